@@ -9,6 +9,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"path/filepath"
 	"runtime"
 	"strings"
 
@@ -24,17 +25,31 @@ import (
 	"github.com/sylabs/singularity/internal/pkg/client/shub"
 	scs "github.com/sylabs/singularity/internal/pkg/remote"
 	"github.com/sylabs/singularity/internal/pkg/util/uri"
+	buildtypes "github.com/sylabs/singularity/pkg/build/types"
 	"github.com/sylabs/singularity/pkg/sylog"
+	useragent "github.com/sylabs/singularity/pkg/util/user-agent"
 )
 
 const (
 	defaultPath = "/bin:/usr/bin:/sbin:/usr/sbin:/usr/local/bin:/usr/local/sbin"
 )
 
+// cacheParentDir returns the directory the image cache is kept in, given by
+// --cachedir or SINGULARITY_CACHEDIR for the commands without the flag, or
+// an empty string for the default one.
+func cacheParentDir() string {
+	if cacheDir != "" {
+		return cacheDir
+	}
+	return os.Getenv(cache.DirEnv)
+}
+
 func getCacheHandle(cfg cache.Config) *cache.Handle {
 	h, err := cache.New(cache.Config{
-		ParentDir: os.Getenv(cache.DirEnv),
-		Disable:   cfg.Disable,
+		ParentDir:       cacheParentDir(),
+		Disable:         cfg.Disable,
+		PreserveOnError: cfg.PreserveOnError,
+		ReadOnly:        cfg.ReadOnly,
 	})
 	if err != nil {
 		sylog.Fatalf("Failed to create an image cache handle: %s", err)
@@ -51,6 +66,11 @@ func actionPreRun(cmd *cobra.Command, args []string) {
 	os.Setenv("USER_PATH", userPath)
 	os.Setenv("PATH", defaultPath)
 
+	// nothing pulled with --tmpfs may be written to the cache
+	if pullTmpfs {
+		disableCache = true
+	}
+
 	// create an handle for the current image cache
 	imgCache := getCacheHandle(cache.Config{Disable: disableCache})
 	if imgCache == nil {
@@ -63,36 +83,41 @@ func actionPreRun(cmd *cobra.Command, args []string) {
 }
 
 func handleOCI(ctx context.Context, imgCache *cache.Handle, cmd *cobra.Command, pullFrom string) (string, error) {
-	ociAuth, err := makeDockerCredentials(cmd)
+	ociAuth, err := makeDockerCredentials(cmd, "")
 	if err != nil {
 		sylog.Fatalf("While creating Docker credentials: %v", err)
 	}
-	return oci.Pull(ctx, imgCache, pullFrom, tmpDir, ociAuth, noHTTPS, false)
+	return oci.Pull(ctx, imgCache, pullFrom, buildtypes.Options{
+		TmpDir:           tmpDir,
+		NoHTTPS:          noHTTPS,
+		DockerAuthConfig: ociAuth,
+	})
 }
 
 func handleOras(ctx context.Context, imgCache *cache.Handle, cmd *cobra.Command, pullFrom string) (string, error) {
-	ociAuth, err := makeDockerCredentials(cmd)
+	ociAuth, err := makeDockerCredentials(cmd, "")
 	if err != nil {
 		return "", fmt.Errorf("while creating docker credentials: %v", err)
 	}
-	return oras.Pull(ctx, imgCache, pullFrom, tmpDir, ociAuth)
+	return oras.Pull(ctx, imgCache, pullFrom, tmpDir, ociAuth, noHTTPS)
 }
 
 func handleLibrary(ctx context.Context, imgCache *cache.Handle, pullFrom, libraryURL string) (string, error) {
 	c := &scslibrary.Config{
 		AuthToken: authToken,
 		BaseURL:   libraryURL,
+		UserAgent: useragent.Value(),
 		Logger:    (golog.Logger)(sylog.DebugLogger{}),
 	}
 	return library.Pull(ctx, imgCache, pullFrom, runtime.GOARCH, tmpDir, c, keyServerURL)
 }
 
 func handleShub(ctx context.Context, imgCache *cache.Handle, pullFrom string) (string, error) {
-	return shub.Pull(ctx, imgCache, pullFrom, tmpDir, noHTTPS)
+	return shub.Pull(ctx, imgCache, pullFrom, tmpDir, noHTTPS, "")
 }
 
 func handleNet(ctx context.Context, imgCache *cache.Handle, pullFrom string) (string, error) {
-	return net.Pull(ctx, imgCache, pullFrom, tmpDir)
+	return net.Pull(ctx, imgCache, pullFrom, tmpDir, false, "")
 }
 
 func replaceURIWithImage(ctx context.Context, imgCache *cache.Handle, cmd *cobra.Command, args []string) {
@@ -105,6 +130,24 @@ func replaceURIWithImage(ctx context.Context, imgCache *cache.Handle, cmd *cobra
 	var image string
 	var err error
 
+	var tmpfs *tmpfsDir
+	if pullTmpfs {
+		base, err := tmpfsBase(tmpDir)
+		if err != nil {
+			sylog.Fatalf("%s", err)
+		}
+		tmpfs, err = newTmpfsDir(cmd.Context(), base)
+		if err != nil {
+			sylog.Fatalf("%s", err)
+		}
+		defer tmpfs.Remove()
+
+		// the files of the pull go to the tmpfs, but not the ones of the
+		// container run
+		defer func(dir string) { tmpDir = dir }(tmpDir)
+		tmpDir = tmpfs.path
+	}
+
 	switch t {
 	case uri.Library:
 		sylabsToken(cmd, args) // Fetch Auth Token for library access
@@ -125,7 +168,21 @@ func replaceURIWithImage(ctx context.Context, imgCache *cache.Handle, cmd *cobra
 	}
 
 	if err != nil {
-		sylog.Fatalf("Unable to handle %s uri: %v", args[0], err)
+		tmpfs.Remove()
+		sylog.Fatalf("Unable to handle %s uri: %v", args[0], tmpfs.Err(err))
+	}
+
+	if tmpfs != nil {
+		image, err = tmpfs.Keep(image)
+		if err == nil {
+			image, err = filepath.Abs(image)
+		}
+		if err != nil {
+			tmpfs.Remove()
+			sylog.Fatalf("%s", err)
+		}
+		// removed once the container exits
+		tmpfsImage = image
 	}
 
 	args[0] = image
@@ -213,6 +213,10 @@ func execStarter(cobraCmd *cobra.Command, image string, args []string, name stri
 			sylog.Fatalf("Failed to determine image absolute path for %s: %s", image, err)
 		}
 		engineConfig.SetImage(abspath)
+		// pulled into a tmpfs by --tmpfs, removed once the container exits
+		if tmpfsImage != "" && abspath == tmpfsImage {
+			engineConfig.SetDeleteImage(true)
+		}
 	}
 
 	// privileged installation by default
@@ -10,12 +10,16 @@ import (
 	"io/ioutil"
 	"os"
 	"runtime"
+	"strings"
 
+	dockerref "github.com/containers/image/v5/docker/reference"
+	dockerconfig "github.com/containers/image/v5/pkg/docker/config"
 	ocitypes "github.com/containers/image/v5/types"
 	"github.com/spf13/cobra"
 	"github.com/sylabs/singularity/docs"
 	scs "github.com/sylabs/singularity/internal/pkg/remote"
 	"github.com/sylabs/singularity/internal/pkg/util/interactive"
+	"github.com/sylabs/singularity/internal/pkg/util/uri"
 	"github.com/sylabs/singularity/pkg/build/types"
 	"github.com/sylabs/singularity/pkg/build/types/parser"
 	"github.com/sylabs/singularity/pkg/cmdline"
@@ -218,6 +222,7 @@ func init() {
 		cmdManager.RegisterFlagForCmd(&commonForceFlag, buildCmd)
 		cmdManager.RegisterFlagForCmd(&commonNoHTTPSFlag, buildCmd)
 		cmdManager.RegisterFlagForCmd(&commonTmpDirFlag, buildCmd)
+		cmdManager.RegisterFlagForCmd(&commonCacheDirFlag, buildCmd)
 
 		cmdManager.RegisterFlagForCmd(&dockerUsernameFlag, buildCmd)
 		cmdManager.RegisterFlagForCmd(&dockerPasswordFlag, buildCmd)
@@ -354,7 +359,11 @@ func definitionFromSpec(spec string) (types.Definition, error) {
 // OCI/Docker registry operation configuration. Note that if we don't have a
 // username or password set it will return a nil pointer, as containers/image
 // requires this to fall back to .docker/config based authentication.
-func makeDockerCredentials(cmd *cobra.Command) (authConf *ocitypes.DockerAuthConfig, err error) {
+//
+// When ref is not empty and an auth file is specified with --auth-file or
+// REGISTRY_AUTH_FILE, the credentials of the entry matching the registry host
+// of ref are returned. Username / password flags take precedence.
+func makeDockerCredentials(cmd *cobra.Command, ref string) (authConf *ocitypes.DockerAuthConfig, err error) {
 	usernameFlag := cmd.Flags().Lookup("docker-username")
 	passwordFlag := cmd.Flags().Lookup("docker-password")
 
@@ -380,12 +389,69 @@ func makeDockerCredentials(cmd *cobra.Command) (authConf *ocitypes.DockerAuthCon
 		return &dockerAuthConfig, nil
 	}
 
+	if ref != "" {
+		return dockerAuthFromFile(ref)
+	}
+
 	// If a username / password have not been explicitly set, return a nil
 	// pointer, which will mean containers/image falls back to looking for
 	// .docker/config.json
 	return nil, nil
 }
 
+// dockerAuthFromFile looks up the credentials for the registry host of ref
+// in the containers-auth.json / docker config.json style file specified by
+// --auth-file, or by the REGISTRY_AUTH_FILE environment variable. A nil
+// pointer is returned if no auth file is set, or no entry matches the host.
+func dockerAuthFromFile(ref string) (*ocitypes.DockerAuthConfig, error) {
+	authFile := dockerAuthFile
+	if authFile == "" {
+		authFile = os.Getenv("REGISTRY_AUTH_FILE")
+	}
+	if authFile == "" {
+		return nil, nil
+	}
+	if _, err := os.Stat(authFile); err != nil {
+		return nil, fmt.Errorf("unable to access auth file: %v", err)
+	}
+
+	host, err := registryHost(ref)
+	if err != nil {
+		return nil, err
+	}
+	if host == "" {
+		return nil, nil
+	}
+
+	sylog.Debugf("Looking up credentials for %s in %s", host, authFile)
+	auth, err := dockerconfig.GetCredentials(&ocitypes.SystemContext{AuthFilePath: authFile}, host)
+	if err != nil {
+		return nil, fmt.Errorf("while reading auth file %s: %v", authFile, err)
+	}
+	if auth.Username == "" && auth.Password == "" && auth.IdentityToken == "" {
+		sylog.Debugf("No credentials found for %s in %s", host, authFile)
+		return nil, nil
+	}
+
+	return &auth, nil
+}
+
+// registryHost returns the registry host of a docker or oras URI, taking care
+// of the implicit docker.io registry. An empty string is returned for
+// transports which are not backed by a registry (e.g. docker-archive).
+func registryHost(ref string) (string, error) {
+	transport, r := uri.Split(ref)
+	if transport != "docker" && transport != OrasProtocol {
+		return "", nil
+	}
+
+	named, err := dockerref.ParseNormalizedNamed(strings.TrimPrefix(r, "//"))
+	if err != nil {
+		return "", fmt.Errorf("while parsing reference %s: %v", ref, err)
+	}
+	return dockerref.Domain(named), nil
+}
+
 // remote builds need to fail if we cannot resolve remote URLS
 func handleRemoteBuildFlags(cmd *cobra.Command) {
 	// if we can load config and if default endpoint is set, use that
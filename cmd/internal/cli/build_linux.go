@@ -219,7 +219,7 @@ func runBuildLocal(ctx context.Context, cmd *cobra.Command, dst, spec string) {
 		sylog.Fatalf("Could not check build sections: %v", err)
 	}
 
-	authConf, err := makeDockerCredentials(cmd)
+	authConf, err := makeDockerCredentials(cmd, "")
 	if err != nil {
 		sylog.Fatalf("While creating Docker credentials: %v", err)
 	}
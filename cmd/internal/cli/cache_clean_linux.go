@@ -9,6 +9,7 @@ import (
 	"bufio"
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
 
 	"github.com/spf13/cobra"
@@ -25,6 +26,7 @@ func init() {
 		cmdManager.RegisterFlagForCmd(&cacheCleanDaysFlag, cacheCleanCmd)
 		cmdManager.RegisterFlagForCmd(&cacheCleanDryFlag, cacheCleanCmd)
 		cmdManager.RegisterFlagForCmd(&cacheCleanForceFlag, cacheCleanCmd)
+		cmdManager.RegisterFlagForCmd(&cacheCleanMaxSizeFlag, cacheCleanCmd)
 	})
 }
 
@@ -33,6 +35,9 @@ var (
 	cacheCleanDays  int
 	cacheCleanDry   bool
 	cacheCleanForce bool
+	// cacheCleanMaxSize is the size the cache is reduced to by removing
+	// the least recently used entries, e.g. 10G.
+	cacheCleanMaxSize string
 
 	// -T|--type
 	cacheCleanTypesFlag = cmdline.Flag{
@@ -71,14 +76,23 @@ var (
 		DefaultValue: false,
 		Name:         "force",
 		ShortHand:    "f",
-		Usage:        "suppress any prompts and clean the cache",
+		Usage:        "suppress any prompts and clean the cache, including the pinned entries",
+	}
+
+	// --max-size
+	cacheCleanMaxSizeFlag = cmdline.Flag{
+		ID:           "cacheCleanMaxSizeFlag",
+		Value:        &cacheCleanMaxSize,
+		DefaultValue: "",
+		Name:         "max-size",
+		Usage:        "remove the least recently used cache entries until the cache uses at most this size, e.g. 10G or 500M, instead of cleaning it all",
 	}
 
 	// cacheCleanCmd is 'singularity cache clean' and will clear your local singularity cache
 	cacheCleanCmd = &cobra.Command{
 		DisableFlagsInUseLine: true,
 		Run: func(cmd *cobra.Command, args []string) {
-			if err := cleanCache(); err != nil {
+			if err := cleanCache(cmd); err != nil {
 				sylog.Fatalf("Handle clean failed: %v", err)
 			}
 		},
@@ -90,12 +104,28 @@ var (
 	}
 )
 
-func cleanCache() error {
+func cleanCache(cmd *cobra.Command) error {
+	var maxSize int64
+	if cacheCleanMaxSize != "" {
+		var err error
+		if maxSize, err = parseSize(cacheCleanMaxSize); err != nil {
+			return fmt.Errorf("invalid --max-size: %v", err)
+		}
+	}
+	// only the entries over the size limit are removed, unless an age
+	// limit is given too
+	cleanAll := cacheCleanMaxSize == ""
+	cleanOld := cleanAll || cmd.Flags().Changed("days")
+
 	if cacheCleanDry {
 		fmt.Println("User requested a dry run. Not actually deleting any data!")
 	}
 	if !cacheCleanForce && !cacheCleanDry {
-		ok, err := cleanCachePrompt()
+		prompt := "This will delete everything in your cache (containers from all sources and OCI blobs) but the pinned entries."
+		if !cleanAll {
+			prompt = fmt.Sprintf("This will delete the least recently used entries of your cache until it uses at most %s, but the pinned entries.", formatBytes(maxSize))
+		}
+		ok, err := cleanCachePrompt(prompt)
 		if err != nil {
 			return fmt.Errorf("could not prompt user: %v", err)
 		}
@@ -107,15 +137,43 @@ func cleanCache() error {
 
 	// create a handle to access the current image cache
 	imgCache := getCacheHandle(cache.Config{})
-	err := singularity.CleanSingularityCache(imgCache, cacheCleanDry, cacheCleanTypes, cacheCleanDays)
-	if err != nil {
-		return fmt.Errorf("could not clean cache: %v", err)
+	if cleanOld {
+		err := singularity.CleanSingularityCache(imgCache, cacheCleanDry, cacheCleanTypes, cacheCleanDays, cacheCleanForce)
+		if err != nil {
+			return fmt.Errorf("could not clean cache: %v", err)
+		}
+	}
+	if !cleanAll {
+		days := -1
+		if cleanOld {
+			days = cacheCleanDays
+		}
+		err := singularity.EvictSingularityCache(imgCache, cacheCleanDry, cacheCleanTypes, maxSize, days, cacheCleanForce)
+		if err != nil {
+			return fmt.Errorf("could not clean cache: %v", err)
+		}
 	}
 	return nil
 }
 
-func cleanCachePrompt() (bool, error) {
-	fmt.Print(`This will delete everything in your cache (containers from all sources and OCI blobs). 
+// parseSize returns the size s in bytes, a number followed by one of the
+// binary multiples K, M, G and T, optionally with an iB or B suffix.
+func parseSize(s string) (int64, error) {
+	n := strings.TrimSuffix(strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(s)), "B"), "I")
+	multiplier := int64(1)
+	if i := strings.IndexAny(n, "KMGT"); i >= 0 && i == len(n)-1 {
+		multiplier = 1 << (10 * uint(strings.IndexByte("KMGT", n[i])+1))
+		n = n[:i]
+	}
+	size, err := strconv.ParseFloat(strings.TrimSpace(n), 64)
+	if err != nil || size < 0 {
+		return 0, fmt.Errorf("%q is not a size such as 10G or 500M", s)
+	}
+	return int64(size * float64(multiplier)), nil
+}
+
+func cleanCachePrompt(prompt string) (bool, error) {
+	fmt.Print(prompt + `
 Hint: You can see exactly what would be deleted by canceling and using the --dry-run option.
 Do you want to continue? [N/y] `)
 
@@ -0,0 +1,33 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import "testing"
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		size    string
+		want    int64
+		wantErr bool
+	}{
+		{size: "1024", want: 1024},
+		{size: "500M", want: 500 << 20},
+		{size: "10GiB", want: 10 << 30},
+		{size: "1.5k", want: 1536},
+		{size: "2TB", want: 2 << 40},
+		{size: "ten", wantErr: true},
+		{size: "-1G", wantErr: true},
+		{size: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseSize(tt.size)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseSize(%q): got error %v, want error %v", tt.size, err, tt.wantErr)
+		} else if got != tt.want {
+			t.Errorf("parseSize(%q): got %d, want %d", tt.size, got, tt.want)
+		}
+	}
+}
@@ -18,6 +18,14 @@ func init() {
 		cmdManager.RegisterCmd(CacheCmd)
 		cmdManager.RegisterSubCmd(CacheCmd, cacheCleanCmd)
 		cmdManager.RegisterSubCmd(CacheCmd, CacheListCmd)
+		cmdManager.RegisterSubCmd(CacheCmd, CacheVerifyCmd)
+		cmdManager.RegisterSubCmd(CacheCmd, CacheMigrateCmd)
+		cmdManager.RegisterSubCmd(CacheCmd, CachePinCmd)
+		cmdManager.RegisterSubCmd(CacheCmd, CacheUnpinCmd)
+		cmdManager.RegisterSubCmd(CacheCmd, CacheStatusCmd)
+
+		cmdManager.RegisterFlagForCmd(&commonCacheDirFlag, cacheCleanCmd, CacheListCmd, CacheVerifyCmd,
+			CacheMigrateCmd, CachePinCmd, CacheUnpinCmd, CacheStatusCmd)
 	})
 }
 
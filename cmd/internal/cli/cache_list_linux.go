@@ -6,6 +6,7 @@
 package cli
 
 import (
+	"encoding/json"
 	"os"
 
 	"github.com/spf13/cobra"
@@ -19,6 +20,8 @@ import (
 var (
 	cacheListTypes   []string
 	cacheListVerbose bool
+	cacheListStats   bool
+	cacheListJSON    bool
 )
 
 // -T|--type
@@ -41,10 +44,30 @@ var cacheListVerboseFlag = cmdline.Flag{
 	Usage:        "include cache entries in the output",
 }
 
+// --stats
+var cacheListStatsFlag = cmdline.Flag{
+	ID:           "cacheListStats",
+	Value:        &cacheListStats,
+	DefaultValue: false,
+	Name:         "stats",
+	Usage:        "show the space saved by deduplication of the cache entries and the largest ones",
+}
+
+// --json
+var cacheListJSONFlag = cmdline.Flag{
+	ID:           "cacheListJSON",
+	Value:        &cacheListJSON,
+	DefaultValue: false,
+	Name:         "json",
+	Usage:        "print the cache entries grouped by type, with their sizes and last use, in JSON format",
+}
+
 func init() {
 	addCmdInit(func(cmdManager *cmdline.CommandManager) {
 		cmdManager.RegisterFlagForCmd(&cacheListTypesFlag, CacheListCmd)
 		cmdManager.RegisterFlagForCmd(&cacheListVerboseFlag, CacheListCmd)
+		cmdManager.RegisterFlagForCmd(&cacheListStatsFlag, CacheListCmd)
+		cmdManager.RegisterFlagForCmd(&cacheListJSONFlag, CacheListCmd)
 	})
 }
 
@@ -70,7 +93,27 @@ func cacheListCmd() error {
 		sylog.Fatalf("failed to create image cache handle")
 	}
 
-	err := singularity.ListSingularityCache(imgCache, cacheListTypes, cacheListVerbose)
+	if cacheListStats && cacheListVerbose {
+		sylog.Fatalf("--stats can't be used with --verbose")
+	}
+
+	if cacheListJSON && (cacheListStats || cacheListVerbose) {
+		sylog.Fatalf("--json can't be used with --stats nor --verbose")
+	}
+
+	var err error
+	if cacheListJSON {
+		var listing *singularity.CacheListing
+		if listing, err = singularity.ListSingularityCacheEntries(imgCache, cacheListTypes); err == nil {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			err = enc.Encode(listing)
+		}
+	} else if cacheListStats {
+		err = singularity.ListSingularityCacheStats(imgCache, cacheListTypes)
+	} else {
+		err = singularity.ListSingularityCache(imgCache, cacheListTypes, cacheListVerbose)
+	}
 	if err != nil {
 		sylog.Fatalf("An error occurred while listing cache: %v", err)
 		return err
@@ -0,0 +1,86 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/sylabs/singularity/docs"
+	"github.com/sylabs/singularity/internal/app/singularity"
+	"github.com/sylabs/singularity/internal/pkg/cache"
+	"github.com/sylabs/singularity/pkg/cmdline"
+	"github.com/sylabs/singularity/pkg/sylog"
+)
+
+var cacheMigrateDry bool
+
+// -n|--dry-run
+var cacheMigrateDryFlag = cmdline.Flag{
+	ID:           "cacheMigrateDryFlag",
+	Value:        &cacheMigrateDry,
+	DefaultValue: false,
+	Name:         "dry-run",
+	ShortHand:    "n",
+	Usage:        "operate in dry run mode and do not actually migrate the cache",
+}
+
+func init() {
+	addCmdInit(func(cmdManager *cmdline.CommandManager) {
+		cmdManager.RegisterFlagForCmd(&cacheMigrateDryFlag, CacheMigrateCmd)
+	})
+}
+
+// CacheMigrateCmd is 'singularity cache migrate' and will move the entries
+// of your local singularity cache stored by older versions to the current
+// layout
+var CacheMigrateCmd = &cobra.Command{
+	DisableFlagsInUseLine: true,
+	Args:                  cobra.ExactArgs(0),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := cacheMigrateCmd(); err != nil {
+			sylog.Fatalf("An error occurred while migrating cache: %v", err)
+		}
+	},
+
+	Use:     docs.CacheMigrateUse,
+	Short:   docs.CacheMigrateShort,
+	Long:    docs.CacheMigrateLong,
+	Example: docs.CacheMigrateExample,
+}
+
+func cacheMigrateCmd() error {
+	imgCache := getCacheHandle(cache.Config{})
+	if imgCache == nil {
+		sylog.Fatalf("failed to create image cache handle")
+	}
+
+	results, err := singularity.MigrateSingularityCache(imgCache, cacheMigrateDry)
+	if err != nil {
+		return err
+	}
+
+	migrated := 0
+	for _, res := range results {
+		switch {
+		case res.Error != "":
+			fmt.Printf("%s cache entry %s: %s, skipped\n", res.Type, res.Name, res.Error)
+		case cacheMigrateDry:
+			fmt.Printf("%s cache entry %s: would be migrated\n", res.Type, res.Name)
+			migrated++
+		default:
+			sylog.Verbosef("%s cache entry %s: migrated", res.Type, res.Name)
+			migrated++
+		}
+	}
+
+	if cacheMigrateDry {
+		fmt.Printf("%d of %d old cache entries would be migrated\n", migrated, len(results))
+	} else {
+		fmt.Printf("Migrated %d of %d old cache entries\n", migrated, len(results))
+	}
+	return nil
+}
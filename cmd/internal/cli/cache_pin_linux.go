@@ -0,0 +1,77 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/sylabs/singularity/docs"
+	"github.com/sylabs/singularity/internal/app/singularity"
+	"github.com/sylabs/singularity/internal/pkg/cache"
+	"github.com/sylabs/singularity/pkg/cmdline"
+	"github.com/sylabs/singularity/pkg/sylog"
+)
+
+var cachePinTypes []string
+
+// -T|--type
+var cachePinTypesFlag = cmdline.Flag{
+	ID:           "cachePinTypesFlag",
+	Value:        &cachePinTypes,
+	DefaultValue: []string{"all"},
+	Name:         "type",
+	ShortHand:    "T",
+	Usage:        "a list of cache types the entry is looked up in (possible values: library, oci-tmp, shub, net, oras, all)",
+}
+
+func init() {
+	addCmdInit(func(cmdManager *cmdline.CommandManager) {
+		cmdManager.RegisterFlagForCmd(&cachePinTypesFlag, CachePinCmd, CacheUnpinCmd)
+	})
+}
+
+// CachePinCmd is 'singularity cache pin' and protects a cache entry from
+// cache cleaning
+var CachePinCmd = &cobra.Command{
+	DisableFlagsInUseLine: true,
+	Args:                  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		cachePinCmd(args[0], true)
+	},
+
+	Use:     docs.CachePinUse,
+	Short:   docs.CachePinShort,
+	Long:    docs.CachePinLong,
+	Example: docs.CachePinExample,
+}
+
+// CacheUnpinCmd is 'singularity cache unpin' and removes the protection of
+// a pinned cache entry
+var CacheUnpinCmd = &cobra.Command{
+	DisableFlagsInUseLine: true,
+	Args:                  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		cachePinCmd(args[0], false)
+	},
+
+	Use:     docs.CacheUnpinUse,
+	Short:   docs.CacheUnpinShort,
+	Long:    docs.CacheUnpinLong,
+	Example: docs.CacheUnpinExample,
+}
+
+func cachePinCmd(name string, pin bool) {
+	imgCache := getCacheHandle(cache.Config{})
+	if imgCache == nil {
+		sylog.Fatalf("failed to create image cache handle")
+	}
+	if imgCache.IsDisabled() {
+		sylog.Fatalf("The cache is disabled")
+	}
+
+	if err := singularity.PinSingularityCache(imgCache, name, cachePinTypes, pin); err != nil {
+		sylog.Fatalf("%v", err)
+	}
+}
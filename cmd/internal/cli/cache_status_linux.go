@@ -0,0 +1,140 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/sylabs/singularity/docs"
+	"github.com/sylabs/singularity/internal/pkg/cache"
+	"github.com/sylabs/singularity/internal/pkg/util/uri"
+	"github.com/sylabs/singularity/pkg/cmdline"
+	"github.com/sylabs/singularity/pkg/sylog"
+)
+
+var cacheStatusJSON bool
+
+// --json
+var cacheStatusJSONFlag = cmdline.Flag{
+	ID:           "cacheStatusJSONFlag",
+	Value:        &cacheStatusJSON,
+	DefaultValue: false,
+	Name:         "json",
+	Usage:        "print the cache status in JSON format",
+}
+
+func init() {
+	addCmdInit(func(cmdManager *cmdline.CommandManager) {
+		cmdManager.RegisterFlagForCmd(&cacheStatusJSONFlag, CacheStatusCmd)
+
+		// the pull flags changing the cache entry of the image
+		cmdManager.RegisterFlagForCmd(&pullLibraryURIFlag, CacheStatusCmd)
+		cmdManager.RegisterFlagForCmd(&pullArchFlag, CacheStatusCmd)
+		cmdManager.RegisterFlagForCmd(&commonNoHTTPSFlag, CacheStatusCmd)
+		cmdManager.RegisterFlagForCmd(&pullNoDecompressFlag, CacheStatusCmd)
+		cmdManager.RegisterFlagForCmd(&pullNoSetuidFlag, CacheStatusCmd)
+		cmdManager.RegisterFlagForCmd(&pullReproducibleFlag, CacheStatusCmd)
+		cmdManager.RegisterFlagForCmd(&pullSquashFlag, CacheStatusCmd)
+		cmdManager.RegisterFlagForCmd(&pullRegistryMirrorFlag, CacheStatusCmd)
+		cmdManager.RegisterFlagForCmd(&dockerUsernameFlag, CacheStatusCmd)
+		cmdManager.RegisterFlagForCmd(&dockerPasswordFlag, CacheStatusCmd)
+		cmdManager.RegisterFlagForCmd(&dockerAuthFileFlag, CacheStatusCmd)
+	})
+}
+
+// CacheStatusCmd is 'singularity cache status' and tells whether an image
+// is in the cache, without pulling it
+var CacheStatusCmd = &cobra.Command{
+	DisableFlagsInUseLine: true,
+	Args:                  cobra.ExactArgs(1),
+	PreRun:                sylabsToken,
+	Run: func(cmd *cobra.Command, args []string) {
+		imgCache := getCacheHandle(cache.Config{})
+		if imgCache == nil {
+			sylog.Fatalf("failed to create image cache handle")
+		}
+		if imgCache.IsDisabled() {
+			sylog.Fatalf("The cache is disabled")
+		}
+
+		if err := cacheStatusCmd(cmd.Context(), cmd, os.Stdout, imgCache, args[0]); err != nil {
+			sylog.Fatalf("%v", err)
+		}
+	},
+
+	Use:     docs.CacheStatusUse,
+	Short:   docs.CacheStatusShort,
+	Long:    docs.CacheStatusLong,
+	Example: docs.CacheStatusExample,
+}
+
+// cacheStatus is the cache status of an image, printed with --json.
+type cacheStatus struct {
+	Image  string `json:"image"`
+	Type   string `json:"type"`
+	Hash   string `json:"hash"`
+	Cached bool   `json:"cached"`
+	Path   string `json:"path,omitempty"`
+	Size   int64  `json:"size,omitempty"`
+}
+
+// cacheStatusCmd writes to w whether the image pullFrom would be served from
+// the cache by a pull, locating its entry as pullRun does.
+func cacheStatusCmd(ctx context.Context, cmd *cobra.Command, w io.Writer, imgCache *cache.Handle, pullFrom string) error {
+	transport, ref := uri.Split(pullFrom)
+	if ref == "" {
+		return fmt.Errorf("bad URI %s", pullFrom)
+	}
+	if transport == LibraryProtocol || transport == "" {
+		handlePullFlags(cmd)
+	}
+
+	mirrored, err := pullMirrorRef(pullFrom)
+	if err != nil {
+		return err
+	}
+	cacheType, hash, err := pullCacheKey(ctx, cmd, transport, mirrored)
+	if cacheType == "" {
+		return fmt.Errorf("%s images are not cached", transportName(transport))
+	}
+	if err != nil {
+		return fmt.Errorf("could not locate the cache entry of %s: %v", pullFrom, err)
+	}
+
+	path, exists, err := imgCache.Lookup(cacheType, hash)
+	if err != nil {
+		return fmt.Errorf("could not check the %s cache entry %s: %v", cacheType, hash, err)
+	}
+	s := cacheStatus{
+		Image:  redactURI(pullFrom),
+		Type:   cacheType,
+		Hash:   hash,
+		Cached: exists,
+	}
+	if exists {
+		s.Path = path
+		if fi, err := os.Stat(path); err == nil {
+			s.Size = fi.Size()
+		}
+	}
+
+	if cacheStatusJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(s)
+	}
+	if s.Cached {
+		fmt.Fprintf(w, "%s is cached: %s (%s)\n", s.Image, s.Path, formatBytes(s.Size))
+	} else {
+		fmt.Fprintf(w, "%s is not cached, it would be downloaded\n", s.Image)
+	}
+	return nil
+}
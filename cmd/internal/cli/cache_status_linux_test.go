@@ -0,0 +1,78 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/sylabs/singularity/internal/pkg/cache"
+	useragent "github.com/sylabs/singularity/pkg/util/user-agent"
+)
+
+func TestCacheStatus(t *testing.T) {
+	useragent.InitValue("singularity", "3.0.0")
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Last-Modified", "Mon, 01 Jun 2020 00:00:00 GMT")
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "cache-status-test-")
+	if err != nil {
+		t.Fatalf("could not create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	// the cache is disabled unless the real user can write to it
+	if err := os.Chmod(dir, 0777); err != nil {
+		t.Fatalf("could not change permissions of %s: %v", dir, err)
+	}
+	imgCache, err := cache.New(cache.Config{ParentDir: dir})
+	if err != nil {
+		t.Fatalf("could not create cache: %v", err)
+	}
+
+	defer func() { cacheStatusJSON = false }()
+	cacheStatusJSON = true
+	status := func() cacheStatus {
+		var b bytes.Buffer
+		if err := cacheStatusCmd(context.Background(), CacheStatusCmd, &b, imgCache, srv.URL+"/image.sif"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		var s cacheStatus
+		if err := json.Unmarshal(b.Bytes(), &s); err != nil {
+			t.Fatalf("could not decode status %q: %v", b.String(), err)
+		}
+		return s
+	}
+
+	s := status()
+	if s.Cached || s.Type != cache.NetCacheType || s.Path != "" {
+		t.Fatalf("unexpected status of image not in the cache: %+v", s)
+	}
+
+	path, _, err := imgCache.Lookup(cache.NetCacheType, s.Hash)
+	if err != nil {
+		t.Fatalf("could not look up cache entry: %v", err)
+	}
+	if err := ioutil.WriteFile(path, []byte("image"), 0644); err != nil {
+		t.Fatalf("could not write cache entry: %v", err)
+	}
+	if s := status(); !s.Cached || s.Path != path || s.Size != 5 {
+		t.Errorf("unexpected status of cached image: %+v", s)
+	}
+
+	var b bytes.Buffer
+	if err := cacheStatusCmd(context.Background(), CacheStatusCmd, &b, imgCache, "scp://host:image.sif"); err == nil {
+		t.Errorf("unexpected success for an scp image")
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/sylabs/singularity/docs"
+	"github.com/sylabs/singularity/internal/app/singularity"
+	"github.com/sylabs/singularity/internal/pkg/cache"
+	"github.com/sylabs/singularity/pkg/cmdline"
+	"github.com/sylabs/singularity/pkg/sylog"
+)
+
+var (
+	cacheVerifyFix  bool
+	cacheVerifyJSON bool
+)
+
+// --fix
+var cacheVerifyFixFlag = cmdline.Flag{
+	ID:           "cacheVerifyFixFlag",
+	Value:        &cacheVerifyFix,
+	DefaultValue: false,
+	Name:         "fix",
+	Usage:        "remove the corrupted cache entries",
+}
+
+// --json
+var cacheVerifyJSONFlag = cmdline.Flag{
+	ID:           "cacheVerifyJSONFlag",
+	Value:        &cacheVerifyJSON,
+	DefaultValue: false,
+	Name:         "json",
+	Usage:        "print the verification results in JSON format",
+}
+
+func init() {
+	addCmdInit(func(cmdManager *cmdline.CommandManager) {
+		cmdManager.RegisterFlagForCmd(&cacheVerifyFixFlag, CacheVerifyCmd)
+		cmdManager.RegisterFlagForCmd(&cacheVerifyJSONFlag, CacheVerifyCmd)
+	})
+}
+
+// CacheVerifyCmd is 'singularity cache verify' and will check the integrity
+// of your local singularity cache
+var CacheVerifyCmd = &cobra.Command{
+	DisableFlagsInUseLine: true,
+	Args:                  cobra.ExactArgs(0),
+	Run: func(cmd *cobra.Command, args []string) {
+		corrupted, err := cacheVerifyCmd()
+		if err != nil {
+			sylog.Fatalf("An error occurred while verifying cache: %v", err)
+		}
+		if corrupted > 0 {
+			os.Exit(1)
+		}
+	},
+
+	Use:     docs.CacheVerifyUse,
+	Short:   docs.CacheVerifyShort,
+	Long:    docs.CacheVerifyLong,
+	Example: docs.CacheVerifyExample,
+}
+
+// cacheVerifyCmd verifies the cache and returns the number of corrupted
+// entries left in it.
+func cacheVerifyCmd() (int, error) {
+	imgCache := getCacheHandle(cache.Config{})
+	if imgCache == nil {
+		sylog.Fatalf("failed to create image cache handle")
+	}
+
+	results, err := singularity.VerifySingularityCache(imgCache, cacheVerifyFix)
+	if err != nil {
+		return 0, err
+	}
+
+	corrupted := 0
+	for _, res := range results {
+		if !res.Valid && !res.Removed {
+			corrupted++
+		}
+	}
+
+	if cacheVerifyJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return corrupted, enc.Encode(results)
+	}
+
+	for _, res := range results {
+		switch {
+		case res.Valid:
+			sylog.Verbosef("%s cache entry %s: OK", res.Type, res.Name)
+		case res.Removed:
+			fmt.Printf("%s cache entry %s: hash mismatch (%s), removed\n", res.Type, res.Name, res.Hash)
+		case res.Error != "":
+			fmt.Printf("%s cache entry %s: %s\n", res.Type, res.Name, res.Error)
+		default:
+			fmt.Printf("%s cache entry %s: hash mismatch (%s)\n", res.Type, res.Name, res.Hash)
+		}
+	}
+	fmt.Printf("Verified %d cache entries, %d corrupted\n", len(results), corrupted)
+	if corrupted > 0 && !cacheVerifyFix {
+		sylog.Infof("Run 'singularity cache verify --fix' to remove the corrupted entries")
+	}
+
+	return corrupted, nil
+}
@@ -6,24 +6,43 @@
 package cli
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"runtime"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
 
+	ocitypes "github.com/containers/image/v5/types"
 	golog "github.com/go-log/log"
 	"github.com/spf13/cobra"
 	"github.com/sylabs/scs-library-client/client"
 	"github.com/sylabs/singularity/docs"
 	"github.com/sylabs/singularity/internal/pkg/cache"
+	singularityclient "github.com/sylabs/singularity/internal/pkg/client"
 	"github.com/sylabs/singularity/internal/pkg/client/library"
-	"github.com/sylabs/singularity/internal/pkg/client/net"
 	"github.com/sylabs/singularity/internal/pkg/client/oci"
-	"github.com/sylabs/singularity/internal/pkg/client/oras"
-	"github.com/sylabs/singularity/internal/pkg/client/shub"
 	scs "github.com/sylabs/singularity/internal/pkg/remote"
+	"github.com/sylabs/singularity/internal/pkg/util/fs"
+	"github.com/sylabs/singularity/internal/pkg/util/interactive"
+	"github.com/sylabs/singularity/internal/pkg/util/machine"
+	"github.com/sylabs/singularity/internal/pkg/util/signal"
 	"github.com/sylabs/singularity/internal/pkg/util/uri"
+	buildtypes "github.com/sylabs/singularity/pkg/build/types"
 	"github.com/sylabs/singularity/pkg/cmdline"
+	"github.com/sylabs/singularity/pkg/pull"
+	"github.com/sylabs/singularity/pkg/pull/policy"
+	"github.com/sylabs/singularity/pkg/signing"
 	"github.com/sylabs/singularity/pkg/sylog"
+	"github.com/sylabs/singularity/pkg/util/singularityconf"
+	useragent "github.com/sylabs/singularity/pkg/util/user-agent"
+	"golang.org/x/crypto/openpgp"
 )
 
 const (
@@ -39,11 +58,19 @@ const (
 	HTTPSProtocol = "https"
 	// OrasProtocol holds the oras URI.
 	OrasProtocol = "oras"
+	// ScpProtocol holds the scp URI, to pull over SSH.
+	ScpProtocol = "scp"
 )
 
+// pullDefaultJobs is the number of images pulled concurrently by default.
+const pullDefaultJobs = 4
+
 var (
 	// pullLibraryURI holds the base URI to a Sylabs library API instance.
 	pullLibraryURI string
+	// pullLibraryAuthFile is the file holding the library token to use
+	// instead of the one of the remote.
+	pullLibraryAuthFile string
 	// pullImageName holds the name to be given to the pulled image.
 	pullImageName string
 	// keyServerURL server URL.
@@ -55,8 +82,131 @@ var (
 	// pullArch is the architecture for which containers will be pulled from the
 	// SCS library.
 	pullArch string
+	// pullAllowUnknownArch when true; skips the validation of pullArch.
+	pullAllowUnknownArch bool
+	// pullNoSetuid when true; strips setuid/setgid/sticky bits from files
+	// extracted from OCI images.
+	pullNoSetuid bool
+	// pullReproducible when true; builds images from OCI sources with
+	// normalized timestamps and identifiers.
+	pullReproducible bool
+	// pullSquash when true; compacts the filesystem of images built from
+	// OCI sources.
+	pullSquash bool
+	// pullListTransports when true; lists the supported transports and exits.
+	pullListTransports bool
+	// pullJSON when true; prints output in JSON format.
+	pullJSON bool
+	// pullFromFile is the path to a file listing the images to pull.
+	pullFromFile string
+	// pullFromStdin when true; pulls the images listed on stdin.
+	pullFromStdin bool
+	// pullJobs is the number of images pulled concurrently with --from-file.
+	pullJobs int
+	// pullVerifyOnly when true; only verifies the image signatures.
+	pullVerifyOnly bool
+	// pullNoDecompress when true; keeps gzip compressed http(s) images as is.
+	pullNoDecompress bool
+	// pullRegistryMirror is the registry docker.io images are pulled from.
+	pullRegistryMirror string
+	// pullNotifyWebhook is the URL the outcome of the pull is posted to.
+	pullNotifyWebhook string
+	// pullResolvedOut is the file the resolved library image is written to.
+	pullResolvedOut string
+	// pullStripSignature when true; removes the signatures of the verified
+	// library image.
+	pullStripSignature bool
+	// pullAllowedHosts are the hosts images may be pulled from.
+	pullAllowedHosts []string
+	// pullManifestOut is the file the images of a batch pull are listed in
+	// along with their hash.
+	pullManifestOut string
+	// pullGroup is the descriptor group extracted from the pulled image.
+	pullGroup uint32
+	// pullConnectTimeout is the time allowed to connect to the remote host
+	// in seconds, zero keeps the default.
+	pullConnectTimeout int
+	// pullRetries is the number of times a download failing with a
+	// transient error is retried.
+	pullRetries int
+	// pullRetryDelay is the delay before the first retry, as a duration.
+	pullRetryDelay string
+	// pullStreamCount is the number of ranges a library image is
+	// downloaded in concurrently.
+	pullStreamCount int
+	// pullSOCKS5 is the SOCKS5 proxy the connections go through.
+	pullSOCKS5 string
+	// pullCopyMethod is the way images are copied out of the cache.
+	pullCopyMethod string
+	// pullPolicyFile is the content trust policy enforced on the pulled
+	// images.
+	pullPolicyFile string
+	// pullVerifyFingerprints are the fingerprints of the keys one of which
+	// must have signed the pulled images.
+	pullVerifyFingerprints []string
+	// pullKeyServers are the key servers the signatures are verified
+	// against, tried in order.
+	pullKeyServers []string
+	// pullLocalKeyring is the keyring file holding trusted keys, searched
+	// for the signers before the key servers.
+	pullLocalKeyring string
+	// pullPreserveCacheOnError when true; keeps the partial cache files of
+	// failed pulls.
+	pullPreserveCacheOnError bool
+	// pullCacheReadOnly when true; uses the cached images without writing
+	// the cache, pulling the others directly to their destination.
+	pullCacheReadOnly bool
+	// pullUserAgent overrides the User-Agent sent with the pull requests.
+	pullUserAgent string
+	// pullIdentity is the SSH private key used to pull scp images.
+	pullIdentity string
+	// pullChecksum is the expected sha256 hash of the pulled image.
+	pullChecksum string
 )
 
+// pullTransport describes a transport supported by pull.
+type pullTransport struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// pullTransports returns the transports handled by pullRun: the built-in
+// ones followed by the ones registered with containers/image. It must be
+// kept in sync with the transport switch in pullRun.
+func pullTransports() []pullTransport {
+	t := []pullTransport{
+		{LibraryProtocol, "image from a Sylabs Cloud library (default)"},
+		{ShubProtocol, "image from Singularity Hub"},
+		{OrasProtocol, "SIF image from an OCI registry supporting ORAS"},
+		{HTTPProtocol, "image from an http URL"},
+		{HTTPSProtocol, "image from an https URL"},
+		{ScpProtocol, "image copied over SSH from a host"},
+	}
+	names := oci.Transports()
+	sort.Strings(names)
+	for _, n := range names {
+		t = append(t, pullTransport{n, oci.Description(n)})
+	}
+	return t
+}
+
+// listPullTransports prints the transports supported by pull.
+func listPullTransports(asJSON bool) error {
+	t := pullTransports()
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(t)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "%s\t%s\n", "TRANSPORT", "DESCRIPTION")
+	for _, p := range t {
+		fmt.Fprintf(tw, "%s\t%s\n", p.Name, p.Description)
+	}
+	return tw.Flush()
+}
+
 // --arch
 var pullArchFlag = cmdline.Flag{
 	ID:           "pullArchFlag",
@@ -67,6 +217,359 @@ var pullArchFlag = cmdline.Flag{
 	EnvKeys:      []string{"PULL_ARCH"},
 }
 
+// --allow-unknown-platform
+var pullAllowUnknownArchFlag = cmdline.Flag{
+	ID:           "pullAllowUnknownArchFlag",
+	Value:        &pullAllowUnknownArch,
+	DefaultValue: false,
+	Name:         "allow-unknown-platform",
+	Usage:        "allow an --arch value not known by singularity",
+	EnvKeys:      []string{"PULL_ALLOW_UNKNOWN_PLATFORM"},
+}
+
+// --no-setuid
+var pullNoSetuidFlag = cmdline.Flag{
+	ID:           "pullNoSetuidFlag",
+	Value:        &pullNoSetuid,
+	DefaultValue: pullNoSetuidDefault(os.Geteuid()),
+	Name:         "no-setuid",
+	Usage:        "strip setuid/setgid/sticky bits from files extracted from OCI images (default on for unprivileged users)",
+	EnvKeys:      []string{"PULL_NO_SETUID"},
+}
+
+// pullNoSetuidDefault returns the default of --no-setuid for the user
+// euid, on for unprivileged users.
+func pullNoSetuidDefault(euid int) bool {
+	return euid != 0
+}
+
+// --reproducible
+var pullReproducibleFlag = cmdline.Flag{
+	ID:           "pullReproducibleFlag",
+	Value:        &pullReproducible,
+	DefaultValue: false,
+	Name:         "reproducible",
+	Usage:        "build a reproducible SIF from OCI sources, with timestamps set to $SOURCE_DATE_EPOCH (or 0)",
+	EnvKeys:      []string{"PULL_REPRODUCIBLE"},
+}
+
+// --squash
+var pullSquashFlag = cmdline.Flag{
+	ID:           "pullSquashFlag",
+	Value:        &pullSquash,
+	DefaultValue: false,
+	Name:         "squash",
+	Usage:        "consolidate the layers of OCI sources into a compact squashfs partition",
+	EnvKeys:      []string{"PULL_SQUASH"},
+}
+
+// --from-file
+var pullFromFileFlag = cmdline.Flag{
+	ID:           "pullFromFileFlag",
+	Value:        &pullFromFile,
+	DefaultValue: "",
+	Name:         "from-file",
+	Usage:        "pull the images listed in the given file, one URI per line",
+	EnvKeys:      []string{"PULL_FROM_FILE"},
+}
+
+// --from-stdin
+var pullFromStdinFlag = cmdline.Flag{
+	ID:           "pullFromStdinFlag",
+	Value:        &pullFromStdin,
+	DefaultValue: false,
+	Name:         "from-stdin",
+	Usage:        "pull the images read from stdin, one URI per line",
+}
+
+// --jobs
+var pullJobsFlag = cmdline.Flag{
+	ID:           "pullJobsFlag",
+	Value:        &pullJobs,
+	DefaultValue: pullDefaultJobs,
+	Name:         "jobs",
+	Usage:        "number of images to pull concurrently with --from-file, --from-stdin or pull mirror",
+	EnvKeys:      []string{"PULL_JOBS"},
+}
+
+// --concurrency, an alias of --jobs
+var pullConcurrencyFlag = cmdline.Flag{
+	ID:           "pullConcurrencyFlag",
+	Value:        &pullJobs,
+	DefaultValue: pullDefaultJobs,
+	Name:         "concurrency",
+	Usage:        "same as --jobs",
+	EnvKeys:      []string{"PULL_CONCURRENCY"},
+}
+
+// --verify-only
+var pullVerifyOnlyFlag = cmdline.Flag{
+	ID:           "pullVerifyOnlyFlag",
+	Value:        &pullVerifyOnly,
+	DefaultValue: false,
+	Name:         "verify-only",
+	Usage:        "only verify the signatures of a library image, without saving it",
+	EnvKeys:      []string{"PULL_VERIFY_ONLY"},
+}
+
+// --no-decompress
+var pullNoDecompressFlag = cmdline.Flag{
+	ID:           "pullNoDecompressFlag",
+	Value:        &pullNoDecompress,
+	DefaultValue: false,
+	Name:         "no-decompress",
+	Usage:        "do not decompress gzip compressed http(s) images",
+	EnvKeys:      []string{"PULL_NO_DECOMPRESS"},
+}
+
+// --registry-mirror
+var pullRegistryMirrorFlag = cmdline.Flag{
+	ID:           "pullRegistryMirrorFlag",
+	Value:        &pullRegistryMirror,
+	DefaultValue: "",
+	Name:         "registry-mirror",
+	Usage:        "pull docker.io images from the provided registry mirror",
+	EnvKeys:      []string{"REGISTRY_MIRROR"},
+}
+
+// --connect-timeout
+var pullConnectTimeoutFlag = cmdline.Flag{
+	ID:           "pullConnectTimeoutFlag",
+	Value:        &pullConnectTimeout,
+	DefaultValue: 0,
+	Name:         "connect-timeout",
+	Usage:        "time allowed to establish a connection to the remote host in seconds, independently of the transfer time (0 keeps the default)",
+	EnvKeys:      []string{"PULL_CONNECT_TIMEOUT"},
+}
+
+// --retries
+var pullRetriesFlag = cmdline.Flag{
+	ID:           "pullRetriesFlag",
+	Value:        &pullRetries,
+	DefaultValue: 0,
+	Name:         "retries",
+	Usage:        "number of times a download failing with a connection reset, a server error or a partial read is retried, resuming it",
+	EnvKeys:      []string{"PULL_RETRIES"},
+}
+
+// --retry-delay
+var pullRetryDelayFlag = cmdline.Flag{
+	ID:           "pullRetryDelayFlag",
+	Value:        &pullRetryDelay,
+	DefaultValue: singularityclient.DefaultRetryDelay.String(),
+	Name:         "retry-delay",
+	Usage:        "delay before the first retry of a download, e.g. 500ms or 2s, doubled after each retry",
+	EnvKeys:      []string{"PULL_RETRY_DELAY"},
+}
+
+// --stream-count
+var pullStreamCountFlag = cmdline.Flag{
+	ID:           "pullStreamCountFlag",
+	Value:        &pullStreamCount,
+	DefaultValue: library.DefaultStreamCount,
+	Name:         "stream-count",
+	Usage:        "number of byte ranges a library image is downloaded in concurrently, when the library serves them, 1 downloading it in a single stream",
+	EnvKeys:      []string{"PULL_STREAM_COUNT"},
+}
+
+// --socks5
+var pullSOCKS5Flag = cmdline.Flag{
+	ID:           "pullSOCKS5Flag",
+	Value:        &pullSOCKS5,
+	DefaultValue: "",
+	Name:         "socks5",
+	Usage:        "connect through the SOCKS5 proxy [user[:password]@]host:port, taking precedence over the HTTP proxies of the environment",
+	EnvKeys:      []string{"PULL_SOCKS5"},
+}
+
+// --copy-method
+var pullCopyMethodFlag = cmdline.Flag{
+	ID:           "pullCopyMethodFlag",
+	Value:        &pullCopyMethod,
+	DefaultValue: string(fs.CopyAuto),
+	Name:         "copy-method",
+	Usage:        "copy images out of the cache with a reflink, failing where unsupported (reflink), by streaming them (stream), or with the fastest method available (auto)",
+	EnvKeys:      []string{"PULL_COPY_METHOD"},
+}
+
+// --policy
+var pullPolicyFileFlag = cmdline.Flag{
+	ID:           "pullPolicyFileFlag",
+	Value:        &pullPolicyFile,
+	DefaultValue: "",
+	Name:         "policy",
+	Usage:        "enforce the content trust policy of the given YAML or JSON file on the pulled images",
+	EnvKeys:      []string{"PULL_POLICY"},
+}
+
+// --verify-fingerprint
+var pullVerifyFingerprintFlag = cmdline.Flag{
+	ID:           "pullVerifyFingerprintFlag",
+	Value:        &pullVerifyFingerprints,
+	DefaultValue: []string{},
+	Name:         "verify-fingerprint",
+	Usage:        "require the image to be signed by the key with the given fingerprint, can be repeated to accept any of several keys",
+	EnvKeys:      []string{"PULL_VERIFY_FINGERPRINT"},
+}
+
+// --preserve-cache-on-error
+var pullPreserveCacheOnErrorFlag = cmdline.Flag{
+	ID:           "pullPreserveCacheOnErrorFlag",
+	Value:        &pullPreserveCacheOnError,
+	DefaultValue: false,
+	Name:         "preserve-cache-on-error",
+	Usage:        "keep the partial cache files of a failed pull for inspection instead of removing them",
+	EnvKeys:      []string{"PRESERVE_CACHE_ON_ERROR"},
+}
+
+// --cache-readonly
+var pullCacheReadOnlyFlag = cmdline.Flag{
+	ID:           "pullCacheReadOnlyFlag",
+	Value:        &pullCacheReadOnly,
+	DefaultValue: false,
+	Name:         "cache-readonly",
+	Usage:        "use the cached images without writing the cache, e.g. a shared read-only mount, the images not cached being pulled directly to their destination",
+	EnvKeys:      []string{"CACHE_READONLY"},
+}
+
+// --keyserver
+var pullKeyServersFlag = cmdline.Flag{
+	ID:           "pullKeyServersFlag",
+	Value:        &pullKeyServers,
+	DefaultValue: []string{},
+	Name:         "keyserver",
+	Usage:        "verify signatures against the given key server instead of the remote one, can be comma separated or repeated to fall back on the next key servers",
+	EnvKeys:      []string{"PULL_KEYSERVER"},
+}
+
+// --local-keyring
+var pullLocalKeyringFlag = cmdline.Flag{
+	ID:           "pullLocalKeyringFlag",
+	Value:        &pullLocalKeyring,
+	DefaultValue: "",
+	Name:         "local-keyring",
+	Usage:        "verify signatures against the public keys of the given keyring file first, before the local keyring and the key servers",
+	EnvKeys:      []string{"PULL_LOCAL_KEYRING"},
+}
+
+// --identity
+var pullIdentityFlag = cmdline.Flag{
+	ID:           "pullIdentityFlag",
+	Value:        &pullIdentity,
+	DefaultValue: "",
+	Name:         "identity",
+	Usage:        "SSH private key to authenticate with when pulling scp:// images, in addition to the keys of the SSH agent",
+	EnvKeys:      []string{"PULL_IDENTITY"},
+}
+
+// --checksum
+var pullChecksumFlag = cmdline.Flag{
+	ID:           "pullChecksumFlag",
+	Value:        &pullChecksum,
+	DefaultValue: "",
+	Name:         "checksum",
+	Usage:        "expected sha256 hash of the pulled image, the image is removed if it does not match (e.g. --checksum sha256:7f0d...)",
+	EnvKeys:      []string{"PULL_CHECKSUM"},
+}
+
+// --digest
+var pullDigestFlag = cmdline.Flag{
+	ID:           "pullDigestFlag",
+	Value:        &pullChecksum,
+	DefaultValue: "",
+	Name:         "digest",
+	Usage:        "same as --checksum: expected sha256 hash of the pulled image, checked before http(s) and shub images are cached",
+	EnvKeys:      []string{"PULL_DIGEST"},
+}
+
+// --notify-webhook
+var pullNotifyWebhookFlag = cmdline.Flag{
+	ID:           "pullNotifyWebhookFlag",
+	Value:        &pullNotifyWebhook,
+	DefaultValue: "",
+	Name:         "notify-webhook",
+	Usage:        "POST a JSON summary of the pull to the provided URL when it finishes",
+	EnvKeys:      []string{"PULL_NOTIFY_WEBHOOK"},
+}
+
+// --resolved-out
+var pullResolvedOutFlag = cmdline.Flag{
+	ID:           "pullResolvedOutFlag",
+	Value:        &pullResolvedOut,
+	DefaultValue: "",
+	Name:         "resolved-out",
+	Usage:        "write the tags and hash the library image resolved to in the given file, in JSON format",
+	EnvKeys:      []string{"PULL_RESOLVED_OUT"},
+}
+
+// --strip-signature
+var pullStripSignatureFlag = cmdline.Flag{
+	ID:           "pullStripSignatureFlag",
+	Value:        &pullStripSignature,
+	DefaultValue: false,
+	Name:         "strip-signature",
+	Usage:        "remove the signatures of the library image once verified",
+	EnvKeys:      []string{"PULL_STRIP_SIGNATURE"},
+}
+
+// --allowed-host
+var pullAllowedHostsFlag = cmdline.Flag{
+	ID:           "pullAllowedHostsFlag",
+	Value:        &pullAllowedHosts,
+	DefaultValue: []string{},
+	Name:         "allowed-host",
+	Usage:        "only allow pulling from the given host, can be repeated (e.g. --allowed-host library.sylabs.io --allowed-host '*.example.com')",
+	EnvKeys:      []string{"PULL_ALLOWED_HOSTS"},
+}
+
+// --manifest-out
+var pullManifestOutFlag = cmdline.Flag{
+	ID:           "pullManifestOutFlag",
+	Value:        &pullManifestOut,
+	DefaultValue: "",
+	Name:         "manifest-out",
+	Usage:        "with --from-file, --from-stdin or pull mirror, list the URI, path and sha256 hash of the pulled images in the given file",
+	EnvKeys:      []string{"PULL_MANIFEST_OUT"},
+}
+
+// --group
+var pullGroupFlag = cmdline.Flag{
+	ID:           "pullGroupFlag",
+	Value:        &pullGroup,
+	DefaultValue: uint32(0),
+	Name:         "group",
+	Usage:        "only keep the data objects of the given descriptor group ID of a SIF image",
+	EnvKeys:      []string{"PULL_GROUP"},
+}
+
+// --user-agent
+var pullUserAgentFlag = cmdline.Flag{
+	ID:           "pullUserAgentFlag",
+	Value:        &pullUserAgent,
+	DefaultValue: "",
+	Name:         "user-agent",
+	Usage:        "User-Agent sent with the pull requests (default identifies the Singularity version)",
+	EnvKeys:      []string{"USER_AGENT"},
+}
+
+// --list-transports
+var pullListTransportsFlag = cmdline.Flag{
+	ID:           "pullListTransportsFlag",
+	Value:        &pullListTransports,
+	DefaultValue: false,
+	Name:         "list-transports",
+	Usage:        "list the supported transports and exit",
+}
+
+// --json
+var pullJSONFlag = cmdline.Flag{
+	ID:           "pullJSONFlag",
+	Value:        &pullJSON,
+	DefaultValue: false,
+	Name:         "json",
+	Usage:        "print output in JSON format, the transports with --list-transports, the results of pull check or a summary of each image pulled",
+}
+
 // --library
 var pullLibraryURIFlag = cmdline.Flag{
 	ID:           "pullLibraryURIFlag",
@@ -77,6 +580,26 @@ var pullLibraryURIFlag = cmdline.Flag{
 	EnvKeys:      []string{"LIBRARY"},
 }
 
+// --library-auth-file
+var pullLibraryAuthFileFlag = cmdline.Flag{
+	ID:           "pullLibraryAuthFileFlag",
+	Value:        &pullLibraryAuthFile,
+	DefaultValue: "",
+	Name:         "library-auth-file",
+	Usage:        "read the library token from the given file, overriding the one of the remote and SYLABS_TOKEN",
+	EnvKeys:      []string{"LIBRARY_AUTH_FILE"},
+}
+
+// --output
+var pullOutputFlag = cmdline.Flag{
+	ID:           "pullOutputFlag",
+	Value:        &pullImageName,
+	DefaultValue: "",
+	Name:         "output",
+	Usage:        "write the image to the given file instead of the destination argument, - for stdout",
+	EnvKeys:      []string{"PULL_OUTPUT"},
+}
+
 // --name
 var pullNameFlag = cmdline.Flag{
 	ID:           "pullNameFlag",
@@ -108,6 +631,16 @@ var pullDisableCacheFlag = cmdline.Flag{
 	EnvKeys:      []string{"DISABLE_CACHE"},
 }
 
+// --no-cache, an alias of --disable-cache
+var pullNoCacheFlag = cmdline.Flag{
+	ID:           "pullNoCacheFlag",
+	Value:        &disableCache,
+	DefaultValue: false,
+	Name:         "no-cache",
+	Usage:        "same as --disable-cache: download the image directly to its destination, verified there",
+	EnvKeys:      []string{"PULL_NO_CACHE"},
+}
+
 // -U|--allow-unsigned
 var pullAllowUnsignedFlag = cmdline.Flag{
 	ID:           "pullAllowUnauthenticatedFlag",
@@ -123,11 +656,11 @@ var pullAllowUnsignedFlag = cmdline.Flag{
 // --allow-unauthenticated
 var pullAllowUnauthenticatedFlag = cmdline.Flag{
 	ID:           "pullAllowUnauthenticatedFlag",
-	Value:        &unauthenticatedPull,
+	Value:        &pullNoVerify,
 	DefaultValue: false,
 	Name:         "allow-unauthenticated",
 	ShortHand:    "",
-	Usage:        "do not require a signed container",
+	Usage:        "same as --no-verify: do not require a signed container",
 	EnvKeys:      []string{"ALLOW_UNAUTHENTICATED"},
 	Hidden:       true,
 }
@@ -135,30 +668,103 @@ var pullAllowUnauthenticatedFlag = cmdline.Flag{
 func init() {
 	addCmdInit(func(cmdManager *cmdline.CommandManager) {
 		cmdManager.RegisterCmd(PullCmd)
+		cmdManager.RegisterSubCmd(PullCmd, PullMirrorCmd)
+		cmdManager.RegisterSubCmd(PullCmd, PullCheckCmd)
+		cmdManager.RegisterSubCmd(PullCmd, PullDiffCmd)
 
 		cmdManager.RegisterFlagForCmd(&commonForceFlag, PullCmd)
-		cmdManager.RegisterFlagForCmd(&pullLibraryURIFlag, PullCmd)
+		cmdManager.RegisterFlagForCmd(&pullOnConflictFlag, PullCmd)
+		cmdManager.RegisterFlagForCmd(&pullFollowSymlinkFlag, PullCmd)
+		cmdManager.RegisterFlagForCmd(&pullIfNotPresentFlag, PullCmd)
+		cmdManager.RegisterFlagForCmd(&pullLibraryURIFlag, PullCmd, PullMirrorCmd, PullCheckCmd, PullDiffCmd)
+		cmdManager.RegisterFlagForCmd(&pullLibraryAuthFileFlag, PullCmd, PullMirrorCmd, PullCheckCmd, PullDiffCmd)
 		cmdManager.RegisterFlagForCmd(&pullNameFlag, PullCmd)
+		cmdManager.RegisterFlagForCmd(&pullOutputFlag, PullCmd)
+		cmdManager.RegisterFlagForCmd(&pullSearchFlag, PullCmd)
+		cmdManager.RegisterFlagForCmd(&pullTakeFirstFlag, PullCmd)
 		cmdManager.RegisterFlagForCmd(&commonNoHTTPSFlag, PullCmd)
-		cmdManager.RegisterFlagForCmd(&commonTmpDirFlag, PullCmd)
-		cmdManager.RegisterFlagForCmd(&pullDisableCacheFlag, PullCmd)
+		cmdManager.RegisterFlagForCmd(&commonTmpDirFlag, PullCmd, PullMirrorCmd, PullDiffCmd)
+		cmdManager.RegisterFlagForCmd(&commonCacheDirFlag, PullCmd, PullMirrorCmd, PullDiffCmd)
+		cmdManager.RegisterFlagForCmd(&pullDisableCacheFlag, PullCmd, PullMirrorCmd, PullDiffCmd)
+		cmdManager.RegisterFlagForCmd(&pullNoCacheFlag, PullCmd, PullMirrorCmd, PullDiffCmd)
 		cmdManager.RegisterFlagForCmd(&pullDirFlag, PullCmd)
 
 		cmdManager.RegisterFlagForCmd(&dockerUsernameFlag, PullCmd)
 		cmdManager.RegisterFlagForCmd(&dockerPasswordFlag, PullCmd)
 		cmdManager.RegisterFlagForCmd(&dockerLoginFlag, PullCmd)
+		cmdManager.RegisterFlagForCmd(&dockerAuthFileFlag, PullCmd)
 
 		cmdManager.RegisterFlagForCmd(&buildNoCleanupFlag, PullCmd)
 		cmdManager.RegisterFlagForCmd(&pullAllowUnsignedFlag, PullCmd)
 		cmdManager.RegisterFlagForCmd(&pullAllowUnauthenticatedFlag, PullCmd)
-		cmdManager.RegisterFlagForCmd(&pullArchFlag, PullCmd)
+		cmdManager.RegisterFlagForCmd(&pullArchFlag, PullCmd, PullDiffCmd)
+		cmdManager.RegisterFlagForCmd(&pullAllowUnknownArchFlag, PullCmd)
+		cmdManager.RegisterFlagForCmd(&pullArchFallbackFlag, PullCmd)
+		cmdManager.RegisterFlagForCmd(&pullExpectedArchFlag, PullCmd)
+		cmdManager.RegisterFlagForCmd(&pullAllowArchMismatchFlag, PullCmd)
+		cmdManager.RegisterFlagForCmd(&pullNoSetuidFlag, PullCmd)
+		cmdManager.RegisterFlagForCmd(&pullReproducibleFlag, PullCmd)
+		cmdManager.RegisterFlagForCmd(&pullSquashFlag, PullCmd)
+		cmdManager.RegisterFlagForCmd(&pullTmpfsFlag, PullCmd)
+		cmdManager.RegisterFlagForCmd(&pullFromFileFlag, PullCmd)
+		cmdManager.RegisterFlagForCmd(&pullFromStdinFlag, PullCmd)
+		cmdManager.RegisterFlagForCmd(&pullJobsFlag, PullCmd, PullMirrorCmd)
+		cmdManager.RegisterFlagForCmd(&pullConcurrencyFlag, PullCmd, PullMirrorCmd)
+		cmdManager.RegisterFlagForCmd(&pullVerifyOnlyFlag, PullCmd)
+		cmdManager.RegisterFlagForCmd(&pullDownloadOnlyFlag, PullCmd)
+		cmdManager.RegisterFlagForCmd(&pullNoDecompressFlag, PullCmd)
+		cmdManager.RegisterFlagForCmd(&pullRegistryMirrorFlag, PullCmd)
+		cmdManager.RegisterFlagForCmd(&pullUserAgentFlag, PullCmd)
+		cmdManager.RegisterFlagForCmd(&pullConnectTimeoutFlag, PullCmd)
+		cmdManager.RegisterFlagForCmd(&pullRetriesFlag, PullCmd)
+		cmdManager.RegisterFlagForCmd(&pullRetryDelayFlag, PullCmd)
+		cmdManager.RegisterFlagForCmd(&pullStreamCountFlag, PullCmd)
+		cmdManager.RegisterFlagForCmd(&pullSOCKS5Flag, PullCmd)
+		cmdManager.RegisterFlagForCmd(&pullCopyMethodFlag, PullCmd)
+		cmdManager.RegisterFlagForCmd(&pullPolicyFileFlag, PullCmd)
+		cmdManager.RegisterFlagForCmd(&pullFailOnUnsignedFlag, PullCmd, PullMirrorCmd)
+		cmdManager.RegisterFlagForCmd(&pullRequireSignatureFlag, PullCmd, PullMirrorCmd)
+		cmdManager.RegisterFlagForCmd(&pullVerifyFlag, PullCmd, PullMirrorCmd)
+		cmdManager.RegisterFlagForCmd(&pullNoVerifyFlag, PullCmd)
+		cmdManager.RegisterFlagForCmd(&pullVerifyFingerprintFlag, PullCmd)
+		cmdManager.RegisterFlagForCmd(&pullKeyServersFlag, PullCmd, PullCheckCmd, PullDiffCmd)
+		cmdManager.RegisterFlagForCmd(&pullLocalKeyringFlag, PullCmd)
+		cmdManager.RegisterFlagForCmd(&pullPreserveCacheOnErrorFlag, PullCmd)
+		cmdManager.RegisterFlagForCmd(&pullCacheReadOnlyFlag, PullCmd)
+		cmdManager.RegisterFlagForCmd(&pullIdentityFlag, PullCmd)
+		cmdManager.RegisterFlagForCmd(&pullChecksumFlag, PullCmd)
+		cmdManager.RegisterFlagForCmd(&pullDigestFlag, PullCmd)
+		cmdManager.RegisterFlagForCmd(&pullScanFlag, PullCmd)
+		cmdManager.RegisterFlagForCmd(&pullScanCommandFlag, PullCmd)
+		cmdManager.RegisterFlagForCmd(&pullScanCleanExitCodeFlag, PullCmd)
+		cmdManager.RegisterFlagForCmd(&pullExplainFlag, PullCmd)
+		cmdManager.RegisterFlagForCmd(&pullDryRunFlag, PullCmd)
+		cmdManager.RegisterFlagForCmd(&pullDeffileOnlyFlag, PullCmd)
+		cmdManager.RegisterFlagForCmd(&pullNotifyWebhookFlag, PullCmd)
+		cmdManager.RegisterFlagForCmd(&pullReportToFlag, PullCmd)
+		cmdManager.RegisterFlagForCmd(&pullReportImageNamesFlag, PullCmd)
+		cmdManager.RegisterFlagForCmd(&pullResolvedOutFlag, PullCmd)
+		cmdManager.RegisterFlagForCmd(&pullAttestationOutFlag, PullCmd)
+		cmdManager.RegisterFlagForCmd(&pullSignKeyFlag, PullCmd)
+		cmdManager.RegisterFlagForCmd(&pullStripSignatureFlag, PullCmd)
+		cmdManager.RegisterFlagForCmd(&pullAllowedHostsFlag, PullCmd)
+		cmdManager.RegisterFlagForCmd(&pullManifestOutFlag, PullCmd, PullMirrorCmd)
+		cmdManager.RegisterFlagForCmd(&pullDedupFlag, PullCmd, PullMirrorCmd)
+		cmdManager.RegisterFlagForCmd(&pullGroupFlag, PullCmd)
+		cmdManager.RegisterFlagForCmd(&pullOutputFormatFlag, PullCmd)
+		cmdManager.RegisterFlagForCmd(&pullListTransportsFlag, PullCmd)
+		cmdManager.RegisterFlagForCmd(&pullJSONFlag, PullCmd, PullCheckCmd)
+		cmdManager.RegisterFlagForCmd(&pullNoAliasFlag, PullCmd)
+		cmdManager.RegisterFlagForCmd(&pullTraceFlag, PullCmd)
+		cmdManager.RegisterFlagForCmd(&pullRekorFlag, PullCmd, PullMirrorCmd)
+		cmdManager.RegisterFlagForCmd(&pullSkipRekorFlag, PullCmd, PullMirrorCmd)
 	})
 }
 
 // PullCmd singularity pull
 var PullCmd = &cobra.Command{
 	DisableFlagsInUseLine: true,
-	Args:                  cobra.RangeArgs(1, 2),
+	Args:                  pullArgs,
 	PreRun:                sylabsToken,
 	Run:                   pullRun,
 	Use:                   docs.PullUse,
@@ -167,97 +773,875 @@ var PullCmd = &cobra.Command{
 	Example:               docs.PullExample,
 }
 
+// pullArgs checks the pull arguments, none are accepted with --list-transports,
+// --from-file or --from-stdin, only the destination with --search and only
+// the image with --download-only.
+func pullArgs(cmd *cobra.Command, args []string) error {
+	if pullListTransports || pullFromFile != "" || pullFromStdin {
+		return cobra.NoArgs(cmd, args)
+	}
+	if pullSearch != "" {
+		return cobra.MaximumNArgs(1)(cmd, args)
+	}
+	if pullDownloadOnly {
+		return cobra.ExactArgs(1)(cmd, args)
+	}
+	return cobra.RangeArgs(1, 2)(cmd, args)
+}
+
 func pullRun(cmd *cobra.Command, args []string) {
-	ctx := cmd.Context()
+	// a first Ctrl-C cancels the pull, which removes its partial files, a
+	// second one quits without waiting for the removal
+	ctx, cancel := context.WithCancel(cmd.Context())
+	stop := signal.HandleInterrupt(cancel, os.Interrupt)
+	defer func() {
+		stop()
+		cancel()
+	}()
+	runPull(ctx, cmd, args)
+}
+
+// runPull runs the pull command with args until ctx is done.
+func runPull(ctx context.Context, cmd *cobra.Command, args []string) {
+	if pullListTransports {
+		if err := listPullTransports(pullJSON); err != nil {
+			sylog.Fatalf("While listing transports: %v", err)
+		}
+		return
+	}
 
-	imgCache := getCacheHandle(cache.Config{Disable: disableCache})
+	ctx, attestKey, err := pullSetup(ctx, args)
+	if err != nil {
+		sylog.Fatalf("%s", err)
+	}
+
+	var tmpfs string
+	if pullTmpfs {
+		tmpfs, err = tmpfsBase(tmpDir)
+		if err != nil {
+			sylog.Fatalf("%s", err)
+		}
+		// nothing may be written to the cache
+		disableCache = true
+	}
+
+	imgCache := pullCacheHandle(cache.Config{
+		Disable:         disableCache,
+		PreserveOnError: pullPreserveCacheOnError,
+		ReadOnly:        pullCacheReadOnly,
+	})
 	if imgCache == nil {
 		sylog.Fatalf("Failed to create an image cache handle")
 	}
-
-	pullFrom := args[len(args)-1]
-	transport, ref := uri.Split(pullFrom)
-	if ref == "" {
-		sylog.Fatalf("Bad URI %s", pullFrom)
+	if err := pullCheckDownloadOnly(imgCache); err != nil {
+		sylog.Fatalf("%s", err)
 	}
 
-	pullTo := pullImageName
-	if pullTo == "" {
-		pullTo = args[0]
-		if len(args) == 1 {
-			if transport == "" {
-				pullTo = uri.GetName("library://" + pullFrom)
-			} else {
-				pullTo = uri.GetName(pullFrom) // TODO: If not library/shub & no name specified, simply put to cache
-			}
+	if pullFromFile != "" || pullFromStdin {
+		if err := pullRunBatch(ctx, cmd, imgCache, tmpfs); err != nil {
+			exitIfUnsigned(err)
+			sylog.Fatalf("%s", err)
 		}
+		return
 	}
 
-	if pullDir != "" {
-		pullTo = filepath.Join(pullDir, pullTo)
+	if pullManifestOut != "" {
+		sylog.Fatalf("--manifest-out can only be used with --from-file or --from-stdin")
+	}
+	if pullDedup {
+		sylog.Fatalf("--dedup can only be used with --from-file or --from-stdin")
 	}
 
-	_, err := os.Stat(pullTo)
-	if !os.IsNotExist(err) {
-		// image already exists
-		if !forceOverwrite {
-			sylog.Fatalf("Image file already exists: %q - will not overwrite", pullTo)
+	var opts pullImageOptions
+	if pullChecksum != "" {
+		hash, err := parseSHA256(pullChecksum)
+		if err != nil {
+			sylog.Fatalf("Invalid --checksum: %v", err)
 		}
+		opts.sha256 = hash
+	}
+
+	if pullTrace {
+		ctx, _ = singularityclient.WithTrace(ctx)
 	}
+	endResolve := singularityclient.StartPhase(ctx, singularityclient.PhaseResolve)
 
-	switch transport {
-	case LibraryProtocol, "":
+	if pullSearch != "" {
 		handlePullFlags(cmd)
+		// stdout only holds the summary with --json, or the image
+		w := os.Stdout
+		if pullJSON || pullToStdout {
+			w = os.Stderr
+		}
+		ref, err := pullSearchRef(ctx, w)
+		if err != nil {
+			sylog.Fatalf("%s", err)
+		}
+		sylog.Infof("Pulling %s", ref)
+		args = append(args, ref)
+	} else {
+		args[len(args)-1] = pullExpandAlias(args[len(args)-1])
+	}
+
+	if pullExplain {
+		explainPull(ctx, cmd, os.Stdout, imgCache, args)
+		return
+	}
 
-		libraryConfig := &client.Config{
-			BaseURL:   pullLibraryURI,
-			AuthToken: authToken,
-			Logger:    (golog.Logger)(sylog.DebugLogger{}),
+	// the canonical URI is used from here on, in messages and reports
+	transport, ref, err := uri.Normalize(args[len(args)-1])
+	if err != nil {
+		sylog.Fatalf("Bad URI %s: %v", args[len(args)-1], err)
+	}
+	pullFrom := transport + ":" + ref
+	if err := pullCheckArchFallback(cmd, transport); err != nil {
+		sylog.Fatalf("%s", err)
+	}
+	if pullToStdout {
+		if err := pullCheckStdoutTransport(transport); err != nil {
+			sylog.Fatalf("%s", err)
 		}
+	}
 
-		_, err = library.PullToFile(ctx, imgCache, pullTo, pullFrom, pullArch, tmpDir, libraryConfig, keyServerURL)
-		if err != nil && err != library.ErrLibraryPullUnsigned {
-			sylog.Fatalf("While pulling library image: %v", err)
+	// enforced before any request is made
+	if err := pullCheckHosts(cmd, pullFrom); err != nil {
+		sylog.Fatalf("%s", err)
+	}
+	if pullIfNotPresent {
+		if pullTo := pullDestination(cmd, args, transport, pullFrom, tmpfs); pullPresent(pullTo) {
+			sylog.Infof("Image file already exists: %q - not pulling it (--if-not-present)", pullTo)
+			return
+		}
+	}
+
+	if pullVerifyOnly {
+		if err := pullVerify(ctx, imgCache, pullFrom); err != nil {
+			sylog.Fatalf("Verification failed: %s", err)
+		}
+		sylog.Infof("Verification passed: %s", pullFrom)
+		return
+	}
+
+	if transport == LibraryProtocol || transport == "" {
+		if err := pullDefaultArch(cmd, pullFrom); err != nil {
+			sylog.Fatalf("%s", err)
+		}
+		if len(pullArchFallback) > 0 {
+			arch, err := pullFallbackLibraryArch(ctx, pullFrom)
+			if err != nil {
+				sylog.Fatalf("While resolving library image: %s", err)
+			}
+			logFallbackArch(arch)
+			pullArch = arch
+		}
+	} else if pullResolvedOut != "" {
+		sylog.Fatalf("--resolved-out is only supported for library images")
+	}
+	endResolve()
+
+	var resolvedRef *library.ResolvedRef
+	if pullResolvedOut != "" {
+		// the image the user selects, if not found, is pulled from here on
+		pullFrom, err = pullRetryResolved(ctx, cmd, pullFrom, func(ref string) (err error) {
+			resolvedRef, err = library.Resolve(ctx, pullLibraryConfig(), ref, pullArch)
+			return err
+		})
+		if err != nil {
+			sylog.Fatalf("While resolving library image: %s", err)
+		}
+		sylog.Verbosef("%s resolved to %s", resolvedRef.Ref, resolvedRef.Pinned)
+	}
+
+	if pullDownloadOnly {
+		pullFrom, ociAuth, err := pullSource(ctx, cmd, pullFrom, &opts)
+		if err != nil {
+			sylog.Fatalf("%s", err)
+		}
+		var path string
+		pullFrom, err = pullRetryResolved(ctx, cmd, pullFrom, func(ref string) (err error) {
+			path, err = pullDownload(ctx, imgCache, ref, ociAuth, opts)
+			return err
+		})
+		if err != nil {
+			sylog.Fatalf("%s", err)
+		}
+		sylog.Infof("Downloaded %s to the cache", redactURI(pullFrom))
+		fmt.Println(path)
+		if err := writeResolvedRef(pullResolvedOut, resolvedRef); err != nil {
+			sylog.Fatalf("While writing resolved image: %s", err)
+		}
+		return
+	}
+
+	if pullDeffileOnly {
+		if pullOutputFormat != formatSIF {
+			sylog.Fatalf("--output-format %s can't be used with --deffile-only", pullOutputFormat)
+		}
+		err := pullDeffile(ctx, cmd, imgCache, args, pullFrom, opts)
+		pullReportFlush()
+		if err != nil {
+			sylog.Fatalf("%s", err)
 		}
-		if err == library.ErrLibraryPullUnsigned {
-			sylog.Warningf("Skipping container verification")
+		if err := writeResolvedRef(pullResolvedOut, resolvedRef); err != nil {
+			sylog.Fatalf("While writing resolved image: %s", err)
 		}
-	case ShubProtocol:
-		_, err := shub.PullToFile(ctx, imgCache, pullTo, pullFrom, tmpDir, noHTTPS)
+		return
+	}
+
+	if pullToStdout {
+		pullFrom, ociAuth, err := pullSource(ctx, cmd, pullFrom, &opts)
 		if err != nil {
-			sylog.Fatalf("While pulling shub image: %v\n", err)
+			sylog.Fatalf("%s", err)
 		}
-	case OrasProtocol:
-		ociAuth, err := makeDockerCredentials(cmd)
+		_, err = pullRetryResolved(ctx, cmd, pullFrom, func(ref string) error {
+			return pullStdout(ctx, os.Stdout, imgCache, ref, ociAuth, opts)
+		})
+		pullReportFlush()
+		pullNotify(ctx, pullFrom, pullStdoutName, err)
 		if err != nil {
-			sylog.Fatalf("Unable to make docker oci credentials: %s", err)
+			exitIfUnsigned(err)
+			sylog.Fatalf("%s", err)
+		}
+		if err := writeResolvedRef(pullResolvedOut, resolvedRef); err != nil {
+			sylog.Fatalf("While writing resolved image: %s", err)
+		}
+		return
+	}
+
+	pullTo := pullDestination(cmd, args, transport, pullFrom, tmpfs)
+	if pullTmpfs {
+		if err := checkTmpfsDest(pullTo); err != nil {
+			sylog.Fatalf("%s", err)
+		}
+	}
+
+	resolved, skip, err := pullResolveConflict(pullTo, nil)
+	if err != nil {
+		sylog.Fatalf("%s", err)
+	}
+	if skip {
+		sylog.Infof("Image file already exists: %q - skipping the pull", pullTo)
+		return
+	}
+	if resolved != pullTo {
+		sylog.Infof("Image file already exists: %q - pulling to %q", pullTo, resolved)
+		pullTo = resolved
+	}
+
+	pullFrom, ociAuth, err := pullSource(ctx, cmd, pullFrom, &opts)
+	if err != nil {
+		sylog.Fatalf("%s", err)
+	}
+
+	if pullDryRun {
+		item := pullBatchItem{ref: pullFrom, pullFrom: pullFrom, pullTo: pullTo, ociAuth: ociAuth, opts: opts}
+		if err := pullPlan(ctx, os.Stdout, imgCache, []pullBatchItem{item}); err != nil {
+			sylog.Fatalf("%s", err)
 		}
+		return
+	}
 
-		_, err = oras.PullToFile(ctx, imgCache, pullTo, pullFrom, tmpDir, ociAuth)
+	opts.attestationOut, opts.attestationKey = pullAttestationOut, attestKey
+	d := pullTmpfsDir(ctx, tmpfs)
+	_, err = pullRetryResolved(ctx, cmd, pullFrom, func(ref string) error {
+		return pullImage(ctx, imgCache, pullTo, ref, ociAuth, opts)
+	})
+	d.Remove()
+	pullReportFlush()
+	pullNotify(ctx, pullFrom, pullTo, err)
+	if err != nil {
+		exitIfUnsigned(err)
+		sylog.Fatalf("%s", d.Err(err))
+	}
+
+	if err := writeResolvedRef(pullResolvedOut, resolvedRef); err != nil {
+		sylog.Fatalf("While writing resolved image: %s", err)
+	}
+}
+
+// pullSetup checks the flags of the pull of args and applies them, before
+// any request is made. It returns ctx with the network settings of the
+// flags, and the key the attestation is signed with, if any.
+func pullSetup(ctx context.Context, args []string) (context.Context, *openpgp.Entity, error) {
+	if err := pullCheckStdout(args); err != nil {
+		return ctx, nil, err
+	}
+	if pullJSON || pullToStdout {
+		// stdout only holds the summaries, or the image
+		ctx = singularityclient.WithoutProgress(ctx)
+	}
+	settings, err := pullSettings()
+	if err != nil {
+		return ctx, nil, err
+	}
+	ctx = singularityclient.WithSettings(ctx, settings)
+	if err := fs.SetCopyMethod(fs.CopyMethod(pullCopyMethod)); err != nil {
+		return ctx, nil, fmt.Errorf("invalid --copy-method: %v", err)
+	}
+
+	if pullPolicyFile != "" {
+		p, err := policy.Load(pullPolicyFile)
 		if err != nil {
-			sylog.Fatalf("While pulling image from oci registry: %v", err)
+			return ctx, nil, err
 		}
-	case HTTPProtocol, HTTPSProtocol:
-		_, err := net.PullToFile(ctx, imgCache, pullTo, pullFrom, tmpDir)
+		pullTrustPolicy = p
+	}
+	if err := pullCheckNoVerify(); err != nil {
+		return ctx, nil, err
+	}
+	if err := pullApplyUnsignedMode(); err != nil {
+		return ctx, nil, err
+	}
+	if pullRequireSignature && unauthenticatedPull {
+		return ctx, nil, fmt.Errorf("--require-signature can't be used with --allow-unauthenticated")
+	}
+	if pullFailOnUnsigned && unauthenticatedPull {
+		return ctx, nil, fmt.Errorf("--fail-on-unsigned can't be used with --allow-unauthenticated")
+	}
+	if len(pullVerifyFingerprints) > 0 {
+		fps, err := policy.ParseFingerprints(pullVerifyFingerprints)
 		if err != nil {
-			sylog.Fatalf("While pulling from image from http(s): %v\n", err)
+			return ctx, nil, fmt.Errorf("invalid --verify-fingerprint: %v", err)
 		}
-	case oci.IsSupported(transport):
-		ociAuth, err := makeDockerCredentials(cmd)
+		pullFingerprints = fps
+	}
+	if pullLocalKeyring != "" {
+		if err := signing.SetLocalKeyring(pullLocalKeyring); err != nil {
+			return ctx, nil, fmt.Errorf("invalid --local-keyring: %v", err)
+		}
+	}
+
+	// the host architecture is always accepted
+	if pullArch != runtime.GOARCH && !pullAllowUnknownArch {
+		if err := machine.CheckArch(pullArch); err != nil {
+			return ctx, nil, fmt.Errorf("invalid --arch: %v (use --allow-unknown-platform to bypass this check)", err)
+		}
+	}
+	if err := pullCheckExpectedArch(); err != nil {
+		return ctx, nil, err
+	}
+
+	if err := pullCheckIfNotPresent(); err != nil {
+		return ctx, nil, err
+	}
+	strategy, err := pullConflictStrategy()
+	if err != nil {
+		return ctx, nil, err
+	}
+	pullOnConflict = strategy
+	if err := pullCheckOutputFormat(); err != nil {
+		return ctx, nil, err
+	}
+	// a missing scanner fails before anything is pulled
+	if _, err := pullScanConfig(); err != nil {
+		return ctx, nil, err
+	}
+	attestKey, err := pullCheckAttestation()
+	if err != nil {
+		return ctx, nil, err
+	}
+	if err := pullCheckSearch(); err != nil {
+		return ctx, nil, err
+	}
+	if err := pullCheckTrace(); err != nil {
+		return ctx, nil, err
+	}
+	if err := pullCheckDryRun(); err != nil {
+		return ctx, nil, err
+	}
+	pullAliases, err = loadPullAliases(pullAliasFiles())
+	if err != nil {
+		return ctx, nil, err
+	}
+	return ctx, attestKey, nil
+}
+
+// pullSettings returns the network settings of the pull from the flags.
+func pullSettings() (singularityclient.Settings, error) {
+	if pullConnectTimeout < 0 {
+		return singularityclient.Settings{}, fmt.Errorf("--connect-timeout must not be negative")
+	}
+	if pullRetries < 0 {
+		return singularityclient.Settings{}, fmt.Errorf("--retries must not be negative")
+	}
+	retryDelay, err := time.ParseDuration(pullRetryDelay)
+	if err != nil || retryDelay < 0 {
+		return singularityclient.Settings{}, fmt.Errorf("invalid --retry-delay %q: a duration such as 500ms or 2s is expected", pullRetryDelay)
+	}
+	if pullStreamCount < 1 {
+		return singularityclient.Settings{}, fmt.Errorf("--stream-count must be at least 1")
+	}
+	settings := singularityclient.Settings{
+		UserAgent:      pullAgent(),
+		Retries:        pullRetries,
+		RetryDelay:     retryDelay,
+		ConnectTimeout: time.Duration(pullConnectTimeout) * time.Second,
+		StreamCount:    pullStreamCount,
+	}
+	if pullSOCKS5 != "" {
+		u, err := singularityclient.ParseSOCKS5Proxy(pullSOCKS5)
 		if err != nil {
-			sylog.Fatalf("While creating Docker credentials: %v", err)
+			return singularityclient.Settings{}, fmt.Errorf("invalid --socks5: %v", err)
+		}
+		settings.SOCKS5Proxy = u
+		sylog.Verbosef("Connecting through the SOCKS5 proxy %s", redactURI(u.String()))
+	}
+	return settings, nil
+}
+
+// pullDestination returns the path the image pullFrom is pulled to: the
+// --name or the one given, else the default name, in the --dir or the --tmpfs
+// base if set.
+func pullDestination(cmd *cobra.Command, args []string, transport, pullFrom, tmpfs string) string {
+	pullTo := pullImageName
+	if pullTo == "" {
+		pullTo = args[0]
+		if len(args) == 1 {
+			pullTo = pullDefaultName(transport, pullFrom, pullNameArch(cmd))
+			if pullTmpfs && pullDir == "" {
+				pullTo = filepath.Join(tmpfs, pullTo)
+			}
+		}
+	}
+
+	if pullDir != "" {
+		pullTo = filepath.Join(pullDir, pullTo)
+	}
+	return pullTo
+}
+
+// pullTmpfsDir creates the --tmpfs temporary directory of the pull on the
+// tmpfs base and sets it as the temporary directory, nothing is done and nil
+// is returned without --tmpfs.
+func pullTmpfsDir(ctx context.Context, base string) *tmpfsDir {
+	if !pullTmpfs {
+		return nil
+	}
+	d, err := newTmpfsDir(ctx, base)
+	if err != nil {
+		sylog.Fatalf("%s", err)
+	}
+	tmpDir = d.path
+	return d
+}
+
+// writeResolvedRef writes the resolved library image ref to path in JSON
+// format, nothing being written without --resolved-out.
+func writeResolvedRef(path string, ref *library.ResolvedRef) error {
+	if ref == nil {
+		return nil
+	}
+	b, err := json.MarshalIndent(ref, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(b, '\n'), 0644)
+}
+
+// pullVerify verifies the signatures of the image pullFrom without saving it.
+func pullVerify(ctx context.Context, imgCache *cache.Handle, pullFrom string) error {
+	transport, _ := uri.Split(pullFrom)
+	if transport != LibraryProtocol && transport != "" {
+		return fmt.Errorf("--verify-only is only supported for library images")
+	}
+
+	return library.Verify(ctx, imgCache, pullFrom, pullArch, tmpDir, pullLibraryConfig(), pullKeyServer(pullFrom))
+}
+
+// pullAgent returns the User-Agent of the requests of pull, the one set with
+// --user-agent if any.
+func pullAgent() string {
+	if pullUserAgent != "" {
+		return pullUserAgent
+	}
+	return useragent.Value()
+}
+
+// pullLibraryConfig returns the library client configuration for pull.
+func pullLibraryConfig() *client.Config {
+	return &client.Config{
+		BaseURL:    pullLibraryURI,
+		AuthToken:  authToken,
+		UserAgent:  pullAgent(),
+		HTTPClient: singularityclient.NewHTTPClient(0),
+		Logger:     (golog.Logger)(sylog.DebugLogger{}),
+	}
+}
+
+// pullRetryResolved calls pull with the library image ref, returning the
+// image pulled and the error of its last call. When ref was not found, but
+// other tags or architectures of its container are available, the user is
+// asked to select one if interactive, which is then pulled instead with the
+// same destination and options. Otherwise the returned error lists them.
+// The other errors are returned as is, the container only being looked up
+// once the image wasn't found.
+func pullRetryResolved(ctx context.Context, cmd *cobra.Command, ref string, pull func(ref string) error) (string, error) {
+	err := pull(ref)
+	if !errors.Is(err, library.ErrImageNotFound) {
+		return ref, err
+	}
+	resolved, err := pullResolveRef(ctx, cmd, ref)
+	if err != nil {
+		return ref, err
+	}
+	sylog.Infof("Pulling %s", resolved)
+	return resolved, pull(resolved)
+}
+
+// pullResolveRef returns the image of the container of the library
+// reference pullFrom, which resolves to no image for --arch, the user
+// selects. The returned error lists the available tags and architectures
+// when not interactive.
+func pullResolveRef(ctx context.Context, cmd *cobra.Command, pullFrom string) (string, error) {
+	err := library.NotFoundError(ctx, pullLibraryConfig(), pullFrom, pullArch)
+	ambiguous, ok := err.(*library.AmbiguousRefError)
+	if !ok {
+		return pullFrom, err
+	}
+	if !pullInteractive() {
+		return "", err
+	}
+
+	fmt.Printf("Image %s is not available for %s, available images are:\n", ambiguous.Ref, ambiguous.Arch)
+	for i, c := range ambiguous.Choices {
+		fmt.Printf("  %d) %s\n", i+1, c)
+	}
+	n, err := interactive.AskNumberInRange(1, len(ambiguous.Choices), "Select the image to pull [1-%d]: ", len(ambiguous.Choices))
+	if err != nil {
+		return "", fmt.Errorf("invalid selection: %v", err)
+	}
+
+	// the selection is pulled as if given on the command line
+	choice := ambiguous.Choices[n-1]
+	if err := cmd.Flags().Set("arch", choice.Arch); err != nil {
+		return "", err
+	}
+	pullArchFallback = nil
+	return library.WithTag(pullFrom, choice.Tag), nil
+}
+
+// pullDefaultName returns the image file name used when none is given, for
+// the --output-format. The names of library and OCI images include arch,
+// unless empty, e.g. ubuntu_latest_arm64.sif.
+func pullDefaultName(transport, pullFrom, arch string) string {
+	if transport == "" {
+		transport, pullFrom = LibraryProtocol, "library://"+pullFrom
+	}
+	name := uri.GetName(pullFrom) // TODO: If not library/shub & no name specified, simply put to cache
+	if (transport == HTTPProtocol || transport == HTTPSProtocol) && !pullNoDecompress {
+		// compressed images are decompressed on the fly
+		name = strings.TrimSuffix(name, ".gz")
+	}
+	if arch != "" && name != "" && (transport == LibraryProtocol || oci.IsSupported(transport) != "") {
+		name = strings.TrimSuffix(name, ".sif") + "_" + arch + ".sif"
+	}
+	return formatName(name)
+}
+
+// pullMirrorRef rewrites the docker.io reference pullFrom to the registry mirror
+// set with --registry-mirror or in singularity.conf, if any.
+func pullMirrorRef(pullFrom string) (string, error) {
+	mirror := pullRegistryMirror
+	if mirror == "" {
+		if cfg := singularityconf.GetCurrentConfig(); cfg != nil {
+			mirror = cfg.RegistryMirror
 		}
+	}
 
-		_, err = oci.PullToFile(ctx, imgCache, pullTo, pullFrom, tmpDir, ociAuth, noHTTPS, buildArgs.noCleanUp)
+	ref, err := oci.MirrorRef(pullFrom, mirror)
+	if err != nil {
+		return "", err
+	}
+	if ref != pullFrom {
+		sylog.Debugf("Pulling %s from registry mirror as %s", pullFrom, ref)
+	}
+	return ref, nil
+}
+
+// pullSource returns the reference the image pullFrom is pulled from, after
+// the registry mirror rewriting, with its docker credentials. The
+// architecture of an OCI image is selected in opts with --arch-fallback.
+func pullSource(ctx context.Context, cmd *cobra.Command, pullFrom string, opts *pullImageOptions) (string, *ocitypes.DockerAuthConfig, error) {
+	pullFrom, err := pullMirrorRef(pullFrom)
+	if err != nil {
+		return "", nil, err
+	}
+	ociAuth, err := pullDockerCredentials(cmd, pullFrom)
+	if err != nil {
+		return "", nil, fmt.Errorf("while creating Docker credentials: %v", err)
+	}
+
+	transport, _ := uri.Split(pullFrom)
+	if len(pullArchFallback) > 0 && oci.IsSupported(transport) != "" {
+		arch, err := pullFallbackOCIArch(ctx, pullFrom, ociAuth)
 		if err != nil {
-			sylog.Fatalf("While making image from oci registry: %v", err)
+			return "", nil, fmt.Errorf("while selecting the image architecture: %s", err)
+		}
+		logFallbackArch(arch)
+		opts.ociArch = arch
+	}
+	return pullFrom, ociAuth, nil
+}
+
+// pullDockerCredentials returns the docker credentials for pullFrom if its
+// transport uses them.
+func pullDockerCredentials(cmd *cobra.Command, pullFrom string) (*ocitypes.DockerAuthConfig, error) {
+	transport, _ := uri.Split(pullFrom)
+	if transport != OrasProtocol && oci.IsSupported(transport) == "" {
+		return nil, nil
+	}
+	// answers may still be piped to stdin, only an explicit
+	// --non-interactive aborts
+	if dockerLogin && promptsDisabled() {
+		return nil, fmt.Errorf("--docker-login prompts for credentials, use --docker-username and --docker-password when non-interactive")
+	}
+	return makeDockerCredentials(cmd, pullFrom)
+}
+
+// pullImageOptions are the settings of a single image pull, overriding
+// the command line ones.
+type pullImageOptions struct {
+	// arch is the architecture of the library image, pullArch if empty.
+	arch string
+	// ociArch is the architecture of the OCI image, the host one if empty.
+	ociArch string
+	// sha256 is the expected hash of the pulled image, if set.
+	sha256 string
+	// fingerprints are the keys one of which must have signed the image,
+	// instead of the --verify-fingerprint ones.
+	fingerprints []string
+	// attestationOut is the file the attestation of the image is written
+	// to, clearsigned with attestationKey if not nil, if set.
+	attestationOut string
+	attestationKey *openpgp.Entity
+}
+
+// pullImage pulls the image pullFrom to pullTo with the client matching
+// its transport.
+func pullImage(ctx context.Context, imgCache *cache.Handle, pullTo, pullFrom string, ociAuth *ocitypes.DockerAuthConfig, opts pullImageOptions) (err error) {
+	ctx, transfer := singularityclient.WithTransfer(ctx)
+	start := time.Now()
+	var res pull.Result
+	defer func() {
+		pullReport(pullFrom, pullTo, res.Cache, time.Since(start), err)
+	}()
+
+	pullOpts, err := pullOptions(ctx, imgCache, pullFrom, pullTo, ociAuth, opts)
+	if err != nil {
+		return err
+	}
+	res, err = pull.Pull(ctx, pullOpts)
+	if err != nil {
+		return pullError(pullFrom, err)
+	}
+	pullSuccess(ctx, pullFrom, pullTo, res, transfer, time.Since(start))
+	return nil
+}
+
+// pullOptions returns the options pullFrom is pulled to pullTo with, or
+// only to the cache if pullTo is empty, from the flags and opts, with the
+// network settings of ctx, through the cache of imgCache.
+func pullOptions(ctx context.Context, imgCache *cache.Handle, pullFrom, pullTo string, ociAuth *ocitypes.DockerAuthConfig, opts pullImageOptions) (pull.Options, error) {
+	arch := pullArch
+	if opts.arch != "" {
+		arch = opts.arch
+	}
+	fingerprints := pullFingerprints
+	if len(opts.fingerprints) > 0 {
+		fingerprints = opts.fingerprints
+	}
+	scanner, err := pullScanConfig()
+	if err != nil {
+		return pull.Options{}, err
+	}
+	settings := singularityclient.SettingsFromContext(ctx)
+	return pull.Options{
+		From:                 pullFrom,
+		To:                   pullTo,
+		Format:               pullOutputFormat,
+		Arch:                 arch,
+		CacheDir:             imgCache.ParentDir(),
+		DisableCache:         imgCache.IsDisabled(),
+		ReadOnlyCache:        imgCache.IsReadOnly(),
+		PreserveCacheOnError: pullPreserveCacheOnError,
+		TmpDir:               tmpDir,
+		Library:              pullLibraryConfig(),
+		KeyServerURL:         pullKeyServer(pullFrom),
+		NoVerify:             pullNoVerify,
+		RequireSignature:     pullRequireSignature,
+		FailOnUnsigned:       pullFailOnUnsigned,
+		AllowUnauthenticated: unauthenticatedPull,
+		Policy:               pullTrustPolicy,
+		Fingerprints:         fingerprints,
+		RekorURL:             pullRekorURL(pullFrom),
+		Scanner:              scanner,
+		ExpectedArch:         pullExpectedArch,
+		AllowArchMismatch:    pullAllowArchMismatch,
+		StripSignatures:      pullStripSignature,
+		Group:                pullGroup,
+		AttestationOut:       opts.attestationOut,
+		AttestationKey:       opts.attestationKey,
+		Digest:               opts.sha256,
+		NoHTTPS:              noHTTPS,
+		NoDecompress:         pullNoDecompress,
+		DockerAuthConfig:     ociAuth,
+		Identity:             pullIdentity,
+		OCI:                  pullOCIOptions(ociAuth, opts.ociArch),
+		UserAgent:            settings.UserAgent,
+		Retries:              settings.Retries,
+		RetryDelay:           settings.RetryDelay,
+		ConnectTimeout:       settings.ConnectTimeout,
+		SOCKS5Proxy:          settings.SOCKS5Proxy,
+		StreamCount:          settings.StreamCount,
+	}, nil
+}
+
+// pullOCIOptions returns the options OCI images are built with, for the
+// architecture arch, the host one if empty.
+func pullOCIOptions(ociAuth *ocitypes.DockerAuthConfig, arch string) buildtypes.Options {
+	return buildtypes.Options{
+		TmpDir:           tmpDir,
+		NoHTTPS:          noHTTPS,
+		NoCleanUp:        buildArgs.noCleanUp,
+		DockerAuthConfig: ociAuth,
+		NoSetuid:         pullNoSetuid,
+		Reproducible:     pullReproducible,
+		Squash:           pullSquash,
+		Arch:             arch,
+	}
+}
+
+// pullSummary is the summary of a successful pull, printed with --json.
+type pullSummary struct {
+	Image     string `json:"image"`
+	Transport string `json:"transport"`
+	Path      string `json:"path"`
+	Arch      string `json:"arch"`
+	Hash      string `json:"hash"`
+	Cache     string `json:"cache"`
+	// Signature is the signature status of the image, see
+	// pull.SignatureStatus
+	Signature    string  `json:"signature"`
+	NetworkBytes int64   `json:"networkBytes"`
+	CachedBytes  int64   `json:"cachedBytes"`
+	Duration     float64 `json:"durationSeconds"`
+	Throughput   float64 `json:"throughputBytesPerSecond"`
+	// Signers are the keys of the signers of a verified image
+	Signers []pullSigner `json:"signers,omitempty"`
+	// Trace are the phases of the pull, with --trace
+	Trace []pullTracePhase `json:"trace,omitempty"`
+}
+
+// pullSigner is the key of a signer of a pulled image, printed with --json.
+type pullSigner struct {
+	Fingerprint string `json:"fingerprint"`
+	// Identity is the identity of the key, as found in the local keyring
+	// or on the key server
+	Identity string `json:"identity"`
+	// Local is whether the key is in the local keyring
+	Local bool `json:"local"`
+}
+
+// pullSummarySigners returns the signers of the summary from their keys.
+func pullSummarySigners(keys []signing.KeyEntity) []pullSigner {
+	var signers []pullSigner
+	for _, k := range keys {
+		signers = append(signers, pullSigner{Fingerprint: k.Fingerprint, Identity: k.Name, Local: k.KeyLocal})
+	}
+	return signers
+}
+
+// pullSuccess logs the summary of the successful pull of pullFrom to pullTo
+// with the result res, which took duration and downloaded the bytes
+// accounted by transfer. The phases traced with --trace are printed along.
+func pullSuccess(ctx context.Context, pullFrom, pullTo string, res pull.Result, transfer *singularityclient.Transfer, duration time.Duration) {
+	arch := res.Arch
+	if arch == "" {
+		arch = "unknown"
+	}
+	hash := res.Hash
+	if hash == "" {
+		hash = "unknown hash"
+	}
+
+	cacheUse := res.Cache
+	cached := cacheUse.String()
+
+	// bytes are only served from the cache when nothing was missing
+	var cachedBytes int64
+	if cacheUse == pull.CacheHit {
+		cachedBytes = res.Size
+	}
+	networkBytes := transfer.Network()
+	var throughput float64
+	if duration > 0 {
+		throughput = float64(networkBytes) / duration.Seconds()
+	}
+
+	trace := singularityclient.TraceFromContext(ctx)
+	sylog.Infof("Pulled %s (arch %s, %s, %s) to %s: %s downloaded, %s from cache in %s (%s/s)",
+		redactURI(pullFrom), arch, hash, cached, pullTo,
+		formatBytes(networkBytes), formatBytes(cachedBytes), duration.Round(time.Millisecond), formatBytes(int64(throughput)))
+	for _, k := range res.Signers {
+		sylog.Infof("Signed by %s, key fingerprint %s", k.Name, k.Fingerprint)
+	}
+
+	if pullJSON {
+		transport, _ := uri.Split(pullFrom)
+		if transport == "" {
+			transport = LibraryProtocol
+		}
+		s := pullSummary{
+			Image:        redactURI(pullFrom),
+			Transport:    transport,
+			Path:         pullTo,
+			Arch:         arch,
+			Hash:         hash,
+			Cache:        cached,
+			Signature:    string(res.Signature),
+			Signers:      pullSummarySigners(res.Signers),
+			NetworkBytes: networkBytes,
+			CachedBytes:  cachedBytes,
+			Duration:     duration.Seconds(),
+			Throughput:   throughput,
+			Trace:        pullTracePhases(trace),
+		}
+		if err := json.NewEncoder(os.Stdout).Encode(s); err != nil {
+			sylog.Warningf("Could not print pull summary: %v", err)
+		}
+	} else if trace != nil {
+		if err := writePullTrace(os.Stderr, trace); err != nil {
+			sylog.Warningf("Could not print pull trace: %v", err)
 		}
-	default:
-		sylog.Fatalf("Unsupported transport type: %s", transport)
 	}
 }
 
+// pullInteractive returns whether the user can be prompted during a pull,
+// never with --json nor to stdout so that stdout only holds the summary or
+// the image.
+func pullInteractive() bool {
+	return !pullJSON && !pullToStdout && isInteractive()
+}
+
+// formatBytes returns the size n in bytes in a human readable form,
+// e.g. 1.5 MiB.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
 func handlePullFlags(cmd *cobra.Command) {
+	// the token of --library-auth-file overrides the remote one
+	defer pullApplyLibraryAuthFile()
+
 	// if we can load config and if default endpoint is set, use that
 	// otherwise fall back on regular authtoken and URI behavior
 	endpoint, err := sylabsRemote(remoteConfig)
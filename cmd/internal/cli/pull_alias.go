@@ -0,0 +1,73 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"path/filepath"
+
+	"github.com/sylabs/singularity/internal/pkg/buildcfg"
+	"github.com/sylabs/singularity/internal/pkg/client/alias"
+	"github.com/sylabs/singularity/pkg/cmdline"
+	"github.com/sylabs/singularity/pkg/syfs"
+	"github.com/sylabs/singularity/pkg/sylog"
+)
+
+// pullAliasFile is the name of the alias files, in the singularity
+// configuration directory and the user one.
+const pullAliasFile = "pull-aliases.yaml"
+
+var (
+	// pullNoAlias when true; refs are never expanded as aliases.
+	pullNoAlias bool
+	// pullAliases are the aliases the pulled refs are expanded with, nil
+	// with --no-alias.
+	pullAliases *alias.Aliases
+)
+
+// --no-alias
+var pullNoAliasFlag = cmdline.Flag{
+	ID:           "pullNoAliasFlag",
+	Value:        &pullNoAlias,
+	DefaultValue: false,
+	Name:         "no-alias",
+	Usage:        "don't expand the image argument with the aliases of pull-aliases.yaml",
+	EnvKeys:      []string{"PULL_NO_ALIAS"},
+}
+
+// pullAliasFiles returns the alias files, the aliases of the user file
+// overriding the system ones.
+func pullAliasFiles() []string {
+	return []string{
+		filepath.Join(buildcfg.SINGULARITY_CONFDIR, pullAliasFile),
+		filepath.Join(syfs.ConfigDir(), pullAliasFile),
+	}
+}
+
+// loadPullAliases returns the aliases of files, or nil with --no-alias.
+func loadPullAliases(files []string) (*alias.Aliases, error) {
+	if pullNoAlias {
+		return nil, nil
+	}
+	aliases := &alias.Aliases{}
+	for _, f := range files {
+		a, err := alias.Load(f)
+		if err != nil {
+			return nil, err
+		}
+		aliases.Merge(a)
+	}
+	return aliases, nil
+}
+
+// pullExpandAlias returns the URI the alias ref expands to, or ref if it
+// isn't an alias.
+func pullExpandAlias(ref string) string {
+	expanded, ok := pullAliases.Expand(ref)
+	if ok {
+		sylog.Debugf("Expanded alias %s to %s", ref, expanded)
+	}
+	return expanded
+}
@@ -0,0 +1,71 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPullExpandAlias(t *testing.T) {
+	defer func(noAlias bool) {
+		pullNoAlias = noAlias
+		pullAliases = nil
+	}(pullNoAlias)
+
+	dir, err := ioutil.TempDir("", "pull-alias-")
+	if err != nil {
+		t.Fatalf("could not create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	system := filepath.Join(dir, "system.yaml")
+	user := filepath.Join(dir, "user.yaml")
+	files := map[string]string{
+		system: "aliases:\n  alpine: library://library/default/alpine:3.11\n  tools: library://myorg/prod/tools:stable\n",
+		user:   "aliases:\n  alpine: library://myorg/base/alpine:3.12\n",
+	}
+	for path, content := range files {
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("could not write %s: %v", path, err)
+		}
+	}
+	paths := []string{system, user, filepath.Join(dir, "missing.yaml")}
+
+	tests := []struct {
+		name     string
+		noAlias  bool
+		ref      string
+		expected string
+	}{
+		{name: "UserOverride", ref: "alpine", expected: "library://myorg/base/alpine:3.12"},
+		{name: "System", ref: "library://tools", expected: "library://myorg/prod/tools:stable"},
+		{name: "NotAlias", ref: "library://tools:latest", expected: "library://tools:latest"},
+		{name: "NoAlias", noAlias: true, ref: "alpine", expected: "alpine"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pullNoAlias = tt.noAlias
+			pullAliases, err = loadPullAliases(paths)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := pullExpandAlias(tt.ref); got != tt.expected {
+				t.Errorf("got %q, want %q", got, tt.expected)
+			}
+		})
+	}
+
+	pullNoAlias = false
+	if err := ioutil.WriteFile(user, []byte("aliases:\n  alpine: alpine:3.12\n"), 0644); err != nil {
+		t.Fatalf("could not write %s: %v", user, err)
+	}
+	if _, err := loadPullAliases(paths); err == nil {
+		t.Errorf("unexpected success loading an invalid alias file")
+	}
+}
@@ -0,0 +1,233 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"strings"
+
+	ocitypes "github.com/containers/image/v5/types"
+	"github.com/spf13/cobra"
+	"github.com/sylabs/singularity/internal/pkg/client/library"
+	"github.com/sylabs/singularity/internal/pkg/client/oci"
+	"github.com/sylabs/singularity/internal/pkg/util/machine"
+	"github.com/sylabs/singularity/internal/pkg/util/uri"
+	buildtypes "github.com/sylabs/singularity/pkg/build/types"
+	"github.com/sylabs/singularity/pkg/cmdline"
+	"github.com/sylabs/singularity/pkg/sylog"
+	"github.com/sylabs/singularity/pkg/util/singularityconf"
+)
+
+var (
+	// pullArchFallback are the architectures tried in turn, the image
+	// being pulled for the first one it is available for.
+	pullArchFallback []string
+	// pullExpectedArch is the architecture the pulled images must hold a
+	// system partition for.
+	pullExpectedArch string
+	// pullAllowArchMismatch keeps the images pulled for the host whose
+	// system partitions can't run on it.
+	pullAllowArchMismatch bool
+)
+
+// --arch-fallback
+var pullArchFallbackFlag = cmdline.Flag{
+	ID:           "pullArchFallbackFlag",
+	Value:        &pullArchFallback,
+	DefaultValue: []string{},
+	Name:         "arch-fallback",
+	Usage:        "pull the library or OCI image for the first of the given architectures it is available for (e.g. --arch-fallback arm64,amd64)",
+	EnvKeys:      []string{"PULL_ARCH_FALLBACK"},
+}
+
+// --expected-arch
+var pullExpectedArchFlag = cmdline.Flag{
+	ID:           "pullExpectedArchFlag",
+	Value:        &pullExpectedArch,
+	DefaultValue: "",
+	Name:         "expected-arch",
+	Usage:        "fail and remove the pulled image unless it holds a partition for the given architecture, 'host' for the host one",
+	EnvKeys:      []string{"PULL_EXPECTED_ARCH"},
+}
+
+// --allow-arch-mismatch
+var pullAllowArchMismatchFlag = cmdline.Flag{
+	ID:           "pullAllowArchMismatchFlag",
+	Value:        &pullAllowArchMismatch,
+	DefaultValue: false,
+	Name:         "allow-arch-mismatch",
+	Usage:        "keep a library or OCI image pulled for the host even if its architecture can't run on it",
+	EnvKeys:      []string{"PULL_ALLOW_ARCH_MISMATCH"},
+}
+
+// pullNameArch returns the architecture included in the default image file
+// names: the one set with --arch, so that the pulls of several architectures
+// of an image don't overwrite each other, or none to keep the names of the
+// pulls for the host architecture unchanged.
+func pullNameArch(cmd *cobra.Command) string {
+	if f := cmd.Flags().Lookup("arch"); f == nil || !f.Changed {
+		return ""
+	}
+	return pullArch
+}
+
+// pullCheckArchFallback checks the --arch-fallback architectures, and that
+// they apply to the transport of the pull.
+func pullCheckArchFallback(cmd *cobra.Command, transport string) error {
+	if len(pullArchFallback) == 0 {
+		return nil
+	}
+	if cmd.Flags().Lookup("arch").Changed {
+		return fmt.Errorf("--arch can't be used with --arch-fallback")
+	}
+	if transport != LibraryProtocol && transport != "" && oci.IsSupported(transport) == "" {
+		return fmt.Errorf("--arch-fallback is only supported for library and OCI images")
+	}
+	for _, arch := range pullArchFallback {
+		if arch == runtime.GOARCH || pullAllowUnknownArch {
+			continue
+		}
+		if err := machine.CheckArch(arch); err != nil {
+			return fmt.Errorf("invalid --arch-fallback: %v (use --allow-unknown-platform to bypass this check)", err)
+		}
+	}
+	return nil
+}
+
+// pullCheckExpectedArch checks the --expected-arch architecture, 'host'
+// being replaced with the host architecture.
+func pullCheckExpectedArch() error {
+	if pullExpectedArch == "host" {
+		pullExpectedArch = runtime.GOARCH
+	}
+	if pullExpectedArch == "" || pullExpectedArch == runtime.GOARCH || pullAllowUnknownArch {
+		return nil
+	}
+	if err := machine.CheckArch(pullExpectedArch); err != nil {
+		return fmt.Errorf("invalid --expected-arch: %v (use --allow-unknown-platform to bypass this check)", err)
+	}
+	return nil
+}
+
+// pullDefaultArch sets the architecture the library image pullFrom is
+// pulled for to the default one of its collection, unless --arch or
+// --arch-fallback are given.
+func pullDefaultArch(cmd *cobra.Command, pullFrom string) error {
+	if cmd.Flags().Lookup("arch").Changed {
+		sylog.Debugf("Pulling %s for %s, set by --arch", pullFrom, pullArch)
+		return nil
+	}
+	if len(pullArchFallback) > 0 {
+		return nil
+	}
+	arch, prefix, err := pullCollectionArch(pullFrom)
+	if err != nil {
+		return err
+	}
+	if arch == "" {
+		sylog.Debugf("Pulling %s for %s, the host architecture", pullFrom, pullArch)
+		return nil
+	}
+	sylog.Debugf("Pulling %s for %s, the default architecture of %s in singularity.conf", pullFrom, arch, prefix)
+	pullArch = arch
+	return nil
+}
+
+// pullCollectionArch returns the default architecture of the collection of
+// the library image pullFrom, set by the 'pull collection arch' directive
+// of singularity.conf, and the collection prefix it is set for, or an
+// empty architecture if no prefix matches.
+func pullCollectionArch(pullFrom string) (arch, prefix string, err error) {
+	cfg := singularityconf.GetCurrentConfig()
+	if cfg == nil {
+		return "", "", nil
+	}
+	return collectionArch(cfg.PullCollectionArch, pullFrom)
+}
+
+// collectionArch returns the architecture of the longest of the
+// <prefix>=<arch> entries whose prefix, an entity or an entity and a
+// collection, matches the library image pullFrom.
+func collectionArch(entries []string, pullFrom string) (arch, prefix string, err error) {
+	// alpine is matched as library/default/alpine:latest
+	if t, ref, err := uri.Normalize(pullFrom); err == nil && t == uri.Library {
+		pullFrom = ref
+	}
+	path := strings.TrimLeft(library.NormalizeLibraryRef(pullFrom), "/")
+	for _, e := range entries {
+		kv := strings.SplitN(e, "=", 2)
+		p, a := "", ""
+		if len(kv) == 2 {
+			p, a = strings.Trim(strings.TrimSpace(kv[0]), "/"), strings.TrimSpace(kv[1])
+		}
+		if p == "" || a == "" {
+			return "", "", fmt.Errorf("invalid 'pull collection arch' entry %q in singularity.conf, expected <collection>=<arch>", e)
+		}
+		if a != runtime.GOARCH && !pullAllowUnknownArch {
+			if err := machine.CheckArch(a); err != nil {
+				return "", "", fmt.Errorf("invalid 'pull collection arch' entry %q in singularity.conf: %v", e, err)
+			}
+		}
+		if strings.HasPrefix(path, p+"/") && len(p) > len(prefix) {
+			arch, prefix = a, p
+		}
+	}
+	return arch, prefix, nil
+}
+
+// pullFallbackLibraryArch returns the first --arch-fallback architecture
+// the library image pullFrom is available for.
+func pullFallbackLibraryArch(ctx context.Context, pullFrom string) (string, error) {
+	var available []string
+	for _, arch := range pullArchFallback {
+		err := library.CheckRef(ctx, pullLibraryConfig(), pullFrom, arch)
+		if err == nil {
+			return arch, nil
+		}
+		ambiguous, ok := err.(*library.AmbiguousRefError)
+		if !ok {
+			return "", err
+		}
+		available = available[:0]
+		for _, c := range ambiguous.Choices {
+			available = append(available, c.String())
+		}
+	}
+	return "", fmt.Errorf("image %s is not available for any of %s, available: %s",
+		library.NormalizeLibraryRef(pullFrom), strings.Join(pullArchFallback, ", "), strings.Join(available, ", "))
+}
+
+// pullFallbackOCIArch returns the first --arch-fallback architecture the OCI
+// image pullFrom is available for, according to its manifest.
+func pullFallbackOCIArch(ctx context.Context, pullFrom string, ociAuth *ocitypes.DockerAuthConfig) (string, error) {
+	available, err := oci.Architectures(ctx, pullFrom, buildtypes.Options{
+		NoHTTPS:          noHTTPS,
+		DockerAuthConfig: ociAuth,
+	})
+	if err != nil {
+		return "", err
+	}
+	for _, arch := range pullArchFallback {
+		for _, a := range available {
+			if a == arch {
+				return arch, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("image %s is not available for any of %s, available: %s",
+		pullFrom, strings.Join(pullArchFallback, ", "), strings.Join(available, ", "))
+}
+
+// logFallbackArch records the architecture chosen from --arch-fallback.
+func logFallbackArch(arch string) {
+	if arch == pullArchFallback[0] {
+		sylog.Infof("Pulling the image for %s", arch)
+		return
+	}
+	sylog.Infof("Pulling the image for %s, the first available of --arch-fallback %s", arch, strings.Join(pullArchFallback, ","))
+}
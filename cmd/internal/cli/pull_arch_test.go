@@ -0,0 +1,217 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/sylabs/singularity/internal/pkg/client/library"
+	useragent "github.com/sylabs/singularity/pkg/util/user-agent"
+)
+
+func TestPullFallbackLibraryArch(t *testing.T) {
+	useragent.InitValue("singularity", "3.0.0")
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/images/user/collection/container:latest":
+			if r.URL.Query().Get("arch") == "amd64" {
+				w.Write([]byte(`{"data": {"hash": "sha256.0123"}}`))
+				return
+			}
+		case "/v1/containers/user/collection/container":
+			w.Write([]byte(`{"data": {"archTags": {"amd64": {"latest": "1"}, "arm64": {"1.0": "2"}}}}`))
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	defer func(uri string, archs []string) {
+		pullLibraryURI, pullArchFallback = uri, archs
+	}(pullLibraryURI, pullArchFallback)
+	pullLibraryURI = srv.URL
+
+	tests := []struct {
+		name     string
+		archs    []string
+		expected string
+		err      string
+	}{
+		{name: "First", archs: []string{"amd64", "arm64"}, expected: "amd64"},
+		{name: "Fallback", archs: []string{"arm64", "ppc64le", "amd64"}, expected: "amd64"},
+		{name: "None", archs: []string{"arm64", "ppc64le"}, err: "not available for any of arm64, ppc64le, available: 1.0 (arm64), latest (amd64)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pullArchFallback = tt.archs
+			arch, err := pullFallbackLibraryArch(context.Background(), "library://user/collection/container:latest")
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("unexpected error %v, expected %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if arch != tt.expected {
+				t.Errorf("unexpected architecture %s, expected %s", arch, tt.expected)
+			}
+		})
+	}
+}
+
+func TestPullRetryResolved(t *testing.T) {
+	useragent.InitValue("singularity", "3.0.0")
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/containers/user/collection/container" {
+			w.Write([]byte(`{"data": {"archTags": {"arm64": {"1.0": "2"}}}}`))
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	defer func(uri string, json bool) { pullLibraryURI, pullJSON = uri, json }(pullLibraryURI, pullJSON)
+	pullLibraryURI = srv.URL
+	// never prompted for another image
+	pullJSON = true
+
+	ref := "library://user/collection/container:latest"
+	failed := errors.New("failed")
+	tests := []struct {
+		name string
+		err  error
+		want interface{}
+	}{
+		{name: "Pulled"},
+		{name: "Failed", err: failed, want: failed},
+		{name: "NotFound", err: fmt.Errorf("%w: %s", library.ErrImageNotFound, ref), want: &library.AmbiguousRefError{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var pulled []string
+			got, err := pullRetryResolved(context.Background(), &cobra.Command{}, ref, func(r string) error {
+				pulled = append(pulled, r)
+				return tt.err
+			})
+			if len(pulled) != 1 || pulled[0] != ref || got != ref {
+				t.Errorf("unexpected pulls %v returning %s, expected only %s", pulled, got, ref)
+			}
+			switch want := tt.want.(type) {
+			case nil:
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+			case *library.AmbiguousRefError:
+				if !errors.As(err, &want) || want.Ref != "user/collection/container:latest" {
+					t.Errorf("unexpected error %v, expected the available images", err)
+				}
+			default:
+				if err != want {
+					t.Errorf("unexpected error %v, expected %v", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestPullDefaultName(t *testing.T) {
+	defer func(f string) { pullOutputFormat = f }(pullOutputFormat)
+	pullOutputFormat = formatSIF
+
+	tests := []struct {
+		transport string
+		pullFrom  string
+		arch      string
+		want      string
+	}{
+		{"docker", "docker://ubuntu:20.04", "", "ubuntu_20.04.sif"},
+		{"docker", "docker://ubuntu:20.04", "arm64", "ubuntu_20.04_arm64.sif"},
+		{"library", "library://alpine", "arm64", "alpine_latest_arm64.sif"},
+		{"", "alpine", "ppc64le", "alpine_latest_ppc64le.sif"},
+		// only library and OCI images are pulled for an architecture
+		{"https", "https://example.com/image.sif", "arm64", "image.sif"},
+		{"shub", "shub://user/image", "arm64", "image_latest.sif"},
+	}
+	for _, tt := range tests {
+		if got := pullDefaultName(tt.transport, tt.pullFrom, tt.arch); got != tt.want {
+			t.Errorf("pullDefaultName(%q, %q, %q) = %q, want %q", tt.transport, tt.pullFrom, tt.arch, got, tt.want)
+		}
+	}
+}
+
+func TestPullCheckExpectedArch(t *testing.T) {
+	defer func(arch string, allow bool) {
+		pullExpectedArch, pullAllowUnknownArch = arch, allow
+	}(pullExpectedArch, pullAllowUnknownArch)
+
+	pullAllowUnknownArch = false
+	tests := []struct {
+		arch    string
+		wantErr bool
+	}{
+		{arch: ""},
+		{arch: "arm64"},
+		{arch: "ppc64le"},
+		{arch: "sparc", wantErr: true},
+	}
+	for _, tt := range tests {
+		pullExpectedArch = tt.arch
+		if err := pullCheckExpectedArch(); (err != nil) != tt.wantErr {
+			t.Errorf("unexpected error checking --expected-arch %s: %v", tt.arch, err)
+		}
+	}
+
+	pullExpectedArch = "host"
+	if err := pullCheckExpectedArch(); err != nil || pullExpectedArch != runtime.GOARCH {
+		t.Errorf("unexpected --expected-arch %s for host: %v", pullExpectedArch, err)
+	}
+}
+
+func TestCollectionArch(t *testing.T) {
+	defer func(allow bool) { pullAllowUnknownArch = allow }(pullAllowUnknownArch)
+	pullAllowUnknownArch = false
+
+	entries := []string{"myorg/arm-builds=arm64", " myorg = ppc64le ", "library/default/=amd64"}
+	tests := []struct {
+		pullFrom string
+		arch     string
+		prefix   string
+	}{
+		{pullFrom: "library://myorg/arm-builds/tools:1.0", arch: "arm64", prefix: "myorg/arm-builds"},
+		{pullFrom: "library://myorg/power/tools", arch: "ppc64le", prefix: "myorg"},
+		{pullFrom: "alpine", arch: "amd64", prefix: "library/default"},
+		// prefixes match whole path components
+		{pullFrom: "library://myorganization/collection/tools"},
+		// a single component is a container of library/default
+		{pullFrom: "library://myorg", arch: "amd64", prefix: "library/default"},
+	}
+	for _, tt := range tests {
+		arch, prefix, err := collectionArch(entries, tt.pullFrom)
+		if err != nil {
+			t.Errorf("unexpected error for %s: %v", tt.pullFrom, err)
+		} else if arch != tt.arch || prefix != tt.prefix {
+			t.Errorf("got arch %q of %q for %s, want %q of %q", arch, prefix, tt.pullFrom, tt.arch, tt.prefix)
+		}
+	}
+
+	for _, e := range []string{"myorg", "=arm64", "myorg=", "myorg=sparc"} {
+		if _, _, err := collectionArch([]string{e}, "library://myorg/collection/tools"); err == nil {
+			t.Errorf("unexpected success with entry %q", e)
+		}
+	}
+}
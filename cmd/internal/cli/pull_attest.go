@@ -0,0 +1,88 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"fmt"
+
+	"github.com/sylabs/singularity/pkg/cmdline"
+	"github.com/sylabs/singularity/pkg/sypgp"
+	"golang.org/x/crypto/openpgp"
+)
+
+var (
+	// pullAttestationOut is the file the attestation of the verified pull
+	// is written to.
+	pullAttestationOut string
+	// pullSignKey is the private key file the attestation is signed with.
+	pullSignKey string
+)
+
+// --attestation-out
+var pullAttestationOutFlag = cmdline.Flag{
+	ID:           "pullAttestationOutFlag",
+	Value:        &pullAttestationOut,
+	DefaultValue: "",
+	Name:         "attestation-out",
+	Usage:        "write a JSON attestation of the verified image, its hash and signers to the given file",
+	EnvKeys:      []string{"PULL_ATTESTATION_OUT"},
+}
+
+// --sign-key
+var pullSignKeyFlag = cmdline.Flag{
+	ID:           "pullSignKeyFlag",
+	Value:        &pullSignKey,
+	DefaultValue: "",
+	Name:         "sign-key",
+	Usage:        "clearsign the --attestation-out attestation with the private key of the given key file",
+	EnvKeys:      []string{"PULL_SIGN_KEY"},
+}
+
+// pullCheckAttestation checks that --attestation-out is used with a single
+// image pulled to a destination, and returns the entity of --sign-key,
+// decrypted up front so that any passphrase prompt happens before the pull.
+// The image options it can't be used with are rejected by pull.Pull.
+func pullCheckAttestation() (*openpgp.Entity, error) {
+	if pullAttestationOut == "" {
+		if pullSignKey != "" {
+			return nil, fmt.Errorf("--sign-key requires --attestation-out")
+		}
+		return nil, nil
+	}
+
+	switch {
+	case pullFromFile != "" || pullFromStdin:
+		return nil, fmt.Errorf("--attestation-out can't be used with --from-file or --from-stdin")
+	case pullVerifyOnly || pullExplain || pullDeffileOnly:
+		return nil, fmt.Errorf("--attestation-out requires an image pulled to a destination")
+	}
+
+	if pullSignKey == "" {
+		return nil, nil
+	}
+	return loadAttestationKey(pullSignKey)
+}
+
+// loadAttestationKey returns the first private key of the key file path,
+// decrypted.
+func loadAttestationKey(path string) (*openpgp.Entity, error) {
+	el, err := sypgp.LoadKeyringFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not load --sign-key %s: %v", path, err)
+	}
+	for _, e := range el {
+		if e.PrivateKey == nil {
+			continue
+		}
+		if e.PrivateKey.Encrypted {
+			if err := sypgp.DecryptKey(e, ""); err != nil {
+				return nil, fmt.Errorf("could not decrypt --sign-key %s, wrong password?", path)
+			}
+		}
+		return e, nil
+	}
+	return nil, fmt.Errorf("no private key in --sign-key %s", path)
+}
@@ -0,0 +1,41 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"testing"
+)
+
+func TestPullCheckAttestation(t *testing.T) {
+	defer func(out, key, fromFile string, verifyOnly bool) {
+		pullAttestationOut, pullSignKey, pullFromFile, pullVerifyOnly = out, key, fromFile, verifyOnly
+	}(pullAttestationOut, pullSignKey, pullFromFile, pullVerifyOnly)
+
+	tests := []struct {
+		name       string
+		out        string
+		key        string
+		fromFile   string
+		verifyOnly bool
+		expectErr  bool
+	}{
+		{name: "None"},
+		{name: "Unsigned", out: "attestation.json"},
+		{name: "KeyWithoutOut", key: "key.asc", expectErr: true},
+		{name: "MissingKey", out: "attestation.json", key: "/non/existent/key.asc", expectErr: true},
+		{name: "FromFile", out: "attestation.json", fromFile: "images.txt", expectErr: true},
+		{name: "VerifyOnly", out: "attestation.json", verifyOnly: true, expectErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pullAttestationOut, pullSignKey, pullFromFile, pullVerifyOnly = tt.out, tt.key, tt.fromFile, tt.verifyOnly
+			_, err := pullCheckAttestation()
+			if (err != nil) != tt.expectErr {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
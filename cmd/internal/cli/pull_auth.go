@@ -0,0 +1,37 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"fmt"
+
+	"github.com/sylabs/singularity/internal/pkg/util/auth"
+	"github.com/sylabs/singularity/pkg/sylog"
+)
+
+// pullApplyLibraryAuthFile replaces the library token with the one of
+// --library-auth-file, if set, exiting if it can't be read.
+func pullApplyLibraryAuthFile() {
+	if pullLibraryAuthFile == "" {
+		return
+	}
+	token, err := readLibraryAuthFile(pullLibraryAuthFile)
+	if err != nil {
+		sylog.Fatalf("%v", err)
+	}
+	authToken, authWarning = token, ""
+	sylog.Debugf("Using the library token of %s", pullLibraryAuthFile)
+}
+
+// readLibraryAuthFile returns the library token of the file path, failing
+// unless it holds a valid one. The error never includes the token.
+func readLibraryAuthFile(path string) (string, error) {
+	token, warning := auth.ReadToken(path)
+	if token == "" {
+		return "", fmt.Errorf("invalid --library-auth-file %s: %s", path, warning)
+	}
+	return token, nil
+}
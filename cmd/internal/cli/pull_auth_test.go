@@ -0,0 +1,149 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadLibraryAuthFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pull-auth-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	token := strings.Repeat("a", 200)
+	short := "secret"
+	tests := []struct {
+		name    string
+		content *string
+		want    string
+		wantErr string
+	}{
+		{name: "Valid", content: &token, want: token},
+		{name: "Missing", wantErr: "not found"},
+		{name: "Malformed", content: &short, wantErr: "too short"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name)
+			if tt.content != nil {
+				if err := ioutil.WriteFile(path, []byte(*tt.content+"\n"), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got, err := readLibraryAuthFile(path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+				if strings.Contains(err.Error(), short) {
+					t.Errorf("error %q includes the token", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got token %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDockerAuthFromFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pull-auth-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	auth := func(user string) string {
+		return base64.StdEncoding.EncodeToString([]byte(user + ":" + user + "-secret"))
+	}
+	valid := filepath.Join(dir, "auth.json")
+	content := `{"auths": {
+		"docker.io": {"auth": "` + auth("hub") + `"},
+		"quay.io": {"auth": "` + auth("quay") + `"},
+		"registry.example.com:5000": {"auth": "` + auth("example") + `"}
+	}}`
+	if err := ioutil.WriteFile(valid, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	malformed := filepath.Join(dir, "malformed.json")
+	if err := ioutil.WriteFile(malformed, []byte(`{"auths": {"quay.io": `), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(authFile string) {
+		dockerAuthFile = authFile
+	}(dockerAuthFile)
+	defer func(env string, set bool) {
+		if set {
+			os.Setenv("REGISTRY_AUTH_FILE", env)
+		} else {
+			os.Unsetenv("REGISTRY_AUTH_FILE")
+		}
+	}(os.LookupEnv("REGISTRY_AUTH_FILE"))
+
+	tests := []struct {
+		name     string
+		authFile string
+		env      string
+		ref      string
+		wantUser string
+		wantErr  string
+	}{
+		{name: "NoAuthFile", ref: "docker://alpine"},
+		{name: "Missing", authFile: filepath.Join(dir, "missing.json"), ref: "docker://alpine", wantErr: "unable to access auth file"},
+		{name: "Malformed", authFile: malformed, ref: "docker://quay.io/org/image", wantErr: "while reading auth file"},
+		{name: "DockerHub", authFile: valid, ref: "docker://alpine", wantUser: "hub"},
+		{name: "Registry", authFile: valid, ref: "docker://quay.io/org/image:latest", wantUser: "quay"},
+		{name: "RegistryPort", authFile: valid, ref: "docker://registry.example.com:5000/image", wantUser: "example"},
+		{name: "Oras", authFile: valid, ref: "oras://quay.io/org/image:latest", wantUser: "quay"},
+		{name: "UnknownRegistry", authFile: valid, ref: "docker://ghcr.io/org/image"},
+		{name: "NoRegistry", authFile: valid, ref: "docker-archive:/tmp/image.tar"},
+		{name: "Env", env: valid, ref: "docker://quay.io/org/image", wantUser: "quay"},
+		{name: "FlagOverEnv", authFile: valid, env: malformed, ref: "docker://quay.io/org/image", wantUser: "quay"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dockerAuthFile = tt.authFile
+			os.Setenv("REGISTRY_AUTH_FILE", tt.env)
+
+			got, err := dockerAuthFromFile(tt.ref)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.wantUser == "" {
+				if got != nil {
+					t.Errorf("unexpected credentials for %s: %s", tt.ref, got.Username)
+				}
+				return
+			}
+			if got == nil {
+				t.Fatalf("no credentials for %s", tt.ref)
+			}
+			if got.Username != tt.wantUser || got.Password != tt.wantUser+"-secret" {
+				t.Errorf("got credentials %s:%s, want those of %s", got.Username, got.Password, tt.wantUser)
+			}
+		})
+	}
+}
@@ -0,0 +1,376 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	ocitypes "github.com/containers/image/v5/types"
+	"github.com/spf13/cobra"
+	"github.com/sylabs/singularity/internal/pkg/cache"
+	"github.com/sylabs/singularity/internal/pkg/client"
+	"github.com/sylabs/singularity/internal/pkg/util/uri"
+	"github.com/sylabs/singularity/pkg/pull"
+	"github.com/sylabs/singularity/pkg/sylog"
+)
+
+// pullBatchItem is an image pulled in batch mode.
+type pullBatchItem struct {
+	ref      string
+	pullFrom string
+	pullTo   string
+	ociAuth  *ocitypes.DockerAuthConfig
+	opts     pullImageOptions
+	// skip is set if pullTo exists and --on-conflict is skip
+	skip bool
+	// conflict is the error of an existing pullTo, reported once pulled
+	conflict error
+}
+
+// readPullRefs returns the URIs read from r, one per line. Empty lines and
+// lines starting with '#' are ignored, as is anything following the URI on a
+// line so that a --manifest-out file can be read back.
+func readPullRefs(r io.Reader) ([]string, error) {
+	var refs []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		refs = append(refs, strings.Fields(line)[0])
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read image list: %v", err)
+	}
+	return refs, nil
+}
+
+// readPullImages returns the images listed in b, read from name, in the
+// structured or the plain line format.
+func readPullImages(name string, b []byte) ([]pullListImage, error) {
+	if isPullList(name, b) {
+		images, err := parsePullList(b)
+		if err != nil {
+			return nil, fmt.Errorf("invalid image list %s: %v", name, err)
+		}
+		return images, nil
+	}
+
+	refs, err := readPullRefs(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	images := make([]pullListImage, len(refs))
+	for i, ref := range refs {
+		images[i] = pullListImage{URI: ref}
+	}
+	return images, nil
+}
+
+// pullBatchRefs returns the images to pull in batch mode, read from
+// --from-file or from stdin with --from-stdin.
+func pullBatchRefs() ([]pullListImage, error) {
+	if pullFromFile != "" && pullFromStdin {
+		return nil, fmt.Errorf("--from-file and --from-stdin are mutually exclusive")
+	}
+
+	if pullFromStdin {
+		b, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, fmt.Errorf("could not read image list: %v", err)
+		}
+		images, err := readPullImages("stdin", b)
+		if err != nil {
+			return nil, err
+		}
+		if len(images) == 0 {
+			return nil, fmt.Errorf("no images read from stdin")
+		}
+		return images, nil
+	}
+
+	b, err := ioutil.ReadFile(pullFromFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not open image list: %v", err)
+	}
+	images, err := readPullImages(pullFromFile, b)
+	if err != nil {
+		return nil, err
+	}
+	if len(images) == 0 {
+		return nil, fmt.Errorf("no images listed in %s", pullFromFile)
+	}
+	return images, nil
+}
+
+// pullRunBatch pulls the images of --from-file or --from-stdin through
+// imgCache, the --tmpfs base being tmpfs if set.
+func pullRunBatch(ctx context.Context, cmd *cobra.Command, imgCache *cache.Handle, tmpfs string) error {
+	switch {
+	case pullExplain:
+		return fmt.Errorf("--explain can't be used with --from-file or --from-stdin")
+	case pullDeffileOnly:
+		return fmt.Errorf("--deffile-only can't be used with --from-file or --from-stdin")
+	case len(pullArchFallback) > 0:
+		return fmt.Errorf("--arch-fallback can't be used with --from-file or --from-stdin")
+	case pullOutputFormat != formatSIF:
+		return fmt.Errorf("--output-format %s can't be used with --from-file or --from-stdin", pullOutputFormat)
+	}
+	if pullTmpfs {
+		if pullDir == "" {
+			pullDir = tmpfs
+		}
+		if err := checkTmpfsDest(filepath.Join(pullDir, "image")); err != nil {
+			return err
+		}
+	}
+
+	d := pullTmpfsDir(ctx, tmpfs)
+	err := pullBatch(ctx, cmd, imgCache, pullJobs)
+	d.Remove()
+	return d.Err(err)
+}
+
+// pullBatch pulls the images listed with --from-file or --from-stdin, up to
+// jobs at a time. All the images are attempted, an error is returned if any
+// of them failed.
+func pullBatch(ctx context.Context, cmd *cobra.Command, imgCache *cache.Handle, jobs int) error {
+	if pullImageName != "" {
+		return fmt.Errorf("--name can't be used with --from-file or --from-stdin")
+	}
+	if pullResolvedOut != "" {
+		return fmt.Errorf("--resolved-out can't be used with --from-file or --from-stdin")
+	}
+	if pullChecksum != "" {
+		return fmt.Errorf("--checksum can't be used with --from-file or --from-stdin, set the sha256 of the images in a structured image list")
+	}
+	if jobs < 1 {
+		return fmt.Errorf("--jobs must be at least 1")
+	}
+
+	images, err := pullBatchRefs()
+	if err != nil {
+		return err
+	}
+
+	refs := make([]string, 0, len(images))
+	for _, img := range images {
+		// the canonical URI is used from here on, as for single pulls
+		transport, ref, err := uri.Normalize(pullExpandAlias(img.URI))
+		if err != nil {
+			return fmt.Errorf("bad URI %s: %v", img.URI, err)
+		}
+		refs = append(refs, transport+":"+ref)
+	}
+	if err := pullCheckHosts(cmd, refs...); err != nil {
+		return err
+	}
+
+	// resolve destinations and credentials up front so that any prompt
+	// happens before the concurrent downloads start
+	items := make([]pullBatchItem, 0, len(images))
+	dests := make(map[string]string)
+	for i, img := range images {
+		listed := img.URI
+		pullFrom := refs[i]
+		transport, _ := uri.Split(pullFrom)
+		if transport != LibraryProtocol && transport != "" && pullStripSignature {
+			return fmt.Errorf("--strip-signature is only supported for library images: %s", pullFrom)
+		}
+
+		pullTo := img.Name
+		if pullTo == "" {
+			arch := img.Arch
+			if arch == "" {
+				arch = pullNameArch(cmd)
+			}
+			pullTo = pullDefaultName(transport, pullFrom, arch)
+		}
+		if pullDir != "" {
+			pullTo = filepath.Join(pullDir, pullTo)
+		}
+		if other, ok := dests[pullTo]; ok {
+			return fmt.Errorf("%s and %s would both be pulled to %s", other, pullFrom, pullTo)
+		}
+		dests[pullTo] = pullFrom
+
+		// renamed destinations must not clash with the listed ones either
+		resolved, skip, conflict := pullResolveConflict(pullTo, func(path string) bool {
+			_, ok := dests[path]
+			return ok
+		})
+		if resolved != pullTo && conflict == nil {
+			sylog.Infof("Image file already exists: %q - pulling %s to %q", pullTo, pullFrom, resolved)
+			pullTo = resolved
+			dests[pullTo] = pullFrom
+		}
+
+		pullFrom, err := pullMirrorRef(pullFrom)
+		if err != nil {
+			return err
+		}
+		ociAuth, err := pullDockerCredentials(cmd, pullFrom)
+		if err != nil {
+			return fmt.Errorf("while creating Docker credentials for %s: %v", pullFrom, err)
+		}
+		opts := pullImageOptions{arch: img.Arch, sha256: img.SHA256}
+		if opts.arch == "" && (transport == LibraryProtocol || transport == "") && !cmd.Flags().Lookup("arch").Changed {
+			arch, prefix, err := pullCollectionArch(pullFrom)
+			if err != nil {
+				return err
+			}
+			if arch != "" {
+				sylog.Debugf("Pulling %s for %s, the default architecture of %s in singularity.conf", pullFrom, arch, prefix)
+				opts.arch = arch
+			}
+		}
+		if img.SignFingerprint != "" {
+			opts.fingerprints = []string{img.SignFingerprint}
+		}
+		items = append(items, pullBatchItem{ref: listed, pullFrom: pullFrom, pullTo: pullTo, ociAuth: ociAuth, opts: opts, skip: skip, conflict: conflict})
+	}
+
+	if pullDryRun {
+		return pullPlan(ctx, os.Stdout, imgCache, items)
+	}
+
+	errs := pullBatchRun(ctx, imgCache, items, jobs)
+	return pullBatchFinish(ctx, items, errs, pullManifestOut)
+}
+
+// pullBatchRun pulls the items, up to jobs at a time, and returns the error
+// of each of them.
+func pullBatchRun(ctx context.Context, imgCache *cache.Handle, items []pullBatchItem, jobs int) []error {
+	// concurrent progress bars are grouped to remain legible
+	var pg *client.ProgressGroup
+	if jobs > 1 {
+		pg = client.NewProgressGroup()
+	}
+
+	errs := make([]error, len(items))
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < jobs && i < len(items); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range work {
+				errs[idx] = pullBatchImage(ctx, pg, imgCache, items[idx])
+			}
+		}()
+	}
+	for idx := range items {
+		work <- idx
+	}
+	close(work)
+	wg.Wait()
+	if pg != nil {
+		pg.Wait()
+	}
+	return errs
+}
+
+// pullBatchFinish reports the result of the pulls of the items, hardlinks
+// the identical ones with --dedup, writes the result to the manifest if set,
+// and returns an error if any of them failed.
+func pullBatchFinish(ctx context.Context, items []pullBatchItem, errs []error, manifest string) error {
+	pullReportFlush()
+	failed, unsigned := 0, 0
+	for idx, err := range errs {
+		pullNotify(ctx, items[idx].pullFrom, items[idx].pullTo, err)
+		if err != nil {
+			failed++
+			sylog.Errorf("Failed to pull %s: %s", items[idx].pullFrom, err)
+		}
+		var unsignedErr *pullUnsignedError
+		if errors.As(err, &unsignedErr) {
+			unsigned++
+		}
+	}
+	sylog.Infof("Pulled %d of %d images", len(items)-failed, len(items))
+
+	if pullDedup {
+		var paths []string
+		for idx, item := range items {
+			if errs[idx] == nil {
+				paths = append(paths, item.pullTo)
+			}
+		}
+		res, err := pullDedupImages(paths)
+		if err != nil {
+			return fmt.Errorf("while deduplicating images: %v", err)
+		}
+		sylog.Infof("Replaced %d identical images with hardlinks, saving %s", res.linked, formatBytes(res.saved))
+	}
+
+	if manifest != "" {
+		if err := pullBatchManifest(manifest, items, errs); err != nil {
+			return fmt.Errorf("while writing manifest: %v", err)
+		}
+		sylog.Infof("Manifest written to %s", manifest)
+	}
+	if unsigned > 0 {
+		return &pullUnsignedError{err: fmt.Errorf("%d of %d images failed to pull, %d of them unsigned", failed, len(items), unsigned)}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d images failed to pull", failed, len(items))
+	}
+	return nil
+}
+
+// pullBatchImage pulls a single image of a batch, with its messages and
+// progress bar prefixed by the image name.
+func pullBatchImage(ctx context.Context, pg *client.ProgressGroup, imgCache *cache.Handle, item pullBatchItem) error {
+	name := filepath.Base(item.pullTo)
+
+	if item.conflict != nil {
+		return item.conflict
+	}
+	if item.skip {
+		sylog.Infof("%s: already exists, skipping %s", name, item.pullFrom)
+		return nil
+	}
+
+	if pg != nil {
+		ctx = pg.Context(ctx, name)
+	}
+
+	sylog.Infof("%s: pulling %s", name, item.pullFrom)
+	if err := pullImage(ctx, imgCache, item.pullTo, item.pullFrom, item.ociAuth, item.opts); err != nil {
+		return err
+	}
+	sylog.Infof("%s: pulled to %s", name, item.pullTo)
+	return nil
+}
+
+// pullBatchManifest writes the --manifest-out file of a batch pull, hashing
+// the images that were pulled successfully.
+func pullBatchManifest(path string, items []pullBatchItem, errs []error) error {
+	entries := make([]pullManifestEntry, len(items))
+	for idx, item := range items {
+		entries[idx] = pullManifestEntry{ref: item.ref, path: item.pullTo, err: errs[idx]}
+		if errs[idx] != nil {
+			continue
+		}
+		hash, err := pull.FileSHA256(item.pullTo)
+		if err != nil {
+			return fmt.Errorf("could not hash %s: %v", item.pullTo, err)
+		}
+		entries[idx].hash = hash
+	}
+	return writePullManifest(path, entries)
+}
@@ -0,0 +1,33 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"github.com/sylabs/singularity/internal/pkg/cache"
+	"github.com/sylabs/singularity/pkg/sylog"
+)
+
+// pullCacheHandle returns the handle of the image cache configured by cfg,
+// or of a disabled cache if the cache directory can't be created or written
+// to, so that images are pulled straight to their destination and verified
+// there, as with --disable-cache, rather than failing.
+func pullCacheHandle(cfg cache.Config) *cache.Handle {
+	cfg.ParentDir = cacheParentDir()
+	h, err := cache.New(cfg)
+	if err == nil {
+		err = h.CheckWritable()
+	}
+	if err == nil {
+		return h
+	}
+
+	sylog.Warningf("Image cache unavailable, pulling without it: %v", err)
+	h, err = cache.New(cache.Config{Disable: true})
+	if err != nil {
+		sylog.Fatalf("Failed to create an image cache handle: %s", err)
+	}
+	return h
+}
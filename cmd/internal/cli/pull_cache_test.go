@@ -0,0 +1,52 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sylabs/singularity/internal/pkg/cache"
+)
+
+func TestPullCacheHandle(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pull-cache-test-")
+	if err != nil {
+		t.Fatalf("could not create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	// the cache is disabled unless the real user can write to it
+	if err := os.Chmod(dir, 0777); err != nil {
+		t.Fatalf("could not change permissions of %s: %v", dir, err)
+	}
+
+	defer func(v string, ok bool) {
+		if ok {
+			os.Setenv(cache.DirEnv, v)
+		} else {
+			os.Unsetenv(cache.DirEnv)
+		}
+	}(os.LookupEnv(cache.DirEnv))
+	os.Setenv(cache.DirEnv, dir)
+
+	if h := pullCacheHandle(cache.Config{}); h.IsDisabled() {
+		t.Errorf("unexpected disabled cache in %s", dir)
+	}
+
+	// a cache type directory replaced with a file can't be created
+	library := filepath.Join(dir, cache.SubDirName, cache.LibraryCacheType)
+	if err := os.RemoveAll(library); err != nil {
+		t.Fatalf("could not remove %s: %v", library, err)
+	}
+	if err := ioutil.WriteFile(library, nil, 0600); err != nil {
+		t.Fatalf("could not write %s: %v", library, err)
+	}
+	if h := pullCacheHandle(cache.Config{}); !h.IsDisabled() {
+		t.Errorf("unexpected enabled cache with %s not a directory", library)
+	}
+}
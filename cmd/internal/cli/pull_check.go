@@ -0,0 +1,212 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/sylabs/singularity/docs"
+	singularityclient "github.com/sylabs/singularity/internal/pkg/client"
+	"github.com/sylabs/singularity/pkg/cmdline"
+	"github.com/sylabs/singularity/pkg/signing"
+	"github.com/sylabs/singularity/pkg/sylog"
+)
+
+// pullCheckRegistry is the docker registry checked along with the library
+// and key servers.
+var pullCheckRegistry string
+
+// --registry
+var pullCheckRegistryFlag = cmdline.Flag{
+	ID:           "pullCheckRegistryFlag",
+	Value:        &pullCheckRegistry,
+	DefaultValue: "",
+	Name:         "registry",
+	Usage:        "also check the given docker registry, e.g. docker.io or https://registry.example.com",
+	EnvKeys:      []string{"PULL_CHECK_REGISTRY"},
+}
+
+// pullCheckTimeout bounds the time spent checking an endpoint.
+const pullCheckTimeout = 10 * time.Second
+
+// The TLS states of a checked endpoint.
+const (
+	tlsValid   = "valid"
+	tlsInvalid = "invalid"
+	tlsNone    = "none"
+)
+
+func init() {
+	addCmdInit(func(cmdManager *cmdline.CommandManager) {
+		cmdManager.RegisterFlagForCmd(&pullCheckRegistryFlag, PullCheckCmd)
+	})
+}
+
+// PullCheckCmd is 'singularity pull check' and checks that the endpoints
+// images are pulled from can be reached
+var PullCheckCmd = &cobra.Command{
+	DisableFlagsInUseLine: true,
+	Args:                  cobra.NoArgs,
+	PreRun:                sylabsToken,
+	Run:                   pullCheckRun,
+
+	Use:     docs.PullCheckUse,
+	Short:   docs.PullCheckShort,
+	Long:    docs.PullCheckLong,
+	Example: docs.PullCheckExample,
+}
+
+// pullEndpoint is the result of the check of an endpoint.
+type pullEndpoint struct {
+	Name      string `json:"name"`
+	URL       string `json:"url"`
+	Reachable bool   `json:"reachable"`
+	// Status is the HTTP status code of the response, any response
+	// making the endpoint reachable
+	Status int `json:"status,omitempty"`
+	// TLS is the validity of the TLS certificate of an https endpoint:
+	// valid, invalid or none for an http one
+	TLS string `json:"tls"`
+	// CertExpiry is the expiry time of a valid certificate
+	CertExpiry *time.Time `json:"certExpiry,omitempty"`
+	LatencyMs  int64      `json:"latencyMs"`
+	Error      string     `json:"error,omitempty"`
+}
+
+func pullCheckRun(cmd *cobra.Command, args []string) {
+	handlePullFlags(cmd)
+
+	targets := [][2]string{{"library", strings.TrimSuffix(pullLibraryURI, "/") + "/version"}}
+	keyServers := keyServerURL
+	if len(pullKeyServers) > 0 {
+		keyServers = strings.Join(pullKeyServers, ",")
+	}
+	for _, ks := range signing.KeyServers(keyServers) {
+		if ks == "" {
+			ks = keyServerURL
+		}
+		targets = append(targets, [2]string{"keyserver", ks})
+	}
+	if pullCheckRegistry != "" {
+		targets = append(targets, [2]string{"registry", registryCheckURL(pullCheckRegistry)})
+	}
+
+	client := singularityclient.NewHTTPClient(pullCheckTimeout)
+	endpoints := make([]pullEndpoint, 0, len(targets))
+	unreachable := 0
+	for _, t := range targets {
+		e := checkPullEndpoint(cmd.Context(), client, t[0], t[1])
+		if !e.Reachable {
+			unreachable++
+		}
+		endpoints = append(endpoints, e)
+	}
+
+	if err := writePullEndpoints(os.Stdout, endpoints, pullJSON); err != nil {
+		sylog.Fatalf("While writing the check results: %v", err)
+	}
+	if unreachable > 0 {
+		sylog.Fatalf("%d of %d endpoints are not reachable", unreachable, len(endpoints))
+	}
+}
+
+// registryCheckURL returns the URL of the API of the docker registry,
+// an https one if registry is a host, Docker Hub being served by
+// registry-1.docker.io.
+func registryCheckURL(registry string) string {
+	if !strings.Contains(registry, "://") {
+		if registry == "docker.io" || registry == "index.docker.io" {
+			registry = "registry-1.docker.io"
+		}
+		registry = "https://" + registry
+	}
+	return strings.TrimSuffix(registry, "/") + "/v2/"
+}
+
+// checkPullEndpoint sends a request to rawURL with client and returns the
+// check result of the endpoint name. Any HTTP response, including an
+// authentication error, makes the endpoint reachable, nothing is
+// downloaded.
+func checkPullEndpoint(ctx context.Context, client *http.Client, name, rawURL string) pullEndpoint {
+	e := pullEndpoint{Name: name, URL: rawURL, TLS: tlsNone}
+	if strings.HasPrefix(rawURL, "https://") {
+		e.TLS = tlsValid
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		e.Error = err.Error()
+		return e
+	}
+	req.Header.Set("User-Agent", pullAgent())
+
+	start := time.Now()
+	res, err := client.Do(req)
+	e.LatencyMs = time.Since(start).Milliseconds()
+	if err != nil {
+		if isCertificateError(err) {
+			e.TLS = tlsInvalid
+		}
+		e.Error = err.Error()
+		return e
+	}
+	defer res.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(res.Body, 4096))
+
+	e.Reachable = true
+	e.Status = res.StatusCode
+	if res.TLS != nil && len(res.TLS.PeerCertificates) > 0 {
+		expiry := res.TLS.PeerCertificates[0].NotAfter
+		e.CertExpiry = &expiry
+	}
+	return e
+}
+
+// isCertificateError returns whether err is due to the TLS certificate of
+// the server failing verification.
+func isCertificateError(err error) bool {
+	var unknownAuthority x509.UnknownAuthorityError
+	var invalid x509.CertificateInvalidError
+	var hostname x509.HostnameError
+	return errors.As(err, &unknownAuthority) || errors.As(err, &invalid) || errors.As(err, &hostname)
+}
+
+// writePullEndpoints writes the check results of the endpoints to w, in
+// JSON format if asJSON.
+func writePullEndpoints(w io.Writer, endpoints []pullEndpoint, asJSON bool) error {
+	if asJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(endpoints)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", "ENDPOINT", "URL", "STATUS", "TLS", "LATENCY")
+	for _, e := range endpoints {
+		status := "unreachable: " + e.Error
+		if e.Reachable {
+			status = fmt.Sprintf("reachable (%d)", e.Status)
+		}
+		tls := e.TLS
+		if e.CertExpiry != nil {
+			tls += ", expires " + e.CertExpiry.Format("2006-01-02")
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%dms\n", e.Name, e.URL, status, tls, e.LatencyMs)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,100 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	useragent "github.com/sylabs/singularity/pkg/util/user-agent"
+)
+
+func TestCheckPullEndpoint(t *testing.T) {
+	useragent.InitValue("singularity", "3.0.0")
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	})
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+	tlsSrv := httptest.NewTLSServer(handler)
+	defer tlsSrv.Close()
+	closed := httptest.NewServer(handler)
+	closed.Close()
+
+	tests := []struct {
+		name      string
+		client    *http.Client
+		url       string
+		reachable bool
+		tls       string
+		expiry    bool
+	}{
+		{name: "HTTP", client: http.DefaultClient, url: srv.URL, reachable: true, tls: tlsNone},
+		{name: "TrustedTLS", client: tlsSrv.Client(), url: tlsSrv.URL, reachable: true, tls: tlsValid, expiry: true},
+		{name: "UntrustedTLS", client: http.DefaultClient, url: tlsSrv.URL, tls: tlsInvalid},
+		{name: "Unreachable", client: http.DefaultClient, url: closed.URL, tls: tlsNone},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := checkPullEndpoint(context.Background(), tt.client, "library", tt.url)
+			if e.Reachable != tt.reachable || e.TLS != tt.tls || (e.CertExpiry != nil) != tt.expiry {
+				t.Errorf("unexpected result %+v", e)
+			}
+			if tt.reachable && e.Status != http.StatusUnauthorized {
+				t.Errorf("unexpected status %d", e.Status)
+			}
+			if !tt.reachable && e.Error == "" {
+				t.Errorf("no error reported")
+			}
+		})
+	}
+}
+
+func TestWritePullEndpoints(t *testing.T) {
+	endpoints := []pullEndpoint{
+		{Name: "library", URL: "https://library.example.com/version", Reachable: true, Status: 200, TLS: tlsValid},
+		{Name: "keyserver", URL: "https://keys.example.com", TLS: tlsInvalid, Error: "x509: certificate signed by unknown authority"},
+	}
+
+	var out bytes.Buffer
+	if err := writePullEndpoints(&out, endpoints, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, s := range []string{"reachable (200)", "unreachable: x509", "invalid"} {
+		if !strings.Contains(out.String(), s) {
+			t.Errorf("%q not found in:\n%s", s, out.String())
+		}
+	}
+
+	out.Reset()
+	if err := writePullEndpoints(&out, endpoints, true); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var decoded []pullEndpoint
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil || len(decoded) != 2 || decoded[1].Reachable {
+		t.Errorf("unexpected JSON output %s (%v)", out.String(), err)
+	}
+}
+
+func TestRegistryCheckURL(t *testing.T) {
+	tests := map[string]string{
+		"docker.io":                    "https://registry-1.docker.io/v2/",
+		"quay.io":                      "https://quay.io/v2/",
+		"http://localhost:5000/":       "http://localhost:5000/v2/",
+		"https://registry.example.com": "https://registry.example.com/v2/",
+	}
+	for registry, expected := range tests {
+		if u := registryCheckURL(registry); u != expected {
+			t.Errorf("%s: got %s, expected %s", registry, u, expected)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sylabs/singularity/pkg/cmdline"
+)
+
+// The --on-conflict strategies, applied when the destination of a pull
+// already exists.
+const (
+	conflictFail      = "fail"
+	conflictOverwrite = "overwrite"
+	conflictRename    = "rename"
+	conflictSkip      = "skip"
+)
+
+var conflictStrategies = []string{conflictFail, conflictOverwrite, conflictRename, conflictSkip}
+
+// pullOnConflict is the --on-conflict strategy, set by pullConflictStrategy
+// from the flags.
+var pullOnConflict string
+
+// --on-conflict
+var pullOnConflictFlag = cmdline.Flag{
+	ID:           "pullOnConflictFlag",
+	Value:        &pullOnConflict,
+	DefaultValue: "",
+	Name:         "on-conflict",
+	Usage:        "what to do when the image file exists: fail (default), overwrite (same as --force), rename to image-1.sif, image-2.sif... or skip the pull",
+	EnvKeys:      []string{"PULL_ON_CONFLICT"},
+}
+
+// pullFollowSymlink when true; pulls to the target of a destination which is
+// a symbolic link.
+var pullFollowSymlink bool
+
+// --follow-symlink
+var pullFollowSymlinkFlag = cmdline.Flag{
+	ID:           "pullFollowSymlinkFlag",
+	Value:        &pullFollowSymlink,
+	DefaultValue: false,
+	Name:         "follow-symlink",
+	Usage:        "pull to the target of the image file if it is a symbolic link, instead of refusing to, or replacing the link itself with --force",
+	EnvKeys:      []string{"PULL_FOLLOW_SYMLINK"},
+}
+
+// maxSymlinks is the number of symbolic links followed in a destination
+// path, as the kernel does.
+const maxSymlinks = 40
+
+// pullConflictStrategy checks --on-conflict and returns the strategy it
+// sets, --force being an alias for overwrite.
+func pullConflictStrategy() (string, error) {
+	strategy := pullOnConflict
+	valid := strategy == ""
+	for _, s := range conflictStrategies {
+		valid = valid || s == strategy
+	}
+	if !valid {
+		return "", fmt.Errorf("invalid --on-conflict %q, must be one of %s", strategy, strings.Join(conflictStrategies, ", "))
+	}
+	if forceOverwrite {
+		if strategy != "" && strategy != conflictOverwrite {
+			return "", fmt.Errorf("--force can't be used with --on-conflict %s", strategy)
+		}
+		return conflictOverwrite, nil
+	}
+	if strategy == "" {
+		return conflictFail, nil
+	}
+	return strategy, nil
+}
+
+// pullResolveConflict returns the path the image is pulled to instead of
+// pullTo according to the --on-conflict strategy, and whether the pull is
+// skipped. Renamed paths for which taken is true are avoided, taken can be
+// nil.
+//
+// A symbolic link, even dangling, is an existing destination. Writing to it
+// would truncate its target, possibly an unrelated file, so a link is only
+// followed with --follow-symlink. Otherwise an overwritten link is kept
+// until the image is pulled, and only then replaced by it, its target being
+// left untouched.
+func pullResolveConflict(pullTo string, taken func(string) bool) (string, bool, error) {
+	fi, err := os.Lstat(pullTo)
+	if os.IsNotExist(err) {
+		return pullTo, false, nil
+	}
+	symlink := err == nil && fi.Mode()&os.ModeSymlink != 0
+	if symlink && pullFollowSymlink {
+		target, err := pullSymlinkTarget(pullTo)
+		if err != nil {
+			return "", false, err
+		}
+		return pullResolveConflict(target, taken)
+	}
+
+	switch pullOnConflict {
+	case conflictOverwrite:
+		return pullTo, false, nil
+	case conflictSkip:
+		return pullTo, true, nil
+	case conflictRename:
+		ext := filepath.Ext(pullTo)
+		base := strings.TrimSuffix(pullTo, ext)
+		for i := 1; ; i++ {
+			renamed := fmt.Sprintf("%s-%d%s", base, i, ext)
+			if _, err := os.Lstat(renamed); !os.IsNotExist(err) {
+				continue
+			}
+			if taken == nil || !taken(renamed) {
+				return renamed, false, nil
+			}
+		}
+	}
+	if symlink {
+		return "", false, fmt.Errorf("image file already exists: %q is a symbolic link - will not overwrite, use --force to replace the link or --follow-symlink to pull to its target", pullTo)
+	}
+	return "", false, fmt.Errorf("image file already exists: %q - will not overwrite", pullTo)
+}
+
+// pullSymlinkTarget returns the path the symbolic link path finally points
+// to, which may not exist.
+func pullSymlinkTarget(path string) (string, error) {
+	target := path
+	for i := 0; i < maxSymlinks; i++ {
+		fi, err := os.Lstat(target)
+		if os.IsNotExist(err) {
+			return target, nil
+		} else if err != nil {
+			return "", err
+		}
+		if fi.Mode()&os.ModeSymlink == 0 {
+			return target, nil
+		}
+		link, err := os.Readlink(target)
+		if err != nil {
+			return "", err
+		}
+		if !filepath.IsAbs(link) {
+			link = filepath.Join(filepath.Dir(target), link)
+		}
+		target = link
+	}
+	return "", fmt.Errorf("too many levels of symbolic links in %q", path)
+}
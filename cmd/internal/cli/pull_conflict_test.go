@@ -0,0 +1,220 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sylabs/singularity/internal/pkg/cache"
+	"github.com/sylabs/singularity/pkg/pull"
+	useragent "github.com/sylabs/singularity/pkg/util/user-agent"
+)
+
+func TestPullConflictStrategy(t *testing.T) {
+	defer func(s string, f bool) { pullOnConflict, forceOverwrite = s, f }(pullOnConflict, forceOverwrite)
+
+	tests := []struct {
+		onConflict string
+		force      bool
+		expected   string
+		ok         bool
+	}{
+		{"", false, conflictFail, true},
+		{"", true, conflictOverwrite, true},
+		{conflictRename, false, conflictRename, true},
+		{conflictOverwrite, true, conflictOverwrite, true},
+		{conflictSkip, true, "", false},
+		{"clobber", false, "", false},
+	}
+	for _, tt := range tests {
+		pullOnConflict, forceOverwrite = tt.onConflict, tt.force
+		s, err := pullConflictStrategy()
+		if (err == nil) != tt.ok || s != tt.expected {
+			t.Errorf("--on-conflict %q with --force %v: got %q (%v), expected %q", tt.onConflict, tt.force, s, err, tt.expected)
+		}
+	}
+}
+
+func TestPullResolveConflict(t *testing.T) {
+	defer func(s string) { pullOnConflict = s }(pullOnConflict)
+
+	dir, err := ioutil.TempDir("", "pull-conflict-")
+	if err != nil {
+		t.Fatalf("could not create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	image := filepath.Join(dir, "image.sif")
+	for _, p := range []string{image, filepath.Join(dir, "image-1.sif")} {
+		if err := ioutil.WriteFile(p, nil, 0644); err != nil {
+			t.Fatalf("could not write %s: %v", p, err)
+		}
+	}
+	missing := filepath.Join(dir, "missing.sif")
+	taken := func(p string) bool { return p == filepath.Join(dir, "image-2.sif") }
+
+	tests := []struct {
+		strategy string
+		pullTo   string
+		expected string
+		skip     bool
+		ok       bool
+	}{
+		{conflictFail, missing, missing, false, true},
+		{conflictSkip, missing, missing, false, true},
+		{conflictFail, image, "", false, false},
+		{conflictOverwrite, image, image, false, true},
+		{conflictSkip, image, image, true, true},
+		{conflictRename, image, filepath.Join(dir, "image-3.sif"), false, true},
+	}
+	for _, tt := range tests {
+		pullOnConflict = tt.strategy
+		path, skip, err := pullResolveConflict(tt.pullTo, taken)
+		if (err == nil) != tt.ok || path != tt.expected || skip != tt.skip {
+			t.Errorf("%s with %s: got %q, skip %v (%v), expected %q, skip %v", tt.pullTo, tt.strategy, path, skip, err, tt.expected, tt.skip)
+		}
+	}
+}
+
+func TestPullResolveConflictSymlink(t *testing.T) {
+	defer func(s string, f bool) { pullOnConflict, pullFollowSymlink = s, f }(pullOnConflict, pullFollowSymlink)
+
+	dir, err := ioutil.TempDir("", "pull-conflict-")
+	if err != nil {
+		t.Fatalf("could not create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// an unrelated file the destination points to
+	secret := filepath.Join(dir, "secret")
+	if err := ioutil.WriteFile(secret, []byte("secret"), 0600); err != nil {
+		t.Fatalf("could not write %s: %v", secret, err)
+	}
+	link := func(name, target string) string {
+		p := filepath.Join(dir, name)
+		if err := os.Symlink(target, p); err != nil {
+			t.Fatalf("could not create symbolic link %s: %v", p, err)
+		}
+		return p
+	}
+	image := link("image.sif", "secret")
+	dangling := link("dangling.sif", "missing.sif")
+	chained := link("chained.sif", "image.sif")
+	loop := link("loop.sif", "loop.sif")
+
+	tests := []struct {
+		name     string
+		strategy string
+		follow   bool
+		pullTo   string
+		expected string
+		ok       bool
+	}{
+		{"Fail", conflictFail, false, image, "", false},
+		{"FailDangling", conflictFail, false, dangling, "", false},
+		{"Rename", conflictRename, false, image, filepath.Join(dir, "image-1.sif"), true},
+		{"FollowFail", conflictFail, true, image, "", false},
+		{"FollowOverwrite", conflictOverwrite, true, chained, secret, true},
+		{"FollowDangling", conflictFail, true, dangling, filepath.Join(dir, "missing.sif"), true},
+		{"FollowLoop", conflictOverwrite, true, loop, "", false},
+		{"Overwrite", conflictOverwrite, false, image, image, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pullOnConflict, pullFollowSymlink = tt.strategy, tt.follow
+			path, _, err := pullResolveConflict(tt.pullTo, nil)
+			if (err == nil) != tt.ok || path != tt.expected {
+				t.Errorf("got %q (%v), expected %q", path, err, tt.expected)
+			}
+		})
+	}
+
+	// the link is only replaced once the image is pulled
+	if !pull.IsSymlink(image) {
+		t.Errorf("symbolic link %s removed before the pull", image)
+	}
+}
+
+func TestPullImageSymlink(t *testing.T) {
+	useragent.InitValue("singularity", "3.0.0")
+	defer func(f string) { pullOutputFormat = f }(pullOutputFormat)
+	pullOutputFormat = formatSIF
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/image.sif" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, "image")
+	}))
+	defer srv.Close()
+
+	imgCache, err := cache.New(cache.Config{Disable: true})
+	if err != nil {
+		t.Fatalf("could not create cache: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		from    string
+		wantErr bool
+	}{
+		{"Pulled", srv.URL + "/image.sif", false},
+		{"Failed", srv.URL + "/missing.sif", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "pull-conflict-")
+			if err != nil {
+				t.Fatalf("could not create temporary directory: %v", err)
+			}
+			defer os.RemoveAll(dir)
+
+			secret := filepath.Join(dir, "secret")
+			if err := ioutil.WriteFile(secret, []byte("secret"), 0600); err != nil {
+				t.Fatalf("could not write %s: %v", secret, err)
+			}
+			pullTo := filepath.Join(dir, "image.sif")
+			if err := os.Symlink("secret", pullTo); err != nil {
+				t.Fatalf("could not create symbolic link %s: %v", pullTo, err)
+			}
+
+			err = pullImage(context.Background(), imgCache, pullTo, tt.from, nil, pullImageOptions{})
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("unexpected success pulling %s", tt.from)
+				}
+				if !pull.IsSymlink(pullTo) {
+					t.Errorf("symbolic link %s removed by a failed pull", pullTo)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if pull.IsSymlink(pullTo) {
+					t.Errorf("symbolic link %s not replaced", pullTo)
+				}
+				if b, err := ioutil.ReadFile(pullTo); err != nil || string(b) != "image" {
+					t.Errorf("unexpected image %s: %q (%v)", pullTo, b, err)
+				}
+			}
+			if b, err := ioutil.ReadFile(secret); err != nil || string(b) != "secret" {
+				t.Errorf("%s was overwritten: %q (%v)", secret, b, err)
+			}
+			// nothing is left next to the link
+			if fis, err := ioutil.ReadDir(dir); err != nil || len(fis) != 2 {
+				t.Errorf("unexpected files in %s: %d (%v)", dir, len(fis), err)
+			}
+		})
+	}
+}
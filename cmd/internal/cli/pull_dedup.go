@@ -0,0 +1,113 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/sylabs/singularity/pkg/cmdline"
+	"github.com/sylabs/singularity/pkg/pull"
+	"github.com/sylabs/singularity/pkg/sylog"
+	"golang.org/x/sys/unix"
+)
+
+// pullDedup when true; hardlinks the identical images of a batch pull.
+var pullDedup bool
+
+// --dedup
+var pullDedupFlag = cmdline.Flag{
+	ID:           "pullDedupFlag",
+	Value:        &pullDedup,
+	DefaultValue: false,
+	Name:         "dedup",
+	Usage:        "with --from-file, --from-stdin or pull mirror, replace the pulled images identical to another one with hardlinks to it",
+	EnvKeys:      []string{"PULL_DEDUP"},
+}
+
+// pullDedupResult is the outcome of the deduplication of the images of a
+// batch pull.
+type pullDedupResult struct {
+	// linked is the number of images replaced with a hardlink
+	linked int
+	// saved is the size of the replaced images
+	saved int64
+}
+
+// pullDedupImages replaces the images of paths identical to a previous one
+// with a hardlink to it. Images are identical if their sha256 hashes match,
+// the hashes being computed once all of them were written. Images on
+// another filesystem than the first identical image are kept as separate
+// copies, as are the images that aren't regular files, e.g. sandboxes.
+func pullDedupImages(paths []string) (pullDedupResult, error) {
+	var res pullDedupResult
+	first := make(map[string][]string)
+
+	for _, path := range paths {
+		fi, err := os.Lstat(path)
+		if err != nil {
+			return res, err
+		}
+		if !fi.Mode().IsRegular() {
+			continue
+		}
+		hash, err := pull.FileSHA256(path)
+		if err != nil {
+			return res, fmt.Errorf("could not hash %s: %v", path, err)
+		}
+
+		linked := false
+		for _, target := range first[hash] {
+			ok, err := pullHardlink(target, path, fi)
+			if err != nil {
+				return res, err
+			}
+			if ok {
+				res.linked++
+				res.saved += fi.Size()
+				linked = true
+				break
+			}
+		}
+		// a copy on another filesystem is a target for the next ones there
+		if !linked {
+			first[hash] = append(first[hash], path)
+		}
+	}
+	return res, nil
+}
+
+// pullHardlink replaces path, whose info is fi, with a hardlink to target,
+// returning false if they are already the same file or on different
+// filesystems. The link is created next to path then renamed over it, so
+// that path is never missing.
+func pullHardlink(target, path string, fi os.FileInfo) (bool, error) {
+	tfi, err := os.Stat(target)
+	if err != nil {
+		return false, err
+	}
+	if os.SameFile(tfi, fi) {
+		return false, nil
+	}
+
+	tmp := filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".dedup")
+	if err := os.Link(target, tmp); err != nil {
+		var linkErr *os.LinkError
+		if errors.As(err, &linkErr) && linkErr.Err == unix.EXDEV {
+			sylog.Verbosef("Keeping %s as a copy of %s on another filesystem", path, target)
+			return false, nil
+		}
+		return false, fmt.Errorf("could not link %s to %s: %v", path, target, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return false, fmt.Errorf("could not replace %s with a link to %s: %v", path, target, err)
+	}
+	sylog.Verbosef("Replaced %s with a hardlink to the identical %s", path, target)
+	return true, nil
+}
@@ -0,0 +1,80 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPullDedupImages(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pull-dedup-")
+	if err != nil {
+		t.Fatalf("could not create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"alpine_latest.sif": "alpine",
+		"alpine_3.11.sif":   "alpine",
+		"ubuntu_latest.sif": "ubuntu",
+		"alpine_3.sif":      "alpine",
+	}
+	var paths []string
+	for _, name := range []string{"alpine_latest.sif", "alpine_3.11.sif", "ubuntu_latest.sif", "alpine_3.sif"} {
+		p := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(p, []byte(files[name]), 0644); err != nil {
+			t.Fatalf("could not write %s: %v", p, err)
+		}
+		paths = append(paths, p)
+	}
+	// sandboxes are left as is
+	sandbox := filepath.Join(dir, "alpine_latest")
+	if err := os.Mkdir(sandbox, 0755); err != nil {
+		t.Fatalf("could not create %s: %v", sandbox, err)
+	}
+	paths = append(paths, sandbox)
+
+	res, err := pullDedupImages(paths)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if res.linked != 2 || res.saved != int64(2*len("alpine")) {
+		t.Errorf("got %d images linked saving %d bytes, expected 2 saving %d", res.linked, res.saved, 2*len("alpine"))
+	}
+
+	same := func(a, b string) bool {
+		fa, err := os.Stat(a)
+		if err != nil {
+			t.Fatalf("could not stat %s: %v", a, err)
+		}
+		fb, err := os.Stat(b)
+		if err != nil {
+			t.Fatalf("could not stat %s: %v", b, err)
+		}
+		return os.SameFile(fa, fb)
+	}
+	if !same(paths[0], paths[1]) || !same(paths[0], paths[3]) {
+		t.Errorf("identical images not hardlinked")
+	}
+	if same(paths[0], paths[2]) {
+		t.Errorf("different images hardlinked")
+	}
+	if b, err := ioutil.ReadFile(paths[3]); err != nil || string(b) != "alpine" {
+		t.Errorf("unexpected content of %s: %q (%v)", paths[3], b, err)
+	}
+
+	// already linked images are not counted again
+	res, err = pullDedupImages(paths)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if res.linked != 0 {
+		t.Errorf("got %d images linked again", res.linked)
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"github.com/sylabs/singularity/internal/pkg/cache"
+	"github.com/sylabs/singularity/internal/pkg/util/sifedit"
+	"github.com/sylabs/singularity/pkg/cmdline"
+	"github.com/sylabs/singularity/pkg/pull"
+	"github.com/sylabs/singularity/pkg/sylog"
+)
+
+// pullDeffileOnly when true; only the definition file of the pulled image
+// is written.
+var pullDeffileOnly bool
+
+// --deffile-only
+var pullDeffileOnlyFlag = cmdline.Flag{
+	ID:           "pullDeffileOnlyFlag",
+	Value:        &pullDeffileOnly,
+	DefaultValue: false,
+	Name:         "deffile-only",
+	Usage:        "only write the definition file the image was built from, to the given destination or to stdout",
+	EnvKeys:      []string{"PULL_DEFFILE_ONLY"},
+}
+
+// pullDeffile pulls pullFrom to a temporary file, going through the checks
+// of any pull, and writes the definition file of the image to the
+// destination given in args, or to stdout if there is none.
+func pullDeffile(ctx context.Context, cmd *cobra.Command, imgCache *cache.Handle, args []string, pullFrom string, opts pullImageOptions) error {
+	deffileTo := pullImageName
+	if deffileTo == "" && len(args) == 2 {
+		deffileTo = args[0]
+	}
+	if deffileTo != "" && pullDir != "" {
+		deffileTo = filepath.Join(pullDir, deffileTo)
+	}
+	if deffileTo != "" {
+		resolved, skip, err := pullResolveConflict(deffileTo, nil)
+		if err != nil {
+			return err
+		}
+		if skip {
+			sylog.Infof("File already exists: %q - skipping the pull", deffileTo)
+			return nil
+		}
+		deffileTo = resolved
+	}
+
+	mirrored, err := pullMirrorRef(pullFrom)
+	if err != nil {
+		return err
+	}
+	ociAuth, err := pullDockerCredentials(cmd, mirrored)
+	if err != nil {
+		return fmt.Errorf("while creating Docker credentials: %v", err)
+	}
+
+	// descriptors can't be fetched separately from the library, nor from
+	// the other transports, so the full image is pulled
+	dir, err := ioutil.TempDir(tmpDir, "pull-deffile-")
+	if err != nil {
+		return fmt.Errorf("could not create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	pullTo := filepath.Join(dir, "image.sif")
+	if err := pullImage(ctx, imgCache, pullTo, mirrored, ociAuth, opts); err != nil {
+		return err
+	}
+
+	deffile, err := sifedit.Deffile(pullTo)
+	if err == sifedit.ErrNoDeffile {
+		return fmt.Errorf("image %s has no definition file descriptor, it was not built from a definition file", pullFrom)
+	} else if err != nil {
+		return err
+	}
+
+	if deffileTo == "" {
+		_, err := os.Stdout.Write(deffile)
+		return err
+	}
+	writeTo, replaceLink := deffileTo, func() error { return nil }
+	if pull.IsSymlink(deffileTo) {
+		path, replace, cleanup, err := pull.ReplaceSymlink(deffileTo)
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+		writeTo, replaceLink = path, replace
+	}
+	if err := ioutil.WriteFile(writeTo, deffile, 0644); err != nil {
+		return fmt.Errorf("could not write definition file: %v", err)
+	}
+	if err := replaceLink(); err != nil {
+		return err
+	}
+	sylog.Infof("Definition file of %s written to %s", pullFrom, deffileTo)
+	return nil
+}
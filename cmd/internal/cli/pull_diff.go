@@ -0,0 +1,161 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/sylabs/scs-library-client/client"
+	"github.com/sylabs/singularity/docs"
+	"github.com/sylabs/singularity/internal/pkg/cache"
+	"github.com/sylabs/singularity/internal/pkg/client/library"
+	"github.com/sylabs/singularity/internal/pkg/util/sifedit"
+	"github.com/sylabs/singularity/internal/pkg/util/uri"
+	"github.com/sylabs/singularity/pkg/cmdline"
+	"github.com/sylabs/singularity/pkg/sylog"
+)
+
+// pullDiffDeep when true; downloads images whose hashes differ to compare
+// their SIF descriptors.
+var pullDiffDeep bool
+
+// --deep
+var pullDiffDeepFlag = cmdline.Flag{
+	ID:           "pullDiffDeepFlag",
+	Value:        &pullDiffDeep,
+	DefaultValue: false,
+	Name:         "deep",
+	Usage:        "download the images if their hashes differ and report the SIF descriptors which changed",
+	EnvKeys:      []string{"PULL_DIFF_DEEP"},
+}
+
+// pullDiffExitCode is the exit code of 'pull diff' for images which differ.
+const pullDiffExitCode = 1
+
+func init() {
+	addCmdInit(func(cmdManager *cmdline.CommandManager) {
+		cmdManager.RegisterFlagForCmd(&pullDiffDeepFlag, PullDiffCmd)
+	})
+}
+
+// PullDiffCmd is 'singularity pull diff' and compares two library images
+var PullDiffCmd = &cobra.Command{
+	DisableFlagsInUseLine: true,
+	Args:                  cobra.ExactArgs(2),
+	PreRun:                sylabsToken,
+	Run:                   pullDiffRun,
+
+	Use:     docs.PullDiffUse,
+	Short:   docs.PullDiffShort,
+	Long:    docs.PullDiffLong,
+	Example: docs.PullDiffExample,
+}
+
+func pullDiffRun(cmd *cobra.Command, args []string) {
+	ctx := cmd.Context()
+
+	var refs [2]string
+	for i, arg := range args {
+		transport, ref, err := uri.Normalize(arg)
+		if err != nil {
+			sylog.Fatalf("Invalid image reference %s: %v", arg, err)
+		}
+		if transport != LibraryProtocol {
+			sylog.Fatalf("pull diff only compares library images, not %s", arg)
+		}
+		refs[i] = transport + ":" + ref
+	}
+	if err := pullCheckHosts(cmd, refs[:]...); err != nil {
+		sylog.Fatalf("%s", err)
+	}
+
+	scsConfig := pullLibraryConfig()
+
+	var resolved [2]*library.ResolvedRef
+	for i, ref := range refs {
+		r, err := library.Resolve(ctx, scsConfig, ref, pullArch)
+		if err != nil {
+			sylog.Fatalf("While resolving %s: %v", args[i], err)
+		}
+		resolved[i] = r
+	}
+
+	differ := resolved[0].Hash != resolved[1].Hash
+	var changes []sifedit.Change
+	if differ && pullDiffDeep {
+		var err error
+		changes, err = pullDiffImages(ctx, scsConfig, refs)
+		if err != nil {
+			sylog.Fatalf("%s", err)
+		}
+	}
+
+	if err := writePullDiff(os.Stdout, resolved, changes, pullDiffDeep); err != nil {
+		sylog.Fatalf("While writing the comparison: %v", err)
+	}
+	if differ {
+		os.Exit(pullDiffExitCode)
+	}
+}
+
+// pullDiffImages pulls the library images refs through the cache and returns
+// the SIF descriptors of the second one changed from the first one.
+func pullDiffImages(ctx context.Context, scsConfig *client.Config, refs [2]string) ([]sifedit.Change, error) {
+	imgCache := pullCacheHandle(cache.Config{Disable: disableCache})
+	if imgCache == nil {
+		return nil, fmt.Errorf("failed to create an image cache handle")
+	}
+
+	var paths [2]string
+	for i, ref := range refs {
+		path, err := library.Pull(ctx, imgCache, ref, pullArch, tmpDir, scsConfig, pullKeyServer(ref))
+		if err != nil {
+			return nil, fmt.Errorf("while pulling %s: %v", ref, err)
+		}
+		if imgCache.IsDisabled() {
+			// a temporary file without the cache
+			defer os.Remove(path)
+		}
+		paths[i] = path
+	}
+	return sifedit.Diff(paths[0], paths[1])
+}
+
+// writePullDiff writes to w the hashes of the resolved images, whether they
+// differ and, if deep, their changed descriptors.
+func writePullDiff(w io.Writer, resolved [2]*library.ResolvedRef, changes []sifedit.Change, deep bool) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, r := range resolved {
+		fmt.Fprintf(tw, "%s\t%s\n", r.Ref, r.Hash)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	switch {
+	case resolved[0].Hash == resolved[1].Hash:
+		_, err := fmt.Fprintln(w, "Images are identical")
+		return err
+	case !deep:
+		_, err := fmt.Fprintln(w, "Images differ")
+		return err
+	case len(changes) == 0:
+		_, err := fmt.Fprintln(w, "Images differ, their descriptors are identical but for the SIF header")
+		return err
+	}
+
+	fmt.Fprintf(w, "Images differ in %d descriptor(s):\n", len(changes))
+	fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", "CHANGE", "ID", "TYPE", "NAME")
+	for _, c := range changes {
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\n", c.Kind, c.ID, c.Datatype, c.Name)
+	}
+	return tw.Flush()
+}
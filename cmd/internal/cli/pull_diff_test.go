@@ -0,0 +1,53 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/sylabs/singularity/internal/pkg/client/library"
+	"github.com/sylabs/singularity/internal/pkg/util/sifedit"
+)
+
+func TestWritePullDiff(t *testing.T) {
+	a := &library.ResolvedRef{Ref: "library://org/col/img:a", Hash: "sha256.aaa"}
+	b := &library.ResolvedRef{Ref: "library://org/col/img:b", Hash: "sha256.bbb"}
+	changes := []sifedit.Change{{ID: 3, Datatype: "FS", Name: "rootfs", Kind: sifedit.Changed}}
+
+	tests := []struct {
+		name     string
+		resolved [2]*library.ResolvedRef
+		changes  []sifedit.Change
+		deep     bool
+		want     []string
+	}{
+		{name: "Identical", resolved: [2]*library.ResolvedRef{a, a}, deep: true, want: []string{"Images are identical"}},
+		{name: "Differ", resolved: [2]*library.ResolvedRef{a, b}, want: []string{"sha256.aaa", "sha256.bbb", "Images differ"}},
+		{name: "DeepHeaderOnly", resolved: [2]*library.ResolvedRef{a, b}, deep: true, want: []string{"but for the SIF header"}},
+		{
+			name:     "Deep",
+			resolved: [2]*library.ResolvedRef{a, b},
+			changes:  changes,
+			deep:     true,
+			want:     []string{"Images differ in 1 descriptor(s)", "CHANGE   ID  TYPE  NAME", "changed  3   FS    rootfs"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := writePullDiff(&out, tt.resolved, tt.changes, tt.deep); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for _, w := range tt.want {
+				if !strings.Contains(out.String(), w) {
+					t.Errorf("%q not found in output:\n%s", w, out.String())
+				}
+			}
+		})
+	}
+}
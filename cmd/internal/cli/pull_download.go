@@ -0,0 +1,72 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"context"
+	"fmt"
+
+	ocitypes "github.com/containers/image/v5/types"
+	"github.com/sylabs/singularity/internal/pkg/cache"
+	"github.com/sylabs/singularity/pkg/cmdline"
+	"github.com/sylabs/singularity/pkg/pull"
+)
+
+// pullDownloadOnly when true; only downloads the image to the cache,
+// without saving it to a destination.
+var pullDownloadOnly bool
+
+// --download-only
+var pullDownloadOnlyFlag = cmdline.Flag{
+	ID:           "pullDownloadOnlyFlag",
+	Value:        &pullDownloadOnly,
+	DefaultValue: false,
+	Name:         "download-only",
+	Usage:        "only download the image to the cache, verified as when pulled, and print the path of its cache entry",
+	EnvKeys:      []string{"PULL_DOWNLOAD_ONLY"},
+}
+
+// pullCheckDownloadOnly checks that --download-only is used with a writable
+// cache and a single image pulled. The flags changing the pulled image, the
+// cache entry being left as is, are rejected by pull.Pull.
+func pullCheckDownloadOnly(imgCache *cache.Handle) error {
+	if !pullDownloadOnly {
+		return nil
+	}
+
+	switch {
+	case imgCache.IsDisabled():
+		return fmt.Errorf("--download-only can't be used with the cache disabled")
+	case imgCache.IsReadOnly():
+		return fmt.Errorf("--download-only can't be used with --cache-readonly")
+	case pullFromFile != "" || pullFromStdin:
+		return fmt.Errorf("--download-only can't be used with --from-file or --from-stdin")
+	case pullExplain:
+		return fmt.Errorf("--download-only can't be used with --explain")
+	case pullVerifyOnly:
+		return fmt.Errorf("--download-only can't be used with --verify-only")
+	case pullDeffileOnly:
+		return fmt.Errorf("--download-only can't be used with --deffile-only")
+	}
+	return nil
+}
+
+// pullDownload downloads the image pullFrom to the cache with the client
+// matching its transport and returns the path of its cache entry. The
+// entry goes through the checks of a pull to a destination: --scan, the
+// hash of opts, the signatures of library images, --require-signature, the
+// --policy and --verify-fingerprint.
+func pullDownload(ctx context.Context, imgCache *cache.Handle, pullFrom string, ociAuth *ocitypes.DockerAuthConfig, opts pullImageOptions) (string, error) {
+	pullOpts, err := pullOptions(ctx, imgCache, pullFrom, "", ociAuth, opts)
+	if err != nil {
+		return "", err
+	}
+	res, err := pull.Pull(ctx, pullOpts)
+	if err != nil {
+		return "", pullError(pullFrom, err)
+	}
+	return res.Path, nil
+}
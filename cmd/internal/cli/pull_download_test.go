@@ -0,0 +1,103 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/sylabs/singularity/internal/pkg/cache"
+	useragent "github.com/sylabs/singularity/pkg/util/user-agent"
+)
+
+func TestPullDownload(t *testing.T) {
+	useragent.InitValue("singularity", "3.0.0")
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Last-Modified", "Mon, 01 Jun 2020 00:00:00 GMT")
+		fmt.Fprint(w, "image")
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "pull-download-test-")
+	if err != nil {
+		t.Fatalf("could not create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	// the cache is disabled unless the real user can write to it
+	if err := os.Chmod(dir, 0777); err != nil {
+		t.Fatalf("could not change permissions of %s: %v", dir, err)
+	}
+	imgCache, err := cache.New(cache.Config{ParentDir: dir})
+	if err != nil {
+		t.Fatalf("could not create cache: %v", err)
+	}
+
+	defer func(require bool) { pullRequireSignature = require }(pullRequireSignature)
+	pullFrom := srv.URL + "/image.sif"
+	ctx := context.Background()
+
+	path, err := pullDownload(ctx, imgCache, pullFrom, nil, pullImageOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if b, err := ioutil.ReadFile(path); err != nil || string(b) != "image" {
+		t.Errorf("unexpected cache entry %s: %q (%v)", path, b, err)
+	}
+
+	// "image" hash
+	opts := pullImageOptions{sha256: "sha256:6105d6cc76af400325e94d588ce511be5bfdbb73b437dc51eca43917d7a43e3d"}
+	if _, err := pullDownload(ctx, imgCache, pullFrom, nil, opts); err != nil {
+		t.Errorf("unexpected error with the expected hash: %v", err)
+	}
+	opts.sha256 = "sha256:0000000000000000000000000000000000000000000000000000000000000000"
+	if _, err := pullDownload(ctx, imgCache, pullFrom, nil, opts); err == nil {
+		t.Errorf("unexpected success with another expected hash")
+	}
+
+	pullRequireSignature = true
+	if _, err := pullDownload(ctx, imgCache, pullFrom, nil, pullImageOptions{}); err == nil {
+		t.Errorf("unexpected success of an unsigned image with --require-signature")
+	}
+	pullRequireSignature = false
+
+	if _, err := pullDownload(ctx, imgCache, "scp://host:image.sif", nil, pullImageOptions{}); err == nil {
+		t.Errorf("unexpected success for an scp image")
+	}
+}
+
+func TestPullCheckDownloadOnly(t *testing.T) {
+	defer func(d bool, f string, g uint32) {
+		pullDownloadOnly, pullOutputFormat, pullGroup = d, f, g
+	}(pullDownloadOnly, pullOutputFormat, pullGroup)
+
+	disabled, err := cache.New(cache.Config{Disable: true})
+	if err != nil {
+		t.Fatalf("could not create cache: %v", err)
+	}
+
+	pullDownloadOnly, pullOutputFormat, pullGroup = false, formatSandbox, 1
+	if err := pullCheckDownloadOnly(disabled); err != nil {
+		t.Errorf("unexpected error without --download-only: %v", err)
+	}
+	pullDownloadOnly = true
+	if err := pullCheckDownloadOnly(disabled); err == nil {
+		t.Errorf("unexpected success with the cache disabled")
+	}
+
+	readOnly, err := cache.New(cache.Config{ParentDir: os.TempDir(), ReadOnly: true})
+	if err != nil {
+		t.Fatalf("could not create cache: %v", err)
+	}
+	if err := pullCheckDownloadOnly(readOnly); err == nil {
+		t.Errorf("unexpected success with --cache-readonly")
+	}
+}
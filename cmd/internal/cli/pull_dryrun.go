@@ -0,0 +1,118 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	ocitypes "github.com/containers/image/v5/types"
+	"github.com/sylabs/singularity/internal/pkg/cache"
+	"github.com/sylabs/singularity/internal/pkg/util/uri"
+	"github.com/sylabs/singularity/pkg/cmdline"
+)
+
+// pullDryRun when true; lists what would be pulled, and whether it is
+// cached, without downloading nor writing any image.
+var pullDryRun bool
+
+// --dry-run
+var pullDryRunFlag = cmdline.Flag{
+	ID:           "pullDryRunFlag",
+	Value:        &pullDryRun,
+	DefaultValue: false,
+	Name:         "dry-run",
+	Usage:        "resolve the images and list their destinations and cache entries, without downloading them",
+	EnvKeys:      []string{"PULL_DRY_RUN"},
+}
+
+// pullCheckDryRun rejects the flags writing files with --dry-run.
+func pullCheckDryRun() error {
+	if !pullDryRun {
+		return nil
+	}
+	switch {
+	case pullVerifyOnly:
+		return fmt.Errorf("--dry-run can't be used with --verify-only")
+	case pullDownloadOnly:
+		return fmt.Errorf("--dry-run can't be used with --download-only")
+	case pullDeffileOnly:
+		return fmt.Errorf("--dry-run can't be used with --deffile-only")
+	case pullResolvedOut != "":
+		return fmt.Errorf("--dry-run can't be used with --resolved-out")
+	case pullManifestOut != "":
+		return fmt.Errorf("--dry-run can't be used with --manifest-out")
+	case pullAttestationOut != "":
+		return fmt.Errorf("--dry-run can't be used with --attestation-out")
+	}
+	return nil
+}
+
+// pullPlan writes to w what a pull of items would do with --dry-run: the
+// destination of each image and its cache entry, located from the metadata
+// of the image only. An error is returned if any entry couldn't be located
+// or any destination already exists without an --on-conflict strategy.
+func pullPlan(ctx context.Context, w io.Writer, imgCache *cache.Handle, items []pullBatchItem) error {
+	pulled, failed := 0, 0
+	for _, item := range items {
+		arch := item.opts.arch
+		if item.opts.ociArch != "" {
+			arch = item.opts.ociArch
+		} else if arch == "" {
+			arch = pullArch
+		}
+
+		if item.conflict != nil {
+			fmt.Fprintf(w, "fail %s (%s) -> %s, %v\n", redactURI(item.ref), arch, item.pullTo, item.conflict)
+			failed++
+			continue
+		}
+		action := "skip"
+		if !item.skip {
+			action = "pull"
+			pulled++
+		}
+		entry, err := pullPlanEntry(ctx, imgCache, item, arch)
+		if err != nil {
+			entry = fmt.Sprintf("cache entry unknown: %v", err)
+			failed++
+		}
+		fmt.Fprintf(w, "%s %s (%s) -> %s, %s\n", action, redactURI(item.ref), arch, item.pullTo, entry)
+	}
+	fmt.Fprintf(w, "%d of %d images would be pulled\n", pulled, len(items))
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d images would fail to be pulled", failed, len(items))
+	}
+	return nil
+}
+
+// pullPlanEntry describes the cache entry of the image of item for arch.
+func pullPlanEntry(ctx context.Context, imgCache *cache.Handle, item pullBatchItem, arch string) (string, error) {
+	if imgCache.IsDisabled() {
+		return "cache disabled", nil
+	}
+	transport, _ := uri.Split(item.pullFrom)
+	cacheType, hash, err := imageCacheKey(ctx, transport, item.pullFrom, arch, func() (*ocitypes.DockerAuthConfig, error) {
+		return item.ociAuth, nil
+	})
+	if cacheType == "" {
+		return "not cached", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	path, exists, err := imgCache.Lookup(cacheType, hash)
+	if err != nil {
+		return "", err
+	}
+	if exists {
+		return "cached at " + path, nil
+	}
+	return "to be cached at " + path, nil
+}
@@ -0,0 +1,119 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/sylabs/singularity/internal/pkg/cache"
+	"github.com/sylabs/singularity/internal/pkg/client/net"
+	useragent "github.com/sylabs/singularity/pkg/util/user-agent"
+)
+
+func TestPullPlan(t *testing.T) {
+	useragent.InitValue("singularity", "3.0.0")
+
+	var downloads int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodHead {
+			downloads++
+		}
+		w.Header().Set("Last-Modified", "Mon, 01 Jun 2020 00:00:00 GMT")
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "pull-plan-test-")
+	if err != nil {
+		t.Fatalf("could not create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	// the cache is disabled unless the real user can write to it
+	if err := os.Chmod(dir, 0777); err != nil {
+		t.Fatalf("could not change permissions of %s: %v", dir, err)
+	}
+	imgCache, err := cache.New(cache.Config{ParentDir: dir})
+	if err != nil {
+		t.Fatalf("could not create cache: %v", err)
+	}
+	if imgCache.IsDisabled() {
+		t.Skip("cache directory is not writable")
+	}
+
+	ref := srv.URL + "/image.sif"
+	hash, err := net.CacheHash(context.Background(), ref, false)
+	if err != nil {
+		t.Fatalf("could not get cache hash: %v", err)
+	}
+	entry, _, err := imgCache.Lookup(cache.NetCacheType, hash)
+	if err != nil {
+		t.Fatalf("could not look up cache entry: %v", err)
+	}
+
+	item := pullBatchItem{ref: ref, pullFrom: ref, pullTo: "image.sif", opts: pullImageOptions{arch: "amd64"}}
+	tests := []struct {
+		name    string
+		items   []pullBatchItem
+		cached  bool
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:  "Miss",
+			items: []pullBatchItem{item},
+			want:  []string{"pull " + ref + " (amd64) -> image.sif, to be cached at " + entry, "1 of 1 images would be pulled"},
+		},
+		{
+			name:   "Hit",
+			items:  []pullBatchItem{item},
+			cached: true,
+			want:   []string{"pull " + ref + " (amd64) -> image.sif, cached at " + entry, "1 of 1 images would be pulled"},
+		},
+		{
+			name: "SkipAndConflict",
+			items: []pullBatchItem{
+				{ref: ref, pullFrom: ref, pullTo: "skipped.sif", opts: pullImageOptions{arch: "amd64"}, skip: true},
+				{ref: ref, pullFrom: ref, pullTo: "existing.sif", opts: pullImageOptions{arch: "amd64"}, conflict: errors.New("image file already exists")},
+			},
+			want: []string{
+				"skip " + ref + " (amd64) -> skipped.sif, to be cached at " + entry,
+				"fail " + ref + " (amd64) -> existing.sif, image file already exists",
+				"0 of 2 images would be pulled",
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Remove(entry)
+			if tt.cached {
+				if err := ioutil.WriteFile(entry, []byte("image"), 0644); err != nil {
+					t.Fatalf("could not write cache entry: %v", err)
+				}
+			}
+
+			var b bytes.Buffer
+			err := pullPlan(context.Background(), &b, imgCache, tt.items)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if got := strings.Split(strings.TrimSpace(b.String()), "\n"); strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("got plan:\n%s\nwant:\n%s", b.String(), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+
+	if downloads > 0 {
+		t.Errorf("%d images downloaded by a dry run", downloads)
+	}
+}
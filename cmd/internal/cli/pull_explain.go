@@ -0,0 +1,331 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	ocitypes "github.com/containers/image/v5/types"
+	"github.com/spf13/cobra"
+	"github.com/sylabs/singularity/internal/pkg/cache"
+	"github.com/sylabs/singularity/internal/pkg/client/library"
+	"github.com/sylabs/singularity/internal/pkg/client/net"
+	"github.com/sylabs/singularity/internal/pkg/client/oci"
+	"github.com/sylabs/singularity/internal/pkg/client/oras"
+	"github.com/sylabs/singularity/internal/pkg/client/shub"
+	"github.com/sylabs/singularity/internal/pkg/util/uri"
+	buildtypes "github.com/sylabs/singularity/pkg/build/types"
+	"github.com/sylabs/singularity/pkg/cmdline"
+	"github.com/sylabs/singularity/pkg/pull"
+	"github.com/sylabs/singularity/pkg/pull/policy"
+)
+
+// pullExplain when true; narrates the decisions of the pull instead of
+// pulling.
+var pullExplain bool
+
+// --explain
+var pullExplainFlag = cmdline.Flag{
+	ID:           "pullExplainFlag",
+	Value:        &pullExplain,
+	DefaultValue: false,
+	Name:         "explain",
+	Usage:        "explain how the image would be pulled: the parsed URI, the transport, the destination, the cache entry and the verification, without downloading it",
+}
+
+// explainer writes the sections of an explanation.
+type explainer struct {
+	w io.Writer
+}
+
+func (e explainer) section(name string) {
+	fmt.Fprintf(e.w, "%s\n", name)
+}
+
+func (e explainer) item(key, format string, a ...interface{}) {
+	fmt.Fprintf(e.w, "  %-13s %s\n", key+":", fmt.Sprintf(format, a...))
+}
+
+// explainPull writes to w how pullRun would handle args, going through the
+// same decisions but stopping before anything is downloaded. Only the
+// metadata needed to locate the cache entry is requested from the remote.
+func explainPull(ctx context.Context, cmd *cobra.Command, w io.Writer, imgCache *cache.Handle, args []string) {
+	e := explainer{w: w}
+	pullFrom := args[len(args)-1]
+	transport, ref := uri.Split(pullFrom)
+
+	e.section("Reference")
+	e.item("argument", "%s", pullFrom)
+	if ref == "" {
+		e.item("uri.Split", "no reference after the transport %q, the pull would fail with a bad URI error", transport)
+		return
+	}
+	e.item("uri.Split", "transport %q, reference %q", transport, ref)
+
+	e.section("Transport")
+	e.item("transport", "%s, %s", transportName(transport), explainTransport(transport))
+
+	if transport == LibraryProtocol || transport == "" {
+		handlePullFlags(cmd)
+		e.item("library", "%s, architecture %s", pullLibraryURI, pullArch)
+		err := library.CheckRef(ctx, pullLibraryConfig(), pullFrom, pullArch)
+		if ambiguous, ok := err.(*library.AmbiguousRefError); ok {
+			choices := make([]string, 0, len(ambiguous.Choices))
+			for _, c := range ambiguous.Choices {
+				choices = append(choices, c.String())
+			}
+			e.item("resolution", "%s is not available for %s, the user would be asked to choose between: %s", ambiguous.Ref, ambiguous.Arch, strings.Join(choices, ", "))
+		} else if err != nil {
+			e.item("resolution", "the library could not resolve the image, the pull would fail: %v", err)
+		} else {
+			e.item("resolution", "available in the library")
+		}
+	}
+
+	e.section("Host")
+	mirrored, err := pullMirrorRef(pullFrom)
+	switch {
+	case err != nil:
+		e.item("mirror", "the registry mirror could not be applied, the pull would fail: %v", err)
+		mirrored = pullFrom
+	case mirrored != pullFrom:
+		e.item("mirror", "rewritten to %s by the registry mirror", mirrored)
+	default:
+		e.item("mirror", "not rewritten")
+	}
+	if host, err := pullHost(mirrored); err != nil {
+		e.item("host", "could not be determined: %v", err)
+	} else if host == "" {
+		e.item("host", "none, the image is read locally")
+	} else {
+		e.item("host", "%s", host)
+	}
+	if err := pullCheckHost(pullFrom); err != nil {
+		e.item("allowed", "no, the pull would fail: %v", err)
+	} else {
+		e.item("allowed", "yes")
+	}
+
+	e.section("Destination")
+	pullTo := pullImageName
+	switch {
+	case pullTo != "":
+		e.item("name", "%s, from --name", pullTo)
+	case len(args) == 2:
+		pullTo = args[0]
+		e.item("name", "%s, as given", pullTo)
+	default:
+		pullTo = pullDefaultName(transport, pullFrom, pullNameArch(cmd))
+		e.item("name", "%s, computed by uri.GetName as no destination was given", pullTo)
+	}
+	if pullDir != "" {
+		pullTo = filepath.Join(pullDir, pullTo)
+		e.item("directory", "%s, from --dir", pullDir)
+	} else if pullTmpfs && len(args) == 1 && pullImageName == "" {
+		e.item("directory", "the tmpfs, as --tmpfs is set")
+	}
+	if abs, err := filepath.Abs(pullTo); err == nil {
+		e.item("path", "%s", abs)
+	}
+	_, statErr := os.Stat(pullTo)
+	resolved, _, _ := pullResolveConflict(pullTo, nil)
+	switch {
+	case os.IsNotExist(statErr):
+		e.item("existing", "no")
+	case pullOnConflict == conflictOverwrite:
+		e.item("existing", "yes, overwritten as --force or --on-conflict overwrite is set")
+	case pullOnConflict == conflictRename:
+		e.item("existing", "yes, the image would be pulled to %s as --on-conflict rename is set", resolved)
+	case pullOnConflict == conflictSkip:
+		e.item("existing", "yes, the pull would be skipped as --on-conflict skip is set")
+	default:
+		e.item("existing", "yes, the pull would fail without --force or another --on-conflict strategy")
+	}
+
+	e.section("Cache")
+	explainCache(ctx, cmd, e, imgCache, transport, mirrored)
+
+	e.section("Verification")
+	explainVerification(e, transport, pullFrom)
+
+	e.section("Action")
+	e.item("result", "nothing was downloaded, run the command without --explain to pull")
+}
+
+// transportName returns the name of transport, the default one if empty.
+func transportName(transport string) string {
+	if transport == "" {
+		return LibraryProtocol
+	}
+	return transport
+}
+
+// explainTransport returns why transport is handled the way it is.
+func explainTransport(transport string) string {
+	switch transport {
+	case "":
+		return "no transport given, images without transport are pulled from the library"
+	case LibraryProtocol:
+		return "SIF image downloaded from a Sylabs Cloud library"
+	case ShubProtocol:
+		return "image downloaded from Singularity Hub"
+	case OrasProtocol:
+		return "SIF image downloaded from an OCI registry supporting ORAS"
+	case HTTPProtocol, HTTPSProtocol:
+		if pullNoDecompress {
+			return "image downloaded from the URL, kept compressed as --no-decompress is set"
+		}
+		return "image downloaded from the URL, decompressed on the fly if gzip compressed"
+	case ScpProtocol:
+		return "image copied over SSH with the scp program of the host"
+	case oci.IsSupported(transport):
+		return "OCI image read through containers/image, its layers are converted to a SIF image"
+	}
+	return "not a supported transport, the pull would fail (see --list-transports)"
+}
+
+// explainCache locates the cache entry of pullFrom, the only remote request
+// being for its metadata.
+func explainCache(ctx context.Context, cmd *cobra.Command, e explainer, imgCache *cache.Handle, transport, pullFrom string) {
+	if imgCache.IsDisabled() {
+		if pullTmpfs {
+			e.item("cache", "disabled by --tmpfs, the image would be downloaded directly to its destination")
+		} else {
+			e.item("cache", "disabled by --disable-cache, the image would be downloaded directly to its destination")
+		}
+		return
+	}
+
+	cacheType, hash, err := pullCacheKey(ctx, cmd, transport, pullFrom)
+	switch {
+	case cacheType == "" && transport == ScpProtocol:
+		e.item("cache", "not used, scp images are copied directly to their destination")
+		return
+	case cacheType == "":
+		e.item("cache", "not used")
+		return
+	case err != nil:
+		e.item("cache", "the %s cache entry could not be located, the pull would fail: %v", cacheType, err)
+		return
+	}
+
+	path, exists, err := imgCache.Lookup(cacheType, hash)
+	if err != nil {
+		e.item("cache", "the %s cache entry could not be checked: %v", cacheType, err)
+		return
+	}
+	e.item("entry", "%s", path)
+	if exists {
+		e.item("cache", "hit, the image would be copied from the cache to its destination")
+	} else {
+		e.item("cache", "miss, the image would be downloaded into the cache, then copied to its destination")
+	}
+}
+
+// pullCacheKey returns the cache type and the hash the image pullFrom is
+// cached with by a pull, the only remote request being for its metadata.
+// The cache type is empty for the transports whose images aren't cached.
+func pullCacheKey(ctx context.Context, cmd *cobra.Command, transport, pullFrom string) (cacheType, hash string, err error) {
+	return imageCacheKey(ctx, transport, pullFrom, pullArch, func() (*ocitypes.DockerAuthConfig, error) {
+		return explainDockerCredentials(cmd, pullFrom)
+	})
+}
+
+// imageCacheKey is pullCacheKey for the image pullFrom for arch, the docker
+// credentials of OCI and ORAS images being returned by ociAuth.
+func imageCacheKey(ctx context.Context, transport, pullFrom, arch string, ociAuth func() (*ocitypes.DockerAuthConfig, error)) (cacheType, hash string, err error) {
+	switch transport {
+	case LibraryProtocol, "":
+		cacheType = cache.LibraryCacheType
+		hash, err = library.CacheHash(ctx, pullFrom, arch, pullLibraryConfig())
+	case ShubProtocol:
+		cacheType = cache.ShubCacheType
+		hash, err = shub.CacheHash(ctx, pullFrom, noHTTPS)
+	case OrasProtocol:
+		cacheType = cache.OrasCacheType
+		var auth *ocitypes.DockerAuthConfig
+		if auth, err = ociAuth(); err == nil {
+			hash, err = oras.ImageSHA(ctx, pullFrom, auth, noHTTPS)
+		}
+	case HTTPProtocol, HTTPSProtocol:
+		cacheType = cache.NetCacheType
+		hash, err = net.CacheHash(ctx, pullFrom, pullNoDecompress)
+	case oci.IsSupported(transport):
+		cacheType = cache.OciTempCacheType
+		var auth *ocitypes.DockerAuthConfig
+		if auth, err = ociAuth(); err == nil {
+			hash, err = oci.CacheHash(ctx, pullFrom, buildtypes.Options{
+				NoHTTPS:          noHTTPS,
+				DockerAuthConfig: auth,
+				NoSetuid:         pullNoSetuid,
+				Reproducible:     pullReproducible,
+				Squash:           pullSquash,
+			})
+		}
+	}
+	return cacheType, hash, err
+}
+
+// explainDockerCredentials returns the docker credentials of pullFrom,
+// without prompting for them.
+func explainDockerCredentials(cmd *cobra.Command, pullFrom string) (*ocitypes.DockerAuthConfig, error) {
+	if dockerLogin {
+		return nil, fmt.Errorf("--docker-login would prompt for credentials")
+	}
+	return pullDockerCredentials(cmd, pullFrom)
+}
+
+// explainVerification lists the checks the image pullFrom would go through
+// once pulled.
+func explainVerification(e explainer, transport, pullFrom string) {
+	switch {
+	case pullRequireSignature:
+		e.item("signatures", "verified against %s, the pull fails unless verified as --require-signature is set", pullKeyServer(pullFrom))
+	case pull.VerifiedByDefault(transport):
+		e.item("signatures", "verified against %s, unsigned images only produce a warning", pullKeyServer(pullFrom))
+	default:
+		e.item("signatures", "not verified by default for %s images, unless required below", transportName(transport))
+	}
+
+	switch r := pullPolicyRule(pullFrom); {
+	case pullTrustPolicy == nil:
+		e.item("policy", "none, no --policy given")
+	case r == nil:
+		e.item("policy", "no rule of %s matches", pullPolicyFile)
+	case !r.Verify:
+		e.item("policy", "rule %q does not require verification", r.Prefix)
+	case len(r.Keys) == 0:
+		e.item("policy", "rule %q requires a verified signature by any key", r.Prefix)
+	default:
+		e.item("policy", "rule %q requires a verified signature by one of %s", r.Prefix, strings.Join(r.Keys, ", "))
+	}
+
+	if pullLocalKeyring != "" {
+		e.item("keyring", "signer keys are searched in %s first, from --local-keyring", pullLocalKeyring)
+	}
+	if len(pullFingerprints) > 0 {
+		e.item("signer", "must be one of %s, from --verify-fingerprint", strings.Join(pullFingerprints, ", "))
+	}
+	if pullChecksum != "" {
+		// already validated by pullRun
+		hash, _ := parseSHA256(pullChecksum)
+		e.item("checksum", "the image is removed unless its hash is %s", hash)
+	}
+}
+
+// pullPolicyRule returns the rule of the --policy applying to pullFrom, if
+// any.
+func pullPolicyRule(pullFrom string) *policy.Rule {
+	if pullTrustPolicy == nil {
+		return nil
+	}
+	return pullTrustPolicy.Match(pullFrom)
+}
@@ -0,0 +1,93 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sylabs/singularity/internal/pkg/cache"
+	"github.com/sylabs/singularity/internal/pkg/client/net"
+	useragent "github.com/sylabs/singularity/pkg/util/user-agent"
+)
+
+func TestExplainPull(t *testing.T) {
+	useragent.InitValue("singularity", "3.0.0")
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Last-Modified", "Mon, 01 Jun 2020 00:00:00 GMT")
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "explain-test-")
+	if err != nil {
+		t.Fatalf("could not create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	// the cache is disabled unless the real user can write to it
+	if err := os.Chmod(dir, 0777); err != nil {
+		t.Fatalf("could not change permissions of %s: %v", dir, err)
+	}
+
+	imgCache, err := cache.New(cache.Config{ParentDir: dir})
+	if err != nil {
+		t.Fatalf("could not create cache: %v", err)
+	}
+
+	explain := func(args ...string) string {
+		var b bytes.Buffer
+		explainPull(context.Background(), PullCmd, &b, imgCache, args)
+		return b.String()
+	}
+	expect := func(out string, expected ...string) {
+		for _, e := range expected {
+			if !strings.Contains(out, e) {
+				t.Errorf("explanation does not contain %q:\n%s", e, out)
+			}
+		}
+	}
+
+	pullFrom := srv.URL + "/image.sif.gz"
+	out := explain(pullFrom)
+	expect(out,
+		`transport "http", reference "//`+strings.TrimPrefix(srv.URL, "http://")+`/image.sif.gz"`,
+		"image.sif, computed by uri.GetName",
+		"miss, the image would be downloaded",
+		"nothing was downloaded",
+	)
+
+	// the entry of the image in the cache turns the miss into a hit
+	hash, err := net.CacheHash(context.Background(), pullFrom, false)
+	if err != nil {
+		t.Fatalf("could not compute cache hash: %v", err)
+	}
+	path, exists, err := imgCache.Lookup(cache.NetCacheType, hash)
+	if err != nil || exists {
+		t.Fatalf("unexpected cache entry %s (exists %v): %v", path, exists, err)
+	}
+	if err := ioutil.WriteFile(path, []byte("image"), 0644); err != nil {
+		t.Fatalf("could not write cache entry: %v", err)
+	}
+	expect(explain("out.sif", pullFrom), "out.sif, as given", "hit, the image would be copied from the cache")
+
+	if _, err := os.Stat(filepath.Join(dir, "image.sif")); !os.IsNotExist(err) {
+		t.Errorf("image unexpectedly pulled")
+	}
+
+	expect(explain("scp://user@host:images/alpine.sif"),
+		"alpine.sif, computed by uri.GetName",
+		"host:         host",
+		"not used, scp images are copied directly",
+	)
+	expect(explain("foo://bar"), "not a supported transport")
+}
@@ -0,0 +1,58 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sylabs/singularity/pkg/cmdline"
+	"github.com/sylabs/singularity/pkg/pull"
+)
+
+// The --output-format formats, in which the pulled image is saved.
+const (
+	formatSIF     = pull.FormatSIF
+	formatSandbox = pull.FormatSandbox
+	formatTar     = pull.FormatTar
+)
+
+var outputFormats = []string{formatSIF, formatSandbox, formatTar}
+
+// pullOutputFormat is the format the pulled image is saved in.
+var pullOutputFormat string
+
+// --output-format
+var pullOutputFormatFlag = cmdline.Flag{
+	ID:           "pullOutputFormatFlag",
+	Value:        &pullOutputFormat,
+	DefaultValue: formatSIF,
+	Name:         "output-format",
+	Usage:        "format the image is saved in: sif, sandbox (a directory holding the root filesystem) or tar (a tarball of the root filesystem)",
+	EnvKeys:      []string{"PULL_OUTPUT_FORMAT"},
+}
+
+// pullCheckOutputFormat checks --output-format.
+func pullCheckOutputFormat() error {
+	for _, f := range outputFormats {
+		if f == pullOutputFormat {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid --output-format %q, must be one of %s", pullOutputFormat, strings.Join(outputFormats, ", "))
+}
+
+// formatName returns the default image name name, computed for a SIF
+// image, adjusted to the --output-format.
+func formatName(name string) string {
+	switch pullOutputFormat {
+	case formatSandbox:
+		return strings.TrimSuffix(name, ".sif")
+	case formatTar:
+		return strings.TrimSuffix(name, ".sif") + ".tar"
+	}
+	return name
+}
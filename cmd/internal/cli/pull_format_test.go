@@ -0,0 +1,40 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import "testing"
+
+func TestFormatName(t *testing.T) {
+	defer func(f string) { pullOutputFormat = f }(pullOutputFormat)
+
+	tests := []struct {
+		format  string
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{format: formatSIF, name: "alpine_latest.sif", want: "alpine_latest.sif"},
+		{format: formatSandbox, name: "alpine_latest.sif", want: "alpine_latest"},
+		{format: formatSandbox, name: "image.img", want: "image.img"},
+		{format: formatTar, name: "alpine_latest.sif", want: "alpine_latest.tar"},
+		{format: formatTar, name: "image", want: "image.tar"},
+		{format: "squashfs", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		pullOutputFormat = tt.format
+		err := pullCheckOutputFormat()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("unexpected error for --output-format %s: %v", tt.format, err)
+		}
+		if err != nil {
+			continue
+		}
+		if got := formatName(tt.name); got != tt.want {
+			t.Errorf("got name %q for %s with --output-format %s, want %q", got, tt.name, tt.format, tt.want)
+		}
+	}
+}
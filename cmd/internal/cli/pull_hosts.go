@@ -0,0 +1,149 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/spf13/cobra"
+	"github.com/sylabs/singularity/internal/pkg/client/scp"
+	"github.com/sylabs/singularity/internal/pkg/client/shub"
+	"github.com/sylabs/singularity/internal/pkg/util/uri"
+	"github.com/sylabs/singularity/pkg/util/singularityconf"
+)
+
+// pullHost returns the host pullFrom is pulled from, or an empty string for
+// the transports reading local images such as docker-daemon or oci-archive.
+func pullHost(pullFrom string) (string, error) {
+	transport, ref := uri.Split(pullFrom)
+
+	switch transport {
+	case LibraryProtocol, "":
+		if host, _ := uri.SplitLibraryHost(pullFrom); host != "" {
+			return strings.ToLower(host), nil
+		}
+		u, err := url.Parse(pullLibraryURI)
+		if err != nil {
+			return "", fmt.Errorf("invalid library URL %s: %v", pullLibraryURI, err)
+		}
+		return u.Host, nil
+	case ShubProtocol:
+		shubURI, err := shub.ParseReference(pullFrom)
+		if err != nil {
+			return "", err
+		}
+		return shubURI.Host(), nil
+	case HTTPProtocol, HTTPSProtocol:
+		u, err := url.Parse(pullFrom)
+		if err != nil {
+			return "", err
+		}
+		return u.Host, nil
+	case ScpProtocol:
+		r, err := scp.ParseReference(pullFrom)
+		if err != nil {
+			return "", err
+		}
+		if r.Port != "22" {
+			return r.Addr(), nil
+		}
+		return r.Host, nil
+	case OrasProtocol, "docker":
+		named, err := reference.ParseNormalizedNamed(strings.TrimPrefix(ref, "//"))
+		if err != nil {
+			return "", fmt.Errorf("invalid reference %s: %v", pullFrom, err)
+		}
+		return reference.Domain(named), nil
+	}
+	return "", nil
+}
+
+// hostAllowed returns true if host matches one of the allowed patterns. A
+// pattern is a host name, or IP address, optionally with a port, or a
+// domain prefixed with '*.' matching any of its sub-domains. A pattern
+// without port matches any port.
+func hostAllowed(host string, allowed []string) bool {
+	hostname := host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		hostname = h
+	}
+	hostname = strings.ToLower(hostname)
+
+	for _, pattern := range allowed {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		name := hostname
+		if _, _, err := net.SplitHostPort(pattern); err == nil {
+			name = strings.ToLower(host)
+		}
+
+		if strings.HasPrefix(pattern, "*.") {
+			if strings.HasSuffix(name, pattern[1:]) {
+				return true
+			}
+		} else if name == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// pullCheckHost returns an error if the host pullFrom, after the registry
+// mirror rewriting, is pulled from isn't allowed by singularity.conf or by
+// --allowed-host. When both are set the host must be allowed by both, so
+// the flag can only restrict the site configuration.
+func pullCheckHost(pullFrom string) error {
+	var confAllowed []string
+	if cfg := singularityconf.GetCurrentConfig(); cfg != nil {
+		confAllowed = cfg.AllowedPullHosts
+	}
+	if len(confAllowed) == 0 && len(pullAllowedHosts) == 0 {
+		return nil
+	}
+
+	ref, err := pullMirrorRef(pullFrom)
+	if err != nil {
+		return err
+	}
+	host, err := pullHost(ref)
+	if err != nil {
+		return err
+	}
+	if host == "" {
+		return nil
+	}
+
+	if len(confAllowed) > 0 && !hostAllowed(host, confAllowed) {
+		return fmt.Errorf("pulling from %s is not allowed by the configuration, allowed hosts: %s", host, strings.Join(confAllowed, ", "))
+	}
+	if len(pullAllowedHosts) > 0 && !hostAllowed(host, pullAllowedHosts) {
+		return fmt.Errorf("pulling from %s is not allowed by --allowed-host, allowed hosts: %s", host, strings.Join(pullAllowedHosts, ", "))
+	}
+	return nil
+}
+
+// pullCheckHosts returns an error if the host any of the images pullFrom is
+// pulled from isn't allowed, see pullCheckHost. The remote endpoint is
+// resolved first with handlePullFlags when one of them is a library image,
+// the library images being pulled from the library of the endpoint rather
+// than the default one.
+func pullCheckHosts(cmd *cobra.Command, pullFrom ...string) error {
+	for _, p := range pullFrom {
+		if transport, _ := uri.Split(p); transport == LibraryProtocol || transport == "" {
+			handlePullFlags(cmd)
+			break
+		}
+	}
+	for _, p := range pullFrom {
+		if err := pullCheckHost(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	useragent "github.com/sylabs/singularity/pkg/util/user-agent"
+)
+
+func TestPullHost(t *testing.T) {
+	defer func(uri string) { pullLibraryURI = uri }(pullLibraryURI)
+	pullLibraryURI = "https://library.sylabs.io"
+
+	tests := []struct {
+		pullFrom string
+		expected string
+	}{
+		{"library://alpine", "library.sylabs.io"},
+		{"alpine", "library.sylabs.io"},
+		{"library://Library.Example.com/user/collection/image", "library.example.com"},
+		{"shub://vsoch/singularity-images", "singularity-hub.org"},
+		{"shub://shub.example.com/user/image", "shub.example.com"},
+		{"https://example.com:8443/image.sif", "example.com:8443"},
+		{"docker://ubuntu", "docker.io"},
+		{"docker://quay.io/user/image:tag", "quay.io"},
+		{"oras://localhost:5000/image:tag", "localhost:5000"},
+		{"scp://user@hpc.example.com:/data/image.sif", "hpc.example.com"},
+		{"scp://hpc.example.com:2222:image.sif", "hpc.example.com:2222"},
+		{"docker-archive:/tmp/image.tar", ""},
+	}
+
+	for _, tt := range tests {
+		host, err := pullHost(tt.pullFrom)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.pullFrom, err)
+		} else if host != tt.expected {
+			t.Errorf("%s: expected host %q, got %q", tt.pullFrom, tt.expected, host)
+		}
+	}
+}
+
+func TestHostAllowed(t *testing.T) {
+	allowed := []string{"library.sylabs.io", "*.example.com", "10.0.0.1:5000"}
+
+	tests := []struct {
+		host     string
+		expected bool
+	}{
+		{"library.sylabs.io", true},
+		{"LIBRARY.sylabs.io:443", true},
+		{"registry.example.com", true},
+		{"a.b.example.com:5000", true},
+		{"example.com", false},
+		{"badexample.com", false},
+		{"10.0.0.1:5000", true},
+		{"10.0.0.1:5001", false},
+		{"10.0.0.1", false},
+		{"docker.io", false},
+	}
+
+	for _, tt := range tests {
+		if got := hostAllowed(tt.host, allowed); got != tt.expected {
+			t.Errorf("%s: expected %v, got %v", tt.host, tt.expected, got)
+		}
+	}
+}
+
+func TestPullCheckHostsEndpoint(t *testing.T) {
+	useragent.InitValue("singularity", "3.0.0")
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/assets/config/config.prod.json" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"libraryAPI": {"uri": "https://library.example.com"}, "keystoreAPI": {"uri": "https://keys.example.com"}}`))
+	}))
+	defer srv.Close()
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "pull-hosts-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	conf := filepath.Join(dir, "remote.yaml")
+	if err := ioutil.WriteFile(conf, []byte("Active: test\nRemotes:\n  test:\n    URI: "+u.Host+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(transport http.RoundTripper) { http.DefaultTransport = transport }(http.DefaultTransport)
+	http.DefaultTransport = srv.Client().Transport
+	defer func(conf, sys, library, keys, token string, allowed []string) {
+		remoteConfig, remoteConfigSys, pullLibraryURI, keyServerURL, authToken, pullAllowedHosts = conf, sys, library, keys, token, allowed
+	}(remoteConfig, remoteConfigSys, pullLibraryURI, keyServerURL, authToken, pullAllowedHosts)
+	remoteConfig = conf
+	remoteConfigSys = filepath.Join(dir, "none.yaml")
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("library", "", "")
+
+	// the default library is allowed, not the one of the endpoint the
+	// image is pulled from
+	pullLibraryURI = "https://library.sylabs.io"
+	pullAllowedHosts = []string{"library.sylabs.io"}
+	err = pullCheckHosts(cmd, "library://user/collection/image")
+	if err == nil || !strings.Contains(err.Error(), "library.example.com") {
+		t.Errorf("unexpected error %v, expected library.example.com to be refused", err)
+	}
+	if pullLibraryURI != "https://library.example.com" {
+		t.Errorf("unexpected library %s, expected the one of the endpoint", pullLibraryURI)
+	}
+
+	pullLibraryURI = "https://library.sylabs.io"
+	pullAllowedHosts = []string{"library.example.com"}
+	if err := pullCheckHosts(cmd, "docker://library.sylabs.io/image", "library://user/collection/image"); err == nil {
+		t.Errorf("unexpected success pulling from library.sylabs.io")
+	}
+	if err := pullCheckHosts(cmd, "library://user/collection/image"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/sylabs/singularity/internal/pkg/util/machine"
+	"github.com/sylabs/singularity/internal/pkg/util/uri"
+	"github.com/sylabs/singularity/pkg/pull/policy"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// pullList is the structured form of an image list, in YAML or JSON format:
+//
+//	images:
+//	  - uri: library://alpine:3.11
+//	    name: alpine.sif
+//	    arch: arm64
+//	    sha256: 7f0d...
+//	    signFingerprint: 8883491F4268F173C6E5DC49446946928C851A55
+type pullList struct {
+	Images []pullListImage `yaml:"images"`
+}
+
+// pullListImage is an image of a list, only the URI is set for the plain
+// line format.
+type pullListImage struct {
+	// URI is the image to pull.
+	URI string `yaml:"uri"`
+	// Name is the file name of the image in the destination directory.
+	Name string `yaml:"name,omitempty"`
+	// Arch is the architecture of the library image to pull.
+	Arch string `yaml:"arch,omitempty"`
+	// SHA256 is the expected hash of the pulled image.
+	SHA256 string `yaml:"sha256,omitempty"`
+	// SignFingerprint is the fingerprint of the key that must have signed
+	// the image.
+	SignFingerprint string `yaml:"signFingerprint,omitempty"`
+}
+
+// isPullList returns whether the image list named name with content b is in
+// the structured format, from its extension or its content if it has none.
+func isPullList(name string, b []byte) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".yaml", ".yml", ".json":
+		return true
+	case "":
+		b = bytes.TrimSpace(b)
+		return bytes.HasPrefix(b, []byte("{")) || bytes.HasPrefix(b, []byte("images:"))
+	}
+	return false
+}
+
+// parsePullList parses and validates the structured image list b. All the
+// invalid images are reported at once, before anything is pulled.
+func parsePullList(b []byte) ([]pullListImage, error) {
+	var l pullList
+	// JSON being a subset of YAML, both are decoded the same way
+	if err := yaml.UnmarshalStrict(b, &l); err != nil {
+		return nil, err
+	}
+
+	var errs []string
+	names := make(map[string]int)
+	for i := range l.Images {
+		img := &l.Images[i]
+		for _, err := range validatePullListImage(img) {
+			errs = append(errs, fmt.Sprintf("image %d: %s", i+1, err))
+		}
+		if img.Name == "" {
+			continue
+		}
+		if other, ok := names[img.Name]; ok {
+			errs = append(errs, fmt.Sprintf("image %d: name %q is already used by image %d", i+1, img.Name, other))
+		} else {
+			names[img.Name] = i + 1
+		}
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("%d error(s):\n  %s", len(errs), strings.Join(errs, "\n  "))
+	}
+	return l.Images, nil
+}
+
+// validatePullListImage returns the errors of the image img, with its
+// hash and fingerprint normalized.
+func validatePullListImage(img *pullListImage) []string {
+	var errs []string
+
+	transport, ref := uri.Split(img.URI)
+	if img.URI == "" {
+		errs = append(errs, "uri is required")
+	} else if ref == "" {
+		errs = append(errs, fmt.Sprintf("bad URI %s", img.URI))
+	}
+
+	if img.Name != "" && (strings.ContainsRune(img.Name, filepath.Separator) || img.Name == "." || img.Name == "..") {
+		errs = append(errs, fmt.Sprintf("name %q must be a file name", img.Name))
+	}
+
+	if img.Arch != "" {
+		if transport != LibraryProtocol && transport != "" {
+			errs = append(errs, "arch is only supported for library images")
+		} else if !pullAllowUnknownArch {
+			if err := machine.CheckArch(img.Arch); err != nil {
+				errs = append(errs, fmt.Sprintf("invalid arch: %v", err))
+			}
+		}
+	}
+
+	if img.SHA256 != "" {
+		h, err := parseSHA256(img.SHA256)
+		if err != nil {
+			errs = append(errs, err.Error())
+		}
+		img.SHA256 = h
+	}
+
+	if img.SignFingerprint != "" {
+		fps, err := policy.ParseFingerprints([]string{img.SignFingerprint})
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("invalid signFingerprint: %v", err))
+		} else {
+			img.SignFingerprint = fps[0]
+		}
+	}
+
+	return errs
+}
+
+// parseSHA256 returns the sha256 hash s, with or without the sha256: prefix,
+// in the sha256:<hex> form used for the pulled images.
+func parseSHA256(s string) (string, error) {
+	h := strings.ToLower(strings.TrimPrefix(s, "sha256:"))
+	if _, err := hex.DecodeString(h); err != nil || len(h) != 64 {
+		return "", fmt.Errorf("sha256 %q is not a sha256 hash", s)
+	}
+	return "sha256:" + h, nil
+}
@@ -0,0 +1,119 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParsePullList(t *testing.T) {
+	const hash = "7f0d4c5cfb1e9f6a06a5a1d6b8e5b26a4c1e1f4fd0cd24e1a1ce2d0b3f0cbe33"
+	const fp = "8883491F4268F173C6E5DC49446946928C851A55"
+
+	tests := []struct {
+		name     string
+		list     string
+		expected []pullListImage
+		errs     []string
+	}{
+		{
+			name: "YAML",
+			list: `images:
+  - uri: library://alpine:3.11
+    name: alpine.sif
+    arch: arm64
+    sha256: ` + strings.ToUpper(hash) + `
+    signFingerprint: 0x` + fp + `
+  - uri: docker://busybox
+`,
+			expected: []pullListImage{
+				{URI: "library://alpine:3.11", Name: "alpine.sif", Arch: "arm64", SHA256: "sha256:" + hash, SignFingerprint: fp},
+				{URI: "docker://busybox"},
+			},
+		},
+		{
+			name: "JSON",
+			list: `{"images": [{"uri": "docker://busybox", "sha256": "sha256:` + hash + `"}]}`,
+			expected: []pullListImage{
+				{URI: "docker://busybox", SHA256: "sha256:" + hash},
+			},
+		},
+		{
+			name: "AllErrors",
+			list: `images:
+  - name: a.sif
+  - uri: docker://busybox
+    name: ../a.sif
+    arch: arm64
+  - uri: library://alpine
+    name: a.sif
+    sha256: 0123
+    signFingerprint: 0123
+`,
+			errs: []string{
+				"6 error(s)",
+				"image 1: uri is required",
+				"image 2: name \"../a.sif\" must be a file name",
+				"image 2: arch is only supported for library images",
+				"image 3: sha256 \"0123\" is not a sha256 hash",
+				"image 3: invalid signFingerprint",
+				"image 3: name \"a.sif\" is already used by image 1",
+			},
+		},
+		{
+			name: "UnknownField",
+			list: "images:\n  - uri: docker://busybox\n    tag: latest\n",
+			errs: []string{"field tag not found"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			images, err := parsePullList([]byte(tt.list))
+			if tt.errs == nil {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if !reflect.DeepEqual(images, tt.expected) {
+					t.Fatalf("unexpected images %+v, expected %+v", images, tt.expected)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("unexpected success: %+v", images)
+			}
+			for _, e := range tt.errs {
+				if !strings.Contains(err.Error(), e) {
+					t.Errorf("error %q does not report %q", err, e)
+				}
+			}
+		})
+	}
+}
+
+func TestIsPullList(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected bool
+	}{
+		{"images.yaml", "", true},
+		{"images.JSON", "", true},
+		{"images.txt", "images:", false},
+		{"images", "library://alpine\n", false},
+		{"images", pullManifestHeader + "\nlibrary://alpine\n", false},
+		{"stdin", "\n  images:\n  - uri: library://alpine\n", true},
+		{"stdin", `{"images": []}`, true},
+	}
+
+	for _, tt := range tests {
+		if got := isPullList(tt.name, []byte(tt.content)); got != tt.expected {
+			t.Errorf("isPullList(%q, %q) = %v, expected %v", tt.name, tt.content, got, tt.expected)
+		}
+	}
+}
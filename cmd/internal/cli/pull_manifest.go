@@ -0,0 +1,84 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// pullManifestHeader is the first line of a --manifest-out file, it must be
+// changed along with the format.
+const pullManifestHeader = "# singularity pull manifest v1"
+
+// pullManifestEntry is an image of a batch pull recorded in the manifest.
+type pullManifestEntry struct {
+	ref  string
+	path string
+	hash string
+	err  error
+}
+
+// writePullManifest writes the entries of a batch pull to the file at path.
+// The file is replaced atomically so that a previous manifest is never left
+// half written.
+func writePullManifest(path string, entries []pullManifestEntry) error {
+	var b bytes.Buffer
+	if err := formatPullManifest(&b, entries); err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".")
+	if err != nil {
+		return fmt.Errorf("could not create manifest: %v", err)
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(b.Bytes()); err != nil {
+		f.Close()
+		return fmt.Errorf("could not write manifest: %v", err)
+	}
+	if err := f.Chmod(0644); err != nil {
+		f.Close()
+		return fmt.Errorf("could not write manifest: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("could not write manifest: %v", err)
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// formatPullManifest writes entries to w, one pulled image per line made of the
+// URI, the path and the sha256 hash of the image separated by tabs. Failed
+// images are listed as comments and a summary line ends the manifest. As
+// comments are ignored and only the first field of a line is read, the
+// manifest can be passed back to --from-file.
+func formatPullManifest(w io.Writer, entries []pullManifestEntry) error {
+	if _, err := fmt.Fprintln(w, pullManifestHeader); err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, e := range entries {
+		var err error
+		if e.err != nil {
+			failed++
+			_, err = fmt.Fprintf(w, "# failed: %s\t%s\t%s\n", e.ref, e.path, e.err)
+		} else {
+			_, err = fmt.Fprintf(w, "%s\t%s\t%s\n", e.ref, e.path, e.hash)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := fmt.Fprintf(w, "# %d of %d images pulled, %d failed\n", len(entries)-failed, len(entries), failed)
+	return err
+}
@@ -0,0 +1,43 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestFormatPullManifest(t *testing.T) {
+	entries := []pullManifestEntry{
+		{ref: "library://alpine:3.11", path: "alpine_3.11.sif", hash: "sha256:0123"},
+		{ref: "docker://missing", path: "missing_latest.sif", err: errors.New("not found")},
+		{ref: "docker://busybox", path: "/data/busybox_latest.sif", hash: "sha256:4567"},
+	}
+	expected := pullManifestHeader + "\n" +
+		"library://alpine:3.11\talpine_3.11.sif\tsha256:0123\n" +
+		"# failed: docker://missing\tmissing_latest.sif\tnot found\n" +
+		"docker://busybox\t/data/busybox_latest.sif\tsha256:4567\n" +
+		"# 2 of 3 images pulled, 1 failed\n"
+
+	var b bytes.Buffer
+	if err := formatPullManifest(&b, entries); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if b.String() != expected {
+		t.Fatalf("unexpected manifest:\n%s\nexpected:\n%s", b.String(), expected)
+	}
+
+	// the manifest is accepted back as a list of images
+	refs, err := readPullRefs(&b)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if want := []string{"library://alpine:3.11", "docker://busybox"}; !reflect.DeepEqual(refs, want) {
+		t.Fatalf("unexpected refs %v, expected %v", refs, want)
+	}
+}
@@ -0,0 +1,174 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"github.com/sylabs/scs-library-client/client"
+	"github.com/sylabs/singularity/docs"
+	"github.com/sylabs/singularity/internal/pkg/cache"
+	"github.com/sylabs/singularity/internal/pkg/client/library"
+	"github.com/sylabs/singularity/pkg/cmdline"
+	"github.com/sylabs/singularity/pkg/sylog"
+)
+
+// pullMirrorDryRun when true; lists the images a mirror would pull or skip
+// without pulling them.
+var pullMirrorDryRun bool
+
+// -n|--dry-run
+var pullMirrorDryRunFlag = cmdline.Flag{
+	ID:           "pullMirrorDryRunFlag",
+	Value:        &pullMirrorDryRun,
+	DefaultValue: false,
+	Name:         "dry-run",
+	ShortHand:    "n",
+	Usage:        "list the images that would be pulled or skipped, without pulling them",
+	EnvKeys:      []string{"PULL_MIRROR_DRY_RUN"},
+}
+
+// pullMirrorManifestName is the name of the manifest written in the mirror
+// directory without --manifest-out.
+const pullMirrorManifestName = "mirror-manifest.txt"
+
+func init() {
+	addCmdInit(func(cmdManager *cmdline.CommandManager) {
+		cmdManager.RegisterFlagForCmd(&pullMirrorDryRunFlag, PullMirrorCmd)
+	})
+}
+
+// PullMirrorCmd is 'singularity pull mirror' and pulls all the images of a
+// library namespace into a directory tree
+var PullMirrorCmd = &cobra.Command{
+	DisableFlagsInUseLine: true,
+	Args:                  cobra.RangeArgs(1, 2),
+	PreRun:                sylabsToken,
+	Run:                   pullMirrorRun,
+
+	Use:     docs.PullMirrorUse,
+	Short:   docs.PullMirrorShort,
+	Long:    docs.PullMirrorLong,
+	Example: docs.PullMirrorExample,
+}
+
+func pullMirrorRun(cmd *cobra.Command, args []string) {
+	ctx := cmd.Context()
+
+	dir := "."
+	if len(args) > 1 {
+		dir = args[1]
+	}
+	if pullJobs < 1 {
+		sylog.Fatalf("--jobs must be at least 1")
+	}
+	if err := pullCheckHosts(cmd, args[0]); err != nil {
+		sylog.Fatalf("%s", err)
+	}
+	if err := pullApplyUnsignedMode(); err != nil {
+		sylog.Fatalf("%s", err)
+	}
+
+	scsConfig := pullLibraryConfig()
+
+	images, err := library.ListNamespace(ctx, scsConfig, args[0])
+	if err != nil {
+		sylog.Fatalf("While listing %s: %v", args[0], err)
+	}
+	if len(images) == 0 {
+		sylog.Fatalf("No tagged images in %s", args[0])
+	}
+
+	items, err := pullMirrorItems(ctx, scsConfig, images, dir)
+	if err != nil {
+		sylog.Fatalf("%s", err)
+	}
+
+	if pullMirrorDryRun {
+		pullMirrorPlan(os.Stdout, items)
+		return
+	}
+
+	for _, item := range items {
+		if err := os.MkdirAll(filepath.Dir(item.pullTo), 0755); err != nil {
+			sylog.Fatalf("While creating the mirror directory: %v", err)
+		}
+	}
+
+	imgCache := pullCacheHandle(cache.Config{Disable: disableCache})
+	if imgCache == nil {
+		sylog.Fatalf("Failed to create an image cache handle")
+	}
+
+	manifest := pullManifestOut
+	if manifest == "" {
+		manifest = filepath.Join(dir, pullMirrorManifestName)
+	}
+	errs := pullBatchRun(ctx, imgCache, items, pullJobs)
+	if err := pullBatchFinish(ctx, items, errs, manifest); err != nil {
+		exitIfUnsigned(err)
+		sylog.Fatalf("%s", err)
+	}
+}
+
+// pullMirrorPath returns the path the image is mirrored to in dir.
+func pullMirrorPath(dir string, img library.NamespaceImage) string {
+	return filepath.Join(dir, img.Collection, img.Container, img.Tag+"_"+img.Arch+".sif")
+}
+
+// pullMirrorItems returns the batch items mirroring images into dir. The
+// images already mirrored, with the hash reported by the library, are
+// skipped so that an interrupted mirror can be resumed.
+func pullMirrorItems(ctx context.Context, scsConfig *client.Config, images []library.NamespaceImage, dir string) ([]pullBatchItem, error) {
+	items := make([]pullBatchItem, 0, len(images))
+	for _, img := range images {
+		ref := img.Ref()
+		item := pullBatchItem{
+			ref:      ref,
+			pullFrom: ref,
+			pullTo:   pullMirrorPath(dir, img),
+			opts:     pullImageOptions{arch: img.Arch},
+		}
+
+		if _, err := os.Stat(item.pullTo); err == nil {
+			hash, err := library.CacheHash(ctx, ref, img.Arch, scsConfig)
+			if err != nil {
+				return nil, fmt.Errorf("while checking %s (%s): %v", ref, img.Arch, err)
+			}
+			fileHash, err := client.ImageHash(item.pullTo)
+			if err != nil {
+				return nil, fmt.Errorf("could not hash %s: %v", item.pullTo, err)
+			}
+			item.skip = fileHash == hash
+			if !item.skip {
+				sylog.Verbosef("%s has hash %s instead of %s, pulling it again", item.pullTo, fileHash, hash)
+			}
+		} else if !os.IsNotExist(err) {
+			return nil, fmt.Errorf("while checking %s: %v", item.pullTo, err)
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// pullMirrorPlan writes what a mirror of items would do with --dry-run.
+func pullMirrorPlan(w io.Writer, items []pullBatchItem) {
+	pulled := 0
+	for _, item := range items {
+		action := "skip"
+		if !item.skip {
+			action = "pull"
+			pulled++
+		}
+		fmt.Fprintf(w, "%s %s (%s) -> %s\n", action, item.ref, item.opts.arch, item.pullTo)
+	}
+	fmt.Fprintf(w, "%d of %d images would be pulled\n", pulled, len(items))
+}
@@ -0,0 +1,92 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sylabs/scs-library-client/client"
+	"github.com/sylabs/singularity/internal/pkg/client/library"
+)
+
+func TestPullMirrorItems(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pull-mirror-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	images := []library.NamespaceImage{
+		{Entity: "org", Collection: "tools", Container: "grep", Tag: "1.0", Arch: "amd64"},
+		{Entity: "org", Collection: "tools", Container: "grep", Tag: "latest", Arch: "amd64"},
+		{Entity: "org", Collection: "tools", Container: "grep", Tag: "latest", Arch: "arm64"},
+	}
+	// 1.0 is mirrored, latest for amd64 is stale and for arm64 is missing
+	for _, img := range images[:2] {
+		path := pullMirrorPath(dir, img)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(img.Tag), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	hash, err := client.ImageHash(pullMirrorPath(dir, images[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/images/org/tools/grep:1.0":
+			w.Write([]byte(`{"data": {"hash": "` + hash + `"}}`))
+			return
+		case "/v1/images/org/tools/grep:latest":
+			w.Write([]byte(`{"data": {"hash": "sha256.0123"}}`))
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	items, err := pullMirrorItems(context.Background(), &client.Config{BaseURL: srv.URL}, images, dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(items) != len(images) {
+		t.Fatalf("got %d items, expected %d", len(items), len(images))
+	}
+
+	skips := []bool{true, false, false}
+	for i, item := range items {
+		if item.pullFrom != images[i].Ref() || item.opts.arch != images[i].Arch {
+			t.Errorf("unexpected item %s (%s) for %v", item.pullFrom, item.opts.arch, images[i])
+		}
+		if item.skip != skips[i] {
+			t.Errorf("%s: got skip %v, expected %v", item.pullTo, item.skip, skips[i])
+		}
+	}
+	if want := filepath.Join(dir, "tools", "grep", "latest_arm64.sif"); items[2].pullTo != want {
+		t.Errorf("got destination %s, expected %s", items[2].pullTo, want)
+	}
+
+	var out bytes.Buffer
+	pullMirrorPlan(&out, items)
+	if !strings.HasPrefix(out.String(), "skip library://org/tools/grep:1.0 (amd64)") {
+		t.Errorf("unexpected plan:\n%s", out.String())
+	}
+	if !strings.HasSuffix(out.String(), "2 of 3 images would be pulled\n") {
+		t.Errorf("unexpected plan:\n%s", out.String())
+	}
+}
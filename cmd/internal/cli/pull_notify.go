@@ -0,0 +1,116 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+
+	singularityclient "github.com/sylabs/singularity/internal/pkg/client"
+	"github.com/sylabs/singularity/internal/pkg/util/uri"
+	"github.com/sylabs/singularity/pkg/pull"
+	"github.com/sylabs/singularity/pkg/sylog"
+)
+
+// pullNotifyTimeout bounds the time spent delivering a pull notification.
+const pullNotifyTimeout = 5 * time.Second
+
+// pullNotification is the JSON payload posted to --notify-webhook.
+type pullNotification struct {
+	Image   string `json:"image"`
+	Path    string `json:"path"`
+	Hash    string `json:"hash,omitempty"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+// pullNotify posts the outcome of the pull of pullFrom to pullTo to the
+// --notify-webhook URL, if any, with the network settings of ctx. Delivery
+// failures are only logged.
+func pullNotify(ctx context.Context, pullFrom, pullTo string, pullErr error) {
+	if pullNotifyWebhook == "" {
+		return
+	}
+
+	n := pullNotification{
+		Image:   redactURI(pullFrom),
+		Success: pullErr == nil,
+	}
+	if path, err := filepath.Abs(pullTo); err == nil && pullTo != pullStdoutName {
+		n.Path = path
+	} else {
+		n.Path = pullTo
+	}
+	switch {
+	case pullErr != nil:
+		n.Error = redactUserinfo(pullErr.Error(), pullFrom)
+	case pullTo == pullStdoutName:
+		// no file is left to hash
+	default:
+		if hash, err := pull.FileSHA256(pullTo); err == nil {
+			n.Hash = hash
+		} else {
+			sylog.Debugf("Could not compute hash of %s: %v", pullTo, err)
+		}
+	}
+
+	if err := postNotification(ctx, pullNotifyWebhook, n); err != nil {
+		sylog.Warningf("Could not send pull notification: %v", err)
+	}
+}
+
+// postNotification posts n as JSON to webhook, within pullNotifyTimeout and
+// with the network settings of ctx.
+func postNotification(ctx context.Context, webhook string, n pullNotification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+
+	// the outcome of an interrupted pull is still notified
+	ctx = singularityclient.WithSettings(context.Background(), singularityclient.SettingsFromContext(ctx))
+	ctx, cancel := context.WithTimeout(ctx, pullNotifyTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error constructing http request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", pullAgent())
+
+	res, err := singularityclient.NewHTTPClient(0).Do(req)
+	if err != nil {
+		return fmt.Errorf("error making http request: %v", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("webhook returned status %s", res.Status)
+	}
+	return nil
+}
+
+// redactURI removes the credentials embedded in the URI s, if any.
+func redactURI(s string) string {
+	return uri.Redact(s)
+}
+
+// redactUserinfo removes from s the credentials embedded in the URI uri.
+func redactUserinfo(s, uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.User == nil {
+		return s
+	}
+	return strings.Replace(s, u.User.String()+"@", "", -1)
+}
@@ -0,0 +1,222 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/sylabs/singularity/pkg/cmdline"
+	"github.com/sylabs/singularity/pkg/pull"
+	"github.com/sylabs/singularity/pkg/pull/policy"
+	"github.com/sylabs/singularity/pkg/signing"
+	"github.com/sylabs/singularity/pkg/sylog"
+	"github.com/sylabs/singularity/pkg/util/singularityconf"
+)
+
+// pullTrustPolicy is the policy loaded from --policy, if any.
+var pullTrustPolicy *policy.Policy
+
+// pullRequireSignature when true; fails the pull unless the image
+// signatures are verified, whatever its transport.
+var pullRequireSignature bool
+
+// --require-signature
+var pullRequireSignatureFlag = cmdline.Flag{
+	ID:           "pullRequireSignatureFlag",
+	Value:        &pullRequireSignature,
+	DefaultValue: false,
+	Name:         "require-signature",
+	Usage:        "fail unless the image signatures are verified, including for the transports whose images are not verified by default",
+	EnvKeys:      []string{"PULL_REQUIRE_SIGNATURE"},
+}
+
+// --verify
+var pullVerifyFlag = cmdline.Flag{
+	ID:           "pullVerifyFlag",
+	Value:        &pullRequireSignature,
+	DefaultValue: false,
+	Name:         "verify",
+	Usage:        "same as --require-signature: verify the image signatures whatever its transport, and fail unless they are verified",
+	EnvKeys:      []string{"PULL_VERIFY"},
+}
+
+// pullNoVerify when true; skips the verification of the image signatures,
+// including for the library images.
+var pullNoVerify bool
+
+// --no-verify
+var pullNoVerifyFlag = cmdline.Flag{
+	ID:           "pullNoVerifyFlag",
+	Value:        &pullNoVerify,
+	DefaultValue: false,
+	Name:         "no-verify",
+	Usage:        "do not verify the image signatures, not even for library images, nor warn about unsigned images",
+	EnvKeys:      []string{"PULL_NO_VERIFY"},
+}
+
+// pullCheckNoVerify rejects the flags requiring a verification with
+// --no-verify, which implies --allow-unauthenticated.
+func pullCheckNoVerify() error {
+	if !pullNoVerify {
+		return nil
+	}
+	switch {
+	case pullRequireSignature:
+		return fmt.Errorf("--no-verify can't be used with --verify nor --require-signature")
+	case pullFailOnUnsigned:
+		return fmt.Errorf("--no-verify can't be used with --fail-on-unsigned")
+	case len(pullVerifyFingerprints) > 0:
+		return fmt.Errorf("--no-verify can't be used with --verify-fingerprint")
+	case pullVerifyOnly:
+		return fmt.Errorf("--no-verify can't be used with --verify-only")
+	case pullStripSignature:
+		return fmt.Errorf("--no-verify can't be used with --strip-signature, only verified signatures are removed")
+	}
+	unauthenticatedPull = true
+	return nil
+}
+
+// pullFailOnUnsigned when true; fails the pull with pullUnsignedExitCode
+// unless the image signatures are verified, without any other check
+// overriding it.
+var pullFailOnUnsigned bool
+
+// --fail-on-unsigned
+var pullFailOnUnsignedFlag = cmdline.Flag{
+	ID:           "pullFailOnUnsignedFlag",
+	Value:        &pullFailOnUnsigned,
+	DefaultValue: false,
+	Name:         "fail-on-unsigned",
+	Usage:        "fail with exit code 3 and remove the image unless its signatures are verified, whatever its transport or policy",
+	EnvKeys:      []string{"PULL_FAIL_ON_UNSIGNED"},
+}
+
+// pullUnsignedExitCode is the exit code of a pull refused by
+// --fail-on-unsigned.
+const pullUnsignedExitCode = 3
+
+// The modes of the 'pull unsigned' directive of singularity.conf.
+const (
+	// unsignedPrompt keeps unsigned images with a warning unless
+	// --allow-unauthenticated is set, the default
+	unsignedPrompt = "prompt"
+	// unsignedAllow keeps unsigned images as with --allow-unauthenticated
+	unsignedAllow = "allow"
+	// unsignedDeny refuses unsigned images as with --fail-on-unsigned
+	unsignedDeny = "deny"
+)
+
+// pullUnsignedDenied is set when the 'pull unsigned = deny' directive of
+// singularity.conf refuses the unsigned images, whatever the flags.
+var pullUnsignedDenied bool
+
+// pullApplyUnsignedMode applies the 'pull unsigned' directive of
+// singularity.conf to the flags. The flags can only make it stricter: deny
+// implies --fail-on-unsigned and rejects --allow-unauthenticated, while allow
+// implies --allow-unauthenticated unless --fail-on-unsigned or
+// --require-signature is set.
+func pullApplyUnsignedMode() error {
+	mode := unsignedPrompt
+	if cfg := singularityconf.GetCurrentConfig(); cfg != nil && cfg.PullUnsigned != "" {
+		mode = cfg.PullUnsigned
+	}
+	pullUnsignedDenied = mode == unsignedDeny
+
+	switch mode {
+	case unsignedPrompt:
+	case unsignedAllow:
+		if !pullFailOnUnsigned && !pullRequireSignature {
+			unauthenticatedPull = true
+		}
+	case unsignedDeny:
+		if unauthenticatedPull {
+			return fmt.Errorf("--no-verify and --allow-unauthenticated are not allowed, 'pull unsigned = deny' is set in singularity.conf")
+		}
+		pullFailOnUnsigned = true
+	default:
+		return fmt.Errorf("invalid 'pull unsigned' mode %q in singularity.conf, expected %s, %s or %s", mode, unsignedPrompt, unsignedAllow, unsignedDeny)
+	}
+	return nil
+}
+
+// pullUnsignedError is the error of an image refused by --fail-on-unsigned.
+type pullUnsignedError struct {
+	pullFrom string
+	err      error
+}
+
+func (e *pullUnsignedError) Error() string {
+	by := "--fail-on-unsigned"
+	if pullUnsignedDenied {
+		by = "'pull unsigned = deny' in singularity.conf"
+	}
+	if e.err == nil {
+		return fmt.Sprintf("%s is not signed, %s requires a verified signature", e.pullFrom, by)
+	}
+	return fmt.Sprintf("%v, %s requires a verified signature", e.err, by)
+}
+
+func (e *pullUnsignedError) Unwrap() error {
+	return e.err
+}
+
+// pullFingerprints are the normalized --verify-fingerprint values.
+var pullFingerprints []string
+
+// pullKeyServer returns the comma separated key servers the image pullFrom
+// is verified against: the one of its policy rule if set, the --keyserver
+// ones or the one of the remote.
+func pullKeyServer(pullFrom string) string {
+	if pullTrustPolicy != nil {
+		if r := pullTrustPolicy.Match(pullFrom); r != nil && r.Keyserver != "" {
+			return r.Keyserver
+		}
+	}
+	if len(pullKeyServers) > 0 {
+		return strings.Join(pullKeyServers, ",")
+	}
+	return keyServerURL
+}
+
+// exitIfUnsigned exits with pullUnsignedExitCode, logging err, if the pull
+// was refused by --fail-on-unsigned.
+func exitIfUnsigned(err error) {
+	var unsignedErr *pullUnsignedError
+	if errors.As(err, &unsignedErr) {
+		sylog.Errorf("%s", err)
+		os.Exit(pullUnsignedExitCode)
+	}
+}
+
+// pullError returns the error of the pull of pullFrom failing with err in
+// the terms of the command line.
+func pullError(pullFrom string, err error) error {
+	var unsignedErr *pull.UnsignedError
+	var archErr *pull.ArchMismatchError
+	switch {
+	case errors.As(err, &unsignedErr):
+		if unsignedErr.Err == nil {
+			return &pullUnsignedError{pullFrom: pullFrom}
+		}
+		return &pullUnsignedError{pullFrom: pullFrom, err: pullError(pullFrom, unsignedErr.Err)}
+	case errors.Is(err, signing.ErrNotSIF):
+		return pullNotSIFError(pullFrom, err)
+	case errors.As(err, &archErr):
+		return fmt.Errorf("%v, use --allow-arch-mismatch to keep it anyway", err)
+	}
+	return err
+}
+
+// pullNotSIFError returns the error of the image pullFrom which failed to be
+// verified with err as the downloaded file isn't a SIF image, e.g. an error
+// page, rather than an unsigned image.
+func pullNotSIFError(pullFrom string, err error) error {
+	sylog.Debugf("While verifying %s: %v", pullFrom, err)
+	return fmt.Errorf("%s: downloaded file is not a valid SIF image; the server may have returned an error page, or only signatures of SIF images can be verified (see --no-verify)", pullFrom)
+}
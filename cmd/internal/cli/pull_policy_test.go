@@ -0,0 +1,141 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/sylabs/singularity/pkg/pull"
+	"github.com/sylabs/singularity/pkg/signing"
+	"github.com/sylabs/singularity/pkg/util/singularityconf"
+)
+
+func TestPullApplyUnsignedMode(t *testing.T) {
+	defer singularityconf.SetCurrentConfig(singularityconf.GetCurrentConfig())
+	defer func(unauthenticated, failOnUnsigned, requireSignature bool) {
+		unauthenticatedPull, pullFailOnUnsigned, pullRequireSignature = unauthenticated, failOnUnsigned, requireSignature
+		pullUnsignedDenied = false
+	}(unauthenticatedPull, pullFailOnUnsigned, pullRequireSignature)
+
+	tests := []struct {
+		name                string
+		mode                string
+		unauthenticated     bool
+		failOnUnsigned      bool
+		requireSignature    bool
+		wantUnauthenticated bool
+		wantFailOnUnsigned  bool
+		wantDenied          bool
+		wantErr             bool
+	}{
+		{name: "Default"},
+		{name: "Prompt", mode: unsignedPrompt},
+		{name: "PromptAllowFlag", mode: unsignedPrompt, unauthenticated: true, wantUnauthenticated: true},
+		{name: "Allow", mode: unsignedAllow, wantUnauthenticated: true},
+		{name: "AllowFailFlag", mode: unsignedAllow, failOnUnsigned: true, wantFailOnUnsigned: true},
+		{name: "AllowRequireFlag", mode: unsignedAllow, requireSignature: true},
+		{name: "Deny", mode: unsignedDeny, wantFailOnUnsigned: true, wantDenied: true},
+		{name: "DenyFailFlag", mode: unsignedDeny, failOnUnsigned: true, wantFailOnUnsigned: true, wantDenied: true},
+		{name: "DenyAllowFlag", mode: unsignedDeny, unauthenticated: true, wantErr: true},
+		{name: "Invalid", mode: "sometimes", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			singularityconf.SetCurrentConfig(&singularityconf.File{PullUnsigned: tt.mode})
+			unauthenticatedPull, pullFailOnUnsigned, pullRequireSignature = tt.unauthenticated, tt.failOnUnsigned, tt.requireSignature
+			pullUnsignedDenied = false
+
+			err := pullApplyUnsignedMode()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if unauthenticatedPull != tt.wantUnauthenticated || pullFailOnUnsigned != tt.wantFailOnUnsigned || pullUnsignedDenied != tt.wantDenied {
+				t.Errorf("got --allow-unauthenticated %v, --fail-on-unsigned %v, denied %v", unauthenticatedPull, pullFailOnUnsigned, pullUnsignedDenied)
+			}
+
+			// applied again, as by another command, the flags it set
+			// don't change the outcome
+			if err := pullApplyUnsignedMode(); err != nil {
+				t.Fatalf("unexpected error applying again: %v", err)
+			}
+			if unauthenticatedPull != tt.wantUnauthenticated || pullFailOnUnsigned != tt.wantFailOnUnsigned || pullUnsignedDenied != tt.wantDenied {
+				t.Errorf("applied again, got --allow-unauthenticated %v, --fail-on-unsigned %v, denied %v", unauthenticatedPull, pullFailOnUnsigned, pullUnsignedDenied)
+			}
+		})
+	}
+
+	// the refusal names the directive rather than the flag
+	pullUnsignedDenied = true
+	if err := (&pullUnsignedError{pullFrom: "library://alpine"}).Error(); !strings.Contains(err, "'pull unsigned = deny'") {
+		t.Errorf("unexpected error %q", err)
+	}
+}
+
+func TestPullCheckNoVerify(t *testing.T) {
+	defer func(noVerify, unauthenticated, require, verifyOnly bool) {
+		pullNoVerify, unauthenticatedPull, pullRequireSignature, pullVerifyOnly = noVerify, unauthenticated, require, verifyOnly
+	}(pullNoVerify, unauthenticatedPull, pullRequireSignature, pullVerifyOnly)
+
+	tests := []struct {
+		name       string
+		noVerify   bool
+		require    bool
+		verifyOnly bool
+		wantErr    bool
+		wantUnauth bool
+	}{
+		{name: "Unset"},
+		{name: "NoVerify", noVerify: true, wantUnauth: true},
+		{name: "Verify", noVerify: true, require: true, wantErr: true},
+		{name: "VerifyOnly", noVerify: true, verifyOnly: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pullNoVerify, unauthenticatedPull, pullRequireSignature, pullVerifyOnly = tt.noVerify, false, tt.require, tt.verifyOnly
+			err := pullCheckNoVerify()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && unauthenticatedPull != tt.wantUnauth {
+				t.Errorf("got unauthenticated pull %v, want %v", unauthenticatedPull, tt.wantUnauth)
+			}
+		})
+	}
+}
+
+func TestPullError(t *testing.T) {
+	notSIF := fmt.Errorf("https://example.com/image.sif could not be verified: %w", signing.ErrNotSIF)
+	tests := []struct {
+		name     string
+		err      error
+		unsigned bool
+		want     string
+	}{
+		{name: "Unsigned", err: &pull.UnsignedError{From: "library://alpine"}, unsigned: true, want: "--fail-on-unsigned requires a verified signature"},
+		{name: "UnsignedNotSIF", err: &pull.UnsignedError{From: "https://example.com/image.sif", Err: notSIF}, unsigned: true, want: "downloaded file is not a valid SIF image"},
+		{name: "NotSIF", err: notSIF, want: "downloaded file is not a valid SIF image"},
+		{name: "ArchMismatch", err: &pull.ArchMismatchError{From: "library://alpine", Arch: "amd64", ImageArchs: []string{"s390x"}}, want: "use --allow-arch-mismatch"},
+		{name: "Other", err: errors.New("not found"), want: "not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := pullError("library://alpine", tt.err)
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got error %q, want %q", err, tt.want)
+			}
+			var unsignedErr *pullUnsignedError
+			if errors.As(err, &unsignedErr) != tt.unsigned {
+				t.Errorf("got unsigned error %v, want %v", !tt.unsigned, tt.unsigned)
+			}
+		})
+	}
+}
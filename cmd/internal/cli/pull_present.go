@@ -0,0 +1,59 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/sylabs/singularity/pkg/cmdline"
+)
+
+// pullIfNotPresent when true; does nothing if the destination of the pull
+// already exists, without any request.
+var pullIfNotPresent bool
+
+// --if-not-present
+var pullIfNotPresentFlag = cmdline.Flag{
+	ID:           "pullIfNotPresentFlag",
+	Value:        &pullIfNotPresent,
+	DefaultValue: false,
+	Name:         "if-not-present",
+	Usage:        "do nothing if the image file already exists, without any request, a newer image upstream not being detected",
+	EnvKeys:      []string{"PULL_IF_NOT_PRESENT"},
+}
+
+// pullCheckIfNotPresent checks that --if-not-present is only used for a
+// pull to a destination, whose existence is enough to skip it.
+func pullCheckIfNotPresent() error {
+	if !pullIfNotPresent {
+		return nil
+	}
+
+	switch {
+	case pullFromFile != "" || pullFromStdin:
+		return fmt.Errorf("--if-not-present can't be used with --from-file or --from-stdin")
+	case forceOverwrite || pullOnConflict != "":
+		return fmt.Errorf("--if-not-present can't be used with --force or --on-conflict")
+	case pullVerifyOnly:
+		return fmt.Errorf("--if-not-present can't be used with --verify-only")
+	case pullDownloadOnly:
+		return fmt.Errorf("--if-not-present can't be used with --download-only")
+	case pullDeffileOnly:
+		return fmt.Errorf("--if-not-present can't be used with --deffile-only")
+	}
+	return nil
+}
+
+// pullPresent returns whether the pull to pullTo is skipped by
+// --if-not-present, pullTo being there whatever its content.
+func pullPresent(pullTo string) bool {
+	if !pullIfNotPresent {
+		return false
+	}
+	_, err := os.Lstat(pullTo)
+	return err == nil
+}
@@ -0,0 +1,76 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPullPresent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pull-present-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	present := filepath.Join(dir, "present.sif")
+	if err := ioutil.WriteFile(present, []byte("image"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// a dangling symlink is there as well
+	dangling := filepath.Join(dir, "dangling.sif")
+	if err := os.Symlink(filepath.Join(dir, "missing"), dangling); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(b bool) { pullIfNotPresent = b }(pullIfNotPresent)
+
+	pullIfNotPresent = false
+	if pullPresent(present) {
+		t.Errorf("pull skipped without --if-not-present")
+	}
+
+	pullIfNotPresent = true
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{present, true},
+		{dangling, true},
+		{filepath.Join(dir, "absent.sif"), false},
+	}
+	for _, tt := range tests {
+		if got := pullPresent(tt.path); got != tt.want {
+			t.Errorf("pullPresent(%s) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestPullCheckIfNotPresent(t *testing.T) {
+	defer func(b, f bool, s string) {
+		pullIfNotPresent, forceOverwrite, pullOnConflict = b, f, s
+	}(pullIfNotPresent, forceOverwrite, pullOnConflict)
+
+	pullIfNotPresent, forceOverwrite, pullOnConflict = false, true, ""
+	if err := pullCheckIfNotPresent(); err != nil {
+		t.Errorf("unexpected error without --if-not-present: %v", err)
+	}
+	pullIfNotPresent = true
+	if err := pullCheckIfNotPresent(); err == nil {
+		t.Errorf("unexpected success with --force")
+	}
+	forceOverwrite, pullOnConflict = false, conflictSkip
+	if err := pullCheckIfNotPresent(); err == nil {
+		t.Errorf("unexpected success with --on-conflict")
+	}
+	pullOnConflict = ""
+	if err := pullCheckIfNotPresent(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
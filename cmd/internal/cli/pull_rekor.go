@@ -0,0 +1,53 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"github.com/sylabs/singularity/pkg/cmdline"
+	"github.com/sylabs/singularity/pkg/sylog"
+)
+
+var (
+	// pullRekor is the URL of the Rekor transparency log the signatures
+	// of the pulled images must be recorded in.
+	pullRekor string
+	// pullSkipRekor when true; skips the transparency log check, e.g.
+	// offline.
+	pullSkipRekor bool
+)
+
+// --rekor
+var pullRekorFlag = cmdline.Flag{
+	ID:           "pullRekorFlag",
+	Value:        &pullRekor,
+	DefaultValue: "",
+	Name:         "rekor",
+	Usage:        "fail unless the signature of the pulled image is recorded in the Rekor transparency log at the given URL",
+	EnvKeys:      []string{"PULL_REKOR"},
+}
+
+// --skip-rekor
+var pullSkipRekorFlag = cmdline.Flag{
+	ID:           "pullSkipRekorFlag",
+	Value:        &pullSkipRekor,
+	DefaultValue: false,
+	Name:         "skip-rekor",
+	Usage:        "skip the --rekor transparency log check, e.g. when offline",
+	EnvKeys:      []string{"PULL_SKIP_REKOR"},
+}
+
+// pullRekorURL returns the --rekor transparency log the signature of the
+// image pullFrom must be recorded in, none with --skip-rekor.
+func pullRekorURL(pullFrom string) string {
+	if pullRekor == "" {
+		return ""
+	}
+	if pullSkipRekor {
+		sylog.Warningf("Skipping the transparency log check of %s (--skip-rekor)", redactURI(pullFrom))
+		return ""
+	}
+	return pullRekor
+}
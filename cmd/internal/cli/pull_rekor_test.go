@@ -0,0 +1,35 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"testing"
+)
+
+func TestPullRekorURL(t *testing.T) {
+	defer func(url string, skip bool) {
+		pullRekor, pullSkipRekor = url, skip
+	}(pullRekor, pullSkipRekor)
+
+	tests := []struct {
+		name string
+		url  string
+		skip bool
+		want string
+	}{
+		{name: "Disabled"},
+		{name: "Skipped", url: "https://rekor.example.com", skip: true},
+		{name: "Checked", url: "https://rekor.example.com", want: "https://rekor.example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pullRekor, pullSkipRekor = tt.url, tt.skip
+			if got := pullRekorURL("https://example.com/image.sif"); got != tt.want {
+				t.Errorf("got transparency log %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,239 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	singularityclient "github.com/sylabs/singularity/internal/pkg/client"
+	"github.com/sylabs/singularity/internal/pkg/util/uri"
+	"github.com/sylabs/singularity/pkg/cmdline"
+	"github.com/sylabs/singularity/pkg/pull"
+	"github.com/sylabs/singularity/pkg/sylog"
+	"github.com/sylabs/singularity/pkg/util/singularityconf"
+)
+
+// pullReportTimeout bounds the time spent delivering the queued pull
+// events once the pulls are done, the exit being delayed by it at most.
+var pullReportTimeout = 2 * time.Second
+
+var (
+	// pullReportTo is the URL the anonymized pull events are posted to.
+	pullReportTo string
+	// pullReportImageNames when true; includes the image in the pull
+	// events.
+	pullReportImageNames bool
+)
+
+// --report-to
+var pullReportToFlag = cmdline.Flag{
+	ID:           "pullReportToFlag",
+	Value:        &pullReportTo,
+	DefaultValue: "",
+	Name:         "report-to",
+	Usage:        "POST an anonymized event of the pull (transport, size bucket, duration, result, cache use) to the provided URL",
+	EnvKeys:      []string{"PULL_REPORT_TO"},
+}
+
+// --report-image-names
+var pullReportImageNamesFlag = cmdline.Flag{
+	ID:           "pullReportImageNamesFlag",
+	Value:        &pullReportImageNames,
+	DefaultValue: false,
+	Name:         "report-image-names",
+	Usage:        "include the image, without credentials, in the events sent to --report-to",
+	EnvKeys:      []string{"PULL_REPORT_IMAGE_NAMES"},
+}
+
+// pullEvent is the JSON payload posted to --report-to. It holds nothing
+// identifying the image or the user, unless the image is explicitly
+// requested.
+type pullEvent struct {
+	Transport  string  `json:"transport"`
+	SizeBucket string  `json:"sizeBucket,omitempty"`
+	Duration   float64 `json:"durationSeconds"`
+	Success    bool    `json:"success"`
+	Cache      string  `json:"cache"`
+	Image      string  `json:"image,omitempty"`
+}
+
+// pullReportConfig returns the URL the pull events are reported to and
+// whether they include the image, from the flags or else singularity.conf.
+// An empty URL means the events aren't reported.
+func pullReportConfig() (string, bool) {
+	endpoint, imageNames := pullReportTo, pullReportImageNames
+	if cfg := singularityconf.GetCurrentConfig(); cfg != nil {
+		if endpoint == "" {
+			endpoint = cfg.PullReportURL
+		}
+		imageNames = imageNames || cfg.PullReportImageNames
+	}
+	return endpoint, imageNames
+}
+
+// pullReport queues the event of the pull of pullFrom to pullTo, which took
+// duration, used the cache as cacheUse and failed with pullErr if not nil,
+// to be posted to the report URL, if any, by pullReportFlush at the latest.
+// Delivery failures are only logged.
+func pullReport(pullFrom, pullTo string, cacheUse pull.CacheUse, duration time.Duration, pullErr error) {
+	endpoint, imageNames := pullReportConfig()
+	if endpoint == "" {
+		return
+	}
+
+	transport, _ := uri.Split(pullFrom)
+	e := pullEvent{
+		Transport: transportName(transport),
+		Duration:  duration.Round(time.Millisecond).Seconds(),
+		Success:   pullErr == nil,
+		Cache:     cacheUse.String(),
+	}
+	if pullErr == nil {
+		// sandboxes have no size
+		if fi, err := os.Stat(pullTo); err == nil && fi.Mode().IsRegular() {
+			e.SizeBucket = sizeBucket(fi.Size())
+		}
+	}
+	if imageNames {
+		e.Image = redactURI(pullFrom)
+	}
+
+	pullReports.queue(endpoint, e)
+}
+
+// pullReports is the queue of the pull events of the command.
+var pullReports pullReporter
+
+// pullReporter sends the queued pull events from a single goroutine, so
+// that the pulls never wait for their delivery.
+type pullReporter struct {
+	mu      sync.Mutex
+	pending *pullReportQueue
+}
+
+// pullReportQueue is the queue of the pull events sent until the next
+// flush.
+type pullReportQueue struct {
+	events chan queuedEvent
+	wg     sync.WaitGroup
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// queuedEvent is a pull event to post to endpoint.
+type queuedEvent struct {
+	endpoint string
+	event    pullEvent
+}
+
+// queue queues e to be posted to endpoint.
+func (r *pullReporter) queue(endpoint string, e pullEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.pending == nil {
+		q := &pullReportQueue{events: make(chan queuedEvent, 64)}
+		q.ctx, q.cancel = context.WithCancel(context.Background())
+		go q.run()
+		r.pending = q
+	}
+	r.pending.wg.Add(1)
+	r.pending.events <- queuedEvent{endpoint: endpoint, event: e}
+}
+
+// run posts the events of the queue until it is closed, dropping them once
+// its deadline is exceeded.
+func (q *pullReportQueue) run() {
+	for e := range q.events {
+		if q.ctx.Err() == nil {
+			if err := postEvent(q.ctx, e.endpoint, e.event); err != nil && q.ctx.Err() == nil {
+				sylog.Warningf("Could not report pull: %v", err)
+			}
+		}
+		q.wg.Done()
+	}
+}
+
+// flush waits for the queued events to be posted, within pullReportTimeout
+// overall, the ones not posted by then being dropped.
+func (r *pullReporter) flush() {
+	r.mu.Lock()
+	q := r.pending
+	r.pending = nil
+	r.mu.Unlock()
+	if q == nil {
+		return
+	}
+	defer q.cancel()
+	close(q.events)
+
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(pullReportTimeout):
+		sylog.Warningf("Could not report all the pulls within %v", pullReportTimeout)
+	}
+}
+
+// pullReportFlush sends the pull events not sent yet, within
+// pullReportTimeout.
+func pullReportFlush() {
+	pullReports.flush()
+}
+
+// sizeBucket returns the range of sizes n bytes falls in, so that the
+// reported events don't tell images apart by their exact size.
+func sizeBucket(n int64) string {
+	const mib = 1 << 20
+	switch {
+	case n < 10*mib:
+		return "<10MiB"
+	case n < 100*mib:
+		return "10MiB-100MiB"
+	case n < 1024*mib:
+		return "100MiB-1GiB"
+	case n < 10*1024*mib:
+		return "1GiB-10GiB"
+	}
+	return ">10GiB"
+}
+
+// postEvent posts e as JSON to endpoint, until ctx is done.
+func postEvent(ctx context.Context, endpoint string, e pullEvent) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error constructing http request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", pullAgent())
+
+	res, err := singularityclient.NewHTTPClient(0).Do(req)
+	if err != nil {
+		return fmt.Errorf("error making http request: %v", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("report endpoint returned status %s", res.Status)
+	}
+	return nil
+}
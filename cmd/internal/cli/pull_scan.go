@@ -0,0 +1,93 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sylabs/singularity/pkg/cmdline"
+	"github.com/sylabs/singularity/pkg/pull"
+	"github.com/sylabs/singularity/pkg/util/singularityconf"
+)
+
+var (
+	// pullScan when true; scans the pulled images with the scanner.
+	pullScan bool
+	// pullScanCommand is the scanner command the image path is appended
+	// to.
+	pullScanCommand string
+	// pullScanCleanExitCode is the exit code of the scanner for a clean
+	// image, -1 keeping the configured one.
+	pullScanCleanExitCode int
+)
+
+// --scan
+var pullScanFlag = cmdline.Flag{
+	ID:           "pullScanFlag",
+	Value:        &pullScan,
+	DefaultValue: false,
+	Name:         "scan",
+	Usage:        "scan the pulled image with the scanner set by --scan-command or singularity.conf, removing it if a threat is detected",
+	EnvKeys:      []string{"PULL_SCAN"},
+}
+
+// --scan-command
+var pullScanCommandFlag = cmdline.Flag{
+	ID:           "pullScanCommandFlag",
+	Value:        &pullScanCommand,
+	DefaultValue: "",
+	Name:         "scan-command",
+	Usage:        "scanner command run by --scan, the path of the image being appended to its arguments (e.g. 'clamdscan --fdpass --no-summary')",
+	EnvKeys:      []string{"PULL_SCAN_COMMAND"},
+}
+
+// --scan-clean-exit-code
+var pullScanCleanExitCodeFlag = cmdline.Flag{
+	ID:           "pullScanCleanExitCodeFlag",
+	Value:        &pullScanCleanExitCode,
+	DefaultValue: -1,
+	Name:         "scan-clean-exit-code",
+	Usage:        "exit code of the --scan scanner for a clean image (default 0)",
+	EnvKeys:      []string{"PULL_SCAN_CLEAN_EXIT_CODE"},
+}
+
+// pullScanConfig returns the scanner the pulled images are scanned with,
+// from the flags or else singularity.conf, or nil without --scan nor
+// 'pull scan = yes'. The scan required by 'pull scan = yes' is run with the
+// scanner of singularity.conf, which the flags can't replace.
+func pullScanConfig() (*pull.Scanner, error) {
+	scan, command, cleanCode := pullScan, pullScanCommand, pullScanCleanExitCode
+	if cfg := singularityconf.GetCurrentConfig(); cfg != nil {
+		if cfg.PullScan {
+			if command != "" || cleanCode >= 0 {
+				return nil, fmt.Errorf("--scan-command and --scan-clean-exit-code can't be used, 'pull scan = yes' in singularity.conf sets the scanner")
+			}
+			if strings.TrimSpace(cfg.PullScanCommand) == "" {
+				return nil, fmt.Errorf("'pull scan = yes' in singularity.conf requires a scanner, set with 'pull scan command'")
+			}
+			scan = true
+		}
+		if command == "" {
+			command = cfg.PullScanCommand
+		}
+		if cleanCode < 0 {
+			cleanCode = int(cfg.PullScanCleanExitCode)
+		}
+	}
+	if !scan {
+		return nil, nil
+	}
+	if cleanCode < 0 {
+		cleanCode = 0
+	}
+
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return nil, fmt.Errorf("--scan requires a scanner, set with --scan-command or 'pull scan command' in singularity.conf")
+	}
+	return &pull.Scanner{Args: args, CleanExitCode: cleanCode}, nil
+}
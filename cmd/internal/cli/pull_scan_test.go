@@ -0,0 +1,168 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/sylabs/singularity/internal/pkg/cache"
+	"github.com/sylabs/singularity/pkg/pull"
+	"github.com/sylabs/singularity/pkg/util/singularityconf"
+	useragent "github.com/sylabs/singularity/pkg/util/user-agent"
+)
+
+func TestPullScanConfig(t *testing.T) {
+	defer singularityconf.SetCurrentConfig(singularityconf.GetCurrentConfig())
+	singularityconf.SetCurrentConfig(&singularityconf.File{})
+	defer func(scan bool, command string, code int) {
+		pullScan, pullScanCommand, pullScanCleanExitCode = scan, command, code
+	}(pullScan, pullScanCommand, pullScanCleanExitCode)
+
+	tests := []struct {
+		name      string
+		scan      bool
+		command   string
+		cleanCode int
+		want      *pull.Scanner
+		wantErr   bool
+	}{
+		{name: "NoScan", command: "scanner --fdpass", cleanCode: -1},
+		{name: "Scan", scan: true, command: "scanner --fdpass", cleanCode: -1, want: &pull.Scanner{Args: []string{"scanner", "--fdpass"}}},
+		{name: "CleanExitCode", scan: true, command: "scanner", cleanCode: 1, want: &pull.Scanner{Args: []string{"scanner"}, CleanExitCode: 1}},
+		{name: "NoScanner", scan: true, cleanCode: -1, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pullScan, pullScanCommand, pullScanCleanExitCode = tt.scan, tt.command, tt.cleanCode
+			got, err := pullScanConfig()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got scanner %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPullScanConfigRequired(t *testing.T) {
+	defer singularityconf.SetCurrentConfig(singularityconf.GetCurrentConfig())
+	defer func(scan bool, command string, code int) {
+		pullScan, pullScanCommand, pullScanCleanExitCode = scan, command, code
+	}(pullScan, pullScanCommand, pullScanCleanExitCode)
+
+	tests := []struct {
+		name      string
+		conf      singularityconf.File
+		command   string
+		cleanCode int
+		want      *pull.Scanner
+		wantErr   bool
+	}{
+		{
+			name:      "Conf",
+			conf:      singularityconf.File{PullScan: true, PullScanCommand: "scanner --fdpass", PullScanCleanExitCode: 2},
+			cleanCode: -1,
+			want:      &pull.Scanner{Args: []string{"scanner", "--fdpass"}, CleanExitCode: 2},
+		},
+		{
+			// a required scan can't be skipped with another command
+			name:      "ScanCommand",
+			conf:      singularityconf.File{PullScan: true, PullScanCommand: "scanner --fdpass"},
+			command:   "true",
+			cleanCode: -1,
+			wantErr:   true,
+		},
+		{
+			name:      "ScanCleanExitCode",
+			conf:      singularityconf.File{PullScan: true, PullScanCommand: "scanner --fdpass"},
+			cleanCode: 1,
+			wantErr:   true,
+		},
+		{
+			name:      "NoConfScanner",
+			conf:      singularityconf.File{PullScan: true},
+			command:   "scanner",
+			cleanCode: -1,
+			wantErr:   true,
+		},
+		{
+			name:      "NotRequired",
+			conf:      singularityconf.File{PullScanCommand: "scanner --fdpass"},
+			command:   "other",
+			cleanCode: -1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := tt.conf
+			singularityconf.SetCurrentConfig(&conf)
+			pullScan, pullScanCommand, pullScanCleanExitCode = false, tt.command, tt.cleanCode
+			got, err := pullScanConfig()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got scanner %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPullImageScanReleasedLease(t *testing.T) {
+	useragent.InitValue("singularity", "3.0.0")
+	defer func(f string) { pullOutputFormat = f }(pullOutputFormat)
+	pullOutputFormat = formatSIF
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "image")
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "pull-scan-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	// the cache is disabled unless the real user can write to it
+	if err := os.Chmod(dir, 0777); err != nil {
+		t.Fatalf("could not change permissions of %s: %v", dir, err)
+	}
+	imgCache, err := cache.New(cache.Config{ParentDir: filepath.Join(dir, "cache")})
+	if err != nil {
+		t.Fatalf("could not create cache: %v", err)
+	}
+
+	// fails while a lease is held, the concurrent pulls waiting for the scan
+	scanner := filepath.Join(dir, "scanner")
+	script := fmt.Sprintf("#!/bin/sh\nif find %q -path '*/%s/*' -type f | grep -q .; then echo \"lease held\"; exit 1; fi\n", dir, cache.LeaseDirName)
+	if err := ioutil.WriteFile(scanner, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(scan bool, command string, code int) {
+		pullScan, pullScanCommand, pullScanCleanExitCode = scan, command, code
+	}(pullScan, pullScanCommand, pullScanCleanExitCode)
+	pullScan, pullScanCommand, pullScanCleanExitCode = true, scanner, -1
+
+	pullTo := filepath.Join(dir, "image.sif")
+	if err := pullImage(context.Background(), imgCache, pullTo, srv.URL+"/image.sif", nil, pullImageOptions{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if b, err := ioutil.ReadFile(pullTo); err != nil || string(b) != "image" {
+		t.Errorf("unexpected image %s: %q (%v)", pullTo, b, err)
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/sylabs/singularity/internal/pkg/client/library"
+	"github.com/sylabs/singularity/internal/pkg/util/interactive"
+	"github.com/sylabs/singularity/pkg/cmdline"
+)
+
+var (
+	// pullSearch is the term the library is searched for the image to
+	// pull.
+	pullSearch string
+	// pullTakeFirst when true; pulls the first of several --search
+	// matches.
+	pullTakeFirst bool
+)
+
+// --search
+var pullSearchFlag = cmdline.Flag{
+	ID:           "pullSearchFlag",
+	Value:        &pullSearch,
+	DefaultValue: "",
+	Name:         "search",
+	Usage:        "search the library for the term and pull the matching container, the only argument being the optional destination",
+	EnvKeys:      []string{"PULL_SEARCH"},
+}
+
+// --take-first
+var pullTakeFirstFlag = cmdline.Flag{
+	ID:           "pullTakeFirstFlag",
+	Value:        &pullTakeFirst,
+	DefaultValue: false,
+	Name:         "take-first",
+	Usage:        "pull the first container matching --search when several do",
+	EnvKeys:      []string{"PULL_TAKE_FIRST"},
+}
+
+// pullCheckSearch checks that --search is used to pull a single image.
+func pullCheckSearch() error {
+	if pullSearch == "" {
+		if pullTakeFirst {
+			return fmt.Errorf("--take-first requires --search")
+		}
+		return nil
+	}
+	if pullFromFile != "" || pullFromStdin {
+		return fmt.Errorf("--search can't be used with --from-file or --from-stdin")
+	}
+	return nil
+}
+
+// pullSearchRef searches the library for pullSearch and returns the URI of
+// the matching container, the matches being listed to w. Several matches
+// are only resolved with --take-first or by asking the user to select one,
+// when interactive.
+func pullSearchRef(ctx context.Context, w io.Writer) (string, error) {
+	matches, err := library.SearchContainers(ctx, pullLibraryConfig(), pullSearch)
+	if err != nil {
+		return "", fmt.Errorf("while searching the library: %v", err)
+	}
+	if len(matches) == 0 {
+		return "", fmt.Errorf("no library container matches %q", pullSearch)
+	}
+
+	fmt.Fprintf(w, "Found %d containers for '%s'\n", len(matches), pullSearch)
+	for i, m := range matches {
+		if m.Description != "" {
+			fmt.Fprintf(w, "  %d) %s - %s\n", i+1, m.URI, m.Description)
+		} else {
+			fmt.Fprintf(w, "  %d) %s\n", i+1, m.URI)
+		}
+	}
+	if len(matches) == 1 || pullTakeFirst {
+		return matches[0].URI, nil
+	}
+	if !pullInteractive() {
+		return "", fmt.Errorf("%d library containers match %q, use --take-first or pull one of them", len(matches), pullSearch)
+	}
+
+	n, err := interactive.AskNumberInRange(1, len(matches), "Select the container to pull [1-%d]: ", len(matches))
+	if err != nil {
+		return "", fmt.Errorf("invalid selection: %v", err)
+	}
+	return matches[n-1].URI, nil
+}
@@ -0,0 +1,78 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	useragent "github.com/sylabs/singularity/pkg/util/user-agent"
+)
+
+func TestPullSearchRef(t *testing.T) {
+	useragent.InitValue("singularity", "3.0.0")
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("value") {
+		case "alpine":
+			w.Write([]byte(`{"data": {"container": [{"name": "alpine", "description": "Alpine Linux", "entityName": "library", "collectionName": "default"}]}}`))
+		case "grep":
+			w.Write([]byte(`{"data": {"container": [
+				{"name": "grep", "entityName": "org", "collectionName": "tools"},
+				{"name": "ripgrep", "entityName": "other", "collectionName": "default"}
+			]}}`))
+		default:
+			w.Write([]byte(`{"data": {}}`))
+		}
+	}))
+	defer srv.Close()
+
+	defer func(uri, search string, first bool) {
+		pullLibraryURI, pullSearch, pullTakeFirst = uri, search, first
+	}(pullLibraryURI, pullSearch, pullTakeFirst)
+	pullLibraryURI = srv.URL
+
+	tests := []struct {
+		name      string
+		term      string
+		takeFirst bool
+		expected  string
+		listed    string
+		err       string
+	}{
+		{name: "Single", term: "alpine", expected: "library://library/default/alpine", listed: "1) library://library/default/alpine - Alpine Linux"},
+		{name: "TakeFirst", term: "grep", takeFirst: true, expected: "library://org/tools/grep", listed: "2) library://other/default/ripgrep"},
+		{name: "Several", term: "grep", err: "2 library containers match"},
+		{name: "None", term: "nothing", err: "no library container matches"},
+		{name: "Short", term: "ab", err: "at least 3 characters"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pullSearch, pullTakeFirst = tt.term, tt.takeFirst
+			var out bytes.Buffer
+			ref, err := pullSearchRef(context.Background(), &out)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("unexpected error %v, expected %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if ref != tt.expected {
+				t.Errorf("got %s, expected %s", ref, tt.expected)
+			}
+			if !strings.Contains(out.String(), tt.listed) {
+				t.Errorf("%q not listed in:\n%s", tt.listed, out.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"os"
+	"testing"
+)
+
+func TestPullNoSetuidDefault(t *testing.T) {
+	if pullNoSetuidDefault(0) {
+		t.Errorf("unexpected stripping by default for root")
+	}
+	if !pullNoSetuidDefault(1000) {
+		t.Errorf("unexpected no stripping by default for an unprivileged user")
+	}
+	if d := pullNoSetuidFlag.DefaultValue; d != pullNoSetuidDefault(os.Geteuid()) {
+		t.Errorf("unexpected --no-setuid default %v for uid %d", d, os.Geteuid())
+	}
+
+	defer func(noSetuid bool) {
+		pullNoSetuid = noSetuid
+	}(pullNoSetuid)
+
+	// the OCI images are built with the default
+	for _, euid := range []int{0, 1000} {
+		pullNoSetuid = pullNoSetuidDefault(euid)
+		if opts := pullOCIOptions(nil, ""); opts.NoSetuid != (euid != 0) {
+			t.Errorf("unexpected NoSetuid %v for uid %d", opts.NoSetuid, euid)
+		}
+	}
+}
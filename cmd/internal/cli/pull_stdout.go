@@ -0,0 +1,95 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	ocitypes "github.com/containers/image/v5/types"
+	"github.com/sylabs/singularity/internal/pkg/cache"
+)
+
+// pullStdoutName is the destination writing the pulled image to stdout.
+const pullStdoutName = "-"
+
+// pullToStdout is true when the pulled image is written to stdout, which
+// then only holds its bytes.
+var pullToStdout bool
+
+// pullCheckStdout sets pullToStdout if the destination of the pull of args,
+// or --output, is stdout, failing with the options writing anything else to
+// it or not producing a single SIF image.
+func pullCheckStdout(args []string) error {
+	dest := pullImageName
+	if dest == "" && (len(args) == 2 || (pullSearch != "" && len(args) == 1)) {
+		dest = args[0]
+	}
+	if dest != pullStdoutName {
+		return nil
+	}
+
+	switch {
+	case pullJSON:
+		return fmt.Errorf("--json can't be used when pulling to stdout, which only holds the image")
+	case pullFromFile != "" || pullFromStdin:
+		return fmt.Errorf("--from-file and --from-stdin can't be used when pulling to stdout")
+	case pullOutputFormat != formatSIF:
+		return fmt.Errorf("--output-format %s can't be used when pulling to stdout, only SIF images can be written to it", pullOutputFormat)
+	case pullDir != "":
+		return fmt.Errorf("--dir can't be used when pulling to stdout")
+	case pullTmpfs:
+		return fmt.Errorf("--tmpfs can't be used when pulling to stdout")
+	case pullIfNotPresent:
+		return fmt.Errorf("--if-not-present can't be used when pulling to stdout")
+	case pullDryRun, pullExplain, pullDownloadOnly, pullDeffileOnly:
+		return fmt.Errorf("--dry-run, --explain, --download-only and --deffile-only can't be used when pulling to stdout")
+	case pullAttestationOut != "":
+		return fmt.Errorf("--attestation-out can't be used when pulling to stdout")
+	}
+	pullToStdout = true
+	return nil
+}
+
+// pullCheckStdoutTransport fails when pulling images of transport to
+// stdout: only the transports downloading a SIF image are supported, images
+// built from OCI layers aren't as the build may write to stdout.
+func pullCheckStdoutTransport(transport string) error {
+	switch transport {
+	case LibraryProtocol, "", ShubProtocol, OrasProtocol, HTTPProtocol, HTTPSProtocol, ScpProtocol:
+		return nil
+	}
+	return fmt.Errorf("%s images can't be pulled to stdout, they are built rather than downloaded as a single SIF image", transportName(transport))
+}
+
+// pullStdout pulls the image pullFrom to a temporary file, from which it is
+// written to w once verified. Nothing is written to w if the pull fails.
+func pullStdout(ctx context.Context, w io.Writer, imgCache *cache.Handle, pullFrom string, ociAuth *ocitypes.DockerAuthConfig, opts pullImageOptions) error {
+	dir, err := ioutil.TempDir(tmpDir, "pull-stdout-")
+	if err != nil {
+		return fmt.Errorf("could not create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "image.sif")
+	if err := pullImage(ctx, imgCache, path, pullFrom, ociAuth, opts); err != nil {
+		return err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("could not open pulled image: %v", err)
+	}
+	defer f.Close()
+	if _, err := io.Copy(w, f); err != nil {
+		return fmt.Errorf("while writing %s to stdout: %v", pullFrom, err)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sylabs/singularity/internal/pkg/cache"
+	useragent "github.com/sylabs/singularity/pkg/util/user-agent"
+)
+
+func TestPullCheckStdout(t *testing.T) {
+	defer func(name string, json bool, format string) {
+		pullImageName, pullJSON, pullOutputFormat, pullToStdout = name, json, format, false
+	}(pullImageName, pullJSON, pullOutputFormat)
+
+	tests := []struct {
+		name       string
+		args       []string
+		output     string
+		json       bool
+		format     string
+		wantStdout bool
+		wantErr    bool
+	}{
+		{name: "File", args: []string{"image.sif", "library://alpine"}},
+		{name: "Default", args: []string{"library://alpine"}},
+		{name: "Argument", args: []string{"-", "library://alpine"}, wantStdout: true},
+		{name: "Output", args: []string{"library://alpine"}, output: "-", wantStdout: true},
+		{name: "JSON", args: []string{"-", "library://alpine"}, json: true, wantErr: true},
+		{name: "Sandbox", args: []string{"-", "library://alpine"}, format: formatSandbox, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pullImageName, pullJSON, pullToStdout = tt.output, tt.json, false
+			pullOutputFormat = formatSIF
+			if tt.format != "" {
+				pullOutputFormat = tt.format
+			}
+			err := pullCheckStdout(tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if pullToStdout != tt.wantStdout {
+				t.Errorf("got stdout %v, want %v", pullToStdout, tt.wantStdout)
+			}
+		})
+	}
+}
+
+func TestPullCheckStdoutTransport(t *testing.T) {
+	for _, transport := range []string{LibraryProtocol, ShubProtocol, OrasProtocol, HTTPSProtocol, ScpProtocol} {
+		if err := pullCheckStdoutTransport(transport); err != nil {
+			t.Errorf("unexpected error for %s: %v", transport, err)
+		}
+	}
+	if err := pullCheckStdoutTransport("docker"); err == nil {
+		t.Errorf("unexpected success for docker images")
+	}
+}
+
+func TestPullStdout(t *testing.T) {
+	useragent.InitValue("singularity", "3.0.0")
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "image")
+	}))
+	defer srv.Close()
+
+	defer func(format string) { pullOutputFormat = format }(pullOutputFormat)
+	pullOutputFormat = formatSIF
+
+	imgCache, err := cache.New(cache.Config{Disable: true})
+	if err != nil {
+		t.Fatalf("could not create cache: %v", err)
+	}
+
+	var b bytes.Buffer
+	if err := pullStdout(context.Background(), &b, imgCache, srv.URL+"/image.sif", nil, pullImageOptions{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if b.String() != "image" {
+		t.Errorf("got %q written, want the image", b.String())
+	}
+
+	b.Reset()
+	opts := pullImageOptions{sha256: "sha256:0000000000000000000000000000000000000000000000000000000000000000"}
+	if err := pullStdout(context.Background(), &b, imgCache, srv.URL+"/image.sif", nil, opts); err == nil {
+		t.Errorf("unexpected success with another expected hash")
+	}
+	if b.Len() > 0 {
+		t.Errorf("got %q written by a failed pull", b.String())
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	singularityclient "github.com/sylabs/singularity/internal/pkg/client"
+	"github.com/sylabs/singularity/pkg/cmdline"
+)
+
+// pullTrace when true; records the duration of each phase of the pull.
+var pullTrace bool
+
+// --trace
+var pullTraceFlag = cmdline.Flag{
+	ID:           "pullTraceFlag",
+	Value:        &pullTrace,
+	DefaultValue: false,
+	Name:         "trace",
+	Usage:        "print the start and duration of each phase of the pull, in the summary with --json",
+	EnvKeys:      []string{"PULL_TRACE"},
+}
+
+// pullTracePhase is a traced phase of a pull, printed with --json.
+type pullTracePhase struct {
+	Phase      string `json:"phase"`
+	StartMs    int64  `json:"startMs"`
+	DurationMs int64  `json:"durationMs"`
+}
+
+// pullCheckTrace checks that --trace is used to pull a single image to a
+// destination.
+func pullCheckTrace() error {
+	if !pullTrace {
+		return nil
+	}
+	switch {
+	case pullFromFile != "" || pullFromStdin:
+		return fmt.Errorf("--trace can't be used with --from-file or --from-stdin")
+	case pullDownloadOnly || pullVerifyOnly || pullExplain || pullDeffileOnly:
+		return fmt.Errorf("--trace requires an image pulled to a destination")
+	}
+	return nil
+}
+
+// pullTracePhases returns the phases recorded by trace, nil without trace.
+func pullTracePhases(trace *singularityclient.Trace) []pullTracePhase {
+	var phases []pullTracePhase
+	for _, p := range trace.Phases() {
+		phases = append(phases, pullTracePhase{
+			Phase:      p.Name,
+			StartMs:    p.Offset.Milliseconds(),
+			DurationMs: p.Duration.Milliseconds(),
+		})
+	}
+	return phases
+}
+
+// writePullTrace writes the phases recorded by trace to w as a table.
+func writePullTrace(w io.Writer, trace *singularityclient.Trace) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "%s\t%s\t%s\n", "PHASE", "START", "DURATION")
+	for _, p := range trace.Phases() {
+		fmt.Fprintf(tw, "%s\t+%s\t%s\n", p.Name, p.Offset.Round(time.Millisecond), p.Duration.Round(time.Millisecond))
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,75 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	singularityclient "github.com/sylabs/singularity/internal/pkg/client"
+)
+
+func TestPullCheckTrace(t *testing.T) {
+	defer func(trace, download bool, file string) {
+		pullTrace, pullDownloadOnly, pullFromFile = trace, download, file
+	}(pullTrace, pullDownloadOnly, pullFromFile)
+
+	tests := []struct {
+		name      string
+		trace     bool
+		download  bool
+		file      string
+		expectErr bool
+	}{
+		{name: "None", download: true, file: "images.txt"},
+		{name: "Single", trace: true},
+		{name: "Batch", trace: true, file: "images.txt", expectErr: true},
+		{name: "DownloadOnly", trace: true, download: true, expectErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pullTrace, pullDownloadOnly, pullFromFile = tt.trace, tt.download, tt.file
+			if err := pullCheckTrace(); (err != nil) != tt.expectErr {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestWritePullTrace(t *testing.T) {
+	if p := pullTracePhases(nil); p != nil {
+		t.Errorf("unexpected phases without trace: %v", p)
+	}
+
+	ctx, trace := singularityclient.WithTrace(context.Background())
+	singularityclient.StartPhase(ctx, singularityclient.PhaseMetadata)()
+	singularityclient.StartPhase(ctx, singularityclient.PhaseDownload)()
+
+	phases := pullTracePhases(trace)
+	if len(phases) != 2 || phases[0].Phase != "metadata" || phases[1].Phase != "download" {
+		t.Errorf("unexpected phases %+v", phases)
+	}
+
+	var b bytes.Buffer
+	if err := writePullTrace(&b, trace); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("unexpected trace table:\n%s", b.String())
+	}
+	if f := strings.Fields(lines[0]); strings.Join(f, " ") != "PHASE START DURATION" {
+		t.Errorf("unexpected header %q", lines[0])
+	}
+	if !strings.HasPrefix(lines[1], "metadata") || !strings.Contains(lines[1], "+0s") {
+		t.Errorf("unexpected metadata line %q", lines[1])
+	}
+	if !strings.HasPrefix(lines[2], "download") {
+		t.Errorf("unexpected download line %q", lines[2])
+	}
+}
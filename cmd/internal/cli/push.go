@@ -90,7 +90,7 @@ var PushCmd = &cobra.Command{
 				sylog.Fatalf("Unable to push image to library: %v", err)
 			}
 		case OrasProtocol:
-			ociAuth, err := makeDockerCredentials(cmd)
+			ociAuth, err := makeDockerCredentials(cmd, "")
 			if err != nil {
 				sylog.Fatalf("Unable to make docker oci credentials: %s", err)
 			}
@@ -57,6 +57,7 @@ var (
 	}
 
 	dockerAuthConfig ocitypes.DockerAuthConfig
+	dockerAuthFile   string
 	dockerLogin      bool
 
 	encryptionPEMPath   string
@@ -64,6 +65,7 @@ var (
 	forceOverwrite      bool
 	noHTTPS             bool
 	tmpDir              string
+	cacheDir            string
 )
 
 const (
@@ -78,6 +80,9 @@ var (
 	verbose bool
 	quiet   bool
 
+	interactiveMode bool
+	nonInteractive  bool
+
 	configurationFile string
 )
 
@@ -130,6 +135,26 @@ var singVerboseFlag = cmdline.Flag{
 	Usage:        "print additional information",
 }
 
+// --interactive
+var singInteractiveFlag = cmdline.Flag{
+	ID:           "singInteractiveFlag",
+	Value:        &interactiveMode,
+	DefaultValue: true,
+	Name:         "interactive",
+	Usage:        "set to false to abort instead of prompting, selection prompts also abort when stdin isn't a terminal",
+	EnvKeys:      []string{"INTERACTIVE"},
+}
+
+// --non-interactive
+var singNonInteractiveFlag = cmdline.Flag{
+	ID:           "singNonInteractiveFlag",
+	Value:        &nonInteractive,
+	DefaultValue: false,
+	Name:         "non-interactive",
+	Usage:        "abort instead of prompting, same as --interactive=false",
+	EnvKeys:      []string{"NON_INTERACTIVE"},
+}
+
 var singTokenFileFlag = cmdline.Flag{
 	ID:           "singTokenFileFlag",
 	Value:        &tokenFile,
@@ -172,6 +197,16 @@ var dockerLoginFlag = cmdline.Flag{
 	EnvKeys:      []string{"DOCKER_LOGIN"},
 }
 
+// --auth-file
+var dockerAuthFileFlag = cmdline.Flag{
+	ID:           "dockerAuthFileFlag",
+	Value:        &dockerAuthFile,
+	DefaultValue: "",
+	Name:         "auth-file",
+	Usage:        "path to a containers auth.json or docker config.json file holding registry credentials (default $REGISTRY_AUTH_FILE)",
+	EnvKeys:      []string{"DOCKER_AUTH_FILE"},
+}
+
 // --passphrase
 var commonPromptForPassphraseFlag = cmdline.Flag{
 	ID:           "commonPromptForPassphraseFlag",
@@ -207,10 +242,20 @@ var commonNoHTTPSFlag = cmdline.Flag{
 	Value:        &noHTTPS,
 	DefaultValue: false,
 	Name:         "nohttps",
-	Usage:        "do NOT use HTTPS with the docker:// transport (useful for local docker registries without a certificate)",
+	Usage:        "do NOT use HTTPS with the docker:// and oras:// transports (useful for local docker registries without a certificate)",
 	EnvKeys:      []string{"NOHTTPS"},
 }
 
+// --cachedir
+var commonCacheDirFlag = cmdline.Flag{
+	ID:           "commonCacheDirFlag",
+	Value:        &cacheDir,
+	DefaultValue: "",
+	Name:         "cachedir",
+	Usage:        "directory the image cache is kept in, instead of the one in $HOME/.singularity",
+	EnvKeys:      []string{"CACHEDIR"},
+}
+
 // --tmpdir
 var commonTmpDirFlag = cmdline.Flag{
 	ID:           "commonTmpDirFlag",
@@ -233,6 +278,35 @@ var singConfigFileFlag = cmdline.Flag{
 	EnvKeys:      []string{"CONFIG_FILE"},
 }
 
+// updateInteractiveFromEnv sets the --interactive and --non-interactive
+// flags from the environment, as only the flags of the executed command
+// are set by the command manager.
+func updateInteractiveFromEnv() error {
+	for _, f := range []*cmdline.Flag{&singInteractiveFlag, &singNonInteractiveFlag} {
+		flag := singularityCmd.Flags().Lookup(f.Name)
+		for _, key := range f.EnvKeys {
+			if val, ok := os.LookupEnv(envPrefix + key); ok {
+				if err := f.EnvHandler(flag, val); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// promptsDisabled returns if prompts were disabled with --interactive=false
+// or --non-interactive.
+func promptsDisabled() bool {
+	return !interactiveMode || nonInteractive
+}
+
+// isInteractive returns if the user can be prompted: prompts were not
+// disabled and stdin is a terminal.
+func isInteractive() bool {
+	return !promptsDisabled() && terminal.IsTerminal(int(os.Stdin.Fd()))
+}
+
 func getCurrentUser() *user.User {
 	usr, err := user.Current()
 	if err != nil {
@@ -353,6 +427,9 @@ func Init(loadPlugins bool) {
 
 	// set persistent pre run function here to avoid initialization loop error
 	singularityCmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		if err := updateInteractiveFromEnv(); err != nil {
+			return err
+		}
 		persistentPreRun(cmd, args)
 		return cmdManager.UpdateCmdFlagFromEnv(cmd, envPrefix)
 	}
@@ -362,6 +439,8 @@ func Init(loadPlugins bool) {
 	cmdManager.RegisterFlagForCmd(&singSilentFlag, singularityCmd)
 	cmdManager.RegisterFlagForCmd(&singQuietFlag, singularityCmd)
 	cmdManager.RegisterFlagForCmd(&singVerboseFlag, singularityCmd)
+	cmdManager.RegisterFlagForCmd(&singInteractiveFlag, singularityCmd)
+	cmdManager.RegisterFlagForCmd(&singNonInteractiveFlag, singularityCmd)
 	cmdManager.RegisterFlagForCmd(&singTokenFileFlag, singularityCmd)
 	cmdManager.RegisterFlagForCmd(&singConfigFileFlag, singularityCmd)
 
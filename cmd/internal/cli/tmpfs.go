@@ -0,0 +1,136 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/sylabs/singularity/pkg/cmdline"
+	"github.com/sylabs/singularity/pkg/sylog"
+)
+
+// defaultTmpfs is the tmpfs used by --tmpfs unless --tmpdir points at one.
+const defaultTmpfs = "/dev/shm"
+
+var (
+	// pullTmpfs when true; pulls images into a tmpfs instead of the cache.
+	pullTmpfs bool
+	// tmpfsImage is the image pulled into a tmpfs by an action command.
+	tmpfsImage string
+)
+
+// --tmpfs
+var pullTmpfsFlag = cmdline.Flag{
+	ID:           "pullTmpfsFlag",
+	Value:        &pullTmpfs,
+	DefaultValue: false,
+	Name:         "tmpfs",
+	Usage:        "pull the image into a memory-backed tmpfs instead of the cache, images pulled to run a container are removed on exit",
+	EnvKeys:      []string{"TMPFS"},
+	ExcludedOS:   []string{cmdline.Darwin},
+}
+
+// tmpfsDir is a temporary directory on a tmpfs, holding the files of a pull
+// so that they never touch persistent storage. It is removed by Remove, or
+// as soon as the command is interrupted.
+type tmpfsDir struct {
+	// base is the tmpfs holding the directory.
+	base string
+	path string
+	once sync.Once
+}
+
+// tmpfsBase returns tmpDir if it is a tmpfs, or the default tmpfs.
+func tmpfsBase(tmpDir string) (string, error) {
+	base := defaultTmpfs
+	if tmpDir != "" {
+		if ok, _ := isTmpfs(tmpDir); ok {
+			base = tmpDir
+		} else {
+			sylog.Verbosef("Temporary directory %s is not a tmpfs, using %s", tmpDir, defaultTmpfs)
+		}
+	}
+	if ok, err := isTmpfs(base); err != nil {
+		return "", fmt.Errorf("could not check the filesystem of %s: %v", base, err)
+	} else if !ok {
+		return "", fmt.Errorf("%s is not a tmpfs, set --tmpdir to a tmpfs mount point", base)
+	}
+	return base, nil
+}
+
+// newTmpfsDir creates a temporary directory on the tmpfs base, removed when
+// ctx is done.
+func newTmpfsDir(ctx context.Context, base string) (*tmpfsDir, error) {
+	path, err := ioutil.TempDir(base, "singularity-tmpfs-")
+	if err != nil {
+		return nil, fmt.Errorf("could not create temporary directory on tmpfs: %v", err)
+	}
+	sylog.Debugf("Using tmpfs temporary directory %s", path)
+
+	d := &tmpfsDir{base: base, path: path}
+	go func() {
+		<-ctx.Done()
+		d.Remove()
+	}()
+	return d, nil
+}
+
+// Remove removes the directory and its content.
+func (d *tmpfsDir) Remove() {
+	if d == nil {
+		return
+	}
+	d.once.Do(func() {
+		if err := os.RemoveAll(d.path); err != nil {
+			sylog.Errorf("Could not remove tmpfs temporary directory %s: %v", d.path, err)
+		}
+	})
+}
+
+// Keep moves the file at path out of the directory, to the base tmpfs, so
+// that it outlives the directory, and returns its new location.
+func (d *tmpfsDir) Keep(path string) (string, error) {
+	f, err := ioutil.TempFile(d.base, "singularity-tmpfs-*"+filepath.Ext(path))
+	if err != nil {
+		return "", fmt.Errorf("could not create file on tmpfs: %v", err)
+	}
+	f.Close()
+
+	if err := os.Rename(path, f.Name()); err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("could not move %s: %v", path, err)
+	}
+	return f.Name(), nil
+}
+
+// Err returns err, explaining it when it is due to the image not fitting on
+// the tmpfs or in the available memory.
+func (d *tmpfsDir) Err(err error) error {
+	if d == nil || err == nil || !strings.Contains(err.Error(), "no space left on device") {
+		return err
+	}
+	available, availErr := tmpfsAvailable(d.base)
+	if availErr != nil {
+		return fmt.Errorf("image does not fit in the memory available to the tmpfs %s: %v", d.base, err)
+	}
+	return fmt.Errorf("image does not fit in the memory available to the tmpfs %s (%.1f MiB free): %v", d.base, float64(available)/(1<<20), err)
+}
+
+// checkTmpfsDest checks that the image destination pullTo is on a tmpfs.
+func checkTmpfsDest(pullTo string) error {
+	if ok, err := isTmpfs(filepath.Dir(pullTo)); err != nil {
+		return fmt.Errorf("could not check the filesystem of %s: %v", pullTo, err)
+	} else if !ok {
+		return fmt.Errorf("%s is not on a tmpfs, as required by --tmpfs", pullTo)
+	}
+	return nil
+}
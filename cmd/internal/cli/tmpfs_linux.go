@@ -0,0 +1,38 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// isTmpfs returns whether path is on a tmpfs.
+func isTmpfs(path string) (bool, error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return false, err
+	}
+	return st.Type == unix.TMPFS_MAGIC, nil
+}
+
+// tmpfsAvailable returns the space available on the tmpfs at path, which
+// is bounded by the free memory.
+func tmpfsAvailable(path string) (uint64, error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return 0, err
+	}
+	var info unix.Sysinfo_t
+	if err := unix.Sysinfo(&info); err != nil {
+		return 0, err
+	}
+
+	available := st.Bavail * uint64(st.Bsize)
+	if ram := (uint64(info.Freeram) + uint64(info.Bufferram)) * uint64(info.Unit); ram < available {
+		available = ram
+	}
+	return available, nil
+}
@@ -0,0 +1,188 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// tmpfsTestDirs returns a temporary directory on the default tmpfs and one
+// on persistent storage, skipping the test without a default tmpfs.
+func tmpfsTestDirs(t *testing.T) (string, string, func()) {
+	if ok, err := isTmpfs(defaultTmpfs); err != nil || !ok {
+		t.Skipf("%s is not a tmpfs", defaultTmpfs)
+	}
+	mem, err := ioutil.TempDir(defaultTmpfs, "tmpfs-test-")
+	if err != nil {
+		t.Fatalf("could not create temporary directory: %v", err)
+	}
+	disk, err := ioutil.TempDir("", "tmpfs-test-")
+	if err != nil {
+		os.RemoveAll(mem)
+		t.Fatalf("could not create temporary directory: %v", err)
+	}
+	if ok, _ := isTmpfs(disk); ok {
+		os.RemoveAll(mem)
+		os.RemoveAll(disk)
+		t.Skipf("%s is a tmpfs", disk)
+	}
+	return mem, disk, func() {
+		os.RemoveAll(mem)
+		os.RemoveAll(disk)
+	}
+}
+
+func TestTmpfsBase(t *testing.T) {
+	mem, disk, cleanup := tmpfsTestDirs(t)
+	defer cleanup()
+
+	tests := []struct {
+		name     string
+		tmpDir   string
+		expected string
+		wantErr  bool
+	}{
+		{name: "Default", tmpDir: "", expected: defaultTmpfs},
+		{name: "TmpdirOnTmpfs", tmpDir: mem, expected: mem},
+		{name: "TmpdirOnDisk", tmpDir: disk, expected: defaultTmpfs},
+		{name: "MissingTmpdir", tmpDir: filepath.Join(disk, "missing"), expected: defaultTmpfs},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base, err := tmpfsBase(tt.tmpDir)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if base != tt.expected {
+				t.Errorf("got tmpfs %s, expected %s", base, tt.expected)
+			}
+		})
+	}
+}
+
+func TestTmpfsRejected(t *testing.T) {
+	mem, disk, cleanup := tmpfsTestDirs(t)
+	defer cleanup()
+
+	defer func(tmpfs bool, name, format string) {
+		pullTmpfs, pullImageName, pullOutputFormat, pullToStdout = tmpfs, name, format, false
+	}(pullTmpfs, pullImageName, pullOutputFormat)
+	pullTmpfs, pullImageName, pullOutputFormat = true, "", formatSIF
+
+	tests := []struct {
+		name    string
+		check   func() error
+		wantErr string
+	}{
+		{
+			name:  "DestOnTmpfs",
+			check: func() error { return checkTmpfsDest(filepath.Join(mem, "image.sif")) },
+		},
+		{
+			name:    "DestOnDisk",
+			check:   func() error { return checkTmpfsDest(filepath.Join(disk, "image.sif")) },
+			wantErr: "is not on a tmpfs, as required by --tmpfs",
+		},
+		{
+			name:    "MissingDir",
+			check:   func() error { return checkTmpfsDest(filepath.Join(disk, "missing", "image.sif")) },
+			wantErr: "could not check the filesystem",
+		},
+		{
+			name:    "Stdout",
+			check:   func() error { return pullCheckStdout([]string{pullStdoutName, "library://alpine"}) },
+			wantErr: "--tmpfs can't be used when pulling to stdout",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.check()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("unexpected error %v, expected %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTmpfsDirErr(t *testing.T) {
+	mem, disk, cleanup := tmpfsTestDirs(t)
+	defer cleanup()
+
+	d, err := newTmpfsDir(context.Background(), mem)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer d.Remove()
+
+	enospc := fmt.Errorf("while copying image: %v", syscall.ENOSPC)
+	other := errors.New("while copying image: permission denied")
+
+	tests := []struct {
+		name       string
+		dir        *tmpfsDir
+		err        error
+		expected   []string
+		unexpected string
+	}{
+		{name: "NoError", dir: d},
+		{name: "Other", dir: d, err: other, expected: []string{other.Error()}},
+		{name: "NoTmpfs", dir: nil, err: enospc, expected: []string{enospc.Error()}},
+		{name: "Full", dir: d, err: enospc, expected: []string{"image does not fit in the memory available to the tmpfs " + mem, "MiB free", enospc.Error()}},
+		{name: "FullUnknownSize", dir: &tmpfsDir{base: filepath.Join(disk, "missing")}, err: enospc, expected: []string{"image does not fit in the memory available", enospc.Error()}, unexpected: "MiB free"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.dir.Err(tt.err)
+			if tt.err == nil {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("unexpected success")
+			}
+			for _, s := range tt.expected {
+				if !strings.Contains(err.Error(), s) {
+					t.Errorf("error %q doesn't contain %q", err, s)
+				}
+			}
+			if tt.unexpected != "" && strings.Contains(err.Error(), tt.unexpected) {
+				t.Errorf("error %q unexpectedly contains %q", err, tt.unexpected)
+			}
+		})
+	}
+}
+
+func TestTmpfsAvailable(t *testing.T) {
+	mem, disk, cleanup := tmpfsTestDirs(t)
+	defer cleanup()
+
+	available, err := tmpfsAvailable(mem)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if available == 0 {
+		t.Errorf("unexpected empty tmpfs %s", mem)
+	}
+	if _, err := tmpfsAvailable(filepath.Join(disk, "missing")); err == nil {
+		t.Errorf("unexpected success for a missing path")
+	}
+}
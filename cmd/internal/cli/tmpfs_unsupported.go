@@ -0,0 +1,20 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// +build !linux
+
+package cli
+
+import (
+	"fmt"
+)
+
+func isTmpfs(path string) (bool, error) {
+	return false, fmt.Errorf("tmpfs is not supported on this platform")
+}
+
+func tmpfsAvailable(path string) (uint64, error) {
+	return 0, fmt.Errorf("tmpfs is not supported on this platform")
+}
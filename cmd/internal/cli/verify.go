@@ -33,7 +33,7 @@ var verifyServerURIFlag = cmdline.Flag{
 	DefaultValue: defaultKeyServer,
 	Name:         "url",
 	ShortHand:    "u",
-	Usage:        "specify a URL for a key server",
+	Usage:        "specify a URL for a key server, or a comma separated list of key servers tried in order",
 	EnvKeys:      []string{"URL"},
 }
 
@@ -164,7 +164,14 @@ Enterprise Performance Computing (EPC)`
 	CacheShort string = `Manage the local cache`
 	CacheLong  string = `
   Manage your local Singularity cache. You can list/clean using the specific 
-  types.`
+  types.
+
+  The cache is kept in $HOME/.singularity/cache, or in the cache directory of
+  the directory given by --cachedir or SINGULARITY_CACHEDIR, e.g. for each
+  user of a shared builder to have an isolated cache. The flag takes
+  precedence, is accepted by pull, build, the action and cache commands, and
+  a relative path is relative to the current directory. Missing directories
+  are created, accessible by the user only.`
 	CacheExample string = `
   All group commands have their own help output:
 
@@ -179,13 +186,20 @@ Enterprise Performance Computing (EPC)`
 	CacheCleanLong  string = `
   This will clean your local cache (stored at $HOME/.singularity/cache if
   SINGULARITY_CACHEDIR is not set). By default the entire cache is cleaned, use
-  --days and --type flags to override this behavior. Note: if you use Singularity
+  --days and --type flags to override this behavior. Entries protected with
+  'cache pin' are kept unless --force is given. Note: if you use Singularity
   as root, cache will be stored in '/root/.singularity/.cache', to clean that
-  cache, you will need to run 'cache clean' as root, or with 'sudo'.`
+  cache, you will need to run 'cache clean' as root, or with 'sudo'.
+
+  --max-size removes the least recently used entries, as of their last pull
+  from the cache, until the cache uses at most the given size, e.g. 10G or
+  500M, instead of cleaning it all. With --days the entries older than it
+  are removed too. --dry-run lists the entries which would be removed.`
 	CacheCleanExample string = `
   All group commands have their own help output:
 
   $ singularity help cache clean --days 30
+  $ singularity cache clean --max-size 10G --dry-run
   $ singularity help cache clean --type=library,oci
   $ singularity cache clean --help`
 
@@ -196,13 +210,107 @@ Enterprise Performance Computing (EPC)`
 	CacheListShort string = `List your local Singularity cache`
 	CacheListLong  string = `
   This will list your local cache (stored at $HOME/.singularity/cache if
-  SINGULARITY_CACHEDIR is not set).`
+  SINGULARITY_CACHEDIR is not set). --verbose shows each entry, with the
+  time it was created and last used, and the usage of each cache type.
+
+  --json prints the entries grouped by type, each with its path, size,
+  creation and last use times, along with the size of each type and the
+  total size, for tooling.
+
+  --stats reports instead the number of entries and of unique blobs, the
+  logical size of the entries and the physical size of the files storing
+  them, entries hard linked to the same file being counted once, and the
+  largest entries.`
 	CacheListExample string = `
   All group commands have their own help output:
 
   $ singularity help cache list
   $ singularity help cache list --type=library,oci
-  $ singularity cache list --help`
+  $ singularity cache list --help
+
+  Show the space saved by deduplication and the largest entries:
+
+  $ singularity cache list --stats
+
+  List the entries in JSON format:
+
+  $ singularity cache list --json`
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// Cache Verify
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	CacheVerifyUse   string = `verify [verify options...]`
+	CacheVerifyShort string = `Verify the integrity of your local Singularity cache`
+	CacheVerifyLong  string = `
+  This will recompute the hash of every library image in your local cache
+  (stored at $HOME/.singularity/cache if SINGULARITY_CACHEDIR is not set) and
+  report the entries which don't match the hash they were cached under. Use
+  --fix to remove them, they will be downloaded again on the next pull. The
+  command exits with a non-zero status if corrupted entries are left.`
+	CacheVerifyExample string = `
+  $ singularity cache verify
+  $ singularity cache verify --fix
+  $ singularity cache verify --json`
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// Cache Migrate
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	CacheMigrateUse   string = `migrate [migrate options...]`
+	CacheMigrateShort string = `Migrate your local Singularity cache to the current layout`
+	CacheMigrateLong  string = `
+  Older versions of Singularity stored each cache entry in a directory named
+  after its hash, these entries are removed when accessed by this version.
+  This will move them to the current layout instead, so that they don't have
+  to be downloaded again. The hash of library and oras images is verified
+  first, corrupted entries are skipped. Entries already using the current
+  layout are left untouched, the command can be run several times.`
+	CacheMigrateExample string = `
+  $ singularity cache migrate --dry-run
+  $ singularity cache migrate`
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// Cache Pin
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	CachePinUse   string = `pin [pin options...] <name>`
+	CachePinShort string = `Protect an entry of your local Singularity cache from cleaning`
+	CachePinLong  string = `
+  This will pin the image entry of your local cache named <name>, as shown by
+  'cache list --verbose', or whose name starts with it. Pinned entries are
+  kept by 'cache clean' unless --force is given, so that frequently needed
+  images don't have to be downloaded again. Use --type when a name prefix
+  matches entries of several cache types.`
+	CachePinExample string = `
+  $ singularity cache list --verbose --type library
+  $ singularity cache pin sha256.7f0d4c5cfb1e
+  $ singularity cache pin --type oci-tmp 3b1a`
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// Cache Unpin
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	CacheUnpinUse   string = `unpin [unpin options...] <name>`
+	CacheUnpinShort string = `Remove the protection of a pinned entry of your local Singularity cache`
+	CacheUnpinLong  string = `
+  This will unpin the entry of your local cache named <name>, or whose name
+  starts with it, so that it is removed by the next 'cache clean'.`
+	CacheUnpinExample string = `
+  $ singularity cache unpin sha256.7f0d4c5cfb1e`
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// Cache Status
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	CacheStatusUse   string = `status [status options...] <URI>`
+	CacheStatusShort string = `Tell whether an image is in your local Singularity cache`
+	CacheStatusLong  string = `
+  This will resolve the image <URI> as 'singularity pull' does, only
+  requesting its metadata from the remote, and report whether that exact
+  image is in your local cache, along with the path and size of its entry.
+  A cached image is copied from the cache by the next pull instead of being
+  downloaded. The --arch, --library and OCI build options select the entry
+  as for a pull.`
+	CacheStatusExample string = `
+  $ singularity cache status library://alpine:latest
+  $ singularity cache status --arch arm64 --json library://org/collection/image:1.0
+  $ singularity cache status docker://alpine`
 
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// key
@@ -573,20 +681,404 @@ Enterprise Performance Computing (EPC)`
   The 'pull' command allows you to download or build a container from a given
   URI. Supported URIs include:
 
-  library: Pull an image from the currently configured library
+  library: Pull an image from the currently configured library, with the
+  token of the remote unless --library-auth-file names a token file to use
       library://user/collection/container[:tag]
+      library://user/collection/container@sha256:<digest>
+  or from the library at the host of the URI, which takes precedence over
+  --library and the remote and isn't sent their token. The first component
+  is the host when it has a dot or a port, or is localhost:
+      library://host[:port]/user/collection/container[:tag]
 
   docker: Pull an image from Docker Hub
       docker://user/image:tag
+
+  docker-daemon: Pull an image from the local Docker daemon
+      docker-daemon:image:tag
+
+  podman: Pull an image from the local, possibly rootless, Podman storage
+      podman://localhost/image:tag
     
   shub: Pull an image from Singularity Hub
       shub://user/image:tag
 
-  oras: Pull a SIF image from a supporting OCI registry
+  oras: Pull a SIF image from a supporting OCI registry, e.g. Harbor or
+  GHCR, authenticating as with docker:// and over plain http with --nohttps
       oras://registry/namespace/image:tag
 
   http, https: Pull an image using the http(s?) protocol
-      https://library.sylabs.io/v1/imagefile/library/default/alpine:latest`
+      https://library.sylabs.io/v1/imagefile/library/default/alpine:latest
+
+  scp: Copy an image over SSH from a host
+      scp://user@host:/path/image.sif
+
+  Use 'singularity pull --list-transports' for the full list of supported
+  transports.
+
+  A destination, or --output, of - writes the image to stdout once pulled
+  and verified, for piping it to another command. stdout then only holds
+  the image bytes, the messages going to stderr without progress bar. Only
+  the SIF images of the library, shub, oras, http(s) and scp transports can
+  be pulled to stdout, the OCI ones being built rather than downloaded.
+
+  A library image pinned by @sha256:<digest>, the sha256 hash of the SIF
+  file, is downloaded without resolving any tag, and the pull fails, the
+  downloaded file being removed, unless its hash matches the digest.
+
+  With --from-file or --from-stdin, up to --jobs images, or --concurrency,
+  4 by default, are pulled at a time, each one through the cache. An image
+  failing to pull doesn't stop the others, the failures are reported once
+  all are done and make the command exit with an error.
+
+  With --from-file or --from-stdin, --manifest-out lists the pulled images in
+  the given file, one per line with the URI, the path and the sha256 hash of
+  the image separated by tabs. Images that failed to pull are listed in
+  comment lines starting with '# failed:' and the file ends with a summary
+  comment. As comments and anything following the URI are ignored, the
+  manifest can be passed back to --from-file.
+
+  The list given to --from-file or --from-stdin can also be a YAML or JSON
+  file, detected from its .yaml, .yml or .json extension or from its content,
+  setting per image the destination file name, the architecture of library
+  images, the expected sha256 hash and the fingerprint of the key that must
+  have signed it. The whole list is validated before any image is pulled:
+
+      images:
+        - uri: library://alpine:3.11
+          name: alpine-arm64.sif
+          arch: arm64
+          sha256: 7f0d4c5cfb1e9f6a06a5a1d6b8e5b26a4c1e1f4fd0cd24e1a1ce2d0b3f0cbe33
+          signFingerprint: 8883491F4268F173C6E5DC49446946928C851A55
+        - uri: docker://busybox:latest
+
+  --policy enforces a content trust policy, read from a YAML or JSON file,
+  on the pulled images whatever their transport. Each rule applies to the
+  URIs starting with its prefix, the longest matching prefix wins:
+
+      rules:
+        - prefix: library://
+          verify: true
+        - prefix: library://sylabs/
+          verify: true
+          keys: [8883491F4268F173C6E5DC49446946928C851A55]
+          keyserver: https://keys.sylabs.io
+        - prefix: docker://
+          verify: false
+
+  When verify is true the image must be a SIF image whose signatures are
+  valid, signed by one of the keys if any are listed. The keyserver, if
+  set, is used instead of the default one. A pulled image violating the
+  policy is removed. The prefixes are matched against both the URI as given
+  and its canonical form, e.g. library://library/default/alpine:latest for
+  alpine.
+
+  Signatures are verified by default for library images only, unsigned
+  ones producing a warning. The images of the other transports, such as
+  http, https or shub, are pulled as with --allow-unauthenticated.
+  --require-signature makes the pull fail unless the image, whatever its
+  transport, has valid signatures. A policy rule matching the image
+  overrides both the transport default and --require-signature.
+
+  An unsigned image is handled in one of three mutually exclusive ways: by
+  default it is pulled with a warning, --allow-unauthenticated skips the
+  verification altogether and --fail-on-unsigned makes it a hard error,
+  whatever the transport or policy, removing the image and exiting with
+  code 3. --fail-on-unsigned never asks, so suits scripts and CI jobs.
+
+  --verify and --no-verify state the intent explicitly: --verify is the same
+  as --require-signature, and --no-verify, of which --allow-unauthenticated
+  is now an alias, pulls library images without verifying them, as needed
+  for images which aren't SIF files. A policy rule requiring verification
+  still applies with --no-verify.
+
+  Administrators set the default with the 'pull unsigned' directive of
+  singularity.conf, which the flags can only make stricter: prompt, the
+  default, keeps the behaviour above; allow acts as --allow-unauthenticated
+  unless --fail-on-unsigned or --require-signature is given; deny acts as
+  --fail-on-unsigned for every pull and rejects --allow-unauthenticated.
+
+  --verify-fingerprint requires the pulled image, whatever its transport, to
+  have valid signatures including one by the key with the given 40
+  characters fingerprint. It can be repeated to accept any of several keys.
+  An image failing the check is removed.
+
+  --keyserver sets the key servers the signatures are verified against,
+  instead of the one of the remote. It can be comma separated or repeated:
+  the keys missing locally are fetched from the first key server returning
+  them, the failures of the others are reported as warnings and the
+  signature is only unverifiable when all of them fail. The keyserver of a
+  policy rule can also list several key servers separated by commas. When
+  none of them can be reached, the warning says so rather than reporting
+  the image as unsigned.
+
+  Images are downloaded into the cache as partial files, named after the
+  entry with a .part suffix, renamed to the entry once complete and
+  verified. When a pull fails, the partial file is removed, unless
+  --preserve-cache-on-error is set to keep it for inspection. An interrupt
+  with Ctrl-C cancels the download and goes through the same cleanup, a
+  second Ctrl-C quitting without waiting for it to finish. Partial files,
+  including those left by a killed process, are never used as cache
+  entries and are removed by 'singularity cache clean'.
+
+  Library images are the exception: an interrupted or failed download is
+  kept as <hash>.part in the cache and the next pull of the image resumes it
+  with an HTTP range request, restarting from scratch if the library doesn't
+  serve ranges. A resumed download whose hash doesn't match is removed.
+
+  --cache-readonly uses a cache that can't be written, e.g. shared by the
+  nodes of a cluster through a read-only mount: cached images are copied from
+  it, the others are downloaded directly to the destination and verified
+  against their hash, without creating any cache entry, partial file or
+  lease. OCI images missing from the cache are built without caching their
+  layers either.
+
+  --no-cache, or --disable-cache, bypasses the cache entirely, e.g. when the
+  cache directory is on a small partition: the image is downloaded straight
+  to its destination, where its hash and signatures are verified, instead of
+  being written to the cache and copied out of it.
+
+  When the cache directory can't be created or written to, e.g. because of
+  its permissions or a full disk, pull warns and carries on without the
+  cache, as with --disable-cache: the image is downloaded and verified
+  straight into its destination.
+
+  The global --non-interactive flag, or --interactive=false, disables all
+  the prompts: pull aborts instead, e.g. with an error listing the available
+  images when the requested tag or architecture doesn't exist. Selection
+  prompts also abort when stdin isn't a terminal, while --docker-login only
+  aborts when prompts are explicitly disabled, as credentials may be piped.
+
+  --tmpfs keeps the pulled image off persistent storage: the cache is
+  bypassed and the temporary files of the pull are written to --tmpdir if
+  it is a tmpfs, to /dev/shm otherwise, and removed on exit or interrupt.
+  The destination must be on a tmpfs, images pulled without destination nor
+  --dir are saved to that tmpfs. With the run, exec, shell, test and
+  instance start commands the image is removed once the container exits.
+
+  Each pull reports the bytes downloaded and served from the cache, its
+  duration and the average download throughput. Images served from the
+  cache show no bytes downloaded. With --json, this summary is also printed
+  to stdout as a JSON object per image pulled, along with the resolved URI,
+  its transport and the signature status of the image: verified, unsigned
+  or unverified when nothing required its signatures to be checked. The
+  fingerprint and identity of the key of each signer of a verified image
+  are logged, and listed as signers in the JSON summary. The user is never
+  prompted with --json, e.g. to select one of several search
+  matches, the pull failing instead, and no progress bar is drawn, so that
+  stdout only holds the summary.
+
+  Downloads from the library, http(s) and shub show a progress bar with the
+  bytes transferred, the percentage, the transfer rate and the remaining
+  time when stdout is a terminal, or a spinner with the bytes transferred
+  and the rate when the server doesn't send the size of the image.
+
+  --trace breaks the single pull down into its phases: the resolution of
+  the URI, the library metadata request, the cache lookup, the download,
+  the hash verification, the copy from the cache to the destination and the
+  signature verification. The start and duration of each phase recorded is
+  printed as a table to stderr once the image is pulled, or in the trace of
+  the --json summary, telling whether the network, the disk or the
+  verification is slow. Library pulls record all the phases, other images
+  being traced as a single download.
+
+  scp images are copied with the scp program of the host, which must be
+  installed there, authenticating with the keys of the SSH agent and the
+  --identity key, or ~/.ssh/id_ed25519, id_ecdsa and id_rsa without it. The
+  host key must already be recorded in ~/.ssh/known_hosts or
+  /etc/ssh/ssh_known_hosts. The path is relative to the home directory of
+  the user unless absolute, and a port can follow the host, as in
+  scp://user@host:2222:/path/image.sif. These images are not cached.
+
+  --checksum, or its alias --digest, removes the pulled image unless its
+  sha256 hash is the given one. http(s) and shub images are checked as
+  downloaded, before they are cached, so that a truncated or tampered
+  download never makes it into the cache.
+
+  --explain describes how the image would be pulled, step by step: how the
+  URI was split into transport and reference, the client handling the
+  transport, the registry mirror and allowed hosts, the destination and its
+  default name, the cache entry and whether it is already there, and the
+  verification applied. Nothing is downloaded, only the metadata locating
+  the cache entry is requested from the remote.
+
+  --dry-run resolves the images, their destinations and credentials as a
+  pull would, then lists each of them on one line with its destination and
+  whether its cache entry is already there, without downloading or writing
+  any image. It also applies to --from-file and --from-stdin, where
+  --explain can't be used, and fails if any image would fail to be pulled.
+
+  --deffile-only writes the definition file the image was built from to the
+  destination, or to stdout when none is given, instead of the image. The
+  full image is still downloaded and verified, and the pull fails if the
+  image holds no definition file.
+
+  --on-conflict sets what happens when the image file already exists: the
+  pull fails by default, "overwrite" replaces the file as --force does,
+  "rename" pulls to the first free name with a numeric suffix, as
+  image-1.sif, and "skip" succeeds without pulling anything.
+
+  A destination which is a symbolic link, even dangling, already exists:
+  overwriting it replaces the link itself once the image is pulled, a failed
+  pull leaving the link in place. Its target is never written to unless
+  --follow-symlink is given, the image then being pulled to the
+  target of the link.
+
+  --if-not-present does nothing and succeeds if the image file already
+  exists, before any request is made: unlike "--on-conflict skip", neither
+  the library nor the registry is contacted, e.g. to resolve the image.
+  Whatever the file holds is kept, a newer image upstream is therefore not
+  detected, which is the point for provisioning scripts running pull
+  unconditionally.
+
+  --socks5 makes the library, http(s), shub and oras pulls, and the key
+  servers, connect through a SOCKS5 proxy, given as
+  [user[:password]@]host:port. It takes precedence over the HTTP_PROXY,
+  HTTPS_PROXY and NO_PROXY environment variables, which are ignored: every
+  connection goes through the SOCKS5 proxy, TLS being negotiated with the
+  remote host through it. The --connect-timeout applies to the connection
+  to the proxy. scp pulls are not proxied, and docker:// pulls fail with
+  --socks5 as containers/image only reads the proxy from the environment,
+  e.g. HTTPS_PROXY=socks5://host:port.
+
+  --retries retries the library and http(s) downloads failing with a
+  connection reset, a 5xx server error or a response cut short, up to the
+  given number of times, resuming from the bytes already downloaded when the
+  server supports range requests. --retry-delay is the delay before the
+  first retry, doubled after each one. Authentication failures and missing
+  images (401, 403 and 404) are not retried. The final error states the
+  number of attempts made.
+
+  --stream-count splits the download of a library image into up to the
+  given number of byte ranges fetched concurrently, 4 by default, for the
+  images of at least 32MiB when the library serves ranges. The image is
+  downloaded in a single stream otherwise, or with --stream-count 1. A range
+  served with a sha-256 Content-Digest is checked as it lands, a corrupt one
+  being fetched again alone. The reassembled image is checked against its
+  library hash.
+
+  --local-keyring verifies the signatures against the public keys of a
+  keyring file, as written by 'singularity key export', before the local
+  keyring and the key servers. Images signed by these keys are verified
+  without any network access, for air-gapped systems.
+
+  --rekor takes the URL of a Rekor transparency log the signature of the
+  pulled image must be recorded in: once the signatures are verified, the
+  log is searched for a PGP entry of the sha256 hash of the image signed by
+  one of its signers, and the pull fails without one. The error tells
+  whether the signature verification or the transparency log lookup
+  failed. --skip-rekor skips the lookup with a warning, e.g. offline.
+
+  The layers of docker:// images are kept in the blob cache as they are
+  downloaded. When a pull fails, retrying it skips the layers already
+  downloaded and resumes the interrupted ones where they stopped, for the
+  registries supporting range requests. The digest of each layer is
+  verified before it is used, a corrupted layer being downloaded again.
+
+  --report-to posts an anonymized JSON event to the given URL once the pull
+  finished, defaulting to the 'pull report url' of singularity.conf: the
+  transport, the size range of the image, the duration, whether the pull
+  succeeded and whether the cache was hit. Neither the image nor any
+  credentials are sent, unless --report-image-names or 'pull report image
+  names = yes' adds the image, without its credentials. Reporting gives up
+  after 2 seconds, failures only producing a warning.
+
+  --arch-fallback takes an ordered list of architectures, the library or OCI
+  image being pulled for the first one it is available for, as listed by
+  the library or the manifest list of the image. The chosen architecture is
+  logged, and the pull fails listing the available ones if none matches. It
+  replaces --arch, which can't be used with it.
+
+  When --arch is given and no destination is, the default name of library
+  and OCI images ends with the architecture, e.g. ubuntu_latest_arm64.sif,
+  so that pulling several architectures of an image doesn't overwrite the
+  same file. Without --arch the default name is unchanged.
+
+  Without --arch nor --arch-fallback, library images are pulled for the
+  default architecture of their entity or collection when the 'pull
+  collection arch' directive of singularity.conf sets one, e.g.
+  'myorg/arm-builds=arm64', the longest matching prefix applying, and for
+  the host architecture otherwise. The default name is unchanged.
+
+  --expected-arch asserts the architecture of the pulled image rather than
+  selecting it as --arch does: once downloaded, the system partitions of
+  the SIF image are read and the pull fails, removing the image, unless one
+  of them is for the given architecture, 'host' standing for the host one.
+  It catches a mislabeled image that would otherwise be accepted.
+
+  Library and OCI images pulled for an architecture the host can run, the
+  host one by default, must also hold a system partition it can run: the
+  pull fails, removing the image, rather than the container failing later
+  with an exec format error. --allow-arch-mismatch keeps the image anyway.
+
+  --output-format saves the image as a SIF file (sif, the default), as a
+  sandbox directory holding its root filesystem (sandbox), or as a tarball
+  of its root filesystem (tar). The image is pulled as SIF, verified, then
+  extracted next to its destination, which is only replaced once the
+  extraction completed. The default name drops the .sif extension for a
+  sandbox, and ends with .tar for a tarball.
+
+  podman images are read through the Docker compatible API of the Podman
+  socket: the one of $CONTAINER_HOST if set, $XDG_RUNTIME_DIR/podman/podman.sock
+  for unprivileged users, which can be started with 'systemctl --user start
+  podman.socket', or /run/podman/podman.sock for root.
+
+  --scan runs a scanner over the pulled image before it is verified, e.g.
+  ClamAV through its daemon socket with --scan-command 'clamdscan --fdpass
+  --no-summary', the path of the image being appended to the command. The
+  image is removed and the pull fails unless the scanner exits with
+  --scan-clean-exit-code, 0 by default. The scanner and its clean exit code
+  default to 'pull scan command' and 'pull scan clean exit code' of
+  singularity.conf, where 'pull scan = yes' scans every pulled image with
+  them, --scan-command and --scan-clean-exit-code being rejected.
+
+  --download-only downloads the image to the cache without saving it
+  anywhere else, and prints the path of its cache entry. The image goes
+  through the same checks as when pulled to a destination: its hash,
+  --checksum, its signatures, --require-signature, --policy and
+  --verify-fingerprint. The network cost is paid once, later commands using
+  the image being served from the cache. scp images, which are not cached,
+  can't be downloaded this way.
+
+  --attestation-out writes a JSON attestation of the pulled image once its
+  signatures are verified: the URI, path, architecture and sha256 hash of
+  the image, the fingerprints of its signers, the key server and the time
+  of the verification. The pull fails if the image has no verified
+  signature. With --sign-key, the attestation is clearsigned with the first
+  private key of the given key file, as exported by 'singularity key
+  export --secret --armor'.
+
+  --copy-method selects how images are copied from the cache to their
+  destination. With auto, the default, an image is cloned as a reflink when
+  the cache and the destination are on the same filesystem supporting it,
+  such as Btrfs or XFS, else copied in the kernel with copy_file_range,
+  else streamed. reflink fails where reflinks are not supported, stream
+  always streams the image as previous versions did.
+
+  --search searches the library for a term instead of taking the URI of
+  the image, the only argument being the optional destination. The
+  matching containers are listed with their description, and pulled if
+  there is only one. When several match, the first one is pulled with
+  --take-first, otherwise the user is asked to select one if interactive,
+  and the pull fails if not.
+
+  --dedup saves space when the images pulled with --from-file or
+  --from-stdin hold identical content, e.g. several tags of the same image:
+  once all of them are written, the images whose sha256 hash matches the one
+  of a previous image are replaced with a hardlink to it, and the space
+  saved is reported. Images on another filesystem are kept as copies.
+
+  Aliases are shortnames expanded to full image URIs, similar to the
+  shortnames of the containers registries.conf. They are read from the
+  pull-aliases.yaml file of the singularity configuration directory and
+  of the user one, ~/.singularity, the user aliases overriding the system
+  ones:
+
+    aliases:
+      tools: library://myorg/prod/tools:stable
+
+  An image argument matching an alias, with or without the library://
+  transport, is pulled from the URI it expands to, any other image being
+  pulled as is. --no-alias disables the expansion.`
 	PullExample string = `
   From Sylabs cloud library
   $ singularity pull alpine.sif library://alpine:latest
@@ -594,11 +1086,207 @@ Enterprise Performance Computing (EPC)`
   From Docker
   $ singularity pull tensorflow.sif docker://tensorflow/tensorflow:latest
 
+  From Docker, into a compact image
+  $ singularity pull --squash tensorflow.sif docker://tensorflow/tensorflow:latest
+
+  From the local Docker daemon
+  $ singularity pull myimage.sif docker-daemon:myimage:latest
+
+  From the rootless Podman storage of the user
+  $ singularity pull myimage.sif podman://localhost/myimage:latest
+
   From Shub
   $ singularity pull singularity-images.sif shub://vsoch/singularity-images
 
   From supporting OCI registry (e.g. Azure Container Registry)
-  $ singularity pull image.sif oras://<username>.azurecr.io/namespace/image:tag`
+  $ singularity pull image.sif oras://<username>.azurecr.io/namespace/image:tag
+
+  Pull the images listed in a file, 4 at a time
+  $ singularity pull --from-file images.txt --jobs 8 --dir /data/images
+
+  Pull the images of a YAML list, checking their hash and signer
+  $ singularity pull --from-file images.yaml --dir /data/images
+
+  Pull the images read from stdin
+  $ grep docker:// images.txt | singularity pull --from-stdin --dir /data/images
+
+  Pull the images listed in a file, hardlinking the identical ones
+  $ singularity pull --from-file images.txt --dedup --dir /data/images
+
+  Pull the images listed in a file and record their hash
+  $ singularity pull --from-file images.txt --manifest-out checksums.txt
+
+  Pull an image in CI, aborting instead of prompting
+  $ singularity --non-interactive pull library://alpine
+
+  Pull an image into memory, without it touching persistent storage
+  $ singularity pull --tmpfs /dev/shm/alpine.sif docker://alpine
+
+  Pull an image only if signed by a given key
+  $ singularity pull --verify-fingerprint 8883491F4268F173C6E5DC49446946928C851A55 library://alpine
+
+  Pull an image, printing its transfer summary in JSON format
+  $ singularity pull --json alpine.sif library://alpine:latest
+
+  Pull an image to stdout, e.g. to upload it
+  $ singularity pull - library://alpine:latest | ssh host 'cat > alpine.sif'
+
+  Pull an image, printing the duration of each of its phases
+  $ singularity pull --trace alpine.sif library://alpine:latest
+
+  Pull an image verified against a primary and a backup key server
+  $ singularity pull --keyserver https://keys.example.com --keyserver https://keys.sylabs.io alpine.sif library://alpine:latest
+
+  Pull an image, keeping the partial cache file if the download fails
+  $ singularity pull --preserve-cache-on-error alpine.sif library://alpine:latest
+
+  Copy an image over SSH, checking its hash
+  $ singularity pull --identity ~/.ssh/hpc_ed25519 --checksum sha256:7f0d... image.sif scp://user@hpc.example.com:/data/image.sif
+
+  Explain how an image would be pulled, without pulling it
+  $ singularity pull --explain docker://alpine
+
+  List the images of a file that would be pulled, and which are cached
+  $ singularity pull --dry-run --from-file images.txt
+
+  Print the definition file a library image was built from
+  $ singularity pull --deffile-only library://alpine:latest
+
+  Pull an image without replacing an existing one, as alpine-1.sif
+  $ singularity pull --on-conflict rename alpine.sif library://alpine:latest
+
+  Search the library for an image and pull it
+  $ singularity pull --search alpine
+
+  Pull the image the alias tools of pull-aliases.yaml expands to
+  $ singularity pull tools
+
+  Pull an image unless the file is already there, without any request
+  $ singularity pull --if-not-present alpine.sif library://alpine:latest
+
+  Pull an image through an authenticated SOCKS5 proxy
+  $ singularity pull --socks5 user:password@proxy.example.com:1080 docker://alpine
+
+  Verify an image against a pre-distributed set of trusted keys
+  $ singularity pull --local-keyring /etc/singularity/trusted.asc --verify-fingerprint 8883491F4268F173C6E5DC49446946928C851A55 image.sif oras://registry.example.com/image:latest
+
+  Pull an image whose signature is recorded in a transparency log
+  $ singularity pull --rekor https://rekor.sigstore.dev image.sif oras://registry.example.com/image:latest
+
+  Pull the arm64 image, or the amd64 one if there is none for arm64
+  $ singularity pull --arch-fallback arm64,amd64 docker://alpine
+
+  Pull an image, failing unless it is for the host architecture
+  $ singularity pull --expected-arch host library://alpine
+
+  Pull the arm64 image of a multi-arch OCI image, ubuntu_latest_arm64.sif
+  $ singularity pull --arch arm64 docker://ubuntu
+
+  Pull an image to a sandbox directory, alpine_latest
+  $ singularity pull --output-format sandbox docker://alpine
+
+  Pull an untrusted image, removing it if ClamAV detects a threat
+  $ singularity pull --scan --scan-command 'clamdscan --fdpass --no-summary' https://example.com/image.sif
+
+  Pull an image through a shared read-only cache
+  $ SINGULARITY_CACHEDIR=/shared/cache singularity pull --cache-readonly library://alpine:latest
+
+  Download an image to the cache only, for later commands
+  $ singularity pull --download-only library://alpine:latest
+
+  Pull an image from a URL, failing unless it is signed
+  $ singularity pull --require-signature https://example.com/image.sif
+
+  Pull an image, exiting with code 3 unless it is signed
+  $ singularity pull --fail-on-unsigned library://alpine:latest
+
+  Pull an image complying with a content trust policy
+  $ singularity pull --policy /etc/singularity/pull-policy.yaml library://alpine
+
+  Pull a verified image and record a signed attestation of its verification
+  $ singularity pull --attestation-out alpine.att --sign-key ci-key.asc library://alpine:latest
+
+  List the supported transports in JSON format
+  $ singularity pull --list-transports --json
+
+  Mirror all the images of a library entity, 4 at a time
+  $ singularity pull mirror --jobs 4 library://myorg/ /data/mirror`
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// pull mirror
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	PullMirrorUse   string = `mirror [mirror options...] <library://entity[/collection]> [directory]`
+	PullMirrorShort string = `Pull all the images of a library namespace`
+	PullMirrorLong  string = `
+  The 'pull mirror' command pulls every tagged image of a library entity or
+  collection, for all their architectures, into a directory tree laid out as
+  <directory>/<collection>/<container>/<tag>_<arch>.sif, the current
+  directory by default.
+
+  The images are pulled through the cache and verified as with 'pull
+  --from-file', up to --jobs at a time. A mirror can be resumed or updated
+  by running the command again: images whose file already has the hash
+  reported by the library are skipped, the others are pulled again.
+  --dry-run lists what would be pulled or skipped without pulling anything.
+  --dedup replaces the mirrored images identical to another one, e.g. tags
+  of the same image, with hardlinks to it.
+
+  Once done, the reference, path and hash of each image are written to
+  --manifest-out, <directory>/mirror-manifest.txt by default.`
+	PullMirrorExample string = `
+  Mirror all the collections of an entity
+  $ singularity pull mirror library://myorg/ /data/mirror
+
+  Mirror a collection, 4 images at a time
+  $ singularity pull mirror --jobs 4 library://myorg/tools /data/mirror
+
+  List what an update of the mirror would pull
+  $ singularity pull mirror --dry-run library://myorg/ /data/mirror`
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// pull check
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	PullCheckUse   string = `check [check options...]`
+	PullCheckShort string = `Check that the library, key servers and registries can be reached`
+	PullCheckLong  string = `
+  The 'pull check' command checks the pull path of the node without
+  downloading any image: the configured library, or the one set with
+  --library, the key servers, or the ones set with --keyserver, and the
+  docker registry given with --registry, e.g. docker.io.
+
+  Each endpoint is reported reachable if it answers any HTTP response,
+  including an authentication error, along with the status code, the
+  validity of its TLS certificate and its expiry date, and the latency of
+  the request. The command fails if any endpoint is not reachable, so that
+  it can be used as a readiness probe, --json printing the results in JSON
+  format for alerting integration.`
+	PullCheckExample string = `
+  $ singularity pull check
+  $ singularity pull check --registry docker.io --json`
+
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// pull diff
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	PullDiffUse   string = `diff [diff options...] <library://image> <library://image>`
+	PullDiffShort string = `Compare two library images`
+	PullDiffLong  string = `
+  The 'pull diff' command tells whether two library images, e.g. two tags
+  of an image, are the same image. Both references are resolved for --arch,
+  the host architecture by default, and the hashes reported by the library
+  are compared without downloading anything.
+
+  With --deep, images whose hashes differ are pulled through the cache and
+  their SIF descriptors compared by ID, each one added, removed, or changed
+  in its data type, name, partition information or content being listed.
+
+  The command exits with code 0 if the images are identical and 1 if they
+  differ.`
+	PullDiffExample string = `
+  Check whether the latest tag moved since 1.0
+  $ singularity pull diff library://myorg/tools/app:1.0 library://myorg/tools/app:latest
+
+  List the descriptors which changed
+  $ singularity pull diff --deep library://myorg/tools/app:1.0 library://myorg/tools/app:1.1`
 
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// push
@@ -724,9 +1412,14 @@ Enterprise Performance Computing (EPC)`
   multiple data objects signed. By default the command searches for the primary 
   partition signature. If found, a list of all verification blocks applied on 
   the primary partition is gathered so that data integrity (hashing) and 
-  signature verification is done for all those blocks.`
+  signature verification is done for all those blocks. The --url option
+  accepts a comma separated list of key servers, tried in order until one
+  returns the signing key.`
 	VerifyExample string = `
-  $ singularity verify container.sif`
+  $ singularity verify container.sif
+
+  Verify against a primary key server, falling back on a backup one
+  $ singularity verify --url https://keys.example.com,https://keys.sylabs.io container.sif`
 
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// Run-help
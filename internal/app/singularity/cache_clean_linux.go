@@ -19,11 +19,11 @@ var (
 
 // cleanCache cleans the given type of cache cacheType. It will return a
 // error if one occurs.
-func cleanCache(imgCache *cache.Handle, cacheType string, dryRun bool, days int) error {
+func cleanCache(imgCache *cache.Handle, cacheType string, dryRun bool, days int, removePinned bool) error {
 	if imgCache == nil {
 		return fmt.Errorf("invalid image cache handle")
 	}
-	return imgCache.CleanCache(cacheType, dryRun, days)
+	return imgCache.CleanCache(cacheType, dryRun, days, removePinned)
 }
 
 // CleanSingularityCache is the main function that drives all these
@@ -31,8 +31,9 @@ func cleanCache(imgCache *cache.Handle, cacheType string, dryRun bool, days int)
 // provide a summary of what would have been done. If cacheCleanTypes
 // contains something, only clean that type. The special value "all" is
 // interpreted as "all types of entries". If cacheName contains
-// something, clean only cache entries matching that name.
-func CleanSingularityCache(imgCache *cache.Handle, dryRun bool, cacheCleanTypes []string, days int) error {
+// something, clean only cache entries matching that name. Pinned entries are
+// kept unless removePinned is true.
+func CleanSingularityCache(imgCache *cache.Handle, dryRun bool, cacheCleanTypes []string, days int, removePinned bool) error {
 	if imgCache == nil {
 		return errInvalidCacheHandle
 	}
@@ -48,10 +49,36 @@ func CleanSingularityCache(imgCache *cache.Handle, dryRun bool, cacheCleanTypes
 
 	for _, cacheType := range cachesToClean {
 		sylog.Debugf("Cleaning %s cache...", cacheType)
-		if err := cleanCache(imgCache, cacheType, dryRun, days); err != nil {
+		if err := cleanCache(imgCache, cacheType, dryRun, days, removePinned); err != nil {
 			return err
 		}
 	}
 
 	return nil
 }
+
+// EvictSingularityCache removes the least recently used entries of the
+// cacheCleanTypes caches, or of all of them if empty or containing "all",
+// until they use at most maxSize bytes. The entries older than days, unless
+// negative, are expected to be removed by CleanSingularityCache. Pinned
+// entries are kept unless removePinned is true. With dryRun the entries are
+// only listed.
+func EvictSingularityCache(imgCache *cache.Handle, dryRun bool, cacheCleanTypes []string, maxSize int64, days int, removePinned bool) error {
+	if imgCache == nil {
+		return errInvalidCacheHandle
+	}
+
+	var cacheTypes []string
+	if len(cacheCleanTypes) > 0 && !stringInSlice("all", cacheCleanTypes) {
+		cacheTypes = cacheCleanTypes
+	}
+
+	evicted, err := imgCache.Evict(maxSize, days, dryRun, removePinned, cacheTypes...)
+	if err != nil {
+		return err
+	}
+	if len(evicted) == 0 {
+		sylog.Infof("The cache uses at most %d bytes, no entry to remove", maxSize)
+	}
+	return nil
+}
@@ -7,10 +7,8 @@ package singularity
 
 import (
 	"fmt"
-	"io/ioutil"
-	"os"
-	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/sylabs/singularity/internal/pkg/cache"
 )
@@ -41,17 +39,10 @@ func findSize(size int64) string {
 // listTypeCache will list a cache type with given name (cacheType). The options are 'library', and 'oci'.
 // Will return: the number of containers for that type (int), the total space the container type is using (int64),
 // and an error if one occurs.
-func listTypeCache(printList bool, name, cachePath string) (int, int64, error) {
-	_, err := os.Stat(cachePath)
-	if os.IsNotExist(err) {
-		return 0, 0, nil
-	} else if err != nil {
-		return 0, 0, fmt.Errorf("unable to open cache %s at directory %s: %v", name, cachePath, err)
-	}
-
-	cacheEntries, err := ioutil.ReadDir(cachePath)
+func listTypeCache(imgCache *cache.Handle, printList bool, cacheType string) (int, int64, error) {
+	cacheEntries, err := imgCache.ListEntries(cacheType)
 	if err != nil {
-		return 0, 0, fmt.Errorf("unable to open cache %s at directory %s: %v", name, cachePath, err)
+		return 0, 0, err
 	}
 
 	var (
@@ -61,13 +52,19 @@ func listTypeCache(printList bool, name, cachePath string) (int, int64, error) {
 	for _, entry := range cacheEntries {
 
 		if printList {
-			fmt.Printf("%-24.22s %-22s %-16s %s\n",
-				entry.Name(),
-				entry.ModTime().Format("2006-01-02 15:04:05"),
-				findSize(entry.Size()),
-				name)
+			pinned := ""
+			if entry.Pinned {
+				pinned = "yes"
+			}
+			fmt.Printf("%-24.22s %-22s %-22s %-16s %-10s %s\n",
+				entry.Name,
+				entry.ModTime.Format("2006-01-02 15:04:05"),
+				entry.AccessTime.Format("2006-01-02 15:04:05"),
+				findSize(entry.Size),
+				cacheType,
+				pinned)
 		}
-		totalSize += entry.Size()
+		totalSize += entry.Size
 	}
 
 	return len(cacheEntries), totalSize, nil
@@ -89,11 +86,13 @@ func ListSingularityCache(imgCache *cache.Handle, cacheListTypes []string, cache
 	)
 
 	if cacheListVerbose {
-		fmt.Printf("%-24s %-22s %-16s %s\n", "NAME", "DATE CREATED", "SIZE", "TYPE")
+		fmt.Printf("%-24s %-22s %-22s %-16s %-10s %s\n", "NAME", "DATE CREATED", "LAST USED", "SIZE", "TYPE", "PINNED")
 	}
 
 	containersShown := false
 	blobsShown := false
+	// the usage of each cache type, shown with the entries
+	var typeUsage strings.Builder
 
 	// If types requested includes "all" then we don't want to filter anything
 	if stringInSlice("all", cacheListTypes) {
@@ -107,17 +106,13 @@ func ListSingularityCache(imgCache *cache.Handle, cacheListTypes []string, cache
 		if len(cacheListTypes) > 0 && !stringInSlice(cacheType, cacheListTypes) {
 			continue
 		}
-		cacheDir, err := imgCache.GetOciCacheDir(cacheType)
-		if err != nil {
-			return err
-		}
-		cacheDir = filepath.Join(cacheDir, "blobs", "sha256")
-		blobsCount, blobsSize, err := listTypeCache(cacheListVerbose, cacheType, cacheDir)
+		blobsCount, blobsSize, err := listTypeCache(imgCache, cacheListVerbose, cacheType)
 		if err != nil {
 			fmt.Print(err)
 			return err
 		}
 		blobCount = blobsCount
+		fmt.Fprintf(&typeUsage, "%-10s %d entries using %s\n", cacheType+":", blobsCount, findSize(blobsSize))
 		blobSpace = blobsSize
 		totalSpace += blobsSize
 		blobsShown = true
@@ -126,23 +121,20 @@ func ListSingularityCache(imgCache *cache.Handle, cacheListTypes []string, cache
 		if len(cacheListTypes) > 0 && !stringInSlice(cacheType, cacheListTypes) {
 			continue
 		}
-		cacheDir, err := imgCache.GetFileCacheDir(cacheType)
-		if err != nil {
-			return err
-		}
-		count, size, err := listTypeCache(cacheListVerbose, cacheType, cacheDir)
+		count, size, err := listTypeCache(imgCache, cacheListVerbose, cacheType)
 		if err != nil {
 			fmt.Print(err)
 			return err
 		}
 		containerCount += count
+		fmt.Fprintf(&typeUsage, "%-10s %d entries using %s\n", cacheType+":", count, findSize(size))
 		containerSpace += size
 		totalSpace += size
 		containersShown = true
 	}
 
 	if cacheListVerbose {
-		fmt.Print("\n")
+		fmt.Print("\n" + typeUsage.String() + "\n")
 	}
 
 	out := new(strings.Builder)
@@ -164,6 +156,127 @@ func ListSingularityCache(imgCache *cache.Handle, cacheListTypes []string, cache
 	return nil
 }
 
+// CacheListEntry describes a cache entry listed with --json.
+type CacheListEntry struct {
+	// Name is the name of the entry, for most cache types the hash of its
+	// content.
+	Name string `json:"name"`
+	// Path is the location of the entry.
+	Path string `json:"path"`
+	// Size is the size of the entry in bytes.
+	Size int64 `json:"size"`
+	// Created is the time the entry was written.
+	Created time.Time `json:"created"`
+	// LastUsed is the time the entry was last pulled from the cache.
+	LastUsed time.Time `json:"lastUsed"`
+	// Pinned is true when the entry is protected from cache cleaning.
+	Pinned bool `json:"pinned"`
+}
+
+// CacheListType holds the entries of a cache type listed with --json.
+type CacheListType struct {
+	// Type is the cache type, e.g. library.
+	Type string `json:"type"`
+	// Size is the size of the entries in bytes.
+	Size int64 `json:"size"`
+	// Entries are the entries of the cache type.
+	Entries []CacheListEntry `json:"entries"`
+}
+
+// CacheListing is the listing of the local singularity cache, by type.
+type CacheListing struct {
+	// Size is the size of all the entries listed in bytes.
+	Size int64 `json:"size"`
+	// Types are the cache types listed.
+	Types []CacheListType `json:"types"`
+}
+
+// ListSingularityCacheEntries returns the entries of the local singularity
+// cache of the types specified by cacheListTypes, "all" meaning all of
+// them, grouped by type along with their total size.
+func ListSingularityCacheEntries(imgCache *cache.Handle, cacheListTypes []string) (*CacheListing, error) {
+	if imgCache == nil {
+		return nil, errInvalidCacheHandle
+	}
+
+	listing := &CacheListing{Types: []CacheListType{}}
+	for _, cacheType := range append(cache.FileCacheTypes, cache.OciCacheTypes...) {
+		if !stringInSlice("all", cacheListTypes) && !stringInSlice(cacheType, cacheListTypes) {
+			continue
+		}
+		entries, err := imgCache.ListEntries(cacheType)
+		if err != nil {
+			return nil, err
+		}
+
+		t := CacheListType{Type: cacheType, Entries: make([]CacheListEntry, 0, len(entries))}
+		for _, e := range entries {
+			t.Entries = append(t.Entries, CacheListEntry{
+				Name:     e.Name,
+				Path:     e.Path,
+				Size:     e.Size,
+				Created:  e.ModTime,
+				LastUsed: e.AccessTime,
+				Pinned:   e.Pinned,
+			})
+			t.Size += e.Size
+		}
+		listing.Size += t.Size
+		listing.Types = append(listing.Types, t)
+	}
+	return listing, nil
+}
+
+// cacheStatsTop is the number of largest entries shown by
+// ListSingularityCacheStats.
+const cacheStatsTop = 5
+
+// ListSingularityCacheStats will print the space used by the local
+// singularity cache for the types specified by cacheListTypes, "all" meaning
+// all of them, before and after deduplication of the entries sharing their
+// content, and its largest entries.
+func ListSingularityCacheStats(imgCache *cache.Handle, cacheListTypes []string) error {
+	if imgCache == nil {
+		return errInvalidCacheHandle
+	}
+
+	var types []string
+	if !stringInSlice("all", cacheListTypes) {
+		for _, cacheType := range append(cache.OciCacheTypes, cache.FileCacheTypes...) {
+			if stringInSlice(cacheType, cacheListTypes) {
+				types = append(types, cacheType)
+			}
+		}
+		if len(types) == 0 {
+			return fmt.Errorf("no valid cache type in %s", strings.Join(cacheListTypes, ","))
+		}
+	}
+
+	stats, err := imgCache.Stats(cacheStatsTop, types...)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Entries:        %d\n", stats.Entries)
+	fmt.Printf("Unique blobs:   %d\n", stats.UniqueBlobs)
+	fmt.Printf("Logical size:   %s\n", findSize(stats.LogicalSize))
+	fmt.Printf("Physical size:  %s\n", findSize(stats.PhysicalSize))
+	saved := 0.0
+	if stats.LogicalSize > 0 {
+		saved = 100 * float64(stats.Saved()) / float64(stats.LogicalSize)
+	}
+	fmt.Printf("Saved by dedup: %s (%.1f%%)\n", findSize(stats.Saved()), saved)
+
+	if len(stats.Top) > 0 {
+		fmt.Printf("\nTop space consumers:\n")
+		fmt.Printf("%-24s %-16s %s\n", "NAME", "SIZE", "TYPE")
+		for _, entry := range stats.Top {
+			fmt.Printf("%-24.22s %-16s %s\n", entry.Name, findSize(entry.Size), entry.Type)
+		}
+	}
+	return nil
+}
+
 func stringInSlice(a string, list []string) bool {
 	for _, b := range list {
 		if b == a {
@@ -0,0 +1,134 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/sylabs/scs-library-client/client"
+	"github.com/sylabs/singularity/internal/pkg/cache"
+	"github.com/sylabs/singularity/internal/pkg/client/oras"
+	"github.com/sylabs/singularity/internal/pkg/util/fs"
+	"github.com/sylabs/singularity/pkg/sylog"
+)
+
+// CacheMigrateResult holds the outcome of the migration of a cache entry
+// stored with the layout of older versions.
+type CacheMigrateResult struct {
+	// Name is the name of the entry, i.e. the hash it is cached under.
+	Name string `json:"name"`
+	// Type is the cache type of the entry.
+	Type string `json:"type"`
+	// Path is the location of the entry with the old layout.
+	Path string `json:"path"`
+	// Verified is true when the entry content matches its hash, entries
+	// of the cache types not named after a content hash can't be verified.
+	Verified bool `json:"verified"`
+	// Migrated is true when the entry was moved to the current layout.
+	Migrated bool `json:"migrated"`
+	// Error holds the reason the entry was skipped.
+	Error string `json:"error,omitempty"`
+}
+
+// cacheContentHash returns the function computing the hash an entry of
+// cacheType is named after, or nil if the name isn't a content hash.
+func cacheContentHash(cacheType string) func(string) (string, error) {
+	switch cacheType {
+	case cache.LibraryCacheType:
+		return client.ImageHash
+	case cache.OrasCacheType:
+		return oras.ImageHash
+	}
+	return nil
+}
+
+// MigrateSingularityCache moves the file cache entries stored by older
+// versions in a directory named after their hash, e.g. library/<hash>/<name>,
+// to the current layout where the entry is the file named after the hash.
+// The hash of the library and oras entries is verified first, corrupted
+// entries are skipped and removed on the next access. If dryRun is true
+// nothing is moved. Entries already using the current layout are ignored,
+// so that the migration can run several times. The result of each old layout
+// entry is returned, an error is only returned if the cache can't be read.
+func MigrateSingularityCache(imgCache *cache.Handle, dryRun bool) ([]CacheMigrateResult, error) {
+	if imgCache == nil {
+		return nil, errInvalidCacheHandle
+	}
+
+	var results []CacheMigrateResult
+	for _, cacheType := range cache.FileCacheTypes {
+		entries, err := imgCache.Entries(cacheType)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, entry := range entries {
+			if !fs.IsDir(entry.Path) {
+				continue
+			}
+
+			res := CacheMigrateResult{
+				Name: entry.Name,
+				Type: entry.Type,
+				Path: entry.Path,
+			}
+			if err := migrateCacheEntry(&res, dryRun); err != nil {
+				res.Error = err.Error()
+				sylog.Debugf("Skipping %s cache entry %s: %v", res.Type, res.Name, err)
+			}
+			results = append(results, res)
+		}
+	}
+
+	return results, nil
+}
+
+// migrateCacheEntry migrates the old layout entry described by res.
+func migrateCacheEntry(res *CacheMigrateResult, dryRun bool) error {
+	files, err := ioutil.ReadDir(res.Path)
+	if err != nil {
+		return fmt.Errorf("could not read directory: %v", err)
+	}
+	if len(files) != 1 || !files[0].Mode().IsRegular() {
+		return fmt.Errorf("expected a single file in the directory")
+	}
+	src := filepath.Join(res.Path, files[0].Name())
+
+	if hashFn := cacheContentHash(res.Type); hashFn != nil {
+		hash, err := hashFn(src)
+		if err != nil {
+			return fmt.Errorf("could not compute hash: %v", err)
+		}
+		if hash != res.Name {
+			return fmt.Errorf("hash mismatch (%s)", hash)
+		}
+		res.Verified = true
+	}
+
+	if dryRun {
+		return nil
+	}
+
+	// the file is moved out of the way while the directory taking its
+	// place is removed, with the prefix of in progress downloads so that
+	// it is ignored like them if interrupted
+	tmp := filepath.Join(filepath.Dir(res.Path), "tmp_migrate_"+res.Name)
+	if err := os.Rename(src, tmp); err != nil {
+		return fmt.Errorf("could not move entry: %v", err)
+	}
+	if err := os.Remove(res.Path); err != nil {
+		os.Rename(tmp, src)
+		return fmt.Errorf("could not remove directory: %v", err)
+	}
+	if err := os.Rename(tmp, res.Path); err != nil {
+		return fmt.Errorf("could not move entry: %v", err)
+	}
+	res.Migrated = true
+	return nil
+}
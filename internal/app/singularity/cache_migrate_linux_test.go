@@ -0,0 +1,106 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sylabs/scs-library-client/client"
+	"github.com/sylabs/singularity/internal/pkg/cache"
+)
+
+func TestMigrateSingularityCache(t *testing.T) {
+	parentDir, err := ioutil.TempDir("", "cache-migrate-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(parentDir)
+
+	imgCache, err := cache.New(cache.Config{ParentDir: parentDir})
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	if imgCache.IsDisabled() {
+		t.Skip("cache directory is not writable")
+	}
+
+	// writes an old layout entry, <type>/<name>/image.sif
+	oldEntry := func(cacheType, name, content string) string {
+		cacheDir, err := imgCache.GetFileCacheDir(cacheType)
+		if err != nil {
+			t.Fatalf("failed to get %s cache directory: %v", cacheType, err)
+		}
+		dir := filepath.Join(cacheDir, name)
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			t.Fatalf("failed to create cache entry: %v", err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, "image.sif"), []byte(content), 0600); err != nil {
+			t.Fatalf("failed to write cache entry: %v", err)
+		}
+		return dir
+	}
+
+	tmp := filepath.Join(parentDir, "image")
+	if err := ioutil.WriteFile(tmp, []byte("valid image"), 0600); err != nil {
+		t.Fatalf("failed to write image: %v", err)
+	}
+	hash, err := client.ImageHash(tmp)
+	if err != nil {
+		t.Fatalf("failed to compute hash: %v", err)
+	}
+	valid := oldEntry(cache.LibraryCacheType, hash, "valid image")
+	corrupted := oldEntry(cache.LibraryCacheType, "sha256.0000000000000000000000000000000000000000000000000000000000000000", "corrupted")
+	unverified := oldEntry(cache.ShubCacheType, "0123456789abcdef", "shub image")
+
+	expected := map[string]CacheMigrateResult{
+		valid:      {Verified: true, Migrated: true},
+		corrupted:  {},
+		unverified: {Migrated: true},
+	}
+
+	for _, dryRun := range []bool{true, false} {
+		results, err := MigrateSingularityCache(imgCache, dryRun)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(results) != len(expected) {
+			t.Fatalf("expected %d old entries, got %d", len(expected), len(results))
+		}
+		for _, res := range results {
+			exp, ok := expected[res.Path]
+			if !ok {
+				t.Fatalf("unexpected entry %s", res.Path)
+			}
+			if res.Verified != exp.Verified || res.Migrated != (exp.Migrated && !dryRun) {
+				t.Errorf("entry %s: unexpected result with dryRun=%v: %+v", res.Path, dryRun, res)
+			}
+			if (res.Error != "") != (res.Path == corrupted) {
+				t.Errorf("entry %s: unexpected error: %q", res.Path, res.Error)
+			}
+		}
+	}
+
+	for _, path := range []string{valid, unverified} {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Errorf("entry %s was not migrated: %v", path, err)
+		} else if len(b) == 0 {
+			t.Errorf("entry %s is empty", path)
+		}
+	}
+
+	// only the corrupted entry is left
+	results, err := MigrateSingularityCache(imgCache, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(results) != 1 || results[0].Path != corrupted {
+		t.Errorf("unexpected results on second migration: %+v", results)
+	}
+}
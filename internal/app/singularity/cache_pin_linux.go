@@ -0,0 +1,58 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sylabs/singularity/internal/pkg/cache"
+	"github.com/sylabs/singularity/pkg/sylog"
+)
+
+// PinSingularityCache pins the cache entry named name, or whose name starts
+// with it, among the cache types cacheTypes, all of them if empty or
+// containing "all". It unpins the entry if pin is false.
+func PinSingularityCache(imgCache *cache.Handle, name string, cacheTypes []string, pin bool) error {
+	if imgCache == nil {
+		return errInvalidCacheHandle
+	}
+	if stringInSlice("all", cacheTypes) {
+		cacheTypes = nil
+	}
+
+	entries, err := imgCache.FindEntries(name, cacheTypes...)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return fmt.Errorf("no cache entry matches %s", name)
+	}
+	if len(entries) > 1 {
+		matches := make([]string, 0, len(entries))
+		for _, e := range entries {
+			matches = append(matches, e.Type+"/"+e.Name)
+		}
+		return fmt.Errorf("%s matches several cache entries, give more of the name or a --type: %s", name, strings.Join(matches, ", "))
+	}
+
+	e := entries[0]
+	if !pin {
+		if err := imgCache.Unpin(e.Type, e.Name); err == cache.ErrNotPinned {
+			return fmt.Errorf("%s cache entry %s is not pinned", e.Type, e.Name)
+		} else if err != nil {
+			return err
+		}
+		sylog.Infof("Unpinned %s cache entry: %s", e.Type, e.Name)
+		return nil
+	}
+
+	if err := imgCache.Pin(e.Type, e.Name); err != nil {
+		return err
+	}
+	sylog.Infof("Pinned %s cache entry: %s", e.Type, e.Name)
+	return nil
+}
@@ -0,0 +1,83 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/sylabs/scs-library-client/client"
+	"github.com/sylabs/singularity/internal/pkg/cache"
+	"github.com/sylabs/singularity/internal/pkg/util/fs"
+	"github.com/sylabs/singularity/pkg/sylog"
+)
+
+// CacheVerifyResult holds the outcome of the verification of a cache entry.
+type CacheVerifyResult struct {
+	// Name is the name of the entry, i.e. its expected hash.
+	Name string `json:"name"`
+	// Type is the cache type of the entry.
+	Type string `json:"type"`
+	// Hash is the hash computed from the entry content.
+	Hash string `json:"hash,omitempty"`
+	// Valid is true when the computed hash matches the entry name.
+	Valid bool `json:"valid"`
+	// Removed is true when the corrupted entry was deleted.
+	Removed bool `json:"removed"`
+	// Error holds the reason the entry couldn't be verified or removed.
+	Error string `json:"error,omitempty"`
+}
+
+// VerifySingularityCache recomputes the hash of every library cache entry
+// and compares it against the hash its name is derived from. If fix is
+// true the corrupted entries are removed. The result of each verification
+// is returned, an error is only returned if the cache can't be read.
+func VerifySingularityCache(imgCache *cache.Handle, fix bool) ([]CacheVerifyResult, error) {
+	if imgCache == nil {
+		return nil, errInvalidCacheHandle
+	}
+
+	entries, err := imgCache.Entries(cache.LibraryCacheType)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]CacheVerifyResult, 0, len(entries))
+	for _, entry := range entries {
+		// skip the temporary files of in progress downloads, and
+		// directories left by older versions which are removed
+		// on the next access
+		if !fs.IsFile(entry.Path) || cache.IsPartial(entry.Name) {
+			continue
+		}
+
+		res := CacheVerifyResult{
+			Name: entry.Name,
+			Type: entry.Type,
+		}
+
+		sylog.Debugf("Verifying %s cache entry: %s", res.Type, res.Name)
+		res.Hash, err = client.ImageHash(entry.Path)
+		if err != nil {
+			res.Error = fmt.Sprintf("could not compute hash: %v", err)
+			results = append(results, res)
+			continue
+		}
+		res.Valid = res.Hash == res.Name
+
+		if !res.Valid && fix {
+			sylog.Infof("Removing corrupted %s cache entry: %s", res.Type, res.Name)
+			if err := os.Remove(entry.Path); err != nil {
+				res.Error = fmt.Sprintf("could not remove entry: %v", err)
+			} else {
+				res.Removed = true
+			}
+		}
+		results = append(results, res)
+	}
+
+	return results, nil
+}
@@ -0,0 +1,87 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sylabs/scs-library-client/client"
+	"github.com/sylabs/singularity/internal/pkg/cache"
+)
+
+func TestVerifySingularityCache(t *testing.T) {
+	parentDir, err := ioutil.TempDir("", "cache-verify-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(parentDir)
+
+	imgCache, err := cache.New(cache.Config{ParentDir: parentDir})
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	if imgCache.IsDisabled() {
+		t.Skip("cache directory is not writable")
+	}
+	cacheDir, err := imgCache.GetFileCacheDir(cache.LibraryCacheType)
+	if err != nil {
+		t.Fatalf("failed to get library cache directory: %v", err)
+	}
+
+	// a valid entry is named after the hash of its content
+	tmp := filepath.Join(parentDir, "image")
+	if err := ioutil.WriteFile(tmp, []byte("valid image"), 0600); err != nil {
+		t.Fatalf("failed to write image: %v", err)
+	}
+	hash, err := client.ImageHash(tmp)
+	if err != nil {
+		t.Fatalf("failed to compute hash: %v", err)
+	}
+	if err := os.Rename(tmp, filepath.Join(cacheDir, hash)); err != nil {
+		t.Fatalf("failed to create cache entry: %v", err)
+	}
+
+	corrupted := "sha256.0000000000000000000000000000000000000000000000000000000000000000"
+	for _, name := range []string{corrupted, "tmp_12345"} {
+		if err := ioutil.WriteFile(filepath.Join(cacheDir, name), []byte("corrupted"), 0600); err != nil {
+			t.Fatalf("failed to write cache entry: %v", err)
+		}
+	}
+
+	for _, fix := range []bool{false, true} {
+		results, err := VerifySingularityCache(imgCache, fix)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(results) != 2 {
+			t.Fatalf("expected 2 verified entries, got %d", len(results))
+		}
+		for _, res := range results {
+			switch res.Name {
+			case hash:
+				if !res.Valid || res.Removed {
+					t.Errorf("entry %s: expected valid entry to be kept: %+v", res.Name, res)
+				}
+			case corrupted:
+				if res.Valid || res.Removed != fix {
+					t.Errorf("entry %s: unexpected result with fix=%v: %+v", res.Name, fix, res)
+				}
+			default:
+				t.Errorf("unexpected entry %s", res.Name)
+			}
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(cacheDir, corrupted)); !os.IsNotExist(err) {
+		t.Errorf("corrupted entry was not removed")
+	}
+	if _, err := os.Stat(filepath.Join(cacheDir, hash)); err != nil {
+		t.Errorf("valid entry was removed: %v", err)
+	}
+}
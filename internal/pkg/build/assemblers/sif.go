@@ -6,14 +6,19 @@
 package assemblers
 
 import (
+	"crypto/sha256"
 	"encoding/binary"
+	"encoding/hex"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"regexp"
 	"runtime"
 	"strconv"
 	"syscall"
+	"time"
 
 	uuid "github.com/satori/go.uuid"
 	"github.com/sylabs/sif/pkg/sif"
@@ -22,6 +27,7 @@ import (
 	"github.com/sylabs/singularity/pkg/image/packer"
 	"github.com/sylabs/singularity/pkg/sylog"
 	"github.com/sylabs/singularity/pkg/util/crypt"
+	"golang.org/x/sys/unix"
 )
 
 // SIFAssembler doesn't store anything.
@@ -37,13 +43,13 @@ type encryptionOptions struct {
 	plaintext []byte
 }
 
-func createSIF(path string, definition, ociConf []byte, squashfile string, encOpts *encryptionOptions, arch string) (err error) {
+func createSIF(path string, definition, ociConf []byte, squashfile string, encOpts *encryptionOptions, arch string, id uuid.UUID) (err error) {
 	// general info for the new SIF file creation
 	cinfo := sif.CreateInfo{
 		Pathname:   path,
 		Launchstr:  sif.HdrLaunch,
 		Sifversion: sif.HdrVersion,
-		ID:         uuid.NewV4(),
+		ID:         id,
 	}
 
 	// data we need to create a definition file descriptor
@@ -192,10 +198,36 @@ func (a *SIFAssembler) Assemble(b *types.Bundle, path string) error {
 	}
 	sylog.Verbosef("Set SIF container architecture to %s", arch)
 
+	if b.Opts.Reproducible {
+		buildTime := b.Opts.BuildTime()
+		sylog.Debugf("Setting rootfs timestamps to %s", buildTime)
+		if err := setRootfsTimes(b.RootfsPath, buildTime); err != nil {
+			return fmt.Errorf("while setting rootfs timestamps: %v", err)
+		}
+		// honored by squashfs-tools >= 4.4 for the filesystem creation time
+		os.Setenv("SOURCE_DATE_EPOCH", strconv.FormatInt(buildTime.Unix(), 10))
+	}
+
+	var rootfsSize int64
+	if b.Opts.Squash {
+		// the layers are already merged in the rootfs, larger blocks and
+		// packing the file tails in fragments give a smaller partition
+		flags = append(flags, "-b", "1048576", "-always-use-fragments")
+		rootfsSize = dirSize(b.RootfsPath)
+	}
+
 	if err := s.Create([]string{b.RootfsPath}, fsPath, flags); err != nil {
 		return fmt.Errorf("while creating squashfs: %v", err)
 	}
 
+	if b.Opts.Squash {
+		fi, err := os.Stat(fsPath)
+		if err != nil {
+			return fmt.Errorf("while calling stat on squashfs: %v", err)
+		}
+		sylog.Infof("Squashed %.1f MiB root filesystem into a %.1f MiB partition", mebibytes(rootfsSize), mebibytes(fi.Size()))
+	}
+
 	var encOpts *encryptionOptions
 
 	if b.Opts.EncryptionKeyInfo != nil {
@@ -226,14 +258,109 @@ func (a *SIFAssembler) Assemble(b *types.Bundle, path string) error {
 
 	}
 
-	err = createSIF(path, b.Recipe.Raw, b.JSONObjects[types.OCIConfigJSON], fsPath, encOpts, arch)
+	id := uuid.NewV4()
+	if b.Opts.Reproducible {
+		// derive the image ID from its content instead
+		id, err = contentID(fsPath)
+		if err != nil {
+			return fmt.Errorf("while computing image ID: %v", err)
+		}
+	}
+
+	err = createSIF(path, b.Recipe.Raw, b.JSONObjects[types.OCIConfigJSON], fsPath, encOpts, arch, id)
 	if err != nil {
 		return fmt.Errorf("while creating SIF: %v", err)
 	}
 
+	if b.Opts.Reproducible {
+		if err := setSIFTimes(path, b.Opts.BuildTime()); err != nil {
+			return fmt.Errorf("while setting SIF timestamps: %v", err)
+		}
+	}
+
 	return nil
 }
 
+// setRootfsTimes sets the access and modification times of everything in
+// rootfs, without following symlinks.
+func setRootfsTimes(rootfs string, t time.Time) error {
+	ts := []unix.Timespec{unix.NsecToTimespec(t.UnixNano()), unix.NsecToTimespec(t.UnixNano())}
+	return filepath.Walk(rootfs, func(path string, _ os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := unix.UtimesNanoAt(unix.AT_FDCWD, path, ts, unix.AT_SYMLINK_NOFOLLOW); err != nil {
+			return fmt.Errorf("could not set times on %s: %v", path, err)
+		}
+		return nil
+	})
+}
+
+// dirSize returns the total size of the regular files under dir, the
+// directories that can't be read are skipped.
+func dirSize(dir string) int64 {
+	var size int64
+	filepath.Walk(dir, func(_ string, fi os.FileInfo, err error) error {
+		if err == nil && fi.Mode().IsRegular() {
+			size += fi.Size()
+		}
+		return nil
+	})
+	return size
+}
+
+// mebibytes returns size in MiB.
+func mebibytes(size int64) float64 {
+	return float64(size) / (1 << 20)
+}
+
+// contentID returns a name based UUID derived from the sha256 sum of the
+// file at path.
+func contentID(path string) (uuid.UUID, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return uuid.Nil, err
+	}
+	return uuid.NewV5(uuid.NamespaceOID, hex.EncodeToString(h.Sum(nil))), nil
+}
+
+// setSIFTimes sets the creation and modification times recorded in the
+// global header and descriptors of the SIF image at path.
+func setSIFTimes(path string, t time.Time) error {
+	fimg, err := sif.LoadContainer(path, false)
+	if err != nil {
+		return err
+	}
+	defer fimg.UnloadContainer()
+
+	fimg.Header.Ctime = t.Unix()
+	fimg.Header.Mtime = t.Unix()
+	for i := range fimg.DescrArr {
+		if !fimg.DescrArr[i].Used {
+			continue
+		}
+		fimg.DescrArr[i].Ctime = t.Unix()
+		fimg.DescrArr[i].Mtime = t.Unix()
+	}
+
+	if _, err := fimg.Fp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := binary.Write(fimg.Fp, binary.LittleEndian, fimg.Header); err != nil {
+		return err
+	}
+	if _, err := fimg.Fp.Seek(fimg.Header.Descroff, io.SeekStart); err != nil {
+		return err
+	}
+	return binary.Write(fimg.Fp, binary.LittleEndian, fimg.DescrArr)
+}
+
 // changeOwner check the command being called with sudo with the environment
 // variable SUDO_COMMAND. Pattern match that for the singularity bin.
 func changeOwner() (int, int, bool) {
@@ -7,11 +7,13 @@ package assemblers_test
 
 import (
 	"context"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"testing"
 
+	"github.com/sylabs/sif/pkg/sif"
 	"github.com/sylabs/singularity/internal/pkg/build/assemblers"
 	"github.com/sylabs/singularity/internal/pkg/build/sources"
 	"github.com/sylabs/singularity/internal/pkg/cache"
@@ -126,3 +128,46 @@ func TestSIFAssemblerShub(t *testing.T) {
 
 	defer os.Remove(assemblerShubDest)
 }
+
+// TestSIFAssemblerSquash sees if we can build a SIF image with a squashed
+// partition from a local root filesystem
+func TestSIFAssemblerSquash(t *testing.T) {
+	mksquashfsPath, err := exec.LookPath("mksquashfs")
+	if err != nil {
+		t.Skipf("could not find mksquashfs: %v", err)
+	}
+
+	b, err := types.NewBundle(filepath.Join(os.TempDir(), "sbuild-SIFAssembler"), os.TempDir())
+	if err != nil {
+		t.Fatalf("unable to make bundle: %v", err)
+	}
+	defer b.Remove()
+
+	if err := ioutil.WriteFile(filepath.Join(b.RootfsPath, "file"), make([]byte, 4096), 0644); err != nil {
+		t.Fatalf("unable to write rootfs file: %v", err)
+	}
+	b.Opts.Squash = true
+
+	a := &assemblers.SIFAssembler{
+		MksquashfsPath: mksquashfsPath,
+	}
+
+	dest := filepath.Join(b.TmpDir, "squash.sif")
+	if err := a.Assemble(b, dest); err != nil {
+		t.Fatalf("failed to assemble squashed image: %v", err)
+	}
+
+	fimg, err := sif.LoadContainer(dest, true)
+	if err != nil {
+		t.Fatalf("failed to load squashed image: %v", err)
+	}
+	defer fimg.UnloadContainer()
+
+	part, _, err := fimg.GetPartPrimSys()
+	if err != nil {
+		t.Fatalf("squashed image has no primary partition: %v", err)
+	}
+	if fstype, err := part.GetFsType(); err != nil || fstype != sif.FsSquash {
+		t.Errorf("unexpected primary partition type %v: %v", fstype, err)
+	}
+}
@@ -55,6 +55,9 @@ type Config struct {
 	NoCleanUp bool
 	// Opts for bundles.
 	Opts types.Options
+	// OnInterrupt, when set, is called once the bundles of a build
+	// interrupted by a signal were cleaned up, before the process exits.
+	OnInterrupt func()
 }
 
 // NewBuild creates a new Build struct from a spec (URI, definition file, etc...).
@@ -312,6 +315,9 @@ func (b *Build) Full(ctx context.Context) error {
 	go func() {
 		<-c
 		b.cleanUp()
+		if b.Conf.OnInterrupt != nil {
+			b.Conf.OnInterrupt()
+		}
 		os.Exit(1)
 	}()
 	// clean up build normally
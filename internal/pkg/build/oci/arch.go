@@ -0,0 +1,84 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package oci
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/containers/image/v5/image"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/types"
+	"github.com/pkg/errors"
+)
+
+// ImageArchitectures returns the architectures the linux image of uri is
+// available for: those of the instances of a manifest list, or the one of
+// the image otherwise.
+func ImageArchitectures(ctx context.Context, uri string, sys *types.SystemContext) (archs []string, err error) {
+	ref, err := parseURI(uri)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse image name %v: %v", uri, err)
+	}
+	source, err := ref.NewImageSource(ctx, sys)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if closeErr := source.Close(); closeErr != nil {
+			err = errors.Wrapf(err, " (src: %v)", closeErr)
+		}
+	}()
+
+	man, mimeType, err := source.GetManifest(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	if manifest.MIMETypeIsMultiImage(mimeType) {
+		return listArchitectures(man)
+	}
+
+	img, err := image.FromUnparsedImage(ctx, sys, image.UnparsedInstance(source, nil))
+	if err != nil {
+		return nil, err
+	}
+	info, err := img.Inspect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return []string{info.Architecture}, nil
+}
+
+// listArchitectures returns the architectures of the linux instances of the
+// OCI index or docker manifest list man, which share their layout.
+func listArchitectures(man []byte) ([]string, error) {
+	var list struct {
+		Manifests []struct {
+			Platform struct {
+				Architecture string `json:"architecture"`
+				OS           string `json:"os"`
+			} `json:"platform"`
+		} `json:"manifests"`
+	}
+	if err := json.Unmarshal(man, &list); err != nil {
+		return nil, fmt.Errorf("could not decode manifest list: %v", err)
+	}
+
+	var archs []string
+	seen := make(map[string]bool)
+	for _, m := range list.Manifests {
+		a := m.Platform.Architecture
+		if m.Platform.OS != "linux" || a == "" || seen[a] {
+			continue
+		}
+		seen[a] = true
+		archs = append(archs, a)
+	}
+	sort.Strings(archs)
+	return archs, nil
+}
@@ -0,0 +1,35 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package oci
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestListArchitectures(t *testing.T) {
+	list := `{
+		"schemaVersion": 2,
+		"manifests": [
+			{"digest": "sha256:1", "platform": {"architecture": "s390x", "os": "linux"}},
+			{"digest": "sha256:2", "platform": {"architecture": "amd64", "os": "linux"}},
+			{"digest": "sha256:3", "platform": {"architecture": "amd64", "os": "windows"}},
+			{"digest": "sha256:4", "platform": {"architecture": "arm64", "os": "linux", "variant": "v8"}},
+			{"digest": "sha256:5", "platform": {"architecture": "amd64", "os": "linux", "variant": "v2"}}
+		]
+	}`
+	archs, err := listArchitectures([]byte(list))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := []string{"amd64", "arm64", "s390x"}; !reflect.DeepEqual(archs, expected) {
+		t.Errorf("unexpected architectures %v, expected %v", archs, expected)
+	}
+
+	if _, err := listArchitectures([]byte("{")); err == nil {
+		t.Errorf("unexpected success decoding invalid list")
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"fmt"
 	"io"
 	"strings"
+	"time"
 
 	"github.com/containers/image/v5/copy"
 	"github.com/containers/image/v5/oci/layout"
@@ -20,6 +21,7 @@ import (
 	"github.com/containers/image/v5/types"
 	"github.com/pkg/errors"
 	"github.com/sylabs/singularity/internal/pkg/cache"
+	"github.com/sylabs/singularity/internal/pkg/client"
 	"github.com/sylabs/singularity/pkg/sylog"
 )
 
@@ -27,6 +29,8 @@ import (
 type ImageReference struct {
 	source types.ImageReference
 	types.ImageReference
+	// dir is the blob pool directory
+	dir string
 }
 
 // ConvertReference converts a source reference into a cache.ImageReference to cache its blobs
@@ -55,6 +59,7 @@ func ConvertReference(ctx context.Context, imgCache *cache.Handle, src types.Ima
 	return &ImageReference{
 		source:         src,
 		ImageReference: c,
+		dir:            cacheDir,
 	}, nil
 
 }
@@ -72,16 +77,51 @@ func (t *ImageReference) newImageSource(ctx context.Context, sys *types.SystemCo
 	}
 
 	// First we are fetching into the cache
-	_, err = copy.Image(ctx, policyCtx, t.ImageReference, t.source, &copy.Options{
+	opts := &copy.Options{
 		ReportWriter: w,
 		SourceCtx:    sys,
-	})
+	}
+	done := TransferProgress(ctx, t.source, opts)
+	src := t.source
+	if src.Transport().Name() == "docker" && t.dir != "" {
+		// layers interrupted by a failure are resumed by the next pull
+		src = &resumableReference{ImageReference: src, dir: t.dir}
+	}
+	_, err = copy.Image(ctx, policyCtx, t.ImageReference, src, opts)
+	done()
 	if err != nil {
 		return nil, err
 	}
 	return t.ImageReference.NewImageSource(ctx, sys)
 }
 
+// TransferProgress sets the progress channel of opts so that the blobs
+// copied from the registry src are added to the transfer of ctx, if any. The
+// returned function must be called once the copy is done.
+func TransferProgress(ctx context.Context, src types.ImageReference, opts *copy.Options) func() {
+	t := client.TransferFromContext(ctx)
+	if t == nil || src.Transport().Name() != "docker" {
+		return func() {}
+	}
+
+	progress := make(chan types.ProgressProperties)
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		for p := range progress {
+			if p.Event == types.ProgressEventDone {
+				t.AddNetwork(int64(p.Offset))
+			}
+		}
+	}()
+	opts.Progress = progress
+	opts.ProgressInterval = time.Second
+	return func() {
+		close(progress)
+		<-finished
+	}
+}
+
 // ParseImageName parses a uri (e.g. docker://ubuntu) into it's transport:reference
 // combination and then returns the proper reference
 func ParseImageName(ctx context.Context, imgCache *cache.Handle, uri string, sys *types.SystemContext) (types.ImageReference, error) {
@@ -0,0 +1,455 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package oci
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/pkg/docker/config"
+	"github.com/containers/image/v5/transports"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/sylabs/singularity/internal/pkg/cache"
+	"github.com/sylabs/singularity/internal/pkg/client"
+	"github.com/sylabs/singularity/pkg/sylog"
+)
+
+// resumableReference wraps a docker reference so that the blobs of its image
+// source are downloaded through partial files of the blob pool dir, which a
+// later pull resumes with Range requests when a download is interrupted.
+// The blobs already completed are in the blob pool, and are not requested
+// again as containers/image reuses them.
+type resumableReference struct {
+	types.ImageReference
+	dir string
+}
+
+// NewImageSource returns the image source of the wrapped reference, whose
+// blobs are downloaded resumably.
+func (r *resumableReference) NewImageSource(ctx context.Context, sys *types.SystemContext) (types.ImageSource, error) {
+	src, err := r.ImageReference.NewImageSource(ctx, sys)
+	if err != nil {
+		return nil, err
+	}
+	fetcher, err := newBlobFetcher(r.ImageReference, sys)
+	if err != nil {
+		sylog.Debugf("Layers of %s will not be downloaded resumably: %v", transports.ImageName(r.ImageReference), err)
+		return src, nil
+	}
+	return &resumableSource{ImageSource: src, fetcher: fetcher, dir: r.dir}, nil
+}
+
+// resumableSource is an image source whose blobs are fetched by fetcher and
+// saved to partial files of the blob pool dir while they are read.
+type resumableSource struct {
+	types.ImageSource
+	fetcher *blobFetcher
+	dir     string
+}
+
+// GetBlob returns a stream of the blob info, resuming its partial download
+// if any. The blob is downloaded by the wrapped image source when it can't
+// be downloaded resumably.
+func (s *resumableSource) GetBlob(ctx context.Context, info types.BlobInfo, bic types.BlobInfoCache) (io.ReadCloser, int64, error) {
+	if len(info.URLs) > 0 || info.Digest.Validate() != nil {
+		return s.ImageSource.GetBlob(ctx, info, bic)
+	}
+	rc, size, err := s.resumeBlob(ctx, info)
+	if err != nil {
+		sylog.Debugf("Could not download blob %s resumably, downloading it in full: %v", info.Digest, err)
+		return s.ImageSource.GetBlob(ctx, info, bic)
+	}
+	return rc, size, nil
+}
+
+// partialPath returns the path of the partial file of the blob d.
+func (s *resumableSource) partialPath(d digest.Digest) string {
+	return filepath.Join(s.dir, "blobs", d.Algorithm().String(), d.Hex()+cache.PartSuffix)
+}
+
+func (s *resumableSource) resumeBlob(ctx context.Context, info types.BlobInfo) (io.ReadCloser, int64, error) {
+	partial := s.partialPath(info.Digest)
+	if err := os.MkdirAll(filepath.Dir(partial), 0755); err != nil {
+		return nil, 0, err
+	}
+	f, err := os.OpenFile(partial, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, 0, err
+	}
+	// the lock is released when f is closed
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		return nil, 0, fmt.Errorf("blob is being downloaded by another process")
+	}
+
+	r, size, err := s.openBlob(ctx, info, f)
+	if err != nil {
+		if fi, statErr := f.Stat(); statErr == nil && fi.Size() == 0 {
+			os.Remove(partial)
+		}
+		f.Close()
+		return nil, 0, err
+	}
+	return r, size, nil
+}
+
+// openBlob returns a reader of the blob info streaming the part already
+// downloaded to f, then the rest of it from the registry.
+func (s *resumableSource) openBlob(ctx context.Context, info types.BlobInfo, f *os.File) (*resumeReader, int64, error) {
+	offset, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, 0, err
+	}
+	if info.Size >= 0 && offset > info.Size {
+		sylog.Debugf("Partial blob %s is larger than the blob, discarding it", info.Digest)
+		if offset, err = truncate(f); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	r := &resumeReader{
+		f:        f,
+		digester: info.Digest.Algorithm().Digester(),
+		expected: info.Digest,
+		body:     http.NoBody,
+	}
+	if info.Size >= 0 && offset == info.Size {
+		sylog.Debugf("Blob %s was already downloaded, verifying it", info.Digest)
+		r.start(offset)
+		return r, info.Size, nil
+	}
+
+	res, err := s.fetcher.getBlob(ctx, info.Digest, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	size := int64(-1)
+	switch {
+	case res.StatusCode == http.StatusPartialContent && contentRangeStart(res) == offset:
+		sylog.Infof("Resuming download of blob %s at byte %d", info.Digest, offset)
+		if res.ContentLength >= 0 {
+			size = offset + res.ContentLength
+		}
+	case res.StatusCode == http.StatusOK:
+		if offset > 0 {
+			sylog.Debugf("Registry ignored the range request for blob %s, downloading it in full", info.Digest)
+			if offset, err = truncate(f); err != nil {
+				res.Body.Close()
+				return nil, 0, err
+			}
+		}
+		size = res.ContentLength
+	case res.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0:
+		// the size of the blob wasn't known, the partial file may be
+		// complete, which the verification of its digest tells
+		res.Body.Close()
+		r.start(offset)
+		return r, offset, nil
+	default:
+		res.Body.Close()
+		return nil, 0, fmt.Errorf("unexpected response fetching blob: %s", res.Status)
+	}
+	r.body = res.Body
+	r.start(offset)
+	return r, size, nil
+}
+
+// truncate discards the content of f.
+func truncate(f *os.File) (int64, error) {
+	if err := f.Truncate(0); err != nil {
+		return 0, err
+	}
+	return f.Seek(0, io.SeekStart)
+}
+
+// contentRangeStart returns the first byte of the Content-Range of res, -1
+// if it hasn't one.
+func contentRangeStart(res *http.Response) int64 {
+	cr := strings.TrimPrefix(res.Header.Get("Content-Range"), "bytes ")
+	i := strings.IndexByte(cr, '-')
+	if i < 0 {
+		return -1
+	}
+	start, err := strconv.ParseInt(cr[:i], 10, 64)
+	if err != nil {
+		return -1
+	}
+	return start
+}
+
+// resumeReader reads a blob from its partial file f followed by the response
+// body which is appended to f. The digest of the blob is verified once it
+// is read entirely; the partial file is discarded if it doesn't match, and
+// removed when the reader is closed after a match, the blob being in the
+// blob pool by then.
+type resumeReader struct {
+	r        io.Reader
+	f        *os.File
+	body     io.ReadCloser
+	digester digest.Digester
+	expected digest.Digest
+	verified bool
+}
+
+// start sets up r to read the offset bytes of its partial file, then the
+// response body.
+func (r *resumeReader) start(offset int64) {
+	prefix := io.NewSectionReader(r.f, 0, offset)
+	r.r = io.TeeReader(io.MultiReader(prefix, io.TeeReader(r.body, r.f)), r.digester.Hash())
+}
+
+func (r *resumeReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if err == io.EOF && !r.verified {
+		if actual := r.digester.Digest(); actual != r.expected {
+			r.f.Truncate(0)
+			return n, fmt.Errorf("digest of blob %s is %s, the download is discarded", r.expected, actual)
+		}
+		r.verified = true
+	}
+	return n, err
+}
+
+func (r *resumeReader) Close() error {
+	r.body.Close()
+	err := r.f.Close()
+	if r.verified {
+		os.Remove(r.f.Name())
+	}
+	return err
+}
+
+// blobFetcher requests the blobs of a docker repository, with range requests
+// when resuming a download.
+type blobFetcher struct {
+	client   *http.Client
+	registry string
+	host     string
+	repo     string
+	schemes  []string
+	sys      *types.SystemContext
+
+	mu   sync.Mutex
+	auth string
+}
+
+func newBlobFetcher(ref types.ImageReference, sys *types.SystemContext) (*blobFetcher, error) {
+	named := ref.DockerReference()
+	if named == nil {
+		return nil, fmt.Errorf("not a docker reference")
+	}
+	registry := reference.Domain(named)
+	host := registry
+	if host == "docker.io" {
+		host = "registry-1.docker.io"
+	}
+
+	f := &blobFetcher{
+		client:   client.NewHTTPClient(0),
+		registry: registry,
+		host:     host,
+		repo:     reference.Path(named),
+		schemes:  []string{"https"},
+		sys:      sys,
+	}
+	if sys != nil && sys.DockerInsecureSkipTLSVerify == types.OptionalBoolTrue {
+		t, ok := f.client.Transport.(*http.Transport)
+		if !ok {
+			return nil, fmt.Errorf("unexpected HTTP transport %T", f.client.Transport)
+		}
+		t = t.Clone()
+		t.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+		f.client.Transport = t
+		// as for containers/image, insecure registries may be plain HTTP
+		f.schemes = append(f.schemes, "http")
+	}
+	return f, nil
+}
+
+// getBlob requests the blob d from byte offset, authenticating as required
+// by the registry.
+func (f *blobFetcher) getBlob(ctx context.Context, d digest.Digest, offset int64) (*http.Response, error) {
+	var err error
+	for _, scheme := range f.schemes {
+		u := fmt.Sprintf("%s://%s/v2/%s/blobs/%s", scheme, f.host, f.repo, d)
+		var res *http.Response
+		res, err = f.do(ctx, u, offset)
+		if err == nil {
+			return res, nil
+		}
+	}
+	return nil, err
+}
+
+func (f *blobFetcher) do(ctx context.Context, u string, offset int64) (*http.Response, error) {
+	for retry := 0; ; retry++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+		if err != nil {
+			return nil, err
+		}
+		if offset > 0 {
+			req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		}
+		if f.sys != nil && f.sys.DockerRegistryUserAgent != "" {
+			req.Header.Set("User-Agent", f.sys.DockerRegistryUserAgent)
+		}
+		f.mu.Lock()
+		auth := f.auth
+		f.mu.Unlock()
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+
+		res, err := f.client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if res.StatusCode != http.StatusUnauthorized || retry > 0 {
+			return res, nil
+		}
+		challenge := res.Header.Get("WWW-Authenticate")
+		res.Body.Close()
+		if err := f.authenticate(ctx, challenge); err != nil {
+			return nil, fmt.Errorf("could not authenticate to %s: %v", f.registry, err)
+		}
+	}
+}
+
+// authenticate sets the authorization answering the registry challenge.
+func (f *blobFetcher) authenticate(ctx context.Context, challenge string) error {
+	username, password, err := f.credentials()
+	if err != nil {
+		return err
+	}
+
+	scheme, params := parseChallenge(challenge)
+	var auth string
+	switch strings.ToLower(scheme) {
+	case "basic":
+		req := &http.Request{Header: http.Header{}}
+		req.SetBasicAuth(username, password)
+		auth = req.Header.Get("Authorization")
+	case "bearer":
+		token, err := f.token(ctx, params, username, password)
+		if err != nil {
+			return err
+		}
+		auth = "Bearer " + token
+	default:
+		return fmt.Errorf("unsupported authentication challenge %q", challenge)
+	}
+
+	f.mu.Lock()
+	f.auth = auth
+	f.mu.Unlock()
+	return nil
+}
+
+func (f *blobFetcher) credentials() (string, string, error) {
+	if f.sys != nil && f.sys.DockerAuthConfig != nil {
+		return f.sys.DockerAuthConfig.Username, f.sys.DockerAuthConfig.Password, nil
+	}
+	return config.GetAuthentication(f.sys, f.registry)
+}
+
+// token requests a bearer token from the realm of the challenge params.
+func (f *blobFetcher) token(ctx context.Context, params map[string]string, username, password string) (string, error) {
+	realm, err := url.Parse(params["realm"])
+	if err != nil || realm.Host == "" {
+		return "", fmt.Errorf("invalid token realm %q", params["realm"])
+	}
+	q := realm.Query()
+	if s := params["service"]; s != "" {
+		q.Set("service", s)
+	}
+	scope := params["scope"]
+	if scope == "" {
+		scope = "repository:" + f.repo + ":pull"
+	}
+	q.Set("scope", scope)
+	realm.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	if username != "" {
+		req.SetBasicAuth(username, password)
+	}
+	res, err := f.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token request failed: %s", res.Status)
+	}
+
+	var t struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&t); err != nil {
+		return "", fmt.Errorf("could not decode token: %v", err)
+	}
+	if t.Token != "" {
+		return t.Token, nil
+	}
+	if t.AccessToken != "" {
+		return t.AccessToken, nil
+	}
+	return "", fmt.Errorf("no token returned by %s", realm.Host)
+}
+
+// parseChallenge splits the WWW-Authenticate header h into its scheme and
+// parameters.
+func parseChallenge(h string) (string, map[string]string) {
+	params := make(map[string]string)
+	h = strings.TrimSpace(h)
+	i := strings.IndexByte(h, ' ')
+	if i < 0 {
+		return h, params
+	}
+	scheme, rest := h[:i], h[i+1:]
+
+	for rest != "" {
+		rest = strings.TrimLeft(rest, " ,")
+		eq := strings.IndexByte(rest, '=')
+		if eq < 0 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(rest[:eq]))
+		rest = rest[eq+1:]
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.IndexByte(rest[1:], '"')
+			if end < 0 {
+				value, rest = rest[1:], ""
+			} else {
+				value, rest = rest[1:end+1], rest[end+2:]
+			}
+		} else if comma := strings.IndexByte(rest, ','); comma >= 0 {
+			value, rest = rest[:comma], rest[comma+1:]
+		} else {
+			value, rest = rest, ""
+		}
+		params[key] = value
+	}
+	return scheme, params
+}
@@ -0,0 +1,165 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package oci
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/containers/image/v5/docker"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+)
+
+// fullSource is an image source whose blobs can't be downloaded, so that
+// the tests fail when resumableSource falls back to it.
+type fullSource struct {
+	types.ImageSource
+}
+
+func (fullSource) GetBlob(context.Context, types.BlobInfo, types.BlobInfoCache) (io.ReadCloser, int64, error) {
+	return nil, 0, fmt.Errorf("blob downloaded in full")
+}
+
+func TestResumableSource(t *testing.T) {
+	blob := bytes.Repeat([]byte("layer data "), 1000)
+	d := digest.FromBytes(blob)
+
+	var ranges []string
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			if r.URL.Query().Get("scope") != "repository:library/alpine:pull" {
+				http.Error(w, "bad scope", http.StatusForbidden)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]string{"token": "secret"})
+		case "/v2/library/alpine/blobs/" + d.String():
+			if r.Header.Get("Authorization") != "Bearer secret" {
+				w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test"`, srv.URL))
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			ranges = append(ranges, r.Header.Get("Range"))
+			http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(blob))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "resume-test-")
+	if err != nil {
+		t.Fatalf("could not create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ref, err := docker.ParseReference("//" + strings.TrimPrefix(srv.URL, "http://") + "/library/alpine")
+	if err != nil {
+		t.Fatalf("could not parse reference: %v", err)
+	}
+	sys := &types.SystemContext{DockerInsecureSkipTLSVerify: types.OptionalBoolTrue}
+	fetcher, err := newBlobFetcher(ref, sys)
+	if err != nil {
+		t.Fatalf("could not create blob fetcher: %v", err)
+	}
+	src := &resumableSource{ImageSource: fullSource{}, fetcher: fetcher, dir: dir}
+	partial := src.partialPath(d)
+
+	get := func(size int64) ([]byte, error) {
+		rc, _, err := src.GetBlob(context.Background(), types.BlobInfo{Digest: d, Size: size}, nil)
+		if err != nil {
+			t.Fatalf("unexpected error getting blob: %v", err)
+		}
+		defer rc.Close()
+		return ioutil.ReadAll(rc)
+	}
+
+	tests := []struct {
+		name    string
+		partial []byte
+		size    int64
+		ranges  []string
+		wantErr bool
+	}{
+		{name: "Full", ranges: []string{""}, size: int64(len(blob))},
+		{name: "Resumed", partial: blob[:4000], ranges: []string{"bytes=4000-"}, size: int64(len(blob))},
+		{name: "ResumedUnknownSize", partial: blob[:4000], ranges: []string{"bytes=4000-"}, size: -1},
+		{name: "Complete", partial: blob, size: int64(len(blob))},
+		{name: "CompleteUnknownSize", partial: blob, ranges: []string{fmt.Sprintf("bytes=%d-", len(blob))}, size: -1},
+		{name: "Corrupted", partial: bytes.Repeat([]byte("x"), 4000), ranges: []string{"bytes=4000-"}, size: int64(len(blob)), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ranges = nil
+			os.Remove(partial)
+			if tt.partial != nil {
+				if err := os.MkdirAll(dir+"/blobs/sha256", 0755); err != nil {
+					t.Fatalf("could not create blob directory: %v", err)
+				}
+				if err := ioutil.WriteFile(partial, tt.partial, 0644); err != nil {
+					t.Fatalf("could not write partial blob: %v", err)
+				}
+			}
+
+			data, err := get(tt.size)
+			if strings.Join(ranges, ",") != strings.Join(tt.ranges, ",") {
+				t.Errorf("unexpected requested ranges %q, expected %q", ranges, tt.ranges)
+			}
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("unexpected success reading corrupted blob")
+				}
+				// the next download restarts from scratch
+				if fi, err := os.Stat(partial); err != nil || fi.Size() != 0 {
+					t.Errorf("corrupted partial blob was kept")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error reading blob: %v", err)
+			}
+			if !bytes.Equal(data, blob) {
+				t.Errorf("unexpected blob content")
+			}
+			if _, err := os.Stat(partial); !os.IsNotExist(err) {
+				t.Errorf("partial blob not removed once complete")
+			}
+		})
+	}
+}
+
+func TestParseChallenge(t *testing.T) {
+	scheme, params := parseChallenge(`Bearer realm="https://auth.docker.io/token",service="registry.docker.io",scope="repository:library/alpine:pull"`)
+	if scheme != "Bearer" {
+		t.Errorf("unexpected scheme %q", scheme)
+	}
+	expected := map[string]string{
+		"realm":   "https://auth.docker.io/token",
+		"service": "registry.docker.io",
+		"scope":   "repository:library/alpine:pull",
+	}
+	for k, v := range expected {
+		if params[k] != v {
+			t.Errorf("unexpected %s %q, expected %q", k, params[k], v)
+		}
+	}
+
+	if scheme, params := parseChallenge(`Basic realm=registry`); scheme != "Basic" || params["realm"] != "registry" {
+		t.Errorf("unexpected challenge %q %v", scheme, params)
+	}
+}
@@ -29,6 +29,7 @@ import (
 	"github.com/containers/image/v5/types"
 	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/sylabs/singularity/internal/pkg/build/oci"
+	"github.com/sylabs/singularity/internal/pkg/client"
 	"github.com/sylabs/singularity/internal/pkg/util/shell"
 	buildTypes "github.com/sylabs/singularity/pkg/build/types"
 	sytypes "github.com/sylabs/singularity/pkg/build/types"
@@ -64,7 +65,10 @@ func (cp *OCIConveyorPacker) Get(ctx context.Context, b *sytypes.Bundle) (err er
 	cp.sysCtx = &types.SystemContext{
 		OCIInsecureSkipTLSVerify: cp.b.Opts.NoHTTPS,
 		DockerAuthConfig:         cp.b.Opts.DockerAuthConfig,
+		DockerRegistryUserAgent:  client.UserAgent(ctx),
 		OSChoice:                 "linux",
+		ArchitectureChoice:       cp.b.Opts.Arch,
+		DockerDaemonHost:         cp.b.Opts.DockerDaemonHost,
 	}
 	if cp.b.Opts.NoHTTPS {
 		cp.sysCtx.DockerInsecureSkipTLSVerify = types.NewOptionalBool(true)
@@ -184,10 +188,14 @@ func (cp *OCIConveyorPacker) Pack(ctx context.Context) (*sytypes.Bundle, error)
 
 func (cp *OCIConveyorPacker) fetch(ctx context.Context) error {
 	// cp.srcRef contains the cache source reference
-	_, err := copy.Image(ctx, cp.policyCtx, cp.tmpfsRef, cp.srcRef, &copy.Options{
+	opts := &copy.Options{
 		ReportWriter: ioutil.Discard,
 		SourceCtx:    cp.sysCtx,
-	})
+	}
+	// without the cache, the blobs are fetched from the source itself
+	done := oci.TransferProgress(ctx, cp.srcRef, opts)
+	defer done()
+	_, err := copy.Image(ctx, cp.policyCtx, cp.tmpfsRef, cp.srcRef, opts)
 	return err
 }
 
@@ -94,6 +94,15 @@ func unpackRootfs(ctx context.Context, b *sytypes.Bundle, tmpfsRef types.ImageRe
 		return fmt.Errorf("error unpacking rootfs: %s", err)
 	}
 
+	// Strip setuid/setgid/sticky bits so they can't land on the filesystem
+	// from untrusted OCI content
+	if b.Opts.NoSetuid {
+		sylog.Debugf("Removing setuid/setgid/sticky bits from rootfs files")
+		if err := stripSetuid(b.RootfsPath); err != nil {
+			return err
+		}
+	}
+
 	// If the `--fix-perms` flag was used, then modify the permissions so that
 	// content has owner rwX and we're done
 	if b.Opts.FixPerms {
@@ -153,6 +162,42 @@ func fixPerms(rootfs string) (err error) {
 	return err
 }
 
+// stripSetuid will work through the rootfs of this bundle, removing the
+// setuid, setgid and sticky bits from all regular files
+func stripSetuid(rootfs string) (err error) {
+	const stripModes = os.ModeSetuid | os.ModeSetgid | os.ModeSticky
+	stripped := 0
+	errors := 0
+	err = fs.PermWalk(rootfs, func(path string, f os.FileInfo, err error) error {
+		if err != nil {
+			sylog.Errorf("Unable to access rootfs path %s: %s", path, err)
+			errors++
+			return nil
+		}
+
+		mode := f.Mode()
+		if !mode.IsRegular() || mode&stripModes == 0 {
+			return nil
+		}
+		if err := os.Chmod(path, mode&^stripModes); err != nil {
+			sylog.Errorf("Error removing setuid/setgid/sticky bits from %s: %s", path, err)
+			errors++
+			return nil
+		}
+		sylog.Debugf("Removed setuid/setgid/sticky bits from %s", path)
+		stripped++
+		return nil
+	})
+
+	if stripped > 0 {
+		sylog.Infof("Removed setuid/setgid/sticky bits from %d file(s)", stripped)
+	}
+	if errors > 0 {
+		err = fmt.Errorf("%d errors were encountered when removing setuid/setgid/sticky bits", errors)
+	}
+	return err
+}
+
 // checkPerms will work through the rootfs of this bundle, and find if any
 // directory does not have owner rwX - which may cause unexpected issues for a
 // user trying to look through, or delete a sandbox
@@ -0,0 +1,72 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sources
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStripSetuid(t *testing.T) {
+	rootfs, err := ioutil.TempDir("", "strip-setuid-")
+	if err != nil {
+		t.Fatalf("could not create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(rootfs)
+
+	tests := []struct {
+		name     string
+		dir      bool
+		mode     os.FileMode
+		expected os.FileMode
+	}{
+		{"setuid", false, 0755 | os.ModeSetuid, 0755},
+		{"setgid", false, 0755 | os.ModeSetgid, 0755},
+		{"sticky", false, 0644 | os.ModeSticky, 0644},
+		{"all", false, 0750 | os.ModeSetuid | os.ModeSetgid | os.ModeSticky, 0750},
+		{"plain", false, 0600, 0600},
+		// only the bits of regular files are stripped
+		{"sub/dir", true, 0775 | os.ModeSetgid | os.ModeSticky, 0775 | os.ModeSetgid | os.ModeSticky},
+		{"sub/dir/nested", false, 0755 | os.ModeSetuid, 0755},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(rootfs, tt.name)
+		if tt.dir {
+			err = os.MkdirAll(path, 0755)
+		} else {
+			err = ioutil.WriteFile(path, []byte(tt.name), 0600)
+		}
+		if err != nil {
+			t.Fatalf("could not create %s: %v", path, err)
+		}
+		if err := os.Chmod(path, tt.mode); err != nil {
+			t.Fatalf("could not set mode of %s: %v", path, err)
+		}
+	}
+	if err := os.Symlink("setuid", filepath.Join(rootfs, "link")); err != nil {
+		t.Fatalf("could not create symlink: %v", err)
+	}
+
+	if err := stripSetuid(rootfs); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, tt := range tests {
+		fi, err := os.Lstat(filepath.Join(rootfs, tt.name))
+		if err != nil {
+			t.Fatalf("could not stat %s: %v", tt.name, err)
+		}
+		mode := fi.Mode() & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)
+		if mode != tt.expected {
+			t.Errorf("unexpected mode %v of %s, expected %v", mode, tt.name, tt.expected)
+		}
+	}
+	if fi, err := os.Lstat(filepath.Join(rootfs, "link")); err != nil || fi.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("symlink not kept: %v", err)
+	}
+}
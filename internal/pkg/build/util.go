@@ -13,7 +13,6 @@ import (
 	"path/filepath"
 	"strings"
 
-	ocitypes "github.com/containers/image/v5/types"
 	"github.com/sylabs/singularity/internal/pkg/cache"
 	"github.com/sylabs/singularity/internal/pkg/util/env"
 	"github.com/sylabs/singularity/pkg/build/types"
@@ -22,26 +21,26 @@ import (
 	"golang.org/x/sys/unix"
 )
 
-// ConvertOciToSIf will convert an OCI source into a SIF using the build routines
-func ConvertOciToSIF(ctx context.Context, imgCache *cache.Handle, image, cachedImgPath, tmpDir string, noHTTPS, noCleanUp bool, authConf *ocitypes.DockerAuthConfig) error {
+// ConvertOciToSIF will convert an OCI source into a SIF using the build routines.
+// The build options are taken from opts, with the cache related fields set from
+// imgCache.
+func ConvertOciToSIF(ctx context.Context, imgCache *cache.Handle, image, cachedImgPath string, opts buildtypes.Options) error {
 	if imgCache == nil {
 		return fmt.Errorf("image cache is undefined")
 	}
 
+	// the layers aren't cached either if the image can't be
+	opts.NoCache = imgCache.IsDisabled() || imgCache.IsReadOnly()
+	opts.NoTest = true
+	opts.ImgCache = imgCache
+
 	b, err := NewBuild(
 		image,
 		Config{
 			Dest:      cachedImgPath,
 			Format:    "sif",
-			NoCleanUp: noCleanUp,
-			Opts: buildtypes.Options{
-				TmpDir:           tmpDir,
-				NoCache:          imgCache.IsDisabled(),
-				NoTest:           true,
-				NoHTTPS:          noHTTPS,
-				DockerAuthConfig: authConf,
-				ImgCache:         imgCache,
-			},
+			NoCleanUp: opts.NoCleanUp,
+			Opts:      opts,
 		},
 	)
 	if err != nil {
@@ -14,6 +14,7 @@ import (
 	"path"
 	"path/filepath"
 	"strconv"
+	"sync/atomic"
 	"time"
 
 	"github.com/sylabs/singularity/internal/pkg/util/fs"
@@ -24,6 +25,7 @@ import (
 var (
 	ErrBadChecksum      = errors.New("hash does not match")
 	ErrInvalidCacheType = errors.New("invalid cache type")
+	ErrReadOnly         = errors.New("cache is read-only")
 )
 
 const (
@@ -50,6 +52,10 @@ const (
 	OrasCacheType = "oras"
 	// The Net cache holds images pulled from http(s) internet sources
 	NetCacheType = "net"
+
+	// PartSuffix is the suffix of the partial files of the entries being
+	// created, renamed to the entry once complete.
+	PartSuffix = ".part"
 )
 
 var (
@@ -72,6 +78,12 @@ type Config struct {
 	ParentDir string
 	// Disable specifies whether the user request the cache to be disabled by default.
 	Disable bool
+	// PreserveOnError specifies whether the partial files of the entries
+	// that failed to be created are kept for inspection.
+	PreserveOnError bool
+	// ReadOnly specifies whether the cache is only read, e.g. when it is a
+	// shared read-only mount, the entries missing from it not being created.
+	ReadOnly bool
 }
 
 // Handle is an structure representing the image cache, it's location and subdirectories
@@ -86,6 +98,39 @@ type Handle struct {
 	rootDir string
 	// If the cache is disabled
 	disabled bool
+	// preserveOnError keeps the partial files of failed entries
+	preserveOnError bool
+	// readOnly is true if the entries are only looked up, never created
+	readOnly bool
+	// accesses counts the entry lookups if the handle is tracked
+	accesses *Accesses
+}
+
+// Accesses counts the lookups of file cache entries made through a
+// tracked handle.
+type Accesses struct {
+	hits   int32
+	misses int32
+}
+
+// Hits returns the number of lookups that found the entry in the cache.
+func (a *Accesses) Hits() int {
+	return int(atomic.LoadInt32(&a.hits))
+}
+
+// Misses returns the number of lookups that didn't find the entry in the
+// cache.
+func (a *Accesses) Misses() int {
+	return int(atomic.LoadInt32(&a.misses))
+}
+
+// Track returns a copy of the handle counting the entry lookups made
+// through it, so that the cache hits of a single pull can be reported
+// while other pulls share the cache.
+func (h *Handle) Track() (*Handle, *Accesses) {
+	t := *h
+	t.accesses = new(Accesses)
+	return &t, t.accesses
 }
 
 func (h *Handle) GetFileCacheDir(cacheType string) (cacheDir string, err error) {
@@ -102,6 +147,16 @@ func (h *Handle) GetOciCacheDir(cacheType string) (cacheDir string, err error) {
 	return h.getCacheTypeDir(cacheType), nil
 }
 
+// Lookup returns the path of the entry for a specified file cache type and
+// hash, and whether it exists, without creating nor accounting for it.
+func (h *Handle) Lookup(cacheType, hash string) (path string, exists bool, err error) {
+	if h.disabled {
+		return "", false, nil
+	}
+	path = filepath.Join(h.getCacheTypeDir(cacheType), hash)
+	return path, fs.IsFile(path), nil
+}
+
 // GetEntry returns a cache Entry for a specified file cache type and hash
 func (h *Handle) GetEntry(cacheType string, hash string) (e *Entry, err error) {
 	if h.disabled {
@@ -136,8 +191,15 @@ func (h *Handle) GetEntry(cacheType string, hash string) (e *Entry, err error) {
 	}
 
 	if !pathExists {
+		if h.accesses != nil {
+			atomic.AddInt32(&h.accesses.misses, 1)
+		}
+		if h.readOnly {
+			return nil, ErrReadOnly
+		}
 		e.Exists = false
-		f, err := fs.MakeTmpFile(cacheDir, "tmp_", 0700)
+		e.preserveOnError = h.preserveOnError
+		f, err := fs.MakeTmpFile(cacheDir, hash+".*"+PartSuffix, 0700)
 		if err != nil {
 			return nil, err
 		}
@@ -150,16 +212,57 @@ func (h *Handle) GetEntry(cacheType string, hash string) (e *Entry, err error) {
 	}
 
 	// Double check that there isn't something else weird there
-	if !fs.IsFile(e.Path) {
+	fi, err := os.Stat(e.Path)
+	if err != nil {
+		return nil, fmt.Errorf("could not check for cache entry '%s': %v", e.Path, err)
+	}
+	if !fi.Mode().IsRegular() {
 		return nil, fmt.Errorf("path '%s' exists but is not a file", e.Path)
 	}
+	if !h.readOnly {
+		recordAccess(e.Path, fi.ModTime())
+	}
 
 	// It exists in the cache and it's a file. Caller can use the Path directly
+	if h.accesses != nil {
+		atomic.AddInt32(&h.accesses.hits, 1)
+	}
 	e.Exists = true
 	return e, nil
 }
 
-func (h *Handle) CleanCache(cacheType string, dryRun bool, days int) (err error) {
+// GetResumableEntry returns a cache Entry for a specified file cache type
+// and hash like GetEntry, the TmpPath of a missing entry being the partial
+// file <hash>.part left by an interrupted download, if any, so that it can
+// be resumed. The partial file is locked until the entry is finalized or
+// cleaned, which keeps it unless empty. A new partial file is used while
+// another process downloads to it.
+func (h *Handle) GetResumableEntry(cacheType string, hash string) (e *Entry, err error) {
+	e, err = h.GetEntry(cacheType, hash)
+	if err != nil || e == nil || e.Exists {
+		return e, err
+	}
+
+	partial := filepath.Join(filepath.Dir(e.Path), hash+PartSuffix)
+	f, err := lockPartial(partial)
+	if err != nil {
+		e.CleanTmp()
+		return nil, fmt.Errorf("could not open partial cache file '%s': %v", partial, err)
+	}
+	if f == nil {
+		sylog.Debugf("Partial cache file %s is locked by another process", partial)
+		return e, nil
+	}
+	os.Remove(e.TmpPath)
+	e.TmpPath = partial
+	e.partial = f
+	return e, nil
+}
+
+// CleanCache removes the entries of cacheType older than days, or all of
+// them if days is negative. The pinned entries are kept unless removePinned
+// is true.
+func (h *Handle) CleanCache(cacheType string, dryRun bool, days int, removePinned bool) (err error) {
 	dir := h.getCacheTypeDir(cacheType)
 
 	files, err := ioutil.ReadDir(dir)
@@ -178,6 +281,12 @@ func (h *Handle) CleanCache(cacheType string, dryRun bool, days int) (err error)
 			}
 		}
 
+		pinned := h.IsPinned(cacheType, f.Name())
+		if pinned && !removePinned {
+			sylog.Infof("Keeping pinned %s cache entry: %s", cacheType, f.Name())
+			continue
+		}
+
 		sylog.Infof("Removing %s cache entry: %s", cacheType, f.Name())
 		if !dryRun {
 			// We RemoveAll in case the entry is a directory from Singularity <3.6
@@ -185,6 +294,10 @@ func (h *Handle) CleanCache(cacheType string, dryRun bool, days int) (err error)
 			if err != nil {
 				sylog.Errorf("Could not remove cache entry '%s': %v", f.Name(), err)
 				errCount = errCount + 1
+			} else if pinned {
+				if err := h.Unpin(cacheType, f.Name()); err != nil {
+					sylog.Warningf("While removing the pin of cache entry '%s': %v", f.Name(), err)
+				}
 			}
 		}
 	}
@@ -209,6 +322,9 @@ func (h *Handle) cleanAllCaches() {
 			sylog.Verbosef("unable to clean %s cache, directory %s: %v", ct, dir, err)
 		}
 	}
+	if err := os.RemoveAll(filepath.Join(h.rootDir, PinDirName)); err != nil {
+		sylog.Verbosef("unable to remove cache pins: %v", err)
+	}
 
 }
 
@@ -217,6 +333,38 @@ func (h *Handle) IsDisabled() bool {
 	return h.disabled
 }
 
+// IsReadOnly returns true if the cache is read-only, a miss being pulled
+// without going through the cache.
+func (h *Handle) IsReadOnly() bool {
+	return h.readOnly
+}
+
+// CheckWritable checks that entries can be written to the file cache
+// directories, e.g. that they weren't made read-only after their creation
+// or that the disk isn't full, by writing and removing a probe file in each
+// of them. Disabled and read-only caches are never written to.
+func (h *Handle) CheckWritable() error {
+	if h.disabled || h.readOnly {
+		return nil
+	}
+	for _, ct := range FileCacheTypes {
+		dir := h.getCacheTypeDir(ct)
+		f, err := ioutil.TempFile(dir, ".probe.*"+PartSuffix)
+		if err != nil {
+			return fmt.Errorf("cache directory %s is not writable: %v", dir, err)
+		}
+		_, err = f.Write([]byte("probe"))
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		os.Remove(f.Name())
+		if err != nil {
+			return fmt.Errorf("cache directory %s is not writable: %v", dir, err)
+		}
+	}
+	return nil
+}
+
 // Return the directory for a specific CacheType
 func (h *Handle) getCacheTypeDir(cacheType string) string {
 	return path.Join(h.rootDir, cacheType)
@@ -243,6 +391,7 @@ func New(cfg Config) (h *Handle, err error) {
 	if cacheDisabled || cfg.Disable {
 		h.disabled = true
 	}
+	h.preserveOnError = cfg.PreserveOnError
 	// If the cache is disabled, we stop here. Basically we return a valid handle that is not fully initialized
 	// since it would create the directories required by an enabled cache.
 	if h.disabled {
@@ -254,8 +403,23 @@ func New(cfg Config) (h *Handle, err error) {
 	if parentDir == "" {
 		parentDir = getCacheParentDir()
 	}
+	// the entries are located from other directories, e.g. to remove
+	// them on interrupt
+	if !filepath.IsAbs(parentDir) {
+		if parentDir, err = filepath.Abs(parentDir); err != nil {
+			return nil, fmt.Errorf("failed to get absolute path of cache directory: %v", err)
+		}
+	}
 	h.parentDir = parentDir
 
+	// A read-only cache is used as is, nothing is created nor checked for
+	// writing in it
+	if cfg.ReadOnly {
+		h.readOnly = true
+		h.rootDir = path.Join(parentDir, SubDirName)
+		return h, nil
+	}
+
 	ep, err := fs.FirstExistingParent(parentDir)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get first existing parent of cache directory: %v", err)
@@ -0,0 +1,238 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cache
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTrack(t *testing.T) {
+	h, cleanup := newTestHandle(t)
+	defer cleanup()
+
+	tracked, accesses := h.Track()
+
+	e, err := tracked.GetEntry(LibraryCacheType, "hash")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer e.CleanTmp()
+	if err := e.Finalize(); err != nil {
+		t.Fatalf("failed to finalize entry: %v", err)
+	}
+
+	if _, err := tracked.GetEntry(LibraryCacheType, "hash"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// lookups through the original handle aren't counted
+	if _, err := h.GetEntry(LibraryCacheType, "hash"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if accesses.Hits() != 1 || accesses.Misses() != 1 {
+		t.Errorf("expected 1 hit and 1 miss, got %d and %d", accesses.Hits(), accesses.Misses())
+	}
+}
+
+func TestEntryCleanTmp(t *testing.T) {
+	h, cleanup := newTestHandle(t)
+	defer cleanup()
+
+	for _, preserve := range []bool{false, true} {
+		h.preserveOnError = preserve
+
+		e, err := h.GetEntry(LibraryCacheType, "hash")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if name := filepath.Base(e.TmpPath); !strings.HasPrefix(name, "hash.") || !IsPartial(name) {
+			t.Errorf("unexpected partial file name %s", name)
+		}
+
+		// the entry failed to be created
+		e.CleanTmp()
+		if _, err := os.Stat(e.TmpPath); os.IsNotExist(err) == preserve {
+			t.Errorf("partial file kept=%v with preserveOnError=%v", !os.IsNotExist(err), preserve)
+		}
+
+		// partial files are never served as the entry
+		if e, err := h.GetEntry(LibraryCacheType, "hash"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		} else if e.Exists {
+			t.Errorf("partial file served as cache entry")
+		}
+	}
+}
+
+func TestGetResumableEntry(t *testing.T) {
+	h, cleanup := newTestHandle(t)
+	defer cleanup()
+
+	e, err := h.GetResumableEntry(LibraryCacheType, "hash")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if name := filepath.Base(e.TmpPath); name != "hash"+PartSuffix {
+		t.Errorf("unexpected partial file name %s", name)
+	}
+
+	// the partial file is locked by e
+	other, err := h.GetResumableEntry(LibraryCacheType, "hash")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if other.TmpPath == e.TmpPath {
+		t.Errorf("locked partial file %s used twice", e.TmpPath)
+	}
+	other.CleanTmp()
+
+	// the interrupted download is kept to be resumed
+	if err := ioutil.WriteFile(e.TmpPath, []byte("part"), 0600); err != nil {
+		t.Fatalf("failed to write partial file: %v", err)
+	}
+	e.CleanTmp()
+	if _, err := os.Stat(e.TmpPath); err != nil {
+		t.Fatalf("partial file not kept: %v", err)
+	}
+
+	e, err = h.GetResumableEntry(LibraryCacheType, "hash")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if b, err := ioutil.ReadFile(e.TmpPath); err != nil || string(b) != "part" {
+		t.Errorf("partial file not resumed: %q, %v", b, err)
+	}
+	if err := e.Finalize(); err != nil {
+		t.Fatalf("failed to finalize entry: %v", err)
+	}
+	if path, exists, _ := h.Lookup(LibraryCacheType, "hash"); !exists || path != e.Path {
+		t.Errorf("entry %s not finalized", e.Path)
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	h, cleanup := newTestHandle(t)
+	defer cleanup()
+
+	e, err := h.GetEntry(LibraryCacheType, "cached")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer e.CleanTmp()
+	if err := e.Finalize(); err != nil {
+		t.Fatalf("failed to finalize entry: %v", err)
+	}
+
+	ro, err := New(Config{ParentDir: h.parentDir, ReadOnly: true})
+	if err != nil {
+		t.Fatalf("failed to create read-only cache: %v", err)
+	}
+	if !ro.IsReadOnly() || ro.IsDisabled() {
+		t.Fatalf("expected an enabled read-only cache")
+	}
+
+	// hits are still served
+	if e, err := ro.GetEntry(LibraryCacheType, "cached"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if !e.Exists {
+		t.Errorf("cached entry not served by read-only cache")
+	}
+
+	// misses don't create anything
+	if _, err := ro.GetEntry(LibraryCacheType, "missing"); err != ErrReadOnly {
+		t.Errorf("expected %v on a miss, got %v", ErrReadOnly, err)
+	}
+	dir, _ := ro.GetFileCacheDir(LibraryCacheType)
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("failed to read cache directory: %v", err)
+	}
+	if len(files) != 1 {
+		t.Errorf("read-only cache miss wrote to the cache: %d files", len(files))
+	}
+
+	if l, err := ro.Lease(context.Background(), "library://alpine"); err != nil || l != nil {
+		t.Errorf("expected no lease from a read-only cache, got %v, %v", l, err)
+	}
+}
+
+func TestCheckWritable(t *testing.T) {
+	h, cleanup := newTestHandle(t)
+	defer cleanup()
+
+	if err := h.CheckWritable(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	dir, _ := h.GetFileCacheDir(NetCacheType)
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("failed to read cache directory: %v", err)
+	}
+	if len(files) != 0 {
+		t.Errorf("probe files left in the cache: %d files", len(files))
+	}
+
+	// a cache directory removed or replaced after its creation
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatalf("failed to remove cache directory: %v", err)
+	}
+	if err := ioutil.WriteFile(dir, nil, 0600); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	if err := h.CheckWritable(); err == nil {
+		t.Errorf("unexpected success checking an unwritable cache")
+	}
+
+	ro, err := New(Config{ParentDir: h.parentDir, ReadOnly: true})
+	if err != nil {
+		t.Fatalf("failed to create read-only cache: %v", err)
+	}
+	if err := ro.CheckWritable(); err != nil {
+		t.Errorf("unexpected error for a read-only cache: %v", err)
+	}
+}
+
+func TestNewRelativeParentDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache-relative-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("failed to get working directory: %v", err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatalf("failed to change directory: %v", err)
+	}
+	defer os.Chdir(wd)
+
+	h, err := New(Config{ParentDir: filepath.Join("shared", "user")})
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	if h.IsDisabled() {
+		t.Skip("cache directory is not writable")
+	}
+
+	want := filepath.Join(dir, "shared", "user", SubDirName)
+	if h.Root() != want {
+		t.Errorf("got cache root %s, want %s", h.Root(), want)
+	}
+	fi, err := os.Stat(want)
+	if err != nil {
+		t.Fatalf("cache root not created: %v", err)
+	}
+	if fi.Mode().Perm() != 0700 {
+		t.Errorf("got cache root permissions %o, want 700", fi.Mode().Perm())
+	}
+}
@@ -9,6 +9,8 @@ package cache
 import (
 	"fmt"
 	"os"
+	"strings"
+	"syscall"
 
 	"github.com/sylabs/singularity/internal/pkg/util/fs"
 	"github.com/sylabs/singularity/pkg/sylog"
@@ -27,6 +29,18 @@ type Entry struct {
 	// tmpPath is the temporary location that should be used for a new cache entry as it
 	// is created
 	TmpPath string
+	// preserveOnError keeps the file at TmpPath when the entry isn't finalized
+	preserveOnError bool
+	// partial is the locked partial file at TmpPath of a resumable entry,
+	// kept when the entry isn't finalized
+	partial *os.File
+}
+
+// IsPartial returns whether the file name of a cache directory is the
+// partial file of an entry being created, or left by a failed one.
+func IsPartial(name string) bool {
+	// tmp_ is the prefix used by older versions
+	return strings.HasSuffix(name, PartSuffix) || strings.HasPrefix(name, "tmp_")
 }
 
 // Finalize an entry by renaming it to its permanent path atomically
@@ -39,17 +53,53 @@ func (e *Entry) Finalize() error {
 	if err != nil {
 		return fmt.Errorf("could not finalize cached file: %v", err)
 	}
+	e.unlock()
 	return nil
 }
 
-// CleanTmp should be defer'd when an Entry is created and will remove any temporary file
+// unlock releases the lock on the partial file of a resumable entry.
+func (e *Entry) unlock() {
+	if e.partial != nil {
+		e.partial.Close()
+		e.partial = nil
+	}
+}
+
+// CleanTmp should be defer'd when an Entry is created and will remove any temporary file,
+// unless the cache preserves them on error
 func (e *Entry) CleanTmp() {
+	resumable := e.partial != nil
+	defer e.unlock()
+
 	// If there is no TmpPath / file there then there is nothing to clean up
 	if e.TmpPath == "" || !fs.IsFile(e.TmpPath) {
 		return
 	}
+	if fi, err := os.Stat(e.TmpPath); resumable && err == nil && fi.Size() > 0 {
+		sylog.Infof("Keeping partial download %s to resume it", e.TmpPath)
+		return
+	}
+	if e.preserveOnError {
+		sylog.Warningf("Keeping partial cache file for inspection: %s", e.TmpPath)
+		return
+	}
 	err := os.Remove(e.TmpPath)
 	if err != nil {
 		sylog.Errorf("Could not remove cache temporary file '%s': %v", e.TmpPath, err)
 	}
 }
+
+// lockPartial opens and locks the partial file at path, returning nil if
+// another process holds the lock.
+func lockPartial(path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0700)
+	if err != nil {
+		return nil, err
+	}
+	// the lock is released when f is closed
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		return nil, nil
+	}
+	return f, nil
+}
@@ -0,0 +1,76 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cache
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/sylabs/singularity/pkg/sylog"
+)
+
+// Evict removes the least recently used entries of the given cache types,
+// or of all the cache types if none is given, until they use at most
+// maxSize bytes. Entries older than days, unless negative, don't count as
+// they are removed by CleanCache, and pinned entries are kept unless
+// removePinned is true. The entries removed, or which would be with dryRun,
+// are returned least recently used first.
+func (h *Handle) Evict(maxSize int64, days int, dryRun bool, removePinned bool, cacheTypes ...string) ([]EntryInfo, error) {
+	entries, err := h.ListEntries(cacheTypes...)
+	if err != nil {
+		return nil, err
+	}
+
+	var size int64
+	candidates := make([]EntryInfo, 0, len(entries))
+	for _, e := range entries {
+		if days >= 0 && time.Since(e.ModTime) >= time.Duration(days*24)*time.Hour && (!e.Pinned || removePinned) {
+			continue
+		}
+		size += e.Size
+		if e.Pinned && !removePinned {
+			continue
+		}
+		candidates = append(candidates, e)
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].AccessTime.Before(candidates[j].AccessTime)
+	})
+
+	var evicted []EntryInfo
+	errCount := 0
+	for _, e := range candidates {
+		if size <= maxSize {
+			break
+		}
+		sylog.Infof("Removing %s cache entry: %s (last used %s)", e.Type, e.Name, e.AccessTime.Format(time.RFC3339))
+		if !dryRun {
+			// We RemoveAll in case the entry is a directory from Singularity <3.6
+			if err := os.RemoveAll(e.Path); err != nil {
+				sylog.Errorf("Could not remove cache entry '%s': %v", e.Name, err)
+				errCount++
+				continue
+			}
+			if e.Pinned {
+				if err := h.Unpin(e.Type, e.Name); err != nil {
+					sylog.Warningf("While removing the pin of cache entry '%s': %v", e.Name, err)
+				}
+			}
+		}
+		size -= e.Size
+		evicted = append(evicted, e)
+	}
+
+	if errCount > 0 {
+		return evicted, fmt.Errorf("failed to remove %d cache entries", errCount)
+	}
+	if size > maxSize {
+		sylog.Warningf("The cache still uses %d bytes, more than %d, once the unpinned entries are removed", size, maxSize)
+	}
+	return evicted, nil
+}
@@ -0,0 +1,83 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cache
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEvict(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxSize     int64
+		days        int
+		dryRun      bool
+		wantEvicted []string
+	}{
+		{name: "DryRun", maxSize: 200, days: -1, dryRun: true, wantEvicted: []string{"a", "c"}},
+		{name: "LeastRecentlyUsed", maxSize: 200, days: -1, wantEvicted: []string{"a", "c"}},
+		{name: "UnderLimit", maxSize: 400, days: -1},
+		{name: "OldEntriesRemoved", maxSize: 200, days: 5, wantEvicted: []string{"a"}},
+		{name: "PinnedKept", maxSize: 0, days: -1, wantEvicted: []string{"a", "c", "b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, cleanup := newTestHandle(t)
+			defer cleanup()
+
+			now := time.Now()
+			entries := []struct {
+				cacheType string
+				name      string
+				accessed  time.Time
+				modified  time.Time
+			}{
+				{NetCacheType, "a", now.Add(-3 * time.Hour), now},
+				{NetCacheType, "b", now.Add(-1 * time.Hour), now.Add(-10 * 24 * time.Hour)},
+				{NetCacheType, "c", now.Add(-2 * time.Hour), now},
+				{LibraryCacheType, "d", now.Add(-4 * time.Hour), now},
+			}
+			for _, e := range entries {
+				path := filepath.Join(h.getCacheTypeDir(e.cacheType), e.name)
+				if err := ioutil.WriteFile(path, make([]byte, 100), 0644); err != nil {
+					t.Fatalf("could not write cache entry: %v", err)
+				}
+				if err := os.Chtimes(path, e.accessed, e.modified); err != nil {
+					t.Fatalf("could not set times of %s: %v", path, err)
+				}
+			}
+			if err := h.Pin(LibraryCacheType, "d"); err != nil {
+				t.Fatalf("could not pin cache entry: %v", err)
+			}
+
+			evicted, err := h.Evict(tt.maxSize, tt.days, tt.dryRun, false)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var names []string
+			for _, e := range evicted {
+				names = append(names, e.Name)
+			}
+			if !reflect.DeepEqual(names, tt.wantEvicted) {
+				t.Errorf("got evicted %v, want %v", names, tt.wantEvicted)
+			}
+
+			for _, e := range evicted {
+				if _, err := os.Stat(e.Path); os.IsNotExist(err) != !tt.dryRun {
+					t.Errorf("got %s removed %v with dry run %v", e.Path, os.IsNotExist(err), tt.dryRun)
+				}
+			}
+			if _, err := os.Stat(filepath.Join(h.getCacheTypeDir(LibraryCacheType), "d")); err != nil {
+				t.Errorf("pinned entry removed: %v", err)
+			}
+		})
+	}
+}
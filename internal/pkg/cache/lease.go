@@ -0,0 +1,274 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cache
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/sylabs/singularity/pkg/sylog"
+)
+
+// LeaseDirName is the directory of the cache root holding the lease files.
+const LeaseDirName = "lease"
+
+var (
+	// leaseHeartbeat is the interval at which a lease holder refreshes
+	// its lease file.
+	leaseHeartbeat = 5 * time.Second
+	// leaseTimeout is the time after which a lease that wasn't refreshed
+	// is considered stale and can be taken over.
+	leaseTimeout = 30 * time.Second
+	// leasePoll is the interval at which a waiter checks the lease.
+	leasePoll = 500 * time.Millisecond
+)
+
+// leaseOwner is the content of a lease file, identifying its holder.
+type leaseOwner struct {
+	Host  string `json:"host"`
+	PID   int    `json:"pid"`
+	Token string `json:"token"`
+}
+
+// Lease is held by the process populating the cache for a given image, so
+// that concurrent pulls of the image, possibly from other nodes sharing the
+// cache, wait for it instead of downloading it again. The holder refreshes
+// the modification time of the lease file as a heartbeat, a lease whose
+// holder crashed is taken over once stale.
+type Lease struct {
+	path  string
+	owner []byte
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// Lease blocks until the calling process holds the lease of the image name,
+// e.g. its URI, or ctx is done. The caller must then check whether the
+// image was cached in the meantime before downloading it, and release the
+// lease once the cache entry is finalized. A nil lease is returned if the
+// cache is disabled or read-only.
+func (h *Handle) Lease(ctx context.Context, name string) (*Lease, error) {
+	if h.disabled || h.readOnly {
+		return nil, nil
+	}
+
+	dir := filepath.Join(h.rootDir, LeaseDirName)
+	if err := initCacheDir(dir); err != nil {
+		return nil, fmt.Errorf("failed initializing lease directory: %s", err)
+	}
+	sum := sha256.Sum256([]byte(name))
+	path := filepath.Join(dir, hex.EncodeToString(sum[:]))
+
+	owner, err := newLeaseOwner()
+	if err != nil {
+		return nil, err
+	}
+
+	waiting := false
+	for {
+		ok, err := createLease(path, owner)
+		if err != nil {
+			return nil, fmt.Errorf("could not create lease for %s: %v", name, err)
+		}
+		if ok {
+			l := &Lease{
+				path:  path,
+				owner: owner,
+				stop:  make(chan struct{}),
+			}
+			l.wg.Add(1)
+			go l.heartbeat()
+			return l, nil
+		}
+
+		if takenOver, err := takeOverStaleLease(path); err != nil {
+			return nil, fmt.Errorf("could not take over lease for %s: %v", name, err)
+		} else if takenOver {
+			continue
+		}
+
+		if !waiting {
+			sylog.Infof("Waiting for another process to populate the cache with %s", name)
+			waiting = true
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(leasePoll):
+		}
+	}
+}
+
+// Release stops the heartbeat and removes the lease file, unless it was
+// taken over.
+func (l *Lease) Release() error {
+	if l == nil {
+		return nil
+	}
+	close(l.stop)
+	l.wg.Wait()
+
+	if !l.held() {
+		return nil
+	}
+	if err := os.Remove(l.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("could not release lease: %v", err)
+	}
+	return nil
+}
+
+// heartbeat refreshes the lease file until the lease is released or lost.
+func (l *Lease) heartbeat() {
+	defer l.wg.Done()
+
+	ticker := time.NewTicker(leaseHeartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+		}
+		if !l.held() {
+			sylog.Warningf("Cache lease %s was taken over", l.path)
+			return
+		}
+		now := time.Now()
+		if err := os.Chtimes(l.path, now, now); err != nil {
+			sylog.Warningf("Could not refresh cache lease %s: %v", l.path, err)
+		}
+	}
+}
+
+// held returns whether the lease file is still the one of l.
+func (l *Lease) held() bool {
+	b, err := ioutil.ReadFile(l.path)
+	return err == nil && bytes.Equal(b, l.owner)
+}
+
+// newLeaseOwner returns the lease file content identifying this process,
+// with a random token telling apart the leases taken by its goroutines.
+func newLeaseOwner() ([]byte, error) {
+	host, err := os.Hostname()
+	if err != nil {
+		return nil, fmt.Errorf("could not get hostname: %v", err)
+	}
+	token := make([]byte, 8)
+	if _, err := rand.Read(token); err != nil {
+		return nil, fmt.Errorf("could not generate lease token: %v", err)
+	}
+	return json.Marshal(leaseOwner{
+		Host:  host,
+		PID:   os.Getpid(),
+		Token: hex.EncodeToString(token),
+	})
+}
+
+// createLease atomically creates the lease file at path with the content
+// owner, it returns false if it already exists.
+func createLease(path string, owner []byte) (bool, error) {
+	// the content is written before the lease file appears so that
+	// waiters never read a partial lease
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "tmp_")
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(owner); err != nil {
+		tmp.Close()
+		return false, err
+	}
+	if err := tmp.Close(); err != nil {
+		return false, err
+	}
+
+	if err := os.Link(tmp.Name(), path); os.IsExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// takeOverStaleLease removes the lease file at path if it is stale, it
+// returns true if the lease was removed or released in the meantime.
+func takeOverStaleLease(path string) (bool, error) {
+	b, fi, err := readLease(path)
+	if os.IsNotExist(err) {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+	if !leaseIsStale(b, fi) {
+		return false, nil
+	}
+
+	// the stale lease is moved aside and checked again, as another waiter
+	// may have replaced it with a new lease since it was read
+	aside := fmt.Sprintf("%s.stale.%d", path, os.Getpid())
+	if err := os.Rename(path, aside); os.IsNotExist(err) {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+	defer os.Remove(aside)
+
+	if moved, _ := ioutil.ReadFile(aside); !bytes.Equal(moved, b) {
+		// restore the new lease unless yet another one was created
+		if err := os.Link(aside, path); err != nil && !os.IsExist(err) {
+			return false, err
+		}
+		return false, nil
+	}
+
+	sylog.Warningf("Taking over stale cache lease %s held by %s", path, b)
+	return true, nil
+}
+
+// readLease returns the content and the file info of the lease at path.
+func readLease(path string) ([]byte, os.FileInfo, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return b, fi, nil
+}
+
+// leaseIsStale returns whether the lease with content b and file info fi
+// wasn't refreshed for leaseTimeout, or its holder on this host is gone.
+func leaseIsStale(b []byte, fi os.FileInfo) bool {
+	if time.Since(fi.ModTime()) > leaseTimeout {
+		return true
+	}
+
+	var owner leaseOwner
+	if err := json.Unmarshal(b, &owner); err != nil {
+		// unreadable leases are left to expire
+		return false
+	}
+	if host, err := os.Hostname(); err != nil || host != owner.Host {
+		return false
+	}
+	return syscall.Kill(owner.PID, 0) == syscall.ESRCH
+}
@@ -0,0 +1,211 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// setLeaseTimings shortens the lease timings, the returned function
+// restores them.
+func setLeaseTimings() func() {
+	heartbeat, timeout, poll := leaseHeartbeat, leaseTimeout, leasePoll
+	leaseHeartbeat, leaseTimeout, leasePoll = 10*time.Millisecond, 100*time.Millisecond, 5*time.Millisecond
+	return func() {
+		leaseHeartbeat, leaseTimeout, leasePoll = heartbeat, timeout, poll
+	}
+}
+
+// newTestHandle returns a cache in a temporary directory, removed by the
+// returned function.
+func newTestHandle(t *testing.T) (*Handle, func()) {
+	dir, err := ioutil.TempDir("", "cache-lease-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+
+	h, err := New(Config{ParentDir: dir})
+	if err != nil {
+		cleanup()
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	if h.IsDisabled() {
+		cleanup()
+		t.Skip("cache directory is not writable")
+	}
+	return h, cleanup
+}
+
+// writeLease writes a lease held by owner for name, last refreshed at mtime.
+func writeLease(t *testing.T, h *Handle, name string, owner leaseOwner, mtime time.Time) {
+	l, err := h.Lease(context.Background(), name)
+	if err != nil {
+		t.Fatalf("failed to create lease: %v", err)
+	}
+	close(l.stop)
+	l.wg.Wait()
+
+	b, err := json.Marshal(owner)
+	if err != nil {
+		t.Fatalf("failed to marshal lease owner: %v", err)
+	}
+	if err := ioutil.WriteFile(l.path, b, 0600); err != nil {
+		t.Fatalf("failed to write lease: %v", err)
+	}
+	if err := os.Chtimes(l.path, mtime, mtime); err != nil {
+		t.Fatalf("failed to set lease times: %v", err)
+	}
+}
+
+func TestLeaseConcurrentPopulators(t *testing.T) {
+	defer setLeaseTimings()()
+	h, cleanup := newTestHandle(t)
+	defer cleanup()
+
+	const name = "library://alpine:latest"
+	entry := filepath.Join(h.rootDir, LibraryCacheType, "alpine")
+
+	var downloads, holders int32
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+
+	for i := 0; i < cap(errs); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			l, err := h.Lease(context.Background(), name)
+			if err != nil {
+				errs <- err
+				return
+			}
+			defer l.Release()
+
+			if atomic.AddInt32(&holders, 1) != 1 {
+				t.Errorf("lease held by several populators")
+			}
+			defer atomic.AddInt32(&holders, -1)
+
+			if _, err := os.Stat(entry); os.IsNotExist(err) {
+				atomic.AddInt32(&downloads, 1)
+				// outlive the lease timeout, the heartbeat keeps it
+				time.Sleep(3 * leaseTimeout)
+				if err := ioutil.WriteFile(entry, []byte("image"), 0600); err != nil {
+					errs <- err
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if downloads != 1 {
+		t.Errorf("expected a single download, got %d", downloads)
+	}
+	if files, _ := ioutil.ReadDir(filepath.Join(h.rootDir, LeaseDirName)); len(files) != 0 {
+		t.Errorf("expected no lease file left, got %d", len(files))
+	}
+}
+
+func TestLeaseStaleTakeOver(t *testing.T) {
+	defer setLeaseTimings()()
+	h, cleanup := newTestHandle(t)
+	defer cleanup()
+
+	host, err := os.Hostname()
+	if err != nil {
+		t.Fatalf("failed to get hostname: %v", err)
+	}
+
+	// a process that exited stands for a crashed lease holder
+	cmd := exec.Command("true")
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("failed to run process: %v", err)
+	}
+	deadPID := cmd.Process.Pid
+
+	tests := []struct {
+		name     string
+		owner    leaseOwner
+		mtime    time.Time
+		takeOver bool
+	}{
+		{
+			name:     "CrashedLocalHolder",
+			owner:    leaseOwner{Host: host, PID: deadPID, Token: "dead"},
+			mtime:    time.Now(),
+			takeOver: true,
+		},
+		{
+			name:     "ExpiredRemoteHolder",
+			owner:    leaseOwner{Host: host + ".remote", PID: os.Getpid(), Token: "expired"},
+			mtime:    time.Now().Add(-2 * leaseTimeout),
+			takeOver: true,
+		},
+		{
+			name:     "LiveRemoteHolder",
+			owner:    leaseOwner{Host: host + ".remote", PID: deadPID, Token: "live"},
+			mtime:    time.Now().Add(time.Hour),
+			takeOver: false,
+		},
+		{
+			name:     "LiveLocalHolder",
+			owner:    leaseOwner{Host: host, PID: os.Getpid(), Token: "live"},
+			mtime:    time.Now().Add(time.Hour),
+			takeOver: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writeLease(t, h, tt.name, tt.owner, tt.mtime)
+
+			ctx, cancel := context.WithTimeout(context.Background(), leaseTimeout/2)
+			defer cancel()
+
+			l, err := h.Lease(ctx, tt.name)
+			if tt.takeOver {
+				if err != nil {
+					t.Fatalf("stale lease was not taken over: %v", err)
+				}
+				if !l.held() {
+					t.Errorf("lease taken over is not held")
+				}
+				if err := l.Release(); err != nil {
+					t.Errorf("failed to release lease: %v", err)
+				}
+			} else if err != context.DeadlineExceeded {
+				t.Errorf("expected to wait for the live lease, got %v", err)
+				l.Release()
+			}
+		})
+	}
+}
+
+func TestLeaseDisabledCache(t *testing.T) {
+	h := &Handle{disabled: true}
+
+	l, err := h.Lease(context.Background(), "library://alpine")
+	if err != nil || l != nil {
+		t.Errorf("unexpected lease with disabled cache: %v, %v", l, err)
+	}
+	if err := l.Release(); err != nil {
+		t.Errorf("unexpected error releasing nil lease: %v", err)
+	}
+}
@@ -0,0 +1,40 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cache
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// ListEntries returns the entries of the given cache types, or of all the
+// cache types if none is given, as Entries does, along with the time each
+// one was last used.
+func (h *Handle) ListEntries(cacheTypes ...string) ([]EntryInfo, error) {
+	entries, err := h.Entries(cacheTypes...)
+	if err != nil {
+		return nil, err
+	}
+	for i := range entries {
+		entries[i].AccessTime = accessTime(entries[i])
+	}
+	return entries, nil
+}
+
+// accessTime returns the last access time of the entry e, recorded on each
+// cache hit, or its modification time if unknown.
+func accessTime(e EntryInfo) time.Time {
+	fi, err := os.Lstat(e.Path)
+	if err != nil {
+		return e.ModTime
+	}
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return e.ModTime
+	}
+	return time.Unix(st.Atim.Unix())
+}
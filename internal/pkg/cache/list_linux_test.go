@@ -0,0 +1,51 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cache
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestListEntries(t *testing.T) {
+	h, cleanup := newTestHandle(t)
+	defer cleanup()
+
+	modified := time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)
+	accessed := time.Date(2020, 6, 15, 0, 0, 0, 0, time.UTC)
+	path := filepath.Join(h.getCacheTypeDir(LibraryCacheType), "sha256.0123")
+	if err := ioutil.WriteFile(path, make([]byte, 42), 0644); err != nil {
+		t.Fatalf("could not write cache entry: %v", err)
+	}
+	if err := os.Chtimes(path, accessed, modified); err != nil {
+		t.Fatalf("could not set times of %s: %v", path, err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(h.getCacheTypeDir(NetCacheType), "4567"), nil, 0644); err != nil {
+		t.Fatalf("could not write cache entry: %v", err)
+	}
+
+	entries, err := h.ListEntries(LibraryCacheType)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("got %d library entries, want 1", len(entries))
+	}
+	e := entries[0]
+	if e.Type != LibraryCacheType || e.Name != "sha256.0123" || e.Path != path || e.Size != 42 {
+		t.Errorf("unexpected entry %+v", e)
+	}
+	if !e.ModTime.Equal(modified) || !e.AccessTime.Equal(accessed) {
+		t.Errorf("got modified %s and accessed %s, want %s and %s", e.ModTime, e.AccessTime, modified, accessed)
+	}
+
+	if entries, err := h.ListEntries(); err != nil || len(entries) != 2 {
+		t.Errorf("got %d entries of all types with error %v, want 2", len(entries), err)
+	}
+}
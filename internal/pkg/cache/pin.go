@@ -0,0 +1,105 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sylabs/singularity/internal/pkg/util/fs"
+)
+
+// PinDirName is the directory of the cache root holding the pin files, one
+// per pinned entry in a directory per cache type.
+const PinDirName = "pin"
+
+// ErrNotPinned is returned when unpinning an entry which isn't pinned.
+var ErrNotPinned = errors.New("entry is not pinned")
+
+func (h *Handle) pinPath(cacheType, name string) string {
+	return filepath.Join(h.rootDir, PinDirName, cacheType, name)
+}
+
+// Pin protects the entry name of cacheType from being removed when the
+// cache is cleaned. Only the image entries can be pinned.
+func (h *Handle) Pin(cacheType, name string) error {
+	if h.disabled {
+		return fmt.Errorf("cache is disabled")
+	}
+	if !stringInSlice(cacheType, FileCacheTypes) {
+		return fmt.Errorf("%s cache entries can't be pinned, only images can", cacheType)
+	}
+	if !fs.IsFile(filepath.Join(h.getCacheTypeDir(cacheType), name)) {
+		return fmt.Errorf("no %s cache entry %s", cacheType, name)
+	}
+
+	path := h.pinPath(cacheType, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed initializing pin directory: %v", err)
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("could not pin %s cache entry %s: %v", cacheType, name, err)
+	}
+	return f.Close()
+}
+
+// Unpin removes the protection of the entry name of cacheType, ErrNotPinned
+// is returned if it wasn't pinned.
+func (h *Handle) Unpin(cacheType, name string) error {
+	if h.disabled {
+		return fmt.Errorf("cache is disabled")
+	}
+	err := os.Remove(h.pinPath(cacheType, name))
+	if os.IsNotExist(err) {
+		return ErrNotPinned
+	} else if err != nil {
+		return fmt.Errorf("could not unpin %s cache entry %s: %v", cacheType, name, err)
+	}
+	return nil
+}
+
+// IsPinned returns whether the entry name of cacheType is pinned.
+func (h *Handle) IsPinned(cacheType, name string) bool {
+	if h.disabled {
+		return false
+	}
+	return fs.IsFile(h.pinPath(cacheType, name))
+}
+
+// FindEntries returns the image entries of the given cache types, or of
+// all of them if none is given, whose name is ref or starts with it.
+func (h *Handle) FindEntries(ref string, cacheTypes ...string) ([]EntryInfo, error) {
+	if len(cacheTypes) == 0 {
+		cacheTypes = FileCacheTypes
+	}
+	entries, err := h.Entries(cacheTypes...)
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []EntryInfo
+	for _, e := range entries {
+		if e.Name == ref {
+			// an exact match wins over prefixes
+			return []EntryInfo{e}, nil
+		}
+		if strings.HasPrefix(e.Name, ref) && !IsPartial(e.Name) {
+			matches = append(matches, e)
+		}
+	}
+	return matches, nil
+}
+
+// recordAccess sets the access time of the entry at path, keeping its
+// modification time, so that entries can be told apart by their last use.
+func recordAccess(path string, modTime time.Time) {
+	os.Chtimes(path, time.Now(), modTime)
+}
@@ -0,0 +1,81 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cache
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPin(t *testing.T) {
+	h, cleanup := newTestHandle(t)
+	defer cleanup()
+
+	dir := h.getCacheTypeDir(NetCacheType)
+	for _, name := range []string{"abc123", "abc456", "def789"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(name), 0644); err != nil {
+			t.Fatalf("could not write cache entry: %v", err)
+		}
+	}
+
+	if err := h.Pin(NetCacheType, "missing"); err == nil {
+		t.Errorf("unexpected success pinning a missing entry")
+	}
+	if err := h.Pin(OciBlobCacheType, "abc123"); err == nil {
+		t.Errorf("unexpected success pinning a blob entry")
+	}
+	if err := h.Pin(NetCacheType, "abc123"); err != nil {
+		t.Fatalf("could not pin entry: %v", err)
+	}
+	if !h.IsPinned(NetCacheType, "abc123") || h.IsPinned(NetCacheType, "abc456") {
+		t.Errorf("unexpected pin status")
+	}
+
+	entries, err := h.Entries(NetCacheType)
+	if err != nil {
+		t.Fatalf("could not list entries: %v", err)
+	}
+	for _, e := range entries {
+		if e.Pinned != (e.Name == "abc123") {
+			t.Errorf("entry %s listed with pinned %v", e.Name, e.Pinned)
+		}
+	}
+
+	for ref, count := range map[string]int{"abc": 2, "abc123": 1, "def": 1, "xyz": 0} {
+		matches, err := h.FindEntries(ref)
+		if err != nil {
+			t.Fatalf("could not find entries: %v", err)
+		}
+		if len(matches) != count {
+			t.Errorf("%d entries found for %s, expected %d", len(matches), ref, count)
+		}
+	}
+
+	// the pinned entry survives cleaning, unless pinned entries are removed
+	if err := h.CleanCache(NetCacheType, false, 0, false); err != nil {
+		t.Fatalf("could not clean cache: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "abc123")); err != nil {
+		t.Errorf("pinned entry removed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "abc456")); !os.IsNotExist(err) {
+		t.Errorf("unpinned entry kept")
+	}
+	if err := h.CleanCache(NetCacheType, false, 0, true); err != nil {
+		t.Fatalf("could not clean cache: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "abc123")); !os.IsNotExist(err) {
+		t.Errorf("pinned entry kept")
+	}
+	if h.IsPinned(NetCacheType, "abc123") {
+		t.Errorf("pin of removed entry kept")
+	}
+	if err := h.Unpin(NetCacheType, "abc123"); err != ErrNotPinned {
+		t.Errorf("unexpected error unpinning: %v", err)
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cache
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"syscall"
+)
+
+// Stats describes the space used by the cache once the entries sharing
+// their content, as hard links, are accounted for.
+type Stats struct {
+	// Entries is the number of cache entries.
+	Entries int
+	// UniqueBlobs is the number of distinct files the entries are stored
+	// in.
+	UniqueBlobs int
+	// LogicalSize is the sum of the sizes of the entries in bytes.
+	LogicalSize int64
+	// PhysicalSize is the sum of the sizes of the distinct files in bytes.
+	PhysicalSize int64
+	// Top are the largest distinct files, up to the number requested,
+	// largest first.
+	Top []EntryInfo
+}
+
+// Saved returns the space saved by the deduplication of the entries in
+// bytes.
+func (s *Stats) Saved() int64 {
+	return s.LogicalSize - s.PhysicalSize
+}
+
+// fileID identifies a file whatever the links to it.
+type fileID struct {
+	dev uint64
+	ino uint64
+}
+
+// Stats returns the stats of the entries of the given cache types, or of all
+// the cache types if none is given, with up to top of the largest entries.
+func (h *Handle) Stats(top int, cacheTypes ...string) (*Stats, error) {
+	entries, err := h.Entries(cacheTypes...)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Stats{Entries: len(entries)}
+	seen := make(map[fileID]bool)
+	var unique []EntryInfo
+	for _, e := range entries {
+		s.LogicalSize += e.Size
+
+		fi, err := os.Lstat(e.Path)
+		if err != nil {
+			return nil, fmt.Errorf("unable to stat cache entry %s: %v", e.Path, err)
+		}
+		st, ok := fi.Sys().(*syscall.Stat_t)
+		if !ok {
+			return nil, fmt.Errorf("unable to stat cache entry %s", e.Path)
+		}
+		id := fileID{dev: uint64(st.Dev), ino: st.Ino}
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		s.PhysicalSize += e.Size
+		unique = append(unique, e)
+	}
+	s.UniqueBlobs = len(unique)
+
+	sort.SliceStable(unique, func(i, j int) bool {
+		return unique[i].Size > unique[j].Size
+	})
+	if len(unique) > top {
+		unique = unique[:top]
+	}
+	s.Top = unique
+	return s, nil
+}
@@ -0,0 +1,51 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cache
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	h, cleanup := newTestHandle(t)
+	defer cleanup()
+
+	dir := h.getCacheTypeDir(NetCacheType)
+	for name, size := range map[string]int{"small": 10, "large": 100} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), make([]byte, size), 0644); err != nil {
+			t.Fatalf("could not write cache entry: %v", err)
+		}
+	}
+	// the same content in another cache type
+	if err := os.Link(filepath.Join(dir, "large"), filepath.Join(h.getCacheTypeDir(LibraryCacheType), "large")); err != nil {
+		t.Fatalf("could not link cache entry: %v", err)
+	}
+
+	s, err := h.Stats(1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if s.Entries != 3 || s.UniqueBlobs != 2 {
+		t.Errorf("got %d entries and %d unique blobs, want 3 and 2", s.Entries, s.UniqueBlobs)
+	}
+	if s.LogicalSize != 210 || s.PhysicalSize != 110 || s.Saved() != 100 {
+		t.Errorf("got logical size %d, physical size %d, saved %d", s.LogicalSize, s.PhysicalSize, s.Saved())
+	}
+	if len(s.Top) != 1 || s.Top[0].Name != "large" {
+		t.Errorf("unexpected top entries %+v", s.Top)
+	}
+
+	s, err = h.Stats(5, NetCacheType)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if s.Entries != 2 || s.Saved() != 0 || len(s.Top) != 2 {
+		t.Errorf("unexpected stats of the net cache %+v", s)
+	}
+}
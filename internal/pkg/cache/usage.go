@@ -0,0 +1,114 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cache
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// EntryInfo describes an entry stored in the cache.
+type EntryInfo struct {
+	// Type is the cache type of the entry, e.g. 'library'.
+	Type string
+	// Name is the name of the entry, for most cache types the hash of its
+	// content.
+	Name string
+	// Path is the location of the entry.
+	Path string
+	// Size is the size of the entry in bytes.
+	Size int64
+	// ModTime is the modification time of the entry.
+	ModTime time.Time
+	// AccessTime is the time the entry was last used, only set by
+	// ListEntries.
+	AccessTime time.Time
+	// Pinned is true when the entry is protected from cache cleaning.
+	Pinned bool
+}
+
+// Root returns the root directory of the cache, or an empty string if the
+// cache is disabled.
+func (h *Handle) Root() string {
+	if h.disabled {
+		return ""
+	}
+	return h.rootDir
+}
+
+// ParentDir returns the parent directory of the cache root, the one it was
+// created with, or an empty string if the cache is disabled.
+func (h *Handle) ParentDir() string {
+	if h.disabled {
+		return ""
+	}
+	return h.parentDir
+}
+
+// EntriesDir returns the directory holding the entries of cacheType. For
+// the blob cache type this is the blob directory of the OCI layout.
+func (h *Handle) EntriesDir(cacheType string) (string, error) {
+	if stringInSlice(cacheType, OciCacheTypes) {
+		return filepath.Join(h.getCacheTypeDir(cacheType), "blobs", "sha256"), nil
+	}
+	return h.GetFileCacheDir(cacheType)
+}
+
+// Entries returns the entries of the given cache types, or of all the cache
+// types if none is given.
+func (h *Handle) Entries(cacheTypes ...string) ([]EntryInfo, error) {
+	if h.disabled {
+		return nil, nil
+	}
+	if len(cacheTypes) == 0 {
+		cacheTypes = append(OciCacheTypes, FileCacheTypes...)
+	}
+
+	var entries []EntryInfo
+	for _, cacheType := range cacheTypes {
+		dir, err := h.EntriesDir(cacheType)
+		if err != nil {
+			return nil, err
+		}
+
+		files, err := ioutil.ReadDir(dir)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("unable to open cache %s at directory %s: %v", cacheType, dir, err)
+		}
+
+		for _, f := range files {
+			entries = append(entries, EntryInfo{
+				Type:    cacheType,
+				Name:    f.Name(),
+				Path:    filepath.Join(dir, f.Name()),
+				Size:    f.Size(),
+				ModTime: f.ModTime(),
+				Pinned:  h.IsPinned(cacheType, f.Name()),
+			})
+		}
+	}
+	return entries, nil
+}
+
+// Usage returns the space used by the entries of the given cache types, or
+// of all the cache types if none is given, in bytes.
+func (h *Handle) Usage(cacheTypes ...string) (int64, error) {
+	entries, err := h.Entries(cacheTypes...)
+	if err != nil {
+		return 0, err
+	}
+
+	var size int64
+	for _, e := range entries {
+		size += e.Size
+	}
+	return size, nil
+}
@@ -0,0 +1,103 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package alias implements the shortnames expanded to full image URIs when
+// pulling images, similar to the shortnames of the containers registries.conf.
+package alias
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/sylabs/singularity/internal/pkg/util/uri"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Aliases maps shortnames to the full image URIs they expand to.
+type Aliases struct {
+	Aliases map[string]string `yaml:"aliases"`
+}
+
+// Load reads the aliases from the YAML or JSON file at path, a missing file
+// holding no aliases.
+func Load(path string) (*Aliases, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return &Aliases{}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("could not open aliases: %v", err)
+	}
+	defer f.Close()
+
+	a, err := ReadFrom(f)
+	if err != nil {
+		return nil, fmt.Errorf("invalid aliases %s: %v", path, err)
+	}
+	return a, nil
+}
+
+// ReadFrom reads aliases in YAML or JSON format from r. An alias is a
+// library image name without transport nor tag, expanding to an URI with a
+// transport.
+func ReadFrom(r io.Reader) (*Aliases, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	a := new(Aliases)
+	// JSON being a subset of YAML, both are decoded the same way
+	if err := yaml.UnmarshalStrict(b, a); err != nil {
+		return nil, err
+	}
+
+	for name, target := range a.Aliases {
+		if name == "" || strings.Contains(name, ":") || strings.HasPrefix(name, "/") || strings.HasSuffix(name, "/") {
+			return nil, fmt.Errorf("alias %q is not an image name without transport nor tag", name)
+		}
+		if t, ref := uri.Split(target); t == "" || strings.TrimPrefix(ref, "//") == "" {
+			return nil, fmt.Errorf("alias %q: %q is not an URI with a transport", name, target)
+		}
+	}
+	return a, nil
+}
+
+// Merge adds the aliases of o to a, those of o overriding the ones of a
+// with the same name.
+func (a *Aliases) Merge(o *Aliases) {
+	if len(o.Aliases) == 0 {
+		return
+	}
+	if a.Aliases == nil {
+		a.Aliases = make(map[string]string, len(o.Aliases))
+	}
+	for name, target := range o.Aliases {
+		a.Aliases[name] = target
+	}
+}
+
+// Expand returns the URI the alias ref expands to, ref being an alias with
+// or without the library:// transport, and whether ref is an alias. A ref
+// which isn't an alias is returned as is, an expanded URI is never expanded
+// again.
+func (a *Aliases) Expand(ref string) (string, bool) {
+	if a == nil {
+		return ref, false
+	}
+	name := ref
+	if t, r := uri.Split(ref); t == uri.Library {
+		name = strings.TrimPrefix(r, "//")
+	} else if t != "" {
+		return ref, false
+	}
+	target, ok := a.Aliases[name]
+	if !ok {
+		return ref, false
+	}
+	return target, true
+}
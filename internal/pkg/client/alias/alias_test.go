@@ -0,0 +1,102 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package alias
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testAliases = `
+aliases:
+  alpine: library://library/default/alpine:3.11
+  myorg/tools: library://myorg/prod/tools:stable
+  ubuntu: docker://ubuntu:20.04
+`
+
+func TestReadFrom(t *testing.T) {
+	a, err := ReadFrom(strings.NewReader(testAliases))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if n := len(a.Aliases); n != 3 {
+		t.Errorf("got %d aliases, want 3", n)
+	}
+
+	invalid := []string{
+		"aliases:\n  alpine:3.11: library://alpine",
+		"aliases:\n  /alpine: library://alpine",
+		"aliases:\n  alpine: alpine:3.11",
+		"aliases:\n  alpine: library://",
+		"shortnames:\n  alpine: library://alpine",
+	}
+	for _, s := range invalid {
+		if _, err := ReadFrom(strings.NewReader(s)); err == nil {
+			t.Errorf("unexpected success reading %q", s)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "alias-")
+	if err != nil {
+		t.Fatalf("could not create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	a, err := Load(filepath.Join(dir, "missing.yaml"))
+	if err != nil {
+		t.Fatalf("unexpected error loading a missing file: %s", err)
+	}
+	if len(a.Aliases) != 0 {
+		t.Errorf("unexpected aliases from a missing file: %v", a.Aliases)
+	}
+
+	path := filepath.Join(dir, "aliases.yaml")
+	if err := ioutil.WriteFile(path, []byte("aliases: [alpine]"), 0644); err != nil {
+		t.Fatalf("could not write aliases: %s", err)
+	}
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), path) {
+		t.Errorf("unexpected error loading invalid aliases: %v", err)
+	}
+}
+
+func TestExpand(t *testing.T) {
+	a, err := ReadFrom(strings.NewReader(testAliases))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	a.Merge(&Aliases{Aliases: map[string]string{"ubuntu": "docker://ubuntu:18.04"}})
+
+	tests := []struct {
+		ref      string
+		expected string
+		expanded bool
+	}{
+		{ref: "alpine", expected: "library://library/default/alpine:3.11", expanded: true},
+		{ref: "library://alpine", expected: "library://library/default/alpine:3.11", expanded: true},
+		{ref: "myorg/tools", expected: "library://myorg/prod/tools:stable", expanded: true},
+		{ref: "ubuntu", expected: "docker://ubuntu:18.04", expanded: true},
+		{ref: "alpine:3.12", expected: "alpine:3.12"},
+		{ref: "library://library/default/alpine:3.11", expected: "library://library/default/alpine:3.11"},
+		{ref: "docker://alpine", expected: "docker://alpine"},
+		{ref: "busybox", expected: "busybox"},
+	}
+	for _, tt := range tests {
+		got, expanded := a.Expand(tt.ref)
+		if got != tt.expected || expanded != tt.expanded {
+			t.Errorf("Expand(%q) = %q, %v, want %q, %v", tt.ref, got, expanded, tt.expected, tt.expanded)
+		}
+	}
+
+	var none *Aliases
+	if got, expanded := none.Expand("alpine"); got != "alpine" || expanded {
+		t.Errorf("unexpected expansion without aliases: %q", got)
+	}
+}
@@ -0,0 +1,44 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package client
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// ErrDigestMismatch is the error of a downloaded image whose hash isn't the
+// expected one.
+var ErrDigestMismatch = errors.New("image digest mismatch")
+
+// VerifyDigest checks that the file at path has the sha256 hash digest,
+// in the sha256:<hex> form. An empty digest is not checked.
+func VerifyDigest(path, digest string) error {
+	if digest == "" {
+		return nil
+	}
+	want := strings.ToLower(strings.TrimPrefix(digest, "sha256:"))
+
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("could not hash %s: %v", path, err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return fmt.Errorf("could not hash %s: %v", path, err)
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); got != want {
+		return fmt.Errorf("%w: got sha256:%s instead of the expected sha256:%s", ErrDigestMismatch, got, want)
+	}
+	return nil
+}
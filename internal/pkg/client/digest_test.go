@@ -0,0 +1,44 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package client
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestVerifyDigest(t *testing.T) {
+	f, err := ioutil.TempFile("", "digest-test-")
+	if err != nil {
+		t.Fatalf("could not create temporary file: %v", err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString("image"); err != nil {
+		t.Fatalf("could not write %s: %v", f.Name(), err)
+	}
+	f.Close()
+
+	tests := []struct {
+		name         string
+		digest       string
+		wantMismatch bool
+	}{
+		{"Empty", "", false},
+		{"Match", "sha256:6105d6cc76af400325e94d588ce511be5bfdbb73b437dc51eca43917d7a43e3d", false},
+		{"MatchUpperCase", "sha256:6105D6CC76AF400325E94D588CE511BE5BFDBB73B437DC51ECA43917D7A43E3D", false},
+		{"Mismatch", "sha256:0000000000000000000000000000000000000000000000000000000000000000", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifyDigest(f.Name(), tt.digest)
+			if got := errors.Is(err, ErrDigestMismatch); got != tt.wantMismatch || (err != nil && !got) {
+				t.Errorf("got error %v, want mismatch %v", err, tt.wantMismatch)
+			}
+		})
+	}
+}
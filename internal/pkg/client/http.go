@@ -0,0 +1,134 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WithConnectTimeout returns a copy of ctx canceled when a connection made
+// for a request with it takes longer to establish than the connect timeout
+// of its settings, for the clients whose transport isn't HTTPTransport, e.g.
+// those of containers/image. The returned function releases the context,
+// and returns the error of the connection which timed out, if any, to be
+// returned instead of the cancellation.
+func WithConnectTimeout(ctx context.Context) (context.Context, func() error) {
+	timeout := SettingsFromContext(ctx).ConnectTimeout
+	if timeout == 0 {
+		return ctx, func() error { return nil }
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	var mu sync.Mutex
+	var timedOut error
+	// the timers of the connections being established, by address
+	timers := make(map[string][]*time.Timer)
+	trace := &httptrace.ClientTrace{
+		ConnectStart: func(network, addr string) {
+			t := time.AfterFunc(timeout, func() {
+				mu.Lock()
+				if timedOut == nil {
+					timedOut = fmt.Errorf("could not connect to %s within the connect timeout of %s", addr, timeout)
+				}
+				mu.Unlock()
+				cancel()
+			})
+			mu.Lock()
+			timers[addr] = append(timers[addr], t)
+			mu.Unlock()
+		},
+		ConnectDone: func(network, addr string, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if t := timers[addr]; len(t) > 0 {
+				t[0].Stop()
+				timers[addr] = t[1:]
+			}
+		},
+	}
+	return httptrace.WithClientTrace(ctx, trace), func() error {
+		cancel()
+		mu.Lock()
+		defer mu.Unlock()
+		return timedOut
+	}
+}
+
+// ParseSOCKS5Proxy parses the SOCKS5 proxy s, as [user[:password]@]host:port
+// optionally prefixed by socks5://.
+func ParseSOCKS5Proxy(s string) (*url.URL, error) {
+	if !strings.Contains(s, "://") {
+		s = "socks5://" + s
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "socks5" {
+		return nil, fmt.Errorf("unsupported proxy scheme %s, only socks5 is supported", u.Scheme)
+	}
+	if u.Hostname() == "" || u.Port() == "" {
+		return nil, fmt.Errorf("proxy %s must be given as host:port", u.Host)
+	}
+	if u.Path != "" || u.RawQuery != "" {
+		return nil, fmt.Errorf("unexpected path in proxy %s", s)
+	}
+	return u, nil
+}
+
+// NewHTTPClient returns an HTTP client whose requests time out after
+// timeout, zero meaning no timeout, and whose connections are established
+// within the connect timeout of the settings of the context of each
+// request, through their SOCKS5 proxy if any.
+func NewHTTPClient(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Transport: HTTPTransport(),
+		Timeout:   timeout,
+	}
+}
+
+// transport is the transport of the clients returned by NewHTTPClient.
+var transport = newTransport()
+
+// HTTPTransport returns the transport used by the clients returned by
+// NewHTTPClient.
+func HTTPTransport() http.RoundTripper {
+	return transport
+}
+
+// newTransport returns a transport connecting as set in the settings of the
+// context of each request, as the default transport does otherwise.
+func newTransport() *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	dial := t.DialContext
+	t.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		timeout := SettingsFromContext(ctx).ConnectTimeout
+		if timeout == 0 {
+			return dial(ctx, network, addr)
+		}
+		// also bounds the connection to the proxy
+		d := &net.Dialer{
+			Timeout:   timeout,
+			KeepAlive: 30 * time.Second,
+		}
+		return d.DialContext(ctx, network, addr)
+	}
+	t.Proxy = func(req *http.Request) (*url.URL, error) {
+		if u := SettingsFromContext(req.Context()).SOCKS5Proxy; u != nil {
+			return u, nil
+		}
+		return http.ProxyFromEnvironment(req)
+	}
+	return t
+}
@@ -0,0 +1,217 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package client
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewHTTPClient(t *testing.T) {
+	c := NewHTTPClient(time.Minute)
+	if c.Transport != HTTPTransport() {
+		t.Errorf("transport of the settings not used")
+	}
+	if c.Timeout != time.Minute {
+		t.Errorf("unexpected timeout %s", c.Timeout)
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	for _, s := range []Settings{{}, {ConnectTimeout: 5 * time.Second}} {
+		req, err := http.NewRequestWithContext(WithSettings(context.Background(), s), http.MethodGet, srv.URL, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		res, err := NewHTTPClient(0).Do(req)
+		if err != nil {
+			t.Fatalf("unexpected error with connect timeout %s: %s", s.ConnectTimeout, err)
+		}
+		res.Body.Close()
+	}
+}
+
+func TestWithConnectTimeout(t *testing.T) {
+	ctx, done := WithConnectTimeout(context.Background())
+	if ctx != context.Background() || done() != nil {
+		t.Errorf("context changed without a connect timeout")
+	}
+
+	settings := WithSettings(context.Background(), Settings{ConnectTimeout: 100 * time.Millisecond})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	ctx, done = WithConnectTimeout(settings)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	// not the transport of NewHTTPClient, as for containers/image
+	res, err := (&http.Client{Transport: &http.Transport{}}).Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	res.Body.Close()
+	time.Sleep(200 * time.Millisecond)
+	if err := done(); err != nil {
+		t.Errorf("unexpected timeout: %s", err)
+	}
+
+	// a connection never established
+	ctx, done = WithConnectTimeout(settings)
+	httptrace.ContextClientTrace(ctx).ConnectStart("tcp", "192.0.2.1:443")
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("context not canceled by the connect timeout")
+	}
+	if err := done(); err == nil || !strings.Contains(err.Error(), "192.0.2.1:443") {
+		t.Errorf("unexpected error %v, expected a connect timeout", err)
+	}
+}
+
+// serveSOCKS5 serves the CONNECT command of SOCKS5 on l, with the
+// username/password authentication if user is set, sending the addresses
+// it relays connections to on relayed.
+func serveSOCKS5(l net.Listener, user, password string, relayed chan<- string) {
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go func(c net.Conn) {
+			defer c.Close()
+			b := make([]byte, 2)
+			if _, err := io.ReadFull(c, b); err != nil {
+				return
+			}
+			io.ReadFull(c, make([]byte, b[1]))
+			if user == "" {
+				c.Write([]byte{5, 0})
+			} else {
+				c.Write([]byte{5, 2})
+				// version, then user and password prefixed by their length
+				io.ReadFull(c, b[:1])
+				u := readSOCKS5String(c)
+				p := readSOCKS5String(c)
+				if u != user || p != password {
+					c.Write([]byte{1, 1})
+					return
+				}
+				c.Write([]byte{1, 0})
+			}
+
+			req := make([]byte, 4)
+			if _, err := io.ReadFull(c, req); err != nil {
+				return
+			}
+			var host string
+			switch req[3] {
+			case 1:
+				ip := make([]byte, 4)
+				io.ReadFull(c, ip)
+				host = net.IP(ip).String()
+			case 3:
+				host = readSOCKS5String(c)
+			default:
+				return
+			}
+			port := make([]byte, 2)
+			io.ReadFull(c, port)
+			addr := net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port))))
+
+			remote, err := net.Dial("tcp", addr)
+			if err != nil {
+				c.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+				return
+			}
+			defer remote.Close()
+			c.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+			relayed <- addr
+			go io.Copy(remote, c)
+			io.Copy(c, remote)
+		}(c)
+	}
+}
+
+func readSOCKS5String(r io.Reader) string {
+	n := make([]byte, 1)
+	io.ReadFull(r, n)
+	s := make([]byte, n[0])
+	io.ReadFull(r, s)
+	return string(s)
+}
+
+func TestSOCKS5Proxy(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	defer l.Close()
+	relayed := make(chan string, 1)
+	go serveSOCKS5(l, "user", "secret", relayed)
+
+	tests := []struct {
+		name  string
+		proxy string
+		ok    bool
+	}{
+		{"Auth", "user:secret@" + l.Addr().String(), true},
+		{"WrongPassword", "socks5://user:wrong@" + l.Addr().String(), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := ParseSOCKS5Proxy(tt.proxy)
+			if err != nil {
+				t.Fatalf("could not parse proxy: %v", err)
+			}
+			env := os.Getenv("HTTPS_PROXY")
+			req, err := http.NewRequestWithContext(WithSettings(context.Background(), Settings{SOCKS5Proxy: u}), http.MethodGet, srv.URL, nil)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if os.Getenv("HTTPS_PROXY") != env {
+				t.Errorf("proxy environment changed")
+			}
+
+			res, err := NewHTTPClient(time.Minute).Do(req)
+			if !tt.ok {
+				if err == nil {
+					res.Body.Close()
+					t.Fatalf("unexpected success")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			res.Body.Close()
+			if addr := <-relayed; addr != srv.Listener.Addr().String() {
+				t.Errorf("proxy relayed %s instead of %s", addr, srv.Listener.Addr())
+			}
+		})
+	}
+
+	for _, p := range []string{"http://host:1080", "host", "socks5://host:1080/path"} {
+		if _, err := ParseSOCKS5Proxy(p); err == nil {
+			t.Errorf("unexpected success parsing proxy %s", p)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package library
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	scs "github.com/sylabs/scs-library-client/client"
+	"github.com/sylabs/singularity/internal/pkg/util/uri"
+)
+
+// ImageChoice is a tag and architecture for which an image is available.
+type ImageChoice struct {
+	Tag  string
+	Arch string
+}
+
+func (c ImageChoice) String() string {
+	return c.Tag + " (" + c.Arch + ")"
+}
+
+// AmbiguousRefError is returned when a library reference doesn't resolve to
+// an image for the requested architecture, while other tags or architectures
+// of the container are available.
+type AmbiguousRefError struct {
+	Ref     string
+	Arch    string
+	Choices []ImageChoice
+}
+
+func (e *AmbiguousRefError) Error() string {
+	choices := make([]string, 0, len(e.Choices))
+	for _, c := range e.Choices {
+		choices = append(choices, c.String())
+	}
+	return fmt.Sprintf("image %s not found for architecture %s, available: %s", e.Ref, e.Arch, strings.Join(choices, ", "))
+}
+
+// CheckRef checks that the library reference pullFrom resolves to an image
+// for arch. An *AmbiguousRefError listing the available tags and
+// architectures is returned if it doesn't but its container exists.
+// References pinned by hash aren't checked.
+func CheckRef(ctx context.Context, scsConfig *scs.Config, pullFrom, arch string) error {
+	scsConfig, pullFrom = hostConfig(scsConfig, pullFrom)
+	imageRef := NormalizeLibraryRef(pullFrom)
+	if _, ok := pinnedHash(imageRef); ok {
+		// checked against the downloaded image
+		return nil
+	}
+
+	c, err := scs.NewClient(scsConfig)
+	if err != nil {
+		return fmt.Errorf("unable to initialize client library: %v", err)
+	}
+
+	_, err = c.GetImage(ctx, arch, imageRef)
+	if err != scs.ErrNotFound {
+		return err
+	}
+	return notFoundError(ctx, c, imageRef, arch)
+}
+
+// NotFoundError returns the error of the library reference pullFrom found
+// to resolve to no image for arch: an *AmbiguousRefError listing the
+// available tags and architectures if its container exists, else one
+// wrapping ErrImageNotFound. Unlike CheckRef, the image isn't looked up
+// again.
+func NotFoundError(ctx context.Context, scsConfig *scs.Config, pullFrom, arch string) error {
+	scsConfig, pullFrom = hostConfig(scsConfig, pullFrom)
+	imageRef := NormalizeLibraryRef(pullFrom)
+
+	c, err := scs.NewClient(scsConfig)
+	if err != nil {
+		return fmt.Errorf("unable to initialize client library: %v", err)
+	}
+	return notFoundError(ctx, c, imageRef, arch)
+}
+
+// notFoundError returns the error of the normalized library reference
+// imageRef resolving to no image for arch, see NotFoundError.
+func notFoundError(ctx context.Context, c *scs.Client, imageRef, arch string) error {
+	choices, err := getChoices(ctx, c, imageRef)
+	if err != nil || len(choices) == 0 {
+		return fmt.Errorf("%w: %s (%s)", ErrImageNotFound, imageRef, arch)
+	}
+	return &AmbiguousRefError{Ref: imageRef, Arch: arch, Choices: choices}
+}
+
+// WithTag returns the library reference pullFrom with its tag replaced.
+func WithTag(pullFrom, tag string) string {
+	_, hostless := uri.SplitLibraryHost(pullFrom)
+	ref := NormalizeLibraryRef(hostless)
+	ref = ref[:strings.LastIndex(ref, ":")]
+	return withHost(pullFrom, ref+":"+tag)
+}
+
+// getChoices returns the tags and architectures available for the container
+// of the library reference imageRef.
+func getChoices(ctx context.Context, c *scs.Client, imageRef string) ([]ImageChoice, error) {
+	containerRef := imageRef[:strings.LastIndex(imageRef, ":")]
+
+	var cr scs.ContainerResponse
+	if err := getJSON(ctx, c, "v1/containers/"+containerRef, &cr); err != nil {
+		return nil, fmt.Errorf("container %s: %v", containerRef, err)
+	}
+
+	var choices []ImageChoice
+	for arch, tags := range cr.Data.ArchTags {
+		for tag := range tags {
+			choices = append(choices, ImageChoice{Tag: tag, Arch: arch})
+		}
+	}
+	sort.Slice(choices, func(i, j int) bool {
+		if choices[i].Tag != choices[j].Tag {
+			return choices[i].Tag < choices[j].Tag
+		}
+		return choices[i].Arch < choices[j].Arch
+	})
+	return choices, nil
+}
+
+// getJSON decodes into v the library API response for path, e.g.
+// v1/containers/entity/collection/container.
+func getJSON(ctx context.Context, c *scs.Client, path string, v interface{}) error {
+	u := c.BaseURL.ResolveReference(&url.URL{Path: path})
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	if c.AuthToken != "" {
+		req.Header.Set("Authorization", "BEARER "+c.AuthToken)
+	}
+	if c.UserAgent != "" {
+		req.Header.Set("User-Agent", c.UserAgent)
+	}
+
+	res, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s", http.StatusText(res.StatusCode))
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+		return fmt.Errorf("error decoding response: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package library
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sylabs/scs-library-client/client"
+)
+
+func TestCheckRef(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/images/user/collection/container:latest":
+			if r.URL.Query().Get("arch") == "amd64" {
+				w.Write([]byte(`{"data": {"hash": "sha256.0123"}}`))
+				return
+			}
+		case "/v1/containers/user/collection/container":
+			w.Write([]byte(`{"data": {"archTags": {"amd64": {"latest": "1", "1.0": "2"}, "arm64": {"1.0": "3"}}}}`))
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	config := &client.Config{BaseURL: srv.URL}
+
+	tests := []struct {
+		name      string
+		ref       string
+		arch      string
+		expectErr bool
+		choices   []ImageChoice
+	}{
+		{"found", "library://user/collection/container", "amd64", false, nil},
+		{"missing arch", "library://user/collection/container:latest", "ppc64le", true, []ImageChoice{
+			{"1.0", "amd64"},
+			{"1.0", "arm64"},
+			{"latest", "amd64"},
+		}},
+		{"missing container", "library://user/collection/other:latest", "amd64", true, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckRef(context.Background(), config, tt.ref, tt.arch)
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			ambiguous, ok := err.(*AmbiguousRefError)
+			if tt.choices == nil {
+				if ok {
+					t.Fatalf("unexpected ambiguous reference: %v", err)
+				}
+				return
+			}
+			if !ok {
+				t.Fatalf("expected an ambiguous reference error, got: %v", err)
+			}
+			if !reflect.DeepEqual(ambiguous.Choices, tt.choices) {
+				t.Errorf("expected choices %v, got %v", tt.choices, ambiguous.Choices)
+			}
+		})
+	}
+}
+
+func TestNotFoundError(t *testing.T) {
+	var images int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/containers/user/collection/container" {
+			w.Write([]byte(`{"data": {"archTags": {"amd64": {"latest": "1"}}}}`))
+			return
+		}
+		if strings.HasPrefix(r.URL.Path, "/v1/images/") {
+			images++
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	config := &client.Config{BaseURL: srv.URL}
+
+	err := NotFoundError(context.Background(), config, "library://user/collection/container:latest", "arm64")
+	ambiguous, ok := err.(*AmbiguousRefError)
+	if !ok {
+		t.Fatalf("expected an ambiguous reference error, got: %v", err)
+	}
+	if want := []ImageChoice{{"latest", "amd64"}}; !reflect.DeepEqual(ambiguous.Choices, want) {
+		t.Errorf("expected choices %v, got %v", want, ambiguous.Choices)
+	}
+
+	err = NotFoundError(context.Background(), config, "library://user/collection/other:latest", "amd64")
+	if !errors.Is(err, ErrImageNotFound) {
+		t.Errorf("expected an image not found error, got: %v", err)
+	}
+
+	if images > 0 {
+		t.Errorf("image looked up %d times, expected none", images)
+	}
+}
+
+func TestWithTag(t *testing.T) {
+	tests := []struct {
+		ref      string
+		tag      string
+		expected string
+	}{
+		{"library://alpine", "3.11", "library://alpine:3.11"},
+		{"user/collection/container:latest", "1.0", "library://user/collection/container:1.0"},
+	}
+
+	for _, tt := range tests {
+		if got := WithTag(tt.ref, tt.tag); got != tt.expected {
+			t.Errorf("WithTag(%q, %q): expected %s, got %s", tt.ref, tt.tag, tt.expected, got)
+		}
+	}
+}
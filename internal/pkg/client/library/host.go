@@ -0,0 +1,53 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package library
+
+import (
+	"net/url"
+	"strings"
+
+	scs "github.com/sylabs/scs-library-client/client"
+	"github.com/sylabs/singularity/internal/pkg/util/uri"
+	"github.com/sylabs/singularity/pkg/sylog"
+)
+
+// hostConfig returns the configuration to reach the library of the URI
+// pullFrom with, and the URI without its host. URIs with a host, e.g.
+// library://example.com/user/collection/image, are pulled from the library
+// at that host, over the scheme of scsConfig, rather than from the one of
+// scsConfig, which is only used for the hostless URIs. The authentication
+// token of scsConfig is not sent to another host.
+func hostConfig(scsConfig *scs.Config, pullFrom string) (*scs.Config, string) {
+	host, hostless := uri.SplitLibraryHost(pullFrom)
+	if host == "" {
+		return scsConfig, pullFrom
+	}
+
+	c := scs.Config{}
+	if scsConfig != nil {
+		c = *scsConfig
+	}
+	scheme := "https"
+	if u, err := url.Parse(c.BaseURL); err == nil && u.Host != "" {
+		if strings.EqualFold(u.Host, host) {
+			return scsConfig, hostless
+		}
+		scheme = u.Scheme
+	}
+	c.BaseURL = scheme + "://" + host
+	c.AuthToken = ""
+	sylog.Debugf("Using the library at %s for %s", c.BaseURL, pullFrom)
+	return &c, hostless
+}
+
+// withHost returns the library URI of the normalized library reference ref
+// at the host of pullFrom, if it has one.
+func withHost(pullFrom, ref string) string {
+	if host, _ := uri.SplitLibraryHost(pullFrom); host != "" {
+		return "library://" + host + "/" + ref
+	}
+	return "library://" + ref
+}
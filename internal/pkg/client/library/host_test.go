@@ -0,0 +1,73 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package library
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sylabs/scs-library-client/client"
+)
+
+func TestHostConfig(t *testing.T) {
+	config := &client.Config{BaseURL: "https://library.example.com", AuthToken: "token"}
+
+	tests := []struct {
+		name      string
+		pullFrom  string
+		baseURL   string
+		token     string
+		wantImage string
+	}{
+		{"Hostless", "library://user/collection/image", "https://library.example.com", "token", "library://user/collection/image"},
+		{"SameHost", "library://Library.Example.com/user/collection/image", "https://library.example.com", "token", "library://user/collection/image"},
+		{"OtherHost", "library://other.example.com:8443/user/collection/image", "https://other.example.com:8443", "", "library://user/collection/image"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, pullFrom := hostConfig(config, tt.pullFrom)
+			if c.BaseURL != tt.baseURL || c.AuthToken != tt.token {
+				t.Errorf("got library %s with token %q, want %s with token %q", c.BaseURL, c.AuthToken, tt.baseURL, tt.token)
+			}
+			if pullFrom != tt.wantImage {
+				t.Errorf("got image %s, want %s", pullFrom, tt.wantImage)
+			}
+		})
+	}
+	if config.BaseURL != "https://library.example.com" || config.AuthToken != "token" {
+		t.Errorf("configuration modified: %+v", config)
+	}
+}
+
+func TestResolveHost(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/images/user/collection/container:latest" {
+			w.Write([]byte(`{"data": {"hash": "sha256.0123", "tags": ["latest"]}}`))
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+	host := strings.TrimPrefix(srv.URL, "http://")
+
+	// --library points at another server, which isn't reachable
+	config := &client.Config{BaseURL: "http://127.0.0.1:1"}
+
+	resolved, err := Resolve(context.Background(), config, "library://"+host+"/user/collection/container", "amd64")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := "library://" + host + "/user/collection/container:sha256.0123"; resolved.Pinned != want {
+		t.Errorf("got pinned reference %s, want %s", resolved.Pinned, want)
+	}
+
+	if _, err := Resolve(context.Background(), config, "library://user/collection/container", "amd64"); err == nil {
+		t.Errorf("unexpected success resolving a hostless reference against the unreachable --library")
+	}
+}
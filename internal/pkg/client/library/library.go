@@ -7,65 +7,299 @@ package library
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
+	"net/url"
 	"os"
+	"regexp"
+	"strconv"
 	"strings"
 
-	"github.com/sylabs/singularity/pkg/sylog"
-
 	scslibrary "github.com/sylabs/scs-library-client/client"
 	"github.com/sylabs/singularity/internal/pkg/client"
+	"github.com/sylabs/singularity/pkg/sylog"
 )
 
 const defaultTag = "latest"
 
+// pinnedHashRegexp matches the library hash of an image used as its tag.
+var pinnedHashRegexp = regexp.MustCompile(`^sha256\.[0-9a-f]{64}$`)
+
 // NormalizeLibraryRef strips off leading "library://" prefix, if any, and
-// appends the default tag (latest) if none specified.
+// appends the default tag (latest) if none specified. A @sha256:<digest> is
+// replaced with the :sha256.<digest> tag the library serves the image by.
 func NormalizeLibraryRef(libraryRef string) string {
 	ir := strings.TrimPrefix(libraryRef, "library://")
+	if i := strings.LastIndex(ir, "@sha256:"); i >= 0 {
+		ir = ir[:i] + ":sha256." + ir[i+len("@sha256:"):]
+	}
 	if !strings.Contains(ir, ":") {
 		return ir + ":" + defaultTag
 	}
 	return ir
 }
 
-// DownloadImage is a helper function to wrap library image download operation
+// pinnedHash returns the hash the normalized library reference imageRef is
+// pinned to, e.g. sha256.<digest> for container:sha256.<digest>, ok being
+// false for a tag.
+func pinnedHash(imageRef string) (hash string, ok bool) {
+	hash = imageRef[strings.LastIndex(imageRef, ":")+1:]
+	if !pinnedHashRegexp.MatchString(hash) {
+		return "", false
+	}
+	return hash, true
+}
+
+// DownloadImage downloads an image from the library to imagePath, in
+// as many concurrent byte ranges as the StreamCount of the client settings
+// of ctx when the library serves them. The transient failures are retried
+// as many times as the Retries of the settings, each retry resuming from the bytes already downloaded. The file is
+// removed on failure.
 func DownloadImage(ctx context.Context, c *scslibrary.Client, imagePath, arch, libraryRef string, callback client.ProgressCallback) error {
-	// reassemble "stripped" library ref for scs-library-client
-	validLibraryRef := "library:///" + libraryRef
+	// open destination file for writing
+	f, err := os.OpenFile(imagePath, os.O_CREATE|os.O_TRUNC|os.O_RDWR, 0777)
+	if err != nil {
+		return fmt.Errorf("error opening file %s for writing: %v", imagePath, err)
+	}
+	f.Close()
+
+	err = client.Retry(ctx, libraryRef, func() error {
+		return downloadRange(ctx, c, imagePath, arch, libraryRef, streamCount(ctx), callback)
+	})
+	if err != nil {
+		// Delete incomplete image file in the event of failure
+		// we get here e.g. if the context is canceled by Ctrl-C
+		client.RemoveIncomplete(imagePath)
 
-	// parse library ref
-	r, err := scslibrary.Parse(validLibraryRef)
+		return fmt.Errorf("error downloading image: %w", err)
+	}
+
+	return nil
+}
+
+// ResumeDownloadImage downloads an image from the library to imagePath
+// like DownloadImage, resuming with a range request the download of the
+// part of it already at imagePath. The download restarts from scratch when
+// the server doesn't serve the range, or serves another one, and is over
+// when the server reports the file already has the size of the image. The
+// file is left as is on failure.
+func ResumeDownloadImage(ctx context.Context, c *scslibrary.Client, imagePath, arch, libraryRef string, callback client.ProgressCallback) error {
+	err := client.Retry(ctx, libraryRef, func() error {
+		return downloadRange(ctx, c, imagePath, arch, libraryRef, streamCount(ctx), callback)
+	})
+	if err != nil {
+		return fmt.Errorf("error downloading image: %w", err)
+	}
+	return nil
+}
+
+// downloadRange downloads the rest of the image at imagePath from the
+// library, with a range request for the bytes following those already
+// there, if any, the image being downloaded from scratch with downloadNew
+// otherwise.
+func downloadRange(ctx context.Context, c *scslibrary.Client, imagePath, arch, libraryRef string, streams int, callback client.ProgressCallback) error {
+	var offset int64
+	if fi, err := os.Stat(imagePath); err == nil {
+		offset = fi.Size()
+	}
+
+	// reassemble "stripped" library ref for scs-library-client
+	r, err := scslibrary.Parse("library:///" + libraryRef)
 	if err != nil {
 		return fmt.Errorf("error parsing library ref: %v", err)
 	}
+	tag := defaultTag
+	if len(r.Tags) > 0 {
+		tag = r.Tags[0]
+	}
+	if offset == 0 {
+		return downloadNew(ctx, c, imagePath, arch, r.Path, tag, streams, callback)
+	}
 
-	// open destination file for writing
-	f, err := os.OpenFile(imagePath, os.O_CREATE|os.O_TRUNC|os.O_RDWR, 0777)
+	req, err := imageRequest(ctx, c, imageFileURL(c, r.Path, tag, arch))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+
+	res, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	flags := os.O_WRONLY | os.O_APPEND
+	switch {
+	case res.StatusCode == http.StatusPartialContent:
+		if start, _, _, err := parseContentRange(res.Header.Get("Content-Range")); err != nil || start != offset {
+			// appending the bytes served would corrupt the image
+			sylog.Debugf("Library served range %q instead of bytes %d-, restarting download of %s", res.Header.Get("Content-Range"), offset, libraryRef)
+			res.Body.Close()
+			if err := os.Truncate(imagePath, 0); err != nil {
+				return err
+			}
+			return downloadRange(ctx, c, imagePath, arch, libraryRef, streams, callback)
+		}
+		sylog.Infof("Resuming download of %s at %d bytes", libraryRef, offset)
+	case res.StatusCode == http.StatusOK:
+		sylog.Debugf("Library doesn't serve ranges, restarting download of %s", libraryRef)
+		flags = os.O_WRONLY | os.O_TRUNC
+	case res.StatusCode == http.StatusRequestedRangeNotSatisfiable:
+		// the download was interrupted once complete, the image hash
+		// catching a partial file of the expected size which isn't the image
+		if _, _, size, err := parseContentRange(res.Header.Get("Content-Range")); err == nil && size == offset {
+			sylog.Debugf("Download of %s already complete at %d bytes", libraryRef, offset)
+			return nil
+		}
+		// the partial file is no prefix of the image
+		res.Body.Close()
+		if err := os.Truncate(imagePath, 0); err != nil {
+			return err
+		}
+		return downloadRange(ctx, c, imagePath, arch, libraryRef, streams, callback)
+	case res.StatusCode == http.StatusNotFound:
+		return &client.StatusError{Code: res.StatusCode, Err: fmt.Errorf("requested image was not found in the library")}
+	default:
+		return &client.StatusError{Code: res.StatusCode, Err: fmt.Errorf("unexpected http status code: %d", res.StatusCode)}
+	}
+
+	f, err := os.OpenFile(imagePath, flags, 0777)
 	if err != nil {
 		return fmt.Errorf("error opening file %s for writing: %v", imagePath, err)
 	}
 	defer f.Close()
 
-	var tag string
-	if len(r.Tags) > 0 {
-		tag = r.Tags[0]
+	w := client.NetworkWriter(ctx, f)
+	if callback != nil {
+		return callback(res.ContentLength, res.Body, w)
 	}
+	_, err = io.Copy(w, res.Body)
+	return err
+}
 
-	// call library client to download image
-	err = c.DownloadImage(ctx, f, arch, r.Path, tag, callback)
+// downloadNew downloads the image path:tag from the library to imagePath
+// from scratch. Its size is first requested with a range request for its
+// first byte, the image being split into up to streams concurrent range
+// requests when the library serves them, and downloaded in a single stream
+// by the library client otherwise. A library ignoring the range request
+// answers with the whole image, downloaded from that response.
+func downloadNew(ctx context.Context, c *scslibrary.Client, imagePath, arch, path, tag string, streams int, callback client.ProgressCallback) error {
+	u := imageFileURL(c, path, tag, arch)
+	req, err := imageRequest(ctx, c, u)
 	if err != nil {
-		// Delete incomplete image file in the event of failure
-		// we get here e.g. if the context is canceled by Ctrl-C
-		sylog.Debugf("Cleaning up incomplete download: %s", imagePath)
-		if err := os.Remove(imagePath); err != nil {
-			sylog.Errorf("Error while removing incomplete download: %v", err)
+		return err
+	}
+	req.Header.Set("Range", "bytes=0-0")
+
+	res, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusOK:
+		f, err := os.OpenFile(imagePath, os.O_WRONLY|os.O_TRUNC, 0777)
+		if err != nil {
+			return fmt.Errorf("error opening file %s for writing: %v", imagePath, err)
 		}
+		defer f.Close()
 
-		return fmt.Errorf("error downloading image: %v", err)
+		w := client.NetworkWriter(ctx, f)
+		if callback != nil {
+			return callback(res.ContentLength, res.Body, w)
+		}
+		_, err = io.Copy(w, res.Body)
+		return err
+	case http.StatusNotFound:
+		return &client.StatusError{Code: res.StatusCode, Err: fmt.Errorf("requested image was not found in the library")}
+	default:
+		return &client.StatusError{Code: res.StatusCode, Err: fmt.Errorf("unexpected http status code: %d", res.StatusCode)}
 	}
+	res.Body.Close()
 
-	return nil
+	if _, _, size, err := parseContentRange(res.Header.Get("Content-Range")); err == nil {
+		if n := segmentCount(size, streams); n > 1 {
+			sylog.Debugf("Downloading %s:%s in %d concurrent ranges", path, tag, n)
+			err := downloadSegments(ctx, c, u, imagePath, size, n, callback)
+			if !errors.Is(err, errNoRanges) {
+				return err
+			}
+			sylog.Debugf("Library doesn't serve ranges, downloading %s:%s in a single stream", path, tag)
+		}
+	}
+
+	f, err := os.OpenFile(imagePath, os.O_WRONLY|os.O_TRUNC, 0777)
+	if err != nil {
+		return fmt.Errorf("error opening file %s for writing: %v", imagePath, err)
+	}
+	defer f.Close()
+	return c.DownloadImage(ctx, client.NetworkWriter(ctx, f), arch, path, tag, callback)
+}
+
+// imageFileURL returns the URL of the image file path:tag for arch in the
+// library of c.
+func imageFileURL(c *scslibrary.Client, path, tag, arch string) string {
+	return c.BaseURL.ResolveReference(&url.URL{
+		Path:     "v1/imagefile/" + strings.TrimPrefix(path, "/") + ":" + tag,
+		RawQuery: url.Values{"arch": []string{arch}}.Encode(),
+	}).String()
+}
+
+// parseContentRange parses the Content-Range header h of a response to a
+// range request, either bytes <start>-<end>/<size> or bytes */<size>, start
+// and end being -1 for the latter and size -1 when unknown.
+func parseContentRange(h string) (start, end, size int64, err error) {
+	if !strings.HasPrefix(h, "bytes ") {
+		return 0, 0, 0, fmt.Errorf("bad Content-Range %q", h)
+	}
+	i := strings.Index(h, "/")
+	if i < 0 {
+		return 0, 0, 0, fmt.Errorf("bad Content-Range %q", h)
+	}
+	byteRange, completeLength := h[len("bytes "):i], h[i+1:]
+
+	size = -1
+	if completeLength != "*" {
+		if size, err = strconv.ParseInt(completeLength, 10, 64); err != nil || size < 0 {
+			return 0, 0, 0, fmt.Errorf("bad Content-Range %q", h)
+		}
+	}
+	if byteRange == "*" {
+		if size < 0 {
+			return 0, 0, 0, fmt.Errorf("bad Content-Range %q", h)
+		}
+		return -1, -1, size, nil
+	}
+	j := strings.Index(byteRange, "-")
+	if j < 0 {
+		return 0, 0, 0, fmt.Errorf("bad Content-Range %q", h)
+	}
+	start, err1 := strconv.ParseInt(byteRange[:j], 10, 64)
+	end, err2 := strconv.ParseInt(byteRange[j+1:], 10, 64)
+	if err1 != nil || err2 != nil || start < 0 || end < start || (size >= 0 && end >= size) {
+		return 0, 0, 0, fmt.Errorf("bad Content-Range %q", h)
+	}
+	return start, end, size, nil
+}
+
+// imageRequest returns a request for the image file at u, authenticated
+// with the token of c.
+func imageRequest(ctx context.Context, c *scslibrary.Client, u string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.AuthToken != "" {
+		req.Header.Set("Authorization", "BEARER "+c.AuthToken)
+	}
+	if c.UserAgent != "" {
+		req.Header.Set("User-Agent", c.UserAgent)
+	}
+	return req, nil
 }
 
 // DownloadImageNoProgress downloads an image from the library without
@@ -45,3 +45,35 @@ func TestNormalizeLibraryRef(t *testing.T) {
 		})
 	}
 }
+
+func TestParseContentRange(t *testing.T) {
+	tests := []struct {
+		header  string
+		start   int64
+		end     int64
+		size    int64
+		wantErr bool
+	}{
+		{header: "bytes 7-12/13", start: 7, end: 12, size: 13},
+		{header: "bytes 7-12/*", start: 7, end: 12, size: -1},
+		{header: "bytes */13", start: -1, end: -1, size: 13},
+		{header: "bytes */*", wantErr: true},
+		{header: "bytes 7-13/13", wantErr: true},
+		{header: "bytes 12-7/13", wantErr: true},
+		{header: "bytes 7/13", wantErr: true},
+		{header: "7-12/13", wantErr: true},
+		{header: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		start, end, size, err := parseContentRange(tt.header)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%q: unexpected success", tt.header)
+			}
+			continue
+		}
+		if err != nil || start != tt.start || end != tt.end || size != tt.size {
+			t.Errorf("%q: got %d-%d/%d (%v), want %d-%d/%d", tt.header, start, end, size, err, tt.start, tt.end, tt.size)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package library
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	scs "github.com/sylabs/scs-library-client/client"
+)
+
+// NamespaceImage is a tagged image of a library namespace, for an
+// architecture.
+type NamespaceImage struct {
+	Entity     string
+	Collection string
+	Container  string
+	Tag        string
+	Arch       string
+}
+
+// Ref returns the library URI of the image.
+func (i NamespaceImage) Ref() string {
+	return fmt.Sprintf("library://%s/%s/%s:%s", i.Entity, i.Collection, i.Container, i.Tag)
+}
+
+// ListNamespace returns the images tagged in the library namespace
+// library://entity/ or library://entity/collection/, for all their
+// architectures, sorted by collection, container, tag and architecture.
+func ListNamespace(ctx context.Context, scsConfig *scs.Config, namespace string) ([]NamespaceImage, error) {
+	path := strings.Trim(strings.TrimPrefix(namespace, "library:"), "/")
+	parts := strings.Split(path, "/")
+	if path == "" || len(parts) > 2 || strings.ContainsAny(path, ":@") {
+		return nil, fmt.Errorf("invalid namespace %s, must be library://entity/ or library://entity/collection/", namespace)
+	}
+
+	c, err := scs.NewClient(scsConfig)
+	if err != nil {
+		return nil, fmt.Errorf("unable to initialize client library: %v", err)
+	}
+
+	// collections are listed by the ID the entity refers to them with
+	collections := []string{path}
+	if len(parts) == 1 {
+		var er scs.EntityResponse
+		if err := getJSON(ctx, c, "v1/entities/"+path, &er); err != nil {
+			return nil, fmt.Errorf("entity %s: %v", path, err)
+		}
+		collections = er.Data.Collections
+	}
+
+	var images []NamespaceImage
+	for _, collectionRef := range collections {
+		var cr scs.CollectionResponse
+		if err := getJSON(ctx, c, "v1/collections/"+collectionRef, &cr); err != nil {
+			return nil, fmt.Errorf("collection %s: %v", collectionRef, err)
+		}
+		for _, containerID := range cr.Data.Containers {
+			var ctr scs.ContainerResponse
+			if err := getJSON(ctx, c, "v1/containers/"+containerID, &ctr); err != nil {
+				return nil, fmt.Errorf("container %s of collection %s: %v", containerID, cr.Data.Name, err)
+			}
+			for arch, tags := range ctr.Data.ArchTags {
+				for tag := range tags {
+					images = append(images, NamespaceImage{
+						Entity:     parts[0],
+						Collection: cr.Data.Name,
+						Container:  ctr.Data.Name,
+						Tag:        tag,
+						Arch:       arch,
+					})
+				}
+			}
+		}
+	}
+
+	sort.Slice(images, func(i, j int) bool {
+		a, b := images[i], images[j]
+		if a.Collection != b.Collection {
+			return a.Collection < b.Collection
+		}
+		if a.Container != b.Container {
+			return a.Container < b.Container
+		}
+		if a.Tag != b.Tag {
+			return a.Tag < b.Tag
+		}
+		return a.Arch < b.Arch
+	})
+	return images, nil
+}
@@ -0,0 +1,81 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package library
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/sylabs/scs-library-client/client"
+)
+
+func TestListNamespace(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/entities/org":
+			w.Write([]byte(`{"data": {"name": "org", "collections": ["c1", "c2"]}}`))
+			return
+		case "/v1/collections/c1", "/v1/collections/org/tools":
+			w.Write([]byte(`{"data": {"name": "tools", "containers": ["k1"]}}`))
+			return
+		case "/v1/collections/c2":
+			w.Write([]byte(`{"data": {"name": "base", "containers": ["k2", "k3"]}}`))
+			return
+		case "/v1/containers/k1":
+			w.Write([]byte(`{"data": {"name": "grep", "archTags": {"amd64": {"latest": "1", "1.0": "1"}, "arm64": {"latest": "2"}}}}`))
+			return
+		case "/v1/containers/k2":
+			w.Write([]byte(`{"data": {"name": "alpine", "archTags": {"amd64": {"3.11": "3"}}}}`))
+			return
+		case "/v1/containers/k3":
+			// no tagged images
+			w.Write([]byte(`{"data": {"name": "empty"}}`))
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	config := &client.Config{BaseURL: srv.URL}
+	tools := []NamespaceImage{
+		{"org", "tools", "grep", "1.0", "amd64"},
+		{"org", "tools", "grep", "latest", "amd64"},
+		{"org", "tools", "grep", "latest", "arm64"},
+	}
+
+	tests := []struct {
+		name      string
+		namespace string
+		expectErr bool
+		images    []NamespaceImage
+	}{
+		{"entity", "library://org/", false, append([]NamespaceImage{{"org", "base", "alpine", "3.11", "amd64"}}, tools...)},
+		{"collection", "library://org/tools", false, tools},
+		{"missing entity", "library://other/", true, nil},
+		{"container", "library://org/tools/grep", true, nil},
+		{"tagged", "library://org/tools:latest", true, nil},
+		{"empty", "library://", true, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			images, err := ListNamespace(context.Background(), config, tt.namespace)
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(images, tt.images) {
+				t.Errorf("got images %v, want %v", images, tt.images)
+			}
+		})
+	}
+
+	if ref := tools[0].Ref(); ref != "library://org/tools/grep:1.0" {
+		t.Errorf("unexpected ref %s", ref)
+	}
+}
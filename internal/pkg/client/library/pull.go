@@ -10,7 +10,7 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
-	"runtime"
+	"os"
 
 	scs "github.com/sylabs/scs-library-client/client"
 	"github.com/sylabs/singularity/internal/pkg/cache"
@@ -23,10 +23,14 @@ import (
 var (
 	// ErrLibraryPullUnsigned indicates that the interactive portion of the pull was aborted.
 	ErrLibraryPullUnsigned = errors.New("failed to verify container")
+	// ErrImageNotFound is the error of a library reference resolving to no
+	// image for the requested architecture.
+	ErrImageNotFound = errors.New("image does not exist in the library")
 )
 
 // pull will pull a library image into the cache if directTo="", or a specific file if directTo is set.
 func pull(ctx context.Context, imgCache *cache.Handle, directTo, pullFrom string, arch string, scsConfig *scs.Config, keystoreURI string) (imagePath string, err error) {
+	scsConfig, pullFrom = hostConfig(scsConfig, pullFrom)
 	imageRef := NormalizeLibraryRef(pullFrom)
 
 	sylog.GetLevel()
@@ -36,38 +40,67 @@ func pull(ctx context.Context, imgCache *cache.Handle, directTo, pullFrom string
 		return "", fmt.Errorf("unable to initialize client library: %v", err)
 	}
 
-	libraryImage, err := c.GetImage(ctx, arch, imageRef)
-	if err == scs.ErrNotFound {
-		return "", fmt.Errorf("image does not exist in the library: %s (%s)", imageRef, runtime.GOARCH)
-	}
-	if err != nil {
-		return "", err
+	// images pinned by hash are downloaded without resolving them
+	hash, pinned := pinnedHash(imageRef)
+	if !pinned {
+		endMetadata := client.StartPhase(ctx, client.PhaseMetadata)
+		libraryImage, err := c.GetImage(ctx, arch, imageRef)
+		endMetadata()
+		if err == scs.ErrNotFound {
+			return "", fmt.Errorf("%w: %s (%s)", ErrImageNotFound, imageRef, arch)
+		}
+		if err != nil {
+			return "", err
+		}
+		hash = libraryImage.Hash
 	}
 
 	if directTo != "" {
 		sylog.Infof("Downloading library image")
-		if err = DownloadImage(ctx, c, directTo, arch, imageRef, client.ProgressBarCallback(ctx)); err != nil {
+		endDownload := client.StartPhase(ctx, client.PhaseDownload)
+		err = DownloadImage(ctx, c, directTo, arch, imageRef, client.ProgressBarCallback(ctx))
+		endDownload()
+		if err != nil {
 			return "", fmt.Errorf("unable to download image: %v", err)
 		}
+		endHash := client.StartPhase(ctx, client.PhaseHash)
+		fileHash, err := scs.ImageHash(directTo)
+		endHash()
+		if err != nil {
+			return "", fmt.Errorf("error getting image hash: %v", err)
+		} else if fileHash != hash {
+			os.Remove(directTo)
+			return "", fmt.Errorf("downloaded file hash(%s) and expected hash(%s) does not match", fileHash, hash)
+		}
 		imagePath = directTo
 
 	} else {
-		cacheEntry, err := imgCache.GetEntry(cache.LibraryCacheType, libraryImage.Hash)
+		endLookup := client.StartPhase(ctx, client.PhaseCacheLookup)
+		cacheEntry, err := imgCache.GetResumableEntry(cache.LibraryCacheType, hash)
+		endLookup()
 		if err != nil {
-			return "", fmt.Errorf("unable to check if %v exists in cache: %v", libraryImage.Hash, err)
+			return "", fmt.Errorf("unable to check if %v exists in cache: %v", hash, err)
 		}
 		defer cacheEntry.CleanTmp()
 		if !cacheEntry.Exists {
 			sylog.Infof("Downloading library image")
 
-			if err := DownloadImage(ctx, c, cacheEntry.TmpPath, runtime.GOARCH, imageRef, client.ProgressBarCallback(ctx)); err != nil {
+			endDownload := client.StartPhase(ctx, client.PhaseDownload)
+			err := ResumeDownloadImage(ctx, c, cacheEntry.TmpPath, arch, imageRef, client.ProgressBarCallback(ctx))
+			endDownload()
+			if err != nil {
 				return "", fmt.Errorf("unable to download image: %v", err)
 			}
 
-			if cacheFileHash, err := scs.ImageHash(cacheEntry.TmpPath); err != nil {
+			endHash := client.StartPhase(ctx, client.PhaseHash)
+			cacheFileHash, err := scs.ImageHash(cacheEntry.TmpPath)
+			endHash()
+			if err != nil {
 				return "", fmt.Errorf("error getting image hash: %v", err)
-			} else if cacheFileHash != libraryImage.Hash {
-				return "", fmt.Errorf("cached file hash(%s) and expected hash(%s) does not match", cacheFileHash, libraryImage.Hash)
+			} else if cacheFileHash != hash {
+				// not to resume a corrupt download
+				os.Remove(cacheEntry.TmpPath)
+				return "", fmt.Errorf("cached file hash(%s) and expected hash(%s) does not match", cacheFileHash, hash)
 			}
 
 			err = cacheEntry.Finalize()
@@ -83,6 +116,30 @@ func pull(ctx context.Context, imgCache *cache.Handle, directTo, pullFrom string
 	return imagePath, nil
 }
 
+// CacheHash returns the hash the library image pullFrom for arch is cached
+// with, as reported by the library.
+func CacheHash(ctx context.Context, pullFrom, arch string, scsConfig *scs.Config) (string, error) {
+	scsConfig, pullFrom = hostConfig(scsConfig, pullFrom)
+	imageRef := NormalizeLibraryRef(pullFrom)
+	if hash, ok := pinnedHash(imageRef); ok {
+		return hash, nil
+	}
+
+	c, err := scs.NewClient(scsConfig)
+	if err != nil {
+		return "", fmt.Errorf("unable to initialize client library: %v", err)
+	}
+
+	libraryImage, err := c.GetImage(ctx, arch, imageRef)
+	if err == scs.ErrNotFound {
+		return "", fmt.Errorf("%w: %s (%s)", ErrImageNotFound, imageRef, arch)
+	}
+	if err != nil {
+		return "", err
+	}
+	return libraryImage.Hash, nil
+}
+
 // Pull will pull a library image to the cache or direct to a temporary file if cache is disabled
 func Pull(ctx context.Context, imgCache *cache.Handle, pullFrom string, arch string, tmpDir string, scsConfig *scs.Config, keystoreURI string) (imagePath string, err error) {
 
@@ -100,33 +157,98 @@ func Pull(ctx context.Context, imgCache *cache.Handle, pullFrom string, arch str
 	return pull(ctx, imgCache, directTo, pullFrom, arch, scsConfig, keystoreURI)
 }
 
-// PullToFile will pull a library image to the specified location, through the cache, or directly if cache is disabled
-func PullToFile(ctx context.Context, imgCache *cache.Handle, pullTo, pullFrom, arch string, tmpDir string, scsConfig *scs.Config, keystoreURI string) (imagePath string, err error) {
+// PullToFile will pull a library image to the specified location, through the cache, or directly if cache is disabled,
+// returning the keys of its signers once verified
+func PullToFile(ctx context.Context, imgCache *cache.Handle, pullTo, pullFrom, arch string, tmpDir string, scsConfig *scs.Config, keystoreURI string) (imagePath string, signers []signing.KeyEntity, err error) {
+	if _, err := PullToFileUnverified(ctx, imgCache, pullTo, pullFrom, arch, tmpDir, scsConfig); err != nil {
+		return "", nil, err
+	}
+
+	// multi-arch images are verified for the pulled architecture
+	endVerification := client.StartPhase(ctx, client.PhaseVerification)
+	signers, err = signing.IsSignedArch(ctx, pullTo, arch, keystoreURI, scsConfig.AuthToken)
+	endVerification()
+	if errors.Is(err, signing.ErrNotSIF) {
+		// not an unsigned image which could be kept
+		return "", nil, err
+	} else if err != nil {
+		sylog.Warningf("%v", err)
+		return pullTo, nil, ErrLibraryPullUnsigned
+	}
+
+	return pullTo, signers, nil
+}
 
+// PullToFileUnverified pulls a library image to the specified location as PullToFile does, without verifying its
+// signatures
+func PullToFileUnverified(ctx context.Context, imgCache *cache.Handle, pullTo, pullFrom, arch string, tmpDir string, scsConfig *scs.Config) (imagePath string, err error) {
 	directTo := ""
 	if imgCache.IsDisabled() {
 		directTo = pullTo
 		sylog.Debugf("Cache disabled, pulling directly to: %s", directTo)
+	} else if imgCache.IsReadOnly() {
+		hash, err := CacheHash(ctx, pullFrom, arch, scsConfig)
+		if err != nil {
+			return "", err
+		}
+		if _, cached, _ := imgCache.Lookup(cache.LibraryCacheType, hash); !cached {
+			directTo = pullTo
+			sylog.Debugf("Image not in the read-only cache, pulling directly to: %s", directTo)
+		}
 	}
 
-	src, err := pull(ctx, imgCache, directTo, pullFrom, arch, scsConfig, keystoreURI)
+	src, err := pull(ctx, imgCache, directTo, pullFrom, arch, scsConfig, "")
 	if err != nil {
 		return "", fmt.Errorf("error fetching image: %v", err)
 	}
 
 	if directTo == "" {
 		// mode is before umask if pullTo doesn't exist
+		endCopy := client.StartPhase(ctx, client.PhaseCopy)
 		err = fs.CopyFileAtomic(src, pullTo, 0777)
+		endCopy()
 		if err != nil {
 			return "", fmt.Errorf("error copying image out of cache: %v", err)
 		}
 	}
 
-	_, err = signing.IsSigned(ctx, pullTo, keystoreURI, scsConfig.AuthToken)
+	return pullTo, nil
+}
+
+// Verify checks the signatures of the library image pullFrom against the
+// keystore, without writing the image anywhere but the cache. Images the
+// library reports as unsigned fail without being downloaded. Otherwise, as the
+// library doesn't serve SIF signature descriptors on their own, the full image
+// is downloaded in order to verify it.
+func Verify(ctx context.Context, imgCache *cache.Handle, pullFrom, arch, tmpDir string, scsConfig *scs.Config, keystoreURI string) error {
+	libConfig, hostless := hostConfig(scsConfig, pullFrom)
+	imageRef := NormalizeLibraryRef(hostless)
+
+	c, err := scs.NewClient(libConfig)
+	if err != nil {
+		return fmt.Errorf("unable to initialize client library: %v", err)
+	}
+
+	libraryImage, err := c.GetImage(ctx, arch, imageRef)
+	if err == scs.ErrNotFound {
+		return fmt.Errorf("%w: %s (%s)", ErrImageNotFound, imageRef, arch)
+	}
 	if err != nil {
-		sylog.Warningf("%v", err)
-		return pullTo, ErrLibraryPullUnsigned
+		return err
+	}
+	if libraryImage.Signed != nil && !*libraryImage.Signed {
+		return fmt.Errorf("image %s is not signed", imageRef)
 	}
 
-	return pullTo, nil
+	sylog.Debugf("Signature descriptors can't be fetched separately, downloading full image")
+	src, err := Pull(ctx, imgCache, pullFrom, arch, tmpDir, scsConfig, keystoreURI)
+	if err != nil {
+		return fmt.Errorf("error fetching image: %v", err)
+	}
+	if imgCache.IsDisabled() {
+		defer os.Remove(src)
+	}
+
+	_, err = signing.IsSignedArch(ctx, src, arch, keystoreURI, scsConfig.AuthToken)
+	return err
 }
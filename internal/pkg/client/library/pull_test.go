@@ -0,0 +1,221 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package library
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sylabs/scs-library-client/client"
+	"github.com/sylabs/singularity/internal/pkg/cache"
+)
+
+func TestPullArch(t *testing.T) {
+	// an architecture other than the host one
+	arch := "arm64"
+	if runtime.GOARCH == arch {
+		arch = "ppc64le"
+	}
+	image := []byte(arch + " image")
+	hash := fmt.Sprintf("sha256.%x", sha256.Sum256(image))
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("arch") == arch {
+			switch r.URL.Path {
+			case "/v1/images/user/collection/container:latest":
+				fmt.Fprintf(w, `{"data": {"hash": %q}}`, hash)
+				return
+			case "/v1/imagefile/user/collection/container:latest":
+				w.Write(image)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "library-pull-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	imgCache, err := cache.New(cache.Config{ParentDir: dir})
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	if imgCache.IsDisabled() {
+		t.Skip("cache directory is not writable")
+	}
+
+	config := &client.Config{BaseURL: srv.URL}
+	path, err := Pull(context.Background(), imgCache, "library://user/collection/container", arch, dir, config, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cached, _, _ := imgCache.Lookup(cache.LibraryCacheType, hash); cached != path {
+		t.Errorf("image pulled to %s, not to its cache entry %s", path, cached)
+	}
+
+	_, err = Pull(context.Background(), imgCache, "library://user/collection/container", runtime.GOARCH, dir, config, "")
+	if err == nil {
+		t.Errorf("unexpected success pulling a missing architecture")
+	}
+}
+
+func TestPullPinned(t *testing.T) {
+	image := []byte("pinned image")
+	hash := fmt.Sprintf("sha256.%x", sha256.Sum256(image))
+	other := fmt.Sprintf("sha256.%x", sha256.Sum256([]byte("other image")))
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// pinned images are not resolved, and any content is served
+		if strings.HasPrefix(r.URL.Path, "/v1/imagefile/user/collection/container:sha256.") {
+			w.Write(image)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "library-pull-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	imgCache, err := cache.New(cache.Config{Disable: true})
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	config := &client.Config{BaseURL: srv.URL}
+
+	tests := []struct {
+		name    string
+		ref     string
+		wantErr bool
+	}{
+		{name: "Digest", ref: "library://user/collection/container@sha256:" + strings.TrimPrefix(hash, "sha256.")},
+		{name: "Hash", ref: "library://user/collection/container:" + hash},
+		{name: "Mismatch", ref: "library://user/collection/container@sha256:" + strings.TrimPrefix(other, "sha256."), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pullTo := filepath.Join(dir, tt.name+".sif")
+			_, err := pull(context.Background(), imgCache, pullTo, tt.ref, runtime.GOARCH, config, "")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if _, statErr := os.Stat(pullTo); tt.wantErr != os.IsNotExist(statErr) {
+				t.Errorf("unexpected image file state: %v", statErr)
+			}
+		})
+	}
+}
+
+func TestPullResume(t *testing.T) {
+	image := []byte("resumed image")
+	hash := fmt.Sprintf("sha256.%x", sha256.Sum256(image))
+	ref := "library://user/collection/container:" + hash
+
+	tests := []struct {
+		name      string
+		partial   []byte
+		ranges    bool
+		badRange  bool
+		wantRange string
+		wantGets  int
+	}{
+		{name: "Range", partial: image[:7], ranges: true, wantRange: "bytes=7-", wantGets: 1},
+		{name: "NoRange", partial: image[:7], wantRange: "bytes=7-", wantGets: 1},
+		{name: "Corrupt", partial: []byte("corrupt"), ranges: true, wantRange: "bytes=7-"},
+		{name: "Complete", partial: image, ranges: true, wantRange: "bytes=13-", wantGets: 1},
+		{name: "WrongRange", partial: image[:7], ranges: true, badRange: true, wantGets: 3},
+		{name: "Empty", wantRange: "bytes=0-0", wantGets: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotRange string
+			gets := 0
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/version" {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				gets++
+				gotRange = r.Header.Get("Range")
+				if !tt.ranges {
+					r.Header.Del("Range")
+				}
+				if tt.badRange && gotRange != "" {
+					// served from the start of the image instead
+					r.Header.Set("Range", "bytes=0-")
+				}
+				http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(image))
+			}))
+			defer srv.Close()
+
+			dir, err := ioutil.TempDir("", "library-pull-")
+			if err != nil {
+				t.Fatalf("failed to create temporary directory: %v", err)
+			}
+			defer os.RemoveAll(dir)
+
+			imgCache, err := cache.New(cache.Config{ParentDir: dir})
+			if err != nil {
+				t.Fatalf("failed to create cache: %v", err)
+			}
+			if imgCache.IsDisabled() {
+				t.Skip("cache directory is not writable")
+			}
+			cacheDir, err := imgCache.GetFileCacheDir(cache.LibraryCacheType)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.partial != nil {
+				if err := ioutil.WriteFile(filepath.Join(cacheDir, hash+cache.PartSuffix), tt.partial, 0600); err != nil {
+					t.Fatalf("failed to write partial file: %v", err)
+				}
+			}
+
+			config := &client.Config{BaseURL: srv.URL}
+			path, err := Pull(context.Background(), imgCache, ref, runtime.GOARCH, dir, config, "")
+			if tt.name == "Corrupt" {
+				// the corrupt partial file is discarded, not resumed again
+				if err == nil {
+					t.Fatalf("unexpected success resuming a corrupt download")
+				}
+				if _, err := os.Stat(filepath.Join(cacheDir, hash+cache.PartSuffix)); !os.IsNotExist(err) {
+					t.Errorf("corrupt partial file kept: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if gotRange != tt.wantRange {
+				t.Errorf("got range %q, want %q", gotRange, tt.wantRange)
+			}
+			if gets != tt.wantGets {
+				t.Errorf("got %d requests, want %d", gets, tt.wantGets)
+			}
+			if b, err := ioutil.ReadFile(path); err != nil || !bytes.Equal(b, image) {
+				t.Errorf("unexpected image %q: %v", b, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package library
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	scs "github.com/sylabs/scs-library-client/client"
+)
+
+// ResolvedRef holds the image a library reference resolved to.
+type ResolvedRef struct {
+	// Ref is the requested reference.
+	Ref string `json:"ref"`
+	// Arch is the requested architecture.
+	Arch string `json:"arch"`
+	// Tags are all the tags of the resolved image.
+	Tags []string `json:"tags"`
+	// Hash is the hash of the resolved image.
+	Hash string `json:"hash"`
+	// Pinned is a reference of the resolved image by hash, which
+	// doesn't change when its tags are moved.
+	Pinned string `json:"pinned"`
+}
+
+// Resolve returns the image the library reference pullFrom resolves to for
+// arch, e.g. the concrete tags and hash of a ':latest' image.
+func Resolve(ctx context.Context, scsConfig *scs.Config, pullFrom, arch string) (*ResolvedRef, error) {
+	libConfig, hostless := hostConfig(scsConfig, pullFrom)
+	imageRef := NormalizeLibraryRef(hostless)
+
+	c, err := scs.NewClient(libConfig)
+	if err != nil {
+		return nil, fmt.Errorf("unable to initialize client library: %v", err)
+	}
+
+	img, err := c.GetImage(ctx, arch, imageRef)
+	if err == scs.ErrNotFound {
+		return nil, fmt.Errorf("%w: %s (%s)", ErrImageNotFound, imageRef, arch)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	tags := append([]string(nil), img.Tags...)
+	sort.Strings(tags)
+
+	return &ResolvedRef{
+		Ref:    withHost(pullFrom, imageRef),
+		Arch:   arch,
+		Tags:   tags,
+		Hash:   img.Hash,
+		Pinned: withHost(pullFrom, imageRef[:strings.LastIndex(imageRef, ":")]+":"+img.Hash),
+	}, nil
+}
@@ -0,0 +1,48 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package library
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/sylabs/scs-library-client/client"
+)
+
+func TestResolve(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/images/user/collection/container:latest" && r.URL.Query().Get("arch") == "amd64" {
+			w.Write([]byte(`{"data": {"hash": "sha256.0123", "tags": ["latest", "1.1", "1.1.2"]}}`))
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	config := &client.Config{BaseURL: srv.URL}
+
+	resolved, err := Resolve(context.Background(), config, "library://user/collection/container", "amd64")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := &ResolvedRef{
+		Ref:    "library://user/collection/container:latest",
+		Arch:   "amd64",
+		Tags:   []string{"1.1", "1.1.2", "latest"},
+		Hash:   "sha256.0123",
+		Pinned: "library://user/collection/container:sha256.0123",
+	}
+	if !reflect.DeepEqual(resolved, expected) {
+		t.Errorf("expected %+v, got %+v", expected, resolved)
+	}
+
+	if _, err := Resolve(context.Background(), config, "library://user/collection/container", "arm64"); err == nil {
+		t.Errorf("unexpected success for missing image")
+	}
+}
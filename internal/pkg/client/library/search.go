@@ -0,0 +1,39 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package library
+
+import (
+	"context"
+	"fmt"
+
+	scs "github.com/sylabs/scs-library-client/client"
+)
+
+// SearchMatch is a library container matching a search.
+type SearchMatch struct {
+	URI         string
+	Description string
+}
+
+// SearchContainers returns the library containers matching term, in the
+// order of the library search results.
+func SearchContainers(ctx context.Context, scsConfig *scs.Config, term string) ([]SearchMatch, error) {
+	c, err := scs.NewClient(scsConfig)
+	if err != nil {
+		return nil, fmt.Errorf("unable to initialize client library: %v", err)
+	}
+
+	results, err := c.Search(ctx, map[string]string{"value": term})
+	if err != nil {
+		return nil, err
+	}
+
+	matches := make([]SearchMatch, 0, len(results.Containers))
+	for _, con := range results.Containers {
+		matches = append(matches, SearchMatch{URI: con.LibraryURI(), Description: con.Description})
+	}
+	return matches, nil
+}
@@ -0,0 +1,47 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package library
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/sylabs/scs-library-client/client"
+)
+
+func TestSearchContainers(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/search" || r.URL.Query().Get("value") != "grep" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"data": {"container": [
+			{"name": "grep", "description": "GNU grep", "entityName": "org", "collectionName": "tools"},
+			{"name": "ripgrep", "entityName": "other", "collectionName": "default"}
+		]}}`))
+	}))
+	defer srv.Close()
+
+	config := &client.Config{BaseURL: srv.URL}
+	matches, err := SearchContainers(context.Background(), config, "grep")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []SearchMatch{
+		{URI: "library://org/tools/grep", Description: "GNU grep"},
+		{URI: "library://other/default/ripgrep"},
+	}
+	if !reflect.DeepEqual(matches, expected) {
+		t.Errorf("got matches %v, want %v", matches, expected)
+	}
+
+	if _, err := SearchContainers(context.Background(), config, "gr"); err == nil {
+		t.Errorf("unexpected success with a 2 character term")
+	}
+}
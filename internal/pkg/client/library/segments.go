@@ -0,0 +1,268 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package library
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+
+	scslibrary "github.com/sylabs/scs-library-client/client"
+	"github.com/sylabs/singularity/internal/pkg/client"
+	"github.com/sylabs/singularity/pkg/sylog"
+)
+
+// DefaultStreamCount is the number of byte ranges an image is downloaded in
+// concurrently, unless set in the client settings.
+const DefaultStreamCount = 4
+
+// minSegmentSize is the size of the smallest range worth a request of its
+// own, the images smaller than two of them being downloaded in a single
+// stream.
+var minSegmentSize int64 = 16 << 20
+
+// segmentAttempts is the number of times a range failing its integrity
+// check is fetched before the download fails.
+const segmentAttempts = 3
+
+var (
+	// errNoRanges is the error of a range request the library answered with
+	// the whole image.
+	errNoRanges = errors.New("library doesn't serve ranges")
+	// errCorruptRange is the error of a range whose bytes don't match the
+	// digest it was served with.
+	errCorruptRange = errors.New("range doesn't match its digest")
+)
+
+// streamCount returns the number of concurrent range requests the
+// downloads from scratch made with ctx are split into, one downloading the
+// images in a single stream.
+func streamCount(ctx context.Context) int {
+	if n := client.SettingsFromContext(ctx).StreamCount; n > 0 {
+		return n
+	}
+	return DefaultStreamCount
+}
+
+// segmentCount returns the number of ranges an image of size bytes is
+// downloaded in with up to streams concurrent requests.
+func segmentCount(size int64, streams int) int {
+	if max := size / minSegmentSize; int64(streams) > max {
+		return int(max)
+	}
+	return streams
+}
+
+// downloadSegments downloads the image of size bytes at u to imagePath in n
+// ranges fetched concurrently, each written in place in the preallocated
+// file. A range served with a sha-256 Content-Digest is checked as it lands
+// and fetched again alone if corrupt, the image hash checked once the
+// download finished catching the others. The callback, if any, is given the
+// ranges as a single stream. The file is emptied on failure so that it is
+// never resumed from, its size not being that of the bytes downloaded.
+func downloadSegments(ctx context.Context, c *scslibrary.Client, u, imagePath string, size int64, n int, callback client.ProgressCallback) (err error) {
+	f, err := os.OpenFile(imagePath, os.O_WRONLY|os.O_TRUNC, 0777)
+	if err != nil {
+		return fmt.Errorf("error opening file %s for writing: %v", imagePath, err)
+	}
+	defer f.Close()
+	defer func() {
+		if err != nil {
+			f.Truncate(0)
+		}
+	}()
+	if err := f.Truncate(size); err != nil {
+		return fmt.Errorf("error preallocating file %s: %v", imagePath, err)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var progress io.Writer
+	var pw *io.PipeWriter
+	progressErr := make(chan error, 1)
+	if callback != nil {
+		var pr *io.PipeReader
+		pr, pw = io.Pipe()
+		progress = pw
+		go func() {
+			err := callback(size, pr, ioutil.Discard)
+			// unblock the ranges still written to the progress
+			pr.CloseWithError(err)
+			progressErr <- err
+		}()
+	}
+
+	errs := make(chan error, n)
+	segment := size / int64(n)
+	for i := 0; i < n; i++ {
+		start, end := int64(i)*segment, int64(i+1)*segment-1
+		if i == n-1 {
+			end = size - 1
+		}
+		go func() {
+			err := fetchSegment(ctx, c, u, f, start, end, progress)
+			if err != nil {
+				cancel()
+			}
+			errs <- err
+		}()
+	}
+	for i := 0; i < n; i++ {
+		// the ranges canceled because another one failed don't hide its error
+		if e := <-errs; e != nil && (err == nil || errors.Is(err, context.Canceled)) {
+			err = e
+		}
+	}
+
+	if pw != nil {
+		pw.CloseWithError(err)
+		if e := <-progressErr; err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// fetchSegment downloads the bytes start to end, included, of the image at
+// u to the same offsets of f, as downloadSegment does, fetching them again
+// up to segmentAttempts times while they fail their integrity check. Only
+// the bytes beyond those already copied to progress, if not nil, are copied
+// again.
+func fetchSegment(ctx context.Context, c *scslibrary.Client, u string, f *os.File, start, end int64, progress io.Writer) error {
+	var p *rangeProgress
+	if progress != nil {
+		p = &rangeProgress{w: progress}
+		progress = p
+	}
+	for attempt := 1; ; attempt++ {
+		if p != nil {
+			p.n = 0
+		}
+		err := downloadSegment(ctx, c, u, f, start, end, progress)
+		if !errors.Is(err, errCorruptRange) || attempt == segmentAttempts {
+			return err
+		}
+		sylog.Warningf("Bytes %d-%d of %s are corrupt, fetching them again (attempt %d of %d)", start, end, u, attempt+1, segmentAttempts)
+	}
+}
+
+// downloadSegment downloads the bytes start to end, included, of the image
+// at u to the same offsets of f, copying them to progress if not nil. They
+// are checked against the sha-256 Content-Digest of the response, if any.
+func downloadSegment(ctx context.Context, c *scslibrary.Client, u string, f *os.File, start, end int64, progress io.Writer) error {
+	req, err := imageRequest(ctx, c, u)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+
+	res, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusOK:
+		return errNoRanges
+	default:
+		return &client.StatusError{Code: res.StatusCode, Err: fmt.Errorf("unexpected http status code: %d", res.StatusCode)}
+	}
+	if want := fmt.Sprintf("bytes %d-%d/", start, end); !strings.HasPrefix(res.Header.Get("Content-Range"), want) {
+		return fmt.Errorf("library served range %q instead of bytes %d-%d", res.Header.Get("Content-Range"), start, end)
+	}
+
+	var r io.Reader = res.Body
+	if progress != nil {
+		r = io.TeeReader(r, progress)
+	}
+	w := client.NetworkWriter(ctx, &offsetWriter{w: f, off: start})
+	digest, ok := contentDigest(res.Header)
+	h := sha256.New()
+	if ok {
+		w = io.MultiWriter(w, h)
+	}
+	written, err := io.Copy(w, io.LimitReader(r, end-start+1))
+	if err != nil {
+		return err
+	}
+	if written != end-start+1 {
+		return fmt.Errorf("range %d-%d cut short at %d bytes: %w", start, end, written, io.ErrUnexpectedEOF)
+	}
+	if ok && !bytes.Equal(h.Sum(nil), digest) {
+		return fmt.Errorf("bytes %d-%d: %w", start, end, errCorruptRange)
+	}
+	return nil
+}
+
+// contentDigest returns the sha-256 digest of the content of the response
+// with the header h, from its Content-Digest (RFC 9530), ok being false if
+// it has none.
+func contentDigest(h http.Header) (digest []byte, ok bool) {
+	for _, field := range strings.Split(h.Get("Content-Digest"), ",") {
+		field = strings.TrimSpace(field)
+		i := strings.Index(field, "=")
+		if i < 0 || !strings.EqualFold(field[:i], "sha-256") {
+			continue
+		}
+		value := strings.TrimSpace(field[i+1:])
+		if len(value) < 2 || value[0] != ':' || value[len(value)-1] != ':' {
+			continue
+		}
+		digest, err := base64.StdEncoding.DecodeString(value[1 : len(value)-1])
+		if err != nil || len(digest) != sha256.Size {
+			continue
+		}
+		return digest, true
+	}
+	return nil, false
+}
+
+// rangeProgress writes to w the bytes of a range beyond those it already
+// wrote, n being the offset in the range of the next bytes written.
+type rangeProgress struct {
+	w        io.Writer
+	n        int64
+	reported int64
+}
+
+func (rp *rangeProgress) Write(p []byte) (int, error) {
+	end := rp.n + int64(len(p))
+	if end > rp.reported {
+		skip := int64(0)
+		if rp.reported > rp.n {
+			skip = rp.reported - rp.n
+		}
+		if _, err := rp.w.Write(p[skip:]); err != nil {
+			return 0, err
+		}
+		rp.reported = end
+	}
+	rp.n = end
+	return len(p), nil
+}
+
+// offsetWriter writes to w from the offset off onwards.
+type offsetWriter struct {
+	w   io.WriterAt
+	off int64
+}
+
+func (ow *offsetWriter) Write(p []byte) (int, error) {
+	n, err := ow.w.WriteAt(p, ow.off)
+	ow.off += int64(n)
+	return n, err
+}
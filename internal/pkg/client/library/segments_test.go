@@ -0,0 +1,245 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package library
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sylabs/scs-library-client/client"
+	singularityclient "github.com/sylabs/singularity/internal/pkg/client"
+)
+
+func TestDownloadImageSegments(t *testing.T) {
+	defer func(size int64) {
+		minSegmentSize = size
+	}(minSegmentSize)
+	minSegmentSize = 4
+
+	image := []byte("an image downloaded in ranges")
+
+	tests := []struct {
+		name       string
+		streams    int
+		ranges     bool
+		badRange   bool
+		wantRanges []string
+		wantErr    bool
+	}{
+		{
+			name:       "Segments",
+			streams:    3,
+			ranges:     true,
+			wantRanges: []string{"bytes=0-0", "bytes=0-8", "bytes=18-28", "bytes=9-17"},
+		},
+		{
+			name:       "SingleStream",
+			streams:    1,
+			ranges:     true,
+			wantRanges: []string{"", "bytes=0-0"},
+		},
+		{
+			name:       "SmallImage",
+			streams:    16,
+			ranges:     true,
+			wantRanges: []string{"bytes=0-0", "bytes=0-3", "bytes=12-15", "bytes=16-19", "bytes=20-23", "bytes=24-28", "bytes=4-7", "bytes=8-11"},
+		},
+		{
+			// the image the library answers the size request with is kept
+			name:       "NoRange",
+			streams:    3,
+			wantRanges: []string{"bytes=0-0"},
+		},
+		{
+			name:     "Misassembled",
+			streams:  3,
+			ranges:   true,
+			badRange: true,
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := singularityclient.WithSettings(context.Background(), singularityclient.Settings{StreamCount: tt.streams})
+
+			var mu sync.Mutex
+			var gotRanges []string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/version" {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				mu.Lock()
+				gotRanges = append(gotRanges, r.Header.Get("Range"))
+				mu.Unlock()
+				var start, end int
+				if _, err := fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-%d", &start, &end); err == nil && tt.badRange {
+					// every range is served from the start of the image
+					r.Header.Set("Range", fmt.Sprintf("bytes=0-%d", end-start))
+				}
+				if !tt.ranges {
+					r.Header.Del("Range")
+				}
+				w.Header().Set("Accept-Ranges", "bytes")
+				http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(image))
+			}))
+			defer srv.Close()
+
+			dir, err := ioutil.TempDir("", "library-segments-")
+			if err != nil {
+				t.Fatalf("failed to create temporary directory: %v", err)
+			}
+			defer os.RemoveAll(dir)
+
+			c, err := client.NewClient(&client.Config{BaseURL: srv.URL})
+			if err != nil {
+				t.Fatalf("failed to create client: %v", err)
+			}
+
+			var progress int64
+			callback := func(total int64, r io.Reader, w io.Writer) error {
+				if total != int64(len(image)) {
+					t.Errorf("got progress total %d, want %d", total, len(image))
+				}
+				n, err := io.Copy(w, r)
+				progress = n
+				return err
+			}
+
+			path := filepath.Join(dir, "image.sif")
+			err = DownloadImage(ctx, c, path, "amd64", "user/collection/container", callback)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("unexpected success downloading misassembled ranges")
+				}
+				if _, err := os.Stat(path); !os.IsNotExist(err) {
+					t.Errorf("incomplete image kept: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if b, err := ioutil.ReadFile(path); err != nil || !bytes.Equal(b, image) {
+				t.Errorf("unexpected image %q: %v", b, err)
+			}
+			if progress != int64(len(image)) {
+				t.Errorf("got progress of %d bytes, want %d", progress, len(image))
+			}
+			sort.Strings(gotRanges)
+			if strings.Join(gotRanges, ",") != strings.Join(tt.wantRanges, ",") {
+				t.Errorf("got ranges %q, want %q", gotRanges, tt.wantRanges)
+			}
+		})
+	}
+}
+
+func TestDownloadImageSegmentDigest(t *testing.T) {
+	defer func(size int64) {
+		minSegmentSize = size
+	}(minSegmentSize)
+	minSegmentSize = 4
+	ctx := singularityclient.WithSettings(context.Background(), singularityclient.Settings{StreamCount: 3})
+
+	image := []byte("an image downloaded in ranges")
+
+	tests := []struct {
+		name     string
+		corrupt  int
+		wantErr  bool
+		wantGets int
+	}{
+		{name: "Verified", wantGets: 4},
+		{name: "Refetched", corrupt: 1, wantGets: 5},
+		{name: "Corrupt", corrupt: segmentAttempts, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			gets, corrupt := 0, tt.corrupt
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				defer mu.Unlock()
+				gets++
+
+				w.Header().Set("Accept-Ranges", "bytes")
+				var start, end int
+				if _, err := fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-%d", &start, &end); err != nil {
+					w.Write(image)
+					return
+				}
+				content := append([]byte(nil), image[start:end+1]...)
+				sum := sha256.Sum256(content)
+				if start == 9 && corrupt > 0 {
+					// the middle range is corrupt in transit
+					corrupt--
+					content[0] ^= 0xff
+				}
+				w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(image)))
+				w.Header().Set("Content-Digest", "sha-256=:"+base64.StdEncoding.EncodeToString(sum[:])+":")
+				w.WriteHeader(http.StatusPartialContent)
+				w.Write(content)
+			}))
+			defer srv.Close()
+
+			dir, err := ioutil.TempDir("", "library-segments-")
+			if err != nil {
+				t.Fatalf("failed to create temporary directory: %v", err)
+			}
+			defer os.RemoveAll(dir)
+
+			c, err := client.NewClient(&client.Config{BaseURL: srv.URL})
+			if err != nil {
+				t.Fatalf("failed to create client: %v", err)
+			}
+
+			var progress int64
+			callback := func(total int64, r io.Reader, w io.Writer) error {
+				n, err := io.Copy(w, r)
+				progress = n
+				return err
+			}
+
+			path := filepath.Join(dir, "image.sif")
+			err = DownloadImage(ctx, c, path, "amd64", "user/collection/container", callback)
+			if tt.wantErr {
+				if !errors.Is(err, errCorruptRange) {
+					t.Fatalf("got error %v, want a corrupt range", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if b, err := ioutil.ReadFile(path); err != nil || !bytes.Equal(b, image) {
+				t.Errorf("unexpected image %q: %v", b, err)
+			}
+			if progress != int64(len(image)) {
+				t.Errorf("got progress of %d bytes, want %d", progress, len(image))
+			}
+			if gets != tt.wantGets {
+				t.Errorf("got %d requests, want %d", gets, tt.wantGets)
+			}
+		})
+	}
+}
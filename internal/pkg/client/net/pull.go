@@ -7,10 +7,12 @@ package net
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"os"
@@ -18,11 +20,11 @@ import (
 	"strings"
 	"time"
 
+	"github.com/sylabs/sif/pkg/sif"
 	"github.com/sylabs/singularity/internal/pkg/cache"
 	"github.com/sylabs/singularity/internal/pkg/client"
 	"github.com/sylabs/singularity/internal/pkg/util/fs"
 	"github.com/sylabs/singularity/pkg/sylog"
-	useragent "github.com/sylabs/singularity/pkg/util/user-agent"
 )
 
 // Timeout for an image pull in seconds - could be a large download...
@@ -35,9 +37,19 @@ func IsNetPullRef(netRef string) bool {
 	return match
 }
 
+// isGzip returns true if the response is a gzip compressed image, going by
+// its Content-Encoding or the extension of the requested URL.
+func isGzip(res *http.Response) bool {
+	if !res.Uncompressed && strings.EqualFold(res.Header.Get("Content-Encoding"), "gzip") {
+		return true
+	}
+	return strings.HasSuffix(res.Request.URL.Path, ".gz")
+}
+
 // DownloadImage will retrieve an image from an http(s) URI,
-// saving it into the specified file
-func DownloadImage(ctx context.Context, filePath string, netURL string) error {
+// saving it into the specified file. Gzip compressed images are
+// decompressed on the fly, unless noDecompress is set.
+func DownloadImage(ctx context.Context, filePath string, netURL string, noDecompress bool) error {
 
 	if !IsNetPullRef(netURL) {
 		return fmt.Errorf("not a valid url reference: %s", netURL)
@@ -45,87 +57,168 @@ func DownloadImage(ctx context.Context, filePath string, netURL string) error {
 	if filePath == "" {
 		refParts := strings.Split(netURL, "/")
 		filePath = refParts[len(refParts)-1]
+		if !noDecompress {
+			filePath = strings.TrimSuffix(filePath, ".gz")
+		}
 		sylog.Infof("Download filename not provided. Downloading to: %s\n", filePath)
 	}
 
-	url := netURL
-	sylog.Debugf("Pulling from URL: %s\n", url)
+	sylog.Debugf("Pulling from URL: %s\n", netURL)
 
-	httpClient := &http.Client{
-		Timeout: pullTimeout * time.Second,
+	// Perms are 777 *prior* to umask
+	out, err := os.OpenFile(filePath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0777)
+	if err != nil {
+		return err
 	}
+	out.Close()
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	httpClient := client.NewHTTPClient(pullTimeout * time.Second)
+	err = client.Retry(ctx, netURL, func() error {
+		return downloadRange(ctx, httpClient, filePath, netURL, noDecompress)
+	})
 	if err != nil {
+		// Delete incomplete image file in the event of failure
+		// we get here e.g. if the context is canceled by Ctrl-C
+		client.RemoveIncomplete(filePath)
 		return err
 	}
 
-	req.Header.Set("User-Agent", useragent.Value())
+	sylog.Debugf("Download complete\n")
 
-	res, err := httpClient.Do(req)
+	return nil
+}
+
+// downloadRange downloads the rest of the image at filePath from netURL,
+// with a range request for the bytes following those already there, if any.
+// Decompressed images are downloaded again from the start.
+func downloadRange(ctx context.Context, httpClient *http.Client, filePath, netURL string, noDecompress bool) error {
+	var offset int64
+	if fi, err := os.Stat(filePath); err == nil {
+		offset = fi.Size()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, netURL, nil)
 	if err != nil {
 		return err
 	}
-	defer res.Body.Close()
 
-	if res.StatusCode == http.StatusNotFound {
-		return fmt.Errorf("the requested image was not found")
+	req.Header.Set("User-Agent", client.UserAgent(ctx))
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return err
 	}
+	defer res.Body.Close()
 
-	if res.StatusCode != http.StatusOK {
+	decompress := !noDecompress && isGzip(res)
+	flags := os.O_WRONLY | os.O_TRUNC
+	switch {
+	case res.StatusCode == http.StatusPartialContent && offset > 0 && !decompress:
+		sylog.Infof("Resuming download of %s at %d bytes", netURL, offset)
+		flags = os.O_WRONLY | os.O_APPEND
+	case (res.StatusCode == http.StatusPartialContent || res.StatusCode == http.StatusRequestedRangeNotSatisfiable) && offset > 0:
+		// the decompressed bytes or the partial file are no prefix of
+		// the response
+		res.Body.Close()
+		if err := os.Truncate(filePath, 0); err != nil {
+			return err
+		}
+		return downloadRange(ctx, httpClient, filePath, netURL, noDecompress)
+	case res.StatusCode == http.StatusNotFound:
+		return &client.StatusError{Code: res.StatusCode, Err: fmt.Errorf("the requested image was not found")}
+	case res.StatusCode != http.StatusOK:
 		buf := new(bytes.Buffer)
 		buf.ReadFrom(res.Body)
 		s := buf.String()
-		return fmt.Errorf("Download did not succeed: %d %s\n\t",
-			res.StatusCode, s)
+		return &client.StatusError{Code: res.StatusCode, Err: fmt.Errorf("Download did not succeed: %d %s\n\t",
+			res.StatusCode, s)}
 	}
 
 	sylog.Debugf("OK response received, beginning body download\n")
 
-	// Perms are 777 *prior* to umask
-	out, err := os.OpenFile(filePath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0777)
+	out, err := os.OpenFile(filePath, flags, 0777)
 	if err != nil {
 		return err
 	}
 	defer out.Close()
 
-	pb := client.ProgressBarCallback(ctx)
-
-	err = pb(res.ContentLength, res.Body, out)
-
+	if decompress {
+		sylog.Debugf("Decompressing gzip image")
+		err = copyGunzip(ctx, out, res)
+	} else {
+		err = copyBody(ctx, out, res)
+	}
 	if err != nil {
-		// Delete incomplete image file in the event of failure
-		// we get here e.g. if the context is canceled by Ctrl-C
-		res.Body.Close()
+		return err
+	}
+
+	if decompress {
 		out.Close()
-		sylog.Infof("Cleaning up incomplete download: %s", filePath)
-		if err := os.Remove(filePath); err != nil {
-			sylog.Errorf("Error while removing incomplete download: %v", err)
+		fimg, err := sif.LoadContainer(filePath, true)
+		if err != nil {
+			return fmt.Errorf("decompressed image is not a SIF image: %v", err)
 		}
-		return err
+		fimg.UnloadContainer()
 	}
+	return nil
+}
 
-	sylog.Debugf("Download complete\n")
+// copyBody writes the response body to w, with a progress bar if enabled.
+func copyBody(ctx context.Context, w io.Writer, res *http.Response) error {
+	w = client.NetworkWriter(ctx, w)
+	if pb := client.ProgressBarCallback(ctx); pb != nil {
+		return pb(res.ContentLength, res.Body, w)
+	}
+	return client.CopyWithContext(ctx, w, res.Body)
+}
 
-	return nil
+// copyGunzip writes the decompressed response body to w. The progress
+// bar tracks the compressed bytes received, as the response length is
+// the compressed one.
+func copyGunzip(ctx context.Context, w io.Writer, res *http.Response) error {
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		gz, err := gzip.NewReader(pr)
+		if err == nil {
+			_, err = io.Copy(w, gz)
+		}
+		if err != nil {
+			err = fmt.Errorf("while decompressing image: %v", err)
+		}
+		pr.CloseWithError(err)
+		done <- err
+	}()
+
+	err := copyBody(ctx, pw, res)
+	pw.CloseWithError(err)
+	if gzErr := <-done; gzErr != nil {
+		return gzErr
+	}
+	return err
 }
 
-// pull will pull a http(s) image into the cache if directTo="", or a specific file if directTo is set.
-func pull(ctx context.Context, imgCache *cache.Handle, directTo, pullFrom string) (imagePath string, err error) {
+// CacheHash returns the hash the http(s) image pullFrom is cached with.
+func CacheHash(ctx context.Context, pullFrom string, noDecompress bool) (string, error) {
 	// We will cache using a sha256 over the URL and the date of the file that
 	// is to be fetched, as returned by an HTTP HEAD call and the Last-Modified
 	// header. If no date is available, use the current date-time, which will
 	// effectively result in no caching.
 	imageDate := time.Now().String()
 
-	req, err := http.NewRequest("HEAD", pullFrom, nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, pullFrom, nil)
 	if err != nil {
-		sylog.Fatalf("Error constructing http request: %v\n", err)
+		return "", fmt.Errorf("error constructing http request: %v", err)
 	}
-	res, err := http.DefaultClient.Do(req)
+	req.Header.Set("User-Agent", client.UserAgent(ctx))
+	res, err := client.NewHTTPClient(0).Do(req)
 	if err != nil {
-		sylog.Fatalf("Error making http request: %v\n", err)
+		return "", fmt.Errorf("error making http request: %v", err)
 	}
+	res.Body.Close()
 
 	headerDate := res.Header.Get("Last-Modified")
 	sylog.Debugf("HTTP Last-Modified header is: %s", headerDate)
@@ -135,14 +228,32 @@ func pull(ctx context.Context, imgCache *cache.Handle, directTo, pullFrom string
 
 	h := sha256.New()
 	h.Write([]byte(pullFrom + imageDate))
+	// raw compressed images are cached separately
+	if noDecompress {
+		h.Write([]byte("raw"))
+	}
 	hash := hex.EncodeToString(h.Sum(nil))
 	sylog.Debugf("Image hash for cache is: %s", hash)
+	return hash, nil
+}
+
+// pull will pull a http(s) image into the cache if directTo="", or a specific file if directTo is set.
+// The image is removed unless it has the sha256 hash digest, if not empty.
+func pull(ctx context.Context, imgCache *cache.Handle, directTo, pullFrom string, noDecompress bool, digest string) (imagePath string, err error) {
+	hash, err := CacheHash(ctx, pullFrom, noDecompress)
+	if err != nil {
+		return "", err
+	}
 
 	if directTo != "" {
 		sylog.Infof("Downloading network image")
-		if err := DownloadImage(ctx, directTo, pullFrom); err != nil {
+		if err := DownloadImage(ctx, directTo, pullFrom, noDecompress); err != nil {
 			return "", fmt.Errorf("unable to Download Image: %v", err)
 		}
+		if err := client.VerifyDigest(directTo, digest); err != nil {
+			os.Remove(directTo)
+			return "", err
+		}
 		imagePath = directTo
 
 	} else {
@@ -154,9 +265,13 @@ func pull(ctx context.Context, imgCache *cache.Handle, directTo, pullFrom string
 
 		if !cacheEntry.Exists {
 			sylog.Infof("Downloading network image")
-			err := DownloadImage(ctx, cacheEntry.TmpPath, pullFrom)
+			err := DownloadImage(ctx, cacheEntry.TmpPath, pullFrom, noDecompress)
 			if err != nil {
-				sylog.Fatalf("%v\n", err)
+				return "", fmt.Errorf("unable to Download Image: %v", err)
+			}
+			// not cached unless verified
+			if err := client.VerifyDigest(cacheEntry.TmpPath, digest); err != nil {
+				return "", err
 			}
 
 			err = cacheEntry.Finalize()
@@ -166,6 +281,9 @@ func pull(ctx context.Context, imgCache *cache.Handle, directTo, pullFrom string
 
 		} else {
 			sylog.Verbosef("Using image from cache")
+			if err := client.VerifyDigest(cacheEntry.Path, digest); err != nil {
+				return "", fmt.Errorf("cached image %s: %w", cacheEntry.Path, err)
+			}
 		}
 
 		imagePath = cacheEntry.Path
@@ -174,8 +292,9 @@ func pull(ctx context.Context, imgCache *cache.Handle, directTo, pullFrom string
 	return imagePath, nil
 }
 
-// Pull will pull a http(s) image to the cache or direct to a temporary file if cache is disabled
-func Pull(ctx context.Context, imgCache *cache.Handle, pullFrom string, tmpDir string) (imagePath string, err error) {
+// Pull will pull a http(s) image to the cache or direct to a temporary file if cache is disabled.
+// The image is not cached unless it has the sha256 hash digest, if not empty.
+func Pull(ctx context.Context, imgCache *cache.Handle, pullFrom string, tmpDir string, noDecompress bool, digest string) (imagePath string, err error) {
 
 	directTo := ""
 
@@ -188,19 +307,29 @@ func Pull(ctx context.Context, imgCache *cache.Handle, pullFrom string, tmpDir s
 		sylog.Infof("Downloading library image to tmp cache: %s", directTo)
 	}
 
-	return pull(ctx, imgCache, directTo, pullFrom)
+	return pull(ctx, imgCache, directTo, pullFrom, noDecompress, digest)
 }
 
-// PullToFile will pull an http(s) image to the specified location, through the cache, or directly if cache is disabled
-func PullToFile(ctx context.Context, imgCache *cache.Handle, pullTo, pullFrom, tmpDir string) (imagePath string, err error) {
+// PullToFile will pull an http(s) image to the specified location, through the cache, or directly if cache is disabled.
+// The image is neither cached nor written to pullTo unless it has the sha256 hash digest, if not empty.
+func PullToFile(ctx context.Context, imgCache *cache.Handle, pullTo, pullFrom, tmpDir string, noDecompress bool, digest string) (imagePath string, err error) {
 
 	directTo := ""
 	if imgCache.IsDisabled() {
 		directTo = pullTo
 		sylog.Debugf("Cache disabled, pulling directly to: %s", directTo)
+	} else if imgCache.IsReadOnly() {
+		hash, err := CacheHash(ctx, pullFrom, noDecompress)
+		if err != nil {
+			return "", err
+		}
+		if _, cached, _ := imgCache.Lookup(cache.NetCacheType, hash); !cached {
+			directTo = pullTo
+			sylog.Debugf("Image not in the read-only cache, pulling directly to: %s", directTo)
+		}
 	}
 
-	src, err := pull(ctx, imgCache, directTo, pullFrom)
+	src, err := pull(ctx, imgCache, directTo, pullFrom, noDecompress, digest)
 	if err != nil {
 		return "", fmt.Errorf("error fetching image to cache: %v", err)
 	}
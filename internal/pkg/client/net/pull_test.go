@@ -0,0 +1,97 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package net
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sylabs/singularity/internal/pkg/cache"
+	"github.com/sylabs/singularity/internal/pkg/client"
+	useragent "github.com/sylabs/singularity/pkg/util/user-agent"
+)
+
+const (
+	imageDigest = "sha256:6105d6cc76af400325e94d588ce511be5bfdbb73b437dc51eca43917d7a43e3d"
+	wrongDigest = "sha256:0000000000000000000000000000000000000000000000000000000000000000"
+)
+
+func TestPullDigest(t *testing.T) {
+	useragent.InitValue("singularity", "3.0.0")
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Last-Modified", "Mon, 01 Jun 2020 00:00:00 GMT")
+		w.Write([]byte("image"))
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "net-pull-test-")
+	if err != nil {
+		t.Fatalf("could not create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	// the cache is disabled unless the real user can write to it
+	if err := os.Chmod(dir, 0777); err != nil {
+		t.Fatalf("could not change permissions of %s: %v", dir, err)
+	}
+	imgCache, err := cache.New(cache.Config{ParentDir: dir})
+	if err != nil {
+		t.Fatalf("could not create cache: %v", err)
+	}
+	if imgCache.IsDisabled() {
+		t.Skip("cache directory is not writable")
+	}
+
+	ref := srv.URL + "/image.sif"
+	hash, err := CacheHash(context.Background(), ref, true)
+	if err != nil {
+		t.Fatalf("could not get cache hash: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		directTo   string
+		digest     string
+		wantErr    bool
+		wantCached bool
+	}{
+		{name: "CacheMismatch", digest: wrongDigest, wantErr: true},
+		{name: "CacheMatch", digest: imageDigest, wantCached: true},
+		{name: "CachedMismatch", digest: wrongDigest, wantErr: true, wantCached: true},
+		// bypassing the cache, populated by CacheMatch
+		{name: "DirectMismatch", directTo: filepath.Join(dir, "direct.sif"), digest: wrongDigest, wantErr: true, wantCached: true},
+		{name: "DirectMatch", directTo: filepath.Join(dir, "direct.sif"), digest: imageDigest, wantCached: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, err := pull(context.Background(), imgCache, tt.directTo, ref, true, tt.digest)
+			if tt.wantErr {
+				if !errors.Is(err, client.ErrDigestMismatch) {
+					t.Errorf("got error %v, want %v", err, client.ErrDigestMismatch)
+				}
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			} else if _, err := os.Stat(path); err != nil {
+				t.Errorf("image not pulled: %v", err)
+			}
+
+			if _, cached, _ := imgCache.Lookup(cache.NetCacheType, hash); cached != tt.wantCached {
+				t.Errorf("got cached %v, want %v", cached, tt.wantCached)
+			}
+			if tt.directTo != "" {
+				if _, err := os.Stat(tt.directTo); os.IsNotExist(err) != tt.wantErr {
+					t.Errorf("got %s removed %v, want %v", tt.directTo, os.IsNotExist(err), tt.wantErr)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,33 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package oci
+
+import (
+	"fmt"
+	"net"
+	"time"
+)
+
+const (
+	// DockerDaemonTransport is the transport used to read images from the local Docker daemon.
+	DockerDaemonTransport = "docker-daemon"
+	// dockerSocket is the socket the docker-daemon transport connects to.
+	dockerSocket = "/var/run/docker.sock"
+)
+
+// CheckDockerDaemon returns an error if the local Docker daemon socket used by
+// the docker-daemon transport is not accessible, suggesting the podman
+// transport if the Podman socket is.
+func CheckDockerDaemon() error {
+	conn, err := net.DialTimeout("unix", dockerSocket, 5*time.Second)
+	if err != nil {
+		if CheckPodman() == nil {
+			return fmt.Errorf("docker daemon socket %s is not accessible, use the podman transport to pull from Podman: %v", dockerSocket, err)
+		}
+		return fmt.Errorf("docker daemon socket %s is not accessible, is docker running and are you allowed to use it?: %v", dockerSocket, err)
+	}
+	return conn.Close()
+}
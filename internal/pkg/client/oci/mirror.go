@@ -0,0 +1,44 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package oci
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/containers/image/v5/docker/reference"
+)
+
+// dockerHubDomain is the registry domain of docker references without one.
+const dockerHubDomain = "docker.io"
+
+// MirrorRef rewrites the docker:// reference ref to pull from mirror when
+// it points to Docker Hub, after the implicit docker.io/library/
+// normalization. mirror is a registry host, optionally with a path prefix.
+// Other references are returned unchanged.
+func MirrorRef(ref, mirror string) (string, error) {
+	if mirror == "" || !strings.HasPrefix(ref, "docker://") {
+		return ref, nil
+	}
+
+	named, err := reference.ParseNormalizedNamed(strings.TrimPrefix(ref, "docker://"))
+	if err != nil {
+		return "", fmt.Errorf("invalid docker reference %s: %v", ref, err)
+	}
+	if reference.Domain(named) != dockerHubDomain {
+		return ref, nil
+	}
+
+	mirror = strings.TrimPrefix(strings.TrimPrefix(mirror, "https://"), "http://")
+	mirror = strings.TrimSuffix(mirror, "/")
+
+	// substitute the registry, keeping the repository path, tag and digest
+	mirrored := mirror + strings.TrimPrefix(named.String(), dockerHubDomain)
+	if _, err := reference.ParseNormalizedNamed(mirrored); err != nil {
+		return "", fmt.Errorf("invalid registry mirror %s: %v", mirror, err)
+	}
+	return "docker://" + mirrored, nil
+}
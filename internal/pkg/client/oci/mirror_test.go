@@ -0,0 +1,45 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package oci
+
+import (
+	"testing"
+)
+
+func TestMirrorRef(t *testing.T) {
+	tests := []struct {
+		name      string
+		ref       string
+		mirror    string
+		expected  string
+		expectErr bool
+	}{
+		{"no mirror", "docker://ubuntu", "", "docker://ubuntu", false},
+		{"official image", "docker://ubuntu", "mirror.internal", "docker://mirror.internal/library/ubuntu", false},
+		{"official image with tag", "docker://ubuntu:18.04", "mirror.internal", "docker://mirror.internal/library/ubuntu:18.04", false},
+		{"user image", "docker://sylabsio/lolcow", "mirror.internal:5000", "docker://mirror.internal:5000/sylabsio/lolcow", false},
+		{"explicit docker.io", "docker://docker.io/library/alpine:3.11", "mirror.internal", "docker://mirror.internal/library/alpine:3.11", false},
+		{"mirror with scheme and path", "docker://alpine", "https://mirror.internal/hub/", "docker://mirror.internal/hub/library/alpine", false},
+		{"digest", "docker://alpine@sha256:" + digest, "mirror.internal", "docker://mirror.internal/library/alpine@sha256:" + digest, false},
+		{"other registry", "docker://quay.io/user/image", "mirror.internal", "docker://quay.io/user/image", false},
+		{"other transport", "oras://ghcr.io/user/image", "mirror.internal", "oras://ghcr.io/user/image", false},
+		{"invalid mirror", "docker://alpine", "Mirror Internal", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := MirrorRef(tt.ref, tt.mirror)
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
+
+const digest = "a15790640a6690aa1730c38cf0a440e2aa44aaca9b0e8931a9f2b0d7cc90fd65"
@@ -0,0 +1,75 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package oci
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sylabs/singularity/internal/pkg/util/uri"
+	buildtypes "github.com/sylabs/singularity/pkg/build/types"
+)
+
+// PodmanTransport is the transport used to read images from the local Podman
+// storage, through the Docker compatible API of the Podman socket.
+const PodmanTransport = "podman"
+
+// podmanSocket returns the Podman socket the podman transport connects to:
+// the one of $CONTAINER_HOST if set, the rootless socket of the user
+// otherwise, or the system one for root.
+func podmanSocket() string {
+	if h := os.Getenv("CONTAINER_HOST"); strings.HasPrefix(h, "unix://") {
+		return strings.TrimPrefix(h, "unix://")
+	}
+	if os.Geteuid() == 0 {
+		return "/run/podman/podman.sock"
+	}
+	if d := os.Getenv("XDG_RUNTIME_DIR"); d != "" {
+		return filepath.Join(d, "podman", "podman.sock")
+	}
+	return fmt.Sprintf("/run/user/%d/podman/podman.sock", os.Getuid())
+}
+
+// CheckPodman returns an error if the Podman socket used by the podman
+// transport is not accessible.
+func CheckPodman() error {
+	socket := podmanSocket()
+	conn, err := net.DialTimeout("unix", socket, 5*time.Second)
+	if err != nil {
+		return fmt.Errorf("podman socket %s is not accessible, is the podman service running ('systemctl --user start podman.socket')?: %v", socket, err)
+	}
+	return conn.Close()
+}
+
+// daemonRef returns the reference and options the image pullFrom is read
+// with. Images of the podman transport are read as docker-daemon ones from
+// the Podman socket. An error is returned if the socket of the daemon
+// holding the image isn't accessible.
+func daemonRef(pullFrom string, opts buildtypes.Options) (string, buildtypes.Options, error) {
+	transport, _ := uri.Split(pullFrom)
+	switch transport {
+	case DockerDaemonTransport:
+		if err := CheckDockerDaemon(); err != nil {
+			return "", opts, err
+		}
+	case PodmanTransport:
+		if err := CheckPodman(); err != nil {
+			return "", opts, err
+		}
+		// docker-daemon references require a tag
+		_, ref, err := uri.Normalize(pullFrom)
+		if err != nil {
+			return "", opts, err
+		}
+		opts.DockerDaemonHost = "unix://" + podmanSocket()
+		return DockerDaemonTransport + ":" + strings.TrimPrefix(ref, "//"), opts, nil
+	}
+	return pullFrom, opts, nil
+}
@@ -0,0 +1,64 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package oci
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	buildtypes "github.com/sylabs/singularity/pkg/build/types"
+)
+
+func TestDaemonRef(t *testing.T) {
+	dir, err := ioutil.TempDir("", "podman-test-")
+	if err != nil {
+		t.Fatalf("could not create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, "podman.sock")
+	defer func(h string) { os.Setenv("CONTAINER_HOST", h) }(os.Getenv("CONTAINER_HOST"))
+	os.Setenv("CONTAINER_HOST", "unix://"+socket)
+
+	if _, _, err := daemonRef("podman://localhost/image", buildtypes.Options{}); err == nil {
+		t.Errorf("unexpected success without podman socket")
+	}
+
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("could not listen on %s: %v", socket, err)
+	}
+	defer l.Close()
+
+	tests := []struct {
+		pullFrom string
+		ref      string
+	}{
+		{"podman://localhost/image", "docker-daemon:localhost/image:latest"},
+		{"podman:localhost/image:1.0", "docker-daemon:localhost/image:1.0"},
+		{"docker://alpine", "docker://alpine"},
+	}
+	for _, tt := range tests {
+		ref, opts, err := daemonRef(tt.pullFrom, buildtypes.Options{})
+		if err != nil {
+			t.Errorf("unexpected error for %s: %v", tt.pullFrom, err)
+			continue
+		}
+		if ref != tt.ref {
+			t.Errorf("got reference %s for %s, want %s", ref, tt.pullFrom, tt.ref)
+		}
+		if ref != tt.pullFrom && opts.DockerDaemonHost != "unix://"+socket {
+			t.Errorf("unexpected daemon host %q for %s", opts.DockerDaemonHost, tt.pullFrom)
+		}
+	}
+
+	if IsSupported(PodmanTransport) != PodmanTransport {
+		t.Errorf("podman transport not supported")
+	}
+}
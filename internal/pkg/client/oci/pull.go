@@ -9,38 +9,139 @@ import (
 	"context"
 	"fmt"
 	"io/ioutil"
+	"runtime"
+	"strings"
 
 	ocitypes "github.com/containers/image/v5/types"
 	"github.com/sylabs/singularity/internal/pkg/build"
 	"github.com/sylabs/singularity/internal/pkg/build/oci"
 	"github.com/sylabs/singularity/internal/pkg/cache"
+	"github.com/sylabs/singularity/internal/pkg/client"
 	"github.com/sylabs/singularity/internal/pkg/util/fs"
+	buildtypes "github.com/sylabs/singularity/pkg/build/types"
 	"github.com/sylabs/singularity/pkg/sylog"
 )
 
-// pull will build a SIF image into the cache if directTo="", or a specific file if directTo is set.
-func pull(ctx context.Context, imgCache *cache.Handle, directTo, pullFrom, tmpDir string, ociAuth *ocitypes.DockerAuthConfig, noHTTPS, noCleanUp bool) (imagePath string, err error) {
+// CacheHash returns the hash the SIF image built from the OCI image pullFrom
+// with opts is cached with.
+func CacheHash(ctx context.Context, pullFrom string, opts buildtypes.Options) (string, error) {
+	ctx, done := client.WithConnectTimeout(ctx)
+	hash, err := cacheHash(ctx, pullFrom, opts)
+	if err := done(); err != nil {
+		return "", err
+	}
+	return hash, err
+}
+
+// cacheHash returns the hash the SIF image built from the OCI image pullFrom
+// with opts is cached with, see CacheHash.
+func cacheHash(ctx context.Context, pullFrom string, opts buildtypes.Options) (string, error) {
+	if err := checkProxy(ctx, pullFrom); err != nil {
+		return "", err
+	}
+	pullFrom, opts, err := daemonRef(pullFrom, opts)
+	if err != nil {
+		return "", err
+	}
+
+	hash, err := oci.ImageSHA(ctx, pullFrom, systemContext(ctx, opts))
+	if err != nil {
+		return "", fmt.Errorf("failed to get checksum for %s: %s", pullFrom, err)
+	}
+	// the manifest list is the same for all the architectures
+	if opts.Arch != "" && opts.Arch != runtime.GOARCH {
+		hash += "-" + opts.Arch
+	}
+	// images built with options altering their content are cached separately
+	if opts.NoSetuid {
+		hash += "-nosuid"
+	}
+	if opts.Reproducible {
+		hash += "-reproducible"
+	}
+	if opts.Squash {
+		hash += "-squash"
+	}
+	return hash, nil
+}
+
+// Architectures returns the architectures the OCI image pullFrom is
+// available for.
+func Architectures(ctx context.Context, pullFrom string, opts buildtypes.Options) ([]string, error) {
+	if err := checkProxy(ctx, pullFrom); err != nil {
+		return nil, err
+	}
+	pullFrom, opts, err := daemonRef(pullFrom, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// containers/image connects with its own transport
+	ctx, done := client.WithConnectTimeout(ctx)
+	archs, err := oci.ImageArchitectures(ctx, pullFrom, systemContext(ctx, opts))
+	if err := done(); err != nil {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get architectures of %s: %s", pullFrom, err)
+	}
+	return archs, nil
+}
+
+// checkProxy fails for the docker:// image pullFrom when a SOCKS5 proxy is
+// set in the settings of ctx: the registry clients of containers/image
+// build their own transport, which only takes its proxy from the
+// environment, rather than bypassing the proxy.
+func checkProxy(ctx context.Context, pullFrom string) error {
+	if client.SettingsFromContext(ctx).SOCKS5Proxy == nil || !strings.HasPrefix(pullFrom, "docker://") {
+		return nil
+	}
+	return fmt.Errorf("%s can't be pulled through a SOCKS5 proxy: containers/image only reads the proxy from the environment, e.g. HTTPS_PROXY=socks5://<host>:<port>", pullFrom)
+}
+
+// systemContext returns the containers/image context of the requests made
+// for the image with opts and ctx.
+func systemContext(ctx context.Context, opts buildtypes.Options) *ocitypes.SystemContext {
 	// DockerInsecureSkipTLSVerify is set only if --nohttps is specified to honor
 	// configuration from /etc/containers/registries.conf because DockerInsecureSkipTLSVerify
 	// can have three possible values true/false and undefined, so we left it as undefined instead
 	// of forcing it to false in order to delegate decision to /etc/containers/registries.conf:
 	// https://github.com/sylabs/singularity/issues/5172
 	sysCtx := &ocitypes.SystemContext{
-		OCIInsecureSkipTLSVerify: noHTTPS,
-		DockerAuthConfig:         ociAuth,
+		OCIInsecureSkipTLSVerify: opts.NoHTTPS,
+		DockerAuthConfig:         opts.DockerAuthConfig,
+		DockerRegistryUserAgent:  client.UserAgent(ctx),
+		ArchitectureChoice:       opts.Arch,
+		DockerDaemonHost:         opts.DockerDaemonHost,
 	}
-	if noHTTPS {
+	if opts.NoHTTPS {
 		sysCtx.DockerInsecureSkipTLSVerify = ocitypes.NewOptionalBool(true)
 	}
+	return sysCtx
+}
 
-	hash, err := oci.ImageSHA(ctx, pullFrom, sysCtx)
+// pull will build a SIF image into the cache if directTo="", or a specific file if directTo is set.
+func pull(ctx context.Context, imgCache *cache.Handle, directTo, pullFrom string, opts buildtypes.Options) (imagePath string, err error) {
+	// containers/image connects with its own transport
+	ctx, done := client.WithConnectTimeout(ctx)
+	defer func() {
+		if terr := done(); terr != nil {
+			imagePath, err = "", terr
+		}
+	}()
+
+	hash, err := cacheHash(ctx, pullFrom, opts)
 	if err != nil {
-		return "", fmt.Errorf("failed to get checksum for %s: %s", pullFrom, err)
+		return "", err
+	}
+	pullFrom, opts, err = daemonRef(pullFrom, opts)
+	if err != nil {
+		return "", err
 	}
 
 	if directTo != "" {
 		sylog.Infof("Converting OCI blobs to SIF format")
-		if err := build.ConvertOciToSIF(ctx, imgCache, pullFrom, directTo, tmpDir, noHTTPS, noCleanUp, ociAuth); err != nil {
+		if err := build.ConvertOciToSIF(ctx, imgCache, pullFrom, directTo, opts); err != nil {
 			return "", fmt.Errorf("while building SIF from layers: %v", err)
 		}
 		imagePath = directTo
@@ -54,7 +155,7 @@ func pull(ctx context.Context, imgCache *cache.Handle, directTo, pullFrom, tmpDi
 		if !cacheEntry.Exists {
 			sylog.Infof("Converting OCI blobs to SIF format")
 
-			if err := build.ConvertOciToSIF(ctx, imgCache, pullFrom, cacheEntry.TmpPath, tmpDir, noHTTPS, noCleanUp, ociAuth); err != nil {
+			if err := build.ConvertOciToSIF(ctx, imgCache, pullFrom, cacheEntry.TmpPath, opts); err != nil {
 				return "", fmt.Errorf("while building SIF from layers: %v", err)
 			}
 
@@ -73,12 +174,12 @@ func pull(ctx context.Context, imgCache *cache.Handle, directTo, pullFrom, tmpDi
 }
 
 // Pull will build a SIF image to the cache or direct to a temporary file if cache is disabled
-func Pull(ctx context.Context, imgCache *cache.Handle, pullFrom, tmpDir string, ociAuth *ocitypes.DockerAuthConfig, noHTTPS, noCleanUp bool) (imagePath string, err error) {
+func Pull(ctx context.Context, imgCache *cache.Handle, pullFrom string, opts buildtypes.Options) (imagePath string, err error) {
 
 	directTo := ""
 
 	if imgCache.IsDisabled() {
-		file, err := ioutil.TempFile(tmpDir, "sbuild-tmp-cache-")
+		file, err := ioutil.TempFile(opts.TmpDir, "sbuild-tmp-cache-")
 		if err != nil {
 			return "", fmt.Errorf("unable to create tmp file: %v", err)
 		}
@@ -86,19 +187,28 @@ func Pull(ctx context.Context, imgCache *cache.Handle, pullFrom, tmpDir string,
 		sylog.Infof("Downloading library image to tmp cache: %s", directTo)
 	}
 
-	return pull(ctx, imgCache, directTo, pullFrom, tmpDir, ociAuth, noHTTPS, noCleanUp)
+	return pull(ctx, imgCache, directTo, pullFrom, opts)
 }
 
 // PullToFile will build a SIF image from the specified oci URI and place it at the specified dest
-func PullToFile(ctx context.Context, imgCache *cache.Handle, pullTo, pullFrom, tmpDir string, ociAuth *ocitypes.DockerAuthConfig, noHTTPS, noCleanUp bool) (imagePath string, err error) {
+func PullToFile(ctx context.Context, imgCache *cache.Handle, pullTo, pullFrom string, opts buildtypes.Options) (imagePath string, err error) {
 
 	directTo := ""
 	if imgCache.IsDisabled() {
 		directTo = pullTo
 		sylog.Debugf("Cache disabled, pulling directly to: %s", directTo)
+	} else if imgCache.IsReadOnly() {
+		hash, err := CacheHash(ctx, pullFrom, opts)
+		if err != nil {
+			return "", err
+		}
+		if _, cached, _ := imgCache.Lookup(cache.OciTempCacheType, hash); !cached {
+			directTo = pullTo
+			sylog.Debugf("Image not in the read-only cache, pulling directly to: %s", directTo)
+		}
 	}
 
-	src, err := Pull(ctx, imgCache, pullFrom, tmpDir, ociAuth, noHTTPS, noCleanUp)
+	src, err := pull(ctx, imgCache, directTo, pullFrom, opts)
 	if err != nil {
 		return "", fmt.Errorf("error fetching image to cache: %v", err)
 	}
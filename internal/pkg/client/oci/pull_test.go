@@ -0,0 +1,96 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package oci
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sylabs/singularity/internal/pkg/client"
+	buildtypes "github.com/sylabs/singularity/pkg/build/types"
+	useragent "github.com/sylabs/singularity/pkg/util/user-agent"
+)
+
+func TestCheckProxy(t *testing.T) {
+	if err := checkProxy(context.Background(), "docker://alpine"); err != nil {
+		t.Errorf("unexpected error without a proxy: %v", err)
+	}
+
+	u, err := client.ParseSOCKS5Proxy("127.0.0.1:1080")
+	if err != nil {
+		t.Fatalf("could not parse proxy: %v", err)
+	}
+	ctx := client.WithSettings(context.Background(), client.Settings{SOCKS5Proxy: u})
+	if err := checkProxy(ctx, "docker://alpine"); err == nil {
+		t.Errorf("unexpected success of a docker:// image through the proxy")
+	}
+	// no connection is made for the local images
+	if err := checkProxy(ctx, "docker-archive:/tmp/alpine.tar"); err != nil {
+		t.Errorf("unexpected error for a local image: %v", err)
+	}
+}
+
+// writeLayout writes an OCI layout holding a single image without layers
+// to dir.
+func writeLayout(t *testing.T, dir string) {
+	blob := func(b string) string {
+		digest := fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(b)))
+		path := filepath.Join(dir, "blobs", "sha256", strings.TrimPrefix(digest, "sha256:"))
+		if err := ioutil.WriteFile(path, []byte(b), 0644); err != nil {
+			t.Fatalf("could not write blob: %v", err)
+		}
+		return digest
+	}
+
+	if err := os.MkdirAll(filepath.Join(dir, "blobs", "sha256"), 0755); err != nil {
+		t.Fatalf("could not create layout: %v", err)
+	}
+	config := `{"architecture":"amd64","os":"linux","rootfs":{"type":"layers","diff_ids":[]}}`
+	manifest := fmt.Sprintf(`{"schemaVersion":2,"config":{"mediaType":"application/vnd.oci.image.config.v1+json","digest":%q,"size":%d},"layers":[]}`, blob(config), len(config))
+	index := fmt.Sprintf(`{"schemaVersion":2,"manifests":[{"mediaType":"application/vnd.oci.image.manifest.v1+json","digest":%q,"size":%d}]}`, blob(manifest), len(manifest))
+	files := map[string]string{
+		"oci-layout": `{"imageLayoutVersion":"1.0.0"}`,
+		"index.json": index,
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("could not write %s: %v", name, err)
+		}
+	}
+}
+
+func TestCacheHashNoSetuid(t *testing.T) {
+	useragent.InitValue("singularity", "3.0.0")
+
+	dir, err := ioutil.TempDir("", "oci-layout-")
+	if err != nil {
+		t.Fatalf("could not create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	writeLayout(t, dir)
+
+	pullFrom := "oci:" + dir
+	kept, err := cacheHash(context.Background(), pullFrom, buildtypes.Options{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	stripped, err := cacheHash(context.Background(), pullFrom, buildtypes.Options{NoSetuid: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stripped == kept {
+		t.Errorf("images with and without setuid bits share the cache entry %s", kept)
+	}
+	if stripped != kept+"-nosuid" {
+		t.Errorf("unexpected cache entry %s of the stripped image, expected %s-nosuid", stripped, kept)
+	}
+}
@@ -9,10 +9,37 @@ import (
 	"github.com/containers/image/v5/transports"
 )
 
+// descriptions holds a short description for the known containers/image transports.
+var descriptions = map[string]string{
+	"containers-storage": "image from local containers storage",
+	"dir":                "image from a local directory",
+	"docker":             "image from a Docker registry",
+	"docker-archive":     "image from a docker save archive",
+	"docker-daemon":      "image from the local Docker daemon",
+	"oci":                "image from a local OCI layout directory",
+	"oci-archive":        "image from a tar archive of an OCI layout",
+	"podman":             "image from the local Podman storage, through the Podman socket",
+	"tarball":            "image from a tarball of root filesystem layers",
+}
+
+// Transports returns the names of the transports supported by the OCI client,
+// the containers/image ones and podman.
+func Transports() []string {
+	return append(transports.ListNames(), PodmanTransport)
+}
+
+// Description returns a short description for the given transport.
+func Description(transport string) string {
+	if d, ok := descriptions[transport]; ok {
+		return d
+	}
+	return "image from the " + transport + " containers/image transport"
+}
+
 // IsSupported returns whether or not the transport given is supported. To fit within a switch/case
 // statement, this function will return transport if it is supported
 func IsSupported(transport string) string {
-	for _, t := range transports.ListNames() {
+	for _, t := range Transports() {
 		if transport == t {
 			return transport
 		}
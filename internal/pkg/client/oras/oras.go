@@ -13,12 +13,14 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
 
 	"github.com/containerd/containerd/images"
 	"github.com/containerd/containerd/reference"
+	"github.com/containerd/containerd/remotes"
 	"github.com/containerd/containerd/remotes/docker"
 	ocitypes "github.com/containers/image/v5/types"
 	"github.com/deislabs/oras/pkg/content"
@@ -26,8 +28,10 @@ import (
 	"github.com/deislabs/oras/pkg/oras"
 	"github.com/opencontainers/go-digest"
 	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/sylabs/singularity/internal/pkg/client"
 	"github.com/sylabs/singularity/pkg/image"
 	"github.com/sylabs/singularity/pkg/sylog"
+	useragent "github.com/sylabs/singularity/pkg/util/user-agent"
 )
 
 const (
@@ -41,8 +45,9 @@ const (
 	SifLayerMediaType = "appliciation/vnd.sylabs.sif.layer.tar"
 )
 
-// DownloadImage downloads a SIF image specified by an oci reference to a file using the included credentials
-func DownloadImage(imagePath, ref string, ociAuth *ocitypes.DockerAuthConfig) error {
+// DownloadImage downloads a SIF image specified by an oci reference to a file using the included credentials,
+// over plain http if noHTTPS is set, until ctx is done
+func DownloadImage(ctx context.Context, imagePath, ref string, ociAuth *ocitypes.DockerAuthConfig, noHTTPS bool) error {
 	ref = strings.TrimPrefix(ref, "oras://")
 	ref = strings.TrimPrefix(ref, "//")
 
@@ -57,7 +62,7 @@ func DownloadImage(imagePath, ref string, ociAuth *ocitypes.DockerAuthConfig) er
 		sylog.Infof("No tag or digest found, using default: %s", SifDefaultTag)
 	}
 
-	resolver := docker.NewResolver(docker.ResolverOptions{Credentials: genCredfn(ociAuth)})
+	resolver := newResolver(client.UserAgent(ctx), ociAuth, noHTTPS)
 
 	wd, err := os.Getwd()
 	if err != nil {
@@ -88,7 +93,7 @@ func DownloadImage(imagePath, ref string, ociAuth *ocitypes.DockerAuthConfig) er
 	}
 	pullHandler := oras.WithPullBaseHandler(images.HandlerFunc(handlerFunc))
 
-	_, _, err = oras.Pull(orasctx.Background(), resolver, spec.String(), store, allowedMediaTypes, pullHandler)
+	_, _, err = oras.Pull(orasctx.WithLoggerDiscarded(ctx), resolver, spec.String(), store, allowedMediaTypes, pullHandler)
 	if err != nil {
 		return fmt.Errorf("unable to pull from registry: %s", err)
 	}
@@ -96,7 +101,7 @@ func DownloadImage(imagePath, ref string, ociAuth *ocitypes.DockerAuthConfig) er
 	// ensure that we have downloaded a SIF
 	if err := ensureSIF(imagePath); err != nil {
 		// remove whatever we downloaded if it is not a SIF
-		os.RemoveAll(imagePath)
+		client.RemoveIncomplete(imagePath)
 		return err
 	}
 
@@ -137,7 +142,7 @@ func UploadImage(path, ref string, ociAuth *ocitypes.DockerAuthConfig) error {
 		sylog.Infof("No tag or digest found, using default: %s", SifDefaultTag)
 	}
 
-	resolver := docker.NewResolver(docker.ResolverOptions{Credentials: genCredfn(ociAuth)})
+	resolver := newResolver(useragent.Value(), ociAuth, false)
 
 	store := content.NewFileStore("")
 	defer store.Close()
@@ -185,11 +190,11 @@ func ensureSIF(filepath string) error {
 // sha512 is currently optional for implementations, this function will return an error when
 // encountering such digests.
 // https://github.com/opencontainers/image-spec/blob/master/descriptor.md#registered-algorithms
-func ImageSHA(ctx context.Context, uri string, ociAuth *ocitypes.DockerAuthConfig) (string, error) {
+func ImageSHA(ctx context.Context, uri string, ociAuth *ocitypes.DockerAuthConfig, noHTTPS bool) (string, error) {
 	ref := strings.TrimPrefix(uri, "oras://")
 	ref = strings.TrimPrefix(ref, "//")
 
-	resolver := docker.NewResolver(docker.ResolverOptions{Credentials: genCredfn(ociAuth)})
+	resolver := newResolver(client.UserAgent(ctx), ociAuth, noHTTPS)
 
 	_, desc, err := resolver.Resolve(ctx, ref)
 	if err != nil {
@@ -263,6 +268,20 @@ func sha256sum(r io.Reader) (result string, nBytes int64, err error) {
 	return "sha256:" + hex.EncodeToString(hash.Sum(nil)), nBytes, nil
 }
 
+// newResolver returns a registry resolver authenticating with ociAuth,
+// connecting to the registry over plain http if noHTTPS is set, with the
+// User-Agent userAgent.
+func newResolver(userAgent string, ociAuth *ocitypes.DockerAuthConfig, noHTTPS bool) remotes.Resolver {
+	headers := http.Header{}
+	headers.Set("User-Agent", userAgent)
+	return docker.NewResolver(docker.ResolverOptions{
+		Credentials: genCredfn(ociAuth),
+		Headers:     headers,
+		Client:      client.NewHTTPClient(0),
+		PlainHTTP:   noHTTPS,
+	})
+}
+
 func genCredfn(ociAuth *ocitypes.DockerAuthConfig) func(string) (string, string, error) {
 	return func(_ string) (string, string, error) {
 		if ociAuth != nil {
@@ -9,25 +9,44 @@ import (
 	"context"
 	"fmt"
 	"io/ioutil"
+	"os"
 
 	ocitypes "github.com/containers/image/v5/types"
 	"github.com/sylabs/singularity/internal/pkg/cache"
+	"github.com/sylabs/singularity/internal/pkg/client"
 	"github.com/sylabs/singularity/internal/pkg/util/fs"
 	"github.com/sylabs/singularity/pkg/sylog"
 )
 
+// downloadImage downloads the oras image pullFrom to imagePath, adding its
+// size to the transfer of ctx as the image is a single uncompressed blob.
+func downloadImage(ctx context.Context, imagePath, pullFrom string, ociAuth *ocitypes.DockerAuthConfig, noHTTPS bool) error {
+	if err := DownloadImage(ctx, imagePath, pullFrom, ociAuth, noHTTPS); err != nil {
+		return err
+	}
+	if fi, err := os.Stat(imagePath); err == nil {
+		client.TransferFromContext(ctx).AddNetwork(fi.Size())
+	}
+	return nil
+}
+
 // pull will pull an oras image into the cache if directTo="", or a specific file if directTo is set.
-func pull(ctx context.Context, imgCache *cache.Handle, directTo, pullFrom string, ociAuth *ocitypes.DockerAuthConfig) (imagePath string, err error) {
-	hash, err := ImageSHA(ctx, pullFrom, ociAuth)
+func pull(ctx context.Context, imgCache *cache.Handle, directTo, pullFrom string, ociAuth *ocitypes.DockerAuthConfig, noHTTPS bool) (imagePath string, err error) {
+	hash, err := ImageSHA(ctx, pullFrom, ociAuth, noHTTPS)
 	if err != nil {
 		return "", fmt.Errorf("failed to get checksum for %s: %s", pullFrom, err)
 	}
 
 	if directTo != "" {
 		sylog.Infof("Downloading oras image")
-		if err := DownloadImage(directTo, pullFrom, ociAuth); err != nil {
+		if err := downloadImage(ctx, directTo, pullFrom, ociAuth, noHTTPS); err != nil {
 			return "", fmt.Errorf("unable to Download Image: %v", err)
 		}
+		if fileHash, err := ImageHash(directTo); err != nil {
+			return "", fmt.Errorf("error getting ImageHash: %v", err)
+		} else if fileHash != hash {
+			return "", fmt.Errorf("downloaded file hash(%s) and expected hash(%s) does not match", fileHash, hash)
+		}
 		imagePath = directTo
 
 	} else {
@@ -39,7 +58,7 @@ func pull(ctx context.Context, imgCache *cache.Handle, directTo, pullFrom string
 		if !cacheEntry.Exists {
 			sylog.Infof("Downloading oras image")
 
-			if err := DownloadImage(cacheEntry.TmpPath, pullFrom, ociAuth); err != nil {
+			if err := downloadImage(ctx, cacheEntry.TmpPath, pullFrom, ociAuth, noHTTPS); err != nil {
 				return "", fmt.Errorf("unable to Download Image: %v", err)
 			}
 			if cacheFileHash, err := ImageHash(cacheEntry.TmpPath); err != nil {
@@ -63,7 +82,7 @@ func pull(ctx context.Context, imgCache *cache.Handle, directTo, pullFrom string
 }
 
 // Pull will pull an oras image to the cache or direct to a temporary file if cache is disabled
-func Pull(ctx context.Context, imgCache *cache.Handle, pullFrom, tmpDir string, ociAuth *ocitypes.DockerAuthConfig) (imagePath string, err error) {
+func Pull(ctx context.Context, imgCache *cache.Handle, pullFrom, tmpDir string, ociAuth *ocitypes.DockerAuthConfig, noHTTPS bool) (imagePath string, err error) {
 
 	directTo := ""
 
@@ -76,19 +95,28 @@ func Pull(ctx context.Context, imgCache *cache.Handle, pullFrom, tmpDir string,
 		sylog.Infof("Downloading oras image to tmp cache: %s", directTo)
 	}
 
-	return pull(ctx, imgCache, directTo, pullFrom, ociAuth)
+	return pull(ctx, imgCache, directTo, pullFrom, ociAuth, noHTTPS)
 }
 
 // PullToFile will pull an oras image to the specified location, through the cache, or directly if cache is disabled
-func PullToFile(ctx context.Context, imgCache *cache.Handle, pullTo, pullFrom, tmpDir string, ociAuth *ocitypes.DockerAuthConfig) (imagePath string, err error) {
+func PullToFile(ctx context.Context, imgCache *cache.Handle, pullTo, pullFrom, tmpDir string, ociAuth *ocitypes.DockerAuthConfig, noHTTPS bool) (imagePath string, err error) {
 
 	directTo := ""
 	if imgCache.IsDisabled() {
 		directTo = pullTo
 		sylog.Debugf("Cache disabled, pulling directly to: %s", directTo)
+	} else if imgCache.IsReadOnly() {
+		hash, err := ImageSHA(ctx, pullFrom, ociAuth, noHTTPS)
+		if err != nil {
+			return "", fmt.Errorf("failed to get checksum for %s: %s", pullFrom, err)
+		}
+		if _, cached, _ := imgCache.Lookup(cache.OrasCacheType, hash); !cached {
+			directTo = pullTo
+			sylog.Debugf("Image not in the read-only cache, pulling directly to: %s", directTo)
+		}
 	}
 
-	src, err := pull(ctx, imgCache, directTo, pullFrom, ociAuth)
+	src, err := pull(ctx, imgCache, directTo, pullFrom, ociAuth, noHTTPS)
 	if err != nil {
 		return "", fmt.Errorf("error fetching image to cache: %v", err)
 	}
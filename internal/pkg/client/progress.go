@@ -7,11 +7,16 @@ package client
 
 import (
 	"context"
+	"fmt"
 	"io"
+	"os"
+	"path/filepath"
 
+	"github.com/sylabs/singularity/internal/pkg/cache"
 	"github.com/sylabs/singularity/pkg/sylog"
 	"github.com/vbauerster/mpb/v4"
 	"github.com/vbauerster/mpb/v4/decor"
+	"golang.org/x/crypto/ssh/terminal"
 )
 
 // See: https://ixday.github.io/post/golang-cancel-copy/
@@ -22,25 +27,90 @@ func (rf readerFunc) Read(p []byte) (n int, err error) { return rf(p) }
 // ProgressCallback is a function that provides progress information copying from a Reader to a Writer
 type ProgressCallback func(int64, io.Reader, io.Writer) error
 
-// ProgressBarCallback returns a progress bar callback unless e.g. --quiet or lower loglevel is set
+// ProgressGroup draws the progress bars of concurrent downloads together,
+// each prefixed with the name of its download.
+type ProgressGroup struct {
+	p *mpb.Progress
+}
+
+type progressGroupKey struct{}
+
+type progressGroupValue struct {
+	group *ProgressGroup
+	name  string
+}
+
+// NewProgressGroup returns a new progress bar group.
+func NewProgressGroup() *ProgressGroup {
+	return &ProgressGroup{p: mpb.New()}
+}
+
+// Context returns a copy of ctx for which ProgressBarCallback draws bars
+// in the group, prefixed with name.
+func (g *ProgressGroup) Context(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, progressGroupKey{}, progressGroupValue{group: g, name: name})
+}
+
+// Wait waits for all the bars of the group to be completed.
+func (g *ProgressGroup) Wait() {
+	g.p.Wait()
+}
+
+type noProgressKey struct{}
+
+// WithoutProgress returns a copy of ctx for which ProgressBarCallback draws
+// no progress bar, e.g. as stdout holds machine-readable output.
+func WithoutProgress(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noProgressKey{}, true)
+}
+
+// progressDisabled returns whether progress bars were disabled for ctx with
+// WithoutProgress.
+func progressDisabled(ctx context.Context) bool {
+	disabled, _ := ctx.Value(noProgressKey{}).(bool)
+	return disabled
+}
+
+// ProgressBarCallback returns a progress bar callback unless e.g. --quiet or lower loglevel is set,
+// stdout is not a terminal or the progress was disabled with WithoutProgress. The bar shows the
+// bytes transferred, percentage, rate and ETA of the download, or only the bytes transferred and
+// rate next to a spinner when its size is unknown, e.g. without Content-Length.
 func ProgressBarCallback(ctx context.Context) ProgressCallback {
 
-	if sylog.GetLevel() <= -1 {
+	if sylog.GetLevel() <= -1 || progressDisabled(ctx) || !terminal.IsTerminal(int(os.Stdout.Fd())) {
 		return nil
 	}
 
 	return func(totalSize int64, r io.Reader, w io.Writer) error {
 		p := mpb.New()
-		bar := p.AddBar(totalSize,
-			mpb.PrependDecorators(
-				decor.Counters(decor.UnitKiB, "%.1f / %.1f"),
-			),
-			mpb.AppendDecorators(
-				decor.Percentage(),
-				decor.AverageSpeed(decor.UnitKiB, " % .1f "),
-				decor.AverageETA(decor.ET_STYLE_GO),
-			),
-		)
+		var prepend []decor.Decorator
+		group, grouped := ctx.Value(progressGroupKey{}).(progressGroupValue)
+		if grouped {
+			p = group.group.p
+			prepend = append(prepend, decor.Name(group.name+" "))
+		}
+
+		var bar *mpb.Bar
+		if totalSize > 0 {
+			prepend = append(prepend, decor.Counters(decor.UnitKiB, "%.1f / %.1f"))
+			bar = p.AddBar(totalSize,
+				mpb.PrependDecorators(prepend...),
+				mpb.AppendDecorators(
+					decor.Percentage(),
+					decor.AverageSpeed(decor.UnitKiB, " % .1f "),
+					decor.AverageETA(decor.ET_STYLE_GO),
+				),
+			)
+		} else {
+			// neither percentage nor ETA without the size
+			prepend = append(prepend, decor.Any(func(s *decor.Statistics) string {
+				return fmt.Sprintf("%.1f", decor.SizeB1024(s.Current))
+			}))
+			bar = p.AddSpinner(0, mpb.SpinnerOnLeft,
+				mpb.PrependDecorators(prepend...),
+				mpb.AppendDecorators(decor.AverageSpeed(decor.UnitKiB, " % .1f ")),
+			)
+		}
 
 		// create proxy reader
 		bodyProgress := bar.ProxyReader(r)
@@ -48,9 +118,14 @@ func ProgressBarCallback(ctx context.Context) ProgressCallback {
 
 		err := CopyWithContext(ctx, w, bodyProgress)
 		if err != nil {
-			bar.Abort(true)
+			bar.Abort(!grouped)
 			return err
 		}
+		if grouped || totalSize <= 0 {
+			// mark the bar complete when the size was unknown so
+			// that the group can be waited on and the spinner stops
+			bar.SetTotal(bar.Current(), true)
+		}
 
 		return nil
 	}
@@ -75,3 +150,16 @@ func CopyWithContext(ctx context.Context, dst io.Writer, src io.Reader) error {
 	}))
 	return err
 }
+
+// RemoveIncomplete removes the incomplete or invalid download at path. The
+// partial files of cache entries are left to the entry, which removes them
+// unless the cache preserves them on error.
+func RemoveIncomplete(path string) {
+	if cache.IsPartial(filepath.Base(path)) {
+		return
+	}
+	sylog.Infof("Cleaning up incomplete download: %s", path)
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		sylog.Errorf("Error while removing incomplete download: %v", err)
+	}
+}
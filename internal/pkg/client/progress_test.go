@@ -0,0 +1,25 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package client
+
+import (
+	"context"
+	"testing"
+)
+
+func TestWithoutProgress(t *testing.T) {
+	ctx := context.Background()
+	if progressDisabled(ctx) {
+		t.Errorf("progress disabled by default")
+	}
+	ctx = WithoutProgress(ctx)
+	if !progressDisabled(ctx) {
+		t.Errorf("progress not disabled")
+	}
+	if ProgressBarCallback(ctx) != nil {
+		t.Errorf("unexpected progress bar callback")
+	}
+}
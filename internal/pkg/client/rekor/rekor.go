@@ -0,0 +1,191 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package rekor looks up the signatures of pulled images in a Rekor
+// transparency log.
+package rekor
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/sylabs/singularity/internal/pkg/client"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+)
+
+// maxEntries bounds the number of log entries fetched for an artifact.
+const maxEntries = 32
+
+// ErrNotRecorded is returned when no log entry records a signature of the
+// artifact by one of the expected keys.
+var ErrNotRecorded = errors.New("signature not recorded in the transparency log")
+
+// Entry is a log entry recording a signature of an artifact.
+type Entry struct {
+	UUID           string
+	LogIndex       int64
+	IntegratedTime int64
+	// Fingerprint is the fingerprint of the PGP key which signed the
+	// artifact
+	Fingerprint string
+}
+
+// Client queries the Rekor server at BaseURL.
+type Client struct {
+	BaseURL    string
+	HTTPClient *http.Client
+}
+
+// logEntry is the form of a log entry returned by the server.
+type logEntry struct {
+	Body           string `json:"body"`
+	IntegratedTime int64  `json:"integratedTime"`
+	LogIndex       int64  `json:"logIndex"`
+}
+
+// rekord is the body of a rekord log entry.
+type rekord struct {
+	Kind string `json:"kind"`
+	Spec struct {
+		Signature struct {
+			Format    string `json:"format"`
+			PublicKey struct {
+				Content string `json:"content"`
+			} `json:"publicKey"`
+		} `json:"signature"`
+		Data struct {
+			Hash struct {
+				Algorithm string `json:"algorithm"`
+				Value     string `json:"value"`
+			} `json:"hash"`
+		} `json:"data"`
+	} `json:"spec"`
+}
+
+// FindEntry returns the log entry recording the PGP signature of the
+// artifact whose sha256 hash is hash, as hexadecimal, by one of the keys
+// whose fingerprints are given, ErrNotRecorded if there is none.
+func (c *Client) FindEntry(ctx context.Context, hash string, fingerprints []string) (*Entry, error) {
+	var uuids []string
+	query := map[string]string{"hash": "sha256:" + hash}
+	if err := c.do(ctx, http.MethodPost, "/api/v1/index/retrieve", query, &uuids); err != nil {
+		return nil, fmt.Errorf("while searching the log: %v", err)
+	}
+	if len(uuids) > maxEntries {
+		uuids = uuids[:maxEntries]
+	}
+
+	for _, uuid := range uuids {
+		entries := make(map[string]logEntry)
+		if err := c.do(ctx, http.MethodGet, "/api/v1/log/entries/"+uuid, nil, &entries); err != nil {
+			return nil, fmt.Errorf("while fetching log entry %s: %v", uuid, err)
+		}
+		for id, e := range entries {
+			fp, err := entrySigner(e, hash)
+			if err != nil {
+				continue
+			}
+			if hasFingerprint(fingerprints, fp) {
+				return &Entry{UUID: id, LogIndex: e.LogIndex, IntegratedTime: e.IntegratedTime, Fingerprint: fp}, nil
+			}
+		}
+	}
+	return nil, ErrNotRecorded
+}
+
+// do sends a request with the body in to the path of the server and
+// decodes its JSON response into out.
+func (c *Client) do(ctx context.Context, method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(c.BaseURL, "/")+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("User-Agent", client.UserAgent(ctx))
+
+	res, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s", http.StatusText(res.StatusCode))
+	}
+	if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+		return fmt.Errorf("error decoding response: %v", err)
+	}
+	return nil
+}
+
+// entrySigner returns the fingerprint of the PGP key of the rekord entry
+// e, which must record a signature of the artifact with the sha256 hash.
+func entrySigner(e logEntry, hash string) (string, error) {
+	b, err := base64.StdEncoding.DecodeString(e.Body)
+	if err != nil {
+		return "", err
+	}
+	var r rekord
+	if err := json.Unmarshal(b, &r); err != nil {
+		return "", err
+	}
+	if r.Kind != "rekord" || r.Spec.Signature.Format != "pgp" {
+		return "", fmt.Errorf("not a PGP rekord entry")
+	}
+	if r.Spec.Data.Hash.Algorithm != "sha256" || !strings.EqualFold(r.Spec.Data.Hash.Value, hash) {
+		return "", fmt.Errorf("entry for another artifact")
+	}
+
+	key, err := base64.StdEncoding.DecodeString(r.Spec.Signature.PublicKey.Content)
+	if err != nil {
+		return "", err
+	}
+	var el openpgp.EntityList
+	if block, err := armor.Decode(bytes.NewReader(key)); err == nil {
+		el, err = openpgp.ReadKeyRing(block.Body)
+		if err != nil {
+			return "", err
+		}
+	} else if el, err = openpgp.ReadKeyRing(bytes.NewReader(key)); err != nil {
+		return "", err
+	}
+	if len(el) == 0 {
+		return "", fmt.Errorf("no public key")
+	}
+	return strings.ToUpper(hex.EncodeToString(el[0].PrimaryKey.Fingerprint[:])), nil
+}
+
+// hasFingerprint returns whether fp is one of fingerprints, any fingerprint
+// matching when there are none.
+func hasFingerprint(fingerprints []string, fp string) bool {
+	if len(fingerprints) == 0 {
+		return true
+	}
+	for _, f := range fingerprints {
+		if strings.EqualFold(f, fp) {
+			return true
+		}
+	}
+	return false
+}
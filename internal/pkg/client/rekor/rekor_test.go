@@ -0,0 +1,120 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package rekor
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	useragent "github.com/sylabs/singularity/pkg/util/user-agent"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+)
+
+const testHash = "6105d6cc76af400325e94d588ce511be5bfdbb73b437dc51eca43917d7a43e3d"
+
+// rekordBody returns the base64 body of a rekord entry of the PGP signature
+// of the artifact with hash by entity.
+func rekordBody(t *testing.T, entity *openpgp.Entity, hash string) string {
+	var key bytes.Buffer
+	w, err := armor.Encode(&key, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatalf("could not armor key: %v", err)
+	}
+	if err := entity.Serialize(w); err != nil {
+		t.Fatalf("could not serialize key: %v", err)
+	}
+	w.Close()
+
+	body := map[string]interface{}{
+		"apiVersion": "0.0.1",
+		"kind":       "rekord",
+		"spec": map[string]interface{}{
+			"signature": map[string]interface{}{
+				"format":    "pgp",
+				"content":   base64.StdEncoding.EncodeToString([]byte("signature")),
+				"publicKey": map[string]string{"content": base64.StdEncoding.EncodeToString(key.Bytes())},
+			},
+			"data": map[string]interface{}{
+				"hash": map[string]string{"algorithm": "sha256", "value": hash},
+			},
+		},
+	}
+	b, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("could not encode entry: %v", err)
+	}
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+func TestFindEntry(t *testing.T) {
+	useragent.InitValue("singularity", "3.0.0")
+
+	entity, err := openpgp.NewEntity("test", "", "test@example.com", nil)
+	if err != nil {
+		t.Fatalf("could not create key: %v", err)
+	}
+	fp := strings.ToUpper(hex.EncodeToString(entity.PrimaryKey.Fingerprint[:]))
+
+	entries := map[string]logEntry{
+		"other": {Body: rekordBody(t, entity, strings.Repeat("0", 64)), LogIndex: 1},
+		"image": {Body: rekordBody(t, entity, testHash), LogIndex: 2, IntegratedTime: 1590969600},
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/api/v1/index/retrieve":
+			var q map[string]string
+			json.NewDecoder(r.Body).Decode(&q)
+			if q["hash"] == "sha256:"+testHash {
+				json.NewEncoder(w).Encode([]string{"other", "image"})
+				return
+			}
+			json.NewEncoder(w).Encode([]string{})
+			return
+		case strings.HasPrefix(r.URL.Path, "/api/v1/log/entries/"):
+			uuid := strings.TrimPrefix(r.URL.Path, "/api/v1/log/entries/")
+			if e, ok := entries[uuid]; ok {
+				json.NewEncoder(w).Encode(map[string]logEntry{uuid: e})
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	c := &Client{BaseURL: srv.URL + "/", HTTPClient: srv.Client()}
+	ctx := context.Background()
+
+	e, err := c.FindEntry(ctx, testHash, []string{fp})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if e.UUID != "image" || e.LogIndex != 2 || e.Fingerprint != fp {
+		t.Errorf("unexpected entry %+v", e)
+	}
+	if _, err := c.FindEntry(ctx, testHash, nil); err != nil {
+		t.Errorf("unexpected error without fingerprints: %v", err)
+	}
+
+	if _, err := c.FindEntry(ctx, testHash, []string{"8883491F4268F173C6E5DC49446946928C851A55"}); err != ErrNotRecorded {
+		t.Errorf("expected %v for another signer, got %v", ErrNotRecorded, err)
+	}
+	if _, err := c.FindEntry(ctx, strings.Repeat("1", 64), nil); err != ErrNotRecorded {
+		t.Errorf("expected %v for an unrecorded artifact, got %v", ErrNotRecorded, err)
+	}
+
+	c.BaseURL = srv.URL + "/missing"
+	if _, err := c.FindEntry(ctx, testHash, nil); err == nil || err == ErrNotRecorded {
+		t.Errorf("unexpected error for an unreachable log: %v", err)
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/sylabs/singularity/pkg/sylog"
+)
+
+// StatusError is the error of an HTTP request answered with an unexpected
+// status code, which is only transient for the server errors.
+type StatusError struct {
+	Code int
+	Err  error
+}
+
+func (e *StatusError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *StatusError) Unwrap() error {
+	return e.Err
+}
+
+// IsTransient returns whether the download failing with err could succeed
+// if retried: the connection failed or was reset, the response was cut
+// short, or the server answered with a 5xx status code. Client errors,
+// e.g. 401, 403 and 404, and cancellations are not.
+func IsTransient(ctx context.Context, err error) bool {
+	if ctx.Err() != nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Code >= 500
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// Retry calls download until it succeeds, fails with an error which isn't
+// transient, or the retries of the settings of ctx are exhausted. The error of
+// the last attempt is returned, with the number of attempts made when
+// retries are enabled. download is expected to resume from the bytes
+// already downloaded when it can.
+func Retry(ctx context.Context, what string, download func() error) error {
+	s := SettingsFromContext(ctx)
+	retries, delay := s.Retries, s.RetryDelay
+	for attempt := 1; ; attempt++ {
+		err := download()
+		if err == nil {
+			return nil
+		}
+		if attempt > retries || !IsTransient(ctx, err) {
+			return retryError(err, retries, attempt)
+		}
+
+		sylog.Warningf("Download of %s failed, retrying in %s (attempt %d of %d): %v", what, delay, attempt+1, retries+1, err)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return retryError(ctx.Err(), retries, attempt)
+		}
+		delay *= 2
+	}
+}
+
+// retryError returns err, with the number of attempts made when retries
+// are enabled.
+func retryError(err error, retries, attempts int) error {
+	switch {
+	case retries == 0:
+		return err
+	case attempts == 1:
+		return fmt.Errorf("%w (after 1 attempt)", err)
+	}
+	return fmt.Errorf("%w (after %d attempts)", err, attempts)
+}
@@ -0,0 +1,88 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestIsTransient(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		err  error
+		want bool
+	}{
+		{"ServerError", context.Background(), &StatusError{Code: http.StatusBadGateway, Err: errors.New("bad gateway")}, true},
+		{"Unauthorized", context.Background(), &StatusError{Code: http.StatusUnauthorized, Err: errors.New("unauthorized")}, false},
+		{"Forbidden", context.Background(), &StatusError{Code: http.StatusForbidden, Err: errors.New("forbidden")}, false},
+		{"NotFound", context.Background(), fmt.Errorf("pull: %w", &StatusError{Code: http.StatusNotFound, Err: errors.New("not found")}), false},
+		{"PartialRead", context.Background(), fmt.Errorf("copy: %w", io.ErrUnexpectedEOF), true},
+		{"ConnectionReset", context.Background(), fmt.Errorf("read: %w", syscall.ECONNRESET), true},
+		{"Other", context.Background(), errors.New("not a SIF image"), false},
+		{"Canceled", canceled, io.ErrUnexpectedEOF, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsTransient(tt.ctx, tt.err); got != tt.want {
+				t.Errorf("got transient %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetry(t *testing.T) {
+	serverErr := &StatusError{Code: http.StatusServiceUnavailable, Err: errors.New("unavailable")}
+	notFound := &StatusError{Code: http.StatusNotFound, Err: errors.New("not found")}
+
+	tests := []struct {
+		name         string
+		retries      int
+		errs         []error
+		wantAttempts int
+		wantErr      string
+	}{
+		{"NoRetries", 0, []error{serverErr}, 1, "unavailable"},
+		{"Recovered", 2, []error{serverErr, io.ErrUnexpectedEOF, nil}, 3, ""},
+		{"Exhausted", 2, []error{serverErr, serverErr, serverErr}, 3, "unavailable (after 3 attempts)"},
+		{"NotTransient", 2, []error{notFound}, 1, "not found (after 1 attempt)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := WithSettings(context.Background(), Settings{Retries: tt.retries, RetryDelay: time.Millisecond})
+
+			attempts := 0
+			err := Retry(ctx, "image", func() error {
+				err := tt.errs[attempts]
+				attempts++
+				return err
+			})
+			if attempts != tt.wantAttempts {
+				t.Errorf("got %d attempts, want %d", attempts, tt.wantAttempts)
+			}
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.HasSuffix(err.Error(), tt.wantErr) {
+				t.Errorf("got error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,375 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package scp
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/sylabs/singularity/internal/pkg/client"
+	"github.com/sylabs/singularity/internal/pkg/util/fs"
+	"github.com/sylabs/singularity/pkg/sylog"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// Options are the SSH settings of a pull.
+type Options struct {
+	// Identity is the private key file to authenticate with, in addition
+	// to the keys of the SSH agent. The default keys of ~/.ssh are used if
+	// empty.
+	Identity string
+	// KnownHosts are the files the host keys are checked against,
+	// ~/.ssh/known_hosts and /etc/ssh/ssh_known_hosts if empty.
+	KnownHosts []string
+}
+
+// defaultIdentities are the private keys of ~/.ssh tried without --identity.
+var defaultIdentities = []string{"id_ed25519", "id_ecdsa", "id_rsa"}
+
+// PullToFile fetches the image pullFrom with the scp protocol over SSH, and
+// renames it to pullTo once completely downloaded. Images pulled with scp are
+// not cached, their content can change on the host without notice.
+func PullToFile(ctx context.Context, pullTo, pullFrom string, opts Options) (imagePath string, err error) {
+	ref, err := ParseReference(pullFrom)
+	if err != nil {
+		return "", err
+	}
+
+	conn, err := dial(ctx, ref, opts)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	// unblocks the transfer when interrupted
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	umask, err := fs.Umask()
+	if err != nil {
+		return "", err
+	}
+	tmpFile, err := fs.MakeTmpFile(filepath.Dir(pullTo), "tmp-scp-", 0777&^umask)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		tmpFile.Close()
+		if err != nil {
+			client.RemoveIncomplete(tmpFile.Name())
+		}
+	}()
+
+	sylog.Infof("Downloading %s", ref)
+	if err = fetch(ctx, conn, ref.Path, tmpFile); err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return "", fmt.Errorf("while fetching %s: %v", ref, err)
+	}
+	if err = tmpFile.Close(); err != nil {
+		return "", fmt.Errorf("while writing %s: %v", tmpFile.Name(), err)
+	}
+	if err = os.Rename(tmpFile.Name(), pullTo); err != nil {
+		return "", fmt.Errorf("could not rename temporary file: %v", err)
+	}
+	sylog.Debugf("Download complete: %s", pullTo)
+
+	return pullTo, nil
+}
+
+// dial connects to the host of ref, authenticated with the keys of the SSH
+// agent and the identity files.
+func dial(ctx context.Context, ref Reference, opts Options) (*ssh.Client, error) {
+	name := ref.User
+	if name == "" {
+		u, err := user.Current()
+		if err != nil {
+			return nil, fmt.Errorf("could not get current user: %v", err)
+		}
+		name = u.Username
+	}
+
+	hostKeyCallback, err := hostKeyCallback(opts.KnownHosts)
+	if err != nil {
+		return nil, err
+	}
+
+	signers, closeAgent := agentSigners()
+	defer closeAgent()
+	keys, err := identitySigners(opts.Identity)
+	if err != nil {
+		return nil, err
+	}
+	signers = append(signers, keys...)
+	if len(signers) == 0 {
+		return nil, fmt.Errorf("no SSH key found: start an SSH agent with your key loaded or use --identity")
+	}
+
+	config := &ssh.ClientConfig{
+		User:            name,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signers...)},
+		HostKeyCallback: hostKeyCallback,
+	}
+
+	addr := ref.Addr()
+	var d net.Dialer
+	c, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to %s: %v", addr, err)
+	}
+	sshConn, chans, reqs, err := ssh.NewClientConn(c, addr, config)
+	if err != nil {
+		c.Close()
+		return nil, fmt.Errorf("could not open SSH connection to %s@%s: %v", name, addr, err)
+	}
+	return ssh.NewClient(sshConn, chans, reqs), nil
+}
+
+// hostKeyCallback returns the callback checking the host keys against the
+// known hosts files, refusing hosts not found there.
+func hostKeyCallback(files []string) (ssh.HostKeyCallback, error) {
+	if len(files) == 0 {
+		if home, err := os.UserHomeDir(); err == nil {
+			files = append(files, filepath.Join(home, ".ssh", "known_hosts"))
+		}
+		files = append(files, "/etc/ssh/ssh_known_hosts")
+	}
+
+	var existing []string
+	for _, f := range files {
+		if _, err := os.Stat(f); err == nil {
+			existing = append(existing, f)
+		}
+	}
+	if len(existing) == 0 {
+		return nil, fmt.Errorf("no known hosts file found in %s: connect to the host once with ssh to verify and record its key", strings.Join(files, ", "))
+	}
+
+	callback, err := knownhosts.New(existing...)
+	if err != nil {
+		return nil, fmt.Errorf("while reading known hosts: %v", err)
+	}
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		err := callback(hostname, remote, key)
+		if keyErr, ok := err.(*knownhosts.KeyError); ok {
+			if len(keyErr.Want) == 0 {
+				return fmt.Errorf("host %s is unknown: connect to it once with ssh to verify and record its key", hostname)
+			}
+			return fmt.Errorf("host key of %s does not match the one recorded in %s:%d, it may have been changed or the connection intercepted", hostname, keyErr.Want[0].Filename, keyErr.Want[0].Line)
+		}
+		return err
+	}, nil
+}
+
+// agentSigners returns the keys of the SSH agent, if any, and a function
+// closing the connection to the agent once authenticated.
+func agentSigners() ([]ssh.Signer, func()) {
+	sock := os.Getenv("SSH_AUTH_SOCK")
+	if sock == "" {
+		return nil, func() {}
+	}
+	c, err := net.Dial("unix", sock)
+	if err != nil {
+		sylog.Debugf("Could not connect to SSH agent: %v", err)
+		return nil, func() {}
+	}
+	signers, err := agent.NewClient(c).Signers()
+	if err != nil {
+		sylog.Debugf("Could not get keys from SSH agent: %v", err)
+	}
+	return signers, func() { c.Close() }
+}
+
+// identitySigners returns the key of the identity file, or the default keys
+// of ~/.ssh which can be read if identity is empty.
+func identitySigners(identity string) ([]ssh.Signer, error) {
+	if identity != "" {
+		s, err := readIdentity(identity)
+		if err != nil {
+			return nil, err
+		}
+		return []ssh.Signer{s}, nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, nil
+	}
+	var signers []ssh.Signer
+	for _, name := range defaultIdentities {
+		path := filepath.Join(home, ".ssh", name)
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		s, err := readIdentity(path)
+		if err != nil {
+			sylog.Debugf("Skipping SSH key: %v", err)
+			continue
+		}
+		signers = append(signers, s)
+	}
+	return signers, nil
+}
+
+// readIdentity reads the private key file path. Encrypted keys must be
+// loaded in the SSH agent.
+func readIdentity(path string) (ssh.Signer, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read SSH key: %v", err)
+	}
+	s, err := ssh.ParsePrivateKey(b)
+	if err != nil {
+		if strings.Contains(err.Error(), "encrypted") {
+			return nil, fmt.Errorf("SSH key %s is encrypted: add it to the SSH agent with ssh-add", path)
+		}
+		return nil, fmt.Errorf("invalid SSH key %s: %v", path, err)
+	}
+	return s, nil
+}
+
+// fetch copies the remote file path to w, running scp in source mode on the
+// host. See https://web.archive.org/web/20170215184048/https://blogs.oracle.com/janp/entry/how_the_scp_protocol_works
+func fetch(ctx context.Context, conn *ssh.Client, path string, w io.Writer) error {
+	session, err := conn.NewSession()
+	if err != nil {
+		return fmt.Errorf("could not open SSH session: %v", err)
+	}
+	defer session.Close()
+
+	in, err := session.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	out := bufio.NewReader(stdout)
+
+	if err := session.Start("scp -f -- " + shellQuote(path)); err != nil {
+		return fmt.Errorf("could not run scp on host: %v", err)
+	}
+
+	size, err := readHeader(in, out)
+	if err != nil {
+		return err
+	}
+
+	body := &io.LimitedReader{R: out, N: size}
+	w = client.NetworkWriter(ctx, w)
+	if cb := client.ProgressBarCallback(ctx); cb != nil {
+		err = cb(size, body, w)
+	} else {
+		err = client.CopyWithContext(ctx, w, body)
+	}
+	if err != nil {
+		return err
+	}
+	if body.N > 0 {
+		return fmt.Errorf("transfer ended early, %d bytes missing", body.N)
+	}
+
+	if err := readStatus(out); err != nil {
+		return err
+	}
+	ack(in)
+	in.Close()
+
+	return session.Wait()
+}
+
+// readHeader acknowledges the scp messages until the one announcing the
+// file, and returns its size.
+func readHeader(in io.Writer, out *bufio.Reader) (int64, error) {
+	for {
+		if err := ack(in); err != nil {
+			return 0, err
+		}
+		line, err := out.ReadString('\n')
+		if err != nil {
+			if err == io.EOF {
+				return 0, fmt.Errorf("scp exited unexpectedly, is it installed on the host?")
+			}
+			return 0, err
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			return 0, fmt.Errorf("unexpected empty scp message")
+		}
+
+		switch line[0] {
+		case 'C':
+			// C<mode> <size> <name>
+			fields := strings.SplitN(line[1:], " ", 3)
+			if len(fields) != 3 {
+				return 0, fmt.Errorf("invalid scp message %q", line)
+			}
+			size, err := strconv.ParseInt(fields[1], 10, 64)
+			if err != nil || size < 0 {
+				return 0, fmt.Errorf("invalid file size in scp message %q", line)
+			}
+			return size, ack(in)
+		case 'T':
+			// modification times, only sent with -p
+			continue
+		case 'D':
+			return 0, fmt.Errorf("image is a directory")
+		case '\x01', '\x02':
+			return 0, fmt.Errorf("%s", strings.TrimSpace(line[1:]))
+		default:
+			return 0, fmt.Errorf("unexpected scp message %q", line)
+		}
+	}
+}
+
+// readStatus reads the status sent after the file content.
+func readStatus(out *bufio.Reader) error {
+	b, err := out.ReadByte()
+	if err != nil {
+		return err
+	}
+	if b == 0 {
+		return nil
+	}
+	msg, _ := out.ReadString('\n')
+	return fmt.Errorf("%s", strings.TrimSpace(msg))
+}
+
+// ack sends the scp acknowledgment.
+func ack(in io.Writer) error {
+	_, err := in.Write([]byte{0})
+	return err
+}
+
+// shellQuote quotes path for the remote shell, leaving a leading ~/ to it.
+func shellQuote(path string) string {
+	prefix := ""
+	if strings.HasPrefix(path, "~/") {
+		prefix = "~/"
+		path = path[2:]
+	}
+	return prefix + "'" + strings.Replace(path, "'", `'\''`, -1) + "'"
+}
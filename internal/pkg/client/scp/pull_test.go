@@ -0,0 +1,200 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package scp
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const testImage = "image content"
+
+func newSigner(t *testing.T) (ssh.Signer, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("could not generate key: %v", err)
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("could not marshal key: %v", err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatalf("could not create signer: %v", err)
+	}
+	return signer, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+}
+
+// serveSCP serves a single SSH connection on l accepting the client key,
+// and running scp -f with the files on the host.
+func serveSCP(l net.Listener, hostKey ssh.Signer, clientKey ssh.PublicKey, files map[string]string) {
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if string(key.Marshal()) != string(clientKey.Marshal()) {
+				return nil, fmt.Errorf("unknown key")
+			}
+			return nil, nil
+		},
+	}
+	config.AddHostKey(hostKey)
+
+	c, err := l.Accept()
+	if err != nil {
+		return
+	}
+	defer c.Close()
+	_, chans, reqs, err := ssh.NewServerConn(c, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+
+	for newChan := range chans {
+		ch, chReqs, err := newChan.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer ch.Close()
+			for req := range chReqs {
+				var exec struct{ Command string }
+				if req.Type != "exec" || ssh.Unmarshal(req.Payload, &exec) != nil {
+					req.Reply(false, nil)
+					continue
+				}
+				req.Reply(true, nil)
+
+				status := scpSource(ch, strings.TrimPrefix(exec.Command, "scp -f -- "), files)
+				ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{status}))
+				return
+			}
+		}()
+	}
+}
+
+// scpSource sends the file named by the quoted path, as scp -f does.
+func scpSource(ch ssh.Channel, path string, files map[string]string) uint32 {
+	b := make([]byte, 1)
+	if _, err := io.ReadFull(ch, b); err != nil {
+		return 1
+	}
+	content, ok := files[path]
+	if !ok {
+		fmt.Fprintf(ch, "\x01scp: %s: No such file or directory\n", path)
+		return 1
+	}
+	fmt.Fprintf(ch, "C0644 %d image.sif\n", len(content))
+	if _, err := io.ReadFull(ch, b); err != nil {
+		return 1
+	}
+	io.WriteString(ch, content)
+	ch.Write([]byte{0})
+	if _, err := io.ReadFull(ch, b); err != nil {
+		return 1
+	}
+	return 0
+}
+
+func TestPullToFile(t *testing.T) {
+	if sock, ok := os.LookupEnv("SSH_AUTH_SOCK"); ok {
+		os.Unsetenv("SSH_AUTH_SOCK")
+		defer os.Setenv("SSH_AUTH_SOCK", sock)
+	}
+
+	dir, err := ioutil.TempDir("", "scp-test-")
+	if err != nil {
+		t.Fatalf("could not create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	hostKey, _ := newSigner(t)
+	otherHostKey, _ := newSigner(t)
+	clientKey, clientPEM := newSigner(t)
+	_, otherPEM := newSigner(t)
+
+	identity := filepath.Join(dir, "id_ecdsa")
+	otherIdentity := filepath.Join(dir, "other_ecdsa")
+	for path, b := range map[string][]byte{identity: clientPEM, otherIdentity: otherPEM} {
+		if err := ioutil.WriteFile(path, b, 0600); err != nil {
+			t.Fatalf("could not write key: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		identity string
+		hostKey  ssh.Signer
+		err      string
+	}{
+		{"Pull", "/images/image.sif", identity, hostKey, ""},
+		{"Missing", "/images/missing.sif", identity, hostKey, "No such file or directory"},
+		{"UnknownKey", "/images/image.sif", otherIdentity, hostKey, "unable to authenticate"},
+		{"ChangedHostKey", "/images/image.sif", identity, otherHostKey, "does not match"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatalf("could not listen: %v", err)
+			}
+			defer l.Close()
+			go serveSCP(l, tt.hostKey, clientKey.PublicKey(), map[string]string{"'/images/image.sif'": testImage})
+
+			// the known host key is always the first one
+			knownHosts := filepath.Join(dir, "known_hosts")
+			line := knownhosts.Line([]string{l.Addr().String()}, hostKey.PublicKey())
+			if err := ioutil.WriteFile(knownHosts, []byte(line+"\n"), 0644); err != nil {
+				t.Fatalf("could not write known hosts: %v", err)
+			}
+
+			pullTo := filepath.Join(dir, "image.sif")
+			defer os.Remove(pullTo)
+			pullFrom := fmt.Sprintf("scp://user@%s:%s", l.Addr(), tt.path)
+
+			_, err = PullToFile(context.Background(), pullTo, pullFrom, Options{Identity: tt.identity, KnownHosts: []string{knownHosts}})
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("unexpected error %v, expected %q", err, tt.err)
+				}
+				if _, err := os.Stat(pullTo); !os.IsNotExist(err) {
+					t.Errorf("image unexpectedly created on error")
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				b, err := ioutil.ReadFile(pullTo)
+				if err != nil {
+					t.Fatalf("could not read image: %v", err)
+				}
+				if string(b) != testImage {
+					t.Errorf("unexpected image content %q", b)
+				}
+			}
+
+			if matches, _ := filepath.Glob(filepath.Join(dir, "tmp-scp-*")); len(matches) > 0 {
+				t.Errorf("temporary files left: %v", matches)
+			}
+		})
+	}
+}
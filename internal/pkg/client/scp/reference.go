@@ -0,0 +1,113 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package scp
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// defaultPort is the SSH port used when a reference has none.
+const defaultPort = "22"
+
+// Reference is a parsed scp://[user@]host[:port]:path reference.
+type Reference struct {
+	// User is the remote user, the local one if empty.
+	User string
+	// Host is the remote host name or IP address.
+	Host string
+	// Port is the SSH port of the host.
+	Port string
+	// Path is the path of the image on the host, relative to the home
+	// directory of the user unless absolute.
+	Path string
+}
+
+// Addr returns the host:port address of the reference.
+func (r Reference) Addr() string {
+	return net.JoinHostPort(r.Host, r.Port)
+}
+
+// String returns the reference in its scp:// form.
+func (r Reference) String() string {
+	host := r.Host
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	if r.User != "" {
+		host = r.User + "@" + host
+	}
+	if r.Port != defaultPort {
+		host += ":" + r.Port
+	}
+	return "scp://" + host + ":" + r.Path
+}
+
+// ParseReference parses an scp:// reference. Both the scp form, with the
+// path after a colon, and the URL form, with an absolute path after the host
+// are accepted:
+//
+//   scp://user@host:/path/image.sif
+//   scp://user@host:2222:images/image.sif
+//   scp://host:2222/path/image.sif
+//   scp://user@[::1]:/path/image.sif
+func ParseReference(src string) (Reference, error) {
+	if !strings.HasPrefix(src, "scp://") {
+		return Reference{}, fmt.Errorf("not an scp reference: %s", src)
+	}
+	rest := strings.TrimPrefix(src, "scp://")
+	r := Reference{Port: defaultPort}
+
+	if i := strings.Index(rest, "@"); i >= 0 && i < strings.IndexAny(rest+":", ":/") {
+		r.User = rest[:i]
+		rest = rest[i+1:]
+	}
+
+	if strings.HasPrefix(rest, "[") {
+		i := strings.Index(rest, "]")
+		if i < 0 {
+			return Reference{}, fmt.Errorf("invalid scp reference %s: unterminated IPv6 address", src)
+		}
+		r.Host = rest[1:i]
+		rest = rest[i+1:]
+	} else {
+		i := strings.IndexAny(rest, ":/")
+		if i < 0 {
+			i = len(rest)
+		}
+		r.Host = rest[:i]
+		rest = rest[i:]
+	}
+	if r.Host == "" {
+		return Reference{}, fmt.Errorf("invalid scp reference %s: missing host", src)
+	}
+
+	if strings.HasPrefix(rest, ":") {
+		rest = rest[1:]
+		// a port is only recognized when followed by the path
+		if i := strings.IndexAny(rest, ":/"); i > 0 && isPort(rest[:i]) {
+			r.Port = rest[:i]
+			rest = strings.TrimPrefix(rest[i:], ":")
+		}
+	}
+	r.Path = rest
+	if r.Path == "" || strings.HasSuffix(r.Path, "/") {
+		return Reference{}, fmt.Errorf("invalid scp reference %s: missing image path", src)
+	}
+
+	return r, nil
+}
+
+// isPort returns whether s is a port number.
+func isPort(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return len(s) <= 5
+}
@@ -0,0 +1,51 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package scp
+
+import (
+	"testing"
+)
+
+func TestParseReference(t *testing.T) {
+	tests := []struct {
+		ref      string
+		expected Reference
+		ok       bool
+	}{
+		{"scp://user@host:/path/image.sif", Reference{User: "user", Host: "host", Port: "22", Path: "/path/image.sif"}, true},
+		{"scp://host:images/image.sif", Reference{Host: "host", Port: "22", Path: "images/image.sif"}, true},
+		{"scp://user@host:2222:images/image.sif", Reference{User: "user", Host: "host", Port: "2222", Path: "images/image.sif"}, true},
+		{"scp://host:2222/path/image.sif", Reference{Host: "host", Port: "2222", Path: "/path/image.sif"}, true},
+		{"scp://host/path/image.sif", Reference{Host: "host", Port: "22", Path: "/path/image.sif"}, true},
+		{"scp://user@[::1]:/path/image.sif", Reference{User: "user", Host: "::1", Port: "22", Path: "/path/image.sif"}, true},
+		{"scp://host:2222", Reference{Host: "host", Port: "22", Path: "2222"}, true},
+		{"scp://host", Reference{}, false},
+		{"scp://host:/path/", Reference{}, false},
+		{"scp://user@:/image.sif", Reference{}, false},
+		{"scp://[::1:/image.sif", Reference{}, false},
+		{"http://host/image.sif", Reference{}, false},
+	}
+
+	for _, tt := range tests {
+		r, err := ParseReference(tt.ref)
+		if !tt.ok {
+			if err == nil {
+				t.Errorf("unexpected success parsing %s: %+v", tt.ref, r)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("unexpected error parsing %s: %v", tt.ref, err)
+			continue
+		}
+		if r != tt.expected {
+			t.Errorf("%s parsed as %+v, expected %+v", tt.ref, r, tt.expected)
+		}
+		if again, err := ParseReference(r.String()); err != nil || again != r {
+			t.Errorf("%s does not parse back to %+v: %+v, %v", r, r, again, err)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package client
+
+import (
+	"context"
+	"net/url"
+	"time"
+
+	useragent "github.com/sylabs/singularity/pkg/util/user-agent"
+)
+
+// DefaultRetryDelay is the delay before the first retry of a failed
+// download of the pull command, unless set with --retry-delay.
+const DefaultRetryDelay = time.Second
+
+// Settings are the network settings of the downloads made with a context,
+// so that the pulls sharing a process each have their own. The zero value
+// are the defaults.
+type Settings struct {
+	// UserAgent is the User-Agent of the requests, the one set with
+	// useragent.InitValue if empty.
+	UserAgent string
+	// Retries is the number of times Retry retries a download failing with
+	// a transient error, waiting RetryDelay before the first retry and
+	// doubling it after each one, the retries being immediate if zero.
+	Retries    int
+	RetryDelay time.Duration
+	// ConnectTimeout is the time allowed to establish a connection to the
+	// remote host, independently of the time allowed for the whole
+	// request, the default of the transport if zero.
+	ConnectTimeout time.Duration
+	// SOCKS5Proxy is the SOCKS5 proxy the connections of the clients
+	// returned by NewHTTPClient go through, taking precedence over the HTTP
+	// proxies of the environment, if not nil.
+	SOCKS5Proxy *url.URL
+	// StreamCount is the number of byte ranges the library images
+	// downloaded from scratch are split into, the library default if zero.
+	StreamCount int
+}
+
+type settingsKey struct{}
+
+// WithSettings returns a copy of ctx with which the downloads are made with
+// the settings s.
+func WithSettings(ctx context.Context, s Settings) context.Context {
+	return context.WithValue(ctx, settingsKey{}, s)
+}
+
+// SettingsFromContext returns the settings of ctx, the defaults if it has
+// none.
+func SettingsFromContext(ctx context.Context) Settings {
+	if ctx == nil {
+		return Settings{}
+	}
+	s, _ := ctx.Value(settingsKey{}).(Settings)
+	return s
+}
+
+// UserAgent returns the User-Agent of the requests made with ctx.
+func UserAgent(ctx context.Context) string {
+	if ua := SettingsFromContext(ctx).UserAgent; ua != "" {
+		return ua
+	}
+	return useragent.Value()
+}
@@ -6,16 +6,18 @@
 package shub
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"strings"
 	"time"
 
+	"github.com/sylabs/singularity/internal/pkg/client"
 	"github.com/sylabs/singularity/pkg/sylog"
-	useragent "github.com/sylabs/singularity/pkg/util/user-agent"
 )
 
 const (
@@ -38,6 +40,15 @@ func (s *URI) String() string {
 	return s.registry + s.user + "/" + s.container + s.tag + s.digest
 }
 
+// Host returns the host of the registry the URI points to.
+func (s *URI) Host() string {
+	registry := strings.TrimSuffix(s.registry, shubAPIRoute)
+	if u, err := url.Parse(registry); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return strings.SplitN(registry, "/", 2)[0]
+}
+
 // APIResponse holds the information returned from the Shub API
 type APIResponse struct {
 	Image   string `json:"image"`
@@ -49,11 +60,9 @@ type APIResponse struct {
 
 // GetManifest will return the image manifest for a container uri
 // from Singularity Hub.
-func GetManifest(uri URI, noHTTPS bool) (APIResponse, error) {
+func GetManifest(ctx context.Context, uri URI, noHTTPS bool) (APIResponse, error) {
 	// Create a new http Hub client
-	httpc := http.Client{
-		Timeout: 30 * time.Second,
-	}
+	httpc := client.NewHTTPClient(30 * time.Second)
 
 	if uri.registry != defaultRegistry+shubAPIRoute {
 		uri.registry = "https://" + uri.registry
@@ -69,11 +78,11 @@ func GetManifest(uri URI, noHTTPS bool) (APIResponse, error) {
 		url.Scheme = "http"
 	}
 
-	req, err := http.NewRequest(http.MethodGet, url.String(), nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url.String(), nil)
 	if err != nil {
 		return APIResponse{}, err
 	}
-	req.Header.Set("User-Agent", useragent.Value())
+	req.Header.Set("User-Agent", client.UserAgent(ctx))
 
 	sylog.Debugf("shub request: %s", req.URL.String())
 
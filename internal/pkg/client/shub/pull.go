@@ -7,10 +7,14 @@ package shub
 
 import (
 	"context"
+	"crypto/md5"
+	"encoding/hex"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/sylabs/singularity/internal/pkg/client"
@@ -19,7 +23,6 @@ import (
 	"github.com/sylabs/singularity/internal/pkg/cache"
 	"github.com/sylabs/singularity/internal/pkg/util/fs"
 	"github.com/sylabs/singularity/pkg/sylog"
-	useragent "github.com/sylabs/singularity/pkg/util/user-agent"
 )
 
 // Timeout for an image pull in seconds (2 hours)
@@ -37,7 +40,7 @@ func DownloadImage(ctx context.Context, manifest APIResponse, filePath, shubRef
 
 	// use custom parser to make sure we have a valid shub URI
 	if ok := isShubPullRef(shubRef); !ok {
-		sylog.Fatalf("Invalid shub URI")
+		return fmt.Errorf("invalid shub URI")
 	}
 
 	shubURI, err := ParseReference(shubRef)
@@ -51,15 +54,13 @@ func DownloadImage(ctx context.Context, manifest APIResponse, filePath, shubRef
 	}
 
 	// Get the image based on the manifest
-	httpc := http.Client{
-		Timeout: pullTimeout * time.Second,
-	}
+	httpc := client.NewHTTPClient(pullTimeout * time.Second)
 
-	req, err := http.NewRequest(http.MethodGet, manifest.Image, nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, manifest.Image, nil)
 	if err != nil {
 		return err
 	}
-	req.Header.Set("User-Agent", useragent.Value())
+	req.Header.Set("User-Agent", client.UserAgent(ctx))
 
 	if noHTTPS {
 		req.URL.Scheme = "http"
@@ -95,18 +96,21 @@ func DownloadImage(ctx context.Context, manifest APIResponse, filePath, shubRef
 
 	sylog.Debugf("Created output file: %s\n", filePath)
 
-	// Write the body to file
-	pb := client.ProgressBarCallback(ctx)
-	err = pb(resp.ContentLength, resp.Body, out)
+	// Write the body to file, computing the md5 sum the shub manifest
+	// reports as the image version on the fly
+	hash := md5.New()
+	w := client.NetworkWriter(ctx, io.MultiWriter(out, hash))
+	if pb := client.ProgressBarCallback(ctx); pb != nil {
+		err = pb(resp.ContentLength, resp.Body, w)
+	} else {
+		err = client.CopyWithContext(ctx, w, resp.Body)
+	}
 	if err != nil {
 		// Delete incomplete image file in the event of failure
 		// we get here e.g. if the context is canceled by Ctrl-C
 		resp.Body.Close()
 		out.Close()
-		sylog.Infof("Cleaning up incomplete download: %s", filePath)
-		if err := os.Remove(filePath); err != nil {
-			sylog.Errorf("Error while removing incomplete download: %v", err)
-		}
+		client.RemoveIncomplete(filePath)
 		return err
 	}
 	out.Close()
@@ -120,23 +124,60 @@ func DownloadImage(ctx context.Context, manifest APIResponse, filePath, shubRef
 	if resp.ContentLength == -1 {
 		sylog.Warningf("unknown image length")
 	} else if st.Size() != resp.ContentLength {
+		client.RemoveIncomplete(filePath)
 		return fmt.Errorf("image received is not the right size. supposed to be: %v actually: %v", resp.ContentLength, st.Size())
 	}
 
+	// The manifest version is the md5 sum of the image file
+	if isMD5(manifest.Version) {
+		sum := hex.EncodeToString(hash.Sum(nil))
+		if sum != strings.ToLower(manifest.Version) {
+			client.RemoveIncomplete(filePath)
+			return fmt.Errorf("image received does not match the manifest: expected md5 %s, got %s", manifest.Version, sum)
+		}
+		sylog.Debugf("Image md5 sum verified: %s", sum)
+	} else {
+		sylog.Warningf("No image hash in shub manifest, skipping verification")
+	}
+
 	sylog.Debugf("Download complete: %s\n", filePath)
 
 	return nil
 }
 
-// pull will pull an oras image into the cache if directTo="", or a specific file if directTo is set.
-func pull(ctx context.Context, imgCache *cache.Handle, directTo, pullFrom string, noHTTPS bool) (imagePath string, err error) {
+// isMD5 returns true if s looks like an hex encoded md5 sum.
+func isMD5(s string) bool {
+	if len(s) != 2*md5.Size {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+// CacheHash returns the hash the shub image pullFrom is cached with, the
+// commit of its manifest.
+func CacheHash(ctx context.Context, pullFrom string, noHTTPS bool) (string, error) {
+	shubURI, err := ParseReference(pullFrom)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse shub uri: %s", err)
+	}
+	manifest, err := GetManifest(ctx, shubURI, noHTTPS)
+	if err != nil {
+		return "", fmt.Errorf("failed to get manifest for: %s: %s", pullFrom, err)
+	}
+	return manifest.Commit, nil
+}
+
+// pull will pull a shub image into the cache if directTo="", or a specific file if directTo is set.
+// The image is removed unless it has the sha256 hash digest, if not empty.
+func pull(ctx context.Context, imgCache *cache.Handle, directTo, pullFrom string, noHTTPS bool, digest string) (imagePath string, err error) {
 	shubURI, err := ParseReference(pullFrom)
 	if err != nil {
 		return "", fmt.Errorf("failed to parse shub uri: %s", err)
 	}
 
 	// Get the image manifest
-	manifest, err := GetManifest(shubURI, noHTTPS)
+	manifest, err := GetManifest(ctx, shubURI, noHTTPS)
 	if err != nil {
 		return "", fmt.Errorf("failed to get manifest for: %s: %s", pullFrom, err)
 	}
@@ -146,6 +187,10 @@ func pull(ctx context.Context, imgCache *cache.Handle, directTo, pullFrom string
 		if err := DownloadImage(ctx, manifest, directTo, pullFrom, true, noHTTPS); err != nil {
 			return "", err
 		}
+		if err := client.VerifyDigest(directTo, digest); err != nil {
+			os.Remove(directTo)
+			return "", err
+		}
 		imagePath = directTo
 	} else {
 		cacheEntry, err := imgCache.GetEntry(cache.ShubCacheType, manifest.Commit)
@@ -160,6 +205,10 @@ func pull(ctx context.Context, imgCache *cache.Handle, directTo, pullFrom string
 			if err != nil {
 				return "", err
 			}
+			// not cached unless verified
+			if err := client.VerifyDigest(cacheEntry.TmpPath, digest); err != nil {
+				return "", err
+			}
 
 			err = cacheEntry.Finalize()
 			if err != nil {
@@ -168,6 +217,9 @@ func pull(ctx context.Context, imgCache *cache.Handle, directTo, pullFrom string
 			imagePath = cacheEntry.Path
 		} else {
 			sylog.Infof("Use cached image")
+			if err := client.VerifyDigest(cacheEntry.Path, digest); err != nil {
+				return "", fmt.Errorf("cached image %s: %w", cacheEntry.Path, err)
+			}
 			imagePath = cacheEntry.Path
 		}
 
@@ -176,8 +228,9 @@ func pull(ctx context.Context, imgCache *cache.Handle, directTo, pullFrom string
 	return imagePath, nil
 }
 
-// Pull will pull a shub image to the cache or direct to a temporary file if cache is disabled
-func Pull(ctx context.Context, imgCache *cache.Handle, pullFrom, tmpDir string, noHTTPS bool) (imagePath string, err error) {
+// Pull will pull a shub image to the cache or direct to a temporary file if cache is disabled.
+// The image is not cached unless it has the sha256 hash digest, if not empty.
+func Pull(ctx context.Context, imgCache *cache.Handle, pullFrom, tmpDir string, noHTTPS bool, digest string) (imagePath string, err error) {
 
 	directTo := ""
 
@@ -190,30 +243,61 @@ func Pull(ctx context.Context, imgCache *cache.Handle, pullFrom, tmpDir string,
 		sylog.Infof("Downloading shub image to tmp cache: %s", directTo)
 	}
 
-	return pull(ctx, imgCache, directTo, pullFrom, noHTTPS)
+	return pull(ctx, imgCache, directTo, pullFrom, noHTTPS, digest)
 
 }
 
-// PullToFile will pull a shub image to the specified location, through the cache, or directly if cache is disabled
-func PullToFile(ctx context.Context, imgCache *cache.Handle, pullTo, pullFrom, tmpDir string, noHTTPS bool) (imagePath string, err error) {
+// PullToFile will pull a shub image to the specified location, through the cache, or directly if cache is disabled.
+// The image is neither cached nor written to pullTo unless it has the sha256 hash digest, if not empty.
+func PullToFile(ctx context.Context, imgCache *cache.Handle, pullTo, pullFrom, tmpDir string, noHTTPS bool, digest string) (imagePath string, err error) {
 
 	directTo := ""
-	if imgCache.IsDisabled() {
-		directTo = pullTo
-		sylog.Debugf("Cache disabled, pulling directly to: %s", directTo)
+	bypass := imgCache.IsDisabled()
+	if !bypass && imgCache.IsReadOnly() {
+		hash, err := CacheHash(ctx, pullFrom, noHTTPS)
+		if err != nil {
+			return "", err
+		}
+		_, cached, _ := imgCache.Lookup(cache.ShubCacheType, hash)
+		bypass = !cached
+	}
+	if bypass {
+		// stage the download in tmpDir so that pullTo is only ever
+		// replaced by a complete, verified image
+		file, err := ioutil.TempFile(tmpDir, "shub-tmp-")
+		if err != nil {
+			return "", fmt.Errorf("unable to create tmp file: %v", err)
+		}
+		file.Close()
+		directTo = file.Name()
+		defer os.Remove(directTo)
+		sylog.Debugf("Pulling without the cache to: %s", directTo)
 	}
 
-	src, err := pull(ctx, imgCache, directTo, pullFrom, noHTTPS)
+	src, err := pull(ctx, imgCache, directTo, pullFrom, noHTTPS, digest)
 	if err != nil {
 		return "", fmt.Errorf("error fetching image to cache: %v", err)
 	}
 
-	if directTo == "" {
-		// mode is before umask if pullTo doesn't exist
-		err = fs.CopyFileAtomic(src, pullTo, 0777)
+	if directTo != "" {
+		// try a plain rename first, which is atomic if tmpDir and
+		// pullTo are on the same filesystem
+		umask, err := fs.Umask()
 		if err != nil {
-			return "", fmt.Errorf("error copying image out of cache: %v", err)
+			return "", fmt.Errorf("error getting umask: %v", err)
 		}
+		if err := os.Chmod(directTo, 0777&^umask); err != nil {
+			return "", fmt.Errorf("error setting image permissions: %v", err)
+		}
+		if err := os.Rename(directTo, pullTo); err == nil {
+			return pullTo, nil
+		}
+	}
+
+	// mode is before umask if pullTo doesn't exist
+	err = fs.CopyFileAtomic(src, pullTo, 0777)
+	if err != nil {
+		return "", fmt.Errorf("error copying image out of cache: %v", err)
 	}
 
 	return pullTo, nil
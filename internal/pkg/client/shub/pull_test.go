@@ -36,7 +36,7 @@ func TestDownloadImage(t *testing.T) {
 	}
 
 	// Get the image manifest
-	manifest, err := GetManifest(shubURI, false)
+	manifest, err := GetManifest(context.Background(), shubURI, false)
 	if err != nil {
 		t.Fatalf("failed to get manifest from shub: %s", err)
 	}
@@ -0,0 +1,93 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package client
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// The phases of a pull recorded by a trace.
+const (
+	PhaseResolve      = "resolve"
+	PhaseMetadata     = "metadata"
+	PhaseCacheLookup  = "cache lookup"
+	PhaseDownload     = "download"
+	PhaseHash         = "hash verification"
+	PhaseCopy         = "copy"
+	PhaseVerification = "signature verification"
+	PhaseTransparency = "transparency log"
+)
+
+// TracePhase is a phase of a pull, started at Offset from the start of
+// the trace.
+type TracePhase struct {
+	Name     string
+	Offset   time.Duration
+	Duration time.Duration
+}
+
+// Trace records the phases of a pull.
+type Trace struct {
+	start time.Time
+
+	mu     sync.Mutex
+	phases []TracePhase
+}
+
+type traceKey struct{}
+
+// WithTrace returns a copy of ctx for which the phases of the pull are
+// recorded to the returned trace.
+func WithTrace(ctx context.Context) (context.Context, *Trace) {
+	t := &Trace{start: time.Now()}
+	return context.WithValue(ctx, traceKey{}, t), t
+}
+
+// TraceFromContext returns the trace of ctx, nil if it has none.
+func TraceFromContext(ctx context.Context) *Trace {
+	if ctx == nil {
+		return nil
+	}
+	t, _ := ctx.Value(traceKey{}).(*Trace)
+	return t
+}
+
+// StartPhase starts the phase name of the trace of ctx, if any, and returns
+// the function ending it.
+func StartPhase(ctx context.Context, name string) func() {
+	t := TraceFromContext(ctx)
+	if t == nil {
+		return func() {}
+	}
+	start := time.Now()
+	return func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		t.phases = append(t.phases, TracePhase{
+			Name:     name,
+			Offset:   start.Sub(t.start),
+			Duration: time.Since(start),
+		})
+	}
+}
+
+// Phases returns the phases ended, in the order they started.
+func (t *Trace) Phases() []TracePhase {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	phases := append([]TracePhase(nil), t.phases...)
+	t.mu.Unlock()
+
+	sort.SliceStable(phases, func(i, j int) bool {
+		return phases[i].Offset < phases[j].Offset
+	})
+	return phases
+}
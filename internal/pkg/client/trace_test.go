@@ -0,0 +1,47 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTrace(t *testing.T) {
+	// phases are ignored without a trace
+	StartPhase(context.Background(), PhaseDownload)()
+	var none *Trace
+	if p := none.Phases(); p != nil {
+		t.Errorf("unexpected phases for nil trace: %v", p)
+	}
+
+	ctx, trace := WithTrace(context.Background())
+	if TraceFromContext(ctx) != trace {
+		t.Fatalf("trace not found in context")
+	}
+
+	endDownload := StartPhase(ctx, PhaseDownload)
+	endHash := StartPhase(ctx, PhaseHash)
+	time.Sleep(time.Millisecond)
+	endHash()
+	endDownload()
+	StartPhase(ctx, PhaseCopy)
+
+	phases := trace.Phases()
+	if len(phases) != 2 {
+		t.Fatalf("expected 2 ended phases, got %v", phases)
+	}
+	if phases[0].Name != PhaseDownload || phases[1].Name != PhaseHash {
+		t.Errorf("phases %v not in the order they started", phases)
+	}
+	if phases[1].Duration < time.Millisecond || phases[0].Duration < phases[1].Duration {
+		t.Errorf("unexpected durations %v", phases)
+	}
+	if phases[1].Offset < phases[0].Offset {
+		t.Errorf("unexpected offsets %v", phases)
+	}
+}
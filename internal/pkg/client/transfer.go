@@ -0,0 +1,72 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package client
+
+import (
+	"context"
+	"io"
+	"sync/atomic"
+)
+
+// Transfer accounts for the bytes downloaded by the clients while pulling an
+// image.
+type Transfer struct {
+	network int64
+}
+
+type transferKey struct{}
+
+// WithTransfer returns a copy of ctx for which the bytes downloaded by the
+// clients are added to the returned transfer.
+func WithTransfer(ctx context.Context) (context.Context, *Transfer) {
+	t := &Transfer{}
+	return context.WithValue(ctx, transferKey{}, t), t
+}
+
+// TransferFromContext returns the transfer of ctx, nil if it has none.
+func TransferFromContext(ctx context.Context) *Transfer {
+	if ctx == nil {
+		return nil
+	}
+	t, _ := ctx.Value(transferKey{}).(*Transfer)
+	return t
+}
+
+// AddNetwork adds n bytes downloaded to the transfer.
+func (t *Transfer) AddNetwork(n int64) {
+	if t != nil {
+		atomic.AddInt64(&t.network, n)
+	}
+}
+
+// Network returns the number of bytes downloaded.
+func (t *Transfer) Network() int64 {
+	if t == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&t.network)
+}
+
+type networkWriter struct {
+	w io.Writer
+	t *Transfer
+}
+
+func (nw networkWriter) Write(p []byte) (int, error) {
+	n, err := nw.w.Write(p)
+	nw.t.AddNetwork(int64(n))
+	return n, err
+}
+
+// NetworkWriter returns a writer to w adding the bytes written to the
+// transfer of ctx, if any, as downloaded.
+func NetworkWriter(ctx context.Context, w io.Writer) io.Writer {
+	t := TransferFromContext(ctx)
+	if t == nil {
+		return w
+	}
+	return networkWriter{w: w, t: t}
+}
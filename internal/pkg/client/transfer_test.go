@@ -0,0 +1,45 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestTransfer(t *testing.T) {
+	var b bytes.Buffer
+
+	// without a transfer the writer is returned as is
+	if w := NetworkWriter(context.Background(), &b); w != &b {
+		t.Errorf("unexpected writer wrapping without transfer")
+	}
+	var none *Transfer
+	none.AddNetwork(1)
+	if n := none.Network(); n != 0 {
+		t.Errorf("unexpected bytes for nil transfer: %d", n)
+	}
+
+	ctx, transfer := WithTransfer(context.Background())
+	if TransferFromContext(ctx) != transfer {
+		t.Fatalf("transfer not found in context")
+	}
+
+	const content = "image content"
+	for i := 0; i < 2; i++ {
+		if err := CopyWithContext(ctx, NetworkWriter(ctx, &b), strings.NewReader(content)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if n := transfer.Network(); n != 2*int64(len(content)) {
+		t.Errorf("expected %d bytes downloaded, got %d", 2*len(content), n)
+	}
+	if b.String() != content+content {
+		t.Errorf("unexpected content written: %q", b.String())
+	}
+}
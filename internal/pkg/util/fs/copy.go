@@ -0,0 +1,82 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package fs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/sylabs/singularity/pkg/sylog"
+)
+
+// CopyMethod is the way CopyFileAtomic copies the content of a file.
+type CopyMethod string
+
+const (
+	// CopyAuto clones the file when the source and destination are on the
+	// same filesystem supporting reflinks, else copies it in the kernel
+	// with copy_file_range, else streams it.
+	CopyAuto CopyMethod = "auto"
+	// CopyReflink clones the file, failing where reflinks are not
+	// supported.
+	CopyReflink CopyMethod = "reflink"
+	// CopyStream streams the file through a buffer.
+	CopyStream CopyMethod = "stream"
+)
+
+// errCopyUnsupported is returned by the kernel-side copies the files or
+// the platform don't support.
+var errCopyUnsupported = errors.New("not supported")
+
+// copyMethod is the CopyMethod of CopyFileAtomic.
+var copyMethod = CopyAuto
+
+// SetCopyMethod sets the way CopyFileAtomic copies the content of a file,
+// CopyAuto by default.
+func SetCopyMethod(m CopyMethod) error {
+	switch m {
+	case CopyAuto, CopyReflink, CopyStream:
+		copyMethod = m
+		return nil
+	}
+	return fmt.Errorf("unknown copy method %q, must be one of %s, %s or %s", m, CopyAuto, CopyReflink, CopyStream)
+}
+
+// copyContent copies the content of src to the empty file dst with the
+// copy method set.
+func copyContent(dst, src *os.File) error {
+	switch copyMethod {
+	case CopyStream:
+		_, err := io.Copy(dst, src)
+		return err
+	case CopyReflink:
+		if err := cloneFile(dst, src); err != nil {
+			return fmt.Errorf("reflink of %s to %s failed: %v", src.Name(), dst.Name(), err)
+		}
+		return nil
+	}
+
+	if sameFilesystem(dst, src) {
+		err := cloneFile(dst, src)
+		if err == nil {
+			sylog.Debugf("Cloned %s to %s", src.Name(), dst.Name())
+			return nil
+		}
+		sylog.Debugf("Could not clone %s: %v", src.Name(), err)
+
+		err = copyFileRange(dst, src)
+		if err == nil {
+			sylog.Debugf("Copied %s to %s with copy_file_range", src.Name(), dst.Name())
+			return nil
+		} else if err != errCopyUnsupported {
+			return err
+		}
+	}
+	_, err := io.Copy(dst, src)
+	return err
+}
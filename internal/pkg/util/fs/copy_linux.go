@@ -0,0 +1,63 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package fs
+
+import (
+	"math"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// ficlone is the FICLONE ioctl request, _IOW(0x94, 9, int).
+const ficlone = 0x40049409
+
+// sameFilesystem returns whether the files a and b are on the same
+// filesystem.
+func sameFilesystem(a, b *os.File) bool {
+	var sa, sb unix.Stat_t
+	if unix.Fstat(int(a.Fd()), &sa) != nil || unix.Fstat(int(b.Fd()), &sb) != nil {
+		return false
+	}
+	return sa.Dev == sb.Dev
+}
+
+// cloneFile makes dst share the extents of src, on filesystems supporting
+// reflinks such as Btrfs or XFS.
+func cloneFile(dst, src *os.File) error {
+	_, _, errno := unix.Syscall(unix.SYS_IOCTL, dst.Fd(), ficlone, src.Fd())
+	switch errno {
+	case 0:
+		return nil
+	case unix.EOPNOTSUPP, unix.ENOTTY, unix.EXDEV, unix.EINVAL:
+		return errCopyUnsupported
+	}
+	return errno
+}
+
+// copyFileRange copies src to dst in the kernel, the filesystem being free
+// to share their extents. errCopyUnsupported is returned if nothing could
+// be copied this way, the copy being left to do.
+func copyFileRange(dst, src *os.File) error {
+	copied := false
+	for {
+		n, err := unix.CopyFileRange(int(src.Fd()), nil, int(dst.Fd()), nil, math.MaxInt32, 0)
+		if err != nil {
+			if copied {
+				return err
+			}
+			switch err {
+			case unix.ENOSYS, unix.EOPNOTSUPP, unix.EXDEV, unix.EINVAL:
+				return errCopyUnsupported
+			}
+			return err
+		}
+		if n == 0 {
+			return nil
+		}
+		copied = true
+	}
+}
@@ -0,0 +1,24 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// +build !linux
+
+package fs
+
+import (
+	"os"
+)
+
+func sameFilesystem(a, b *os.File) bool {
+	return false
+}
+
+func cloneFile(dst, src *os.File) error {
+	return errCopyUnsupported
+}
+
+func copyFileRange(dst, src *os.File) error {
+	return errCopyUnsupported
+}
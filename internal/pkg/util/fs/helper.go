@@ -12,6 +12,7 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"syscall"
 
@@ -335,18 +336,60 @@ func CopyFile(from, to string, mode os.FileMode) (err error) {
 	return nil
 }
 
+// Umask returns the umask of the process. Unlike syscall.Umask it doesn't
+// change the umask, even briefly, so it is safe to call while other
+// goroutines create files. The umask is read from /proc/self/status,
+// with a fallback for kernels without the Umask field which creates a
+// file in a new temporary directory and reads back its permission bits.
+func Umask() (os.FileMode, error) {
+	b, err := ioutil.ReadFile("/proc/self/status")
+	if err == nil {
+		for _, line := range strings.Split(string(b), "\n") {
+			if !strings.HasPrefix(line, "Umask:") {
+				continue
+			}
+			m, err := strconv.ParseUint(strings.TrimSpace(strings.TrimPrefix(line, "Umask:")), 8, 32)
+			if err != nil {
+				return 0, fmt.Errorf("could not parse umask %q: %v", line, err)
+			}
+			return os.FileMode(m) & os.ModePerm, nil
+		}
+	}
+
+	dir, err := ioutil.TempDir("", "umask-")
+	if err != nil {
+		return 0, err
+	}
+	defer os.RemoveAll(dir)
+
+	f, err := os.OpenFile(filepath.Join(dir, "umask"), os.O_CREATE|os.O_EXCL|os.O_WRONLY, os.ModePerm)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return os.ModePerm &^ fi.Mode().Perm(), nil
+}
+
 // CopyFileAtomic copies file to a temporary file in the same destination directory
 // and the renames to the final name. This is useful to avoid races where concurrent copies
 // could happen to the same destination. It makes sure the resulting
 // file has permission bits set to the mode prior to umask. To honor umask
-// correctly the resulting file must not exist.
+// correctly the resulting file must not exist. The content is copied with the
+// method set by SetCopyMethod.
 func CopyFileAtomic(from, to string, mode os.FileMode) (err error) {
 
 	// MakeTmpFile forces mode with chmod, so manually apply umask to mode so we
 	// act like other file copy functions that respect umask
-	oldmask := syscall.Umask(0)
-	syscall.Umask(oldmask)
-	mode = mode &^ os.FileMode(oldmask)
+	umask, err := Umask()
+	if err != nil {
+		return fmt.Errorf("could not get umask: %v", err)
+	}
+	mode = mode &^ umask
 
 	parentDir := filepath.Dir(to)
 
@@ -366,7 +409,7 @@ func CopyFileAtomic(from, to string, mode os.FileMode) (err error) {
 	}
 	defer srcFile.Close()
 
-	_, err = io.Copy(tmpFile, srcFile)
+	err = copyContent(tmpFile, srcFile)
 	if err != nil {
 		return fmt.Errorf("could not copy file: %v", err)
 	}
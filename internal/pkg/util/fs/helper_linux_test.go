@@ -11,6 +11,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"syscall"
 	"testing"
 
 	"github.com/sylabs/singularity/internal/pkg/test"
@@ -579,6 +580,65 @@ func TestCopyFileAtomic(t *testing.T) {
 	testCopyFileFunc(t, CopyFileAtomic)
 }
 
+func TestUmask(t *testing.T) {
+	for _, mask := range []int{022, 027, 077, 0} {
+		old := syscall.Umask(mask)
+		umask, err := Umask()
+		if after := syscall.Umask(old); after != mask {
+			t.Errorf("umask changed to %#o, expected %#o", after, mask)
+		}
+		if err != nil {
+			t.Fatalf("unexpected error with umask %#o: %s", mask, err)
+		}
+		if umask != os.FileMode(mask) {
+			t.Errorf("got umask %#o, expected %#o", umask, mask)
+		}
+	}
+}
+
+func TestCopyFileAtomicMethods(t *testing.T) {
+	defer SetCopyMethod(CopyAuto)
+
+	dir, err := ioutil.TempDir("", "copy-method-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// larger than a single read buffer
+	content := bytes.Repeat([]byte("singularity"), 100000)
+	src := filepath.Join(dir, "src")
+	if err := ioutil.WriteFile(src, content, 0644); err != nil {
+		t.Fatalf("failed to write %s: %s", src, err)
+	}
+
+	for _, m := range []CopyMethod{CopyAuto, CopyStream, CopyReflink} {
+		t.Run(string(m), func(t *testing.T) {
+			if err := SetCopyMethod(m); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			dst := filepath.Join(dir, string(m))
+			if err := CopyFileAtomic(src, dst, 0644); err != nil {
+				if m == CopyReflink {
+					t.Skipf("reflinks not supported in %s: %s", dir, err)
+				}
+				t.Fatalf("unexpected error: %s", err)
+			}
+			b, err := ioutil.ReadFile(dst)
+			if err != nil {
+				t.Fatalf("failed to read %s: %s", dst, err)
+			}
+			if !bytes.Equal(b, content) {
+				t.Errorf("copy with %s differs from the source", m)
+			}
+		})
+	}
+
+	if err := SetCopyMethod("mmap"); err == nil {
+		t.Errorf("unexpected success with an unknown copy method")
+	}
+}
+
 func TestIsWritable(t *testing.T) {
 	test.EnsurePrivilege(t)
 
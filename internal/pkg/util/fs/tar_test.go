@@ -0,0 +1,81 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package fs
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestWriteTar(t *testing.T) {
+	dir, err := ioutil.TempDir("", "write-tar-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := os.MkdirAll(filepath.Join(dir, "etc"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "etc", "hostname"), []byte("container\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Link(filepath.Join(dir, "etc", "hostname"), filepath.Join(dir, "etc", "hostname.bak")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("etc/hostname", filepath.Join(dir, "hostname")); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteTar(context.Background(), dir, &buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	type entry struct {
+		typeflag byte
+		link     string
+		content  string
+	}
+	got := make(map[string]entry)
+	tr := tar.NewReader(&buf)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("invalid tarball: %v", err)
+		}
+		content, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatalf("invalid tarball: %v", err)
+		}
+		got[hdr.Name] = entry{hdr.Typeflag, hdr.Linkname, string(content)}
+	}
+
+	want := map[string]entry{
+		"etc/":             {tar.TypeDir, "", ""},
+		"etc/hostname":     {tar.TypeReg, "", "container\n"},
+		"etc/hostname.bak": {tar.TypeLink, "etc/hostname", ""},
+		"hostname":         {tar.TypeSymlink, "etc/hostname", ""},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got entries %v, want %v", got, want)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := WriteTar(ctx, dir, ioutil.Discard); err != context.Canceled {
+		t.Errorf("got error %v for a cancelled context, want %v", err, context.Canceled)
+	}
+}
@@ -17,6 +17,7 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
 
 	"github.com/sylabs/sif/pkg/sif"
@@ -314,3 +315,68 @@ func CompatibleWith(arch string) bool {
 
 	return canEmulate(arch)
 }
+
+// Archs returns the sorted list of architectures known by Singularity.
+func Archs() []string {
+	var archs []string
+	for _, f := range formats {
+		if len(archs) == 0 || archs[len(archs)-1] != f.Arch {
+			archs = append(archs, f.Arch)
+		}
+	}
+	sort.Strings(archs)
+	return archs
+}
+
+// CheckArch returns an error if arch is not a known architecture. The
+// error suggests the known architectures closest to arch, if any.
+func CheckArch(arch string) error {
+	archs := Archs()
+
+	var suggestions []string
+	for _, a := range archs {
+		if a == arch {
+			return nil
+		}
+		// allow up to two typos, except for very short names
+		if d := editDistance(a, arch); d <= 2 && d < len(arch) {
+			suggestions = append(suggestions, a)
+		}
+	}
+
+	if len(suggestions) > 0 {
+		sort.SliceStable(suggestions, func(i, j int) bool {
+			return editDistance(suggestions[i], arch) < editDistance(suggestions[j], arch)
+		})
+		return fmt.Errorf("unknown architecture %q, did you mean %s?", arch, strings.Join(suggestions, " or "))
+	}
+	return fmt.Errorf("unknown architecture %q, known architectures are: %s", arch, strings.Join(archs, ", "))
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = prev[j-1] + cost
+			if d := prev[j] + 1; d < cur[j] {
+				cur[j] = d
+			}
+			if d := cur[j-1] + 1; d < cur[j] {
+				cur[j] = d
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
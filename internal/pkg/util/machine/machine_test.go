@@ -0,0 +1,56 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package machine
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckArch(t *testing.T) {
+	tests := []struct {
+		arch      string
+		expectErr bool
+		suggested string
+	}{
+		{arch: "amd64"},
+		{arch: "ppc64le"},
+		{arch: "amd54", expectErr: true, suggested: "did you mean amd64?"},
+		{arch: "arm46", expectErr: true, suggested: "arm64"},
+		{arch: "x86_64", expectErr: true, suggested: "known architectures are"},
+		{arch: "", expectErr: true, suggested: "known architectures are"},
+	}
+
+	for _, tt := range tests {
+		err := CheckArch(tt.arch)
+		if (err != nil) != tt.expectErr {
+			t.Errorf("arch %q: unexpected error: %v", tt.arch, err)
+			continue
+		}
+		if err != nil && !strings.Contains(err.Error(), tt.suggested) {
+			t.Errorf("arch %q: expected %q in error: %v", tt.arch, tt.suggested, err)
+		}
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected int
+	}{
+		{"", "", 0},
+		{"amd64", "amd64", 0},
+		{"amd64", "amd54", 1},
+		{"arm64", "arm", 2},
+		{"", "s390x", 5},
+	}
+
+	for _, tt := range tests {
+		if d := editDistance(tt.a, tt.b); d != tt.expected {
+			t.Errorf("distance between %q and %q: expected %d, got %d", tt.a, tt.b, tt.expected, d)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sifedit
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/sylabs/sif/pkg/sif"
+)
+
+// ErrNoDeffile is returned by Deffile for images holding no definition file.
+var ErrNoDeffile = errors.New("no definition file descriptor")
+
+// Deffile returns the definition file the SIF image at path was built from,
+// ErrNoDeffile is returned if the image has none.
+func Deffile(path string) ([]byte, error) {
+	fimg, err := sif.LoadContainer(path, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load SIF image %s: %v", path, err)
+	}
+	defer fimg.UnloadContainer()
+
+	for _, d := range fimg.DescrArr {
+		if !d.Used || d.Datatype != sif.DataDeffile {
+			continue
+		}
+		data := d.GetData(&fimg)
+		if data == nil {
+			return nil, fmt.Errorf("failed to read definition file of %s", path)
+		}
+		// the image is memory mapped and unloaded on return
+		return append([]byte(nil), data...), nil
+	}
+	return nil, ErrNoDeffile
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sifedit
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/sylabs/sif/pkg/sif"
+)
+
+func TestDeffile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sifedit-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// the test image of ExtractGroup has no definition file
+	path := filepath.Join(dir, "image.sif")
+	createTestImage(t, path)
+	if _, err := Deffile(path); err != ErrNoDeffile {
+		t.Errorf("unexpected error for image without definition file: %v", err)
+	}
+
+	deffile := []byte("Bootstrap: library\nFrom: alpine\n")
+	inputs := []sif.DescriptorInput{
+		{Datatype: sif.DataDeffile, Groupid: sif.DescrGroupMask | 1, Fname: "deffile", Data: deffile},
+		{Datatype: sif.DataPartition, Groupid: sif.DescrGroupMask | 1, Fname: "rootfs", Data: []byte("rootfs")},
+	}
+	if err := inputs[1].SetPartExtra(sif.FsSquash, sif.PartPrimSys, sif.HdrArchAMD64); err != nil {
+		t.Fatal(err)
+	}
+	for i := range inputs {
+		inputs[i].Size = int64(len(inputs[i].Data))
+		inputs[i].Fp = bytes.NewReader(inputs[i].Data)
+	}
+	path = filepath.Join(dir, "deffile.sif")
+	fimg, err := sif.CreateContainer(sif.CreateInfo{
+		Pathname:   path,
+		Launchstr:  sif.HdrLaunch,
+		Sifversion: sif.HdrVersion,
+		ID:         uuid.NewV4(),
+		InputDescr: inputs,
+	})
+	if err != nil {
+		t.Fatalf("failed to create image: %v", err)
+	}
+	fimg.UnloadContainer()
+
+	b, err := Deffile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !bytes.Equal(b, deffile) {
+		t.Errorf("unexpected definition file %q", b)
+	}
+
+	if _, err := Deffile(filepath.Join(dir, "missing.sif")); err == nil {
+		t.Errorf("unexpected success reading missing image")
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sifedit
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"sort"
+
+	"github.com/sylabs/sif/pkg/sif"
+)
+
+// The kinds of changes of a descriptor.
+const (
+	Added   = "added"
+	Removed = "removed"
+	Changed = "changed"
+)
+
+// Change is a descriptor of a SIF image added, removed or changed in
+// another image.
+type Change struct {
+	// ID is the ID of the descriptor.
+	ID uint32
+	// Datatype is the data type of the descriptor, the one in the other
+	// image unless removed.
+	Datatype string
+	// Name is the name of the descriptor, the one in the other image unless
+	// removed.
+	Name string
+	// Kind is Added, Removed or Changed.
+	Kind string
+}
+
+// descrSummary is what is compared of a descriptor.
+type descrSummary struct {
+	datatype sif.Datatype
+	name     string
+	extra    [sif.DescrMaxPrivLen]byte
+	size     int64
+	hash     [sha256.Size]byte
+}
+
+// Diff returns the descriptors of the SIF image at path a that were added,
+// removed or changed in the image at path b, by ID. A descriptor is changed
+// if its data type, name, extra information such as the partition
+// architecture, or data differ.
+func Diff(a, b string) ([]Change, error) {
+	da, err := summarize(a)
+	if err != nil {
+		return nil, err
+	}
+	db, err := summarize(b)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []Change
+	for id, sa := range da {
+		sb, ok := db[id]
+		switch {
+		case !ok:
+			changes = append(changes, Change{ID: id, Datatype: sa.datatype.String(), Name: sa.name, Kind: Removed})
+		case sa.datatype != sb.datatype || sa.name != sb.name || sa.size != sb.size ||
+			sa.extra != sb.extra || sa.hash != sb.hash:
+			changes = append(changes, Change{ID: id, Datatype: sb.datatype.String(), Name: sb.name, Kind: Changed})
+		}
+	}
+	for id, sb := range db {
+		if _, ok := da[id]; !ok {
+			changes = append(changes, Change{ID: id, Datatype: sb.datatype.String(), Name: sb.name, Kind: Added})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].ID < changes[j].ID
+	})
+	return changes, nil
+}
+
+// summarize returns the summaries of the used descriptors of the SIF image
+// at path by ID.
+func summarize(path string) (map[uint32]descrSummary, error) {
+	fimg, err := sif.LoadContainer(path, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load SIF image %s: %v", path, err)
+	}
+	defer fimg.UnloadContainer()
+
+	summaries := make(map[uint32]descrSummary)
+	for i := range fimg.DescrArr {
+		d := &fimg.DescrArr[i]
+		if !d.Used {
+			continue
+		}
+		data := d.GetData(&fimg)
+		if data == nil && d.Filelen > 0 {
+			return nil, fmt.Errorf("failed to read descriptor %d of %s", d.ID, path)
+		}
+		summaries[d.ID] = descrSummary{
+			datatype: d.Datatype,
+			name:     d.GetName(),
+			extra:    d.Extra,
+			size:     d.Filelen,
+			hash:     sha256.Sum256(data),
+		}
+	}
+	return summaries, nil
+}
@@ -0,0 +1,106 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sifedit
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/sylabs/sif/pkg/sif"
+)
+
+// createDiffImage creates a SIF image at path with a descriptor with each of
+// the given data, a partition for the last one.
+func createDiffImage(t *testing.T, path string, data ...string) {
+	var inputs []sif.DescriptorInput
+	for i, d := range data {
+		input := sif.DescriptorInput{Datatype: sif.DataGeneric, Groupid: sif.DescrGroupMask | 1, Fname: "generic", Data: []byte(d)}
+		if i == len(data)-1 {
+			input.Datatype, input.Fname = sif.DataPartition, "rootfs"
+			if err := input.SetPartExtra(sif.FsSquash, sif.PartPrimSys, sif.HdrArchAMD64); err != nil {
+				t.Fatal(err)
+			}
+		}
+		input.Size = int64(len(input.Data))
+		input.Fp = bytes.NewReader(input.Data)
+		inputs = append(inputs, input)
+	}
+	fimg, err := sif.CreateContainer(sif.CreateInfo{
+		Pathname:   path,
+		Launchstr:  sif.HdrLaunch,
+		Sifversion: sif.HdrVersion,
+		ID:         uuid.NewV4(),
+		InputDescr: inputs,
+	})
+	if err != nil {
+		t.Fatalf("failed to create image: %v", err)
+	}
+	fimg.UnloadContainer()
+}
+
+func TestDiff(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sifedit-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	a := filepath.Join(dir, "a.sif")
+	createDiffImage(t, a, "labels", "rootfs")
+	same := filepath.Join(dir, "same.sif")
+	createDiffImage(t, same, "labels", "rootfs")
+	changed := filepath.Join(dir, "changed.sif")
+	createDiffImage(t, changed, "labels", "new rootfs")
+	added := filepath.Join(dir, "added.sif")
+	createDiffImage(t, added, "labels", "env", "rootfs")
+
+	tests := []struct {
+		name string
+		a, b string
+		want []Change
+	}{
+		{name: "Identical", a: a, b: same},
+		{name: "Changed", a: a, b: changed, want: []Change{{ID: 2, Datatype: "FS", Name: "rootfs", Kind: Changed}}},
+		{
+			name: "Added",
+			a:    a,
+			b:    added,
+			want: []Change{
+				{ID: 2, Datatype: "Generic/Raw", Name: "generic", Kind: Changed},
+				{ID: 3, Datatype: "FS", Name: "rootfs", Kind: Added},
+			},
+		},
+		{
+			name: "Removed",
+			a:    added,
+			b:    a,
+			want: []Change{
+				{ID: 2, Datatype: "FS", Name: "rootfs", Kind: Changed},
+				{ID: 3, Datatype: "FS", Name: "rootfs", Kind: Removed},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes, err := Diff(tt.a, tt.b)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(changes, tt.want) {
+				t.Errorf("got changes %+v, want %+v", changes, tt.want)
+			}
+		})
+	}
+
+	if _, err := Diff(a, filepath.Join(dir, "missing.sif")); err == nil {
+		t.Errorf("unexpected success comparing with a missing image")
+	}
+}
@@ -0,0 +1,182 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package sifedit provides helpers extracting data from and rewriting SIF
+// images.
+package sifedit
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/sylabs/sif/pkg/sif"
+	"github.com/sylabs/singularity/pkg/sylog"
+)
+
+// Groups returns the sorted IDs of the descriptor groups of a loaded SIF.
+func Groups(fimg *sif.FileImage) []uint32 {
+	seen := make(map[uint32]bool)
+	var groups []uint32
+	for _, d := range fimg.DescrArr {
+		if !d.Used || d.Groupid == sif.DescrUnusedGroup {
+			continue
+		}
+		id := d.Groupid &^ sif.DescrGroupMask
+		if !seen[id] {
+			seen[id] = true
+			groups = append(groups, id)
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i] < groups[j] })
+	return groups
+}
+
+// ExtractGroup replaces the SIF image at path by one holding only the data
+// objects of the descriptor group groupID. Signatures are dropped, as the
+// data objects are renumbered, so the image must be verified before. If the
+// group has no primary partition, its first system partition becomes it.
+func ExtractGroup(path string, groupID uint32) error {
+	fimg, err := sif.LoadContainer(path, true)
+	if err != nil {
+		return fmt.Errorf("failed to load SIF image %s: %v", path, err)
+	}
+	defer fimg.UnloadContainer()
+
+	var descrs []sif.Descriptor
+	signatures := 0
+	for _, d := range fimg.DescrArr {
+		if !d.Used {
+			continue
+		}
+		if d.Datatype == sif.DataSignature {
+			signatures++
+			continue
+		}
+		if d.Groupid == groupID|sif.DescrGroupMask {
+			descrs = append(descrs, d)
+		}
+	}
+	if len(descrs) == 0 {
+		groups := make([]string, 0)
+		for _, g := range Groups(&fimg) {
+			groups = append(groups, fmt.Sprint(g))
+		}
+		return fmt.Errorf("group %d not found in %s, available groups: %s", groupID, path, strings.Join(groups, ", "))
+	}
+	if signatures > 0 {
+		sylog.Warningf("Dropping %d signature(s) from %s, which are invalidated by the group extraction", signatures, path)
+	}
+
+	// data objects keep their order, and get the next IDs
+	ids := make(map[uint32]uint32, len(descrs))
+	for i, d := range descrs {
+		ids[d.ID] = uint32(i + 1)
+	}
+
+	cinfo := sif.CreateInfo{
+		Launchstr:  string(trimZero(fimg.Header.Launch[:])),
+		Sifversion: sif.HdrVersion,
+		ID:         uuid.NewV4(),
+	}
+	for _, d := range descrs {
+		// the image is memory mapped, data isn't copied
+		data := d.GetData(&fimg)
+		if data == nil {
+			return fmt.Errorf("failed to read data object %d of %s", d.ID, path)
+		}
+		input := sif.DescriptorInput{
+			Datatype: d.Datatype,
+			Groupid:  d.Groupid,
+			Link:     sif.DescrUnusedLink,
+			Size:     d.Filelen,
+			Fname:    d.GetName(),
+			Fp:       bytes.NewReader(data),
+		}
+		// links to groups are kept, links to other data objects
+		// are only kept if these are extracted too
+		if d.Link&sif.DescrGroupMask != 0 {
+			input.Link = d.Link
+		} else if id, ok := ids[d.Link]; ok {
+			input.Link = id
+		}
+		if _, err := input.Extra.Write(d.Extra[:]); err != nil {
+			return err
+		}
+		cinfo.InputDescr = append(cinfo.InputDescr, input)
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+"-")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %v", err)
+	}
+	tmp.Close()
+	cinfo.Pathname = tmp.Name()
+	defer os.Remove(cinfo.Pathname)
+
+	if _, err := sif.CreateContainer(cinfo); err != nil {
+		return fmt.Errorf("failed to create SIF image for group %d: %v", groupID, err)
+	}
+	if err := setPrimPart(cinfo.Pathname, descrs); err != nil {
+		return fmt.Errorf("failed to set primary partition: %v", err)
+	}
+
+	// keep the permissions of the pulled image
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(cinfo.Pathname, fi.Mode().Perm()); err != nil {
+		return err
+	}
+	return os.Rename(cinfo.Pathname, path)
+}
+
+// setPrimPart makes the first system partition of the image at path the
+// primary one when none of the extracted descrs was, so that the image runs.
+func setPrimPart(path string, descrs []sif.Descriptor) error {
+	partID := uint32(0)
+	for i, d := range descrs {
+		if d.Datatype != sif.DataPartition {
+			continue
+		}
+		ptype, err := d.GetPartType()
+		if err != nil {
+			return err
+		}
+		if ptype == sif.PartPrimSys {
+			return nil
+		}
+		if ptype == sif.PartSystem && partID == 0 {
+			partID = uint32(i + 1)
+		}
+	}
+	if partID == 0 {
+		return nil
+	}
+
+	fimg, err := sif.LoadContainer(path, false)
+	if err != nil {
+		return err
+	}
+	defer fimg.UnloadContainer()
+
+	return fimg.SetPrimPart(partID)
+}
+
+// trimZero returns b up to its first zero byte.
+func trimZero(b []byte) []byte {
+	for i, c := range b {
+		if c == 0 {
+			return b[:i]
+		}
+	}
+	return b
+}
@@ -0,0 +1,108 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sifedit
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/sylabs/sif/pkg/sif"
+)
+
+// createTestImage creates a SIF image with a primary partition in group 1,
+// a partition and a generic object linked to it in group 2, and a signature.
+func createTestImage(t *testing.T, path string) {
+	inputs := []sif.DescriptorInput{
+		{Datatype: sif.DataPartition, Groupid: sif.DescrGroupMask | 1, Fname: "amd64", Data: []byte("amd64 rootfs")},
+		{Datatype: sif.DataPartition, Groupid: sif.DescrGroupMask | 2, Fname: "arm64", Data: []byte("arm64 rootfs")},
+		{Datatype: sif.DataGeneric, Groupid: sif.DescrGroupMask | 2, Link: 2, Fname: "meta", Data: []byte("arm64 metadata")},
+		{Datatype: sif.DataSignature, Groupid: sif.DescrUnusedGroup, Link: sif.DescrGroupMask | 1, Fname: "sig", Data: []byte("signature")},
+	}
+	if err := inputs[0].SetPartExtra(sif.FsSquash, sif.PartPrimSys, sif.HdrArchAMD64); err != nil {
+		t.Fatal(err)
+	}
+	if err := inputs[1].SetPartExtra(sif.FsSquash, sif.PartSystem, sif.HdrArchARM64); err != nil {
+		t.Fatal(err)
+	}
+	if err := inputs[3].SetSignExtra(sif.HashSHA384, "0123456789abcdef0123456789abcdef01234567"); err != nil {
+		t.Fatal(err)
+	}
+	for i := range inputs {
+		inputs[i].Size = int64(len(inputs[i].Data))
+		inputs[i].Fp = bytes.NewReader(inputs[i].Data)
+	}
+
+	fimg, err := sif.CreateContainer(sif.CreateInfo{
+		Pathname:   path,
+		Launchstr:  sif.HdrLaunch,
+		Sifversion: sif.HdrVersion,
+		ID:         uuid.NewV4(),
+		InputDescr: inputs,
+	})
+	if err != nil {
+		t.Fatalf("failed to create image: %v", err)
+	}
+	fimg.UnloadContainer()
+}
+
+func TestExtractGroup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sifedit-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "image.sif")
+	createTestImage(t, path)
+
+	if err := ExtractGroup(path, 3); err == nil {
+		t.Errorf("unexpected success extracting missing group")
+	}
+
+	if err := ExtractGroup(path, 2); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	fimg, err := sif.LoadContainer(path, true)
+	if err != nil {
+		t.Fatalf("failed to load extracted image: %v", err)
+	}
+	defer fimg.UnloadContainer()
+
+	if groups := Groups(&fimg); !reflect.DeepEqual(groups, []uint32{2}) {
+		t.Errorf("expected only group 2, got %v", groups)
+	}
+
+	var names []string
+	for _, d := range fimg.DescrArr {
+		if !d.Used {
+			continue
+		}
+		if d.Datatype == sif.DataSignature {
+			t.Errorf("signature was not dropped")
+		}
+		names = append(names, d.GetName())
+		if d.GetName() == "meta" && d.Link != 1 {
+			t.Errorf("expected link to be renumbered to 1, got %d", d.Link)
+		}
+		data := d.GetData(&fimg)
+		if want := map[string]string{"arm64": "arm64 rootfs", "meta": "arm64 metadata"}[d.GetName()]; string(data) != want {
+			t.Errorf("object %s: expected data %q, got %q", d.GetName(), want, data)
+		}
+	}
+	if !reflect.DeepEqual(names, []string{"arm64", "meta"}) {
+		t.Errorf("unexpected data objects %v", names)
+	}
+
+	if part, _, err := fimg.GetPartPrimSys(); err != nil || part.GetName() != "arm64" {
+		t.Errorf("expected arm64 partition to be the primary partition: %v", err)
+	}
+}
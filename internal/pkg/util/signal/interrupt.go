@@ -0,0 +1,53 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package signal
+
+import (
+	"os"
+	ossignal "os/signal"
+	"sync"
+
+	"github.com/sylabs/singularity/pkg/sylog"
+)
+
+// exit is replaced by tests.
+var exit = os.Exit
+
+// HandleInterrupt calls interrupt once the first of sigs is received,
+// expecting it to clean up and exit the process. If the cleanup is stuck,
+// e.g. removing a file on an unresponsive network filesystem, a second
+// signal makes the process exit straight away with status 1. The returned
+// function stops the handling of sigs.
+func HandleInterrupt(interrupt func(), sigs ...os.Signal) (stop func()) {
+	c := make(chan os.Signal, 2)
+	ossignal.Notify(c, sigs...)
+	done := make(chan struct{})
+
+	go func() {
+		select {
+		case sig := <-c:
+			sylog.Infof("Received %s, cleaning up (interrupt again to quit immediately)", sig)
+			go interrupt()
+		case <-done:
+			return
+		}
+
+		select {
+		case sig := <-c:
+			sylog.Warningf("Received %s again, quitting without finishing the cleanup", sig)
+			exit(1)
+		case <-done:
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			ossignal.Stop(c)
+			close(done)
+		})
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package signal
+
+import (
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestHandleInterrupt(t *testing.T) {
+	exited := make(chan int, 1)
+	exit = func(code int) { exited <- code }
+	defer func() { exit = os.Exit }()
+
+	interrupted := make(chan struct{})
+	stop := HandleInterrupt(func() { close(interrupted) }, syscall.SIGUSR1)
+	defer stop()
+
+	syscall.Kill(syscall.Getpid(), syscall.SIGUSR1)
+	select {
+	case <-interrupted:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("interrupt not called on signal")
+	}
+
+	// a slow cleanup isn't cut short
+	select {
+	case code := <-exited:
+		t.Fatalf("process forced to exit with status %d after a single signal", code)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// the cleanup is stuck as the process didn't exit
+	syscall.Kill(syscall.Getpid(), syscall.SIGUSR1)
+	select {
+	case code := <-exited:
+		if code != 1 {
+			t.Errorf("unexpected exit status %d", code)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("process not forced to exit")
+	}
+
+	// stopping more than once is harmless
+	stop = HandleInterrupt(func() {}, syscall.SIGUSR2)
+	stop()
+	stop()
+}
@@ -0,0 +1,155 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package uri
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+const (
+	// Docker is the keyword for a docker ref
+	Docker = "docker"
+	// Podman is the keyword for a podman ref
+	Podman = "podman"
+
+	// defaultTag is the tag of the references without tag nor digest.
+	defaultTag = "latest"
+	// defaultLibraryNamespace is the entity and collection of the library
+	// references only naming a container.
+	defaultLibraryNamespace = "library/default/"
+)
+
+// Normalize returns the transport and the reference of the canonical form of
+// the URI raw, transport + ":" + canonicalRef being the canonical URI. It is
+// the single place references are canonicalized, normalizing a canonical URI
+// returns it unchanged:
+//   - the transport is lowercased, images without transport are library ones
+//   - library, shub, docker, oras and podman references start with // and
+//     have no trailing slashes, an implicit :latest tag is made explicit
+//     unless they are pinned by digest
+//   - library references only naming a container are in the library/default
+//     namespace, those pinned by a @sha256:<digest> are referenced by their
+//     :sha256.<digest> library hash, the host of those with one, see
+//     SplitLibraryHost, is lowercased
+//   - the host of http(s) URLs is lowercased, their path being kept as is
+//
+// The references of the other transports, e.g. local paths, are kept as is.
+//
+// Examples:
+//   alpine -> library, //library/default/alpine:latest
+//   Docker://ubuntu/ -> docker, //ubuntu:latest
+//   docker://ubuntu@sha256:45b2... -> docker, //ubuntu@sha256:45b2...
+//   HTTPS://Example.com/image.sif -> https, //example.com/image.sif
+//   oci-archive:path/to/archive -> oci-archive, path/to/archive
+func Normalize(raw string) (transport, canonicalRef string, err error) {
+	transport, ref := Split(raw)
+	if ref == "" {
+		return "", "", fmt.Errorf("no reference in %q", raw)
+	}
+
+	switch transport {
+	case "", Library:
+		host, hostless := SplitLibraryHost(raw)
+		_, ref = Split(hostless)
+		ref, err = normalizeLibrary(ref)
+		if err == nil && host != "" {
+			ref = "//" + strings.ToLower(host) + "/" + strings.TrimPrefix(ref, "//")
+		}
+		return Library, ref, err
+	case Shub, Docker, Oras, Podman:
+		ref, err = normalizeRepository(ref)
+		return transport, ref, err
+	case HTTP, HTTPS:
+		u, err := url.Parse(transport + ":" + ref)
+		if err != nil {
+			return "", "", err
+		}
+		if u.Host == "" {
+			return "", "", fmt.Errorf("no host in %q", raw)
+		}
+		u.Host = strings.ToLower(u.Host)
+		return transport, strings.TrimPrefix(u.String(), transport+":"), nil
+	}
+	return transport, ref, nil
+}
+
+// trimPath returns the path of a //path reference without its leading and
+// trailing slashes, failing if it is empty or has empty components.
+func trimPath(ref string) (string, error) {
+	path := strings.Trim(ref, "/")
+	if path == "" {
+		return "", fmt.Errorf("empty reference")
+	}
+	if strings.Contains(path, "//") {
+		return "", fmt.Errorf("empty component in reference %q", path)
+	}
+	return path, nil
+}
+
+// withDefaultTag returns path with the default tag if its last component,
+// the image, has neither tag nor digest.
+func withDefaultTag(path string) string {
+	image := path[strings.LastIndex(path, "/")+1:]
+	if strings.ContainsAny(image, ":@") {
+		return path
+	}
+	return path + ":" + defaultTag
+}
+
+// normalizeLibrary returns the canonical library reference of ref:
+// //entity/collection/container:tag or //collection/container:tag.
+func normalizeLibrary(ref string) (string, error) {
+	path, err := trimPath(ref)
+	if err != nil {
+		return "", err
+	}
+	if i := strings.LastIndex(path, "@"); i >= 0 {
+		digest := path[i+1:]
+		if !isSHA256Digest(digest) {
+			return "", fmt.Errorf("invalid digest in library reference %q, expected sha256:<64 hexadecimal characters>", path)
+		}
+		path = path[:i] + ":sha256." + strings.TrimPrefix(digest, "sha256:")
+	}
+	switch n := strings.Count(path, "/"); {
+	case n == 0:
+		path = defaultLibraryNamespace + path
+	case n > 2:
+		return "", fmt.Errorf("library reference %q has more than entity, collection and container", path)
+	}
+	if strings.HasSuffix(path, ":") {
+		return "", fmt.Errorf("empty tag in library reference %q", path)
+	}
+	return "//" + withDefaultTag(path), nil
+}
+
+// isSHA256Digest returns whether digest is sha256:<hex> of a sha256 hash.
+func isSHA256Digest(digest string) bool {
+	hex := strings.TrimPrefix(digest, "sha256:")
+	if hex == digest || len(hex) != 64 {
+		return false
+	}
+	for _, c := range hex {
+		if !strings.ContainsRune("0123456789abcdef", c) {
+			return false
+		}
+	}
+	return true
+}
+
+// normalizeRepository returns the canonical //[registry/]repository:tag or
+// //[registry/]repository@digest reference of ref.
+func normalizeRepository(ref string) (string, error) {
+	path, err := trimPath(ref)
+	if err != nil {
+		return "", err
+	}
+	if strings.HasSuffix(path, ":") || strings.HasSuffix(path, "@") {
+		return "", fmt.Errorf("empty tag or digest in reference %q", path)
+	}
+	return "//" + withDefaultTag(path), nil
+}
@@ -0,0 +1,104 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package uri
+
+import "testing"
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name      string
+		uri       string
+		transport string
+		ref       string
+		wantErr   bool
+	}{
+		// library
+		{name: "library without transport", uri: "alpine", transport: "library", ref: "//library/default/alpine:latest"},
+		{name: "library without transport with tag", uri: "alpine:3.11", transport: "library", ref: "//library/default/alpine:3.11"},
+		{name: "library container", uri: "library://alpine", transport: "library", ref: "//library/default/alpine:latest"},
+		{name: "library opaque", uri: "library:alpine", transport: "library", ref: "//library/default/alpine:latest"},
+		{name: "library empty host", uri: "library:///alpine", transport: "library", ref: "//library/default/alpine:latest"},
+		{name: "library collection", uri: "library://collection/image", transport: "library", ref: "//collection/image:latest"},
+		{name: "library full", uri: "library://sylabs/tests/image:1.0", transport: "library", ref: "//sylabs/tests/image:1.0"},
+		{name: "library with host", uri: "library://Library.Example.com/sylabs/tests/image", transport: "library", ref: "//library.example.com/sylabs/tests/image:latest"},
+		{name: "library with host and port", uri: "library://localhost:8080/alpine", transport: "library", ref: "//localhost:8080/library/default/alpine:latest"},
+		{name: "library several tags", uri: "library://sylabs/tests/image:1.0,stable", transport: "library", ref: "//sylabs/tests/image:1.0,stable"},
+		{name: "library by hash", uri: "library://sylabs/tests/image:sha256.0123abcd", transport: "library", ref: "//sylabs/tests/image:sha256.0123abcd"},
+		{name: "library digest", uri: "library://sylabs/tests/image@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef", transport: "library", ref: "//sylabs/tests/image:sha256.0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"},
+		{name: "library digest without transport", uri: "alpine@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef", transport: "library", ref: "//library/default/alpine:sha256.0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"},
+		{name: "library trailing slash", uri: "library://sylabs/tests/image/", transport: "library", ref: "//sylabs/tests/image:latest"},
+		{name: "library uppercase transport", uri: "LIBRARY://alpine", transport: "library", ref: "//library/default/alpine:latest"},
+		{name: "library file with colon", uri: "ubuntu:18.04.img", transport: "library", ref: "//library/default/ubuntu:18.04.img"},
+		{name: "library empty", uri: "library://", wantErr: true},
+		{name: "library slashes only", uri: "library:///", wantErr: true},
+		{name: "library empty component", uri: "library://sylabs//image", wantErr: true},
+		{name: "library too many components", uri: "library://a/b/c/d", wantErr: true},
+		{name: "library empty tag", uri: "library://alpine:", wantErr: true},
+		{name: "library short digest", uri: "library://alpine@sha256:0123abcd", wantErr: true},
+		{name: "library digest other algorithm", uri: "library://alpine@md5:0123abcd", wantErr: true},
+		{name: "empty", uri: "", wantErr: true},
+
+		// docker
+		{name: "docker basic", uri: "docker://ubuntu", transport: "docker", ref: "//ubuntu:latest"},
+		{name: "docker opaque", uri: "docker:ubuntu", transport: "docker", ref: "//ubuntu:latest"},
+		{name: "docker scoped", uri: "docker://godlovedc/lolcow", transport: "docker", ref: "//godlovedc/lolcow:latest"},
+		{name: "docker tag", uri: "docker://ubuntu:18.04", transport: "docker", ref: "//ubuntu:18.04"},
+		{name: "docker digest", uri: "docker://ubuntu@sha256:45b23dee08af5e43a7fea6c4cf9c25ccf269ee113168c19722f87876677c5cb2", transport: "docker", ref: "//ubuntu@sha256:45b23dee08af5e43a7fea6c4cf9c25ccf269ee113168c19722f87876677c5cb2"},
+		{name: "docker registry port", uri: "docker://localhost:5000/image", transport: "docker", ref: "//localhost:5000/image:latest"},
+		{name: "docker registry port tag", uri: "docker://localhost:5000/image:1.0", transport: "docker", ref: "//localhost:5000/image:1.0"},
+		{name: "docker trailing slash", uri: "docker://ubuntu/", transport: "docker", ref: "//ubuntu:latest"},
+		{name: "docker mixed case transport", uri: "Docker://ubuntu", transport: "docker", ref: "//ubuntu:latest"},
+		{name: "docker empty", uri: "docker://", wantErr: true},
+		{name: "docker empty tag", uri: "docker://ubuntu:", wantErr: true},
+		{name: "docker empty digest", uri: "docker://ubuntu@", wantErr: true},
+
+		// oras and shub
+		{name: "oras", uri: "oras://registry.example.com/namespace/image", transport: "oras", ref: "//registry.example.com/namespace/image:latest"},
+		{name: "oras tag", uri: "oras://registry.example.com/namespace/image:v1", transport: "oras", ref: "//registry.example.com/namespace/image:v1"},
+		{name: "shub", uri: "shub://vsoch/hello-world", transport: "shub", ref: "//vsoch/hello-world:latest"},
+		{name: "shub tag", uri: "shub://vsoch/hello-world:v1/", transport: "shub", ref: "//vsoch/hello-world:v1"},
+		{name: "shub digest", uri: "shub://vsoch/hello-world@ed9755a0871f04db3e14971bec56a33f", transport: "shub", ref: "//vsoch/hello-world@ed9755a0871f04db3e14971bec56a33f"},
+
+		{name: "podman", uri: "podman://localhost/image", transport: "podman", ref: "//localhost/image:latest"},
+		{name: "podman opaque", uri: "podman:localhost/image:1.0", transport: "podman", ref: "//localhost/image:1.0"},
+
+		// http(s)
+		{name: "https", uri: "https://example.com/image.sif", transport: "https", ref: "//example.com/image.sif"},
+		{name: "http uppercase", uri: "HTTP://Example.COM/Image.sif", transport: "http", ref: "//example.com/Image.sif"},
+		{name: "https trailing slash kept", uri: "https://example.com/images/", transport: "https", ref: "//example.com/images/"},
+		{name: "https query", uri: "https://example.com/image.sif?token=abc", transport: "https", ref: "//example.com/image.sif?token=abc"},
+		{name: "https port", uri: "https://example.com:8443/image.sif", transport: "https", ref: "//example.com:8443/image.sif"},
+		{name: "https no host", uri: "https:///image.sif", wantErr: true},
+
+		// kept as is
+		{name: "scp", uri: "scp://user@host:/path/image.sif", transport: "scp", ref: "//user@host:/path/image.sif"},
+		{name: "oci-archive", uri: "oci-archive:path/to/archive", transport: "oci-archive", ref: "path/to/archive"},
+		{name: "docker-archive", uri: "docker-archive:/path/image.tar", transport: "docker-archive", ref: "/path/image.tar"},
+		{name: "docker-daemon", uri: "docker-daemon:image:tag", transport: "docker-daemon", ref: "image:tag"},
+		{name: "unknown transport", uri: "unknown://ref", transport: "unknown", ref: "//ref"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport, ref, err := Normalize(tt.uri)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if transport != tt.transport || ref != tt.ref {
+				t.Fatalf("normalized %s as %s : %s (expected %s : %s)", tt.uri, transport, ref, tt.transport, tt.ref)
+			}
+
+			// canonical URIs are normalized to themselves
+			canonical := transport + ":" + ref
+			if tr, r, err := Normalize(canonical); err != nil || tr != transport || r != ref {
+				t.Errorf("canonical %s normalized as %s : %s (%v)", canonical, tr, r, err)
+			}
+		})
+	}
+}
@@ -7,6 +7,7 @@ package uri
 
 import (
 	"fmt"
+	"net/url"
 	"strings"
 )
 
@@ -21,6 +22,8 @@ const (
 	HTTPS = "https"
 	// Oras is the keyword for an oras ref
 	Oras = "oras"
+	// SCP is the keyword for an scp ref
+	SCP = "scp"
 )
 
 // validURIs contains a list of known uris
@@ -35,6 +38,8 @@ var validURIs = map[string]bool{
 	"http":           true,
 	"https":          true,
 	"oras":           true,
+	"scp":            true,
+	"podman":         true,
 }
 
 // IsValid returns whether or not the given source is valid
@@ -46,7 +51,7 @@ func IsValid(source string) (valid bool, err error) {
 		return false, fmt.Errorf("invalid uri %s", source)
 	}
 
-	if _, ok := validURIs[u[0]]; ok {
+	if _, ok := validURIs[strings.ToLower(u[0])]; ok {
 		return true, nil
 	}
 
@@ -56,10 +61,14 @@ func IsValid(source string) (valid bool, err error) {
 // GetName turns a transport:ref URI into a name containing the top-level identifier
 // of the image. For example, docker://godlovedc/lolcow returns lolcow
 //
-// Returns "" when not in transport:ref format
+// Returns "" when not in transport:ref format, or when the reference can't
+// be normalized.
 func GetName(uri string) string {
-	transport, ref := Split(uri)
-	if transport == "" {
+	if transport, _ := Split(uri); transport == "" {
+		return ""
+	}
+	transport, ref, err := Normalize(uri)
+	if err != nil {
 		return ""
 	}
 
@@ -71,8 +80,14 @@ func GetName(uri string) string {
 		return imageName
 	}
 
-	// Default tag is latest
-	tags := []string{"latest"}
+	if transport == SCP {
+		// the path of a relative scp://host:image.sif follows the host
+		imageName := refSplit[len(refSplit)-1]
+		return imageName[strings.LastIndex(imageName, ":")+1:]
+	}
+
+	// Default tag is latest, for the transports Normalize leaves untagged
+	tags := []string{defaultTag}
 	container := refSplit[len(refSplit)-1]
 
 	if strings.Contains(container, ":") {
@@ -87,7 +102,8 @@ func GetName(uri string) string {
 	return fmt.Sprintf("%s_%s.sif", container, tags[0])
 }
 
-// Split splits a URI into it's components which can be used directly through containers/image
+// Split splits a URI into it's components which can be used directly through containers/image,
+// the transport being lowercased. Use Normalize to get the canonical reference.
 //
 // This can be tricky if there is no type but a file name contains a colon.
 //
@@ -106,13 +122,49 @@ func Split(uri string) (transport string, ref string) {
 
 	if strings.HasPrefix(uriSplit[1], "//") {
 		// the format was ://, so try it whether or not valid URI
-		return uriSplit[0], uriSplit[1]
+		return strings.ToLower(uriSplit[0]), uriSplit[1]
 	}
 
 	if ok, err := IsValid(uri); ok && err == nil {
 		// also accept recognized URIs
-		return uriSplit[0], uriSplit[1]
+		return strings.ToLower(uriSplit[0]), uriSplit[1]
 	}
 
 	return "", uri
 }
+
+// SplitLibraryHost splits the host off the library URI raw, returning it and
+// the URI without it. The first component of the reference is a host when it
+// has a dot or a port, or is localhost, as entities and collections can't,
+// host being empty for a hostless URI, returned unchanged.
+//
+// Examples:
+//   library://example.com/user/collection/image -> example.com, library://user/collection/image
+//   library://localhost:8080/image -> localhost:8080, library://image
+//   library://user/collection/image -> "", library://user/collection/image
+func SplitLibraryHost(raw string) (host, hostless string) {
+	transport, ref := Split(raw)
+	if transport != Library || !strings.HasPrefix(ref, "//") {
+		return "", raw
+	}
+	path := strings.TrimPrefix(ref, "//")
+	i := strings.Index(path, "/")
+	if i <= 0 {
+		return "", raw
+	}
+	if host = path[:i]; !strings.ContainsAny(host, ".:") && host != "localhost" {
+		return "", raw
+	}
+	return host, Library + "://" + path[i+1:]
+}
+
+// Redact returns the URI s without the credentials of its userinfo, if any,
+// so that it can be logged or reported.
+func Redact(s string) string {
+	u, err := url.Parse(s)
+	if err != nil || u.User == nil {
+		return s
+	}
+	u.User = nil
+	return u.String()
+}
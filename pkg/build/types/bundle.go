@@ -10,7 +10,9 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	ocitypes "github.com/containers/image/v5/types"
 	"github.com/sylabs/singularity/internal/pkg/cache"
@@ -70,6 +72,38 @@ type Options struct {
 	// To warn when the above is needed, we need to know if the target of this
 	// bundle will be a sandbox
 	SandboxTarget bool
+	// NoSetuid strips setuid/setgid/sticky bits from regular files when
+	// extracting OCI content.
+	NoSetuid bool
+	// Reproducible zeroes timestamps and identifiers in the resulting
+	// image so identical input produces an identical image.
+	Reproducible bool
+	// Squash consolidates the content of OCI layers into a squashfs
+	// partition with larger blocks and packed fragments.
+	Squash bool
+	// Arch is the architecture of the OCI image to use from a manifest
+	// list, the host one if empty.
+	Arch string
+	// DockerDaemonHost is the socket docker-daemon images are read from,
+	// the Docker one if empty.
+	DockerDaemonHost string
+}
+
+// BuildTime returns the time recorded in the image. For reproducible builds
+// this is the time set by the SOURCE_DATE_EPOCH environment variable, or the
+// Unix epoch if it's unset.
+func (o Options) BuildTime() time.Time {
+	if !o.Reproducible {
+		return time.Now()
+	}
+	if epoch := os.Getenv("SOURCE_DATE_EPOCH"); epoch != "" {
+		sec, err := strconv.ParseInt(epoch, 10, 64)
+		if err == nil {
+			return time.Unix(sec, 0).UTC()
+		}
+		sylog.Warningf("Ignoring invalid SOURCE_DATE_EPOCH value %q: %s", epoch, err)
+	}
+	return time.Unix(0, 0).UTC()
 }
 
 // NewEncryptedBundle creates an Encrypted Bundle environment.
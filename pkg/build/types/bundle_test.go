@@ -134,3 +134,47 @@ func TestBundle_RunSections(t *testing.T) {
 		})
 	}
 }
+
+func TestOptions_BuildTime(t *testing.T) {
+	defer os.Unsetenv("SOURCE_DATE_EPOCH")
+
+	tt := []struct {
+		name         string
+		reproducible bool
+		epoch        string
+		expect       int64
+	}{
+		{
+			name:         "reproducible without epoch",
+			reproducible: true,
+			expect:       0,
+		},
+		{
+			name:         "reproducible with epoch",
+			reproducible: true,
+			epoch:        "1588000000",
+			expect:       1588000000,
+		},
+		{
+			name:         "reproducible with invalid epoch",
+			reproducible: true,
+			epoch:        "yesterday",
+			expect:       0,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			os.Setenv("SOURCE_DATE_EPOCH", tc.epoch)
+			o := Options{Reproducible: tc.reproducible}
+			if got := o.BuildTime().Unix(); got != tc.expect {
+				t.Errorf("unexpected build time: got %d, expected %d", got, tc.expect)
+			}
+		})
+	}
+
+	os.Setenv("SOURCE_DATE_EPOCH", "1588000000")
+	if got := (Options{}).BuildTime().Unix(); got == 1588000000 {
+		t.Errorf("SOURCE_DATE_EPOCH used for a non reproducible build")
+	}
+}
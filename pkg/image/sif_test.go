@@ -122,6 +122,23 @@ func TestSIFInitializer(t *testing.T) {
 	}
 	primPart.Extra.WriteString(sif.GetSIFArch(runtime.GOARCH))
 
+	foreignArch := "s390x"
+	if runtime.GOARCH == foreignArch {
+		foreignArch = "amd64"
+	}
+	primPartForeignArch := sif.DescriptorInput{
+		Datatype: sif.DataPartition,
+		Groupid:  sif.DescrDefaultGroup,
+		Link:     sif.DescrUnusedLink,
+		Fname:    "primPart",
+		Fp:       fp1,
+		Extra: *bytes.NewBuffer([]byte{
+			0x01, 0x00, 0x00, 0x00, // fstype
+			0x02, 0x00, 0x00, 0x00, // part type
+		}),
+	}
+	primPartForeignArch.Extra.WriteString(sif.GetSIFArch(foreignArch))
+
 	overlayPart := sif.DescriptorInput{
 		Datatype: sif.DataPartition,
 		Groupid:  sif.DescrDefaultGroup,
@@ -174,6 +191,14 @@ func TestSIFInitializer(t *testing.T) {
 			expectedPartitions: 1,
 			expectedSections:   0,
 		},
+		{
+			name:               "PrimaryPartitionForeignArchSIF",
+			path:               createSIF(t, []sif.DescriptorInput{primPartForeignArch}, false),
+			writable:           false,
+			expectedSuccess:    false,
+			expectedPartitions: 0,
+			expectedSections:   0,
+		},
 		{
 			name:               "PrimaryPartitionCorruptedSIF",
 			path:               createSIF(t, []sif.DescriptorInput{primPart}, true),
@@ -0,0 +1,83 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package pull
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+
+	"github.com/sylabs/singularity/internal/pkg/client/oci"
+	"github.com/sylabs/singularity/internal/pkg/util/machine"
+	"github.com/sylabs/singularity/internal/pkg/util/uri"
+	"github.com/sylabs/singularity/pkg/signing"
+)
+
+// ArchMismatchError is the error of a library or OCI image pulled for an
+// architecture the host can run, whose system partitions it can't run.
+type ArchMismatchError struct {
+	// From is the URI of the image.
+	From string
+	// Arch is the architecture the image was pulled for.
+	Arch string
+	// ImageArchs are the architectures of its system partitions.
+	ImageArchs []string
+}
+
+func (e *ArchMismatchError) Error() string {
+	return fmt.Sprintf("%s was pulled for %s but is an image for %s, which can't run on the host (%s)",
+		e.From, e.Arch, strings.Join(e.ImageArchs, ", "), runtime.GOARCH)
+}
+
+// assertArch checks that the SIF image opts.From pulled to path holds a
+// system partition for opts.ExpectedArch, whatever the architecture it was
+// selected for, so that a mislabeled image isn't silently accepted.
+func assertArch(opts Options, path string) error {
+	if opts.ExpectedArch == "" {
+		return nil
+	}
+	archs, err := signing.Architectures(path)
+	if err != nil {
+		return fmt.Errorf("could not read the architecture of %s: %v", opts.From, err)
+	}
+	for _, a := range archs {
+		if a == opts.ExpectedArch {
+			return nil
+		}
+	}
+	if len(archs) == 0 {
+		return fmt.Errorf("%s holds no system partition, expected one for %s", opts.From, opts.ExpectedArch)
+	}
+	return fmt.Errorf("%s is an image for %s, not for the expected %s", opts.From, strings.Join(archs, ", "), opts.ExpectedArch)
+}
+
+// checkHostArch checks that the library or OCI image opts.From pulled to
+// path for arch, an architecture the host can run, records a system
+// partition that the host can run, so that a mislabeled image fails at pull
+// time rather than with an exec format error once run. The images of the
+// other transports, not selected by architecture, aren't checked.
+func checkHostArch(opts Options, path, arch string) error {
+	transport, _ := uri.Split(opts.From)
+	if transport != uri.Library && transport != "" && oci.IsSupported(transport) == "" {
+		return nil
+	}
+	if opts.AllowArchMismatch || !machine.CompatibleWith(arch) {
+		return nil
+	}
+	archs, err := signing.Architectures(path)
+	if err != nil {
+		return fmt.Errorf("could not read the architecture of %s: %v", opts.From, err)
+	}
+	if len(archs) == 0 {
+		return nil
+	}
+	for _, a := range archs {
+		if machine.CompatibleWith(a) {
+			return nil
+		}
+	}
+	return &ArchMismatchError{From: opts.From, Arch: arch, ImageArchs: archs}
+}
@@ -0,0 +1,111 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package pull
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/sylabs/sif/pkg/sif"
+)
+
+// writeArchImage writes to path a SIF image whose system partition is for
+// arch.
+func writeArchImage(t *testing.T, path, arch string) {
+	input := sif.DescriptorInput{Datatype: sif.DataPartition, Groupid: sif.DescrGroupMask | 1, Fname: "rootfs", Data: []byte(arch + " rootfs")}
+	if err := input.SetPartExtra(sif.FsSquash, sif.PartPrimSys, sif.GetSIFArch(arch)); err != nil {
+		t.Fatal(err)
+	}
+	input.Size = int64(len(input.Data))
+	input.Fp = bytes.NewReader(input.Data)
+	fimg, err := sif.CreateContainer(sif.CreateInfo{
+		Pathname:   path,
+		Launchstr:  sif.HdrLaunch,
+		Sifversion: sif.HdrVersion,
+		ID:         uuid.NewV4(),
+		InputDescr: []sif.DescriptorInput{input},
+	})
+	if err != nil {
+		t.Fatalf("could not create image: %v", err)
+	}
+	fimg.UnloadContainer()
+}
+
+func TestAssertArch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pull-arch-")
+	if err != nil {
+		t.Fatalf("could not create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// an arm64 image, e.g. labelled amd64 in the library
+	path := filepath.Join(dir, "image.sif")
+	writeArchImage(t, path, "arm64")
+
+	tests := []struct {
+		arch string
+		err  string
+	}{
+		{arch: ""},
+		{arch: "arm64"},
+		{arch: "ppc64le", err: "library://alpine is an image for arm64, not for the expected ppc64le"},
+	}
+	for _, tt := range tests {
+		err := assertArch(Options{From: "library://alpine", ExpectedArch: tt.arch}, path)
+		if tt.err == "" && err != nil {
+			t.Errorf("unexpected error for expected arch %s: %v", tt.arch, err)
+		} else if tt.err != "" && (err == nil || err.Error() != tt.err) {
+			t.Errorf("unexpected error %v for expected arch %s, expected %q", err, tt.arch, tt.err)
+		}
+	}
+}
+
+func TestCheckHostArch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pull-arch-")
+	if err != nil {
+		t.Fatalf("could not create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// an image the host can't run, e.g. labelled for the host in the library
+	foreign := "s390x"
+	if runtime.GOARCH == foreign {
+		foreign = "amd64"
+	}
+	path := filepath.Join(dir, "image.sif")
+	writeArchImage(t, path, foreign)
+
+	tests := []struct {
+		name    string
+		from    string
+		arch    string
+		allow   bool
+		wantErr bool
+	}{
+		{name: "Library", from: "library://alpine", arch: runtime.GOARCH, wantErr: true},
+		{name: "OCI", from: "docker://alpine", arch: runtime.GOARCH, wantErr: true},
+		{name: "Allowed", from: "library://alpine", arch: runtime.GOARCH, allow: true},
+		{name: "ForeignPull", from: "library://alpine", arch: foreign},
+		{name: "HTTPS", from: "https://example.com/alpine.sif", arch: runtime.GOARCH},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkHostArch(Options{From: tt.from, AllowArchMismatch: tt.allow}, path, tt.arch)
+			var archErr *ArchMismatchError
+			if tt.wantErr && !errors.As(err, &archErr) {
+				t.Errorf("unexpected error %v, expected an architecture mismatch", err)
+			} else if !tt.wantErr && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
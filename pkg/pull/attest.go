@@ -0,0 +1,115 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package pull
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/sylabs/singularity/internal/pkg/util/uri"
+	"github.com/sylabs/singularity/pkg/sylog"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/clearsign"
+)
+
+// Attestation records the verification of a pulled image, written to
+// Options.AttestationOut.
+type Attestation struct {
+	URI       string    `json:"uri"`
+	Path      string    `json:"path"`
+	Arch      string    `json:"arch"`
+	SHA256    string    `json:"sha256"`
+	Signers   []string  `json:"signers"`
+	Keyserver string    `json:"keyserver"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// checkAttestation checks that the attestation of opts is written for a
+// SIF image saved to a destination with its signatures kept.
+func checkAttestation(opts Options) error {
+	if opts.AttestationOut == "" {
+		if opts.AttestationKey != nil {
+			return fmt.Errorf("an attestation key requires an attestation file")
+		}
+		return nil
+	}
+
+	switch {
+	case opts.To == "":
+		return fmt.Errorf("an attestation requires an image pulled to a destination")
+	case opts.StripSignatures:
+		return fmt.Errorf("an attestation can't be written for an image whose signatures are removed")
+	case opts.Group != 0:
+		return fmt.Errorf("an attestation can't be written for an extracted group")
+	case opts.Format != "" && opts.Format != FormatSIF:
+		return fmt.Errorf("an attestation can't be written for an image saved as %s", opts.Format)
+	}
+	return nil
+}
+
+// attest verifies the signatures of the image opts.From pulled to opts.To
+// for arch and writes its attestation to opts.AttestationOut, clearsigned
+// with opts.AttestationKey if not nil. An image without verified signatures
+// fails.
+func attest(ctx context.Context, opts Options, arch string) error {
+	signers, err := newVerification(opts, opts.To, arch, nil).signers(ctx)
+	if err != nil {
+		return err
+	}
+	hash, err := FileSHA256(opts.To)
+	if err != nil {
+		return fmt.Errorf("could not hash %s: %v", opts.To, err)
+	}
+
+	a := Attestation{
+		URI:       uri.Redact(opts.From),
+		Path:      opts.To,
+		Arch:      arch,
+		SHA256:    hash,
+		Signers:   signers,
+		Keyserver: opts.keyServer(),
+		Timestamp: time.Now().UTC(),
+	}
+	b, err := encodeAttestation(a, opts.AttestationKey)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(opts.AttestationOut, b, 0644); err != nil {
+		return err
+	}
+	sylog.Infof("Attestation written to %s", opts.AttestationOut)
+	return nil
+}
+
+// encodeAttestation returns the attestation a in JSON format, clearsigned
+// with entity if not nil.
+func encodeAttestation(a Attestation, entity *openpgp.Entity) ([]byte, error) {
+	b, err := json.MarshalIndent(a, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	b = append(b, '\n')
+	if entity == nil {
+		return b, nil
+	}
+
+	var signed bytes.Buffer
+	plaintext, err := clearsign.Encode(&signed, entity.PrivateKey, nil)
+	if err != nil {
+		return nil, fmt.Errorf("could not build a signature block: %v", err)
+	}
+	if _, err := plaintext.Write(b); err != nil {
+		return nil, fmt.Errorf("failed writing attestation to signature block: %v", err)
+	}
+	if err := plaintext.Close(); err != nil {
+		return nil, fmt.Errorf("I/O error while wrapping up signature block: %v", err)
+	}
+	return signed.Bytes(), nil
+}
@@ -0,0 +1,83 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package pull
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/clearsign"
+)
+
+func TestEncodeAttestation(t *testing.T) {
+	a := Attestation{
+		URI:       "library://library/default/alpine:latest",
+		Path:      "alpine_latest.sif",
+		Arch:      "amd64",
+		SHA256:    "sha256:6105d6cc76af400325e94d588ce511be5bfdbb73b437dc51eca43917d7a43e3d",
+		Signers:   []string{"8883491F4268F173C6E5DC49446946928C851A55"},
+		Keyserver: "https://keys.sylabs.io",
+		Timestamp: time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC),
+	}
+
+	b, err := encodeAttestation(a, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var got Attestation
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("could not decode attestation: %v", err)
+	}
+	if !reflect.DeepEqual(got, a) {
+		t.Errorf("got attestation %+v, want %+v", got, a)
+	}
+
+	entity, err := openpgp.NewEntity("test", "", "test@example.com", nil)
+	if err != nil {
+		t.Fatalf("could not create key: %v", err)
+	}
+	signed, err := encodeAttestation(a, entity)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	block, _ := clearsign.Decode(signed)
+	if block == nil {
+		t.Fatalf("no signature block in:\n%s", signed)
+	}
+	if !bytes.Equal(bytes.TrimSpace(block.Plaintext), bytes.TrimSpace(b)) {
+		t.Errorf("unexpected signed attestation:\n%s", block.Plaintext)
+	}
+	if _, err := openpgp.CheckDetachedSignature(openpgp.EntityList{entity}, bytes.NewReader(block.Bytes), block.ArmoredSignature.Body); err != nil {
+		t.Errorf("could not verify signature: %v", err)
+	}
+}
+
+func TestCheckAttestation(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    Options
+		wantErr bool
+	}{
+		{name: "None", opts: Options{To: "image.sif"}},
+		{name: "Attestation", opts: Options{To: "image.sif", AttestationOut: "attestation.json"}},
+		{name: "KeyWithoutOut", opts: Options{To: "image.sif", AttestationKey: &openpgp.Entity{}}, wantErr: true},
+		{name: "Cache", opts: Options{AttestationOut: "attestation.json"}, wantErr: true},
+		{name: "Sandbox", opts: Options{To: "image", Format: FormatSandbox, AttestationOut: "attestation.json"}, wantErr: true},
+		{name: "StripSignatures", opts: Options{To: "image.sif", StripSignatures: true, AttestationOut: "attestation.json"}, wantErr: true},
+		{name: "Group", opts: Options{To: "image.sif", Group: 1, AttestationOut: "attestation.json"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkAttestation(tt.opts); (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
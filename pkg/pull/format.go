@@ -0,0 +1,117 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package pull
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/sylabs/singularity/internal/pkg/build"
+	"github.com/sylabs/singularity/internal/pkg/cache"
+	"github.com/sylabs/singularity/internal/pkg/util/fs"
+	buildtypes "github.com/sylabs/singularity/pkg/build/types"
+	"github.com/sylabs/singularity/pkg/sylog"
+)
+
+// The formats the pulled images are saved in.
+const (
+	// FormatSIF saves the SIF image as pulled.
+	FormatSIF = "sif"
+	// FormatSandbox saves a directory holding the root filesystem.
+	FormatSandbox = "sandbox"
+	// FormatTar saves a tarball of the root filesystem.
+	FormatTar = "tar"
+)
+
+// converter pulls images in SIF format to a temporary directory next to
+// their destination, from which convert saves them in another format.
+type converter struct {
+	dir string
+}
+
+// newConverter creates the temporary directory of the conversion of the
+// image pulled to to.
+func newConverter(to string) (*converter, error) {
+	dir, err := ioutil.TempDir(filepath.Dir(to), ".pull-convert-")
+	if err != nil {
+		return nil, fmt.Errorf("could not create conversion directory: %v", err)
+	}
+	return &converter{dir: dir}, nil
+}
+
+// sifPath returns the path the SIF image is pulled to.
+func (c *converter) sifPath() string {
+	return filepath.Join(c.dir, "image.sif")
+}
+
+// Remove removes the temporary directory and what it holds.
+func (c *converter) Remove() {
+	if err := os.RemoveAll(c.dir); err != nil {
+		sylog.Warningf("Could not remove %s: %v", c.dir, err)
+	}
+}
+
+// convert saves the pulled SIF image to opts.To in opts.Format, through
+// imgCache. The image is extracted in the temporary directory, and only
+// moved to opts.To once complete, replacing what opts.To holds.
+func (c *converter) convert(ctx context.Context, imgCache *cache.Handle, opts Options) error {
+	sandbox := filepath.Join(c.dir, "sandbox")
+	sylog.Infof("Extracting %s image to %s", opts.Format, opts.To)
+
+	def, err := buildtypes.NewDefinitionFromURI("localimage://" + c.sifPath())
+	if err != nil {
+		return fmt.Errorf("unable to create definition: %v", err)
+	}
+	b, err := build.New([]buildtypes.Definition{def}, build.Config{
+		Dest:      sandbox,
+		Format:    FormatSandbox,
+		NoCleanUp: opts.OCI.NoCleanUp,
+		Opts: buildtypes.Options{
+			ImgCache: imgCache,
+			NoCache:  imgCache.IsDisabled(),
+			NoTest:   true,
+			TmpDir:   opts.TmpDir,
+		},
+		// an interrupted build exits instead of returning
+		OnInterrupt: c.Remove,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to create new build: %v", err)
+	}
+	if err := b.Full(ctx); err != nil {
+		return fmt.Errorf("while extracting image: %v", err)
+	}
+
+	result := sandbox
+	if opts.Format == FormatTar {
+		result = filepath.Join(c.dir, "image.tar")
+		if err := writeTarFile(ctx, sandbox, result); err != nil {
+			return fmt.Errorf("while writing tarball: %v", err)
+		}
+	}
+
+	// a directory can't be renamed over
+	if err := os.RemoveAll(opts.To); err != nil {
+		return fmt.Errorf("could not replace %s: %v", opts.To, err)
+	}
+	return os.Rename(result, opts.To)
+}
+
+// writeTarFile writes the directory dir as a tarball to path.
+func writeTarFile(ctx context.Context, dir, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := fs.WriteTar(ctx, dir, f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,191 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package policy implements the content trust policies enforced when
+// pulling images. A policy is a list of rules, each applying to the image
+// URIs starting with its prefix.
+package policy
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/sylabs/singularity/internal/pkg/util/uri"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Rule is the policy applied to the images whose URI starts with Prefix.
+type Rule struct {
+	// Prefix is matched against the image URI, library images
+	// without transport are matched as library:// URIs.
+	Prefix string `yaml:"prefix"`
+	// Verify when true; the image signatures must be verified.
+	Verify bool `yaml:"verify"`
+	// Keys are the fingerprints, or 16 characters key IDs, of the
+	// signers trusted for the image, any signer is trusted if empty.
+	Keys []string `yaml:"keys,omitempty"`
+	// Keyserver is the key server used to verify the image instead
+	// of the default one, or a comma separated list of key servers.
+	Keyserver string `yaml:"keyserver,omitempty"`
+}
+
+// Policy is a set of rules, the one with the longest matching prefix
+// applies to an image.
+type Policy struct {
+	Rules []Rule `yaml:"rules"`
+
+	path string
+}
+
+// Load reads the policy from the YAML or JSON file at path.
+func Load(path string) (*Policy, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open policy: %v", err)
+	}
+	defer f.Close()
+
+	p, err := ReadFrom(f)
+	if err != nil {
+		return nil, fmt.Errorf("invalid policy %s: %v", path, err)
+	}
+	p.path = path
+	return p, nil
+}
+
+// ReadFrom reads a policy in YAML or JSON format from r.
+func ReadFrom(r io.Reader) (*Policy, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	p := new(Policy)
+	// JSON being a subset of YAML, both are decoded the same way
+	if err := yaml.UnmarshalStrict(b, p); err != nil {
+		return nil, err
+	}
+
+	prefixes := make(map[string]bool)
+	for i := range p.Rules {
+		r := &p.Rules[i]
+		if r.Prefix == "" {
+			return nil, fmt.Errorf("rule %d has no prefix", i+1)
+		}
+		if prefixes[r.Prefix] {
+			return nil, fmt.Errorf("prefix %q is used by several rules", r.Prefix)
+		}
+		prefixes[r.Prefix] = true
+
+		if len(r.Keys) > 0 && !r.Verify {
+			return nil, fmt.Errorf("rule %q lists trusted keys without requiring verification", r.Prefix)
+		}
+		for j, k := range r.Keys {
+			k = normalizeKey(k)
+			if !isKey(k) {
+				return nil, fmt.Errorf("rule %q: %q is neither a fingerprint nor a 16 characters key ID", r.Prefix, r.Keys[j])
+			}
+			r.Keys[j] = k
+		}
+	}
+	return p, nil
+}
+
+// Match returns the rule applying to the image ref, or nil if there is
+// none. Prefixes are matched against ref and its canonical form, so that
+// library://alpine and library://library/default/alpine:latest match the
+// same rules.
+func (p *Policy) Match(ref string) *Rule {
+	if t, _ := uri.Split(ref); t == "" {
+		ref = uri.Library + "://" + ref
+	}
+	refs := []string{ref}
+	if t, r, err := uri.Normalize(ref); err == nil && t+":"+r != ref {
+		refs = append(refs, t+":"+r)
+	}
+
+	var match *Rule
+	for i, r := range p.Rules {
+		if !hasAnyPrefix(refs, r.Prefix) {
+			continue
+		}
+		if match == nil || len(r.Prefix) > len(match.Prefix) {
+			match = &p.Rules[i]
+		}
+	}
+	return match
+}
+
+// Errorf returns an error citing the policy and the rule r violated.
+func (p *Policy) Errorf(r *Rule, format string, a ...interface{}) error {
+	src := p.path
+	if src == "" {
+		src = "policy"
+	}
+	return fmt.Errorf("policy violation: %s (rule %q of %s)", fmt.Sprintf(format, a...), r.Prefix, src)
+}
+
+// Trusts returns if one of the signers, identified by their fingerprint, is
+// trusted by the rule.
+func (r *Rule) Trusts(signers []string) bool {
+	if len(r.Keys) == 0 {
+		return len(signers) > 0
+	}
+	for _, s := range signers {
+		s = normalizeKey(s)
+		for _, k := range r.Keys {
+			if strings.HasSuffix(s, k) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ParseFingerprints returns the key fingerprints fps normalized, an error
+// is returned if one isn't a 40 characters fingerprint.
+func ParseFingerprints(fps []string) ([]string, error) {
+	keys := make([]string, 0, len(fps))
+	for _, fp := range fps {
+		k := normalizeKey(fp)
+		if len(k) != 40 || !isKey(k) {
+			return nil, fmt.Errorf("%q is not a 40 characters key fingerprint", fp)
+		}
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+// normalizeKey returns the key k in upper case, without spaces nor 0x prefix.
+func normalizeKey(k string) string {
+	k = strings.ToUpper(strings.Replace(k, " ", "", -1))
+	return strings.TrimPrefix(k, "0X")
+}
+
+// isKey returns if k is a fingerprint or a long key ID.
+func isKey(k string) bool {
+	if len(k) != 40 && len(k) != 16 {
+		return false
+	}
+	for _, c := range k {
+		if (c < '0' || c > '9') && (c < 'A' || c > 'F') {
+			return false
+		}
+	}
+	return true
+}
+
+// hasAnyPrefix returns whether one of refs starts with prefix.
+func hasAnyPrefix(refs []string, prefix string) bool {
+	for _, ref := range refs {
+		if strings.HasPrefix(ref, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,128 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package policy
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testPolicy = `
+rules:
+  - prefix: library://
+    verify: true
+  - prefix: library://sylabs/
+    verify: true
+    keys:
+      - 8883 491F 4268 F173 C6E5  DC49 4469 4692 8C85 1A55
+    keyserver: https://keys.example.com
+  - prefix: docker://
+    verify: false
+  - prefix: library://library/default/
+    verify: false
+`
+
+func TestReadFrom(t *testing.T) {
+	p, err := ReadFrom(strings.NewReader(testPolicy))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if k := p.Rules[1].Keys[0]; k != "8883491F4268F173C6E5DC49446946928C851A55" {
+		t.Errorf("unexpected normalized key %q", k)
+	}
+
+	// the same policy in JSON format
+	json := `{"rules": [{"prefix": "oras://", "verify": true, "keys": ["0x44694692 8C851A55"]}]}`
+	p, err = ReadFrom(strings.NewReader(json))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(p.Rules) != 1 || p.Rules[0].Keys[0] != "446946928C851A55" {
+		t.Errorf("unexpected rules %+v", p.Rules)
+	}
+
+	invalid := []string{
+		"rules:\n  - verify: true\n",
+		"rules:\n  - prefix: a\n  - prefix: a\n",
+		"rules:\n  - prefix: a\n    keys: [446946928C851A55]\n",
+		"rules:\n  - prefix: a\n    verify: true\n    keys: [1234]\n",
+		"rules:\n  - prefix: a\n    unknown: true\n",
+	}
+	for _, s := range invalid {
+		if _, err := ReadFrom(strings.NewReader(s)); err == nil {
+			t.Errorf("unexpected success for %q", s)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	p, err := ReadFrom(strings.NewReader(testPolicy))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	tests := []struct {
+		ref    string
+		prefix string
+	}{
+		{"library://alpine", "library://library/default/"},
+		{"alpine:latest", "library://library/default/"},
+		{"library://library/default/alpine:latest", "library://library/default/"},
+		{"library://collection/image", "library://"},
+		{"library://sylabs/tests/busybox", "library://sylabs/"},
+		{"sylabs/tests/busybox", "library://sylabs/"},
+		{"docker://alpine", "docker://"},
+		{"shub://vsoch/singularity-images", ""},
+	}
+	for _, tt := range tests {
+		r := p.Match(tt.ref)
+		if tt.prefix == "" {
+			if r != nil {
+				t.Errorf("%s: unexpected rule %q", tt.ref, r.Prefix)
+			}
+			continue
+		}
+		if r == nil || r.Prefix != tt.prefix {
+			t.Errorf("%s: unexpected rule %+v, expected prefix %q", tt.ref, r, tt.prefix)
+		}
+	}
+}
+
+func TestTrusts(t *testing.T) {
+	anySigner := Rule{Prefix: "library://", Verify: true}
+	if anySigner.Trusts(nil) {
+		t.Errorf("unsigned image trusted")
+	}
+	if !anySigner.Trusts([]string{"8883491F4268F173C6E5DC49446946928C851A55"}) {
+		t.Errorf("signed image not trusted")
+	}
+
+	keys := Rule{Prefix: "library://", Verify: true, Keys: []string{"446946928C851A55"}}
+	if !keys.Trusts([]string{"0000000000000000000000000000000000000000", "8883491F4268F173C6E5DC49446946928C851A55"}) {
+		t.Errorf("trusted signer not found")
+	}
+	if keys.Trusts([]string{"0000000000000000000000000000000000000000"}) {
+		t.Errorf("untrusted signer accepted")
+	}
+}
+
+func TestParseFingerprints(t *testing.T) {
+	keys, err := ParseFingerprints([]string{"8883 491f 4268 f173 c6e5 dc49 4469 4692 8c85 1a55", "0x0000000000000000000000000000000000000001"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []string{"8883491F4268F173C6E5DC49446946928C851A55", "0000000000000000000000000000000000000001"}
+	if !reflect.DeepEqual(keys, expected) {
+		t.Errorf("expected %v, got %v", expected, keys)
+	}
+
+	for _, fp := range []string{"446946928C851A55", "8883491F4268F173C6E5DC49446946928C851A5Z", ""} {
+		if _, err := ParseFingerprints([]string{fp}); err == nil {
+			t.Errorf("invalid fingerprint %q accepted", fp)
+		}
+	}
+}
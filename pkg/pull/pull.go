@@ -0,0 +1,757 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package pull pulls SIF images from the transports of the pull command,
+// for the programs embedding it rather than running singularity pull. The
+// pulled images go through the checks of the pull command set in the
+// options of the pull, its scanner, signature requirements and policy,
+// before being saved in their format. The network settings of each pull
+// are those of its options, the concurrent pulls of a program not sharing
+// any.
+package pull
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	ocitypes "github.com/containers/image/v5/types"
+	scs "github.com/sylabs/scs-library-client/client"
+	"github.com/sylabs/sif/pkg/sif"
+	"github.com/sylabs/singularity/internal/pkg/buildcfg"
+	"github.com/sylabs/singularity/internal/pkg/cache"
+	singularityclient "github.com/sylabs/singularity/internal/pkg/client"
+	"github.com/sylabs/singularity/internal/pkg/client/library"
+	"github.com/sylabs/singularity/internal/pkg/client/net"
+	"github.com/sylabs/singularity/internal/pkg/client/oci"
+	"github.com/sylabs/singularity/internal/pkg/client/oras"
+	"github.com/sylabs/singularity/internal/pkg/client/scp"
+	"github.com/sylabs/singularity/internal/pkg/client/shub"
+	"github.com/sylabs/singularity/internal/pkg/util/sifedit"
+	"github.com/sylabs/singularity/internal/pkg/util/uri"
+	buildtypes "github.com/sylabs/singularity/pkg/build/types"
+	"github.com/sylabs/singularity/pkg/pull/policy"
+	"github.com/sylabs/singularity/pkg/signing"
+	"github.com/sylabs/singularity/pkg/sylog"
+	useragent "github.com/sylabs/singularity/pkg/util/user-agent"
+	"golang.org/x/crypto/openpgp"
+)
+
+const (
+	// DefaultLibraryURL is the library images are pulled from when
+	// Options.Library is nil.
+	DefaultLibraryURL = "https://library.sylabs.io"
+	// DefaultKeyServerURL is the key server the signatures of library
+	// images are verified against when Options.KeyServerURL is empty.
+	DefaultKeyServerURL = "https://keys.sylabs.io"
+)
+
+// Options are the options of a pull.
+type Options struct {
+	// From is the URI of the image, a library one if it has no transport.
+	From string
+	// To is the path the image is pulled to, the image only being pulled
+	// to the cache if empty.
+	To string
+	// Format is the format the image is saved in, FormatSIF if empty.
+	Format string
+	// Arch is the architecture of library images, the host one if empty.
+	Arch string
+	// CacheDir is the parent directory of the cache Pull opens, the
+	// default one if empty.
+	CacheDir string
+	// DisableCache pulls without caching the images.
+	DisableCache bool
+	// ReadOnlyCache only pulls the images from the cache, without caching
+	// those missing from it, e.g. when it is a shared read-only mount.
+	ReadOnlyCache bool
+	// PreserveCacheOnError keeps the partial files of the cache entries
+	// that failed to be created, for inspection.
+	PreserveCacheOnError bool
+	// TmpDir is the directory of the temporary files, the default one if
+	// empty.
+	TmpDir string
+	// Library is the configuration of the library client, the
+	// DefaultLibraryURL with no token if nil.
+	Library *scs.Config
+	// KeyServerURL is the key server the signatures of library images are
+	// verified against, DefaultKeyServerURL if empty.
+	KeyServerURL string
+	// NoVerify skips the verification of the signatures of library images.
+	NoVerify bool
+	// RequireSignature fails unless the signatures of the image are
+	// verified, whatever its transport.
+	RequireSignature bool
+	// FailOnUnsigned fails with an UnsignedError unless the signatures of
+	// the image are verified, without the policy overriding it.
+	FailOnUnsigned bool
+	// AllowUnauthenticated is whether unsigned images are allowed, only
+	// for the warnings of the policy overriding it.
+	AllowUnauthenticated bool
+	// Policy is the content trust policy the image is checked against, if
+	// not nil.
+	Policy *policy.Policy
+	// Fingerprints are the keys one of which must have signed the image,
+	// not checked if empty.
+	Fingerprints []string
+	// RekorURL is the transparency log the signature of the image must be
+	// recorded in, not checked if empty.
+	RekorURL string
+	// Scanner scans the pulled image, removed unless clean, if not nil.
+	Scanner *Scanner
+	// ExpectedArch is the architecture the image must hold a system
+	// partition for, not checked if empty.
+	ExpectedArch string
+	// AllowArchMismatch keeps the library and OCI images pulled for the
+	// host whose system partitions can't run on it.
+	AllowArchMismatch bool
+	// StripSignatures removes the signatures of library images once
+	// verified.
+	StripSignatures bool
+	// Group is the descriptor group extracted from the image once
+	// verified, the whole image being kept if zero.
+	Group uint32
+	// AttestationOut is the file the attestation of the verified image is
+	// written to, if set, clearsigned with AttestationKey if not nil.
+	AttestationOut string
+	AttestationKey *openpgp.Entity
+	// Digest is the expected hash of the image, in the sha256:<hex> form,
+	// not checked if empty.
+	Digest string
+	// NoHTTPS pulls the shub, oras and OCI images over http.
+	NoHTTPS bool
+	// NoDecompress keeps the compressed http(s) images as downloaded.
+	NoDecompress bool
+	// DockerAuthConfig authenticates the oras and OCI pulls.
+	DockerAuthConfig *ocitypes.DockerAuthConfig
+	// Identity is the private key file the scp pulls authenticate with,
+	// in addition to the keys of the SSH agent.
+	Identity string
+	// OCI are the options OCI images are built with, their TmpDir, NoHTTPS
+	// and DockerAuthConfig being those above.
+	OCI buildtypes.Options
+
+	// UserAgent is the User-Agent of the requests, the one of this version
+	// of Singularity if empty.
+	UserAgent string
+	// Retries is the number of times a download failing with a transient
+	// error is retried, waiting RetryDelay before the first retry and
+	// doubling it after each one, the retries being immediate if zero.
+	Retries    int
+	RetryDelay time.Duration
+	// ConnectTimeout is the time allowed to establish a connection, not
+	// limited but by the context if zero.
+	ConnectTimeout time.Duration
+	// SOCKS5Proxy is the SOCKS5 proxy the connections go through, those of
+	// the docker and docker-archive pulls excepted, the HTTP proxies of the
+	// environment being used if nil.
+	SOCKS5Proxy *url.URL
+	// StreamCount is the number of concurrent byte ranges the library
+	// images are downloaded in, library.DefaultStreamCount if zero.
+	StreamCount int
+}
+
+// settings returns the network settings of the requests of the pull.
+func (opts Options) settings() singularityclient.Settings {
+	userAgent := opts.UserAgent
+	if userAgent == "" {
+		userAgent = useragent.New(buildcfg.PACKAGE_NAME, buildcfg.PACKAGE_VERSION)
+	}
+	return singularityclient.Settings{
+		UserAgent:      userAgent,
+		Retries:        opts.Retries,
+		RetryDelay:     opts.RetryDelay,
+		ConnectTimeout: opts.ConnectTimeout,
+		SOCKS5Proxy:    opts.SOCKS5Proxy,
+		StreamCount:    opts.StreamCount,
+	}
+}
+
+// Result is the result of a successful pull.
+type Result struct {
+	// Path is the path of the pulled image, its cache entry when only
+	// pulled to the cache.
+	Path string
+	// Transport is the transport the image was pulled with.
+	Transport string
+	// Unsigned is whether the signatures of the library image could not
+	// be verified, the image being pulled anyway.
+	Unsigned bool
+	// Signature is the signature status of the image.
+	Signature SignatureStatus
+	// Signers are the keys of the signers of a verified image.
+	Signers []signing.KeyEntity
+	// Arch is the architecture of the SIF image, empty if unknown.
+	Arch string
+	// Hash is the hash of the SIF image, in the sha256:<hex> form, empty
+	// if unknown.
+	Hash string
+	// Size is the size of the SIF image in bytes.
+	Size int64
+	// Cache is how the cache was used by the pull.
+	Cache CacheUse
+}
+
+// CacheUse is how the cache was used by a pull.
+type CacheUse int
+
+const (
+	// NotCached is the use of the cache by the transports which don't
+	// cache the images.
+	NotCached CacheUse = iota
+	// CacheDisabled is the use of the cache by the pulls with the cache
+	// disabled.
+	CacheDisabled
+	// CacheHit is the use of the cache by the pulls of a cached image.
+	CacheHit
+	// CacheMiss is the use of the cache by the pulls of an image missing
+	// from it.
+	CacheMiss
+)
+
+func (u CacheUse) String() string {
+	switch u {
+	case CacheDisabled:
+		return "cache disabled"
+	case CacheHit:
+		return "cache hit"
+	case CacheMiss:
+		return "cache miss"
+	}
+	return "not cached"
+}
+
+// cacheUse returns how the cache imgCache was used, from the accesses of
+// its tracked handle.
+func cacheUse(imgCache *cache.Handle, accesses *cache.Accesses) CacheUse {
+	switch {
+	case imgCache.IsDisabled():
+		return CacheDisabled
+	case accesses.Misses() > 0:
+		return CacheMiss
+	case accesses.Hits() > 0:
+		return CacheHit
+	}
+	return NotCached
+}
+
+// Pull pulls the image opts.From to opts.To through the cache at
+// opts.CacheDir, or only to the cache if opts.To is empty. The pulled image
+// is removed unless it passes the checks of opts, and is then saved in
+// opts.Format. The pull stops as soon as ctx is done, leaving no partial
+// image at opts.To. The concurrent pulls of an image sharing the cache wait
+// for one of them to populate it, but not for its checks. The result tells
+// how the cache was used even when the pull fails.
+func Pull(ctx context.Context, opts Options) (res Result, err error) {
+	transport, ref, err := uri.Normalize(opts.From)
+	if err != nil {
+		return Result{}, fmt.Errorf("bad URI %s: %w", opts.From, err)
+	}
+	opts.From = transport + ":" + ref
+	if opts.Format == "" {
+		opts.Format = FormatSIF
+	}
+	if err := checkOptions(opts); err != nil {
+		return Result{}, err
+	}
+
+	imgCache, err := cache.New(cache.Config{
+		ParentDir:       opts.CacheDir,
+		Disable:         opts.DisableCache,
+		PreserveOnError: opts.PreserveCacheOnError,
+		ReadOnly:        opts.ReadOnlyCache,
+	})
+	if err != nil {
+		return Result{}, fmt.Errorf("could not open the cache: %w", err)
+	}
+	imgCache, accesses := imgCache.Track()
+	defer func() {
+		res.Cache = cacheUse(imgCache, accesses)
+	}()
+
+	ctx = singularityclient.WithSettings(ctx, opts.settings())
+	if opts.To == "" {
+		return toCache(ctx, imgCache, opts)
+	}
+	return toDestination(ctx, imgCache, opts)
+}
+
+// checkOptions rejects the options of a pull that can't apply together.
+func checkOptions(opts Options) error {
+	transport, _ := uri.Split(opts.From)
+	switch opts.Format {
+	case FormatSIF, FormatSandbox, FormatTar:
+	default:
+		return fmt.Errorf("unknown format %q, must be one of %s, %s or %s", opts.Format, FormatSIF, FormatSandbox, FormatTar)
+	}
+	if opts.To == "" {
+		switch {
+		case opts.Format != FormatSIF:
+			return fmt.Errorf("an image pulled to the cache can't be saved as %s", opts.Format)
+		case opts.StripSignatures:
+			return fmt.Errorf("the signatures of an image pulled to the cache can't be removed")
+		case opts.Group != 0:
+			return fmt.Errorf("a group can't be extracted from an image pulled to the cache")
+		}
+	}
+	if opts.StripSignatures {
+		switch {
+		case !VerifiedByDefault(transport):
+			return fmt.Errorf("signatures can only be removed from library images")
+		case opts.NoVerify:
+			return fmt.Errorf("signatures can only be removed once verified")
+		}
+	}
+	return checkAttestation(opts)
+}
+
+// arch returns the architecture the image opts.From is pulled for.
+func (opts Options) arch() string {
+	transport, _ := uri.Split(opts.From)
+	if oci.IsSupported(transport) != "" {
+		if opts.OCI.Arch != "" {
+			return opts.OCI.Arch
+		}
+		return runtime.GOARCH
+	}
+	if opts.Arch != "" {
+		return opts.Arch
+	}
+	return runtime.GOARCH
+}
+
+// libraryConfig returns the configuration of the library client of the
+// pull with the settings of ctx.
+func (opts Options) libraryConfig(ctx context.Context) *scs.Config {
+	if opts.Library != nil {
+		return opts.Library
+	}
+	return &scs.Config{
+		BaseURL:    DefaultLibraryURL,
+		UserAgent:  singularityclient.UserAgent(ctx),
+		HTTPClient: singularityclient.NewHTTPClient(0),
+	}
+}
+
+// lease takes the lease of the cache entries of from in imgCache, and
+// returns the function releasing it, which may be called more than once.
+func lease(ctx context.Context, imgCache *cache.Handle, from string) (release func(), err error) {
+	l, err := imgCache.Lease(ctx, from)
+	if err != nil {
+		return nil, fmt.Errorf("while waiting for the cache: %w", err)
+	}
+	released := false
+	return func() {
+		if released {
+			return
+		}
+		released = true
+		// the lease of a pull failing to release it is taken over once
+		// expired, the waiters only waiting longer
+		if err := l.Release(); err != nil {
+			sylog.Warningf("While releasing the cache lease of %s: %v", from, err)
+		}
+	}, nil
+}
+
+// toDestination pulls the image at the normalized URI opts.From to opts.To
+// through imgCache, checks it and saves it in opts.Format, as Pull does
+// once it opened the cache.
+func toDestination(ctx context.Context, imgCache *cache.Handle, opts Options) (Result, error) {
+	// images saved in another format are pulled first as SIF
+	sifOpts := opts
+	var conv *converter
+	var replaceLink func() error
+	if opts.Format != FormatSIF {
+		c, err := newConverter(opts.To)
+		if err != nil {
+			return Result{}, err
+		}
+		defer c.Remove()
+		conv, sifOpts.To = c, c.sifPath()
+	} else if IsSymlink(opts.To) {
+		// the link overwritten is only replaced once the image is pulled
+		path, replace, cleanup, err := ReplaceSymlink(opts.To)
+		if err != nil {
+			return Result{}, err
+		}
+		defer cleanup()
+		sifOpts.To, replaceLink = path, replace
+	}
+
+	release, err := lease(ctx, imgCache, opts.From)
+	if err != nil {
+		return Result{}, err
+	}
+	res, err := toFile(ctx, imgCache, sifOpts)
+	// concurrent pulls of the image sharing the cache are served from it
+	// without waiting for the checks and conversion of this copy
+	release()
+	if err != nil {
+		return res, err
+	}
+	if err := check(ctx, sifOpts, &res); err != nil {
+		os.Remove(sifOpts.To)
+		return res, err
+	}
+	describe(&res, sifOpts.To)
+
+	if conv != nil {
+		if err := conv.convert(ctx, imgCache, opts); err != nil {
+			return res, err
+		}
+	}
+	if replaceLink != nil {
+		if err := replaceLink(); err != nil {
+			return res, err
+		}
+	}
+	res.Path = opts.To
+
+	if opts.AttestationOut != "" {
+		if err := attest(ctx, opts, opts.arch()); err != nil {
+			return res, fmt.Errorf("while writing attestation: %w", err)
+		}
+	}
+	return res, nil
+}
+
+// check runs the checks of opts over the SIF image pulled to opts.To with
+// the result res, which is completed with the outcome of the verification,
+// and then removes its signatures and extracts its group as set. The image
+// is left to the caller to remove if a check fails.
+func check(ctx context.Context, opts Options, res *Result) error {
+	transport, _ := uri.Split(opts.From)
+	arch := opts.arch()
+	stripSignatures := false
+	if opts.NoVerify && VerifiedByDefault(transport) {
+		sylog.Verbosef("Not verifying the signatures of %s", opts.From)
+	} else if res.Unsigned {
+		sylog.Warningf("Skipping container verification")
+		if opts.StripSignatures {
+			return fmt.Errorf("not removing the signatures of %s: it could not be verified", opts.To)
+		}
+	} else if VerifiedByDefault(transport) {
+		// only once signing.IsSigned succeeded
+		stripSignatures = opts.StripSignatures
+	}
+	v := newVerification(opts, opts.To, arch, res.Signers)
+
+	if err := scanImage(ctx, opts.Scanner, opts.From, opts.To); err != nil {
+		return err
+	}
+	if err := assertArch(opts, opts.To); err != nil {
+		return err
+	}
+	if err := checkHostArch(opts, opts.To, arch); err != nil {
+		return err
+	}
+
+	// enforced before the signatures can be removed
+	endVerification := singularityclient.StartPhase(ctx, singularityclient.PhaseVerification)
+	if err := checkUnsigned(ctx, opts, v, res.Unsigned); err != nil {
+		return err
+	}
+	if err := checkSignature(ctx, opts, v, res.Unsigned); err != nil {
+		return err
+	}
+	if err := enforcePolicy(ctx, opts, v); err != nil {
+		return err
+	}
+	if err := checkFingerprints(ctx, opts, v); err != nil {
+		return err
+	}
+	res.Signature = signatureStatus(opts, res.Unsigned)
+	res.Signers = nil
+	if res.Signature == SignatureVerified {
+		// before the signatures can be removed
+		keys, err := v.signerKeys(ctx)
+		if err != nil {
+			sylog.Debugf("Could not get the signers of %s: %v", opts.From, err)
+		}
+		res.Signers = keys
+	}
+	endVerification()
+	if err := checkRekor(ctx, opts.RekorURL, v); err != nil {
+		return err
+	}
+
+	if stripSignatures {
+		n, err := signing.StripSignatures(opts.To)
+		if err != nil {
+			return fmt.Errorf("while removing signatures: %v", err)
+		}
+		sylog.Infof("Removed %d signature(s) from %s", n, opts.To)
+	}
+
+	// extracted once the full image was verified
+	if opts.Group != 0 {
+		if err := sifedit.ExtractGroup(opts.To, opts.Group); err != nil {
+			return fmt.Errorf("while extracting group %d: %v", opts.Group, err)
+		}
+		sylog.Verbosef("Extracted group %d in %s", opts.Group, opts.To)
+	}
+	return nil
+}
+
+// describe sets the architecture, hash and size of the SIF image at path
+// in res, left unknown if they can't be read.
+func describe(res *Result, path string) {
+	if fimg, err := sif.LoadContainer(path, true); err == nil {
+		res.Arch = sif.GetGoArch(string(fimg.Header.Arch[:sif.HdrArchLen-1]))
+		fimg.UnloadContainer()
+	}
+	hash, err := FileSHA256(path)
+	if err != nil {
+		sylog.Debugf("Could not compute hash of %s: %v", path, err)
+	}
+	res.Hash = hash
+	if fi, err := os.Stat(path); err == nil {
+		res.Size = fi.Size()
+	}
+}
+
+// IsSymlink returns whether path is a symbolic link, even dangling.
+func IsSymlink(path string) bool {
+	fi, err := os.Lstat(path)
+	return err == nil && fi.Mode()&os.ModeSymlink != 0
+}
+
+// ReplaceSymlink creates a temporary directory next to the symbolic link
+// to, and returns the path in it a file replacing the link is written to.
+// The file is moved over the link with replace once complete, the
+// directory being removed with cleanup whatever the outcome.
+func ReplaceSymlink(to string) (path string, replace func() error, cleanup func(), err error) {
+	dir, err := ioutil.TempDir(filepath.Dir(to), ".pull-replace-")
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("could not create temporary directory to replace %q: %v", to, err)
+	}
+	path = filepath.Join(dir, filepath.Base(to))
+	replace = func() error {
+		// renaming replaces the link itself, not its target
+		if err := os.Rename(path, to); err != nil {
+			return fmt.Errorf("could not replace symbolic link %q: %v", to, err)
+		}
+		return nil
+	}
+	cleanup = func() {
+		if err := os.RemoveAll(dir); err != nil {
+			sylog.Warningf("Could not remove %s: %v", dir, err)
+		}
+	}
+	return path, replace, cleanup, nil
+}
+
+// toCache pulls the image at the normalized URI opts.From to imgCache and
+// returns the path of its cache entry as the path of the result. The entry
+// goes through the checks of a pull to a destination: the scanner, the hash,
+// the signatures of library images, opts.RequireSignature, the policy and
+// the fingerprints.
+func toCache(ctx context.Context, imgCache *cache.Handle, opts Options) (Result, error) {
+	transport, _ := uri.Split(opts.From)
+	arch := opts.arch()
+	res := Result{Transport: transport}
+
+	release, err := lease(ctx, imgCache, opts.From)
+	if err != nil {
+		return res, err
+	}
+	// released once the cache entry is finalized, the waiters don't wait
+	// for the checks of the signatures
+	defer release()
+
+	var path string
+	// the images checked against the hash before they are cached
+	digestVerified := false
+	switch transport {
+	case uri.Library, "":
+		path, err = library.Pull(ctx, imgCache, opts.From, arch, opts.TmpDir, opts.libraryConfig(ctx), opts.keyServer())
+		if err != nil {
+			return res, fmt.Errorf("while pulling library image: %w", err)
+		}
+	case uri.Shub:
+		path, err = shub.Pull(ctx, imgCache, opts.From, opts.TmpDir, opts.NoHTTPS, opts.Digest)
+		if err != nil {
+			return res, fmt.Errorf("while pulling shub image: %w", err)
+		}
+		digestVerified = true
+	case uri.Oras:
+		path, err = oras.Pull(ctx, imgCache, opts.From, opts.TmpDir, opts.DockerAuthConfig, opts.NoHTTPS)
+		if err != nil {
+			return res, fmt.Errorf("while pulling image from oci registry: %w", err)
+		}
+	case uri.HTTP, uri.HTTPS:
+		path, err = net.Pull(ctx, imgCache, opts.From, opts.TmpDir, opts.NoDecompress, opts.Digest)
+		if err != nil {
+			return res, fmt.Errorf("while pulling from image from http(s): %w", err)
+		}
+		digestVerified = true
+	case oci.IsSupported(transport):
+		path, err = oci.Pull(ctx, imgCache, opts.From, opts.ociOptions())
+		if err != nil {
+			return res, fmt.Errorf("while making image from oci registry: %w", err)
+		}
+	default:
+		return res, fmt.Errorf("%s images are not cached, they can only be pulled to a destination", transport)
+	}
+
+	// neither a threat nor an image of another hash must be served from
+	// the cache later
+	if err := scanImage(ctx, opts.Scanner, opts.From, path); err != nil {
+		os.Remove(path)
+		return res, err
+	}
+	if opts.Digest != "" && !digestVerified {
+		hash, err := FileSHA256(path)
+		if err != nil {
+			return res, fmt.Errorf("could not hash %s: %w", path, err)
+		}
+		if hash != opts.Digest {
+			os.Remove(path)
+			return res, fmt.Errorf("%s has hash %s instead of the expected %s", opts.From, hash, opts.Digest)
+		}
+	}
+	release()
+
+	// as library.PullToFile does for a destination
+	if VerifiedByDefault(transport) {
+		keys, err := signing.IsSignedArch(ctx, path, arch, opts.keyServer(), opts.libraryConfig(ctx).AuthToken)
+		if errors.Is(err, signing.ErrNotSIF) {
+			return res, fmt.Errorf("while verifying library image: %w", err)
+		} else if err != nil {
+			sylog.Warningf("%v", err)
+			sylog.Warningf("Skipping container verification")
+			res.Unsigned = true
+		}
+		res.Signers = keys
+	}
+	v := newVerification(opts, path, arch, res.Signers)
+	if err := checkSignature(ctx, opts, v, res.Unsigned); err != nil {
+		return res, err
+	}
+	if err := enforcePolicy(ctx, opts, v); err != nil {
+		return res, err
+	}
+	if err := checkFingerprints(ctx, opts, v); err != nil {
+		return res, err
+	}
+	res.Signature = signatureStatus(opts, res.Unsigned)
+	res.Path = path
+	describe(&res, path)
+	return res, nil
+}
+
+// ociOptions returns the options OCI images are built with.
+func (opts Options) ociOptions() buildtypes.Options {
+	ociOpts := opts.OCI
+	ociOpts.TmpDir = opts.TmpDir
+	ociOpts.NoHTTPS = opts.NoHTTPS
+	ociOpts.DockerAuthConfig = opts.DockerAuthConfig
+	return ociOpts
+}
+
+// toFile pulls the image at the normalized URI opts.From to opts.To through
+// imgCache, with the network settings of ctx. The signatures of library
+// images failing to verify only mark the result as unsigned, unless the
+// file isn't a SIF image.
+func toFile(ctx context.Context, imgCache *cache.Handle, opts Options) (Result, error) {
+	transport, _ := uri.Split(opts.From)
+	result := Result{Path: opts.To, Transport: transport}
+	arch := opts.arch()
+	libraryConfig := opts.libraryConfig(ctx)
+	keyServerURL := opts.keyServer()
+	// the images checked against the hash as downloaded
+	digestVerified := false
+
+	// library pulls trace the phases of their download themselves
+	endDownload := func() {}
+	if transport != uri.Library && transport != "" {
+		endDownload = singularityclient.StartPhase(ctx, singularityclient.PhaseDownload)
+	}
+	switch transport {
+	case uri.Library, "":
+		if opts.NoVerify {
+			if _, err := library.PullToFileUnverified(ctx, imgCache, opts.To, opts.From, arch, opts.TmpDir, libraryConfig); err != nil {
+				return Result{}, fmt.Errorf("while pulling library image: %w", err)
+			}
+			break
+		}
+		_, signers, err := library.PullToFile(ctx, imgCache, opts.To, opts.From, arch, opts.TmpDir, libraryConfig, keyServerURL)
+		if errors.Is(err, signing.ErrNotSIF) {
+			os.Remove(opts.To)
+			return Result{}, fmt.Errorf("while verifying library image: %w", err)
+		} else if err == library.ErrLibraryPullUnsigned {
+			result.Unsigned = true
+		} else if err != nil {
+			return Result{}, fmt.Errorf("while pulling library image: %w", err)
+		}
+		result.Signers = signers
+	case uri.Shub:
+		if _, err := shub.PullToFile(ctx, imgCache, opts.To, opts.From, opts.TmpDir, opts.NoHTTPS, opts.Digest); err != nil {
+			return Result{}, fmt.Errorf("while pulling shub image: %w", err)
+		}
+		digestVerified = true
+	case uri.Oras:
+		if _, err := oras.PullToFile(ctx, imgCache, opts.To, opts.From, opts.TmpDir, opts.DockerAuthConfig, opts.NoHTTPS); err != nil {
+			return Result{}, fmt.Errorf("while pulling image from oci registry: %w", err)
+		}
+	case uri.HTTP, uri.HTTPS:
+		if _, err := net.PullToFile(ctx, imgCache, opts.To, opts.From, opts.TmpDir, opts.NoDecompress, opts.Digest); err != nil {
+			return Result{}, fmt.Errorf("while pulling from image from http(s): %w", err)
+		}
+		digestVerified = true
+	case uri.SCP:
+		if _, err := scp.PullToFile(ctx, opts.To, opts.From, scp.Options{Identity: opts.Identity}); err != nil {
+			return Result{}, fmt.Errorf("while pulling image over scp: %w", err)
+		}
+	case oci.IsSupported(transport):
+		if _, err := oci.PullToFile(ctx, imgCache, opts.To, opts.From, opts.ociOptions()); err != nil {
+			return Result{}, fmt.Errorf("while making image from oci registry: %w", err)
+		}
+	default:
+		return Result{}, fmt.Errorf("unsupported transport type: %s", transport)
+	}
+	endDownload()
+
+	if opts.Digest != "" && !digestVerified {
+		endHash := singularityclient.StartPhase(ctx, singularityclient.PhaseHash)
+		hash, err := FileSHA256(opts.To)
+		endHash()
+		if err != nil {
+			os.Remove(opts.To)
+			return Result{}, fmt.Errorf("could not hash %s: %w", opts.To, err)
+		}
+		if hash != opts.Digest {
+			os.Remove(opts.To)
+			return Result{}, fmt.Errorf("%s has hash %s instead of the expected %s", opts.From, hash, opts.Digest)
+		}
+	}
+	return result, nil
+}
+
+// FileSHA256 returns the sha256 hash of the file at path, in the
+// sha256:<hex> form.
+func FileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,287 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package pull
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	scs "github.com/sylabs/scs-library-client/client"
+	useragent "github.com/sylabs/singularity/pkg/util/user-agent"
+)
+
+func TestPull(t *testing.T) {
+	useragent.InitValue("singularity", "3.0.0")
+
+	image := []byte("pulled image")
+	digest := fmt.Sprintf("sha256:%x", sha256.Sum256(image))
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/images/user/collection/container:latest":
+			fmt.Fprintf(w, `{"data": {"hash": "sha256.%x"}}`, sha256.Sum256(image))
+		case "/v1/imagefile/user/collection/container:latest", "/image.sif":
+			w.Write(image)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		opts    Options
+		wantErr string
+	}{
+		{
+			name: "HTTP",
+			opts: Options{From: srv.URL + "/image.sif", Digest: digest},
+		},
+		{
+			// the architecture of an image which isn't a SIF image can't be
+			// checked
+			name: "Library",
+			opts: Options{From: "library://user/collection/container", Library: &scs.Config{BaseURL: srv.URL}, NoVerify: true, AllowArchMismatch: true},
+		},
+		{
+			name:    "DigestMismatch",
+			opts:    Options{From: srv.URL + "/image.sif", Digest: "sha256:" + strings.Repeat("0", 64)},
+			wantErr: "image digest mismatch",
+		},
+		{
+			name:    "NotFound",
+			opts:    Options{From: srv.URL + "/missing.sif"},
+			wantErr: "not found",
+		},
+		{
+			name:    "UnsupportedTransport",
+			opts:    Options{From: "unknown://image"},
+			wantErr: "unsupported transport",
+		},
+		{
+			name:    "Canceled",
+			ctx:     canceled,
+			opts:    Options{From: srv.URL + "/image.sif"},
+			wantErr: "canceled",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "pull-")
+			if err != nil {
+				t.Fatalf("failed to create temporary directory: %v", err)
+			}
+			defer os.RemoveAll(dir)
+
+			ctx := tt.ctx
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			opts := tt.opts
+			opts.To = filepath.Join(dir, "image.sif")
+			opts.TmpDir = dir
+			opts.DisableCache = true
+
+			res, err := Pull(ctx, opts)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+				if _, err := os.Stat(opts.To); !os.IsNotExist(err) {
+					t.Errorf("image left at %s after failing: %v", opts.To, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if res.Path != opts.To {
+				t.Errorf("image pulled to %s, want %s", res.Path, opts.To)
+			}
+			if b, err := ioutil.ReadFile(res.Path); err != nil || !bytes.Equal(b, image) {
+				t.Errorf("unexpected image %q: %v", b, err)
+			}
+		})
+	}
+}
+
+func TestPullArch(t *testing.T) {
+	useragent.InitValue("singularity", "3.0.0")
+
+	var gotArch string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotArch = r.URL.Query().Get("arch")
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "pull-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	opts := Options{
+		From:         "library://user/collection/container:latest",
+		To:           filepath.Join(dir, "image.sif"),
+		TmpDir:       dir,
+		Library:      &scs.Config{BaseURL: srv.URL},
+		NoVerify:     true,
+		DisableCache: true,
+	}
+	if _, err := Pull(context.Background(), opts); err == nil {
+		t.Fatalf("unexpected success pulling a missing image")
+	}
+	if gotArch != runtime.GOARCH {
+		t.Errorf("got architecture %q, want the host one %q", gotArch, runtime.GOARCH)
+	}
+}
+
+func TestPullUserAgent(t *testing.T) {
+	var gotAgents []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAgents = append(gotAgents, r.UserAgent())
+		w.Write([]byte("pulled image"))
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "pull-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, agent := range []string{"first-agent/1.0", "second-agent/2.0"} {
+		opts := Options{
+			From:         srv.URL + "/image.sif",
+			To:           filepath.Join(dir, "image.sif"),
+			TmpDir:       dir,
+			DisableCache: true,
+			UserAgent:    agent,
+		}
+		gotAgents = nil
+		if _, err := Pull(context.Background(), opts); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		os.Remove(opts.To)
+		for _, got := range gotAgents {
+			if got != agent {
+				t.Errorf("got user agent %q, want %q", got, agent)
+			}
+		}
+	}
+}
+
+func TestPullCache(t *testing.T) {
+	useragent.InitValue("singularity", "3.0.0")
+
+	modified := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "image.sif", modified, strings.NewReader("pulled image"))
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "pull-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	cacheDir := filepath.Join(dir, "cache")
+	if err := os.Mkdir(cacheDir, 0777); err != nil {
+		t.Fatalf("failed to create cache directory: %v", err)
+	}
+	os.Chmod(cacheDir, 0777)
+
+	tests := []struct {
+		name         string
+		disableCache bool
+		want         CacheUse
+	}{
+		{name: "Disabled", disableCache: true, want: CacheDisabled},
+		{name: "Miss", want: CacheMiss},
+		{name: "Hit", want: CacheHit},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := Options{
+				From:         srv.URL + "/image.sif",
+				To:           filepath.Join(dir, "image.sif"),
+				TmpDir:       dir,
+				CacheDir:     cacheDir,
+				DisableCache: tt.disableCache,
+			}
+			defer os.Remove(opts.To)
+
+			res, err := Pull(context.Background(), opts)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if res.Cache != tt.want {
+				t.Errorf("got cache use %q, want %q", res.Cache, tt.want)
+			}
+		})
+	}
+}
+
+func TestPullToCacheDigest(t *testing.T) {
+	useragent.InitValue("singularity", "3.0.0")
+
+	image := []byte("pulled image")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(image)
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "pull-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	cacheDir := filepath.Join(dir, "cache")
+	if err := os.Mkdir(cacheDir, 0777); err != nil {
+		t.Fatalf("failed to create cache directory: %v", err)
+	}
+	os.Chmod(cacheDir, 0777)
+
+	opts := Options{
+		From:     srv.URL + "/image.sif",
+		TmpDir:   dir,
+		CacheDir: cacheDir,
+		Digest:   "sha256:" + strings.Repeat("0", 64),
+	}
+	if _, err := Pull(context.Background(), opts); err == nil || !strings.Contains(err.Error(), "image digest mismatch") {
+		t.Fatalf("got error %v, want an image digest mismatch", err)
+	}
+
+	// the image of another hash wasn't cached
+	opts.Digest = fmt.Sprintf("sha256:%x", sha256.Sum256(image))
+	res, err := Pull(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if res.Cache != CacheMiss {
+		t.Errorf("got cache use %q, want %q", res.Cache, CacheMiss)
+	}
+	if b, err := ioutil.ReadFile(res.Path); err != nil || !bytes.Equal(b, image) {
+		t.Errorf("unexpected cached image %q: %v", b, err)
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package pull
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	singularityclient "github.com/sylabs/singularity/internal/pkg/client"
+	"github.com/sylabs/singularity/internal/pkg/client/rekor"
+	"github.com/sylabs/singularity/internal/pkg/util/uri"
+	"github.com/sylabs/singularity/pkg/sylog"
+)
+
+// rekorTimeout bounds the time spent querying the transparency log.
+const rekorTimeout = 30 * time.Second
+
+// checkRekor checks that the signature of the image of v is recorded in the
+// transparency log at rekorURL by one of its signers. The stage which
+// failed, the signature verification or the transparency log lookup, is
+// reported.
+func checkRekor(ctx context.Context, rekorURL string, v *verification) error {
+	if rekorURL == "" {
+		return nil
+	}
+	defer singularityclient.StartPhase(ctx, singularityclient.PhaseTransparency)()
+
+	signers, err := v.signers(ctx)
+	if err != nil {
+		return fmt.Errorf("signature verification failed: %v", err)
+	}
+	hash, err := FileSHA256(v.path)
+	if err != nil {
+		return fmt.Errorf("could not hash %s: %v", v.path, err)
+	}
+
+	c := &rekor.Client{BaseURL: rekorURL, HTTPClient: singularityclient.NewHTTPClient(rekorTimeout)}
+	e, err := c.FindEntry(ctx, strings.TrimPrefix(hash, "sha256:"), signers)
+	if err == rekor.ErrNotRecorded {
+		return fmt.Errorf("transparency log verification failed: no entry of %s records %s signed by %s",
+			rekorURL, uri.Redact(v.from), strings.Join(signers, ", "))
+	} else if err != nil {
+		return fmt.Errorf("transparency log verification failed: %v", err)
+	}
+	sylog.Infof("Signature of %s by %s recorded in the transparency log (entry %s, index %d)",
+		uri.Redact(v.from), e.Fingerprint, e.UUID, e.LogIndex)
+	return nil
+}
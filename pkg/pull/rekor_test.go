@@ -0,0 +1,48 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package pull
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckRekor(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pull-rekor-")
+	if err != nil {
+		t.Fatalf("could not create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "image.sif")
+	if err := ioutil.WriteFile(path, []byte("unsigned image"), 0644); err != nil {
+		t.Fatalf("could not write image: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		url  string
+		err  string
+	}{
+		{name: "Disabled"},
+		// the log isn't queried for an image whose signature fails
+		{name: "Unsigned", url: "https://rekor.example.com", err: "signature verification failed: "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := Options{From: "https://example.com/image.sif"}
+			err := checkRekor(context.Background(), tt.url, newVerification(opts, path, "amd64", nil))
+			if tt.err == "" && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			} else if tt.err != "" && (err == nil || !strings.HasPrefix(err.Error(), tt.err)) {
+				t.Errorf("unexpected error %v, expected %q", err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package pull
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/sylabs/singularity/pkg/sylog"
+)
+
+// Scanner is the scanner command run over the pulled images.
+type Scanner struct {
+	// Args are the command and its arguments, the path of the image being
+	// appended to them.
+	Args []string
+	// CleanExitCode is the exit code of the scanner for a clean image.
+	CleanExitCode int
+}
+
+// scanImage scans the image from pulled to path with the scanner s, if not
+// nil. It fails unless the scanner exits with the clean exit code, any
+// other exit code being taken as a threat detected or a scan that could
+// not complete, the image being left to the caller to remove.
+func scanImage(ctx context.Context, s *Scanner, from, path string) error {
+	if s == nil {
+		return nil
+	}
+	if len(s.Args) == 0 {
+		return fmt.Errorf("no scanner command to scan %s with", from)
+	}
+
+	sylog.Infof("Scanning %s with %s", from, s.Args[0])
+	var out bytes.Buffer
+	cmd := exec.CommandContext(ctx, s.Args[0], append(s.Args[1:], path)...)
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	err := cmd.Run()
+	sylog.Debugf("Scanner output: %s", out.String())
+
+	code := 0
+	if err != nil {
+		exitErr, ok := err.(*exec.ExitError)
+		if !ok {
+			return fmt.Errorf("could not run scanner %s: %v", s.Args[0], err)
+		}
+		code = exitErr.ExitCode()
+	}
+	if code != s.CleanExitCode {
+		msg := strings.TrimSpace(out.String())
+		if msg == "" {
+			msg = "no scanner output"
+		}
+		if code < 0 {
+			return fmt.Errorf("scan of %s failed, %s was killed: %s", from, s.Args[0], msg)
+		}
+		return fmt.Errorf("scan of %s failed, %s exited with code %d instead of the clean exit code %d: %s", from, s.Args[0], code, s.CleanExitCode, msg)
+	}
+
+	sylog.Verbosef("%s is clean", from)
+	return nil
+}
@@ -0,0 +1,60 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package pull
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestScanImage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pull-scan-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// exits with 1 for infected images, as clamdscan
+	scanner := filepath.Join(dir, "scanner")
+	script := "#!/bin/sh\nif grep -q EICAR \"$1\"; then echo \"$1: FOUND\"; exit 1; fi\n"
+	if err := ioutil.WriteFile(scanner, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	clean := filepath.Join(dir, "clean.sif")
+	if err := ioutil.WriteFile(clean, []byte("image"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	infected := filepath.Join(dir, "infected.sif")
+	if err := ioutil.WriteFile(infected, []byte("EICAR"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		scanner *Scanner
+		path    string
+		wantErr bool
+	}{
+		{name: "NoScan", path: infected},
+		{name: "Clean", scanner: &Scanner{Args: []string{scanner}}, path: clean},
+		{name: "Infected", scanner: &Scanner{Args: []string{scanner}}, path: infected, wantErr: true},
+		{name: "CleanExitCode", scanner: &Scanner{Args: []string{scanner}, CleanExitCode: 1}, path: infected},
+		{name: "NoScanner", scanner: &Scanner{}, path: clean, wantErr: true},
+		{name: "MissingScanner", scanner: &Scanner{Args: []string{filepath.Join(dir, "missing")}}, path: clean, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := scanImage(context.Background(), tt.scanner, "https://example.com/image.sif", tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,268 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package pull
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/sylabs/singularity/internal/pkg/util/uri"
+	"github.com/sylabs/singularity/pkg/pull/policy"
+	"github.com/sylabs/singularity/pkg/signing"
+	"github.com/sylabs/singularity/pkg/sylog"
+)
+
+// SignatureStatus is the status of the signatures of a pulled image.
+type SignatureStatus string
+
+const (
+	// SignatureVerified is the status of an image whose signatures were
+	// verified.
+	SignatureVerified SignatureStatus = "verified"
+	// SignatureUnsigned is the status of a library image whose signatures
+	// could not be verified.
+	SignatureUnsigned SignatureStatus = "unsigned"
+	// SignatureUnverified is the status of an image whose signatures
+	// weren't verified, none of the checks requiring it.
+	SignatureUnverified SignatureStatus = "unverified"
+)
+
+// UnsignedError is the error of an image refused by Options.FailOnUnsigned.
+type UnsignedError struct {
+	// From is the URI of the image.
+	From string
+	// Err is the error of the verification of its signatures, nil if the
+	// library pull reported it unsigned.
+	Err error
+}
+
+func (e *UnsignedError) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("%s is not signed, a verified signature is required", e.From)
+	}
+	return fmt.Sprintf("%v, a verified signature is required", e.Err)
+}
+
+func (e *UnsignedError) Unwrap() error {
+	return e.Err
+}
+
+// VerifiedByDefault returns whether the images of transport have their
+// signatures verified when neither Options.RequireSignature nor a policy
+// rule requires it, a warning being produced for the unsigned ones. Only
+// the library is trusted to serve signed images, the images of the other
+// transports are pulled unverified.
+func VerifiedByDefault(transport string) bool {
+	return transport == uri.Library || transport == ""
+}
+
+// policyRule returns the rule of opts.Policy applying to the image
+// opts.From, if any.
+func (opts Options) policyRule() *policy.Rule {
+	if opts.Policy == nil {
+		return nil
+	}
+	return opts.Policy.Match(opts.From)
+}
+
+// keyServer returns the key servers the image opts.From is verified
+// against: the ones of its policy rule if set, else opts.KeyServerURL or
+// DefaultKeyServerURL.
+func (opts Options) keyServer() string {
+	if r := opts.policyRule(); r != nil && r.Keyserver != "" {
+		return r.Keyserver
+	}
+	if opts.KeyServerURL != "" {
+		return opts.KeyServerURL
+	}
+	return DefaultKeyServerURL
+}
+
+// checkSignature fails, with opts.RequireSignature, unless the image of v
+// has verified signatures. Library images were already verified while
+// pulled, unsigned telling the result. A policy rule matching the image
+// overrides the transport default and opts.RequireSignature, its
+// verification being enforced by enforcePolicy.
+func checkSignature(ctx context.Context, opts Options, v *verification, unsigned bool) error {
+	transport, _ := uri.Split(opts.From)
+	if opts.policyRule() != nil {
+		return nil
+	}
+	if !opts.RequireSignature {
+		if !VerifiedByDefault(transport) {
+			sylog.Verbosef("Not verifying %s, %s images are not verified by default", opts.From, transport)
+		}
+		return nil
+	}
+
+	if VerifiedByDefault(transport) {
+		if unsigned {
+			return fmt.Errorf("%s could not be verified, a verified signature is required", opts.From)
+		}
+		return nil
+	}
+	if _, err := v.signers(ctx); err != nil {
+		return fmt.Errorf("%w, a verified signature is required", err)
+	}
+	sylog.Verbosef("%s is signed", opts.From)
+	return nil
+}
+
+// checkUnsigned fails, with opts.FailOnUnsigned, with an UnsignedError
+// unless the image of v has verified signatures, unsigned being true if the
+// library pull couldn't verify them. It is enforced whatever the
+// transport, opts.RequireSignature and the policy.
+func checkUnsigned(ctx context.Context, opts Options, v *verification, unsigned bool) error {
+	if !opts.FailOnUnsigned {
+		return nil
+	}
+	transport, _ := uri.Split(opts.From)
+	if VerifiedByDefault(transport) {
+		if unsigned {
+			return &UnsignedError{From: opts.From}
+		}
+		return nil
+	}
+	if _, err := v.signers(ctx); err != nil {
+		return &UnsignedError{From: opts.From, Err: err}
+	}
+	return nil
+}
+
+// enforcePolicy checks the image of v against the rule of opts.Policy
+// applying to it, whatever the transport.
+func enforcePolicy(ctx context.Context, opts Options, v *verification) error {
+	r := opts.policyRule()
+	if r == nil || !r.Verify {
+		return nil
+	}
+
+	if opts.NoVerify {
+		sylog.Warningf("Verifying %s although its verification was skipped, the policy requires it", opts.From)
+	} else if opts.AllowUnauthenticated {
+		sylog.Warningf("Verifying %s although unauthenticated images are allowed, the policy requires it", opts.From)
+	}
+
+	signers, err := v.signers(ctx)
+	if err != nil {
+		return opts.Policy.Errorf(r, "%v", err)
+	}
+	if !r.Trusts(signers) {
+		return opts.Policy.Errorf(r, "%s is not signed by a trusted key", opts.From)
+	}
+
+	sylog.Verbosef("%s complies with the policy", opts.From)
+	return nil
+}
+
+// checkFingerprints checks that the image of v was signed by one of the
+// keys with the fingerprints opts.Fingerprints, whatever the transport.
+func checkFingerprints(ctx context.Context, opts Options, v *verification) error {
+	fps := opts.Fingerprints
+	if len(fps) == 0 {
+		return nil
+	}
+
+	signers, err := v.signers(ctx)
+	if err != nil {
+		return err
+	}
+	r := policy.Rule{Verify: true, Keys: fps}
+	if !r.Trusts(signers) {
+		return fmt.Errorf("%s is not signed by any of the required keys (%s)", opts.From, strings.Join(fps, ", "))
+	}
+
+	sylog.Verbosef("%s is signed by a required key", opts.From)
+	return nil
+}
+
+// signatureStatus returns the signature status of the image opts.From once
+// pulled, unsigned being true if the library pull couldn't verify it.
+// Library images are verified unless opts.NoVerify is set, the images of
+// the other transports only when a check required it, as they would have
+// failed otherwise.
+func signatureStatus(opts Options, unsigned bool) SignatureStatus {
+	transport, _ := uri.Split(opts.From)
+	if unsigned {
+		return SignatureUnsigned
+	}
+	if r := opts.policyRule(); r != nil && r.Verify {
+		return SignatureVerified
+	}
+	if opts.NoVerify {
+		return SignatureUnverified
+	}
+	if VerifiedByDefault(transport) || opts.RequireSignature || opts.FailOnUnsigned || len(opts.Fingerprints) > 0 {
+		return SignatureVerified
+	}
+	return SignatureUnverified
+}
+
+// verifyInfo is replaced by tests.
+var verifyInfo = signing.VerifyInfo
+
+// verification is the verification of the signatures of the partition for
+// arch of the image from pulled to path. It is done once, on the first
+// check requiring it, the keys of the signers being shared by the following
+// checks.
+type verification struct {
+	from      string
+	path      string
+	arch      string
+	keyServer string
+	authToken string
+
+	verified bool
+	keys     []signing.KeyEntity
+	err      error
+}
+
+// newVerification returns the verification of the image opts.From pulled
+// to path for arch, keys being the signers of the image if the pull already
+// verified them, nil otherwise.
+func newVerification(opts Options, path, arch string, keys []signing.KeyEntity) *verification {
+	v := &verification{
+		from:      opts.From,
+		path:      path,
+		arch:      arch,
+		keyServer: opts.keyServer(),
+		verified:  keys != nil,
+		keys:      keys,
+	}
+	if opts.Library != nil {
+		v.authToken = opts.Library.AuthToken
+	}
+	return v
+}
+
+// signerKeys verifies the signatures of the image, unless already done, and
+// returns the keys of its signers. The error of an image which isn't a SIF
+// image wraps signing.ErrNotSIF.
+func (v *verification) signerKeys(ctx context.Context) ([]signing.KeyEntity, error) {
+	if v.verified {
+		return v.keys, v.err
+	}
+	v.verified = true
+	v.keys, v.err = verifyInfo(ctx, v.path, v.arch, v.keyServer, v.authToken)
+	if v.err != nil {
+		v.keys, v.err = nil, fmt.Errorf("%s could not be verified: %w", v.from, v.err)
+	}
+	return v.keys, v.err
+}
+
+// signers is signerKeys returning the fingerprints of the signers.
+func (v *verification) signers(ctx context.Context) ([]string, error) {
+	keys, err := v.signerKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	fps := make([]string, 0, len(keys))
+	for _, k := range keys {
+		fps = append(fps, k.Fingerprint)
+	}
+	return fps, nil
+}
@@ -0,0 +1,242 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package pull
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sylabs/singularity/pkg/pull/policy"
+	"github.com/sylabs/singularity/pkg/signing"
+)
+
+func TestCheckSignature(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pull-signature-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// not a SIF image, its signatures can't be verified
+	image := filepath.Join(dir, "image.sif")
+	if err := ioutil.WriteFile(image, []byte("image"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		from     string
+		unsigned bool
+		require  bool
+		policy   *policy.Policy
+		wantErr  bool
+	}{
+		{name: "LibraryUnsigned", from: "library://alpine", unsigned: true},
+		{name: "LibraryRequired", from: "library://alpine", require: true},
+		{name: "LibraryRequiredUnsigned", from: "alpine", unsigned: true, require: true, wantErr: true},
+		{name: "HTTP", from: "https://example.com/image.sif"},
+		{name: "HTTPRequired", from: "https://example.com/image.sif", require: true, wantErr: true},
+		{
+			name:    "HTTPRequiredByPolicy",
+			from:    "https://example.com/image.sif",
+			require: true,
+			// left to enforcePolicy
+			policy: &policy.Policy{Rules: []policy.Rule{{Prefix: "https://example.com/", Verify: true}}},
+		},
+		{
+			name:    "HTTPRequiredNotByPolicy",
+			from:    "https://example.com/image.sif",
+			require: true,
+			policy:  &policy.Policy{Rules: []policy.Rule{{Prefix: "https://example.com/"}}},
+		},
+		{
+			name:    "HTTPRequiredOtherPolicy",
+			from:    "https://example.com/image.sif",
+			require: true,
+			policy:  &policy.Policy{Rules: []policy.Rule{{Prefix: "docker://"}}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := Options{From: tt.from, RequireSignature: tt.require, Policy: tt.policy}
+			err := checkSignature(context.Background(), opts, newVerification(opts, image, "amd64", nil), tt.unsigned)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckUnsigned(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pull-unsigned-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	image := filepath.Join(dir, "image.sif")
+	if err := ioutil.WriteFile(image, []byte("image"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		from     string
+		unsigned bool
+		fail     bool
+		policy   *policy.Policy
+		wantErr  bool
+	}{
+		{name: "LibraryUnsigned", from: "library://alpine", unsigned: true},
+		{name: "LibrarySigned", from: "library://alpine", fail: true},
+		{name: "LibraryFailUnsigned", from: "alpine", unsigned: true, fail: true, wantErr: true},
+		{name: "HTTP", from: "https://example.com/image.sif"},
+		{name: "HTTPFail", from: "https://example.com/image.sif", fail: true, wantErr: true},
+		{
+			name: "HTTPFailNotByPolicy",
+			from: "https://example.com/image.sif",
+			fail: true,
+			// the policy doesn't override FailOnUnsigned
+			policy:  &policy.Policy{Rules: []policy.Rule{{Prefix: "https://example.com/"}}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := Options{From: tt.from, FailOnUnsigned: tt.fail, Policy: tt.policy}
+			err := checkUnsigned(context.Background(), opts, newVerification(opts, image, "amd64", nil), tt.unsigned)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			var unsignedErr *UnsignedError
+			if err != nil && !errors.As(err, &unsignedErr) {
+				t.Errorf("unexpected error type %T", err)
+			}
+		})
+	}
+}
+
+func TestSignatureStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		from     string
+		unsigned bool
+		require  bool
+		noVerify bool
+		fps      []string
+		policy   *policy.Policy
+		want     SignatureStatus
+	}{
+		{name: "Library", from: "library://alpine", want: SignatureVerified},
+		{name: "LibraryUnsigned", from: "alpine", unsigned: true, want: SignatureUnsigned},
+		{name: "LibraryNoVerify", from: "library://alpine", noVerify: true, want: SignatureUnverified},
+		{name: "HTTP", from: "https://example.com/image.sif", want: SignatureUnverified},
+		{name: "HTTPRequired", from: "https://example.com/image.sif", require: true, want: SignatureVerified},
+		{name: "HTTPFingerprint", from: "https://example.com/image.sif", fps: []string{"0123456789ABCDEF0123456789ABCDEF01234567"}, want: SignatureVerified},
+		{
+			name:   "HTTPPolicy",
+			from:   "https://example.com/image.sif",
+			policy: &policy.Policy{Rules: []policy.Rule{{Prefix: "https://example.com/", Verify: true}}},
+			want:   SignatureVerified,
+		},
+		{
+			name:     "LibraryPolicyNoVerify",
+			from:     "library://alpine",
+			noVerify: true,
+			policy:   &policy.Policy{Rules: []policy.Rule{{Prefix: "library://", Verify: true}}},
+			want:     SignatureVerified,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := Options{From: tt.from, RequireSignature: tt.require, NoVerify: tt.noVerify, Fingerprints: tt.fps, Policy: tt.policy}
+			if got := signatureStatus(opts, tt.unsigned); got != tt.want {
+				t.Errorf("got status %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerificationNotSIF(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pull-signature-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// an error page downloaded in place of the image
+	image := filepath.Join(dir, "image.sif")
+	if err := ioutil.WriteFile(image, []byte("<html><body>404 Not Found</body></html>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := Options{From: "https://example.com/image.sif"}
+	_, err = newVerification(opts, image, "amd64", nil).signers(context.Background())
+	if !errors.Is(err, signing.ErrNotSIF) {
+		t.Errorf("expected an invalid SIF image error, got %v", err)
+	}
+}
+
+func TestVerificationOnce(t *testing.T) {
+	defer func() { verifyInfo = signing.VerifyInfo }()
+
+	const fp = "0123456789ABCDEF0123456789ABCDEF01234567"
+	verified := 0
+	verifyInfo = func(ctx context.Context, cpath, arch, keyServiceURI, authToken string) ([]signing.KeyEntity, error) {
+		verified++
+		return []signing.KeyEntity{{Fingerprint: fp}}, nil
+	}
+
+	opts := Options{
+		From:             "https://example.com/image.sif",
+		Policy:           &policy.Policy{Rules: []policy.Rule{{Prefix: "https://example.com/", Verify: true}}},
+		RequireSignature: true,
+		FailOnUnsigned:   true,
+		Fingerprints:     []string{fp},
+	}
+
+	tests := []struct {
+		name         string
+		keys         []signing.KeyEntity
+		wantVerified int
+	}{
+		{name: "Unverified", wantVerified: 1},
+		// verified by the library pull
+		{name: "Verified", keys: []signing.KeyEntity{{Fingerprint: fp}}, wantVerified: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verified = 0
+			ctx := context.Background()
+			v := newVerification(opts, "image.sif", "amd64", tt.keys)
+			if err := checkUnsigned(ctx, opts, v, false); err != nil {
+				t.Errorf("unexpected unsigned error: %v", err)
+			}
+			if err := checkSignature(ctx, opts, v, false); err != nil {
+				t.Errorf("unexpected signature error: %v", err)
+			}
+			if err := enforcePolicy(ctx, opts, v); err != nil {
+				t.Errorf("unexpected policy error: %v", err)
+			}
+			if err := checkFingerprints(ctx, opts, v); err != nil {
+				t.Errorf("unexpected fingerprint error: %v", err)
+			}
+			if keys, err := v.signerKeys(ctx); err != nil || len(keys) != 1 {
+				t.Errorf("unexpected signers %v: %v", keys, err)
+			}
+			if verified != tt.wantVerified {
+				t.Errorf("image verified %d times, want %d", verified, tt.wantVerified)
+			}
+		})
+	}
+}
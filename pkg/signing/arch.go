@@ -0,0 +1,201 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package signing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/sylabs/sif/pkg/sif"
+	"github.com/sylabs/singularity/pkg/sylog"
+)
+
+// partArch returns the Go architecture of the system partition d, ok is
+// false if d isn't one.
+func partArch(d *sif.Descriptor) (arch string, prim, ok bool) {
+	if !d.Used || d.Datatype != sif.DataPartition {
+		return "", false, false
+	}
+	ptype, err := d.GetPartType()
+	if err != nil || (ptype != sif.PartPrimSys && ptype != sif.PartSystem) {
+		return "", false, false
+	}
+	a, err := d.GetArch()
+	if err != nil {
+		return "", false, false
+	}
+	return sif.GetGoArch(string(a[:sif.HdrArchLen-1])), ptype == sif.PartPrimSys, true
+}
+
+// partSignatures returns the selection of the signatures covering the
+// system partition d: its descriptor group if signed as a group, or the
+// partition itself. ok is false if no signature covers it.
+func partSignatures(fimg *sif.FileImage, d *sif.Descriptor) (id uint32, isGroup, ok bool) {
+	if d.Groupid != sif.DescrUnusedGroup {
+		search := sif.Descriptor{
+			Datatype: sif.DataSignature,
+			Link:     d.Groupid,
+		}
+		if _, _, err := fimg.GetFromDescr(search); err == nil {
+			return d.Groupid &^ sif.DescrGroupMask, true, true
+		}
+	}
+	if _, _, err := fimg.GetLinkedDescrsByType(d.ID, sif.DataSignature); err == nil {
+		return d.ID, false, true
+	}
+	return 0, false, false
+}
+
+// archSelection returns the selection of the signatures to verify for the
+// system partition of fimg for arch, as taken by Verify. Images without a
+// partition for arch have their primary partition verified, as it is the
+// one which runs. An error is returned if the partition isn't signed, which
+// names the architectures whose partitions are.
+func archSelection(fimg *sif.FileImage, arch string) (id uint32, isGroup bool, err error) {
+	var part *sif.Descriptor
+	var signed []string
+	for i := range fimg.DescrArr {
+		d := &fimg.DescrArr[i]
+		a, prim, ok := partArch(d)
+		if !ok {
+			continue
+		}
+		if a == arch && (part == nil || prim) {
+			part = d
+		}
+		if _, _, ok := partSignatures(fimg, d); ok && !stringInSlice(a, signed) {
+			signed = append(signed, a)
+		}
+	}
+
+	if part == nil {
+		part, _, err = fimg.GetPartPrimSys()
+		if err != nil {
+			return 0, false, fmt.Errorf("no primary partition found")
+		}
+		a, _, _ := partArch(part)
+		sylog.Debugf("No %s partition found, verifying the %s primary partition", arch, a)
+		arch = a
+	}
+
+	id, isGroup, ok := partSignatures(fimg, part)
+	if !ok {
+		if len(signed) > 0 {
+			return 0, false, fmt.Errorf("the %s partition is not signed, only the partitions for %s are", arch, strings.Join(signed, ", "))
+		}
+		return 0, false, fmt.Errorf("no signatures found for the %s partition", arch)
+	}
+	return id, isGroup, nil
+}
+
+// VerifyInfo verifies the signatures of the system partition for arch of
+// the SIF image at cpath, rather than of its primary partition as done by
+// Verify without selection, so that the signature checked for an image
+// holding several architectures is the one of the pulled architecture.
+// It returns the keys of the signers, with their fingerprint and the
+// identity found for them locally or on the key server. keyServiceURI can
+// be a comma separated list of key servers.
+func VerifyInfo(ctx context.Context, cpath, arch, keyServiceURI, authToken string) ([]KeyEntity, error) {
+	id, isGroup, _, err := archSigners(cpath, arch)
+	if err != nil {
+		return nil, err
+	}
+	_, keys, _, err := verify(ctx, cpath, keyServiceURI, id, isGroup, false, authToken, false, false)
+	if err != nil {
+		return nil, err
+	}
+	signers := make([]KeyEntity, 0, len(keys.SignerKeys))
+	for _, k := range keys.SignerKeys {
+		signers = append(signers, k.Signer)
+	}
+	return signers, nil
+}
+
+// archSigners returns the selection of the signatures of the image at cpath
+// for arch, and the fingerprints of their signers.
+func archSigners(cpath, arch string) (id uint32, isGroup bool, signers []string, err error) {
+	fimg, err := loadContainer(cpath)
+	if err != nil {
+		return 0, false, nil, err
+	}
+	defer fimg.UnloadContainer()
+
+	id, isGroup, err = archSelection(&fimg, arch)
+	if err != nil {
+		return 0, false, nil, err
+	}
+	sigsLink, err := getSigsForSelection(&fimg, id, isGroup, false)
+	if err != nil {
+		return 0, false, nil, fmt.Errorf("error while searching for signature blocks: %s", err)
+	}
+	for _, l := range sigsLink {
+		fingerprint, err := fimg.DescrArr[l.sigIndex].GetEntityString()
+		if err != nil {
+			return 0, false, nil, fmt.Errorf("could not get the signing entity fingerprint: %s", err)
+		}
+		signers = append(signers, fingerprint)
+	}
+	return id, isGroup, signers, nil
+}
+
+// IsSignedArch is IsSigned for the system partition for arch of the image,
+// see VerifyInfo, returning the keys of the signers as VerifyInfo does. The
+// returned error tells why the image isn't signed.
+func IsSignedArch(ctx context.Context, cpath, arch, keyServerURI, authToken string) ([]KeyEntity, error) {
+	signers, err := VerifyInfo(ctx, cpath, arch, keyServerURI, authToken)
+	if errors.Is(err, ErrKeyServerUnreachable) {
+		return nil, fmt.Errorf("unable to verify container %s: it is signed but %w to fetch the keys of its signers", cpath, ErrKeyServerUnreachable)
+	} else if err != nil {
+		return nil, fmt.Errorf("unable to verify container %s: %w", cpath, err)
+	}
+	noLocalKey := false
+	for _, k := range signers {
+		noLocalKey = noLocalKey || !k.KeyLocal
+	}
+	if noLocalKey {
+		sylog.Warningf("Container might not be trusted; run 'singularity verify %s' to show who signed it", cpath)
+	} else {
+		sylog.Infof("Container is trusted - run 'singularity key list' to list your trusted keys")
+	}
+	return signers, nil
+}
+
+// Architectures returns the architectures of the system partitions of the
+// SIF image at cpath, as selected by VerifyInfo, the one of its primary
+// partition first.
+func Architectures(cpath string) ([]string, error) {
+	fimg, err := loadContainer(cpath)
+	if err != nil {
+		return nil, err
+	}
+	defer fimg.UnloadContainer()
+
+	var archs []string
+	for i := range fimg.DescrArr {
+		a, prim, ok := partArch(&fimg.DescrArr[i])
+		if !ok || stringInSlice(a, archs) {
+			continue
+		}
+		if prim {
+			archs = append([]string{a}, archs...)
+		} else {
+			archs = append(archs, a)
+		}
+	}
+	return archs, nil
+}
+
+// stringInSlice returns whether s is one of list.
+func stringInSlice(s string, list []string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
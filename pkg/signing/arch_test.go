@@ -0,0 +1,204 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package signing
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/sylabs/sif/pkg/sif"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/clearsign"
+)
+
+// createArchImage creates a SIF image with an amd64 primary partition in
+// group 1 and an arm64 partition in group 2, and a signature linked to
+// sigLink.
+func createArchImage(t *testing.T, path string, sigLink uint32) {
+	inputs := []sif.DescriptorInput{
+		{Datatype: sif.DataPartition, Groupid: sif.DescrGroupMask | 1, Fname: "amd64", Data: []byte("amd64 rootfs")},
+		{Datatype: sif.DataPartition, Groupid: sif.DescrGroupMask | 2, Fname: "arm64", Data: []byte("arm64 rootfs")},
+		{Datatype: sif.DataSignature, Groupid: sif.DescrUnusedGroup, Link: sigLink, Fname: "sig", Data: []byte("signature")},
+	}
+	if err := inputs[0].SetPartExtra(sif.FsSquash, sif.PartPrimSys, sif.HdrArchAMD64); err != nil {
+		t.Fatal(err)
+	}
+	if err := inputs[1].SetPartExtra(sif.FsSquash, sif.PartSystem, sif.HdrArchARM64); err != nil {
+		t.Fatal(err)
+	}
+	if err := inputs[2].SetSignExtra(sif.HashSHA384, "0123456789abcdef0123456789abcdef01234567"); err != nil {
+		t.Fatal(err)
+	}
+	for i := range inputs {
+		inputs[i].Size = int64(len(inputs[i].Data))
+		inputs[i].Fp = bytes.NewReader(inputs[i].Data)
+	}
+
+	fimg, err := sif.CreateContainer(sif.CreateInfo{
+		Pathname:   path,
+		Launchstr:  sif.HdrLaunch,
+		Sifversion: sif.HdrVersion,
+		ID:         uuid.NewV4(),
+		InputDescr: inputs,
+	})
+	if err != nil {
+		t.Fatalf("failed to create image: %v", err)
+	}
+	fimg.UnloadContainer()
+}
+
+func TestArchSigners(t *testing.T) {
+	dir, err := ioutil.TempDir("", "signing-arch-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name    string
+		sigLink uint32
+		arch    string
+		id      uint32
+		isGroup bool
+		err     string
+	}{
+		{"GroupSigned", sif.DescrGroupMask | 1, "amd64", 1, true, ""},
+		{"OtherArchSigned", sif.DescrGroupMask | 1, "arm64", 0, false, "the arm64 partition is not signed, only the partitions for amd64 are"},
+		{"MissingArch", sif.DescrGroupMask | 1, "ppc64le", 1, true, ""},
+		{"PartitionSigned", 2, "arm64", 2, false, ""},
+		{"PrimaryUnsigned", 2, "amd64", 0, false, "only the partitions for arm64 are"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name+".sif")
+			createArchImage(t, path, tt.sigLink)
+
+			id, isGroup, signers, err := archSigners(path, tt.arch)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("unexpected error %v, expected %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if id != tt.id || isGroup != tt.isGroup {
+				t.Errorf("selected id %d (group %v), expected %d (group %v)", id, isGroup, tt.id, tt.isGroup)
+			}
+			if len(signers) != 1 || signers[0] != "0123456789ABCDEF0123456789ABCDEF01234567" {
+				t.Errorf("unexpected signers %v", signers)
+			}
+		})
+	}
+}
+
+func TestVerifyInfo(t *testing.T) {
+	dir, err := ioutil.TempDir("", "signing-arch-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	defer func() { localKeyring = nil }()
+
+	e, err := openpgp.NewEntity("Test Name", "", "test@test.com", nil)
+	if err != nil {
+		t.Fatalf("failed to create entity: %v", err)
+	}
+	localKeyring = openpgp.EntityList{e}
+
+	// the arm64 partition is signed on its own
+	path := filepath.Join(dir, "image.sif")
+	createArchImage(t, path, sif.DescrGroupMask|1)
+	fimg, err := sif.LoadContainer(path, false)
+	if err != nil {
+		t.Fatalf("failed to load image: %v", err)
+	}
+	part := &fimg.DescrArr[1]
+	var signed bytes.Buffer
+	w, err := clearsign.Encode(&signed, e.PrivateKey, nil)
+	if err != nil {
+		t.Fatalf("failed to create signature: %v", err)
+	}
+	w.Write([]byte(computeHashStr(&fimg, []*sif.Descriptor{part})))
+	w.Close()
+	err = sifAddSignature(&fimg, part.Groupid, part.ID, e.PrimaryKey.Fingerprint, signed.Bytes())
+	fimg.UnloadContainer()
+	if err != nil {
+		t.Fatalf("failed to sign image: %v", err)
+	}
+
+	signers, err := VerifyInfo(context.Background(), path, "arm64", "", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	fp := strings.ToUpper(hex.EncodeToString(e.PrimaryKey.Fingerprint[:]))
+	if len(signers) != 1 || signers[0].Fingerprint != fp || signers[0].Name != "Test Name <test@test.com>" || !signers[0].KeyLocal {
+		t.Errorf("unexpected signers %+v, expected the local key %s", signers, fp)
+	}
+
+	// the amd64 one is signed by an unknown key
+	if _, err := VerifyInfo(context.Background(), path, "amd64", "", ""); err == nil {
+		t.Errorf("unexpected success verifying a partition with an invalid signature")
+	}
+}
+
+func TestArchitectures(t *testing.T) {
+	dir, err := ioutil.TempDir("", "signing-arch-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "image.sif")
+	createArchImage(t, path, sif.DescrGroupMask|1)
+	archs, err := Architectures(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(archs) != 2 || archs[0] != "amd64" || archs[1] != "arm64" {
+		t.Errorf("got architectures %v, expected [amd64 arm64]", archs)
+	}
+
+	page := filepath.Join(dir, "page.sif")
+	if err := ioutil.WriteFile(page, []byte("<html><body>502 Bad Gateway</body></html>"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	if _, err := Architectures(page); !errors.Is(err, ErrNotSIF) {
+		t.Errorf("expected %v for an HTML file, got %v", ErrNotSIF, err)
+	}
+}
+
+func TestArchSignersNotSIF(t *testing.T) {
+	dir, err := ioutil.TempDir("", "signing-arch-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// an error page served in place of the image
+	page := filepath.Join(dir, "page.sif")
+	if err := ioutil.WriteFile(page, []byte("<html><body>502 Bad Gateway</body></html>"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	if _, _, _, err := archSigners(page, "amd64"); !errors.Is(err, ErrNotSIF) {
+		t.Errorf("expected %v for an HTML file, got %v", ErrNotSIF, err)
+	}
+
+	// files that can't be read aren't reported as invalid images
+	if _, _, _, err := archSigners(filepath.Join(dir, "missing.sif"), "amd64"); err == nil || errors.Is(err, ErrNotSIF) {
+		t.Errorf("unexpected error for a missing file: %v", err)
+	}
+}
@@ -14,11 +14,14 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"net/http"
+	"net/url"
 	"os"
+	"sort"
+	"strings"
 
 	"github.com/fatih/color"
 	"github.com/sylabs/sif/pkg/sif"
+	"github.com/sylabs/singularity/internal/pkg/client"
 	"github.com/sylabs/singularity/pkg/sylog"
 	"github.com/sylabs/singularity/pkg/sypgp"
 	"golang.org/x/crypto/openpgp"
@@ -28,9 +31,42 @@ import (
 // ErrVerificationFail is the error when the verify fails
 var ErrVerificationFail = errors.New("verification failed")
 
+// ErrNotSIF is the error when the container to verify isn't a valid SIF
+// file, e.g. its header is corrupt or it is an error page downloaded in
+// place of the image.
+var ErrNotSIF = errors.New("not a valid SIF image")
+
+// ErrKeyServerUnreachable is the error when the key of a signer couldn't be
+// fetched as none of the key servers could be reached, rather than the image
+// being unsigned or signed by an unknown key.
+var ErrKeyServerUnreachable = errors.New("could not reach any key server")
+
 var errNotFound = errors.New("key does not exist in local, or remote keystore")
 var errNotFoundLocal = errors.New("key not in local keyring")
 
+// localKeyring holds the keys of the keyring file set with SetLocalKeyring.
+var localKeyring openpgp.EntityList
+
+// SetLocalKeyring makes the verifications look for the keys of the signers
+// in the keyring file path first, before the keyring of the user and the key
+// servers, so that images signed by a pre-distributed set of trusted keys
+// are verified without network access. An empty path unsets it.
+func SetLocalKeyring(path string) error {
+	if path == "" {
+		localKeyring = nil
+		return nil
+	}
+	el, err := sypgp.LoadKeyringFile(path)
+	if err != nil {
+		return fmt.Errorf("could not load keyring %s: %v", path, err)
+	}
+	if len(el) == 0 {
+		return fmt.Errorf("no keys found in keyring %s", path)
+	}
+	localKeyring = el
+	return nil
+}
+
 // Key is for json formatting.
 type Key struct {
 	Signer KeyEntity
@@ -376,10 +412,15 @@ func getSigsForSelection(fimg *sif.FileImage, id uint32, isGroup, verifyAll bool
 // container. Returns false if the container is not signed, likewise,
 // will return true if the container is signed. Also returns a error
 // if one occures, eg. "the container is not signed", or "container is
-// signed by a unknown signer".
+// signed by a unknown signer". keyServerURI can be a comma separated
+// list of key servers, tried in order.
 func IsSigned(ctx context.Context, cpath, keyServerURI string, authToken string) (bool, error) {
 	_, noLocalKey, err := Verify(ctx, cpath, keyServerURI, uint32(0), false, false, authToken, false, false)
-	if err != nil {
+	if errors.Is(err, ErrNotSIF) {
+		return false, fmt.Errorf("unable to verify container %s: %w", cpath, err)
+	} else if errors.Is(err, ErrKeyServerUnreachable) {
+		return false, fmt.Errorf("unable to verify container %s: it is signed but %w to fetch the keys of its signers", cpath, ErrKeyServerUnreachable)
+	} else if err != nil {
 		return false, fmt.Errorf("unable to verify container: %s", cpath)
 	}
 	if noLocalKey {
@@ -394,24 +435,32 @@ func IsSigned(ctx context.Context, cpath, keyServerURI string, authToken string)
 // for a specified descriptor. If found, the signature block is used to verify
 // the partition hash against the signer's version. Verify will look for OpenPGP
 // keys in the default local keyring, if non is found, it will then looks it up
-// from a key server if access is enabled, or if localVerify is false. Returns
+// from a key server if access is enabled, or if localVerify is false. The key
+// servers of the comma separated list keyServiceURI are tried in order until
+// one returns the key. Returns
 // a string of formatted output, or json (if jsonVerify is true), and true, if
 // theres no local key matching a signers entity.
 func Verify(ctx context.Context, cpath, keyServiceURI string, id uint32, isGroup, verifyAll bool, authToken string, localVerify, jsonVerify bool) (string, bool, error) {
+	author, _, notLocalKey, err := verify(ctx, cpath, keyServiceURI, id, isGroup, verifyAll, authToken, localVerify, jsonVerify)
+	return author, notLocalKey, err
+}
+
+// verify is Verify, also returning the keys of the signers.
+func verify(ctx context.Context, cpath, keyServiceURI string, id uint32, isGroup, verifyAll bool, authToken string, localVerify, jsonVerify bool) (string, KeyList, bool, error) {
 	keyring := sypgp.NewHandle("")
 
 	notLocalKey := false
 
-	fimg, err := sif.LoadContainer(cpath, true)
+	fimg, err := loadContainer(cpath)
 	if err != nil {
-		return "", false, fmt.Errorf("failed to load SIF container file: %s", err)
+		return "", KeyList{}, false, err
 	}
 	defer fimg.UnloadContainer()
 
 	// Get all signature blocks (signatures) for ID/GroupID selected (descr) from SIF file.
 	sigsLink, err := getSigsForSelection(&fimg, id, isGroup, verifyAll)
 	if err != nil {
-		return "", false, fmt.Errorf("error while searching for signature blocks: %s", err)
+		return "", KeyList{}, false, fmt.Errorf("error while searching for signature blocks: %s", err)
 	}
 
 	// Setup some colors.
@@ -420,6 +469,9 @@ func Verify(ctx context.Context, cpath, keyServiceURI string, id uint32, isGroup
 	red := color.New(color.FgRed).SprintFunc()
 
 	var fail bool
+	// unreachable is set if the key of a signer couldn't be fetched as no
+	// key server could be reached
+	var unreachable bool
 	var errRet error
 	var author string
 
@@ -482,11 +534,14 @@ func Verify(ctx context.Context, cpath, keyServiceURI string, id uint32, isGroup
 		i, local, err := getSignerIdentity(ctx, keyring, &fimg.DescrArr[part.sigIndex], block, data, fingerprint, keyServiceURI, authToken, localVerify)
 		if err != nil {
 			// use [MISSING] if we get an error we expect
-			if err == errNotFound || err == errNotFoundLocal {
+			if err == errNotFound || err == errNotFoundLocal || err == ErrKeyServerUnreachable {
 				author += fmt.Sprintf("%-18s %s\n", red("[MISSING]"), err)
 			} else {
 				author += fmt.Sprintf("%-18s %s\n", red("[FAIL]"), err)
 			}
+			if err == ErrKeyServerUnreachable {
+				unreachable = true
+			}
 			fail = true
 		} else {
 			prefix := green("[LOCAL]")
@@ -519,16 +574,18 @@ func Verify(ctx context.Context, cpath, keyServiceURI string, id uint32, isGroup
 	if jsonVerify {
 		jsonData, err := json.MarshalIndent(keyEntityList, "", "  ")
 		if err != nil {
-			return "", notLocalKey, fmt.Errorf("unable to parse json: %s", err)
+			return "", keyEntityList, notLocalKey, fmt.Errorf("unable to parse json: %s", err)
 		}
 		author = string(jsonData) + "\n"
 	}
 
-	if fail {
+	if fail && unreachable {
+		errRet = fmt.Errorf("%v: %w", ErrVerificationFail, ErrKeyServerUnreachable)
+	} else if fail {
 		errRet = ErrVerificationFail
 	}
 
-	return author, notLocalKey, errRet
+	return author, keyEntityList, notLocalKey, errRet
 }
 
 func makeKeyEntity(name, partition, fingerprint string, local, corrupted, dataCheck bool) *Key {
@@ -559,6 +616,19 @@ func getFirstIdentity(e *openpgp.Entity) string {
 }
 
 func getSignerIdentity(ctx context.Context, keyring *sypgp.Handle, v *sif.Descriptor, block *clearsign.Block, data []byte, fingerprint, keyServiceURI, authToken string, local bool) (string, bool, error) {
+	// the keys of the keyring set with SetLocalKeyring are trusted as
+	// local ones, and tried first
+	if len(localKeyring) > 0 {
+		signer, err := openpgp.CheckDetachedSignature(localKeyring, bytes.NewBuffer(block.Bytes), block.ArmoredSignature.Body)
+		if err == nil {
+			return getFirstIdentity(signer), true, nil
+		}
+		block, _ = clearsign.Decode(data)
+		if block == nil {
+			return "", false, fmt.Errorf("failed to parse signature block")
+		}
+	}
+
 	// load the public keys available locally from the cache
 	elist, err := keyring.LoadPubKeyring()
 	if err != nil {
@@ -585,12 +655,15 @@ func getSignerIdentity(ctx context.Context, keyring *sypgp.Handle, v *sif.Descri
 
 	// download the key
 	sylog.Verbosef("Key not found in local keyring, checking remote keystore: %s\n", fingerprint[32:])
-	netlist, err := sypgp.FetchPubkey(ctx, http.DefaultClient, fingerprint, keyServiceURI, authToken, true)
-	if err != nil {
+	netlist, err := fetchPubkey(ctx, fingerprint, keyServiceURI, authToken)
+	if errors.Is(err, ErrKeyServerUnreachable) {
+		sylog.Verbosef("%v", err)
+		return "", false, ErrKeyServerUnreachable
+	} else if err != nil {
+		sylog.Verbosef("%v", err)
 		return "", false, errNotFound
 	}
 
-	sylog.Verbosef("Found key in remote keystore: %s", fingerprint[32:])
 	// search remote keyring for key that matches signature
 	signer, err = openpgp.CheckDetachedSignature(netlist, bytes.NewBuffer(block.Bytes), block.ArmoredSignature.Body)
 	if err == nil {
@@ -600,6 +673,54 @@ func getSignerIdentity(ctx context.Context, keyring *sypgp.Handle, v *sif.Descri
 	return "", false, err
 }
 
+// KeyServers returns the key servers of the comma separated list uris.
+func KeyServers(uris string) []string {
+	var servers []string
+	for _, uri := range strings.Split(uris, ",") {
+		if uri = strings.TrimSpace(uri); uri != "" {
+			servers = append(servers, uri)
+		}
+	}
+	if len(servers) == 0 {
+		// the key service client falls back to its default server
+		return []string{""}
+	}
+	return servers
+}
+
+// fetchPubkey downloads the key with the given fingerprint from the first
+// key server of the comma separated list keyServiceURIs that returns it. The
+// failures of the key servers are only warnings unless they all fail, the
+// error wrapping ErrKeyServerUnreachable if none of them could be reached.
+func fetchPubkey(ctx context.Context, fingerprint, keyServiceURIs, authToken string) (openpgp.EntityList, error) {
+	servers := KeyServers(keyServiceURIs)
+
+	var errs []string
+	reached := false
+	// through the proxy of the pull, if any
+	httpClient := client.NewHTTPClient(0)
+	for _, uri := range servers {
+		el, err := sypgp.FetchPubkey(ctx, httpClient, fingerprint, uri, authToken, true)
+		if err == nil {
+			sylog.Verbosef("Found key in remote keystore %s: %s", uri, fingerprint[32:])
+			return el, nil
+		}
+		if len(servers) > 1 {
+			sylog.Warningf("Could not fetch key %s from key server %s: %v", fingerprint[32:], uri, err)
+		}
+		errs = append(errs, fmt.Sprintf("%s: %v", uri, err))
+		// a server replying with an error was reached
+		var urlErr *url.Error
+		if !errors.As(err, &urlErr) {
+			reached = true
+		}
+	}
+	if !reached {
+		return nil, fmt.Errorf("key %s could not be fetched: %w: %s", fingerprint[32:], ErrKeyServerUnreachable, strings.Join(errs, "; "))
+	}
+	return nil, fmt.Errorf("key %s could not be fetched from any key server: %s", fingerprint[32:], strings.Join(errs, "; "))
+}
+
 // getSigsLinkPrimPart is just like getSigsPrimPart, but returns a []signatureLink
 // instead of descriptors.
 func getSigsLinkPrimPart(fimg *sif.FileImage) ([]signatureLink, error) {
@@ -659,6 +780,21 @@ func getSignEntities(fimg *sif.FileImage) ([]string, error) {
 	return entities, nil
 }
 
+// loadContainer loads the SIF container at cpath read-only to verify it. The
+// returned error wraps ErrNotSIF if the file could be read but isn't a SIF
+// container, as opposed to a file that can't be opened.
+func loadContainer(cpath string) (sif.FileImage, error) {
+	fimg, err := sif.LoadContainer(cpath, true)
+	if err == nil {
+		return fimg, nil
+	}
+	if f, openErr := os.Open(cpath); openErr == nil {
+		f.Close()
+		return fimg, fmt.Errorf("failed to load SIF container file: %w: %s", ErrNotSIF, err)
+	}
+	return fimg, fmt.Errorf("failed to load SIF container file: %s", err)
+}
+
 // GetSignEntities returns all signing entities for an ID/Groupid
 func GetSignEntities(cpath string) ([]string, error) {
 	fimg, err := sif.LoadContainer(cpath, true)
@@ -680,3 +816,34 @@ func GetSignEntitiesFp(fp *os.File) ([]string, error) {
 
 	return getSignEntities(&fimg)
 }
+
+// StripSignatures removes the signature data objects from the SIF container
+// at cpath and returns how many were removed. The container should have been
+// verified before, as it can't be afterwards.
+func StripSignatures(cpath string) (int, error) {
+	fimg, err := sif.LoadContainer(cpath, false)
+	if err != nil {
+		return 0, fmt.Errorf("failed to load SIF container file: %s", err)
+	}
+	defer fimg.UnloadContainer()
+
+	var sigs []sif.Descriptor
+	for _, d := range fimg.DescrArr {
+		if d.Used && d.Datatype == sif.DataSignature {
+			sigs = append(sigs, d)
+		}
+	}
+
+	// signatures are appended to the container, deleting them from the
+	// end of the file allows to truncate it each time
+	sort.Slice(sigs, func(i, j int) bool {
+		return sigs[i].Fileoff > sigs[j].Fileoff
+	})
+	for _, d := range sigs {
+		if err := fimg.DeleteObject(d.ID, 0); err != nil {
+			return 0, fmt.Errorf("failed to delete signature object %d: %s", d.ID, err)
+		}
+	}
+
+	return len(sigs), nil
+}
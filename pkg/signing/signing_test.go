@@ -0,0 +1,242 @@
+// Copyright (c) 2020, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package signing
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/sylabs/sif/pkg/sif"
+	"github.com/sylabs/singularity/pkg/sypgp"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/crypto/openpgp/clearsign"
+)
+
+func TestStripSignatures(t *testing.T) {
+	dir, err := ioutil.TempDir("", "strip-signatures-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	data := []byte("container data")
+	sig := []byte("signature")
+
+	path := filepath.Join(dir, "image.sif")
+	cinfo := sif.CreateInfo{
+		Pathname:   path,
+		Launchstr:  sif.HdrLaunch,
+		Sifversion: sif.HdrVersion,
+		ID:         uuid.NewV4(),
+		InputDescr: []sif.DescriptorInput{
+			{
+				Datatype: sif.DataGeneric,
+				Groupid:  sif.DescrDefaultGroup,
+				Size:     int64(len(data)),
+				Fname:    "data",
+				Fp:       bytes.NewReader(data),
+			},
+			{
+				Datatype: sif.DataSignature,
+				Groupid:  sif.DescrUnusedGroup,
+				Link:     1,
+				Size:     int64(len(sig)),
+				Fname:    "signature",
+				Fp:       bytes.NewReader(sig),
+			},
+		},
+	}
+	if err := cinfo.InputDescr[1].SetSignExtra(sif.HashSHA384, "0123456789abcdef0123456789abcdef01234567"); err != nil {
+		t.Fatalf("failed to set signature extra data: %v", err)
+	}
+	if _, err := sif.CreateContainer(cinfo); err != nil {
+		t.Fatalf("failed to create container: %v", err)
+	}
+
+	before, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("failed to stat container: %v", err)
+	}
+
+	n, err := StripSignatures(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("expected 1 signature to be removed, got %d", n)
+	}
+
+	after, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("failed to stat container: %v", err)
+	}
+	if after.Size() > before.Size()-int64(len(sig)) {
+		t.Errorf("expected container to shrink from %d bytes, got %d", before.Size(), after.Size())
+	}
+
+	fimg, err := sif.LoadContainer(path, true)
+	if err != nil {
+		t.Fatalf("failed to load container: %v", err)
+	}
+	defer fimg.UnloadContainer()
+
+	for _, d := range fimg.DescrArr {
+		if d.Used && d.Datatype == sif.DataSignature {
+			t.Errorf("signature object %d was not removed", d.ID)
+		}
+	}
+	if _, _, err := fimg.GetFromDescrID(1); err != nil {
+		t.Errorf("data object was removed: %v", err)
+	}
+
+	if n, err := StripSignatures(path); err != nil || n != 0 {
+		t.Errorf("expected no signature on unsigned container, got %d: %v", n, err)
+	}
+}
+
+func TestKeyServers(t *testing.T) {
+	tests := []struct {
+		uris     string
+		expected []string
+	}{
+		{"", []string{""}},
+		{"https://keys.sylabs.io", []string{"https://keys.sylabs.io"}},
+		{"https://primary, https://backup,", []string{"https://primary", "https://backup"}},
+	}
+	for _, tt := range tests {
+		if got := KeyServers(tt.uris); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("KeyServers(%q) = %q, expected %q", tt.uris, got, tt.expected)
+		}
+	}
+}
+
+func TestFetchPubkeyFallback(t *testing.T) {
+	e, err := openpgp.NewEntity("Test Name", "", "test@test.com", nil)
+	if err != nil {
+		t.Fatalf("failed to create entity: %v", err)
+	}
+	fp := hex.EncodeToString(e.PrimaryKey.Fingerprint[:])
+
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/pgp-keys")
+		wr, err := armor.Encode(w, openpgp.PublicKeyType, nil)
+		if err != nil {
+			t.Errorf("failed to get encoder: %v", err)
+			return
+		}
+		defer wr.Close()
+		if err := e.Serialize(wr); err != nil {
+			t.Errorf("failed to serialize entity: %v", err)
+		}
+	}))
+	defer up.Close()
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	tests := []struct {
+		name            string
+		uris            string
+		wantErr         bool
+		wantUnreachable bool
+	}{
+		{"Single", up.URL, false, false},
+		{"BackupServer", down.URL + "," + up.URL, false, false},
+		{"UnreachableServer", closed.URL + "," + up.URL, false, false},
+		{"AllFailed", down.URL + "," + down.URL, true, false},
+		{"OneReached", closed.URL + "," + down.URL, true, false},
+		{"NoneReached", closed.URL + "," + closed.URL, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			el, err := fetchPubkey(context.Background(), fp, tt.uris, "")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if errors.Is(err, ErrKeyServerUnreachable) != tt.wantUnreachable {
+				t.Errorf("got error %v, want unreachable %v", err, tt.wantUnreachable)
+			}
+			if !tt.wantErr && (len(el) != 1 || el[0].PrimaryKey.Fingerprint != e.PrimaryKey.Fingerprint) {
+				t.Errorf("unexpected keys fetched: %v", el)
+			}
+		})
+	}
+}
+
+func TestLocalKeyring(t *testing.T) {
+	dir, err := ioutil.TempDir("", "local-keyring-")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	defer SetLocalKeyring("")
+
+	e, err := openpgp.NewEntity("Test Name", "", "test@test.com", nil)
+	if err != nil {
+		t.Fatalf("failed to create entity: %v", err)
+	}
+	fp := hex.EncodeToString(e.PrimaryKey.Fingerprint[:])
+
+	var signed bytes.Buffer
+	w, err := clearsign.Encode(&signed, e.PrivateKey, nil)
+	if err != nil {
+		t.Fatalf("failed to create signature: %v", err)
+	}
+	w.Write([]byte("hash"))
+	w.Close()
+	data := signed.Bytes()
+
+	path := filepath.Join(dir, "trusted.asc")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("failed to create keyring: %v", err)
+	}
+	aw, err := armor.Encode(f, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatalf("failed to get encoder: %v", err)
+	}
+	if err := e.Serialize(aw); err != nil {
+		t.Fatalf("failed to serialize entity: %v", err)
+	}
+	aw.Close()
+	f.Close()
+
+	// the keyring of the user is empty and no key server is reachable
+	keyring := sypgp.NewHandle(filepath.Join(dir, "sypgp"))
+	block, _ := clearsign.Decode(data)
+	if _, _, err := getSignerIdentity(context.Background(), keyring, nil, block, data, fp, "", "", true); err != errNotFoundLocal {
+		t.Fatalf("unexpected error without local keyring: %v", err)
+	}
+
+	if err := SetLocalKeyring(filepath.Join(dir, "missing.asc")); err == nil {
+		t.Errorf("unexpected success loading a missing keyring")
+	}
+	if err := SetLocalKeyring(path); err != nil {
+		t.Fatalf("failed to set local keyring: %v", err)
+	}
+	block, _ = clearsign.Decode(data)
+	name, local, err := getSignerIdentity(context.Background(), keyring, nil, block, data, fp, "", "", true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !local || name != "Test Name <test@test.com>" {
+		t.Errorf("unexpected signer %q (local %v)", name, local)
+	}
+}
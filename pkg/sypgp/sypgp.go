@@ -214,6 +214,12 @@ func (keyring *Handle) LoadPubKeyring() (openpgp.EntityList, error) {
 	return loadKeyring(keyring.PublicPath())
 }
 
+// LoadKeyringFile loads the keys of the keyring file fn, in binary or ascii
+// armored format, as written by 'singularity key export'.
+func LoadKeyringFile(fn string) (openpgp.EntityList, error) {
+	return loadKeysFromFile(fn)
+}
+
 // loadKeysFromFile loads one or more keys from the specified file.
 //
 // The key can be either a public or private key, and the file might be
@@ -808,7 +814,7 @@ func FetchPubkey(ctx context.Context, httpClient *http.Client, fingerprint, keys
 		} else if ok && jerr.Code == http.StatusNotFound {
 			return nil, fmt.Errorf("no matching keys found for fingerprint")
 		} else {
-			return nil, fmt.Errorf("failed to get key: %v", err)
+			return nil, fmt.Errorf("failed to get key: %w", err)
 		}
 	}
 
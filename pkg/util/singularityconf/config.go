@@ -61,6 +61,15 @@ type File struct {
 	MksquashfsMem           string   `directive:"mksquashfs mem"`
 	CryptsetupPath          string   `directive:"cryptsetup path"`
 	ImageDriver             string   `directive:"image driver"`
+	RegistryMirror          string   `directive:"registry mirror"`
+	AllowedPullHosts        []string `directive:"allowed pull hosts"`
+	PullReportURL           string   `directive:"pull report url"`
+	PullReportImageNames    bool     `default:"no" authorized:"yes,no" directive:"pull report image names"`
+	PullScan                bool     `default:"no" authorized:"yes,no" directive:"pull scan"`
+	PullScanCommand         string   `directive:"pull scan command"`
+	PullScanCleanExitCode   uint     `default:"0" directive:"pull scan clean exit code"`
+	PullCollectionArch      []string `directive:"pull collection arch"`
+	PullUnsigned            string   `default:"prompt" authorized:"prompt,allow,deny" directive:"pull unsigned"`
 }
 
 const TemplateAsset = `# SINGULARITY.CONF
@@ -350,4 +359,85 @@ shared loop devices = {{ if eq .SharedLoopDevices true }}yes{{ else }}no{{ end }
 # If the driver name specified has not been registered via a plugin installation
 # the run-time will abort.
 image driver = {{ .ImageDriver }}
+
+# REGISTRY MIRROR: [STRING]
+# DEFAULT: Undefined
+# This option specifies a registry mirror host, optionally with a path, which
+# docker.io images are pulled from instead. It can be overridden with the
+# pull --registry-mirror option.
+# registry mirror = mirror.example.com
+{{ if ne .RegistryMirror "" }}registry mirror = {{ .RegistryMirror }}{{ end }}
+
+# ALLOWED PULL HOSTS: [STRING]
+# DEFAULT: NULL
+# Only allow images to be pulled from the listed library, registry or web
+# server hosts. A host may include a port, and '*.example.com' allows all the
+# sub-domains of example.com. If this configuration is undefined (commented or
+# set to NULL), images can be pulled from any host. The pull --allowed-host
+# option can only restrict this list further.
+#allowed pull hosts = library.sylabs.io, *.example.com, 10.0.0.1:5000
+{{ range $index, $host := .AllowedPullHosts }}
+{{- if eq $index 0 }}allowed pull hosts = {{ else }}, {{ end }}{{$host}}
+{{- end }}
+
+# PULL REPORT URL: [STRING]
+# DEFAULT: Undefined
+# This option specifies a URL an anonymized event is posted to after each
+# pull, holding its transport, the size range of the image, its duration,
+# whether it succeeded and how the cache was used, but neither the image nor
+# the user. It can be overridden with the pull --report-to option.
+# pull report url = https://metrics.example.com/pull
+{{ if ne .PullReportURL "" }}pull report url = {{ .PullReportURL }}{{ end }}
+
+# PULL REPORT IMAGE NAMES: [BOOL]
+# DEFAULT: no
+# Include the pulled image, without credentials, in the pull events posted to
+# the pull report url.
+pull report image names = {{ if eq .PullReportImageNames true }}yes{{ else }}no{{ end }}
+
+# PULL SCAN: [BOOL]
+# DEFAULT: no
+# Scan every pulled image with the pull scan command, as with the pull --scan
+# option, the image being removed and the pull failing unless the scanner
+# reports it clean. The pull scan command and clean exit code can't be
+# overridden by the pull options then.
+pull scan = {{ if eq .PullScan true }}yes{{ else }}no{{ end }}
+
+# PULL SCAN COMMAND: [STRING]
+# DEFAULT: Undefined
+# This option specifies the scanner command pulled images are scanned with,
+# the path of the image being appended to its arguments. It can be
+# overridden with the pull --scan-command option, unless pull scan is set.
+# pull scan command = clamdscan --fdpass --no-summary
+{{ if ne .PullScanCommand "" }}pull scan command = {{ .PullScanCommand }}{{ end }}
+
+# PULL SCAN CLEAN EXIT CODE: [UINT]
+# DEFAULT: 0
+# The exit code of the pull scan command for a clean image, any other exit
+# code failing the pull. It can be overridden with the pull
+# --scan-clean-exit-code option, unless pull scan is set.
+pull scan clean exit code = {{ .PullScanCleanExitCode }}
+
+# PULL COLLECTION ARCH: [STRING]
+# DEFAULT: NULL
+# The default architectures of the library images of some entities or
+# collections, as <prefix>=<arch> entries, the longest prefix matching the
+# entity/collection of an image applying. Library images are pulled for
+# that architecture unless the pull --arch or --arch-fallback options are
+# given, while the others are pulled for the host architecture.
+#pull collection arch = myorg/arm-builds=arm64, myorg=amd64
+{{ range $index, $entry := .PullCollectionArch }}
+{{- if eq $index 0 }}pull collection arch = {{ else }}, {{ end }}{{$entry}}
+{{- end }}
+
+# PULL UNSIGNED: [STRING]
+# DEFAULT: prompt
+# What pull does with the images whose signatures can't be verified. With
+# prompt, they are kept with a warning, or silently with the pull
+# --allow-unauthenticated option. With allow, they are kept silently unless
+# pull --fail-on-unsigned or --require-signature is given. With deny, they
+# are removed and the pull fails with exit code 3, as with pull
+# --fail-on-unsigned, whatever the transport, and --allow-unauthenticated is
+# rejected.
+pull unsigned = {{ .PullUnsigned }}
 `
@@ -27,7 +27,13 @@ func Value() string {
 // InitValue sets value that will be returned when
 // user queries singularity version.
 func InitValue(name, version string) {
-	value = fmt.Sprintf("%v (%v %v) %v",
+	value = New(name, version)
+}
+
+// New returns the user agent of the version of the program name, as
+// InitValue sets it.
+func New(name, version string) string {
+	return fmt.Sprintf("%v (%v %v) %v",
 		singularityVersion(name, version),
 		strings.Title(runtime.GOOS),
 		runtime.GOARCH,
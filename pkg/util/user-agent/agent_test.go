@@ -18,3 +18,11 @@ func TestSingularityVersion(t *testing.T) {
 		t.Fatalf("user agent did not match regexp")
 	}
 }
+
+func TestNew(t *testing.T) {
+	InitValue("singularity", "3.0.0")
+
+	if v := New("singularity", "3.0.0"); v != Value() {
+		t.Fatalf("got user agent %q, want the one of InitValue %q", v, Value())
+	}
+}